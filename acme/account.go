@@ -112,6 +112,7 @@ type ExternalAccountKey struct {
 	HmacKey       []byte    `json:"-"`
 	CreatedAt     time.Time `json:"createdAt"`
 	BoundAt       time.Time `json:"boundAt,omitempty"`
+	ExpiresAt     time.Time `json:"expiresAt,omitempty"`
 	Policy        *Policy   `json:"policy,omitempty"`
 }
 
@@ -121,12 +122,21 @@ func (eak *ExternalAccountKey) AlreadyBound() bool {
 	return !eak.BoundAt.IsZero()
 }
 
+// IsExpired returns whether this EAK has an expiration time
+// and it has passed. Expired EAKs cannot be bound to an account.
+func (eak *ExternalAccountKey) IsExpired() bool {
+	return !eak.ExpiresAt.IsZero() && !clock.Now().Before(eak.ExpiresAt)
+}
+
 // BindTo binds the EAK to an Account.
-// It returns an error if it's already bound.
+// It returns an error if it's already bound or it has expired.
 func (eak *ExternalAccountKey) BindTo(account *Account) error {
 	if eak.AlreadyBound() {
 		return NewError(ErrorUnauthorizedType, "external account binding key with id '%s' was already bound to account '%s' on %s", eak.ID, eak.AccountID, eak.BoundAt)
 	}
+	if eak.IsExpired() {
+		return NewError(ErrorUnauthorizedType, "external account binding key with id '%s' expired on %s", eak.ID, eak.ExpiresAt)
+	}
 	eak.AccountID = account.ID
 	eak.BoundAt = time.Now()
 	eak.HmacKey = []byte{} // clearing the key bytes; can only be used once
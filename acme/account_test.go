@@ -135,6 +135,20 @@ func TestExternalAccountKey_BindTo(t *testing.T) {
 			},
 			err: NewError(ErrorUnauthorizedType, "external account binding key with id '%s' was already bound to account '%s' on %s", "eakID", "someAccountID", boundAt),
 		},
+		{
+			name: "fail/expired",
+			eak: &ExternalAccountKey{
+				ID:            "eakID",
+				ProvisionerID: "provID",
+				Reference:     "ref",
+				HmacKey:       []byte{1, 3, 3, 7},
+				ExpiresAt:     boundAt.Add(-time.Minute),
+			},
+			acct: &Account{
+				ID: "accountID",
+			},
+			err: NewError(ErrorUnauthorizedType, "external account binding key with id '%s' expired on %s", "eakID", boundAt.Add(-time.Minute)),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
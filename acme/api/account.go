@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"go.step.sm/crypto/jose"
 
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api/render"
@@ -131,6 +133,13 @@ func NewAccount(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if err := acme.CheckRateLimits(ctx, db, prov, acme.RateLimitNewAccount, acme.RateLimitSubject{
+			IP: clientIP(r),
+		}); err != nil {
+			render.Error(w, err)
+			return
+		}
+
 		acc = &acme.Account{
 			Key:             jwk,
 			Contact:         nar.Contact,
@@ -224,7 +233,18 @@ func logOrdersByAccount(w http.ResponseWriter, oids []string) {
 	}
 }
 
-// GetOrdersByAccountID ACME api for retrieving the list of order urls belonging to an account.
+// ordersPageSize is the maximum number of orders returned by a request to the
+// orders URL of an account.
+var ordersPageSize = 100
+
+// OrdersList is the list of order urls belonging to an account.
+type OrdersList struct {
+	Orders []string `json:"orders"`
+}
+
+// GetOrdersByAccountID ACME api for retrieving the list of order urls belonging
+// to an account. The list is paginated, if there are more orders a link to the
+// next page is added to the response headers.
 func GetOrdersByAccountID(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	db := acme.MustDatabaseFromContext(ctx)
@@ -241,14 +261,162 @@ func GetOrdersByAccountID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var cursor int
+	if s := r.URL.Query().Get("cursor"); s != "" {
+		if cursor, err = strconv.Atoi(s); err != nil || cursor < 0 {
+			render.Error(w, acme.NewError(acme.ErrorMalformedType, "cursor '%s' is not valid", s))
+			return
+		}
+	}
+
 	orders, err := db.GetOrdersByAccountID(ctx, acc.ID)
 	if err != nil {
 		render.Error(w, err)
 		return
 	}
 
+	if cursor > len(orders) {
+		cursor = len(orders)
+	}
+	end := len(orders)
+	if end-cursor > ordersPageSize {
+		end = cursor + ordersPageSize
+		next := linker.GetLink(ctx, acme.OrdersByAccountLinkType, acc.ID) + "?cursor=" + strconv.Itoa(end)
+		w.Header().Add("Link", link(next, "next"))
+	}
+	orders = orders[cursor:end]
+
 	linker.LinkOrdersByAccountID(ctx, orders)
 
-	render.JSON(w, orders)
+	render.JSON(w, &OrdersList{Orders: orders})
 	logOrdersByAccount(w, orders)
 }
+
+// KeyChangeRequest represents the payload of the inner JWS of a key-change
+// request.
+type KeyChangeRequest struct {
+	Account string           `json:"account"`
+	OldKey  *jose.JSONWebKey `json:"oldKey"`
+}
+
+// KeyChange is the ACME api for rolling over the key of an account. The
+// payload of the request is a JWS signed by the new key, whose payload
+// contains the account URL and the old key.
+func KeyChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	jws, err := jwsFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	newKey, err := verifyKeyChange(jws, payload.value, acc)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	newKeyID, err := acme.KeyToID(newKey)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	other, err := db.GetAccountByKeyID(ctx, newKeyID)
+	switch {
+	case acme.IsErrNotFound(err):
+	case err != nil:
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving account by key"))
+		return
+	default:
+		w.Header().Set("Location", linker.GetLink(ctx, acme.AccountLinkType, other.ID))
+		acmeErr := acme.NewError(acme.ErrorMalformedType, "new key is already in use by another account")
+		acmeErr.Status = http.StatusConflict
+		render.Error(w, acmeErr)
+		return
+	}
+
+	newKey.KeyID = newKeyID
+	acc.Key = newKey
+	if err := db.UpdateAccount(ctx, acc); err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error updating account key"))
+		return
+	}
+
+	linker.LinkAccount(ctx, acc)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AccountLinkType, acc.ID))
+	render.JSON(w, acc)
+}
+
+// verifyKeyChange verifies the inner JWS of a key-change request following RFC
+// 8555 section 7.3.5 and returns the new key of the account.
+func verifyKeyChange(outer *jose.JSONWebSignature, payload []byte, acc *acme.Account) (*jose.JSONWebKey, error) {
+	inner, err := jose.ParseJWS(string(payload))
+	if err != nil {
+		return nil, acme.WrapError(acme.ErrorMalformedType, err, "failed to parse inner JWS")
+	}
+	if len(inner.Signatures) != 1 {
+		return nil, acme.NewError(acme.ErrorMalformedType, "inner JWS must have exactly one signature")
+	}
+
+	hdr := inner.Signatures[0].Protected
+	newKey := hdr.JSONWebKey
+	switch {
+	case newKey == nil:
+		return nil, acme.NewError(acme.ErrorMalformedType, "inner JWS must have a jwk header")
+	case !newKey.Valid() || !newKey.IsPublic():
+		return nil, acme.NewError(acme.ErrorMalformedType, "inner JWS has an invalid jwk header")
+	case hdr.Nonce != "":
+		return nil, acme.NewError(acme.ErrorMalformedType, "inner JWS must not have a nonce header")
+	}
+	if err := validateJWSAlgorithm(hdr); err != nil {
+		return nil, err
+	}
+
+	outerHdr := outer.Signatures[0].Protected
+	innerURL, ok := hdr.ExtraHeaders["url"].(string)
+	if !ok || innerURL != outerHdr.ExtraHeaders["url"] {
+		return nil, acme.NewError(acme.ErrorMalformedType, "url header in inner JWS does not match the outer JWS")
+	}
+
+	b, err := inner.Verify(newKey)
+	if err != nil {
+		return nil, acme.WrapError(acme.ErrorMalformedType, err, "error verifying inner JWS")
+	}
+	var kcr KeyChangeRequest
+	if err := json.Unmarshal(b, &kcr); err != nil {
+		return nil, acme.WrapError(acme.ErrorMalformedType, err, "failed to unmarshal key-change request payload")
+	}
+	if kcr.Account != outerHdr.KeyID {
+		return nil, acme.NewError(acme.ErrorMalformedType, "account '%s' does not match the kid of the outer JWS", kcr.Account)
+	}
+	if kcr.OldKey == nil {
+		return nil, acme.NewError(acme.ErrorMalformedType, "oldKey cannot be empty")
+	}
+
+	oldKeyID, err := acme.KeyToID(kcr.OldKey)
+	if err != nil {
+		return nil, err
+	}
+	accKeyID, err := acme.KeyToID(acc.Key)
+	if err != nil {
+		return nil, err
+	}
+	if oldKeyID != accKeyID {
+		return nil, acme.NewError(acme.ErrorMalformedType, "oldKey does not match the account key")
+	}
+	return newKey, nil
+}
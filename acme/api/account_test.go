@@ -3,6 +3,8 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/json"
 	"fmt"
@@ -21,6 +23,8 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/mdm"
+	"github.com/smallstep/certificates/webhook"
 )
 
 var (
@@ -47,7 +51,19 @@ func (*fakeProvisioner) IsChallengeEnabled(context.Context, provisioner.ACMEChal
 func (*fakeProvisioner) IsAttestationFormatEnabled(context.Context, provisioner.ACMEAttestationFormat) bool {
 	return true
 }
-func (*fakeProvisioner) GetAttestationRoots() (*x509.CertPool, bool)   { return nil, false }
+func (*fakeProvisioner) GetAttestationRoots() (*x509.CertPool, bool)           { return nil, false }
+func (*fakeProvisioner) GetTPMEndorsementRoots() (*x509.CertPool, bool)        { return nil, false }
+func (*fakeProvisioner) GetAndroidKeyAttestationRoots() (*x509.CertPool, bool) { return nil, false }
+func (*fakeProvisioner) GetCAAIdentities() []string                            { return nil }
+func (*fakeProvisioner) GetCAAOptions() *provisioner.ACMECAAOptions            { return nil }
+func (*fakeProvisioner) GetAttestationRevocationPolicy() provisioner.ACMERevocationPolicy {
+	return provisioner.RevocationPolicyDisable
+}
+func (*fakeProvisioner) GetDeviceInventory() mdm.Provider           { return nil }
+func (*fakeProvisioner) GetRateLimits() *provisioner.ACMERateLimits { return nil }
+func (*fakeProvisioner) AuthorizeDeviceAttestation(context.Context, *webhook.DeviceAttestationData) error {
+	return nil
+}
 func (*fakeProvisioner) AuthorizeRevoke(context.Context, string) error { return nil }
 func (*fakeProvisioner) GetID() string                                 { return "" }
 func (*fakeProvisioner) GetName() string                               { return "" }
@@ -299,7 +315,11 @@ func TestHandler_GetOrdersByAccountID(t *testing.T) {
 	type test struct {
 		db         acme.DB
 		ctx        context.Context
+		query      string
+		pageSize   int
 		statusCode int
+		orders     []string
+		next       string
 		err        *acme.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
@@ -357,14 +377,85 @@ func TestHandler_GetOrdersByAccountID(t *testing.T) {
 				},
 				ctx:        ctx,
 				statusCode: 200,
+				orders:     oidURLs,
+			}
+		},
+		"ok/first-page": func(t *testing.T) test {
+			acc := &acme.Account{ID: accID}
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return test{
+				db: &acme.MockDB{
+					MockGetOrdersByAccountID: func(ctx context.Context, id string) ([]string, error) {
+						return []string{"foo", "bar"}, nil
+					},
+				},
+				ctx:        ctx,
+				pageSize:   1,
+				statusCode: 200,
+				orders:     oidURLs[:1],
+				next:       fmt.Sprintf("<%s/acme/%s/account/%s/orders?cursor=1>;rel=\"next\"", baseURL.String(), provName, accID),
+			}
+		},
+		"ok/last-page": func(t *testing.T) test {
+			acc := &acme.Account{ID: accID}
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return test{
+				db: &acme.MockDB{
+					MockGetOrdersByAccountID: func(ctx context.Context, id string) ([]string, error) {
+						return []string{"foo", "bar"}, nil
+					},
+				},
+				ctx:        ctx,
+				query:      "?cursor=1",
+				pageSize:   1,
+				statusCode: 200,
+				orders:     oidURLs[1:],
+			}
+		},
+		"ok/cursor-out-of-range": func(t *testing.T) test {
+			acc := &acme.Account{ID: accID}
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = acme.NewProvisionerContext(ctx, prov)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return test{
+				db: &acme.MockDB{
+					MockGetOrdersByAccountID: func(ctx context.Context, id string) ([]string, error) {
+						return []string{"foo", "bar"}, nil
+					},
+				},
+				ctx:        ctx,
+				query:      "?cursor=10",
+				statusCode: 200,
+				orders:     []string{},
+			}
+		},
+		"fail/bad-cursor": func(t *testing.T) test {
+			acc := &acme.Account{ID: accID}
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        ctx,
+				query:      "?cursor=-1",
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "cursor '-1' is not valid"),
 			}
 		},
 	}
 	for name, run := range tests {
 		tc := run(t)
 		t.Run(name, func(t *testing.T) {
+			if tc.pageSize > 0 {
+				tmp := ordersPageSize
+				ordersPageSize = tc.pageSize
+				t.Cleanup(func() { ordersPageSize = tmp })
+			}
 			ctx := acme.NewContext(tc.ctx, tc.db, nil, acme.NewLinker("test.ca.smallstep.com", "acme"), nil)
-			req := httptest.NewRequest("GET", u, http.NoBody)
+			req := httptest.NewRequest("GET", u+tc.query, http.NoBody)
 			req = req.WithContext(ctx)
 			w := httptest.NewRecorder()
 			GetOrdersByAccountID(w, req)
@@ -385,10 +476,15 @@ func TestHandler_GetOrdersByAccountID(t *testing.T) {
 				assert.Equals(t, ae.Subproblems, tc.err.Subproblems)
 				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
 			} else {
-				expB, err := json.Marshal(oidURLs)
+				expB, err := json.Marshal(&OrdersList{Orders: tc.orders})
 				assert.FatalError(t, err)
 				assert.Equals(t, bytes.TrimSpace(body), expB)
 				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+				if tc.next != "" {
+					assert.Equals(t, res.Header["Link"], []string{tc.next})
+				} else {
+					assert.Nil(t, res.Header["Link"])
+				}
 			}
 		})
 	}
@@ -1038,3 +1134,185 @@ func TestHandler_GetOrUpdateAccount(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_KeyChange(t *testing.T) {
+	prov := newProv()
+	escProvName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	u := fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), escProvName)
+	accURL := fmt.Sprintf("%s/acme/%s/account/accID", baseURL.String(), escProvName)
+
+	oldKey, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newKey, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	newKeyID, err := acme.KeyToID(newKey)
+	assert.FatalError(t, err)
+
+	sign := func(t *testing.T, key *jose.JSONWebKey, embed bool, headers map[string]interface{}, payload []byte) string {
+		so := &jose.SignerOptions{EmbedJWK: embed}
+		for k, v := range headers {
+			so.WithHeader(jose.HeaderKey(k), v)
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{
+			Algorithm: jose.SignatureAlgorithm(key.Algorithm),
+			Key:       key.Key,
+		}, so)
+		assert.FatalError(t, err)
+		jws, err := signer.Sign(payload)
+		assert.FatalError(t, err)
+		return jws.FullSerialize()
+	}
+	// newContext creates the context of a key-change request with the inner
+	// JWS signed by the given key.
+	newContext := func(t *testing.T, key *jose.JSONWebKey, innerURL string, kcr *KeyChangeRequest) context.Context {
+		b, err := json.Marshal(kcr)
+		assert.FatalError(t, err)
+		inner := sign(t, key, true, map[string]interface{}{"url": innerURL}, b)
+		outer := sign(t, oldKey, false, map[string]interface{}{"kid": accURL, "url": u}, []byte(inner))
+		jws, err := jose.ParseJWS(outer)
+		assert.FatalError(t, err)
+		pub := oldKey.Public()
+		acc := &acme.Account{ID: "accID", Key: &pub, Status: acme.StatusValid}
+		ctx := acme.NewProvisionerContext(context.Background(), prov)
+		ctx = context.WithValue(ctx, accContextKey, acc)
+		ctx = context.WithValue(ctx, jwsContextKey, jws)
+		return context.WithValue(ctx, payloadContextKey, &payloadInfo{value: []byte(inner)})
+	}
+	oldPub := oldKey.Public()
+	okRequest := &KeyChangeRequest{Account: accURL, OldKey: &oldPub}
+
+	type test struct {
+		db         acme.DB
+		ctx        context.Context
+		statusCode int
+		location   string
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-account": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        context.Background(),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account does not exist"),
+			}
+		},
+		"fail/url-mismatch": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(t, newKey, "https://foo.bar", okRequest),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "url header in inner JWS does not match the outer JWS"),
+			}
+		},
+		"fail/account-mismatch": func(t *testing.T) test {
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(t, newKey, u, &KeyChangeRequest{Account: "https://foo.bar", OldKey: &oldPub}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "account 'https://foo.bar' does not match the kid of the outer JWS"),
+			}
+		},
+		"fail/old-key-mismatch": func(t *testing.T) test {
+			newPub := newKey.Public()
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(t, newKey, u, &KeyChangeRequest{Account: accURL, OldKey: &newPub}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "oldKey does not match the account key"),
+			}
+		},
+		"fail/new-key-size": func(t *testing.T) test {
+			rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+			assert.FatalError(t, err)
+			smallKey := &jose.JSONWebKey{Key: rsaKey, Algorithm: "RS256"}
+			return test{
+				db:         &acme.MockDB{},
+				ctx:        newContext(t, smallKey, u, okRequest),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "rsa keys must be at least 2048 bits (256 bytes) in size"),
+			}
+		},
+		"fail/key-in-use": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						assert.Equals(t, newKeyID, kid)
+						return &acme.Account{ID: "otherID"}, nil
+					},
+				},
+				ctx:        newContext(t, newKey, u, okRequest),
+				statusCode: 409,
+				location:   fmt.Sprintf("%s/acme/%s/account/otherID", baseURL.String(), escProvName),
+				err:        acme.NewError(acme.ErrorMalformedType, "new key is already in use by another account"),
+			}
+		},
+		"fail/db.UpdateAccount-error": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						return errors.New("force")
+					},
+				},
+				ctx:        newContext(t, newKey, u, okRequest),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error updating account key: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &acme.MockDB{
+					MockGetAccountByKeyID: func(ctx context.Context, kid string) (*acme.Account, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockUpdateAccount: func(ctx context.Context, acc *acme.Account) error {
+						assert.Equals(t, "accID", acc.ID)
+						assert.Equals(t, newKeyID, acc.Key.KeyID)
+						return nil
+					},
+				},
+				ctx:        newContext(t, newKey, u, okRequest),
+				statusCode: 200,
+				location:   accURL,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			ctx := newBaseContext(tc.ctx, tc.db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("POST", u, http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			KeyChange(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if tc.location != "" {
+				assert.Equals(t, res.Header["Location"], []string{tc.location})
+			}
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				acc := new(acme.Account)
+				assert.FatalError(t, json.Unmarshal(body, acc))
+				assert.Equals(t, acme.StatusValid, acc.Status)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
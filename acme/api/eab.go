@@ -72,9 +72,13 @@ func validateExternalAccountBinding(ctx context.Context, nar *NewAccountRequest)
 		return nil, acme.NewError(acme.ErrorUnauthorizedType, "external account binding key with id '%s' was already bound to account '%s' on %s", keyID, externalAccountKey.AccountID, externalAccountKey.BoundAt)
 	}
 
+	if externalAccountKey.IsExpired() {
+		return nil, acme.NewError(acme.ErrorUnauthorizedType, "external account binding key with id '%s' expired on %s", keyID, externalAccountKey.ExpiresAt)
+	}
+
 	payload, err := eabJWS.Verify(externalAccountKey.HmacKey)
 	if err != nil {
-		return nil, acme.WrapErrorISE(err, "error verifying externalAccountBinding signature")
+		return nil, acme.WrapError(acme.ErrorUnauthorizedType, err, "error verifying externalAccountBinding signature")
 	}
 
 	jwk, err := jwkFromContext(ctx)
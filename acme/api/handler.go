@@ -6,11 +6,16 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"go.step.sm/crypto/jose"
+
 	"github.com/smallstep/certificates/acme"
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/api/render"
@@ -156,15 +161,19 @@ func route(r api.Router, middleware func(next nextHTTP) nextHTTP) {
 		commonMiddleware(GetDirectory))
 	r.MethodFunc("HEAD", getPath(acme.DirectoryLinkType, "{provisionerID}"),
 		commonMiddleware(GetDirectory))
+	r.MethodFunc("GET", getPath(acme.RenewalInfoLinkType, "{provisionerID}", "{certID}"),
+		commonMiddleware(GetRenewalInfo))
 
 	r.MethodFunc("POST", getPath(acme.NewAccountLinkType, "{provisionerID}"),
 		extractPayloadByJWK(NewAccount))
 	r.MethodFunc("POST", getPath(acme.AccountLinkType, "{provisionerID}", "{accID}"),
 		extractPayloadByKid(GetOrUpdateAccount))
-	r.MethodFunc("POST", getPath(acme.KeyChangeLinkType, "{provisionerID}", "{accID}"),
-		extractPayloadByKid(NotImplemented))
+	r.MethodFunc("POST", getPath(acme.KeyChangeLinkType, "{provisionerID}"),
+		extractPayloadByKid(KeyChange))
 	r.MethodFunc("POST", getPath(acme.NewOrderLinkType, "{provisionerID}"),
 		extractPayloadByKid(NewOrder))
+	r.MethodFunc("POST", getPath(acme.NewAuthzLinkType, "{provisionerID}"),
+		extractPayloadByKid(NewAuthorization))
 	r.MethodFunc("POST", getPath(acme.OrderLinkType, "{provisionerID}", "{ordID}"),
 		extractPayloadByKid(isPostAsGet(GetOrder)))
 	r.MethodFunc("POST", getPath(acme.OrdersByAccountLinkType, "{provisionerID}", "{accID}"),
@@ -200,12 +209,14 @@ type Meta struct {
 
 // Directory represents an ACME directory for configuring clients.
 type Directory struct {
-	NewNonce   string `json:"newNonce"`
-	NewAccount string `json:"newAccount"`
-	NewOrder   string `json:"newOrder"`
-	RevokeCert string `json:"revokeCert"`
-	KeyChange  string `json:"keyChange"`
-	Meta       *Meta  `json:"meta,omitempty"`
+	NewNonce    string `json:"newNonce"`
+	NewAccount  string `json:"newAccount"`
+	NewOrder    string `json:"newOrder"`
+	NewAuthz    string `json:"newAuthz,omitempty"`
+	RevokeCert  string `json:"revokeCert"`
+	KeyChange   string `json:"keyChange"`
+	RenewalInfo string `json:"renewalInfo,omitempty"`
+	Meta        *Meta  `json:"meta,omitempty"`
 }
 
 // ToLog enables response logging for the Directory type.
@@ -229,14 +240,20 @@ func GetDirectory(w http.ResponseWriter, r *http.Request) {
 
 	linker := acme.MustLinkerFromContext(ctx)
 
-	render.JSON(w, &Directory{
-		NewNonce:   linker.GetLink(ctx, acme.NewNonceLinkType),
-		NewAccount: linker.GetLink(ctx, acme.NewAccountLinkType),
-		NewOrder:   linker.GetLink(ctx, acme.NewOrderLinkType),
-		RevokeCert: linker.GetLink(ctx, acme.RevokeCertLinkType),
-		KeyChange:  linker.GetLink(ctx, acme.KeyChangeLinkType),
-		Meta:       createMetaObject(acmeProv),
-	})
+	dir := &Directory{
+		NewNonce:    linker.GetLink(ctx, acme.NewNonceLinkType),
+		NewAccount:  linker.GetLink(ctx, acme.NewAccountLinkType),
+		NewOrder:    linker.GetLink(ctx, acme.NewOrderLinkType),
+		RevokeCert:  linker.GetLink(ctx, acme.RevokeCertLinkType),
+		KeyChange:   linker.GetLink(ctx, acme.KeyChangeLinkType),
+		RenewalInfo: linker.GetLink(ctx, acme.RenewalInfoLinkType),
+		Meta:        createMetaObject(acmeProv),
+	}
+	if acmeProv.GetPreAuthorizationDuration() > 0 {
+		dir.NewAuthz = linker.GetLink(ctx, acme.NewAuthzLinkType)
+	}
+
+	render.JSON(w, dir)
 }
 
 // createMetaObject creates a Meta object if the ACME provisioner
@@ -350,18 +367,63 @@ func GetChallenge(w http.ResponseWriter, r *http.Request) {
 		render.Error(w, err)
 		return
 	}
-	if err = ch.Validate(ctx, db, jwk, payload.value); err != nil {
+	ctx = acme.NewClientIPContext(ctx, clientIP(r))
+	if ch.Status == acme.StatusPending {
+		prov, err := provisionerFromContext(ctx)
+		if err != nil {
+			render.Error(w, err)
+			return
+		}
+		if err := acme.CheckFailedChallengeRateLimits(ctx, db, prov, acme.RateLimitSubject{
+			AccountID:   acc.ID,
+			IP:          acme.ClientIPFromContext(ctx),
+			Identifiers: []string{ch.Value},
+		}); err != nil {
+			render.Error(w, err)
+			return
+		}
+	}
+	if err = validateChallenge(ctx, db, ch, jwk, payload.value); err != nil {
 		render.Error(w, acme.WrapErrorISE(err, "error validating challenge"))
 		return
 	}
 
 	linker.LinkChallenge(ctx, ch, azID)
 
+	if ch.Status == acme.StatusProcessing {
+		retryAfter := int(math.Ceil(time.Until(ch.RetryAfter).Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
 	w.Header().Add("Link", link(linker.GetLink(ctx, acme.AuthzLinkType, azID), "up"))
 	w.Header().Set("Location", linker.GetLink(ctx, acme.ChallengeLinkType, azID, ch.ID))
 	render.JSON(w, ch)
 }
 
+// validateChallenge validates the challenge in the request, or queues it for
+// background validation if the provisioner allows retries and a validation
+// queue is available. The device-attest-01 challenge is always validated in
+// the request as it requires the payload.
+func validateChallenge(ctx context.Context, db acme.DB, ch *acme.Challenge, jwk *jose.JSONWebKey, payload []byte) error {
+	if q, ok := acme.ValidationQueueFromContext(ctx); ok && ch.Type != acme.DEVICEATTEST01 {
+		if p, err := acmeProvisionerFromContext(ctx); err == nil && p.GetChallengeRetries() > 0 {
+			return q.Enqueue(ctx, db, ch, jwk, p.GetChallengeRetries(), p.GetChallengeRetryInterval())
+		}
+	}
+	return ch.Validate(ctx, db, jwk, payload)
+}
+
+// clientIP returns the IP address of the client of the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // GetCertificate ACME api for retrieving a Certificate.
 func GetCertificate(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
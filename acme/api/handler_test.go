@@ -108,11 +108,33 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
+			}
+			return test{
+				ctx:        ctx,
+				dir:        expDir,
+				statusCode: 200,
+			}
+		},
+		"ok/pre-authorization": func(t *testing.T) test {
+			prov := newACMEProv(t)
+			prov.PreAuthorizationDuration = &provisioner.Duration{Duration: time.Hour}
+			provName := url.PathEscape(prov.GetName())
+			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+			ctx := acme.NewProvisionerContext(context.Background(), prov)
+			expDir := Directory{
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				NewAuthz:    fmt.Sprintf("%s/acme/%s/new-authz", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 			}
 			return test{
 				ctx:        ctx,
@@ -127,11 +149,12 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 				Meta: &Meta{
 					ExternalAccountRequired: true,
 				},
@@ -152,11 +175,12 @@ func TestHandler_GetDirectory(t *testing.T) {
 			baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 			ctx := acme.NewProvisionerContext(context.Background(), prov)
 			expDir := Directory{
-				NewNonce:   fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
-				NewAccount: fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
-				NewOrder:   fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
-				RevokeCert: fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
-				KeyChange:  fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				NewNonce:    fmt.Sprintf("%s/acme/%s/new-nonce", baseURL.String(), provName),
+				NewAccount:  fmt.Sprintf("%s/acme/%s/new-account", baseURL.String(), provName),
+				NewOrder:    fmt.Sprintf("%s/acme/%s/new-order", baseURL.String(), provName),
+				RevokeCert:  fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL.String(), provName),
+				KeyChange:   fmt.Sprintf("%s/acme/%s/key-change", baseURL.String(), provName),
+				RenewalInfo: fmt.Sprintf("%s/acme/%s/renewal-info", baseURL.String(), provName),
 				Meta: &Meta{
 					TermsOfService:          "https://terms.ca.local/",
 					Website:                 "https://ca.local/",
@@ -864,3 +888,53 @@ func Test_createMetaObject(t *testing.T) {
 		})
 	}
 }
+
+func Test_validateChallenge(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+
+	db := &acme.MockDB{
+		MockUpdateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+			return nil
+		},
+	}
+	vc := &mockClient{
+		lookupTxt: func(name string) ([]string, error) {
+			return nil, errors.New("force")
+		},
+	}
+
+	q := acme.NewValidationQueue(1)
+	defer q.Stop()
+
+	newContext := func(p acme.Provisioner, withQueue bool) context.Context {
+		ctx := acme.NewClientContext(context.Background(), vc)
+		ctx = acme.NewProvisionerContext(ctx, p)
+		if withQueue {
+			ctx = acme.NewValidationQueueContext(ctx, q)
+		}
+		return ctx
+	}
+	retries := &provisioner.ACME{Type: "ACME", Name: "acme", ChallengeRetries: 1, ChallengeRetryInterval: &provisioner.Duration{Duration: time.Millisecond}}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		chID       string
+		wantStatus acme.Status
+	}{
+		{"ok queued", newContext(retries, true), "ch1", acme.StatusProcessing},
+		{"ok no queue", newContext(retries, false), "ch2", acme.StatusPending},
+		{"ok no retries", newContext(newProv(), true), "ch3", acme.StatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &acme.Challenge{ID: tt.chID, Type: acme.DNS01, Status: acme.StatusPending, Token: "token", Value: "example.com"}
+			assert.FatalError(t, validateChallenge(tt.ctx, db, ch, jwk, nil))
+			assert.Equals(t, tt.wantStatus, ch.Status)
+			if tt.wantStatus == acme.StatusPending {
+				assert.NotNil(t, ch.Error)
+			}
+		})
+	}
+}
@@ -26,6 +26,7 @@ type NewOrderRequest struct {
 	Identifiers []acme.Identifier `json:"identifiers"`
 	NotBefore   time.Time         `json:"notBefore,omitempty"`
 	NotAfter    time.Time         `json:"notAfter,omitempty"`
+	Replaces    string            `json:"replaces,omitempty"`
 }
 
 // Validate validates a new-order request body.
@@ -55,9 +56,36 @@ func (n *NewOrderRequest) Validate() error {
 		// TODO(hs): add some validations for DNS domains?
 		// TODO(hs): combine the errors from this with allow/deny policy, like example error in https://datatracker.ietf.org/doc/html/rfc8555#section-6.7.1
 	}
+	if n.Replaces != "" {
+		if _, err := acme.ParseCertID(n.Replaces); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// NewAuthzRequest represents the body for a NewAuthz request.
+type NewAuthzRequest struct {
+	Identifier acme.Identifier `json:"identifier"`
+}
+
+// Validate validates a new-authz request body.
+func (n *NewAuthzRequest) Validate() error {
+	switch n.Identifier.Type {
+	case acme.DNS:
+		// Pre-authorization cannot be used for wildcard domain names, see RFC
+		// 8555 section 7.4.1.
+		if _, isWildcard := trimIfWildcard(n.Identifier.Value); isWildcard {
+			return acme.NewError(acme.ErrorMalformedType, "wildcard identifiers cannot be pre-authorized")
+		}
+	case acme.IP:
+	default:
+		return acme.NewError(acme.ErrorUnsupportedIdentifierType, "identifier type %s cannot be pre-authorized", n.Identifier.Type)
+	}
+	nor := &NewOrderRequest{Identifiers: []acme.Identifier{n.Identifier}}
+	return nor.Validate()
+}
+
 // FinalizeRequest captures the body for a Finalize order request.
 type FinalizeRequest struct {
 	CSR string `json:"csr"`
@@ -149,20 +177,28 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, identifier := range nor.Identifiers {
-		// evaluate the ACME account level policy
-		if err = isIdentifierAllowed(acmePolicy, identifier); err != nil {
-			render.Error(w, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
-			return
-		}
-		// evaluate the provisioner level policy
-		orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(identifier.Type), Value: identifier.Value}
-		if err = prov.AuthorizeOrderIdentifier(ctx, orderIdentifier); err != nil {
-			render.Error(w, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
+		if err := authorizeIdentifier(ctx, ca, prov, acmePolicy, identifier); err != nil {
+			render.Error(w, err)
 			return
 		}
-		// evaluate the authority level policy
-		if err = ca.AreSANsAllowed(ctx, []string{identifier.Value}); err != nil {
-			render.Error(w, acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized"))
+	}
+
+	identifiers := make([]string, len(nor.Identifiers))
+	for i, identifier := range nor.Identifiers {
+		identifiers[i] = identifier.Value
+	}
+	if err := acme.CheckRateLimits(ctx, db, prov, acme.RateLimitNewOrder, acme.RateLimitSubject{
+		AccountID:   acc.ID,
+		IP:          clientIP(r),
+		Identifiers: identifiers,
+	}); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	if nor.Replaces != "" {
+		if err := checkReplacedCertificate(ctx, db, acc, nor.Replaces, nor.Identifiers); err != nil {
+			render.Error(w, err)
 			return
 		}
 	}
@@ -178,10 +214,35 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 		AuthorizationIDs: make([]string, len(nor.Identifiers)),
 		NotBefore:        nor.NotBefore,
 		NotAfter:         nor.NotAfter,
+		Replaces:         nor.Replaces,
+	}
+
+	var reusable []*acme.Authorization
+	reuseDuration := acmeProv.GetAuthorizationReuseDuration()
+	preAuthDuration := acmeProv.GetPreAuthorizationDuration()
+	if reuseDuration > 0 || preAuthDuration > 0 {
+		if reusable, err = db.GetAuthorizationsByAccountID(ctx, acc.ID); err != nil {
+			render.Error(w, acme.WrapErrorISE(err, "error retrieving authorizations"))
+			return
+		}
 	}
 
 	for i, identifier := range o.Identifiers {
-		az := &acme.Authorization{
+		az, err := findReusableAuthorization(ctx, reusable, identifier, reuseDuration, preAuthDuration, now)
+		if err != nil {
+			render.Error(w, err)
+			return
+		}
+		if az != nil {
+			o.AuthorizationIDs[i] = az.ID
+			// The order cannot outlive the authorizations it reuses.
+			if az.ExpiresAt.Before(o.ExpiresAt) {
+				o.ExpiresAt = az.ExpiresAt
+			}
+			continue
+		}
+
+		az = &acme.Authorization{
 			AccountID:  acc.ID,
 			Identifier: identifier,
 			ExpiresAt:  o.ExpiresAt,
@@ -217,6 +278,104 @@ func NewOrder(w http.ResponseWriter, r *http.Request) {
 	render.JSONStatus(w, o, http.StatusCreated)
 }
 
+// authorizeIdentifier evaluates the ACME account, provisioner and authority
+// level policies for the given identifier.
+func authorizeIdentifier(ctx context.Context, ca acme.CertificateAuthority, prov acme.Provisioner, acmePolicy policy.X509Policy, identifier acme.Identifier) error {
+	// evaluate the ACME account level policy
+	if err := isIdentifierAllowed(acmePolicy, identifier); err != nil {
+		return acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized")
+	}
+	// evaluate the provisioner level policy
+	orderIdentifier := provisioner.ACMEIdentifier{Type: provisioner.ACMEIdentifierType(identifier.Type), Value: identifier.Value}
+	if err := prov.AuthorizeOrderIdentifier(ctx, orderIdentifier); err != nil {
+		return acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized")
+	}
+	// evaluate the authority level policy
+	if err := ca.AreSANsAllowed(ctx, []string{identifier.Value}); err != nil {
+		return acme.WrapError(acme.ErrorRejectedIdentifierType, err, "not authorized")
+	}
+	return nil
+}
+
+// NewAuthorization ACME api for creating a new pre-authorization.
+func NewAuthorization(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ca := mustAuthority(ctx)
+	db := acme.MustDatabaseFromContext(ctx)
+	linker := acme.MustLinkerFromContext(ctx)
+
+	acc, err := accountFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	prov, err := provisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	acmeProv, err := acmeProvisionerFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	if acmeProv.GetPreAuthorizationDuration() <= 0 {
+		render.Error(w, acme.NewError(acme.ErrorMalformedType, "pre-authorization is not enabled"))
+		return
+	}
+	payload, err := payloadFromContext(ctx)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	var nar NewAuthzRequest
+	if err := json.Unmarshal(payload.value, &nar); err != nil {
+		render.Error(w, acme.WrapError(acme.ErrorMalformedType, err,
+			"failed to unmarshal new-authz request payload"))
+		return
+	}
+	if err := nar.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	var eak *acme.ExternalAccountKey
+	if acmeProv.RequireEAB {
+		if eak, err = db.GetExternalAccountKeyByAccountID(ctx, prov.GetID(), acc.ID); err != nil {
+			render.Error(w, acme.WrapErrorISE(err, "error retrieving external account binding key"))
+			return
+		}
+	}
+
+	acmePolicy, err := newACMEPolicyEngine(eak)
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error creating ACME policy engine"))
+		return
+	}
+	if err := authorizeIdentifier(ctx, ca, prov, acmePolicy, nar.Identifier); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	az := &acme.Authorization{
+		AccountID:     acc.ID,
+		Identifier:    nar.Identifier,
+		ExpiresAt:     clock.Now().Add(defaultOrderExpiry),
+		Status:        acme.StatusPending,
+		PreAuthorized: true,
+	}
+	if err := newAuthorization(ctx, az); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	linker.LinkAuthorization(ctx, az)
+
+	w.Header().Set("Location", linker.GetLink(ctx, acme.AuthzLinkType, az.ID))
+	render.JSONStatus(w, az, http.StatusCreated)
+}
+
 func isIdentifierAllowed(acmePolicy policy.X509Policy, identifier acme.Identifier) error {
 	if acmePolicy == nil {
 		return nil
@@ -238,6 +397,59 @@ func trimIfWildcard(value string) (string, bool) {
 	return value, false
 }
 
+// findReusableAuthorization returns a valid authorization for the given
+// identifier whose challenge was validated within the reuse duration, or
+// within the pre-authorization duration if the authorization was created
+// using newAuthz. If a reusable authorization is found, its expiration is
+// updated to the end of the reuse window. It returns nil if no authorization
+// can be reused.
+func findReusableAuthorization(ctx context.Context, authzs []*acme.Authorization, identifier acme.Identifier, reuseDuration, preAuthDuration time.Duration, now time.Time) (*acme.Authorization, error) {
+	// Authorizations for permanent identifiers are bound to the attested key,
+	// so they always require a new validation.
+	if len(authzs) == 0 || identifier.Type == acme.PermanentIdentifier {
+		return nil, nil
+	}
+
+	db := acme.MustDatabaseFromContext(ctx)
+	value, isWildcard := trimIfWildcard(identifier.Value)
+	for _, candidate := range authzs {
+		if candidate.Status != acme.StatusValid || candidate.Wildcard != isWildcard ||
+			candidate.Identifier.Type != identifier.Type || candidate.Identifier.Value != value {
+			continue
+		}
+		duration := reuseDuration
+		if candidate.PreAuthorized && preAuthDuration > duration {
+			duration = preAuthDuration
+		}
+		if duration <= 0 {
+			continue
+		}
+
+		// Challenges are not loaded when listing authorizations.
+		az, err := db.GetAuthorization(ctx, candidate.ID)
+		if err != nil {
+			return nil, acme.WrapErrorISE(err, "error retrieving authorization")
+		}
+		for _, ch := range az.Challenges {
+			if ch.Status != acme.StatusValid || ch.ValidatedAt.IsZero() {
+				continue
+			}
+			expiresAt := ch.ValidatedAt.Add(duration)
+			if !now.Before(expiresAt) {
+				continue
+			}
+			if !az.ExpiresAt.Equal(expiresAt) {
+				az.ExpiresAt = expiresAt
+				if err := db.UpdateAuthorization(ctx, az); err != nil {
+					return nil, acme.WrapErrorISE(err, "error updating authorization")
+				}
+			}
+			return az, nil
+		}
+	}
+	return nil, nil
+}
+
 func newAuthorization(ctx context.Context, az *acme.Authorization) error {
 	value, isWildcard := trimIfWildcard(az.Identifier.Value)
 	az.Wildcard = isWildcard
@@ -50,6 +50,17 @@ func TestNewOrderRequest_Validate(t *testing.T) {
 				err: acme.NewError(acme.ErrorMalformedType, "identifier type unsupported: foo"),
 			}
 		},
+		"fail/bad-replaces": func(t *testing.T) test {
+			return test{
+				nor: &NewOrderRequest{
+					Identifiers: []acme.Identifier{
+						{Type: "dns", Value: "example.com"},
+					},
+					Replaces: "foo",
+				},
+				err: acme.NewError(acme.ErrorMalformedType, "certID \"foo\" is not valid"),
+			}
+		},
 		"fail/bad-identifier/bad-dns": func(t *testing.T) test {
 			return test{
 				nor: &NewOrderRequest{
@@ -799,6 +810,7 @@ func TestHandler_NewOrder(t *testing.T) {
 		ctx        context.Context
 		nor        *NewOrderRequest
 		statusCode int
+		retryAfter string
 		vr         func(t *testing.T, o *acme.Order)
 		err        *acme.Error
 	}
@@ -1142,6 +1154,47 @@ func TestHandler_NewOrder(t *testing.T) {
 				err: acme.NewErrorISE("error creating challenge: force"),
 			}
 		},
+		"fail/rate-limited": func(t *testing.T) test {
+			acc := &acme.Account{ID: "accID"}
+			fr := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+			}
+			b, err := json.Marshal(fr)
+			assert.FatalError(t, err)
+			p := &provisioner.ACME{
+				Type: "ACME",
+				Name: "test@acme-<test>provisioner.com",
+				RateLimits: &provisioner.ACMERateLimits{
+					NewOrder: &provisioner.ACMERateLimitScopes{
+						IP: &provisioner.ACMERateLimit{Limit: 1, Period: &provisioner.Duration{Duration: time.Hour}},
+					},
+				},
+			}
+			assert.FatalError(t, p.Init(provisioner.Config{Claims: globalProvisionerClaims}))
+			ctx := acme.NewProvisionerContext(context.Background(), p)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 429,
+				retryAfter: "1800",
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetRateLimitCounter: func(ctx context.Context, key string) (*acme.RateLimitCounter, error) {
+						assert.Equals(t, p.GetID()+"/new-order/ip/192.0.2.1", key)
+						return &acme.RateLimitCounter{Key: key, Count: 1, ExpiresAt: time.Now().Add(30*time.Minute - time.Second/2)}, nil
+					},
+					MockIncrementRateLimitCounter: func(ctx context.Context, key string, period time.Duration) (*acme.RateLimitCounter, error) {
+						t.Error("rejected orders must not be counted")
+						return nil, nil
+					},
+				},
+				err: acme.NewDetailedError(acme.ErrorRateLimitedType,
+					"new-order rate limit of 1 per 1h0m0s exceeded for %s/new-order/ip/192.0.2.1", p.GetID()),
+			}
+		},
 		"fail/error-db.CreateOrder": func(t *testing.T) test {
 			acc := &acme.Account{ID: "accID"}
 			fr := &NewOrderRequest{
@@ -1822,6 +1875,213 @@ func TestHandler_NewOrder(t *testing.T) {
 				},
 			}
 		},
+		"fail/db.GetAuthorizationsByAccountID-error": func(t *testing.T) test {
+			acmeProv := newACMEProv(t)
+			acmeProv.AuthorizationReuseDuration = &provisioner.Duration{Duration: time.Hour}
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+				},
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), acmeProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			return test{
+				ctx:        ctx,
+				statusCode: 500,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						assert.Equals(t, "accID", accountID)
+						return nil, errors.New("force")
+					},
+				},
+				err: acme.NewErrorISE("error retrieving authorizations: force"),
+			}
+		},
+		"ok/reuse-authorization": func(t *testing.T) test {
+			acmeProv := newACMEProv(t)
+			acmeProv.AuthorizationReuseDuration = &provisioner.Duration{Duration: time.Hour}
+			now := clock.Now()
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+					{Type: "dns", Value: "*.zap.internal"},
+					{Type: "dns", Value: "zip.internal"},
+				},
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), acmeProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			authzs := map[string]*acme.Authorization{
+				"valid": {
+					ID: "valid", AccountID: "accID", Status: acme.StatusValid,
+					Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"},
+					ExpiresAt:  now.Add(time.Minute),
+					Challenges: []*acme.Challenge{
+						{Status: acme.StatusPending},
+						{Status: acme.StatusValid, ValidatedAt: now.Add(-time.Minute)},
+					},
+				},
+				"wildcard": {
+					ID: "wildcard", AccountID: "accID", Status: acme.StatusValid, Wildcard: true,
+					Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"},
+					ExpiresAt:  now.Add(time.Minute),
+					Challenges: []*acme.Challenge{
+						{Status: acme.StatusValid, ValidatedAt: now.Add(-2 * time.Hour)},
+					},
+				},
+				"pending": {
+					ID: "pending", AccountID: "accID", Status: acme.StatusPending,
+					Identifier: acme.Identifier{Type: "dns", Value: "zip.internal"},
+					ExpiresAt:  now.Add(time.Minute),
+				},
+			}
+			var count int
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						assert.Equals(t, "accID", accountID)
+						return []*acme.Authorization{authzs["valid"], authzs["wildcard"], authzs["pending"]}, nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						if id == "pending" {
+							assert.FatalError(t, errors.New("pending authorization should not be loaded"))
+						}
+						return authzs[id], nil
+					},
+					MockUpdateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						assert.Equals(t, "valid", az.ID)
+						assert.Equals(t, now.Add(-time.Minute).Add(time.Hour), az.ExpiresAt)
+						return nil
+					},
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = fmt.Sprintf("ch%d", count)
+						count++
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						az.ID = az.Identifier.Value
+						if az.Wildcard {
+							az.ID = "wildcard." + az.ID
+						}
+						assert.Equals(t, az.Status, acme.StatusPending)
+						return nil
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.AuthorizationIDs, []string{"valid", "wildcard.zap.internal", "zip.internal"})
+						// The order expires with the reused authorization.
+						assert.Equals(t, now.Add(-time.Minute).Add(time.Hour), o.ExpiresAt)
+						return nil
+					},
+					MockGetExternalAccountKeyByAccountID: func(ctx context.Context, provisionerID, accountID string) (*acme.ExternalAccountKey, error) {
+						return nil, nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					assert.Equals(t, o.ID, "ordID")
+					assert.Equals(t, o.Status, acme.StatusPending)
+					assert.Equals(t, o.AuthorizationURLs, []string{
+						fmt.Sprintf("%s/acme/%s/authz/valid", baseURL.String(), escProvName),
+						fmt.Sprintf("%s/acme/%s/authz/wildcard.zap.internal", baseURL.String(), escProvName),
+						fmt.Sprintf("%s/acme/%s/authz/zip.internal", baseURL.String(), escProvName),
+					})
+				},
+			}
+		},
+		"ok/reuse-pre-authorization": func(t *testing.T) test {
+			acmeProv := newACMEProv(t)
+			acmeProv.PreAuthorizationDuration = &provisioner.Duration{Duration: 24 * time.Hour}
+			now := clock.Now()
+			acc := &acme.Account{ID: "accID"}
+			nor := &NewOrderRequest{
+				Identifiers: []acme.Identifier{
+					{Type: "dns", Value: "zap.internal"},
+					{Type: "dns", Value: "zip.internal"},
+				},
+			}
+			b, err := json.Marshal(nor)
+			assert.FatalError(t, err)
+			ctx := acme.NewProvisionerContext(context.Background(), acmeProv)
+			ctx = context.WithValue(ctx, accContextKey, acc)
+			ctx = context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+			authzs := map[string]*acme.Authorization{
+				"preauth": {
+					ID: "preauth", AccountID: "accID", Status: acme.StatusValid, PreAuthorized: true,
+					Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"},
+					ExpiresAt:  now.Add(time.Minute),
+					Challenges: []*acme.Challenge{
+						{Status: acme.StatusValid, ValidatedAt: now.Add(-2 * time.Hour)},
+					},
+				},
+				"valid": {
+					ID: "valid", AccountID: "accID", Status: acme.StatusValid,
+					Identifier: acme.Identifier{Type: "dns", Value: "zip.internal"},
+					ExpiresAt:  now.Add(time.Minute),
+					Challenges: []*acme.Challenge{
+						{Status: acme.StatusValid, ValidatedAt: now.Add(-time.Minute)},
+					},
+				},
+			}
+			var count int
+			return test{
+				ctx:        ctx,
+				statusCode: 201,
+				nor:        nor,
+				ca:         &mockCA{},
+				db: &acme.MockDB{
+					MockGetAuthorizationsByAccountID: func(ctx context.Context, accountID string) ([]*acme.Authorization, error) {
+						assert.Equals(t, "accID", accountID)
+						return []*acme.Authorization{authzs["preauth"], authzs["valid"]}, nil
+					},
+					MockGetAuthorization: func(ctx context.Context, id string) (*acme.Authorization, error) {
+						if id != "preauth" {
+							assert.FatalError(t, errors.New("only pre-authorizations should be loaded"))
+						}
+						return authzs[id], nil
+					},
+					MockUpdateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						assert.Equals(t, "preauth", az.ID)
+						assert.Equals(t, now.Add(-2*time.Hour).Add(24*time.Hour), az.ExpiresAt)
+						return nil
+					},
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = fmt.Sprintf("ch%d", count)
+						count++
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						az.ID = az.Identifier.Value
+						assert.False(t, az.PreAuthorized)
+						return nil
+					},
+					MockCreateOrder: func(ctx context.Context, o *acme.Order) error {
+						o.ID = "ordID"
+						assert.Equals(t, o.AuthorizationIDs, []string{"preauth", "zip.internal"})
+						assert.Equals(t, now.Add(-2*time.Hour).Add(24*time.Hour), o.ExpiresAt)
+						return nil
+					},
+				},
+				vr: func(t *testing.T, o *acme.Order) {
+					assert.Equals(t, o.ID, "ordID")
+					assert.Equals(t, o.AuthorizationURLs, []string{
+						fmt.Sprintf("%s/acme/%s/authz/preauth", baseURL.String(), escProvName),
+						fmt.Sprintf("%s/acme/%s/authz/zip.internal", baseURL.String(), escProvName),
+					})
+				},
+			}
+		},
 	}
 	for name, run := range tests {
 		tc := run(t)
@@ -1835,6 +2095,9 @@ func TestHandler_NewOrder(t *testing.T) {
 			res := w.Result()
 
 			assert.Equals(t, res.StatusCode, tc.statusCode)
+			if tc.retryAfter != "" {
+				assert.Equals(t, tc.retryAfter, res.Header.Get("Retry-After"))
+			}
 
 			body, err := io.ReadAll(res.Body)
 			res.Body.Close()
@@ -2237,3 +2500,177 @@ func TestTrimIfWildcard(t *testing.T) {
 		})
 	}
 }
+
+func TestNewAuthzRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		nar     *NewAuthzRequest
+		errType string
+	}{
+		{"ok dns", &NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "example.com"}}, ""},
+		{"ok ip", &NewAuthzRequest{Identifier: acme.Identifier{Type: "ip", Value: "10.0.0.1"}}, ""},
+		{"fail wildcard", &NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "*.example.com"}}, "urn:ietf:params:acme:error:malformed"},
+		{"fail bad dns", &NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "example.com:8080"}}, "urn:ietf:params:acme:error:malformed"},
+		{"fail bad ip", &NewAuthzRequest{Identifier: acme.Identifier{Type: "ip", Value: "foo"}}, "urn:ietf:params:acme:error:malformed"},
+		{"fail permanent-identifier", &NewAuthzRequest{Identifier: acme.Identifier{Type: "permanent-identifier", Value: "12345678"}}, "urn:ietf:params:acme:error:unsupportedIdentifier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.nar.Validate()
+			if tt.errType == "" {
+				assert.FatalError(t, err)
+				return
+			}
+			var ae *acme.Error
+			if assert.True(t, errors.As(err, &ae)) {
+				assert.Equals(t, tt.errType, ae.Type)
+			}
+		})
+	}
+}
+
+func TestHandler_NewAuthorization(t *testing.T) {
+	prov := newProv()
+	escProvName := url.PathEscape(prov.GetName())
+	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	u := fmt.Sprintf("%s/acme/%s/new-authz", baseURL.String(), escProvName)
+	acc := &acme.Account{ID: "accID"}
+
+	newACMEPreAuthProv := func(t *testing.T) *provisioner.ACME {
+		p := newACMEProv(t)
+		p.PreAuthorizationDuration = &provisioner.Duration{Duration: 24 * time.Hour}
+		return p
+	}
+	newContext := func(p acme.Provisioner, nar *NewAuthzRequest) context.Context {
+		b, err := json.Marshal(nar)
+		assert.FatalError(t, err)
+		ctx := acme.NewProvisionerContext(context.Background(), p)
+		ctx = context.WithValue(ctx, accContextKey, acc)
+		return context.WithValue(ctx, payloadContextKey, &payloadInfo{value: b})
+	}
+	dnsRequest := &NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "zap.internal"}}
+
+	type test struct {
+		ca         acme.CertificateAuthority
+		db         acme.DB
+		ctx        context.Context
+		statusCode int
+		err        *acme.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/no-account": func(t *testing.T) test {
+			return test{
+				ca:         &mockCA{},
+				db:         &acme.MockDB{},
+				ctx:        acme.NewProvisionerContext(context.Background(), newACMEPreAuthProv(t)),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorAccountDoesNotExistType, "account does not exist"),
+			}
+		},
+		"fail/disabled": func(t *testing.T) test {
+			return test{
+				ca:         &mockCA{},
+				db:         &acme.MockDB{},
+				ctx:        newContext(newACMEProv(t), dnsRequest),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "pre-authorization is not enabled"),
+			}
+		},
+		"fail/wildcard": func(t *testing.T) test {
+			return test{
+				ca:         &mockCA{},
+				db:         &acme.MockDB{},
+				ctx:        newContext(newACMEPreAuthProv(t), &NewAuthzRequest{Identifier: acme.Identifier{Type: "dns", Value: "*.zap.internal"}}),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorMalformedType, "wildcard identifiers cannot be pre-authorized"),
+			}
+		},
+		"fail/not-authorized": func(t *testing.T) test {
+			return test{
+				ca: &mockCA{
+					MockAreSANsallowed: func(ctx context.Context, sans []string) error {
+						assert.Equals(t, []string{"zap.internal"}, sans)
+						return errors.New("force")
+					},
+				},
+				db:         &acme.MockDB{},
+				ctx:        newContext(newACMEPreAuthProv(t), dnsRequest),
+				statusCode: 400,
+				err:        acme.NewError(acme.ErrorRejectedIdentifierType, "not authorized"),
+			}
+		},
+		"fail/db.CreateAuthorization-error": func(t *testing.T) test {
+			return test{
+				ca: &mockCA{},
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						return errors.New("force")
+					},
+				},
+				ctx:        newContext(newACMEPreAuthProv(t), dnsRequest),
+				statusCode: 500,
+				err:        acme.NewErrorISE("error creating authorization: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			var count int
+			return test{
+				ca: &mockCA{},
+				db: &acme.MockDB{
+					MockCreateChallenge: func(ctx context.Context, ch *acme.Challenge) error {
+						ch.ID = fmt.Sprintf("ch%d", count)
+						count++
+						return nil
+					},
+					MockCreateAuthorization: func(ctx context.Context, az *acme.Authorization) error {
+						az.ID = "azID"
+						assert.Equals(t, "accID", az.AccountID)
+						assert.Equals(t, acme.StatusPending, az.Status)
+						assert.True(t, az.PreAuthorized)
+						assert.Equals(t, 3, len(az.Challenges))
+						return nil
+					},
+				},
+				ctx:        newContext(newACMEPreAuthProv(t), dnsRequest),
+				statusCode: 201,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.ca)
+			ctx := newBaseContext(tc.ctx, tc.db, acme.NewLinker("test.ca.smallstep.com", "acme"))
+			req := httptest.NewRequest("POST", u, http.NoBody)
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			NewAuthorization(w, req)
+			res := w.Result()
+
+			assert.Equals(t, res.StatusCode, tc.statusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 && assert.NotNil(t, tc.err) {
+				var ae acme.Error
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &ae))
+
+				assert.Equals(t, ae.Type, tc.err.Type)
+				assert.Equals(t, ae.Detail, tc.err.Detail)
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/problem+json"})
+			} else {
+				az := new(acme.Authorization)
+				assert.FatalError(t, json.Unmarshal(body, az))
+				assert.Equals(t, acme.Identifier{Type: "dns", Value: "zap.internal"}, az.Identifier)
+				assert.Equals(t, acme.StatusPending, az.Status)
+				assert.Equals(t, res.Header["Location"], []string{fmt.Sprintf("%s/acme/%s/authz/azID", baseURL.String(), escProvName)})
+				assert.Equals(t, res.Header["Content-Type"], []string{"application/json"})
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/exp/slices"
+
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api/render"
+)
+
+// GetRenewalInfo is the ACME Renewal Information (ARI) resource for returning
+// the suggested renewal window of a certificate.
+func GetRenewalInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	db := acme.MustDatabaseFromContext(ctx)
+
+	certID, err := acme.ParseCertID(chi.URLParam(r, "certID"))
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	cert, err := getCertificateByCertID(ctx, db, certID)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	revoked, err := mustAuthority(ctx).IsRevoked(cert.Leaf.SerialNumber.String())
+	if err != nil {
+		render.Error(w, acme.WrapErrorISE(err, "error retrieving revocation status of certificate"))
+		return
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(acme.RenewalInfoRetryAfter.Seconds())))
+	render.JSON(w, acme.NewRenewalInfo(cert.Leaf, revoked, clock.Now()))
+}
+
+// getCertificateByCertID returns the certificate identified by the given ARI
+// certID. It returns a not found error if the certificate does not exist or
+// if it was not issued by the authority key in the certID.
+func getCertificateByCertID(ctx context.Context, db acme.DB, certID acme.CertID) (*acme.Certificate, error) {
+	cert, err := db.GetCertificateBySerial(ctx, certID.SerialNumber.String())
+	if err != nil {
+		var acmeErr *acme.Error
+		if errors.As(err, &acmeErr) && acmeErr.Status < http.StatusInternalServerError {
+			return nil, newCertificateNotFoundError(certID)
+		}
+		return nil, acme.WrapErrorISE(err, "error retrieving certificate by serial")
+	}
+	if !certID.Matches(cert.Leaf) {
+		return nil, newCertificateNotFoundError(certID)
+	}
+	return cert, nil
+}
+
+func newCertificateNotFoundError(certID acme.CertID) *acme.Error {
+	err := acme.NewError(acme.ErrorMalformedType, "certificate %s not found", certID)
+	err.Status = http.StatusNotFound
+	return err
+}
+
+// checkReplacedCertificate checks that the certificate identified by the ARI
+// certID in the replaces field of a new-order request can be replaced by the
+// account. The certificate must belong to the account, share at least one
+// identifier with the new order, and must not be replaced by another pending,
+// ready or processing order.
+func checkReplacedCertificate(ctx context.Context, db acme.DB, acc *acme.Account, replaces string, identifiers []acme.Identifier) error {
+	certID, err := acme.ParseCertID(replaces)
+	if err != nil {
+		return err
+	}
+	cert, err := getCertificateByCertID(ctx, db, certID)
+	if err != nil {
+		return err
+	}
+	if cert.AccountID != acc.ID {
+		return acme.NewError(acme.ErrorUnauthorizedType,
+			"account '%s' does not own certificate '%s'", acc.ID, replaces)
+	}
+	if !sharesIdentifier(cert.Leaf, identifiers) {
+		return acme.NewError(acme.ErrorMalformedType,
+			"order does not share any identifier with certificate '%s'", replaces)
+	}
+
+	// A failed or expired renewal can be retried.
+	orderIDs, err := db.GetOrdersByReplaces(ctx, replaces)
+	if err != nil {
+		return acme.WrapErrorISE(err, "error retrieving orders")
+	}
+	for _, id := range orderIDs {
+		o, err := db.GetOrder(ctx, id)
+		if err != nil {
+			return acme.WrapErrorISE(err, "error retrieving order")
+		}
+		switch o.Status {
+		case acme.StatusPending, acme.StatusReady, acme.StatusProcessing:
+			return acme.NewError(acme.ErrorAlreadyReplacedType,
+				"certificate '%s' is already replaced by order '%s'", replaces, o.ID)
+		}
+	}
+	return nil
+}
+
+// sharesIdentifier returns true if one of the DNS or IP identifiers is in the
+// certificate. Certificates for permanent identifiers are bound to an attested
+// key, so they always share the identifier.
+func sharesIdentifier(crt *x509.Certificate, identifiers []acme.Identifier) bool {
+	for _, id := range identifiers {
+		switch id.Type {
+		case acme.DNS:
+			if crt.Subject.CommonName == id.Value || slices.Contains(crt.DNSNames, id.Value) {
+				return true
+			}
+		case acme.IP:
+			ip := net.ParseIP(id.Value)
+			for _, certIP := range crt.IPAddresses {
+				if certIP.Equal(ip) {
+					return true
+				}
+			}
+		case acme.PermanentIdentifier:
+			return true
+		}
+	}
+	return false
+}
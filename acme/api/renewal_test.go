@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+func mustRenewalCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	now := time.Now().UTC().Truncate(time.Second)
+	return &x509.Certificate{
+		SerialNumber:   big.NewInt(1234),
+		AuthorityKeyId: []byte{1, 2, 3, 4},
+		NotBefore:      now,
+		NotAfter:       now.Add(24 * time.Hour),
+		DNSNames:       []string{"example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("127.0.0.1")},
+	}
+}
+
+func TestGetRenewalInfo(t *testing.T) {
+	crt := mustRenewalCertificate(t)
+	certID := acme.NewCertID(crt).String()
+
+	type test struct {
+		certID     string
+		db         acme.DB
+		ca         acme.CertificateAuthority
+		statusCode int
+		want       *acme.RenewalInfo
+		errType    string
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"ok": func(t *testing.T) test {
+			return test{
+				certID: certID,
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						assert.Equal(t, "1234", serial)
+						return &acme.Certificate{Leaf: crt}, nil
+					},
+				},
+				ca:         &mockCA{},
+				statusCode: 200,
+				want:       acme.NewRenewalInfo(crt, false, time.Now()),
+			}
+		},
+		"ok/revoked": func(t *testing.T) test {
+			return test{
+				certID: certID,
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{Leaf: crt}, nil
+					},
+				},
+				ca: &mockCA{
+					MockIsRevoked: func(sn string) (bool, error) {
+						return true, nil
+					},
+				},
+				statusCode: 200,
+			}
+		},
+		"fail/bad-certID": func(t *testing.T) test {
+			return test{
+				certID:     "foo",
+				db:         &acme.MockDB{},
+				ca:         &mockCA{},
+				statusCode: 400,
+				errType:    "urn:ietf:params:acme:error:malformed",
+			}
+		},
+		"fail/not-found": func(t *testing.T) test {
+			return test{
+				certID: certID,
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return nil, acme.NewError(acme.ErrorMalformedType, "certificate with serial %s not found", serial)
+					},
+				},
+				ca:         &mockCA{},
+				statusCode: 404,
+				errType:    "urn:ietf:params:acme:error:malformed",
+			}
+		},
+		"fail/other-authority-key": func(t *testing.T) test {
+			return test{
+				certID: acme.CertID{AuthorityKeyID: []byte{4, 3, 2, 1}, SerialNumber: crt.SerialNumber}.String(),
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{Leaf: crt}, nil
+					},
+				},
+				ca:         &mockCA{},
+				statusCode: 404,
+				errType:    "urn:ietf:params:acme:error:malformed",
+			}
+		},
+		"fail/db.GetCertificateBySerial-error": func(t *testing.T) test {
+			return test{
+				certID: certID,
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return nil, errors.New("force")
+					},
+				},
+				ca:         &mockCA{},
+				statusCode: 500,
+				errType:    "urn:ietf:params:acme:error:serverInternal",
+			}
+		},
+		"fail/ca.IsRevoked-error": func(t *testing.T) test {
+			return test{
+				certID: certID,
+				db: &acme.MockDB{
+					MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+						return &acme.Certificate{Leaf: crt}, nil
+					},
+				},
+				ca: &mockCA{
+					MockIsRevoked: func(sn string) (bool, error) {
+						return false, errors.New("force")
+					},
+				},
+				statusCode: 500,
+				errType:    "urn:ietf:params:acme:error:serverInternal",
+			}
+		},
+	}
+	for name, setup := range tests {
+		tc := setup(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.ca)
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("certID", tc.certID)
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			ctx = newBaseContext(ctx, tc.db)
+			req := httptest.NewRequest("GET", "/renewal-info/"+tc.certID, http.NoBody).WithContext(ctx)
+			w := httptest.NewRecorder()
+			GetRenewalInfo(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.statusCode, res.StatusCode)
+			if tc.errType != "" {
+				var ae acme.Error
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&ae))
+				assert.Equal(t, tc.errType, ae.Type)
+				return
+			}
+
+			var got acme.RenewalInfo
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+			assert.Equal(t, "21600", res.Header.Get("Retry-After"))
+			if tc.want != nil {
+				assert.Equal(t, tc.want, &got)
+			} else {
+				assert.True(t, got.SuggestedWindow.End.Before(time.Now()))
+			}
+		})
+	}
+}
+
+func Test_checkReplacedCertificate(t *testing.T) {
+	crt := mustRenewalCertificate(t)
+	certID := acme.NewCertID(crt).String()
+	acc := &acme.Account{ID: "accID"}
+	dns := []acme.Identifier{{Type: acme.DNS, Value: "example.com"}}
+
+	newDB := func(accountID string, orders ...*acme.Order) acme.DB {
+		return &acme.MockDB{
+			MockGetCertificateBySerial: func(ctx context.Context, serial string) (*acme.Certificate, error) {
+				return &acme.Certificate{AccountID: accountID, Leaf: crt}, nil
+			},
+			MockGetOrdersByReplaces: func(ctx context.Context, replaces string) ([]string, error) {
+				var ids []string
+				for _, o := range orders {
+					if o.Replaces == replaces {
+						ids = append(ids, o.ID)
+					}
+				}
+				return ids, nil
+			},
+			MockGetOrder: func(ctx context.Context, id string) (*acme.Order, error) {
+				for _, o := range orders {
+					if o.ID == id {
+						return o, nil
+					}
+				}
+				return nil, errors.New("not found")
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		db          acme.DB
+		replaces    string
+		identifiers []acme.Identifier
+		errType     string
+	}{
+		{"ok", newDB("accID", &acme.Order{ID: "ordID"}), certID, dns, ""},
+		{"ok ip", newDB("accID"), certID, []acme.Identifier{{Type: acme.IP, Value: "127.0.0.1"}}, ""},
+		{"ok permanent identifier", newDB("accID"), certID, []acme.Identifier{{Type: acme.PermanentIdentifier, Value: "12345678"}}, ""},
+		{"fail certID", newDB("accID"), "foo", dns, "urn:ietf:params:acme:error:malformed"},
+		{"fail other account", newDB("otherID"), certID, dns, "urn:ietf:params:acme:error:unauthorized"},
+		{"fail identifiers", newDB("accID"), certID, []acme.Identifier{{Type: acme.DNS, Value: "other.com"}}, "urn:ietf:params:acme:error:malformed"},
+		{"ok replaced by invalid order", newDB("accID", &acme.Order{ID: "ordID", Replaces: certID, Status: acme.StatusInvalid}), certID, dns, ""},
+		{"ok replaced by valid order", newDB("accID", &acme.Order{ID: "ordID", Replaces: certID, Status: acme.StatusValid}), certID, dns, ""},
+		{"fail already replaced", newDB("accID", &acme.Order{ID: "ordID", Replaces: certID, Status: acme.StatusPending}), certID, dns, "urn:ietf:params:acme:error:alreadyReplaced"},
+		{"fail already replaced ready", newDB("accID", &acme.Order{ID: "ordID", Replaces: certID, Status: acme.StatusReady}), certID, dns, "urn:ietf:params:acme:error:alreadyReplaced"},
+		{"fail already replaced processing", newDB("accID", &acme.Order{ID: "ordID", Replaces: certID, Status: acme.StatusProcessing}), certID, dns, "urn:ietf:params:acme:error:alreadyReplaced"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkReplacedCertificate(context.Background(), tt.db, acc, tt.replaces, tt.identifiers)
+			if tt.errType == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var ae *acme.Error
+			if assert.ErrorAs(t, err, &ae) {
+				assert.Equal(t, tt.errType, ae.Type)
+			}
+		})
+	}
+}
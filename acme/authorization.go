@@ -8,16 +8,17 @@ import (
 
 // Authorization representst an ACME Authorization.
 type Authorization struct {
-	ID          string       `json:"-"`
-	AccountID   string       `json:"-"`
-	Token       string       `json:"-"`
-	Fingerprint string       `json:"-"`
-	Identifier  Identifier   `json:"identifier"`
-	Status      Status       `json:"status"`
-	Challenges  []*Challenge `json:"challenges"`
-	Wildcard    bool         `json:"wildcard"`
-	ExpiresAt   time.Time    `json:"expires"`
-	Error       *Error       `json:"error,omitempty"`
+	ID            string       `json:"-"`
+	AccountID     string       `json:"-"`
+	Token         string       `json:"-"`
+	Fingerprint   string       `json:"-"`
+	Identifier    Identifier   `json:"identifier"`
+	Status        Status       `json:"status"`
+	Challenges    []*Challenge `json:"challenges"`
+	Wildcard      bool         `json:"wildcard"`
+	ExpiresAt     time.Time    `json:"expires"`
+	Error         *Error       `json:"error,omitempty"`
+	PreAuthorized bool         `json:"-"`
 }
 
 // ToLog enables response logging.
@@ -0,0 +1,239 @@
+package acme
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTypeCAA is the type of the CAA records, it is not defined in dnsmessage.
+const dnsTypeCAA = dnsmessage.Type(257)
+
+// resolvConf is the file used to get the DNS servers of the system.
+var resolvConf = "/etc/resolv.conf"
+
+// CAARecord is a Certification Authority Authorization record as defined in
+// RFC 8659.
+type CAARecord struct {
+	Flag  uint8
+	Tag   string
+	Value string
+}
+
+// IsCritical returns true if the issuer critical flag of the record is set.
+func (r CAARecord) IsCritical() bool {
+	return r.Flag&128 != 0
+}
+
+// caaLookuper is the interface implemented by the clients that can look up CAA
+// records.
+type caaLookuper interface {
+	LookupCAA(name string) ([]CAARecord, error)
+}
+
+// LookupCAA returns the relevant CAA record set for the given domain name. As
+// described in RFC 8659, if the domain name does not have CAA records, the
+// records of its parent domains are used. It returns no records if none of
+// the domains have them.
+func (r *DNSResolver) LookupCAA(ctx context.Context, name string) ([]CAARecord, error) {
+	for n := strings.TrimSuffix(name, "."); n != ""; {
+		answers, err := r.lookup(ctx, n, dnsTypeCAA)
+		var dnsErr *net.DNSError
+		if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			return nil, err
+		}
+		var records []CAARecord
+		for _, a := range answers {
+			body, ok := a.Body.(*dnsmessage.UnknownResource)
+			if !ok {
+				continue
+			}
+			rec, err := parseCAARecord(body.Data)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing CAA record of %s: %w", n, err)
+			}
+			records = append(records, rec)
+		}
+		if len(records) > 0 {
+			return records, nil
+		}
+		_, parent, ok := strings.Cut(n, ".")
+		if !ok {
+			break
+		}
+		n = parent
+	}
+	return nil, nil
+}
+
+func parseCAARecord(data []byte) (CAARecord, error) {
+	if len(data) < 2 {
+		return CAARecord{}, errors.New("record is too short")
+	}
+	tagLen := int(data[1])
+	if tagLen == 0 || len(data) < 2+tagLen {
+		return CAARecord{}, errors.New("invalid tag length")
+	}
+	return CAARecord{
+		Flag:  data[0],
+		Tag:   strings.ToLower(string(data[2 : 2+tagLen])),
+		Value: string(data[2+tagLen:]),
+	}, nil
+}
+
+// recursiveServers returns the configured DNS servers, or the servers of the
+// system if none are configured.
+func (r *DNSResolver) recursiveServers() []dnsServer {
+	if len(r.servers) > 0 {
+		return r.servers
+	}
+	return systemDNSServers()
+}
+
+// systemDNSServers returns the name servers in resolv.conf, defaulting to the
+// local host.
+func systemDNSServers() []dnsServer {
+	var servers []dnsServer
+	if f, err := os.Open(resolvConf); err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				servers = append(servers, dnsServer{
+					network: "udp",
+					addr:    net.JoinHostPort(fields[1], "53"),
+				})
+			}
+		}
+	}
+	if len(servers) == 0 {
+		servers = []dnsServer{
+			{network: "udp", addr: "127.0.0.1:53"},
+			{network: "udp", addr: "[::1]:53"},
+		}
+	}
+	return servers
+}
+
+// checkCAA verifies that the CAA records of the domain authorize the issuance
+// of a certificate by the provisioner, for the given account and validation
+// method. If the provisioner only logs the CAA failures, the failures are
+// logged and nil is returned.
+func checkCAA(ctx context.Context, p Provisioner, accountID, domain string, wildcard bool, method ChallengeType) *Error {
+	opts := p.GetCAAOptions()
+	if opts == nil {
+		return nil
+	}
+
+	var accountURI string
+	if linker, ok := LinkerFromContext(ctx); ok {
+		accountURI = linker.GetLink(ctx, AccountLinkType, accountID)
+	}
+
+	var acmeErr *Error
+	if lookuper, ok := MustClientFromContext(ctx).(caaLookuper); !ok {
+		acmeErr = NewErrorISE("acme client does not support CAA lookups")
+	} else if records, err := lookuper.LookupCAA(domain); err != nil {
+		acmeErr = WrapError(ErrorDNSType, err, "error looking up CAA records for domain %s", domain)
+	} else if err := authorizeCAA(records, p.GetCAAIdentities(), wildcard, accountURI, method); err != nil {
+		acmeErr = NewDetailedError(ErrorCaaType, "CAA records for domain %s do not authorize the issuance: %s", domain, err)
+	}
+
+	if acmeErr != nil && opts.IsLogOnly() {
+		log.Printf("ignoring CAA failure for domain %s: %v", domain, acmeErr.Err)
+		return nil
+	}
+	return acmeErr
+}
+
+// isCAAForbidden returns true if the error was caused by CAA records that do
+// not authorize the issuance.
+func isCAAForbidden(err *Error) bool {
+	return err.Type == errorMap[ErrorCaaType].typ
+}
+
+// authorizeCAA returns an error if the CAA record set does not authorize any
+// of the issuer domain names. The "issuewild" properties are used for wildcard
+// names if present, the "issue" properties otherwise. If the matching
+// property has the "accounturi" or "validationmethods" parameters (RFC 8657),
+// they must match the account URI and the validation method used.
+func authorizeCAA(records []CAARecord, identities []string, wildcard bool, accountURI string, method ChallengeType) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var issue, issueWild []CAARecord
+	for _, r := range records {
+		switch r.Tag {
+		case "issue":
+			issue = append(issue, r)
+		case "issuewild":
+			issueWild = append(issueWild, r)
+		case "iodef", "contactemail", "contactphone":
+		default:
+			if r.IsCritical() {
+				return fmt.Errorf("unknown critical property %q", r.Tag)
+			}
+		}
+	}
+
+	properties := issue
+	if wildcard && len(issueWild) > 0 {
+		properties = issueWild
+	}
+	if len(properties) == 0 {
+		return nil
+	}
+
+	for _, r := range properties {
+		issuer, params, ok := parseCAAValue(r.Value)
+		if !ok || issuer == "" || !containsFold(identities, issuer) {
+			continue
+		}
+		if v, ok := params["accounturi"]; ok && v != accountURI {
+			continue
+		}
+		if v, ok := params["validationmethods"]; ok && !containsFold(strings.Split(v, ","), string(method)) {
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("no property authorizes %s", strings.Join(identities, ", "))
+}
+
+// parseCAAValue parses the value of an issue or issuewild property, returning
+// the issuer domain name and the parameters.
+func parseCAAValue(value string) (string, map[string]string, bool) {
+	parts := strings.Split(value, ";")
+	issuer := strings.TrimSpace(parts[0])
+	params := make(map[string]string)
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(p, "=")
+		if !ok {
+			return "", nil, false
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(val)
+	}
+	return strings.TrimSuffix(issuer, "."), params, true
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,272 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+type caaClient struct {
+	mockClient
+	lookupCAA func(name string) ([]CAARecord, error)
+}
+
+func (c *caaClient) LookupCAA(name string) ([]CAARecord, error) { return c.lookupCAA(name) }
+
+func caaResource(t *testing.T, name string, flag uint8, tag, value string) dnsmessage.Resource {
+	t.Helper()
+	data := append([]byte{flag, byte(len(tag))}, tag+value...)
+	return testResource(t, name, &dnsmessage.UnknownResource{Type: dnsTypeCAA, Data: data})
+}
+
+func TestDNSResolver_LookupCAA(t *testing.T) {
+	addr := startTestDNSServer(t, func(q dnsmessage.Question, recursive bool) (dnsmessage.RCode, []dnsmessage.Resource) {
+		assert.Equal(t, dnsTypeCAA, q.Type)
+		switch q.Name.String() {
+		case "example.com.":
+			return dnsmessage.RCodeSuccess, []dnsmessage.Resource{
+				caaResource(t, "example.com.", 0, "issue", "ca.example.com"),
+				caaResource(t, "example.com.", 128, "iodef", "mailto:security@example.com"),
+			}
+		case "alias.example.org.":
+			return dnsmessage.RCodeSuccess, []dnsmessage.Resource{
+				testResource(t, "alias.example.org.", &dnsmessage.CNAMEResource{CNAME: mustDNSName(t, "example.com.")}),
+			}
+		case "nx.example.com.", "sub.nx.example.com.":
+			return dnsmessage.RCodeNameError, nil
+		case "fail.example.net.":
+			return dnsmessage.RCodeServerFailure, nil
+		default:
+			return dnsmessage.RCodeSuccess, nil
+		}
+	}, false)
+
+	r, err := NewDNSResolver(DNSResolverOptions{Servers: []string{addr}})
+	require.NoError(t, err)
+
+	want := []CAARecord{
+		{Flag: 0, Tag: "issue", Value: "ca.example.com"},
+		{Flag: 128, Tag: "iodef", Value: "mailto:security@example.com"},
+	}
+	tests := []struct {
+		name    string
+		want    []CAARecord
+		wantErr bool
+	}{
+		{"example.com", want, false},
+		{"www.example.com", want, false},
+		{"sub.nx.example.com", want, false},
+		{"alias.example.org", want, false},
+		{"www.example.org", nil, false},
+		{"fail.example.net", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.LookupCAA(context.Background(), tt.name)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_systemDNSServers(t *testing.T) {
+	tmp := resolvConf
+	t.Cleanup(func() { resolvConf = tmp })
+
+	resolvConf = filepath.Join(t.TempDir(), "resolv.conf")
+	require.NoError(t, os.WriteFile(resolvConf, []byte("# comment\nsearch example.com\nnameserver 10.0.0.53\nnameserver 2001:db8::53\n"), 0600))
+	assert.Equal(t, []dnsServer{{"udp", "10.0.0.53:53"}, {"udp", "[2001:db8::53]:53"}}, systemDNSServers())
+
+	resolvConf = filepath.Join(t.TempDir(), "missing.conf")
+	assert.Equal(t, []dnsServer{{"udp", "127.0.0.1:53"}, {"udp", "[::1]:53"}}, systemDNSServers())
+}
+
+func Test_authorizeCAA(t *testing.T) {
+	identities := []string{"ca.example.com"}
+	accountURI := "https://ca.example.com/acme/acme/account/accID"
+	issue := func(value string) CAARecord {
+		return CAARecord{Tag: "issue", Value: value}
+	}
+	issueWild := func(value string) CAARecord {
+		return CAARecord{Tag: "issuewild", Value: value}
+	}
+	tests := []struct {
+		name     string
+		records  []CAARecord
+		wildcard bool
+		method   ChallengeType
+		wantErr  bool
+	}{
+		{"ok no records", nil, false, HTTP01, false},
+		{"ok no issue", []CAARecord{{Tag: "iodef", Value: "mailto:security@example.com"}}, false, HTTP01, false},
+		{"ok issue", []CAARecord{issue("other.example.org"), issue("CA.example.com.")}, false, HTTP01, false},
+		{"ok params", []CAARecord{issue("ca.example.com; accounturi=" + accountURI + "; validationmethods=dns-01,http-01")}, false, HTTP01, false},
+		{"ok wildcard issue", []CAARecord{issue("ca.example.com")}, true, DNS01, false},
+		{"ok wildcard issuewild", []CAARecord{issue("other.example.org"), issueWild("ca.example.com")}, true, DNS01, false},
+		{"ok non-critical unknown", []CAARecord{issue("ca.example.com"), {Tag: "future", Value: "value"}}, false, HTTP01, false},
+		{"fail other issuer", []CAARecord{issue("other.example.org")}, false, HTTP01, true},
+		{"fail empty issuer", []CAARecord{issue(";")}, false, HTTP01, true},
+		{"fail accounturi", []CAARecord{issue("ca.example.com; accounturi=https://ca.example.com/acme/acme/account/other")}, false, HTTP01, true},
+		{"fail validationmethods", []CAARecord{issue("ca.example.com; validationmethods=dns-01")}, false, HTTP01, true},
+		{"fail malformed params", []CAARecord{issue("ca.example.com; accounturi")}, false, HTTP01, true},
+		{"fail issuewild", []CAARecord{issue("ca.example.com"), issueWild(";")}, true, DNS01, true},
+		{"fail critical unknown", []CAARecord{issue("ca.example.com"), {Flag: 128, Tag: "future", Value: "value"}}, false, HTTP01, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizeCAA(tt.records, identities, tt.wildcard, accountURI, tt.method)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_checkCAA(t *testing.T) {
+	newContext := func(records []CAARecord, err error) context.Context {
+		ctx := NewClientContext(context.Background(), &caaClient{
+			lookupCAA: func(name string) ([]CAARecord, error) {
+				assert.Equal(t, "example.com", name)
+				return records, err
+			},
+		})
+		return NewLinkerContext(ctx, NewLinker("ca.example.com", "acme"))
+	}
+	newProvisioner := func(opts *provisioner.ACMECAAOptions) Provisioner {
+		return &MockProvisioner{
+			MgetName:          func() string { return "acme" },
+			MgetCAAIdentities: func() []string { return []string{"ca.example.com"} },
+			MgetCAAOptions:    func() *provisioner.ACMECAAOptions { return opts },
+		}
+	}
+	enforce := &provisioner.ACMECAAOptions{}
+	logOnly := &provisioner.ACMECAAOptions{Policy: provisioner.CAAPolicyLog}
+	forbid := []CAARecord{{Tag: "issue", Value: ";"}}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		prov     Provisioner
+		wantType string
+	}{
+		{"ok disabled", newContext(forbid, nil), newProvisioner(nil), ""},
+		{"ok accounturi", newContext([]CAARecord{{Tag: "issue", Value: "ca.example.com; accounturi=https://ca.example.com/acme/acme/account/accID"}}, nil), newProvisioner(enforce), ""},
+		{"ok log forbidden", newContext(forbid, nil), newProvisioner(logOnly), ""},
+		{"ok log lookup error", newContext(nil, errors.New("force")), newProvisioner(logOnly), ""},
+		{"fail forbidden", newContext(forbid, nil), newProvisioner(enforce), "urn:ietf:params:acme:error:caa"},
+		{"fail lookup error", newContext(nil, errors.New("force")), newProvisioner(enforce), "urn:ietf:params:acme:error:dns"},
+		{"fail client", NewClientContext(context.Background(), &mockClient{}), newProvisioner(enforce), "urn:ietf:params:acme:error:serverInternal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewProvisionerContext(tt.ctx, tt.prov)
+			err := checkCAA(ctx, tt.prov, "accID", "example.com", false, HTTP01)
+			if tt.wantType == "" {
+				assert.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			assert.Equal(t, tt.wantType, err.Type)
+			assert.Equal(t, tt.wantType == "urn:ietf:params:acme:error:caa", isCAAForbidden(err))
+		})
+	}
+}
+
+func TestOrder_checkCAA(t *testing.T) {
+	var looked []string
+	ctx := NewClientContext(context.Background(), &caaClient{
+		lookupCAA: func(name string) ([]CAARecord, error) {
+			looked = append(looked, name)
+			return []CAARecord{{Tag: "issue", Value: "ca.example.com; validationmethods=dns-01"}}, nil
+		},
+	})
+	db := &MockDB{
+		MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+			switch id {
+			case "az1":
+				return &Authorization{
+					Identifier: Identifier{Type: DNS, Value: "example.com"},
+					Wildcard:   true,
+					Challenges: []*Challenge{{Type: HTTP01, Status: StatusPending}, {Type: DNS01, Status: StatusValid}},
+				}, nil
+			case "az2":
+				return &Authorization{Identifier: Identifier{Type: IP, Value: "10.0.0.1"}}, nil
+			default:
+				return &Authorization{
+					Identifier: Identifier{Type: DNS, Value: "www.example.com"},
+					Challenges: []*Challenge{{Type: HTTP01, Status: StatusValid}},
+				}, nil
+			}
+		},
+	}
+	prov := &MockProvisioner{
+		MgetCAAIdentities: func() []string { return []string{"ca.example.com"} },
+		MgetCAAOptions:    func() *provisioner.ACMECAAOptions { return &provisioner.ACMECAAOptions{} },
+	}
+
+	o := &Order{AuthorizationIDs: []string{"az1", "az2"}}
+	assert.NoError(t, o.checkCAA(ctx, db, prov))
+	assert.Equal(t, []string{"example.com"}, looked)
+
+	o = &Order{AuthorizationIDs: []string{"az1", "az2", "az3"}}
+	err := o.checkCAA(ctx, db, prov)
+	var acmeErr *Error
+	require.ErrorAs(t, err, &acmeErr)
+	assert.True(t, isCAAForbidden(acmeErr))
+	assert.Contains(t, acmeErr.Detail, "www.example.com")
+}
+
+func TestChallenge_validateCAA(t *testing.T) {
+	var updated *Challenge
+	db := &MockDB{
+		MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+			assert.Equal(t, "azID", id)
+			return &Authorization{Identifier: Identifier{Type: DNS, Value: "example.com"}, Wildcard: true}, nil
+		},
+		MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+			updated = ch
+			return nil
+		},
+	}
+	newContext := func(opts *provisioner.ACMECAAOptions) context.Context {
+		ctx := NewClientContext(context.Background(), &caaClient{
+			lookupCAA: func(name string) ([]CAARecord, error) {
+				assert.Equal(t, "example.com", name)
+				return []CAARecord{{Tag: "issue", Value: "ca.example.com"}, {Tag: "issuewild", Value: ";"}}, nil
+			},
+		})
+		return NewProvisionerContext(ctx, &MockProvisioner{
+			MgetCAAIdentities: func() []string { return []string{"ca.example.com"} },
+			MgetCAAOptions:    func() *provisioner.ACMECAAOptions { return opts },
+		})
+	}
+
+	// The records are only checked if enabled.
+	ch := &Challenge{AuthorizationID: "azID", Value: "example.com", Type: DNS01, Status: StatusPending}
+	ok, err := ch.validateCAA(newContext(&provisioner.ACMECAAOptions{}), db)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Nil(t, updated)
+
+	// Wildcard authorizations use the issuewild property.
+	ok, err = ch.validateCAA(newContext(&provisioner.ACMECAAOptions{CheckChallenges: true}), db)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+	require.NotNil(t, updated)
+	assert.Equal(t, StatusInvalid, updated.Status)
+	assert.True(t, isCAAForbidden(updated.Error))
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/subtle"
@@ -27,6 +28,7 @@ import (
 
 	"github.com/fxamacker/cbor/v2"
 	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/legacy/tpm2/credactivation"
 	"golang.org/x/exp/slices"
 
 	"github.com/smallstep/go-attestation/attest"
@@ -36,7 +38,11 @@ import (
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/internal/metrix"
+	"github.com/smallstep/certificates/mdm"
+	"github.com/smallstep/certificates/webhook"
 )
 
 type ChallengeType string
@@ -73,9 +79,78 @@ type Challenge struct {
 	Type            ChallengeType `json:"type"`
 	Status          Status        `json:"status"`
 	Token           string        `json:"token"`
-	ValidatedAt     string        `json:"validated,omitempty"`
+	ValidatedAt     time.Time     `json:"-"`
 	URL             string        `json:"url"`
 	Error           *Error        `json:"error,omitempty"`
+	RetryCount      int           `json:"-"`
+	RetryAfter      time.Time     `json:"-"`
+
+	// Credential is the TPM credential a device-attest-01 challenge using the
+	// tpm format must activate, and CredentialDigest is the SHA-256 of its
+	// secret.
+	Credential       *TPMCredential `json:"credential,omitempty"`
+	CredentialDigest []byte         `json:"-"`
+}
+
+// TPMCredential is a credential created with TPM2_MakeCredential for the name
+// of an attestation key and encrypted to an endorsement key. Only the TPM with
+// both keys can recover its secret with TPM2_ActivateCredential.
+type TPMCredential struct {
+	CredentialBlob  []byte `json:"credentialBlob"`
+	EncryptedSecret []byte `json:"encryptedSecret"`
+}
+
+type challengeAlias Challenge
+
+// challengeJSON is the JSON representation of a Challenge. The validated
+// attribute is encoded as an RFC 3339 timestamp in UTC and omitted if the
+// challenge has not been validated. The retryAfter attribute reports the time
+// of the next validation attempt of a challenge that is being processed.
+type challengeJSON struct {
+	*challengeAlias
+	ValidatedAt string `json:"validated,omitempty"`
+	RetryAfter  string `json:"retryAfter,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (ch Challenge) MarshalJSON() ([]byte, error) {
+	v := challengeJSON{
+		challengeAlias: (*challengeAlias)(&ch),
+	}
+	if !ch.ValidatedAt.IsZero() {
+		v.ValidatedAt = ch.ValidatedAt.UTC().Format(time.RFC3339)
+	}
+	if ch.Status == StatusProcessing && !ch.RetryAfter.IsZero() {
+		v.RetryAfter = ch.RetryAfter.UTC().Format(time.RFC3339)
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (ch *Challenge) UnmarshalJSON(data []byte) error {
+	v := challengeJSON{
+		challengeAlias: (*challengeAlias)(ch),
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	ch.ValidatedAt = time.Time{}
+	if v.ValidatedAt != "" {
+		t, err := time.Parse(time.RFC3339, v.ValidatedAt)
+		if err != nil {
+			return fmt.Errorf("error parsing validated: %w", err)
+		}
+		ch.ValidatedAt = t.UTC()
+	}
+	ch.RetryAfter = time.Time{}
+	if v.RetryAfter != "" {
+		t, err := time.Parse(time.RFC3339, v.RetryAfter)
+		if err != nil {
+			return fmt.Errorf("error parsing retryAfter: %w", err)
+		}
+		ch.RetryAfter = t.UTC()
+	}
+	return nil
 }
 
 // ToLog enables response logging.
@@ -90,11 +165,88 @@ func (ch *Challenge) ToLog() (interface{}, error) {
 // Validate attempts to validate the Challenge. Stores changes to the Challenge
 // type using the DB interface. If the Challenge is validated, the 'status' and
 // 'validated' attributes are updated.
+//
+// A challenge in the processing status was queued for validation with retries
+// that are no longer available, for example because they were disabled in the
+// provisioner. It is validated once, and marked as invalid if the validation
+// fails with an error that would have been retried.
 func (ch *Challenge) Validate(ctx context.Context, db DB, jwk *jose.JSONWebKey, payload []byte) error {
-	// If already valid or invalid then return without performing validation.
-	if ch.Status != StatusPending {
+	switch ch.Status {
+	case StatusPending:
+		return ch.validate(ctx, db, jwk, payload)
+	case StatusProcessing:
+		if err := ch.validate(ctx, db, jwk, payload); err != nil {
+			return err
+		}
+		if ch.Status == StatusProcessing {
+			return ch.invalidateProcessing(ctx, db)
+		}
+		return nil
+	default:
+		// If already valid or invalid then return without performing validation.
 		return nil
 	}
+}
+
+// validate runs the validation method of the challenge type without checking
+// the status of the challenge. If multi-perspective validation is enabled, the
+// http-01, dns-01, and tls-alpn-01 challenges are also validated from the
+// remote perspectives. Failed validations are counted in the failed challenge
+// rate limits of the provisioner.
+func (ch *Challenge) validate(ctx context.Context, db DB, jwk *jose.JSONWebKey, payload []byte) (err error) {
+	prevErr, prevStatus := ch.Error, ch.Status
+	start := time.Now()
+	defer func() {
+		if err == nil && ch.Error != nil && ch.Error != prevErr {
+			recordFailedChallenge(ctx, db, ch)
+		}
+		if err == nil && ch.Status != prevStatus {
+			if auditErr := auditChallenge(ctx, ch, prevStatus); auditErr != nil {
+				err = WrapErrorISE(auditErr, "error writing audit log")
+			}
+		}
+		metrix.FromContext(ctx).ACMEChallengeValidated(string(ch.Type), validationOutcome(ch, prevErr, err), time.Since(start))
+	}()
+
+	switch ch.Type {
+	case HTTP01, DNS01, TLSALPN01:
+		if ok, err := ch.validateCAA(ctx, db); !ok {
+			return err
+		}
+		if v, ok := MultiPerspectiveFromContext(ctx); ok {
+			return v.validate(ctx, ch, db, jwk)
+		}
+	}
+	return ch.validateLocal(ctx, db, jwk, payload)
+}
+
+// validateCAA checks the CAA records of the identifier of the challenge if the
+// provisioner is configured to check them when challenges are validated. It
+// returns false if the challenge must not be validated, storing the CAA error
+// in the challenge. Challenges are marked as invalid if the records do not
+// authorize the issuance.
+func (ch *Challenge) validateCAA(ctx context.Context, db DB) (bool, error) {
+	p, ok := ProvisionerFromContext(ctx)
+	if !ok || !p.GetCAAOptions().IsCheckChallenges() {
+		return true, nil
+	}
+	wildcard := strings.HasPrefix(ch.Value, "*.")
+	if ch.AuthorizationID != "" {
+		az, err := db.GetAuthorization(ctx, ch.AuthorizationID)
+		if err != nil {
+			return false, WrapErrorISE(err, "error getting authorization %q", ch.AuthorizationID)
+		}
+		wildcard = az.Wildcard
+	}
+	if caaErr := checkCAA(ctx, p, ch.AccountID, strings.TrimPrefix(ch.Value, "*."), wildcard, ch.Type); caaErr != nil {
+		return false, storeError(ctx, db, ch, isCAAForbidden(caaErr), caaErr)
+	}
+	return true, nil
+}
+
+// validateLocal runs the validation method of the challenge type from the
+// network of the CA.
+func (ch *Challenge) validateLocal(ctx context.Context, db DB, jwk *jose.JSONWebKey, payload []byte) error {
 	switch ch.Type {
 	case HTTP01:
 		return http01Validate(ctx, ch, db, jwk)
@@ -149,7 +301,7 @@ func http01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWeb
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
-	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+	ch.ValidatedAt = clock.Now()
 
 	if err = db.UpdateChallenge(ctx, ch); err != nil {
 		return WrapErrorISE(err, "error updating challenge")
@@ -277,7 +429,7 @@ func tlsalpn01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSON
 
 			ch.Status = StatusValid
 			ch.Error = nil
-			ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+			ch.ValidatedAt = clock.Now()
 
 			if err = db.UpdateChallenge(ctx, ch); err != nil {
 				return WrapErrorISE(err, "tlsalpn01ValidateChallenge - error updating challenge")
@@ -334,7 +486,7 @@ func dns01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebK
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
-	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+	ch.ValidatedAt = clock.Now()
 
 	if err = db.UpdateChallenge(ctx, ch); err != nil {
 		return WrapErrorISE(err, "error updating challenge")
@@ -383,7 +535,7 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 	format := att.Format
 	prov := MustProvisionerFromContext(ctx)
 	if !prov.IsAttestationFormatEnabled(ctx, provisioner.ACMEAttestationFormat(format)) {
-		if format != "apple" && format != "step" && format != "tpm" {
+		if format != "apple" && format != "step" && format != "tpm" && format != "android-key" {
 			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "unsupported attestation object format %q", format))
 		}
 
@@ -391,6 +543,7 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 			NewError(ErrorBadAttestationStatementType, "attestation format %q is not enabled", format))
 	}
 
+	var attested *webhook.DeviceAttestationData
 	switch format {
 	case "apple":
 		data, err := doAppleAttestationFormat(ctx, prov, ch, &att)
@@ -415,8 +568,6 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 
 		// Validate Apple's ClientIdentifier (Identifier.Value) with device
 		// identifiers.
-		//
-		// Note: We might want to use an external service for this.
 		if data.UDID != ch.Value && data.SerialNumber != ch.Value {
 			subproblem := NewSubproblemWithIdentifier(
 				ErrorRejectedIdentifierType,
@@ -426,8 +577,26 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "permanent identifier does not match").AddSubproblems(subproblem))
 		}
 
+		// Validate with the configured MDM that the device is enrolled and
+		// compliant.
+		if inventory := prov.GetDeviceInventory(); inventory != nil {
+			if err := validateDeviceInventory(ctx, inventory, data.SerialNumber, data.UDID); err != nil {
+				var acmeError *Error
+				if errors.As(err, &acmeError) {
+					return storeError(ctx, db, ch, true, acmeError)
+				}
+				return WrapErrorISE(err, "error looking up device")
+			}
+		}
+
 		// Update attestation key fingerprint to compare against the CSR
 		az.Fingerprint = data.Fingerprint
+		attested = &webhook.DeviceAttestationData{
+			PermanentIdentifiers: []string{data.UDID, data.SerialNumber},
+			SerialNumber:         data.SerialNumber,
+			UDID:                 data.UDID,
+			Certificate:          data.Certificate.Raw,
+		}
 	case "step":
 		data, err := doStepAttestationFormat(ctx, prov, ch, jwk, &att)
 		if err != nil {
@@ -456,9 +625,22 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 
 		// Update attestation key fingerprint to compare against the CSR
 		az.Fingerprint = data.Fingerprint
+		attested = &webhook.DeviceAttestationData{
+			PermanentIdentifiers: []string{data.SerialNumber},
+			SerialNumber:         data.SerialNumber,
+			Certificate:          data.Certificate.Raw,
+		}
 
 	case "tpm":
 		data, err := doTPMAttestationFormat(ctx, prov, ch, jwk, &att)
+		if errors.Is(err, errTPMCredentialActivationRequired) {
+			// The challenge remains pending until the device sends the
+			// secret of the credential.
+			if err := db.UpdateChallenge(ctx, ch); err != nil {
+				return WrapErrorISE(err, "error updating challenge")
+			}
+			return nil
+		}
 		if err != nil {
 			var acmeError *Error
 			if errors.As(err, &acmeError) {
@@ -486,28 +668,132 @@ func deviceAttest01Validate(ctx context.Context, ch *Challenge, db DB, jwk *jose
 
 		// Update attestation key fingerprint to compare against the CSR
 		az.Fingerprint = data.Fingerprint
+		attested = &webhook.DeviceAttestationData{
+			PermanentIdentifiers: data.PermanentIdentifiers,
+			Certificate:          data.Certificate.Raw,
+		}
+		if data.EKCertificate != nil {
+			attested.EKCertificate = data.EKCertificate.Raw
+			attested.EKIssuerSerial = ekIssuerSerial(data.EKCertificate)
+		}
+	case "android-key":
+		data, err := doAndroidKeyAttestationFormat(ctx, prov, ch, &att)
+		if err != nil {
+			var acmeError *Error
+			if errors.As(err, &acmeError) {
+				if acmeError.Status == 500 {
+					return acmeError
+				}
+				return storeError(ctx, db, ch, true, acmeError)
+			}
+			return WrapErrorISE(err, "error validating attestation")
+		}
+
+		// Validate the attestation challenge with SHA-256 of the token.
+		sum := sha256.Sum256([]byte(ch.Token))
+		if subtle.ConstantTimeCompare(data.Challenge, sum[:]) != 1 {
+			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "challenge token does not match"))
+		}
+
+		// Validate the challenged value with the serial number, IMEIs or MEID
+		// attested by the device.
+		if !slices.Contains(data.PermanentIdentifiers, ch.Value) {
+			subproblem := NewSubproblemWithIdentifier(
+				ErrorRejectedIdentifierType,
+				Identifier{Type: "permanent-identifier", Value: ch.Value},
+				"challenge identifier %q doesn't match any of the attested hardware identifiers %q", ch.Value, data.PermanentIdentifiers,
+			)
+			return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "permanent identifier does not match").AddSubproblems(subproblem))
+		}
+
+		// Update attestation key fingerprint to compare against the CSR
+		az.Fingerprint = data.Fingerprint
+		attested = &webhook.DeviceAttestationData{
+			PermanentIdentifiers: data.PermanentIdentifiers,
+			SerialNumber:         data.SerialNumber,
+			Certificate:          data.Certificate.Raw,
+		}
 	default:
 		return storeError(ctx, db, ch, true, NewDetailedError(ErrorBadAttestationStatementType, "unsupported attestation object format %q", format))
 	}
 
+	// Validate the attested device with the configured device attestation
+	// webhooks.
+	attested.Format = format
+	attested.Identifier = ch.Value
+	attested.Fingerprint = az.Fingerprint
+	if err := prov.AuthorizeDeviceAttestation(ctx, attested); err != nil {
+		if errors.Is(err, provisioner.ErrWebhookDenied) {
+			return storeError(ctx, db, ch, true, WrapDetailedError(ErrorRejectedIdentifierType, err, "device %q is not allowed", ch.Value))
+		}
+		return WrapErrorISE(err, "error validating device attestation")
+	}
+
 	// Update and store the challenge.
 	ch.Status = StatusValid
 	ch.Error = nil
-	ch.ValidatedAt = clock.Now().Format(time.RFC3339)
+	ch.ValidatedAt = clock.Now()
+
+	// Store the fingerprint in the authorization and the challenge
+	// atomically.
+	return db.RunTransaction(ctx, func(txDB DB) error {
+		if az.Fingerprint != "" {
+			if err := txDB.UpdateAuthorization(ctx, az); err != nil {
+				return WrapErrorISE(err, "error updating authorization")
+			}
+		}
+		if err := txDB.UpdateChallenge(ctx, ch); err != nil {
+			return WrapErrorISE(err, "error updating challenge")
+		}
+		return nil
+	})
+}
 
-	// Store the fingerprint in the authorization.
-	//
-	// TODO: add method to update authorization and challenge atomically.
-	if az.Fingerprint != "" {
-		if err := db.UpdateAuthorization(ctx, az); err != nil {
-			return WrapErrorISE(err, "error updating authorization")
+// checkAttestationRevocation checks the revocation status of the verified
+// attestation certificate chains using the revocation policy of the
+// provisioner. The attestation is accepted if any of the chains is not
+// revoked. Android key attestations are checked against the status list
+// published by Google, other formats use OCSP and CRLs.
+func checkAttestationRevocation(ctx context.Context, prov Provisioner, format string, chains [][]*x509.Certificate) error {
+	policy := prov.GetAttestationRevocationPolicy()
+	if policy == "" || policy == provisioner.RevocationPolicyDisable {
+		return nil
+	}
+
+	var err error
+	checker := MustRevocationCheckerFromContext(ctx)
+	check := checker.Check
+	if format == "android-key" {
+		check = checker.CheckAndroidKey
+	}
+	for _, chain := range chains {
+		if err = check(ctx, chain, policy == provisioner.RevocationPolicyRequire); err == nil {
+			return nil
 		}
 	}
+	if err == nil {
+		return nil
+	}
+	return WrapDetailedError(ErrorBadAttestationStatementType, err, "x5c is not valid")
+}
 
-	if err := db.UpdateChallenge(ctx, ch); err != nil {
-		return WrapErrorISE(err, "error updating challenge")
+// validateDeviceInventory checks that the device with the given serial number
+// and UDID is enrolled and compliant in the MDM. Errors from the MDM are
+// returned as is, so the challenge can be retried.
+func validateDeviceInventory(ctx context.Context, inventory mdm.Provider, serialNumber, udid string) error {
+	device, err := inventory.Lookup(ctx, serialNumber, udid)
+	switch {
+	case errors.Is(err, mdm.ErrDeviceNotFound):
+		return NewDetailedError(ErrorRejectedIdentifierType, "device %q is not enrolled", serialNumber)
+	case err != nil:
+		return err
+	case !device.Managed:
+		return NewDetailedError(ErrorRejectedIdentifierType, "device %q is not managed", serialNumber)
+	case !device.Compliant:
+		return NewDetailedError(ErrorRejectedIdentifierType, "device %q is not compliant", serialNumber)
+	default:
+		return nil
 	}
-	return nil
 }
 
 var (
@@ -519,6 +805,7 @@ type tpmAttestationData struct {
 	VerifiedChains       [][]*x509.Certificate
 	PermanentIdentifiers []string
 	Fingerprint          string
+	EKCertificate        *x509.Certificate
 }
 
 // coseAlgorithmIdentifier models a COSEAlgorithmIdentifier.
@@ -530,7 +817,7 @@ const (
 	coseAlgRS256 coseAlgorithmIdentifier = -257
 )
 
-func doTPMAttestationFormat(_ context.Context, prov Provisioner, ch *Challenge, jwk *jose.JSONWebKey, att *attestationObject) (*tpmAttestationData, error) {
+func doTPMAttestationFormat(ctx context.Context, prov Provisioner, ch *Challenge, jwk *jose.JSONWebKey, att *attestationObject) (*tpmAttestationData, error) {
 	ver, ok := att.AttStatement["ver"].(string)
 	if !ok {
 		return nil, NewDetailedError(ErrorBadAttestationStatementType, "ver not present")
@@ -569,19 +856,7 @@ func doTPMAttestationFormat(_ context.Context, prov Provisioner, ch *Challenge,
 		intermediates.AddCert(intCert)
 	}
 
-	// TODO(hs): this can be removed when permanent-identifier/hardware-module-name are handled correctly in
-	// the stdlib in https://cs.opensource.google/go/go/+/refs/tags/go1.19:src/crypto/x509/parser.go;drc=b5b2cf519fe332891c165077f3723ee74932a647;l=362,
-	// but I doubt that will happen.
-	if len(akCert.UnhandledCriticalExtensions) > 0 {
-		unhandledCriticalExtensions := akCert.UnhandledCriticalExtensions[:0]
-		for _, extOID := range akCert.UnhandledCriticalExtensions {
-			if !extOID.Equal(oidSubjectAlternativeName) {
-				// critical extensions other than the Subject Alternative Name remain unhandled
-				unhandledCriticalExtensions = append(unhandledCriticalExtensions, extOID)
-			}
-		}
-		akCert.UnhandledCriticalExtensions = unhandledCriticalExtensions
-	}
+	ignoreCriticalSubjectAlternativeName(akCert)
 
 	roots, ok := prov.GetAttestationRoots()
 	if !ok {
@@ -610,7 +885,9 @@ func doTPMAttestationFormat(_ context.Context, prov Provisioner, ch *Challenge,
 		return nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "AK certificate is not valid")
 	}
 
-	// TODO(hs): implement revocation check; Verify() doesn't perform CRL check nor OCSP lookup.
+	if err := checkAttestationRevocation(ctx, prov, "tpm", verifiedChains); err != nil {
+		return nil, err
+	}
 
 	sans, err := x509util.ParseSubjectAlternativeNames(akCert)
 	if err != nil {
@@ -622,6 +899,15 @@ func doTPMAttestationFormat(_ context.Context, prov Provisioner, ch *Challenge,
 		permanentIdentifiers[i] = pi.Identifier
 	}
 
+	// If the TPM manufacturer roots are configured, the attestation must be
+	// tied to a verified EK, and the device is identified by the EK.
+	var ekCert *x509.Certificate
+	if ekRoots, ok := prov.GetTPMEndorsementRoots(); ok {
+		if ekCert, permanentIdentifiers, err = verifyTPMEndorsementKey(ctx, prov, ch, att, akCert, ekRoots); err != nil {
+			return nil, err
+		}
+	}
+
 	// extract and validate pubArea, sig, certInfo and alg properties from the request body
 	pubArea, ok := att.AttStatement["pubArea"].([]byte)
 	if !ok {
@@ -709,6 +995,7 @@ func doTPMAttestationFormat(_ context.Context, prov Provisioner, ch *Challenge,
 		Certificate:          akCert,
 		VerifiedChains:       verifiedChains,
 		PermanentIdentifiers: permanentIdentifiers,
+		EKCertificate:        ekCert,
 	}
 
 	if data.Fingerprint, err = keyutil.Fingerprint(publicKey); err != nil {
@@ -719,6 +1006,163 @@ func doTPMAttestationFormat(_ context.Context, prov Provisioner, ch *Challenge,
 	return data, nil
 }
 
+// ignoreCriticalSubjectAlternativeName removes the Subject Alternative Name
+// from the unhandled critical extensions of the certificate. TPM certificates
+// use a critical SAN with names that are not supported by the stdlib.
+//
+// TODO(hs): this can be removed when permanent-identifier/hardware-module-name are handled correctly in
+// the stdlib in https://cs.opensource.google/go/go/+/refs/tags/go1.19:src/crypto/x509/parser.go;drc=b5b2cf519fe332891c165077f3723ee74932a647;l=362,
+// but I doubt that will happen.
+func ignoreCriticalSubjectAlternativeName(c *x509.Certificate) {
+	if len(c.UnhandledCriticalExtensions) > 0 {
+		unhandledCriticalExtensions := c.UnhandledCriticalExtensions[:0]
+		for _, extOID := range c.UnhandledCriticalExtensions {
+			if !extOID.Equal(oidSubjectAlternativeName) {
+				// critical extensions other than the Subject Alternative Name remain unhandled
+				unhandledCriticalExtensions = append(unhandledCriticalExtensions, extOID)
+			}
+		}
+		c.UnhandledCriticalExtensions = unhandledCriticalExtensions
+	}
+}
+
+// errTPMCredentialActivationRequired is returned by verifyTPMEndorsementKey
+// when the device has to activate the credential set in the challenge.
+var errTPMCredentialActivationRequired = errors.New("tpm credential activation required")
+
+// verifyTPMEndorsementKey verifies the Endorsement Key certificate chain in
+// the ekX5c property of the attestation statement using the TPM manufacturer
+// roots, and returns the permanent identifiers of the device.
+//
+// The AK must be bound to the EK with a credential activation that proves
+// that both keys reside in the same TPM. The AK public area is sent in the
+// akPub property. The first request creates a credential for the AK name
+// encrypted to the EK, sets it in the challenge, and returns
+// errTPMCredentialActivationRequired. The device activates it with
+// TPM2_ActivateCredential and sends the secret in the credentialSecret
+// property of a new request.
+//
+// The permanent identifiers are the ones in the EK certificate. If there are
+// none, the device is identified by the issuer and the serial number of the
+// EK certificate, as returned by ekIssuerSerial.
+func verifyTPMEndorsementKey(ctx context.Context, prov Provisioner, ch *Challenge, att *attestationObject, akCert *x509.Certificate, roots *x509.CertPool) (*x509.Certificate, []string, error) {
+	ekX5c, ok := att.AttStatement["ekX5c"].([]interface{})
+	if !ok {
+		return nil, nil, NewDetailedError(ErrorBadAttestationStatementType, "ekX5c not present")
+	}
+	if len(ekX5c) == 0 {
+		return nil, nil, NewDetailedError(ErrorBadAttestationStatementType, "ekX5c is empty")
+	}
+
+	certs := make([]*x509.Certificate, len(ekX5c))
+	for i, v := range ekX5c {
+		der, ok := v.([]byte)
+		if !ok {
+			return nil, nil, NewDetailedError(ErrorBadAttestationStatementType, "ekX5c is malformed")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "ekX5c is malformed")
+		}
+		certs[i] = cert
+	}
+	ekCert := certs[0]
+	ignoreCriticalSubjectAlternativeName(ekCert)
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	verifiedChains, err := ekCert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now().Truncate(time.Second),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "ekX5c is not valid")
+	}
+	if err := checkAttestationRevocation(ctx, prov, "tpm", verifiedChains); err != nil {
+		return nil, nil, err
+	}
+
+	if err := verifyTPMCredentialActivation(ch, att, akCert, ekCert); err != nil {
+		return nil, nil, err
+	}
+
+	sans, err := x509util.ParseSubjectAlternativeNames(ekCert)
+	if err != nil {
+		return nil, nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "failed parsing EK certificate Subject Alternative Names")
+	}
+	if len(sans.PermanentIdentifiers) == 0 {
+		return ekCert, []string{ekIssuerSerial(ekCert)}, nil
+	}
+	permanentIdentifiers := make([]string, len(sans.PermanentIdentifiers))
+	for i, pi := range sans.PermanentIdentifiers {
+		permanentIdentifiers[i] = pi.Identifier
+	}
+	return ekCert, permanentIdentifiers, nil
+}
+
+// verifyTPMCredentialActivation verifies that the AK is bound to the EK with
+// a credential activation. It creates the credential if the attestation
+// statement does not include its secret.
+func verifyTPMCredentialActivation(ch *Challenge, att *attestationObject, akCert *x509.Certificate, ekCert *x509.Certificate) error {
+	akPub, ok := att.AttStatement["akPub"].([]byte)
+	if !ok || len(akPub) == 0 {
+		return NewDetailedError(ErrorBadAttestationStatementType, "akPub not present")
+	}
+	pub, err := tpm2.DecodePublic(akPub)
+	if err != nil {
+		return WrapDetailedError(ErrorBadAttestationStatementType, err, "akPub is malformed")
+	}
+	key, err := pub.Key()
+	if err != nil {
+		return WrapDetailedError(ErrorBadAttestationStatementType, err, "akPub is malformed")
+	}
+	if k, ok := key.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(akCert.PublicKey) {
+		return NewDetailedError(ErrorBadAttestationStatementType, "akPub does not match the AK certificate")
+	}
+
+	secret, ok := att.AttStatement["credentialSecret"].([]byte)
+	if !ok {
+		name, err := pub.Name()
+		if err != nil {
+			return WrapDetailedError(ErrorBadAttestationStatementType, err, "akPub is malformed")
+		}
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return WrapErrorISE(err, "error generating credential secret")
+		}
+		blob, encryptedSecret, err := credactivation.Generate(name.Digest, ekCert.PublicKey, 16, secret)
+		if err != nil {
+			return WrapDetailedError(ErrorBadAttestationStatementType, err, "error creating credential for the EK")
+		}
+		sum := sha256.Sum256(secret)
+		ch.Credential = &TPMCredential{
+			CredentialBlob:  blob,
+			EncryptedSecret: encryptedSecret,
+		}
+		ch.CredentialDigest = sum[:]
+		return errTPMCredentialActivationRequired
+	}
+
+	sum := sha256.Sum256(secret)
+	if len(ch.CredentialDigest) == 0 || subtle.ConstantTimeCompare(sum[:], ch.CredentialDigest) != 1 {
+		return NewDetailedError(ErrorBadAttestationStatementType, "AK is not bound to the EK: credential activation failed")
+	}
+	return nil
+}
+
+// ekIssuerSerial returns the identifier of a device with an EK certificate
+// without permanent identifiers. Serial numbers are only unique per issuer,
+// so the identifier is the hex-encoded SHA-256 of the DER-encoded issuer of
+// the certificate and its decimal serial number, separated by a colon.
+func ekIssuerSerial(ekCert *x509.Certificate) string {
+	sum := sha256.Sum256(ekCert.RawIssuer)
+	return hex.EncodeToString(sum[:]) + ":" + ekCert.SerialNumber.String()
+}
+
 var (
 	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
 	oidTCGKpAIKCertificate       = asn1.ObjectIdentifier{2, 23, 133, 8, 3}
@@ -834,7 +1278,7 @@ type appleAttestationData struct {
 	Fingerprint  string
 }
 
-func doAppleAttestationFormat(_ context.Context, prov Provisioner, _ *Challenge, att *attestationObject) (*appleAttestationData, error) {
+func doAppleAttestationFormat(ctx context.Context, prov Provisioner, _ *Challenge, att *attestationObject) (*appleAttestationData, error) {
 	// Use configured or default attestation roots if none is configured.
 	roots, ok := prov.GetAttestationRoots()
 	if !ok {
@@ -876,14 +1320,18 @@ func doAppleAttestationFormat(_ context.Context, prov Provisioner, _ *Challenge,
 		intermediates.AddCert(cert)
 	}
 
-	if _, err := leaf.Verify(x509.VerifyOptions{
+	chains, err := leaf.Verify(x509.VerifyOptions{
 		Intermediates: intermediates,
 		Roots:         roots,
 		CurrentTime:   time.Now().Truncate(time.Second),
 		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
-	}); err != nil {
+	})
+	if err != nil {
 		return nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "x5c is not valid")
 	}
+	if err := checkAttestationRevocation(ctx, prov, "apple", chains); err != nil {
+		return nil, err
+	}
 
 	data := &appleAttestationData{
 		Certificate: leaf,
@@ -939,7 +1387,7 @@ type stepAttestationData struct {
 	Fingerprint  string
 }
 
-func doStepAttestationFormat(_ context.Context, prov Provisioner, ch *Challenge, jwk *jose.JSONWebKey, att *attestationObject) (*stepAttestationData, error) {
+func doStepAttestationFormat(ctx context.Context, prov Provisioner, ch *Challenge, jwk *jose.JSONWebKey, att *attestationObject) (*stepAttestationData, error) {
 	// Use configured or default attestation roots if none is configured.
 	roots, ok := prov.GetAttestationRoots()
 	if !ok {
@@ -979,14 +1427,18 @@ func doStepAttestationFormat(_ context.Context, prov Provisioner, ch *Challenge,
 		}
 		intermediates.AddCert(cert)
 	}
-	if _, err := leaf.Verify(x509.VerifyOptions{
+	chains, err := leaf.Verify(x509.VerifyOptions{
 		Intermediates: intermediates,
 		Roots:         roots,
 		CurrentTime:   time.Now().Truncate(time.Second),
 		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
-	}); err != nil {
+	})
+	if err != nil {
 		return nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "x5c is not valid")
 	}
+	if err := checkAttestationRevocation(ctx, prov, "step", chains); err != nil {
+		return nil, err
+	}
 
 	// Verify proof of possession of private key validating the key
 	// authorization. Per recommendation at
@@ -1051,6 +1503,192 @@ func doStepAttestationFormat(_ context.Context, prov Provisioner, ch *Challenge,
 	return data, nil
 }
 
+// Android key attestation extension, see
+// https://source.android.com/docs/security/features/keystore/attestation
+var oidAndroidKeyAttestation = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 1, 17}
+
+// Tags of the fields in the AuthorizationList of an Android key attestation
+// used by the android-key format.
+const (
+	androidTagRootOfTrust             = 704
+	androidTagAttestationIDSerial     = 713
+	androidTagAttestationIDImei       = 714
+	androidTagAttestationIDMeid       = 715
+	androidTagAttestationIDSecondImei = 723
+)
+
+const (
+	// androidSecurityLevelSoftware is the security level of keys that are not
+	// backed by a TEE or a StrongBox.
+	androidSecurityLevelSoftware = 0
+	// androidVerifiedBootStateVerified is the verified boot state of devices
+	// running an operating system signed by the device manufacturer.
+	androidVerifiedBootStateVerified = 0
+)
+
+type androidKeyDescription struct {
+	AttestationVersion       int
+	AttestationSecurityLevel asn1.Enumerated
+	KeyMintVersion           int
+	KeyMintSecurityLevel     asn1.Enumerated
+	AttestationChallenge     []byte
+	UniqueID                 []byte
+	SoftwareEnforced         asn1.RawValue
+	HardwareEnforced         asn1.RawValue
+}
+
+type androidRootOfTrust struct {
+	VerifiedBootKey   []byte
+	DeviceLocked      bool
+	VerifiedBootState asn1.Enumerated
+	VerifiedBootHash  []byte `asn1:"optional"`
+}
+
+type androidAttestationData struct {
+	Certificate          *x509.Certificate
+	Fingerprint          string
+	Challenge            []byte
+	SecurityLevel        int
+	DeviceLocked         bool
+	VerifiedBootState    int
+	SerialNumber         string
+	PermanentIdentifiers []string
+}
+
+func doAndroidKeyAttestationFormat(ctx context.Context, prov Provisioner, _ *Challenge, att *attestationObject) (*androidAttestationData, error) {
+	// The Google hardware attestation roots are not bundled, the provisioner
+	// must be configured with them. The generic attestation roots are only
+	// used if the android-key roots are not configured.
+	roots, ok := prov.GetAndroidKeyAttestationRoots()
+	if !ok {
+		if roots, ok = prov.GetAttestationRoots(); !ok {
+			return nil, NewErrorISE("android-key attestation format requires androidKeyAttestationRoots")
+		}
+	}
+
+	x5c, ok := att.AttStatement["x5c"].([]interface{})
+	if !ok {
+		return nil, NewDetailedError(ErrorBadAttestationStatementType, "x5c not present")
+	}
+	if len(x5c) == 0 {
+		return nil, NewDetailedError(ErrorBadAttestationStatementType, "x5c is empty")
+	}
+
+	der, ok := x5c[0].([]byte)
+	if !ok {
+		return nil, NewDetailedError(ErrorBadAttestationStatementType, "x5c is malformed")
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "x5c is malformed")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, v := range x5c[1:] {
+		der, ok = v.([]byte)
+		if !ok {
+			return nil, NewDetailedError(ErrorBadAttestationStatementType, "x5c is malformed")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "x5c is malformed")
+		}
+		intermediates.AddCert(cert)
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Intermediates: intermediates,
+		Roots:         roots,
+		CurrentTime:   time.Now().Truncate(time.Second),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "x5c is not valid")
+	}
+	if err := checkAttestationRevocation(ctx, prov, "android-key", chains); err != nil {
+		return nil, err
+	}
+
+	var desc *androidKeyDescription
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(oidAndroidKeyAttestation) {
+			continue
+		}
+		desc = new(androidKeyDescription)
+		if _, err := asn1.Unmarshal(ext.Value, desc); err != nil {
+			return nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "error parsing android key attestation")
+		}
+		break
+	}
+	if desc == nil {
+		return nil, NewDetailedError(ErrorBadAttestationStatementType, "android key attestation not present")
+	}
+
+	data := &androidAttestationData{
+		Certificate:   leaf,
+		Challenge:     desc.AttestationChallenge,
+		SecurityLevel: int(desc.AttestationSecurityLevel),
+	}
+	if data.Fingerprint, err = keyutil.Fingerprint(leaf.PublicKey); err != nil {
+		return nil, WrapErrorISE(err, "error calculating key fingerprint")
+	}
+
+	// Only the properties enforced by the hardware can be trusted.
+	if data.SecurityLevel == androidSecurityLevelSoftware {
+		return nil, NewDetailedError(ErrorBadAttestationStatementType, "android key attestation is not hardware backed")
+	}
+	if err := parseAndroidAuthorizationList(desc.HardwareEnforced.Bytes, data); err != nil {
+		return nil, WrapDetailedError(ErrorBadAttestationStatementType, err, "error parsing android key attestation")
+	}
+	if data.VerifiedBootState != androidVerifiedBootStateVerified {
+		return nil, NewDetailedError(ErrorBadAttestationStatementType, "android verified boot state is not verified")
+	}
+
+	return data, nil
+}
+
+// parseAndroidAuthorizationList parses the root of trust and the device
+// identifiers from the content of an AuthorizationList.
+func parseAndroidAuthorizationList(b []byte, data *androidAttestationData) error {
+	var hasRootOfTrust bool
+	for len(b) > 0 {
+		var (
+			field asn1.RawValue
+			err   error
+		)
+		if b, err = asn1.Unmarshal(b, &field); err != nil {
+			return err
+		}
+		if field.Class != asn1.ClassContextSpecific {
+			continue
+		}
+		switch field.Tag {
+		case androidTagRootOfTrust:
+			var rot androidRootOfTrust
+			if _, err := asn1.Unmarshal(field.Bytes, &rot); err != nil {
+				return err
+			}
+			data.DeviceLocked = rot.DeviceLocked
+			data.VerifiedBootState = int(rot.VerifiedBootState)
+			hasRootOfTrust = true
+		case androidTagAttestationIDSerial, androidTagAttestationIDImei,
+			androidTagAttestationIDMeid, androidTagAttestationIDSecondImei:
+			var id []byte
+			if _, err := asn1.Unmarshal(field.Bytes, &id); err != nil {
+				return err
+			}
+			if field.Tag == androidTagAttestationIDSerial {
+				data.SerialNumber = string(id)
+			}
+			data.PermanentIdentifiers = append(data.PermanentIdentifiers, string(id))
+		}
+	}
+	if !hasRootOfTrust {
+		return errors.New("root of trust not present")
+	}
+	return nil
+}
+
 // serverName determines the SNI HostName to set based on an acme.Challenge
 // for TLS-ALPN-01 challenges RFC8738 states that, if HostName is an IP, it
 // should be the ARPA address https://datatracker.ietf.org/doc/html/rfc8738#section-6.
@@ -1132,3 +1770,43 @@ func storeError(ctx context.Context, db DB, ch *Challenge, markInvalid bool, err
 	}
 	return nil
 }
+
+// validationOutcome returns the outcome of a validation of the challenge used
+// in the metrics: valid, invalid, retry if the validation failed but can be
+// retried, pending if it was not completed, or error.
+func validationOutcome(ch *Challenge, prevErr *Error, err error) string {
+	switch {
+	case err != nil:
+		return "error"
+	case ch.Status == StatusValid:
+		return "valid"
+	case ch.Status == StatusInvalid:
+		return "invalid"
+	case ch.Error != nil && ch.Error != prevErr:
+		return "retry"
+	default:
+		return "pending"
+	}
+}
+
+// auditChallenge writes the transition of the challenge from the given status
+// to its current one in the audit log.
+func auditChallenge(ctx context.Context, ch *Challenge, from Status) error {
+	ev := &audit.Event{
+		Type: audit.ACMEChallenge,
+		Details: map[string]string{
+			"accountID":       ch.AccountID,
+			"authorizationID": ch.AuthorizationID,
+			"challengeID":     ch.ID,
+			"challengeType":   string(ch.Type),
+			"identifier":      ch.Value,
+			"previousStatus":  string(from),
+			"status":          string(ch.Status),
+		},
+	}
+	if p, ok := ProvisionerFromContext(ctx); ok {
+		ev.Provisioner = p.GetName()
+		ev.ProvisionerType = provisioner.TypeACME.String()
+	}
+	return audit.FromContext(ctx).Log(ev)
+}
@@ -24,6 +24,8 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -31,8 +33,12 @@ import (
 	"time"
 
 	"github.com/fxamacker/cbor/v2"
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/mdm"
+	"github.com/smallstep/certificates/webhook"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.step.sm/crypto/jose"
@@ -196,6 +202,67 @@ func mustAttestYubikey(t *testing.T, _, keyAuthorization string, serial int) ([]
 	return payload, leaf, ca.Root
 }
 
+func Test_auditChallenge(t *testing.T) {
+	ch := &Challenge{
+		ID:              "chID",
+		AccountID:       "accID",
+		AuthorizationID: "azID",
+		Value:           "example.com",
+		Type:            "http-01",
+		Status:          StatusValid,
+	}
+
+	// Without an audit logger nothing is written.
+	require.NoError(t, auditChallenge(context.Background(), ch, StatusPending))
+
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := audit.NewFileSink(filename)
+	require.NoError(t, err)
+	l := audit.New(nil, sink)
+	ctx := audit.NewContext(context.Background(), l)
+	ctx = NewProvisionerContext(ctx, mustNonAttestationProvisioner(t))
+	require.NoError(t, auditChallenge(ctx, ch, StatusPending))
+	require.NoError(t, l.Close())
+
+	b, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	var ev audit.Event
+	require.NoError(t, json.Unmarshal(b, &ev))
+	assert.Equal(t, audit.ACMEChallenge, ev.Type)
+	assert.Equal(t, "ACME", ev.ProvisionerType)
+	assert.NotEmpty(t, ev.Provisioner)
+	assert.Equal(t, map[string]string{
+		"accountID":       "accID",
+		"authorizationID": "azID",
+		"challengeID":     "chID",
+		"challengeType":   "http-01",
+		"identifier":      "example.com",
+		"previousStatus":  "pending",
+		"status":          "valid",
+	}, ev.Details)
+}
+
+func Test_validationOutcome(t *testing.T) {
+	prevErr := NewError(ErrorConnectionType, "force")
+	tests := []struct {
+		name string
+		ch   *Challenge
+		err  error
+		want string
+	}{
+		{"error", &Challenge{Status: StatusPending}, errors.New("force"), "error"},
+		{"valid", &Challenge{Status: StatusValid}, nil, "valid"},
+		{"invalid", &Challenge{Status: StatusInvalid, Error: prevErr}, nil, "invalid"},
+		{"retry", &Challenge{Status: StatusProcessing, Error: NewError(ErrorConnectionType, "new")}, nil, "retry"},
+		{"pending", &Challenge{Status: StatusPending, Error: prevErr}, nil, "pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validationOutcome(tt.ch, prevErr, tt.err))
+		})
+	}
+}
+
 func Test_storeError(t *testing.T) {
 	type test struct {
 		ch          *Challenge
@@ -1210,8 +1277,7 @@ func TestHTTP01Validate(t *testing.T) {
 						assert.Equal(t, StatusValid, updch.Status)
 						assert.Nil(t, updch.Error)
 
-						va, err := time.Parse(time.RFC3339, updch.ValidatedAt)
-						require.NoError(t, err)
+						va := updch.ValidatedAt
 						now := clock.Now()
 						assert.True(t, va.Add(-time.Minute).Before(now))
 						assert.True(t, va.Add(time.Minute).After(now))
@@ -1253,8 +1319,7 @@ func TestHTTP01Validate(t *testing.T) {
 						assert.Equal(t, StatusValid, updch.Status)
 						assert.Nil(t, updch.Error)
 
-						va, err := time.Parse(time.RFC3339, updch.ValidatedAt)
-						require.NoError(t, err)
+						va := updch.ValidatedAt
 						now := clock.Now()
 						assert.True(t, va.Add(-time.Minute).Before(now))
 						assert.True(t, va.Add(time.Minute).After(now))
@@ -1508,8 +1573,7 @@ func TestDNS01Validate(t *testing.T) {
 						assert.Equal(t, StatusValid, updch.Status)
 						assert.Nil(t, updch.Error)
 
-						va, err := time.Parse(time.RFC3339, updch.ValidatedAt)
-						require.NoError(t, err)
+						va := updch.ValidatedAt
 						now := clock.Now()
 						assert.True(t, va.Add(-time.Minute).Before(now))
 						assert.True(t, va.Add(time.Minute).After(now))
@@ -1552,8 +1616,7 @@ func TestDNS01Validate(t *testing.T) {
 						assert.Equal(t, StatusValid, updch.Status)
 						assert.Nil(t, updch.Error)
 
-						va, err := time.Parse(time.RFC3339, updch.ValidatedAt)
-						require.NoError(t, err)
+						va := updch.ValidatedAt
 						now := clock.Now()
 						assert.True(t, va.Add(-time.Minute).Before(now))
 						assert.True(t, va.Add(time.Minute).After(now))
@@ -4301,3 +4364,533 @@ func createSubjectAltNameExtension(dnsNames, emailAddresses x509util.MultiString
 		Value:    rawBytes,
 	}, nil
 }
+
+func TestChallenge_JSON(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	validatedAt := time.Date(2023, 10, 1, 14, 30, 0, 0, loc)
+
+	t.Run("validated", func(t *testing.T) {
+		ch := &Challenge{
+			ID:          "chID",
+			Type:        HTTP01,
+			Status:      StatusValid,
+			Token:       "token",
+			ValidatedAt: validatedAt,
+			URL:         "https://ca.example.com/acme/challenge/chID",
+		}
+		b, err := json.Marshal(ch)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"type":"http-01","status":"valid","token":"token","validated":"2023-10-01T12:30:00Z","url":"https://ca.example.com/acme/challenge/chID"}`, string(b))
+
+		got := new(Challenge)
+		require.NoError(t, json.Unmarshal(b, got))
+		assert.Equal(t, time.UTC, got.ValidatedAt.Location())
+		assert.True(t, validatedAt.Equal(got.ValidatedAt))
+		assert.Equal(t, ch.Type, got.Type)
+		assert.Equal(t, ch.Status, got.Status)
+		assert.Equal(t, ch.Token, got.Token)
+		assert.Equal(t, ch.URL, got.URL)
+	})
+
+	t.Run("not validated", func(t *testing.T) {
+		b, err := json.Marshal(Challenge{Type: DNS01, Status: StatusPending, Token: "token"})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"type":"dns-01","status":"pending","token":"token","url":""}`, string(b))
+
+		got := new(Challenge)
+		require.NoError(t, json.Unmarshal(b, got))
+		assert.True(t, got.ValidatedAt.IsZero())
+	})
+
+	t.Run("processing", func(t *testing.T) {
+		b, err := json.Marshal(Challenge{Type: DNS01, Status: StatusProcessing, Token: "token", RetryAfter: validatedAt})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"type":"dns-01","status":"processing","token":"token","url":"","retryAfter":"2023-10-01T12:30:00Z"}`, string(b))
+
+		got := new(Challenge)
+		require.NoError(t, json.Unmarshal(b, got))
+		assert.True(t, validatedAt.Equal(got.RetryAfter))
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		err := json.Unmarshal([]byte(`{"validated":"foobar"}`), new(Challenge))
+		assert.Error(t, err)
+		err = json.Unmarshal([]byte(`{"retryAfter":"foobar"}`), new(Challenge))
+		assert.Error(t, err)
+	})
+}
+
+type mockDeviceInventory func(ctx context.Context, serialNumber, udid string) (*mdm.Device, error)
+
+func (m mockDeviceInventory) Lookup(ctx context.Context, serialNumber, udid string) (*mdm.Device, error) {
+	return m(ctx, serialNumber, udid)
+}
+
+func Test_validateDeviceInventory(t *testing.T) {
+	lookup := func(d *mdm.Device, err error) mdm.Provider {
+		return mockDeviceInventory(func(ctx context.Context, serialNumber, udid string) (*mdm.Device, error) {
+			assert.Equal(t, "SERIAL", serialNumber)
+			assert.Equal(t, "UDID", udid)
+			return d, err
+		})
+	}
+	tests := []struct {
+		name      string
+		inventory mdm.Provider
+		wantErr   error
+	}{
+		{"ok", lookup(&mdm.Device{Managed: true, Compliant: true}, nil), nil},
+		{"fail not enrolled", lookup(nil, mdm.ErrDeviceNotFound), NewDetailedError(ErrorRejectedIdentifierType, `device "SERIAL" is not enrolled`)},
+		{"fail not managed", lookup(&mdm.Device{Compliant: true}, nil), NewDetailedError(ErrorRejectedIdentifierType, `device "SERIAL" is not managed`)},
+		{"fail not compliant", lookup(&mdm.Device{Managed: true}, nil), NewDetailedError(ErrorRejectedIdentifierType, `device "SERIAL" is not compliant`)},
+		{"fail lookup", lookup(nil, errors.New("force")), errors.New("force")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDeviceInventory(context.Background(), tt.inventory, "SERIAL", "UDID")
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr.Error())
+			var ae *Error
+			assert.Equal(t, errors.As(tt.wantErr, &ae), errors.As(err, &ae))
+		})
+	}
+}
+
+type androidAttestOptions struct {
+	securityLevel     int
+	verifiedBootState int
+	serialNumber      string
+	imei              string
+	noRootOfTrust     bool
+}
+
+func mustAndroidKeyDescription(t *testing.T, challenge []byte, opts androidAttestOptions) []byte {
+	t.Helper()
+
+	field := func(tag int, v interface{}) []byte {
+		b, err := asn1.Marshal(v)
+		require.NoError(t, err)
+		b, err = asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: b})
+		require.NoError(t, err)
+		return b
+	}
+
+	var hardwareEnforced []byte
+	if !opts.noRootOfTrust {
+		hardwareEnforced = append(hardwareEnforced, field(androidTagRootOfTrust, androidRootOfTrust{
+			VerifiedBootKey:   []byte("boot-key"),
+			DeviceLocked:      true,
+			VerifiedBootState: asn1.Enumerated(opts.verifiedBootState),
+			VerifiedBootHash:  []byte("boot-hash"),
+		})...)
+	}
+	if opts.serialNumber != "" {
+		hardwareEnforced = append(hardwareEnforced, field(androidTagAttestationIDSerial, []byte(opts.serialNumber))...)
+	}
+	if opts.imei != "" {
+		hardwareEnforced = append(hardwareEnforced, field(androidTagAttestationIDImei, []byte(opts.imei))...)
+	}
+
+	b, err := asn1.Marshal(androidKeyDescription{
+		AttestationVersion:       200,
+		AttestationSecurityLevel: asn1.Enumerated(opts.securityLevel),
+		KeyMintVersion:           200,
+		KeyMintSecurityLevel:     asn1.Enumerated(opts.securityLevel),
+		AttestationChallenge:     challenge,
+		UniqueID:                 []byte{},
+		SoftwareEnforced:         asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: []byte{}},
+		HardwareEnforced:         asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: hardwareEnforced},
+	})
+	require.NoError(t, err)
+	return b
+}
+
+func mustAndroidKeyProvisioner(t *testing.T, roots []byte) Provisioner {
+	t.Helper()
+
+	prov := &provisioner.ACME{
+		Type:                       "ACME",
+		Name:                       "acme",
+		Challenges:                 []provisioner.ACMEChallenge{provisioner.DEVICE_ATTEST_01},
+		AttestationFormats:         []provisioner.ACMEAttestationFormat{provisioner.ANDROID_KEY},
+		AndroidKeyAttestationRoots: roots,
+	}
+	require.NoError(t, prov.Init(provisioner.Config{
+		Claims: config.GlobalProvisionerClaims,
+	}))
+	return prov
+}
+
+func Test_doAndroidKeyAttestationFormat(t *testing.T) {
+	ctx := context.Background()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	caRoot := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	fingerprint, err := keyutil.Fingerprint(signer.Public())
+	require.NoError(t, err)
+
+	mustLeaf := func(t *testing.T, desc []byte) *x509.Certificate {
+		t.Helper()
+		tmpl := &x509.Certificate{
+			Subject:   pkix.Name{CommonName: "Android Keystore Key"},
+			PublicKey: signer.Public(),
+		}
+		if desc != nil {
+			tmpl.ExtraExtensions = []pkix.Extension{{Id: oidAndroidKeyAttestation, Value: desc}}
+		}
+		leaf, err := ca.Sign(tmpl)
+		require.NoError(t, err)
+		return leaf
+	}
+	attestation := func(leaf *x509.Certificate) *attestationObject {
+		return &attestationObject{
+			Format: "android-key",
+			AttStatement: map[string]interface{}{
+				"x5c": []interface{}{leaf.Raw, ca.Intermediate.Raw},
+			},
+		}
+	}
+
+	leaf := mustLeaf(t, mustAndroidKeyDescription(t, []byte("challenge"), androidAttestOptions{
+		securityLevel: 1, serialNumber: "serial-number", imei: "490154203237518",
+	}))
+	softwareLeaf := mustLeaf(t, mustAndroidKeyDescription(t, []byte("challenge"), androidAttestOptions{
+		securityLevel: 0, serialNumber: "serial-number",
+	}))
+	unverifiedLeaf := mustLeaf(t, mustAndroidKeyDescription(t, []byte("challenge"), androidAttestOptions{
+		securityLevel: 2, verifiedBootState: 2, serialNumber: "serial-number",
+	}))
+	noRootOfTrustLeaf := mustLeaf(t, mustAndroidKeyDescription(t, []byte("challenge"), androidAttestOptions{
+		securityLevel: 1, noRootOfTrust: true,
+	}))
+
+	tests := []struct {
+		name    string
+		prov    Provisioner
+		att     *attestationObject
+		want    *androidAttestationData
+		wantErr bool
+	}{
+		{"ok", mustAndroidKeyProvisioner(t, caRoot), attestation(leaf), &androidAttestationData{
+			Certificate:          leaf,
+			Fingerprint:          fingerprint,
+			Challenge:            []byte("challenge"),
+			SecurityLevel:        1,
+			DeviceLocked:         true,
+			VerifiedBootState:    0,
+			SerialNumber:         "serial-number",
+			PermanentIdentifiers: []string{"serial-number", "490154203237518"},
+		}, false},
+		{"ok attestationRoots", &MockProvisioner{
+			MgetAttestationRoots: func() (*x509.CertPool, bool) {
+				pool := x509.NewCertPool()
+				pool.AddCert(ca.Root)
+				return pool, true
+			},
+		}, attestation(leaf), &androidAttestationData{
+			Certificate:          leaf,
+			Fingerprint:          fingerprint,
+			Challenge:            []byte("challenge"),
+			SecurityLevel:        1,
+			DeviceLocked:         true,
+			VerifiedBootState:    0,
+			SerialNumber:         "serial-number",
+			PermanentIdentifiers: []string{"serial-number", "490154203237518"},
+		}, false},
+		{"fail no roots", mustAttestationProvisioner(t, nil), attestation(leaf), nil, true},
+		{"fail missing x5c", mustAndroidKeyProvisioner(t, caRoot), &attestationObject{
+			Format:       "android-key",
+			AttStatement: map[string]interface{}{"foo": "bar"},
+		}, nil, true},
+		{"fail verify", mustAndroidKeyProvisioner(t, caRoot), &attestationObject{
+			Format:       "android-key",
+			AttStatement: map[string]interface{}{"x5c": []interface{}{leaf.Raw}},
+		}, nil, true},
+		{"fail missing extension", mustAndroidKeyProvisioner(t, caRoot), attestation(mustLeaf(t, nil)), nil, true},
+		{"fail malformed extension", mustAndroidKeyProvisioner(t, caRoot), attestation(mustLeaf(t, []byte{0x30, 0x01})), nil, true},
+		{"fail software", mustAndroidKeyProvisioner(t, caRoot), attestation(softwareLeaf), nil, true},
+		{"fail unverified boot", mustAndroidKeyProvisioner(t, caRoot), attestation(unverifiedLeaf), nil, true},
+		{"fail no root of trust", mustAndroidKeyProvisioner(t, caRoot), attestation(noRootOfTrustLeaf), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := doAndroidKeyAttestationFormat(ctx, tt.prov, &Challenge{}, tt.att)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_deviceAttest01Validate_androidKey(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	caRoot := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})
+	prov := mustAndroidKeyProvisioner(t, caRoot)
+
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	fingerprint, err := keyutil.Fingerprint(signer.Public())
+	require.NoError(t, err)
+
+	mustPayload := func(t *testing.T, token string) []byte {
+		t.Helper()
+		sum := sha256.Sum256([]byte(token))
+		leaf, err := ca.Sign(&x509.Certificate{
+			Subject:   pkix.Name{CommonName: "Android Keystore Key"},
+			PublicKey: signer.Public(),
+			ExtraExtensions: []pkix.Extension{
+				{Id: oidAndroidKeyAttestation, Value: mustAndroidKeyDescription(t, sum[:], androidAttestOptions{
+					securityLevel: 1, serialNumber: "serial-number",
+				})},
+			},
+		})
+		require.NoError(t, err)
+		attObj, err := cbor.Marshal(struct {
+			Format       string                 `json:"fmt"`
+			AttStatement map[string]interface{} `json:"attStmt,omitempty"`
+		}{
+			Format: "android-key",
+			AttStatement: map[string]interface{}{
+				"x5c": []interface{}{leaf.Raw, ca.Intermediate.Raw},
+			},
+		})
+		require.NoError(t, err)
+		payload, err := json.Marshal(struct {
+			AttObj string `json:"attObj"`
+		}{
+			AttObj: base64.RawURLEncoding.EncodeToString(attObj),
+		})
+		require.NoError(t, err)
+		return payload
+	}
+
+	allow := func(ctx context.Context, data *webhook.DeviceAttestationData) error {
+		assert.Equal(t, &webhook.DeviceAttestationData{
+			Format:               "android-key",
+			Identifier:           "serial-number",
+			PermanentIdentifiers: []string{"serial-number"},
+			SerialNumber:         "serial-number",
+			Fingerprint:          fingerprint,
+			Certificate:          data.Certificate,
+		}, data)
+		return nil
+	}
+	deny := func(ctx context.Context, data *webhook.DeviceAttestationData) error {
+		return provisioner.ErrWebhookDenied
+	}
+
+	tests := []struct {
+		name        string
+		payload     []byte
+		value       string
+		authorize   func(ctx context.Context, data *webhook.DeviceAttestationData) error
+		wantStatus  Status
+		wantDetail  string
+		fingerprint string
+	}{
+		{"ok", mustPayload(t, "token"), "serial-number", allow, StatusValid, "", fingerprint},
+		{"fail token", mustPayload(t, "other-token"), "serial-number", allow, StatusInvalid, "challenge token does not match", ""},
+		{"fail identifier", mustPayload(t, "token"), "other-serial", allow, StatusInvalid, "permanent identifier does not match", ""},
+		{"fail webhook", mustPayload(t, "token"), "serial-number", deny, StatusInvalid, "device \"serial-number\" is not allowed", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewProvisionerContext(context.Background(), &deviceAttestationProvisioner{
+				Provisioner: prov,
+				authorize:   tt.authorize,
+			})
+			var gotFingerprint string
+			db := &MockDB{
+				MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+					return &Authorization{ID: id}, nil
+				},
+				MockUpdateAuthorization: func(ctx context.Context, az *Authorization) error {
+					gotFingerprint = az.Fingerprint
+					return nil
+				},
+				MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+					return nil
+				},
+			}
+			ch := &Challenge{
+				ID:              "chID",
+				AuthorizationID: "azID",
+				Token:           "token",
+				Type:            DEVICEATTEST01,
+				Status:          StatusPending,
+				Value:           tt.value,
+			}
+			require.NoError(t, deviceAttest01Validate(ctx, ch, db, nil, tt.payload))
+			assert.Equal(t, tt.wantStatus, ch.Status)
+			assert.Equal(t, tt.fingerprint, gotFingerprint)
+			if tt.wantDetail != "" && assert.NotNil(t, ch.Error) {
+				assert.Contains(t, ch.Error.Detail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+type deviceAttestationProvisioner struct {
+	Provisioner
+	authorize func(ctx context.Context, data *webhook.DeviceAttestationData) error
+}
+
+func (p *deviceAttestationProvisioner) AuthorizeDeviceAttestation(ctx context.Context, data *webhook.DeviceAttestationData) error {
+	return p.authorize(ctx, data)
+}
+
+func Test_verifyTPMEndorsementKey(t *testing.T) {
+	eca, err := minica.New(minica.WithName("TPM Manufacturer"))
+	require.NoError(t, err)
+	aca, err := minica.New(minica.WithName("Attestation CA"))
+	require.NoError(t, err)
+	otherCA, err := minica.New(minica.WithName("Other Manufacturer"))
+	require.NoError(t, err)
+
+	mustEKCert := func(t *testing.T, ca *minica.CA, permanentIdentifier string) *x509.Certificate {
+		t.Helper()
+		signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1234),
+			PublicKey:    signer.Public(),
+		}
+		if permanentIdentifier != "" {
+			ext, err := createSubjectAltNameExtension(nil, nil, nil, nil, []x509util.SubjectAlternativeName{
+				{Type: x509util.PermanentIdentifierType, Value: permanentIdentifier},
+			}, true)
+			require.NoError(t, err)
+			ext.Set(template)
+		}
+		cert, err := ca.Sign(template)
+		require.NoError(t, err)
+		return cert
+	}
+	mustAK := func(t *testing.T) (*x509.Certificate, []byte) {
+		t.Helper()
+		signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+		require.NoError(t, err)
+		cert, err := aca.Sign(&x509.Certificate{
+			PublicKey: signer.Public(),
+		})
+		require.NoError(t, err)
+		key := signer.Public().(*ecdsa.PublicKey)
+		akPub, err := tpm2.Public{
+			Type:       tpm2.AlgECC,
+			NameAlg:    tpm2.AlgSHA256,
+			Attributes: tpm2.FlagSignerDefault,
+			ECCParameters: &tpm2.ECCParams{
+				Sign:    &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA256},
+				CurveID: tpm2.CurveNISTP256,
+				Point: tpm2.ECPoint{
+					XRaw: key.X.FillBytes(make([]byte, 32)),
+					YRaw: key.Y.FillBytes(make([]byte, 32)),
+				},
+			},
+		}.Encode()
+		require.NoError(t, err)
+		return cert, akPub
+	}
+	statement := func(akPub, secret []byte, certs ...*x509.Certificate) *attestationObject {
+		x5c := make([]interface{}, len(certs))
+		for i, c := range certs {
+			x5c[i] = c.Raw
+		}
+		att := &attestationObject{Format: "tpm", AttStatement: map[string]interface{}{"ekX5c": x5c}}
+		if akPub != nil {
+			att.AttStatement["akPub"] = akPub
+		}
+		if secret != nil {
+			att.AttStatement["credentialSecret"] = secret
+		}
+		return att
+	}
+
+	ekWithIdentifier := mustEKCert(t, eca, "device-1234")
+	ekWithSerial := mustEKCert(t, eca, "")
+	ekOther := mustEKCert(t, otherCA, "")
+	akCert, akPub := mustAK(t)
+	_, otherAKPub := mustAK(t)
+	secret := []byte("the-credential-secret")
+	digest := sha256.Sum256(secret)
+	roots := x509.NewCertPool()
+	roots.AddCert(eca.Root)
+	prov := &MockProvisioner{}
+
+	tests := []struct {
+		name    string
+		att     *attestationObject
+		digest  []byte
+		want    []string
+		wantErr string
+	}{
+		{"ok permanent identifier", statement(akPub, secret, ekWithIdentifier, eca.Intermediate), digest[:], []string{"device-1234"}, ""},
+		{"ok serial number", statement(akPub, secret, ekWithSerial, eca.Intermediate), digest[:], []string{ekIssuerSerial(ekWithSerial)}, ""},
+		{"fail not present", &attestationObject{AttStatement: map[string]interface{}{}}, digest[:], nil, "ekX5c not present"},
+		{"fail empty", statement(akPub, secret), digest[:], nil, "ekX5c is empty"},
+		{"fail malformed", &attestationObject{AttStatement: map[string]interface{}{"ekX5c": []interface{}{"foo"}}}, digest[:], nil, "ekX5c is malformed"},
+		{"fail untrusted", statement(akPub, secret, ekOther, otherCA.Intermediate), digest[:], nil, "ekX5c is not valid"},
+		{"fail akPub not present", statement(nil, secret, ekWithSerial, eca.Intermediate), digest[:], nil, "akPub not present"},
+		{"fail akPub malformed", statement([]byte("foo"), secret, ekWithSerial, eca.Intermediate), digest[:], nil, "akPub is malformed"},
+		{"fail akPub mismatch", statement(otherAKPub, secret, ekWithSerial, eca.Intermediate), digest[:], nil, "akPub does not match the AK certificate"},
+		{"fail wrong secret", statement(akPub, []byte("other-secret"), ekWithSerial, eca.Intermediate), digest[:], nil, "credential activation failed"},
+		{"fail no credential", statement(akPub, secret, ekWithSerial, eca.Intermediate), nil, nil, "credential activation failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := &Challenge{CredentialDigest: tt.digest}
+			ek, got, err := verifyTPMEndorsementKey(context.Background(), prov, ch, tt.att, akCert, roots)
+			if tt.wantErr != "" {
+				var acmeErr *Error
+				require.ErrorAs(t, err, &acmeErr)
+				assert.Equal(t, "urn:ietf:params:acme:error:badAttestationStatement", acmeErr.Type)
+				assert.Contains(t, acmeErr.Detail, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.att.AttStatement["ekX5c"].([]interface{})[0], ek.Raw)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// Without the secret, a new credential is created for the AK and the EK.
+	ch := &Challenge{CredentialDigest: digest[:]}
+	_, _, err = verifyTPMEndorsementKey(context.Background(), prov, ch, statement(akPub, nil, ekWithSerial, eca.Intermediate), akCert, roots)
+	require.ErrorIs(t, err, errTPMCredentialActivationRequired)
+	require.NotNil(t, ch.Credential)
+	assert.NotEmpty(t, ch.Credential.CredentialBlob)
+	assert.NotEmpty(t, ch.Credential.EncryptedSecret)
+	assert.Len(t, ch.CredentialDigest, sha256.Size)
+	assert.NotEqual(t, digest[:], ch.CredentialDigest)
+}
+
+func Test_ekIssuerSerial(t *testing.T) {
+	ca, err := minica.New(minica.WithName("TPM Manufacturer"))
+	require.NoError(t, err)
+	otherCA, err := minica.New(minica.WithName("Other Manufacturer"))
+	require.NoError(t, err)
+	mustCert := func(ca *minica.CA) *x509.Certificate {
+		signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+		require.NoError(t, err)
+		cert, err := ca.Sign(&x509.Certificate{SerialNumber: big.NewInt(1234), PublicKey: signer.Public()})
+		require.NoError(t, err)
+		return cert
+	}
+
+	cert := mustCert(ca)
+	sum := sha256.Sum256(cert.RawIssuer)
+	assert.Equal(t, hex.EncodeToString(sum[:])+":1234", ekIssuerSerial(cert))
+	// The same serial number from other issuer is a different device.
+	assert.NotEqual(t, ekIssuerSerial(cert), ekIssuerSerial(mustCert(otherCA)))
+}
@@ -1,11 +1,17 @@
 package acme
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
+	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
+
+	"golang.org/x/net/proxy"
 )
 
 // Client is the interface used to verify ACME challenges.
@@ -45,26 +51,119 @@ func MustClientFromContext(ctx context.Context) Client {
 }
 
 type client struct {
-	http   *http.Client
-	dialer *net.Dialer
+	http       *http.Client
+	dialer     *net.Dialer
+	resolver   *DNSResolver
+	proxy      *url.URL
+	socks      proxy.ContextDialer
+	sourceIPv4 net.IP
+	sourceIPv6 net.IP
+}
+
+// ClientOption is the type of options passed to NewClient.
+type ClientOption func(c *client)
+
+// WithDNSResolver sets the resolver used to look up the TXT records of the
+// dns-01 challenge. By default the system resolver is used.
+func WithDNSResolver(r *DNSResolver) ClientOption {
+	return func(c *client) {
+		c.resolver = r
+	}
+}
+
+// WithProxy sets the proxy used to connect to the targets of the http-01 and
+// tls-alpn-01 challenges. The proxy URL can use the http, https, socks5 or
+// socks5h schemes. HTTP proxies must support the CONNECT method to validate
+// the tls-alpn-01 challenge.
+func WithProxy(u *url.URL) ClientOption {
+	return func(c *client) {
+		c.proxy = u
+	}
+}
+
+// WithSourceAddress sets the local IP addresses used in the outgoing
+// connections, one per address family. Connections use the source address of
+// the family of the destination, and destinations of a family without a source
+// address are not dialed.
+func WithSourceAddress(ips ...net.IP) ClientOption {
+	return func(c *client) {
+		for _, ip := range ips {
+			if ip.To4() != nil {
+				c.sourceIPv4 = ip
+			} else {
+				c.sourceIPv6 = ip
+			}
+		}
+	}
+}
+
+// WithDialTimeout sets the maximum amount of time to establish a connection,
+// including the TLS handshake of the tls-alpn-01 challenge. It defaults to 30
+// seconds.
+func WithDialTimeout(d time.Duration) ClientOption {
+	return func(c *client) {
+		c.dialer.Timeout = d
+	}
+}
+
+// WithTimeout sets the maximum amount of time to get the response of the
+// http-01 challenge, including redirects. It defaults to 30 seconds.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *client) {
+		c.http.Timeout = d
+	}
+}
+
+// WithMaxRedirects sets the maximum number of redirects followed validating the
+// http-01 challenge. By default, the client stops after 10 redirects.
+func WithMaxRedirects(n int) ClientOption {
+	return func(c *client) {
+		c.http.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > n {
+				return fmt.Errorf("stopped after %d redirects", n)
+			}
+			return nil
+		}
+	}
 }
 
 // NewClient returns an implementation of Client for verifying ACME challenges.
-func NewClient() Client {
-	return &client{
+func NewClient(opts ...ClientOption) Client {
+	c := &client{
 		http: &http.Client{
 			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					//nolint:gosec // used on tls-alpn-01 challenge
-					InsecureSkipVerify: true, // lgtm[go/disabled-certificate-check]
-				},
-			},
 		},
 		dialer: &net.Dialer{
 			Timeout: 30 * time.Second,
 		},
 	}
+	for _, fn := range opts {
+		fn(c)
+	}
+
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			//nolint:gosec // used on tls-alpn-01 challenge
+			InsecureSkipVerify: true, // lgtm[go/disabled-certificate-check]
+		},
+		DialContext: c.DialContext,
+	}
+	if c.proxy != nil {
+		switch c.proxy.Scheme {
+		case "socks5", "socks5h":
+			// FromURL only fails with unknown schemes.
+			if d, err := proxy.FromURL(c.proxy, c); err == nil {
+				c.socks, _ = d.(proxy.ContextDialer)
+			}
+			if c.socks != nil {
+				tr.DialContext = c.socks.DialContext
+			}
+		default:
+			tr.Proxy = http.ProxyURL(c.proxy)
+		}
+	}
+	c.http.Transport = tr
+	return c
 }
 
 func (c *client) Get(url string) (*http.Response, error) {
@@ -72,9 +171,171 @@ func (c *client) Get(url string) (*http.Response, error) {
 }
 
 func (c *client) LookupTxt(name string) ([]string, error) {
+	if c.resolver != nil {
+		return c.resolver.LookupTXT(context.Background(), name)
+	}
 	return net.LookupTXT(name)
 }
 
+// LookupCAA returns the relevant CAA record set for the given domain name,
+// using the system name servers if no DNS resolver is configured.
+func (c *client) LookupCAA(name string) ([]CAARecord, error) {
+	r := c.resolver
+	if r == nil {
+		r = &DNSResolver{
+			timeout:    defaultDNSTimeout,
+			httpClient: &http.Client{},
+			nsPort:     "53",
+		}
+	}
+	return r.LookupCAA(context.Background(), name)
+}
+
+// Dial connects to the given address, see DialContext.
+func (c *client) Dial(network, addr string) (net.Conn, error) {
+	return c.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the given address using the configured dialer. If
+// the source addresses are configured, the connection is bound to the source
+// address of the family of the destination.
+func (c *client) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if c.sourceIPv4 == nil && c.sourceIPv6 == nil {
+		return c.dialer.DialContext(ctx, network, addr)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ipNetwork := "ip"
+	switch network {
+	case "tcp4":
+		ipNetwork = "ip4"
+	case "tcp6":
+		ipNetwork = "ip6"
+	}
+	resolver := c.dialer.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ips, err := resolver.LookupIP(ctx, ipNetwork, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		source := c.sourceIPv6
+		if ip.To4() != nil {
+			source = c.sourceIPv4
+		}
+		if source == nil {
+			continue
+		}
+		d := *c.dialer
+		d.LocalAddr = &net.TCPAddr{IP: source}
+		conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("dial %s %s: no source address for the addresses of %s", network, addr, host)
+	}
+	return nil, lastErr
+}
+
 func (c *client) TLSDial(network, addr string, config *tls.Config) (*tls.Conn, error) {
-	return tls.DialWithDialer(c.dialer, network, addr, config)
+	if c.proxy == nil && c.sourceIPv4 == nil && c.sourceIPv6 == nil {
+		return tls.DialWithDialer(c.dialer, network, addr, config)
+	}
+
+	ctx := context.Background()
+	if c.dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.dialer.Timeout)
+		defer cancel()
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch {
+	case c.socks != nil:
+		conn, err = c.socks.DialContext(ctx, network, addr)
+	case c.proxy != nil:
+		conn, err = c.dialTunnel(ctx, addr)
+	default:
+		conn, err = c.DialContext(ctx, network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// dialTunnel connects to the given address using the CONNECT method of the
+// HTTP proxy.
+func (c *client) dialTunnel(ctx context.Context, addr string) (net.Conn, error) {
+	port := c.proxy.Port()
+	if port == "" {
+		port = "80"
+		if c.proxy.Scheme == "https" {
+			port = "443"
+		}
+	}
+	conn, err := c.DialContext(ctx, "tcp", net.JoinHostPort(c.proxy.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	if c.proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName: c.proxy.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := c.proxy.User; u != nil {
+		password, _ := u.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s responded with %s", c.proxy.Host, resp.Status)
+	}
+	return conn, nil
 }
@@ -0,0 +1,134 @@
+package acme
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Get_proxy(t *testing.T) {
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		io.WriteString(w, "token")
+	}))
+	defer proxy.Close()
+
+	u, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	c := NewClient(WithProxy(u), WithSourceAddress(net.IPv4(127, 0, 0, 1)))
+	resp, err := c.Get("http://example.com/.well-known/acme-challenge/token")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "token", string(b))
+	assert.Equal(t, "http://example.com/.well-known/acme-challenge/token", requested)
+}
+
+func TestClient_Get_sourceAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		io.WriteString(w, host)
+	}))
+	defer srv.Close()
+
+	// The source address of the family of the destination is used.
+	c := NewClient(WithSourceAddress(net.IPv6loopback, net.IPv4(127, 0, 0, 1)))
+	resp, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", string(b))
+
+	// Destinations without a source address of their family are not dialed.
+	_, err = NewClient(WithSourceAddress(net.IPv6loopback)).Get(srv.URL)
+	assert.ErrorContains(t, err, "no source address")
+}
+
+func TestClient_Get_maxRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/token", http.StatusFound)
+			return
+		}
+		io.WriteString(w, "token")
+	}))
+	defer srv.Close()
+
+	resp, err := NewClient(WithMaxRedirects(1)).Get(srv.URL + "/redirect")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = NewClient(WithMaxRedirects(0)).Get(srv.URL + "/redirect")
+	assert.ErrorContains(t, err, "stopped after 0 redirects")
+}
+
+func TestClient_Get_timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(WithTimeout(10 * time.Millisecond)).Get(srv.URL)
+	assert.ErrorContains(t, err, "Client.Timeout exceeded")
+}
+
+func TestClient_TLSDial_proxy(t *testing.T) {
+	target := httptest.NewTLSServer(http.NotFoundHandler())
+	defer target.Close()
+
+	var connected string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || r.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		connected = r.Host
+		conn, err := net.Dial("tcp", target.Listener.Addr().String())
+		if !assert.NoError(t, err) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer conn.Close()
+		clientConn, brw, err := w.(http.Hijacker).Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer clientConn.Close()
+		io.WriteString(clientConn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(conn, brw)
+		io.Copy(clientConn, conn)
+	}))
+	defer proxy.Close()
+
+	config := &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true, //nolint:gosec // test server
+	}
+
+	u, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+	u.User = url.UserPassword("user", "pass")
+	c := NewClient(WithProxy(u), WithDialTimeout(5*time.Second))
+	conn, err := c.TLSDial("tcp", "example.com:443", config)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "example.com:443", connected)
+	assert.True(t, conn.ConnectionState().HandshakeComplete)
+
+	u.User = nil
+	c = NewClient(WithProxy(u))
+	_, err = c.TLSDial("tcp", "example.com:443", config)
+	assert.ErrorContains(t, err, "responded with 403 Forbidden")
+}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/mdm"
+	"github.com/smallstep/certificates/webhook"
 )
 
 // Clock that returns time in UTC rounded to seconds.
@@ -74,6 +76,14 @@ type Provisioner interface {
 	IsChallengeEnabled(ctx context.Context, challenge provisioner.ACMEChallenge) bool
 	IsAttestationFormatEnabled(ctx context.Context, format provisioner.ACMEAttestationFormat) bool
 	GetAttestationRoots() (*x509.CertPool, bool)
+	GetTPMEndorsementRoots() (*x509.CertPool, bool)
+	GetAndroidKeyAttestationRoots() (*x509.CertPool, bool)
+	GetCAAIdentities() []string
+	GetCAAOptions() *provisioner.ACMECAAOptions
+	GetAttestationRevocationPolicy() provisioner.ACMERevocationPolicy
+	GetDeviceInventory() mdm.Provider
+	GetRateLimits() *provisioner.ACMERateLimits
+	AuthorizeDeviceAttestation(ctx context.Context, data *webhook.DeviceAttestationData) error
 	GetID() string
 	GetName() string
 	DefaultTLSCertDuration() time.Duration
@@ -115,6 +125,14 @@ type MockProvisioner struct {
 	MisChallengeEnabled       func(ctx context.Context, challenge provisioner.ACMEChallenge) bool
 	MisAttFormatEnabled       func(ctx context.Context, format provisioner.ACMEAttestationFormat) bool
 	MgetAttestationRoots      func() (*x509.CertPool, bool)
+	MgetTPMEndorsementRoots   func() (*x509.CertPool, bool)
+	MgetAndroidKeyRoots       func() (*x509.CertPool, bool)
+	MgetCAAIdentities         func() []string
+	MgetCAAOptions            func() *provisioner.ACMECAAOptions
+	MgetRevocationPolicy      func() provisioner.ACMERevocationPolicy
+	MgetDeviceInventory       func() mdm.Provider
+	MgetRateLimits            func() *provisioner.ACMERateLimits
+	MauthorizeDeviceAttest    func(ctx context.Context, data *webhook.DeviceAttestationData) error
 	MdefaultTLSCertDuration   func() time.Duration
 	MgetOptions               func() *provisioner.Options
 }
@@ -174,6 +192,70 @@ func (m *MockProvisioner) GetAttestationRoots() (*x509.CertPool, bool) {
 	return m.Mret1.(*x509.CertPool), m.Mret1 != nil
 }
 
+// GetTPMEndorsementRoots mock
+func (m *MockProvisioner) GetTPMEndorsementRoots() (*x509.CertPool, bool) {
+	if m.MgetTPMEndorsementRoots != nil {
+		return m.MgetTPMEndorsementRoots()
+	}
+	return nil, false
+}
+
+// GetAndroidKeyAttestationRoots mock
+func (m *MockProvisioner) GetAndroidKeyAttestationRoots() (*x509.CertPool, bool) {
+	if m.MgetAndroidKeyRoots != nil {
+		return m.MgetAndroidKeyRoots()
+	}
+	return nil, false
+}
+
+// GetCAAIdentities mock
+func (m *MockProvisioner) GetCAAIdentities() []string {
+	if m.MgetCAAIdentities != nil {
+		return m.MgetCAAIdentities()
+	}
+	return nil
+}
+
+// GetCAAOptions mock
+func (m *MockProvisioner) GetCAAOptions() *provisioner.ACMECAAOptions {
+	if m.MgetCAAOptions != nil {
+		return m.MgetCAAOptions()
+	}
+	return nil
+}
+
+// GetAttestationRevocationPolicy mock
+func (m *MockProvisioner) GetAttestationRevocationPolicy() provisioner.ACMERevocationPolicy {
+	if m.MgetRevocationPolicy != nil {
+		return m.MgetRevocationPolicy()
+	}
+	return provisioner.RevocationPolicyDisable
+}
+
+// GetRateLimits mock
+func (m *MockProvisioner) GetRateLimits() *provisioner.ACMERateLimits {
+	if m.MgetRateLimits != nil {
+		return m.MgetRateLimits()
+	}
+	return nil
+}
+
+// GetDeviceInventory mock
+func (m *MockProvisioner) GetDeviceInventory() mdm.Provider {
+	if m.MgetDeviceInventory != nil {
+		return m.MgetDeviceInventory()
+	}
+	return nil
+}
+
+// AuthorizeDeviceAttestation mock
+func (m *MockProvisioner) AuthorizeDeviceAttestation(ctx context.Context, data *webhook.DeviceAttestationData) error {
+	if m.MauthorizeDeviceAttest != nil {
+		return m.MauthorizeDeviceAttest(ctx, data)
+	}
+	return nil
+}
+
 // DefaultTLSCertDuration mock
 func (m *MockProvisioner) DefaultTLSCertDuration() time.Duration {
 	if m.MdefaultTLSCertDuration != nil {
@@ -2,6 +2,7 @@ package acme
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -25,7 +26,7 @@ type DB interface {
 	GetAccountByKeyID(ctx context.Context, kid string) (*Account, error)
 	UpdateAccount(ctx context.Context, acc *Account) error
 
-	CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
+	CreateExternalAccountKey(ctx context.Context, provisionerID, reference string, expiresAt time.Time) (*ExternalAccountKey, error)
 	GetExternalAccountKey(ctx context.Context, provisionerID, keyID string) (*ExternalAccountKey, error)
 	GetExternalAccountKeys(ctx context.Context, provisionerID, cursor string, limit int) ([]*ExternalAccountKey, string, error)
 	GetExternalAccountKeyByReference(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
@@ -52,7 +53,16 @@ type DB interface {
 	CreateOrder(ctx context.Context, o *Order) error
 	GetOrder(ctx context.Context, id string) (*Order, error)
 	GetOrdersByAccountID(ctx context.Context, accountID string) ([]string, error)
+	GetOrdersByReplaces(ctx context.Context, replaces string) ([]string, error)
 	UpdateOrder(ctx context.Context, o *Order) error
+
+	GetRateLimitCounter(ctx context.Context, key string) (*RateLimitCounter, error)
+	IncrementRateLimitCounter(ctx context.Context, key string, period time.Duration) (*RateLimitCounter, error)
+
+	// RunTransaction runs fn with a DB whose writes are stored atomically
+	// when fn returns without error. If fn returns an error, none of the
+	// writes are stored.
+	RunTransaction(ctx context.Context, fn func(txDB DB) error) error
 }
 
 type dbKey struct{}
@@ -86,7 +96,7 @@ type MockDB struct {
 	MockGetAccountByKeyID func(ctx context.Context, kid string) (*Account, error)
 	MockUpdateAccount     func(ctx context.Context, acc *Account) error
 
-	MockCreateExternalAccountKey         func(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
+	MockCreateExternalAccountKey         func(ctx context.Context, provisionerID, reference string, expiresAt time.Time) (*ExternalAccountKey, error)
 	MockGetExternalAccountKey            func(ctx context.Context, provisionerID, keyID string) (*ExternalAccountKey, error)
 	MockGetExternalAccountKeys           func(ctx context.Context, provisionerID, cursor string, limit int) ([]*ExternalAccountKey, string, error)
 	MockGetExternalAccountKeyByReference func(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error)
@@ -113,8 +123,14 @@ type MockDB struct {
 	MockCreateOrder          func(ctx context.Context, o *Order) error
 	MockGetOrder             func(ctx context.Context, id string) (*Order, error)
 	MockGetOrdersByAccountID func(ctx context.Context, accountID string) ([]string, error)
+	MockGetOrdersByReplaces  func(ctx context.Context, replaces string) ([]string, error)
 	MockUpdateOrder          func(ctx context.Context, o *Order) error
 
+	MockGetRateLimitCounter       func(ctx context.Context, key string) (*RateLimitCounter, error)
+	MockIncrementRateLimitCounter func(ctx context.Context, key string, period time.Duration) (*RateLimitCounter, error)
+
+	MockRunTransaction func(ctx context.Context, fn func(txDB DB) error) error
+
 	MockRet1  interface{}
 	MockError error
 }
@@ -160,9 +176,9 @@ func (m *MockDB) UpdateAccount(ctx context.Context, acc *Account) error {
 }
 
 // CreateExternalAccountKey mock
-func (m *MockDB) CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*ExternalAccountKey, error) {
+func (m *MockDB) CreateExternalAccountKey(ctx context.Context, provisionerID, reference string, expiresAt time.Time) (*ExternalAccountKey, error) {
 	if m.MockCreateExternalAccountKey != nil {
-		return m.MockCreateExternalAccountKey(ctx, provisionerID, reference)
+		return m.MockCreateExternalAccountKey(ctx, provisionerID, reference, expiresAt)
 	} else if m.MockError != nil {
 		return nil, m.MockError
 	}
@@ -379,6 +395,34 @@ func (m *MockDB) UpdateOrder(ctx context.Context, o *Order) error {
 	return m.MockError
 }
 
+// GetRateLimitCounter mock
+func (m *MockDB) GetRateLimitCounter(ctx context.Context, key string) (*RateLimitCounter, error) {
+	if m.MockGetRateLimitCounter != nil {
+		return m.MockGetRateLimitCounter(ctx, key)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.(*RateLimitCounter), m.MockError
+}
+
+// IncrementRateLimitCounter mock
+func (m *MockDB) IncrementRateLimitCounter(ctx context.Context, key string, period time.Duration) (*RateLimitCounter, error) {
+	if m.MockIncrementRateLimitCounter != nil {
+		return m.MockIncrementRateLimitCounter(ctx, key, period)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.(*RateLimitCounter), m.MockError
+}
+
+// RunTransaction mock
+func (m *MockDB) RunTransaction(ctx context.Context, fn func(txDB DB) error) error {
+	if m.MockRunTransaction != nil {
+		return m.MockRunTransaction(ctx, fn)
+	}
+	return fn(m)
+}
+
 // GetOrdersByAccountID mock
 func (m *MockDB) GetOrdersByAccountID(ctx context.Context, accID string) ([]string, error) {
 	if m.MockGetOrdersByAccountID != nil {
@@ -388,3 +432,13 @@ func (m *MockDB) GetOrdersByAccountID(ctx context.Context, accID string) ([]stri
 	}
 	return m.MockRet1.([]string), m.MockError
 }
+
+// GetOrdersByReplaces mock
+func (m *MockDB) GetOrdersByReplaces(ctx context.Context, replaces string) ([]string, error) {
+	if m.MockGetOrdersByReplaces != nil {
+		return m.MockGetOrdersByReplaces(ctx, replaces)
+	} else if m.MockError != nil {
+		return nil, m.MockError
+	}
+	return m.MockRet1.([]string), m.MockError
+}
@@ -138,5 +138,38 @@ func (db *DB) UpdateAccount(ctx context.Context, acc *acme.Account) error {
 		nu.DeactivatedAt = clock.Now()
 	}
 
-	return db.save(ctx, old.ID, nu, old, "account", accountTable)
+	// If the key has changed, then move the jwkID -> acme account ID index to
+	// the new key.
+	if acc.Key == nil {
+		return db.save(ctx, old.ID, nu, old, "account", accountTable)
+	}
+	oldKid, err := acme.KeyToID(old.Key)
+	if err != nil {
+		return err
+	}
+	newKid, err := acme.KeyToID(acc.Key)
+	if err != nil {
+		return err
+	}
+	if oldKid == newKid {
+		return db.save(ctx, old.ID, nu, old, "account", accountTable)
+	}
+
+	newKidB := []byte(newKid)
+	_, swapped, err := db.db.CmpAndSwap(accountByKeyIDTable, newKidB, nil, []byte(acc.ID))
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error storing keyID to accountID index")
+	case !swapped:
+		return errors.Errorf("key-id to account-id index already exists")
+	}
+	nu.Key = acc.Key
+	if err := db.save(ctx, old.ID, nu, old, "account", accountTable); err != nil {
+		db.db.Del(accountByKeyIDTable, newKidB)
+		return err
+	}
+	if err := db.db.Del(accountByKeyIDTable, []byte(oldKid)); err != nil {
+		return errors.Wrap(err, "error deleting keyID to accountID index")
+	}
+	return nil
 }
@@ -659,6 +659,76 @@ func TestDB_UpdateAccount(t *testing.T) {
 				err: errors.New("error saving acme account: force"),
 			}
 		},
+		"fail/key-change/index-exists": func(t *testing.T) test {
+			newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			newKid, err := acme.KeyToID(newJWK)
+			assert.FatalError(t, err)
+			return test{
+				acc: &acme.Account{
+					ID:     accID,
+					Status: acme.StatusValid,
+					Key:    newJWK,
+				},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, accountTable)
+						assert.Equals(t, string(key), accID)
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), newKid)
+						assert.Nil(t, old)
+						return []byte("otherID"), false, nil
+					},
+				},
+				err: errors.New("key-id to account-id index already exists"),
+			}
+		},
+		"ok/key-change": func(t *testing.T) test {
+			newJWK, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+			assert.FatalError(t, err)
+			newKid, err := acme.KeyToID(newJWK)
+			assert.FatalError(t, err)
+			oldKid, err := acme.KeyToID(jwk)
+			assert.FatalError(t, err)
+			return test{
+				acc: &acme.Account{
+					ID:     accID,
+					Status: acme.StatusDeactivated,
+					Key:    newJWK,
+				},
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, bucket, accountTable)
+						assert.Equals(t, string(key), accID)
+						return b, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						switch string(bucket) {
+						case string(accountByKeyIDTable):
+							assert.Equals(t, string(key), newKid)
+							assert.Nil(t, old)
+							assert.Equals(t, string(nu), accID)
+						case string(accountTable):
+							assert.Equals(t, old, b)
+							dbNew := new(dbAccount)
+							assert.FatalError(t, json.Unmarshal(nu, dbNew))
+							assert.Equals(t, dbNew.Key.KeyID, newJWK.KeyID)
+						default:
+							t.Errorf("unexpected bucket %s", bucket)
+						}
+						return nu, true, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, accountByKeyIDTable)
+						assert.Equals(t, string(key), oldKid)
+						return nil
+					},
+				},
+			}
+		},
 		"ok": func(t *testing.T) test {
 			acc := &acme.Account{
 				ID:              accID,
@@ -22,6 +22,38 @@ type dbChallenge struct {
 	ValidatedAt string             `json:"validatedAt"`
 	CreatedAt   time.Time          `json:"createdAt"`
 	Error       *acme.Error        `json:"error"` // TODO(hs): a bit dangerous; should become db-specific type
+	RetryCount  int                `json:"retryCount,omitempty"`
+	RetryAfter  *time.Time         `json:"retryAfter,omitempty"`
+
+	// Credential and CredentialDigest are only set in device-attest-01
+	// challenges using the tpm format.
+	Credential       *acme.TPMCredential `json:"credential,omitempty"`
+	CredentialDigest []byte              `json:"credentialDigest,omitempty"`
+}
+
+// validatedAt returns the time the challenge was validated. The time is
+// stored as an RFC 3339 string that is empty if the challenge was not
+// validated; the stored format is kept so the records written by previous
+// versions can still be updated.
+func (dbc *dbChallenge) validatedAt() (time.Time, error) {
+	if dbc.ValidatedAt == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, dbc.ValidatedAt)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "error parsing validatedAt")
+	}
+	if t.IsZero() {
+		return time.Time{}, nil
+	}
+	return t.UTC(), nil
+}
+
+func formatValidatedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
 }
 
 func (dbc *dbChallenge) clone() *dbChallenge {
@@ -74,6 +106,10 @@ func (db *DB) GetChallenge(ctx context.Context, id, authzID string) (*acme.Chall
 	if err != nil {
 		return nil, err
 	}
+	validatedAt, err := dbch.validatedAt()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading acme challenge %s", id)
+	}
 
 	ch := &acme.Challenge{
 		ID:          dbch.ID,
@@ -83,8 +119,14 @@ func (db *DB) GetChallenge(ctx context.Context, id, authzID string) (*acme.Chall
 		Status:      dbch.Status,
 		Token:       dbch.Token,
 		Error:       dbch.Error,
-		ValidatedAt: dbch.ValidatedAt,
+		ValidatedAt: validatedAt,
+		RetryCount:  dbch.RetryCount,
+	}
+	if dbch.RetryAfter != nil {
+		ch.RetryAfter = *dbch.RetryAfter
 	}
+	ch.Credential = dbch.Credential
+	ch.CredentialDigest = dbch.CredentialDigest
 	return ch, nil
 }
 
@@ -100,7 +142,15 @@ func (db *DB) UpdateChallenge(ctx context.Context, ch *acme.Challenge) error {
 	// These should be the only values changing in an Update request.
 	nu.Status = ch.Status
 	nu.Error = ch.Error
-	nu.ValidatedAt = ch.ValidatedAt
+	nu.ValidatedAt = formatValidatedAt(ch.ValidatedAt)
+	nu.RetryCount = ch.RetryCount
+	nu.RetryAfter = nil
+	if !ch.RetryAfter.IsZero() {
+		retryAfter := ch.RetryAfter.UTC()
+		nu.RetryAfter = &retryAfter
+	}
+	nu.Credential = ch.Credential
+	nu.CredentialDigest = ch.CredentialDigest
 
 	return db.save(ctx, old.ID, nu, old, "challenge", challengeTable)
 }
@@ -1,6 +1,7 @@
 package nosql
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"testing"
@@ -71,7 +72,7 @@ func TestDB_getDBChallenge(t *testing.T) {
 				Token:       "token",
 				Value:       "test.ca.smallstep.com",
 				CreatedAt:   clock.Now(),
-				ValidatedAt: "foobar",
+				ValidatedAt: clock.Now().Format(time.RFC3339),
 				Error:       acme.NewErrorISE("The server experienced an internal error"),
 			}
 			b, err := json.Marshal(dbc)
@@ -263,7 +264,7 @@ func TestDB_GetChallenge(t *testing.T) {
 				Token:       "token",
 				Value:       "test.ca.smallstep.com",
 				CreatedAt:   clock.Now(),
-				ValidatedAt: "foobar",
+				ValidatedAt: clock.Now().Format(time.RFC3339),
 				Error:       acme.NewErrorISE("The server experienced an internal error"),
 			}
 			b, err := json.Marshal(dbc)
@@ -307,7 +308,7 @@ func TestDB_GetChallenge(t *testing.T) {
 				assert.Equals(t, ch.Status, tc.dbc.Status)
 				assert.Equals(t, ch.Token, tc.dbc.Token)
 				assert.Equals(t, ch.Value, tc.dbc.Value)
-				assert.Equals(t, ch.ValidatedAt, tc.dbc.ValidatedAt)
+				assert.Equals(t, ch.ValidatedAt.Format(time.RFC3339), tc.dbc.ValidatedAt)
 				assert.Equals(t, ch.Error.Error(), tc.dbc.Error.Error())
 			}
 		})
@@ -353,7 +354,7 @@ func TestDB_UpdateChallenge(t *testing.T) {
 			updCh := &acme.Challenge{
 				ID:          chID,
 				Status:      acme.StatusValid,
-				ValidatedAt: "foobar",
+				ValidatedAt: clock.Now(),
 				Error:       acme.NewError(acme.ErrorMalformedType, "The request message was malformed"),
 			}
 			return test{
@@ -383,7 +384,7 @@ func TestDB_UpdateChallenge(t *testing.T) {
 						assert.Equals(t, dbNew.Value, dbc.Value)
 						assert.Equals(t, dbNew.Error.Error(), updCh.Error.Error())
 						assert.Equals(t, dbNew.CreatedAt, dbc.CreatedAt)
-						assert.Equals(t, dbNew.ValidatedAt, updCh.ValidatedAt)
+						assert.Equals(t, dbNew.ValidatedAt, updCh.ValidatedAt.Format(time.RFC3339))
 						return nil, false, errors.New("force")
 					},
 				},
@@ -398,7 +399,7 @@ func TestDB_UpdateChallenge(t *testing.T) {
 				Token:       dbc.Token,
 				Value:       dbc.Value,
 				Status:      acme.StatusValid,
-				ValidatedAt: "foobar",
+				ValidatedAt: clock.Now(),
 				Error:       acme.NewError(acme.ErrorMalformedType, "malformed"),
 			}
 			return test{
@@ -427,7 +428,7 @@ func TestDB_UpdateChallenge(t *testing.T) {
 						assert.Equals(t, dbNew.Value, dbc.Value)
 						assert.Equals(t, dbNew.CreatedAt, dbc.CreatedAt)
 						assert.Equals(t, dbNew.Status, acme.StatusValid)
-						assert.Equals(t, dbNew.ValidatedAt, "foobar")
+						assert.Equals(t, dbNew.ValidatedAt, updCh.ValidatedAt.Format(time.RFC3339))
 						assert.Equals(t, dbNew.Error.Error(), acme.NewError(acme.ErrorMalformedType, "The request message was malformed").Error())
 						return nu, true, nil
 					},
@@ -450,7 +451,7 @@ func TestDB_UpdateChallenge(t *testing.T) {
 					assert.Equals(t, tc.ch.Type, dbc.Type)
 					assert.Equals(t, tc.ch.Token, dbc.Token)
 					assert.Equals(t, tc.ch.Value, dbc.Value)
-					assert.Equals(t, tc.ch.ValidatedAt, "foobar")
+					assert.False(t, tc.ch.ValidatedAt.IsZero())
 					assert.Equals(t, tc.ch.Status, acme.StatusValid)
 					assert.Equals(t, tc.ch.Error.Error(), acme.NewError(acme.ErrorMalformedType, "malformed").Error())
 				}
@@ -458,3 +459,109 @@ func TestDB_UpdateChallenge(t *testing.T) {
 		})
 	}
 }
+
+func TestDBChallenge_validatedAt(t *testing.T) {
+	validatedAt := time.Date(2023, 10, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		data string
+		want time.Time
+		err  bool
+	}{
+		{"ok/empty", `{"id":"chID","validatedAt":""}`, time.Time{}, false},
+		{"ok/rfc3339", `{"id":"chID","validatedAt":"2023-10-01T12:30:00Z"}`, validatedAt, false},
+		{"ok/offset", `{"id":"chID","validatedAt":"2023-10-01T14:30:00+02:00"}`, validatedAt, false},
+		{"ok/zero", `{"id":"chID","validatedAt":"0001-01-01T00:00:00Z"}`, time.Time{}, false},
+		{"ok/missing", `{"id":"chID"}`, time.Time{}, false},
+		{"fail/bad-time", `{"id":"chID","validatedAt":"foobar"}`, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbc := new(dbChallenge)
+			assert.FatalError(t, json.Unmarshal([]byte(tt.data), dbc))
+			got, err := dbc.validatedAt()
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+
+	assert.Equals(t, "", formatValidatedAt(time.Time{}))
+	assert.Equals(t, "2023-10-01T12:30:00Z", formatValidatedAt(validatedAt.In(time.FixedZone("", 7200))))
+}
+
+func TestDB_UpdateChallenge_storedRecord(t *testing.T) {
+	// Challenges stored by previous versions must be updated without
+	// changing the bytes used in the compare-and-swap, both directly and in a
+	// transaction.
+	records := map[string][]byte{
+		"validatedAt-string": []byte(`{"id":"chID","accountID":"accID","type":"http-01","status":"pending","token":"token","value":"test.ca.smallstep.com","validatedAt":"","createdAt":"2023-10-01T12:00:00Z","error":null}`),
+		"validatedAt-time":   []byte(`{"id":"chID","accountID":"accID","type":"http-01","status":"pending","token":"token","value":"test.ca.smallstep.com","validatedAt":"0001-01-01T00:00:00Z","createdAt":"2023-10-01T12:00:00Z","error":null}`),
+	}
+	ch := &acme.Challenge{
+		ID:         "chID",
+		Status:     acme.StatusPending,
+		RetryCount: 1,
+		RetryAfter: time.Now().Add(time.Minute),
+	}
+	for name, stored := range records {
+		stored := stored
+		t.Run(name, func(t *testing.T) {
+			newDB := func() *DB {
+				return &DB{db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, challengeTable, bucket)
+						assert.Equals(t, "chID", string(key))
+						return stored, nil
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						if !bytes.Equal(old, stored) {
+							return stored, false, nil
+						}
+						return nu, true, nil
+					},
+					MUpdate: func(tx *nosqldb.Tx) error {
+						return nil
+					},
+				}}
+			}
+
+			assert.FatalError(t, newDB().UpdateChallenge(context.Background(), ch))
+			err := newDB().RunTransaction(context.Background(), func(txDB acme.DB) error {
+				return txDB.UpdateChallenge(context.Background(), ch)
+			})
+			assert.FatalError(t, err)
+		})
+	}
+}
+
+func TestDB_UpdateChallenge_credential(t *testing.T) {
+	stored := []byte(`{"id":"chID","accountID":"accID","type":"device-attest-01","status":"pending","token":"token","value":"device-1234","validatedAt":"","createdAt":"2023-10-01T12:00:00Z","error":null}`)
+	d := &DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return stored, nil
+		},
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			if !bytes.Equal(old, stored) {
+				return stored, false, nil
+			}
+			stored = nu
+			return nu, true, nil
+		},
+	}}
+
+	ch, err := d.GetChallenge(context.Background(), "chID", "azID")
+	assert.FatalError(t, err)
+	assert.Nil(t, ch.Credential)
+	ch.Credential = &acme.TPMCredential{CredentialBlob: []byte("blob"), EncryptedSecret: []byte("secret")}
+	ch.CredentialDigest = []byte("digest")
+	assert.FatalError(t, d.UpdateChallenge(context.Background(), ch))
+
+	got, err := d.GetChallenge(context.Background(), "chID", "azID")
+	assert.FatalError(t, err)
+	assert.Equals(t, ch.Credential, got.Credential)
+	assert.Equals(t, []byte("digest"), got.CredentialDigest)
+}
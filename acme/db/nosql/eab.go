@@ -20,13 +20,33 @@ var externalAccountKeyMutex sync.RWMutex
 var referencesByProvisionerIndexMutex sync.Mutex
 
 type dbExternalAccountKey struct {
-	ID            string    `json:"id"`
-	ProvisionerID string    `json:"provisionerID"`
-	Reference     string    `json:"reference"`
-	AccountID     string    `json:"accountID,omitempty"`
-	HmacKey       []byte    `json:"key"`
-	CreatedAt     time.Time `json:"createdAt"`
-	BoundAt       time.Time `json:"boundAt"`
+	ID            string     `json:"id"`
+	ProvisionerID string     `json:"provisionerID"`
+	Reference     string     `json:"reference"`
+	AccountID     string     `json:"accountID,omitempty"`
+	HmacKey       []byte     `json:"key"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	BoundAt       time.Time  `json:"boundAt"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+}
+
+// expiresAt returns the expiration of the key, or the zero time if the key
+// does not expire.
+func (dbeak *dbExternalAccountKey) expiresAt() time.Time {
+	if dbeak.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return *dbeak.ExpiresAt
+}
+
+// eakExpiresAt returns the expiration to store for a key, nil if the key does
+// not expire, so keys without an expiration are stored as before.
+func eakExpiresAt(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
 }
 
 type dbExternalAccountKeyReference struct {
@@ -52,8 +72,9 @@ func (db *DB) getDBExternalAccountKey(_ context.Context, id string) (*dbExternal
 	return dbeak, nil
 }
 
-// CreateExternalAccountKey creates a new External Account Binding key with a name
-func (db *DB) CreateExternalAccountKey(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+// CreateExternalAccountKey creates a new External Account Binding key with a
+// name. The key does not expire if expiresAt is the zero time.
+func (db *DB) CreateExternalAccountKey(ctx context.Context, provisionerID, reference string, expiresAt time.Time) (*acme.ExternalAccountKey, error) {
 	externalAccountKeyMutex.Lock()
 	defer externalAccountKeyMutex.Unlock()
 
@@ -74,6 +95,7 @@ func (db *DB) CreateExternalAccountKey(ctx context.Context, provisionerID, refer
 		Reference:     reference,
 		HmacKey:       random,
 		CreatedAt:     clock.Now(),
+		ExpiresAt:     eakExpiresAt(expiresAt),
 	}
 
 	if err := db.save(ctx, keyID, dbeak, nil, "external_account_key", externalAccountKeyTable); err != nil {
@@ -102,6 +124,7 @@ func (db *DB) CreateExternalAccountKey(ctx context.Context, provisionerID, refer
 		HmacKey:       dbeak.HmacKey,
 		CreatedAt:     dbeak.CreatedAt,
 		BoundAt:       dbeak.BoundAt,
+		ExpiresAt:     dbeak.expiresAt(),
 	}, nil
 }
 
@@ -127,6 +150,7 @@ func (db *DB) GetExternalAccountKey(ctx context.Context, provisionerID, keyID st
 		HmacKey:       dbeak.HmacKey,
 		CreatedAt:     dbeak.CreatedAt,
 		BoundAt:       dbeak.BoundAt,
+		ExpiresAt:     dbeak.expiresAt(),
 	}, nil
 }
 
@@ -190,6 +214,7 @@ func (db *DB) GetExternalAccountKeys(ctx context.Context, provisionerID, cursor
 			if !nosqlDB.IsErrNotFound(err) {
 				return nil, "", errors.Wrapf(err, "error retrieving ACME EAB Key for provisioner %s and keyID %s", provisionerID, eakID)
 			}
+			continue // skip the IDs of keys that no longer exist
 		}
 		keys = append(keys, &acme.ExternalAccountKey{
 			ID:            eak.ID,
@@ -199,6 +224,7 @@ func (db *DB) GetExternalAccountKeys(ctx context.Context, provisionerID, cursor
 			AccountID:     eak.AccountID,
 			CreatedAt:     eak.CreatedAt,
 			BoundAt:       eak.BoundAt,
+			ExpiresAt:     eak.expiresAt(),
 		})
 	}
 
@@ -263,6 +289,7 @@ func (db *DB) UpdateExternalAccountKey(ctx context.Context, provisionerID string
 		HmacKey:       eak.HmacKey,
 		CreatedAt:     eak.CreatedAt,
 		BoundAt:       eak.BoundAt,
+		ExpiresAt:     eakExpiresAt(eak.ExpiresAt),
 	}
 
 	return db.save(ctx, nu.ID, nu, old, "external_account_key", externalAccountKeyTable)
@@ -1,10 +1,12 @@
 package nosql
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
@@ -907,6 +909,7 @@ func TestDB_CreateExternalAccountKey(t *testing.T) {
 	keyID := "keyID"
 	provID := "provID"
 	ref := "ref"
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
 	type test struct {
 		db  nosql.DB
 		err error
@@ -958,6 +961,7 @@ func TestDB_CreateExternalAccountKey(t *testing.T) {
 							assert.False(t, dbeak.CreatedAt.IsZero())
 							assert.Equals(t, dbeak.AccountID, eak.AccountID)
 							assert.True(t, dbeak.BoundAt.IsZero())
+							assert.True(t, expiresAt.Equal(dbeak.expiresAt()))
 							return nu, true, nil
 						default:
 							assert.FatalError(t, errors.Errorf("unexpected bucket %s", string(bucket)))
@@ -1051,7 +1055,7 @@ func TestDB_CreateExternalAccountKey(t *testing.T) {
 		tc := run(t)
 		t.Run(name, func(t *testing.T) {
 			d := DB{db: tc.db}
-			eak, err := d.CreateExternalAccountKey(context.Background(), provID, ref)
+			eak, err := d.CreateExternalAccountKey(context.Background(), provID, ref, expiresAt)
 			if err != nil {
 				if assert.NotNil(t, tc.err) {
 					assert.Equals(t, err.Error(), tc.err.Error())
@@ -1064,6 +1068,7 @@ func TestDB_CreateExternalAccountKey(t *testing.T) {
 				assert.False(t, eak.CreatedAt.IsZero())
 				assert.False(t, eak.AlreadyBound())
 				assert.True(t, eak.BoundAt.IsZero())
+				assert.Equals(t, expiresAt.UTC(), eak.ExpiresAt)
 			}
 		})
 	}
@@ -1244,6 +1249,50 @@ func TestDB_UpdateExternalAccountKey(t *testing.T) {
 	}
 }
 
+func TestDB_UpdateExternalAccountKey_storedRecord(t *testing.T) {
+	now := clock.Now().Truncate(time.Second)
+	// Keys created without an expiration do not store it.
+	stored, err := json.Marshal(struct {
+		ID            string    `json:"id"`
+		ProvisionerID string    `json:"provisionerID"`
+		Reference     string    `json:"reference"`
+		HmacKey       []byte    `json:"key"`
+		CreatedAt     time.Time `json:"createdAt"`
+		BoundAt       time.Time `json:"boundAt"`
+	}{"keyID", "provID", "ref", []byte{1, 3, 3, 7}, now, time.Time{}})
+	assert.FatalError(t, err)
+
+	var saved []byte
+	d := DB{db: &certdb.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			assert.Equals(t, externalAccountKeyTable, bucket)
+			return stored, nil
+		},
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			if !bytes.Equal(stored, old) {
+				return stored, false, nil
+			}
+			saved = nu
+			return nu, true, nil
+		},
+	}}
+
+	eak, err := d.GetExternalAccountKey(context.Background(), "provID", "keyID")
+	assert.FatalError(t, err)
+	assert.True(t, eak.ExpiresAt.IsZero())
+	eak.AccountID = "accountID"
+	eak.BoundAt = now
+	assert.FatalError(t, d.UpdateExternalAccountKey(context.Background(), "provID", eak))
+	assert.False(t, bytes.Contains(saved, []byte("expiresAt")))
+
+	eak.ExpiresAt = now.Add(time.Hour)
+	saved = nil
+	assert.FatalError(t, d.UpdateExternalAccountKey(context.Background(), "provID", eak))
+	dbeak := new(dbExternalAccountKey)
+	assert.FatalError(t, json.Unmarshal(saved, dbeak))
+	assert.True(t, now.Add(time.Hour).Equal(dbeak.expiresAt()))
+}
+
 func TestDB_addEAKID(t *testing.T) {
 	provID := "provID"
 	eakID := "eakID"
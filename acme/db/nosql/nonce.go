@@ -3,6 +3,7 @@ package nosql
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"time"
 
 	"github.com/pkg/errors"
@@ -64,3 +65,27 @@ func (db *DB) DeleteNonce(_ context.Context, nonce acme.Nonce) error {
 		return nil
 	}
 }
+
+// DeleteExpiredNonces deletes the nonces created before the given time, and
+// returns the number of nonces deleted.
+func (db *DB) DeleteExpiredNonces(_ context.Context, before time.Time) (int, error) {
+	entries, err := db.db.List(nonceTable)
+	if err != nil {
+		return 0, errors.Wrap(err, "error listing nonces")
+	}
+	var deleted int
+	for _, entry := range entries {
+		n := new(dbNonce)
+		if err := json.Unmarshal(entry.Value, n); err != nil {
+			return deleted, errors.Wrapf(err, "error unmarshaling nonce %s", string(entry.Key))
+		}
+		if !n.CreatedAt.Before(before) {
+			continue
+		}
+		if err := db.db.Del(nonceTable, entry.Key); err != nil && !nosql.IsErrNotFound(err) {
+			return deleted, errors.Wrapf(err, "error deleting nonce %s", string(entry.Key))
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -166,3 +166,87 @@ func TestDB_DeleteNonce(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_DeleteExpiredNonces(t *testing.T) {
+	now := time.Now()
+	entry := func(t *testing.T, id string, createdAt time.Time) *database.Entry {
+		b, err := json.Marshal(&dbNonce{ID: id, CreatedAt: createdAt})
+		assert.FatalError(t, err)
+		return &database.Entry{Bucket: nonceTable, Key: []byte(id), Value: b}
+	}
+	type test struct {
+		db      nosql.DB
+		deleted int
+		err     error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.List-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*database.Entry, error) {
+						assert.Equals(t, bucket, nonceTable)
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error listing nonces: force"),
+			}
+		},
+		"fail/unmarshal-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*database.Entry, error) {
+						return []*database.Entry{{Bucket: nonceTable, Key: []byte("n1"), Value: []byte("foo")}}, nil
+					},
+				},
+				err: errors.New("error unmarshaling nonce n1"),
+			}
+		},
+		"fail/db.Del-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*database.Entry, error) {
+						return []*database.Entry{entry(t, "n1", now.Add(-2*time.Hour))}, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						return errors.New("force")
+					},
+				},
+				err: errors.New("error deleting nonce n1: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*database.Entry, error) {
+						return []*database.Entry{
+							entry(t, "n1", now.Add(-2*time.Hour)),
+							entry(t, "n2", now),
+							entry(t, "n3", now.Add(-90*time.Minute)),
+						}, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, nonceTable)
+						assert.NotEquals(t, string(key), "n2")
+						return nil
+					},
+				},
+				deleted: 2,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			deleted, err := d.DeleteExpiredNonces(context.Background(), now.Add(-time.Hour))
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, deleted, tc.deleted)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package nosql
 import (
 	"context"
 	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -18,24 +19,31 @@ var (
 	nonceTable                                = []byte("nonces")
 	orderTable                                = []byte("acme_orders")
 	ordersByAccountIDTable                    = []byte("acme_account_orders_index")
+	ordersByReplacesTable                     = []byte("acme_replaces_orders_index")
 	certTable                                 = []byte("acme_certs")
 	certBySerialTable                         = []byte("acme_serial_certs_index")
 	externalAccountKeyTable                   = []byte("acme_external_account_keys")
 	externalAccountKeyIDsByReferenceTable     = []byte("acme_external_account_keyID_reference_index")
 	externalAccountKeyIDsByProvisionerIDTable = []byte("acme_external_account_keyID_provisionerID_index")
+	rateLimitTable                            = []byte("acme_rate_limits")
 )
 
 // DB is a struct that implements the AcmeDB interface.
 type DB struct {
 	db nosqlDB.DB
+	// mu serializes the entity writes with the transaction commits, so an
+	// entity cannot change between the verification of a transaction and its
+	// writes.
+	mu sync.Mutex
 }
 
 // New configures and returns a new ACME DB backend implemented using a nosql DB.
 func New(db nosqlDB.DB) (*DB, error) {
 	tables := [][]byte{accountTable, accountByKeyIDTable, authzTable,
-		challengeTable, nonceTable, orderTable, ordersByAccountIDTable,
+		challengeTable, nonceTable, orderTable, ordersByAccountIDTable, ordersByReplacesTable,
 		certTable, certBySerialTable, externalAccountKeyTable,
 		externalAccountKeyIDsByReferenceTable, externalAccountKeyIDsByProvisionerIDTable,
+		rateLimitTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -43,7 +51,7 @@ func New(db nosqlDB.DB) (*DB, error) {
 				string(b))
 		}
 	}
-	return &DB{db}, nil
+	return &DB{db: db}, nil
 }
 
 // save writes the new data to the database, overwriting the old data if it
@@ -71,7 +79,9 @@ func (db *DB) save(_ context.Context, id string, nu, old interface{}, typ string
 		}
 	}
 
+	db.mu.Lock()
 	_, swapped, err := db.db.CmpAndSwap(table, []byte(id), oldB, newB)
+	db.mu.Unlock()
 	switch {
 	case err != nil:
 		return errors.Wrapf(err, "error saving acme %s", typ)
@@ -14,6 +14,9 @@ import (
 // Mutex for locking ordersByAccount index operations.
 var ordersByAccountMux sync.Mutex
 
+// Mutex for locking ordersByReplaces index operations.
+var ordersByReplacesMux sync.Mutex
+
 type dbOrder struct {
 	ID               string            `json:"id"`
 	AccountID        string            `json:"accountID"`
@@ -27,6 +30,7 @@ type dbOrder struct {
 	ExpiresAt        time.Time         `json:"expiresAt,omitempty"`
 	CertificateID    string            `json:"certificate,omitempty"`
 	Error            *acme.Error       `json:"error,omitempty"`
+	Replaces         string            `json:"replaces,omitempty"`
 }
 
 func (a *dbOrder) clone() *dbOrder {
@@ -68,6 +72,7 @@ func (db *DB) GetOrder(ctx context.Context, id string) (*acme.Order, error) {
 		NotAfter:         dbo.NotAfter,
 		AuthorizationIDs: dbo.AuthorizationIDs,
 		Error:            dbo.Error,
+		Replaces:         dbo.Replaces,
 	}
 
 	return o, nil
@@ -93,6 +98,7 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 		NotBefore:        o.NotBefore,
 		NotAfter:         o.NotAfter,
 		AuthorizationIDs: o.AuthorizationIDs,
+		Replaces:         o.Replaces,
 	}
 	if err := db.save(ctx, o.ID, dbo, nil, "order", orderTable); err != nil {
 		return err
@@ -102,6 +108,11 @@ func (db *DB) CreateOrder(ctx context.Context, o *acme.Order) error {
 	if err != nil {
 		return err
 	}
+	if o.Replaces != "" {
+		if _, err := db.updateReplacesOrderIDs(ctx, o.Replaces, o.ID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -185,3 +196,61 @@ func (db *DB) updateAddOrderIDs(ctx context.Context, accID string, addOids ...st
 func (db *DB) GetOrdersByAccountID(ctx context.Context, accID string) ([]string, error) {
 	return db.updateAddOrderIDs(ctx, accID)
 }
+
+// GetOrdersByReplaces returns the IDs of the pending, ready and processing
+// orders that replace the certificate with the given ARI certificate ID.
+func (db *DB) GetOrdersByReplaces(ctx context.Context, replaces string) ([]string, error) {
+	return db.updateReplacesOrderIDs(ctx, replaces)
+}
+
+// updateReplacesOrderIDs adds the given orders to the index of orders that
+// replace a certificate. Orders that are no longer pending, ready or
+// processing are removed from the index.
+func (db *DB) updateReplacesOrderIDs(ctx context.Context, replaces string, addOids ...string) ([]string, error) {
+	ordersByReplacesMux.Lock()
+	defer ordersByReplacesMux.Unlock()
+
+	var oldOids []string
+	b, err := db.db.Get(ordersByReplacesTable, []byte(replaces))
+	if err != nil {
+		if !nosql.IsErrNotFound(err) {
+			return nil, errors.Wrapf(err, "error loading orderIDs replacing %s", replaces)
+		}
+	} else {
+		if err := json.Unmarshal(b, &oldOids); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling orderIDs replacing %s", replaces)
+		}
+	}
+
+	activeOids := []string{}
+	for _, oid := range oldOids {
+		o, err := db.GetOrder(ctx, oid)
+		if err != nil {
+			return nil, acme.WrapErrorISE(err, "error loading order %s replacing %s", oid, replaces)
+		}
+		if err = o.UpdateStatus(ctx, db); err != nil {
+			return nil, acme.WrapErrorISE(err, "error updating order %s replacing %s", oid, replaces)
+		}
+		switch o.Status {
+		case acme.StatusPending, acme.StatusReady, acme.StatusProcessing:
+			activeOids = append(activeOids, oid)
+		}
+	}
+	activeOids = append(activeOids, addOids...)
+	var (
+		_old interface{} = oldOids
+		_new interface{} = activeOids
+	)
+	switch {
+	case len(oldOids) == 0 && len(activeOids) == 0:
+		return []string{}, nil
+	case len(oldOids) == 0:
+		_old = nil
+	case len(activeOids) == 0:
+		_new = nil
+	}
+	if err = db.save(ctx, replaces, _new, _old, "orderIDsByReplaces", ordersByReplacesTable); err != nil {
+		return nil, errors.Wrapf(err, "error saving orderIDs index replacing %s", replaces)
+	}
+	return activeOids, nil
+}
@@ -663,7 +663,7 @@ func TestDB_updateAddOrderIDs(t *testing.T) {
 						return nil, false, errors.New("force")
 					},
 				},
-				acmeErr: acme.NewErrorISE("error updating order foo for account accID: error updating order: error saving acme order: force"),
+				acmeErr: acme.NewErrorISE("error updating order foo for account accID: error committing acme transaction: force"),
 			}
 		},
 		"fail/db.save-order-error": func(t *testing.T) test {
@@ -1023,3 +1023,109 @@ func TestDB_updateAddOrderIDs(t *testing.T) {
 		})
 	}
 }
+
+func TestDB_updateReplacesOrderIDs(t *testing.T) {
+	replaces := "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE"
+	future := clock.Now().Add(time.Hour)
+	orders := map[string]*dbOrder{
+		"ready":   {ID: "ready", Status: acme.StatusReady, ExpiresAt: future},
+		"valid":   {ID: "valid", Status: acme.StatusValid, ExpiresAt: future},
+		"invalid": {ID: "invalid", Status: acme.StatusInvalid, ExpiresAt: future},
+	}
+	type test struct {
+		db      nosql.DB
+		addOids []string
+		err     error
+		res     []string
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.Get-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						assert.Equals(t, string(bucket), string(ordersByReplacesTable))
+						assert.Equals(t, string(key), replaces)
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.Errorf("error loading orderIDs replacing %s: force", replaces),
+			}
+		},
+		"fail/unmarshal-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return []byte("foo"), nil
+					},
+				},
+				err: errors.Errorf("error unmarshaling orderIDs replacing %s", replaces),
+			}
+		},
+		"ok/not-found": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, database.ErrNotFound
+					},
+				},
+				res: []string{},
+			}
+		},
+		"ok/add": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						return nil, database.ErrNotFound
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, string(bucket), string(ordersByReplacesTable))
+						assert.Equals(t, string(key), replaces)
+						assert.Equals(t, old, nil)
+						assert.Equals(t, string(nu), `["ordID"]`)
+						return nu, true, nil
+					},
+				},
+				addOids: []string{"ordID"},
+				res:     []string{"ordID"},
+			}
+		},
+		"ok/prune": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MGet: func(bucket, key []byte) ([]byte, error) {
+						switch string(bucket) {
+						case string(ordersByReplacesTable):
+							return []byte(`["ready","valid","invalid"]`), nil
+						case string(orderTable):
+							return json.Marshal(orders[string(key)])
+						default:
+							return nil, errors.Errorf("unexpected bucket %s", bucket)
+						}
+					},
+					MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+						assert.Equals(t, string(bucket), string(ordersByReplacesTable))
+						assert.Equals(t, string(old), `["ready","valid","invalid"]`)
+						assert.Equals(t, string(nu), `["ready","ordID"]`)
+						return nu, true, nil
+					},
+				},
+				addOids: []string{"ordID"},
+				res:     []string{"ready", "ordID"},
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			res, err := d.updateReplacesOrderIDs(context.Background(), replaces, tc.addOids...)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+			} else if assert.Nil(t, tc.err) {
+				assert.Equals(t, res, tc.res)
+			}
+		})
+	}
+}
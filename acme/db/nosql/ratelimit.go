@@ -0,0 +1,114 @@
+package nosql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/nosql"
+)
+
+// maxRateLimitRetries is the number of times a rate limit counter update is
+// retried if the counter is concurrently modified.
+const maxRateLimitRetries = 10
+
+// dbRateLimitCounter is the number of operations in the current window of a
+// rate limit.
+type dbRateLimitCounter struct {
+	Key       string    `json:"key"`
+	Count     int       `json:"count"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (c *dbRateLimitCounter) toACME() *acme.RateLimitCounter {
+	return &acme.RateLimitCounter{
+		Key:       c.Key,
+		Count:     c.Count,
+		ExpiresAt: c.ExpiresAt,
+	}
+}
+
+func (db *DB) getRateLimitCounter(key string) (*dbRateLimitCounter, []byte, error) {
+	data, err := db.db.Get(rateLimitTable, []byte(key))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return &dbRateLimitCounter{Key: key}, nil, nil
+	case err != nil:
+		return nil, nil, errors.Wrapf(err, "error loading rate limit %s", key)
+	}
+	c := new(dbRateLimitCounter)
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, nil, errors.Wrapf(err, "error unmarshaling rate limit %s into dbRateLimitCounter", key)
+	}
+	return c, data, nil
+}
+
+// GetRateLimitCounter retrieves the counter of a rate limit. A counter with
+// no operations is returned if it does not exist.
+func (db *DB) GetRateLimitCounter(_ context.Context, key string) (*acme.RateLimitCounter, error) {
+	c, _, err := db.getRateLimitCounter(key)
+	if err != nil {
+		return nil, err
+	}
+	return c.toACME(), nil
+}
+
+// IncrementRateLimitCounter adds one operation to the counter of a rate limit.
+// If the current window has expired, a new window of the given period is
+// started.
+func (db *DB) IncrementRateLimitCounter(_ context.Context, key string, period time.Duration) (*acme.RateLimitCounter, error) {
+	for i := 0; i < maxRateLimitRetries; i++ {
+		c, old, err := db.getRateLimitCounter(key)
+		if err != nil {
+			return nil, err
+		}
+
+		now := clock.Now()
+		if !now.Before(c.ExpiresAt) {
+			c.Count = 0
+			c.ExpiresAt = now.Add(period)
+		}
+		c.Count++
+
+		nu, err := json.Marshal(c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error marshaling rate limit %s", key)
+		}
+		_, swapped, err := db.db.CmpAndSwap(rateLimitTable, []byte(key), old, nu)
+		switch {
+		case err != nil:
+			return nil, errors.Wrapf(err, "error saving rate limit %s", key)
+		case swapped:
+			return c.toACME(), nil
+		}
+	}
+	return nil, errors.Errorf("error saving rate limit %s; changed since last read", key)
+}
+
+// DeleteExpiredRateLimitCounters deletes the rate limit counters whose window
+// ended before the given time, and returns the number of counters deleted.
+// The counters would be reset by the next operation, so deleting them only
+// removes the entries of the accounts, IPs, and identifiers no longer used.
+func (db *DB) DeleteExpiredRateLimitCounters(_ context.Context, before time.Time) (int, error) {
+	entries, err := db.db.List(rateLimitTable)
+	if err != nil {
+		return 0, errors.Wrap(err, "error listing rate limits")
+	}
+	var deleted int
+	for _, entry := range entries {
+		c := new(dbRateLimitCounter)
+		if err := json.Unmarshal(entry.Value, c); err != nil {
+			return deleted, errors.Wrapf(err, "error unmarshaling rate limit %s", string(entry.Key))
+		}
+		if !c.ExpiresAt.Before(before) {
+			continue
+		}
+		if err := db.db.Del(rateLimitTable, entry.Key); err != nil && !nosql.IsErrNotFound(err) {
+			return deleted, errors.Wrapf(err, "error deleting rate limit %s", string(entry.Key))
+		}
+		deleted++
+	}
+	return deleted, nil
+}
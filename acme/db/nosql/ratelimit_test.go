@@ -0,0 +1,211 @@
+package nosql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/nosql"
+	nosqldb "github.com/smallstep/nosql/database"
+)
+
+func TestDB_IncrementRateLimitCounter(t *testing.T) {
+	key := "provID/new-order/account/accID"
+	now := clock.Now()
+	newCounter := func(count int, expiresAt time.Time) []byte {
+		b, err := json.Marshal(&dbRateLimitCounter{Key: key, Count: count, ExpiresAt: expiresAt})
+		assert.FatalError(t, err)
+		return b
+	}
+	newDB := func(stored []byte, swaps *int) nosql.DB {
+		return &db.MockNoSQLDB{
+			MGet: func(bucket, k []byte) ([]byte, error) {
+				assert.Equals(t, bucket, rateLimitTable)
+				assert.Equals(t, string(k), key)
+				if stored == nil {
+					return nil, nosqldb.ErrNotFound
+				}
+				return stored, nil
+			},
+			MCmpAndSwap: func(bucket, k, old, nu []byte) ([]byte, bool, error) {
+				*swaps++
+				if !bytes.Equal(old, stored) {
+					return stored, false, nil
+				}
+				stored = nu
+				return nu, true, nil
+			},
+		}
+	}
+
+	type test struct {
+		stored    []byte
+		count     int
+		expiresAt time.Time
+		err       error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"ok/new": func(t *testing.T) test {
+			return test{
+				count:     1,
+				expiresAt: now.Add(time.Hour),
+			}
+		},
+		"ok/increment": func(t *testing.T) test {
+			expiresAt := now.Add(30 * time.Minute)
+			return test{
+				stored:    newCounter(4, expiresAt),
+				count:     5,
+				expiresAt: expiresAt,
+			}
+		},
+		"ok/expired": func(t *testing.T) test {
+			return test{
+				stored:    newCounter(4, now.Add(-time.Minute)),
+				count:     1,
+				expiresAt: now.Add(time.Hour),
+			}
+		},
+		"fail/unmarshal": func(t *testing.T) test {
+			return test{
+				stored: []byte("foo"),
+				err:    errors.New("error unmarshaling rate limit provID/new-order/account/accID into dbRateLimitCounter"),
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			var swaps int
+			d := DB{db: newDB(tc.stored, &swaps)}
+			c, err := d.IncrementRateLimitCounter(context.Background(), key, time.Hour)
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, 1, swaps)
+			assert.Equals(t, key, c.Key)
+			assert.Equals(t, tc.count, c.Count)
+			assert.True(t, c.ExpiresAt.Sub(tc.expiresAt).Abs() < time.Second)
+
+			got, err := d.GetRateLimitCounter(context.Background(), key)
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.count, got.Count)
+		})
+	}
+}
+
+func TestDB_IncrementRateLimitCounter_conflict(t *testing.T) {
+	var swaps int
+	d := DB{db: &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, nosqldb.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			swaps++
+			return []byte("{}"), false, nil
+		},
+	}}
+	_, err := d.IncrementRateLimitCounter(context.Background(), "key", time.Hour)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error saving rate limit key; changed since last read", err.Error())
+	}
+	assert.Equals(t, maxRateLimitRetries, swaps)
+
+	c, err := d.GetRateLimitCounter(context.Background(), "key")
+	assert.FatalError(t, err)
+	assert.Equals(t, &acme.RateLimitCounter{Key: "key"}, c)
+}
+
+func TestDB_DeleteExpiredRateLimitCounters(t *testing.T) {
+	now := time.Now()
+	entry := func(t *testing.T, key string, expiresAt time.Time) *nosqldb.Entry {
+		b, err := json.Marshal(&dbRateLimitCounter{Key: key, Count: 1, ExpiresAt: expiresAt})
+		assert.FatalError(t, err)
+		return &nosqldb.Entry{Bucket: rateLimitTable, Key: []byte(key), Value: b}
+	}
+	type test struct {
+		db      nosql.DB
+		deleted int
+		err     error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/db.List-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						assert.Equals(t, bucket, rateLimitTable)
+						return nil, errors.New("force")
+					},
+				},
+				err: errors.New("error listing rate limits: force"),
+			}
+		},
+		"fail/unmarshal-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{{Bucket: rateLimitTable, Key: []byte("k1"), Value: []byte("foo")}}, nil
+					},
+				},
+				err: errors.New("error unmarshaling rate limit k1"),
+			}
+		},
+		"fail/db.Del-error": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{entry(t, "k1", now.Add(-time.Hour))}, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						return errors.New("force")
+					},
+				},
+				err: errors.New("error deleting rate limit k1: force"),
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				db: &db.MockNoSQLDB{
+					MList: func(bucket []byte) ([]*nosqldb.Entry, error) {
+						return []*nosqldb.Entry{
+							entry(t, "prov/new-order/ip/10.0.0.1", now.Add(-time.Hour)),
+							entry(t, "prov/new-order/identifier/example.com", now.Add(time.Hour)),
+							entry(t, "prov/new-order/account/accID", now.Add(-time.Second)),
+						}, nil
+					},
+					MDel: func(bucket, key []byte) error {
+						assert.Equals(t, bucket, rateLimitTable)
+						assert.NotEquals(t, string(key), "prov/new-order/identifier/example.com")
+						return nil
+					},
+				},
+				deleted: 2,
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			d := DB{db: tc.db}
+			deleted, err := d.DeleteExpiredRateLimitCounters(context.Background(), now)
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, deleted, tc.deleted)
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package nosql
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	nosqlDB "github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+// RunTransaction runs the given function with a DB that buffers all the
+// writes, and stores them atomically if the function does not return an
+// error. Reads in the transaction see the buffered writes. The transaction
+// fails without writing anything if any of the entries written was changed
+// since it was read. The verification and the writes are done holding the DB
+// lock, so no other write can happen between them.
+func (db *DB) RunTransaction(_ context.Context, fn func(txDB acme.DB) error) error {
+	// Nested transactions are part of the outer one.
+	if _, ok := db.db.(*txn); ok {
+		return fn(db)
+	}
+
+	tx := &txn{
+		DB:     db.db,
+		mu:     &db.mu,
+		writes: make(map[txnKey]*txnWrite),
+		reads:  make(map[txnKey][]byte),
+	}
+	if err := fn(&DB{db: tx}); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+type txnKey struct {
+	bucket, key string
+}
+
+type txnWrite struct {
+	value   []byte
+	deleted bool
+}
+
+// txn is a nosql.DB that buffers the writes of a transaction. It records the
+// values read from the underlying database before writing an entry, so they
+// can be verified before committing.
+type txn struct {
+	nosqlDB.DB
+	mu     *sync.Mutex
+	order  []txnKey
+	writes map[txnKey]*txnWrite
+	reads  map[txnKey][]byte
+}
+
+// get returns the current value of the entry in the transaction, or nil if it
+// does not exist.
+func (t *txn) get(k txnKey) ([]byte, error) {
+	if w, ok := t.writes[k]; ok {
+		if w.deleted {
+			return nil, nil
+		}
+		return w.value, nil
+	}
+	v, err := t.DB.Get([]byte(k.bucket), []byte(k.key))
+	switch {
+	case nosqlDB.IsErrNotFound(err):
+		v = nil
+	case err != nil:
+		return nil, err
+	}
+	if _, ok := t.reads[k]; !ok {
+		t.reads[k] = v
+	}
+	return v, nil
+}
+
+func (t *txn) write(k txnKey, w *txnWrite) {
+	if _, ok := t.writes[k]; !ok {
+		t.order = append(t.order, k)
+	}
+	t.writes[k] = w
+}
+
+// Get returns the value in the transaction, or the one stored in the
+// underlying database.
+func (t *txn) Get(bucket, key []byte) ([]byte, error) {
+	v, err := t.get(txnKey{string(bucket), string(key)})
+	switch {
+	case err != nil:
+		return nil, err
+	case v == nil:
+		return nil, errors.Wrapf(database.ErrNotFound, "%s/%s not found", bucket, key)
+	default:
+		return v, nil
+	}
+}
+
+// Set buffers the write of the given value.
+func (t *txn) Set(bucket, key, value []byte) error {
+	k := txnKey{string(bucket), string(key)}
+	if _, err := t.get(k); err != nil {
+		return err
+	}
+	t.write(k, &txnWrite{value: value})
+	return nil
+}
+
+// CmpAndSwap buffers the write of the new value if the current value in the
+// transaction is equal to the old value.
+func (t *txn) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	k := txnKey{string(bucket), string(key)}
+	v, err := t.get(k)
+	if err != nil {
+		return nil, false, err
+	}
+	if !bytes.Equal(v, oldValue) {
+		return v, false, nil
+	}
+	if newValue == nil {
+		t.write(k, &txnWrite{deleted: true})
+	} else {
+		t.write(k, &txnWrite{value: newValue})
+	}
+	return newValue, true, nil
+}
+
+// Del buffers the deletion of the given entry.
+func (t *txn) Del(bucket, key []byte) error {
+	k := txnKey{string(bucket), string(key)}
+	if _, err := t.get(k); err != nil {
+		return err
+	}
+	t.write(k, &txnWrite{deleted: true})
+	return nil
+}
+
+// commit verifies that the entries read have not changed, and writes all the
+// buffered entries in a single database transaction.
+func (t *txn) commit() error {
+	if len(t.writes) == 0 {
+		return nil
+	}
+
+	// A single write is verified and written with a compare-and-swap.
+	if len(t.order) == 1 {
+		k := t.order[0]
+		w := t.writes[k]
+		if w.deleted {
+			w.value = nil
+		}
+		_, swapped, err := t.DB.CmpAndSwap([]byte(k.bucket), []byte(k.key), t.reads[k], w.value)
+		switch {
+		case err != nil:
+			return errors.Wrap(err, "error committing acme transaction")
+		case !swapped:
+			return errors.Errorf("error committing acme transaction; %s/%s changed since last read", k.bucket, k.key)
+		default:
+			return nil
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for k, old := range t.reads {
+		if _, ok := t.writes[k]; !ok {
+			continue
+		}
+		v, err := t.DB.Get([]byte(k.bucket), []byte(k.key))
+		switch {
+		case nosqlDB.IsErrNotFound(err):
+			v = nil
+		case err != nil:
+			return errors.Wrap(err, "error verifying acme transaction")
+		}
+		if !bytes.Equal(v, old) {
+			return errors.Errorf("error committing acme transaction; %s/%s changed since last read", k.bucket, k.key)
+		}
+	}
+
+	tx := new(database.Tx)
+	for _, k := range t.order {
+		w := t.writes[k]
+		if w.deleted {
+			tx.Del([]byte(k.bucket), []byte(k.key))
+		} else {
+			tx.Set([]byte(k.bucket), []byte(k.key), w.value)
+		}
+	}
+	if err := t.DB.Update(tx); err != nil {
+		return errors.Wrap(err, "error committing acme transaction")
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package nosql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/db"
+	nosqldb "github.com/smallstep/nosql/database"
+)
+
+// newMapDB returns a MockNoSQLDB backed by the given map that counts the
+// writes done in a transaction or with a compare-and-swap.
+func newMapDB(t *testing.T, data map[string][]byte, updates *int) *db.MockNoSQLDB {
+	return &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if v, ok := data[string(bucket)+"/"+string(key)]; ok {
+				return v, nil
+			}
+			return nil, nosqldb.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			k := string(bucket) + "/" + string(key)
+			if !bytes.Equal(data[k], old) {
+				return data[k], false, nil
+			}
+			*updates++
+			data[k] = nu
+			return nu, true, nil
+		},
+		MUpdate: func(tx *nosqldb.Tx) error {
+			*updates++
+			for _, op := range tx.Operations {
+				switch op.Cmd {
+				case nosqldb.Set:
+					data[string(op.Bucket)+"/"+string(op.Key)] = op.Value
+				case nosqldb.Delete:
+					delete(data, string(op.Bucket)+"/"+string(op.Key))
+				default:
+					t.Errorf("unexpected operation %s", op.Cmd)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func TestDB_RunTransaction(t *testing.T) {
+	dbch := &dbChallenge{ID: "chID", Status: acme.StatusPending, Type: "device-attest-01", Value: "12345678"}
+	chB, err := json.Marshal(dbch)
+	assert.FatalError(t, err)
+	dbaz := &dbAuthz{ID: "azID", Status: acme.StatusPending, ChallengeIDs: []string{"chID"}}
+	azB, err := json.Marshal(dbaz)
+	assert.FatalError(t, err)
+
+	newData := func() map[string][]byte {
+		return map[string][]byte{
+			string(challengeTable) + "/chID": chB,
+			string(authzTable) + "/azID":     azB,
+		}
+	}
+	update := func(ctx context.Context, txDB acme.DB) error {
+		az, err := txDB.GetAuthorization(ctx, "azID")
+		if err != nil {
+			return err
+		}
+		ch := az.Challenges[0]
+		ch.Status = acme.StatusValid
+		az.Fingerprint = "fingerprint"
+		if err := txDB.UpdateAuthorization(ctx, az); err != nil {
+			return err
+		}
+		if err := txDB.UpdateChallenge(ctx, ch); err != nil {
+			return err
+		}
+		// Reads in the transaction see the buffered writes.
+		ch, err = txDB.GetChallenge(ctx, "chID", "azID")
+		if err != nil {
+			return err
+		}
+		if ch.Status != acme.StatusValid {
+			return errors.New("challenge update is not visible in the transaction")
+		}
+		return nil
+	}
+
+	type test struct {
+		data        map[string][]byte
+		fn          func(ctx context.Context, txDB acme.DB) error
+		wantUpdates int
+		wantStatus  acme.Status
+		err         error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"ok": func(t *testing.T) test {
+			return test{
+				data:        newData(),
+				fn:          update,
+				wantUpdates: 1,
+				wantStatus:  acme.StatusValid,
+			}
+		},
+		"ok/no-writes": func(t *testing.T) test {
+			return test{
+				data: newData(),
+				fn: func(ctx context.Context, txDB acme.DB) error {
+					_, err := txDB.GetChallenge(ctx, "chID", "azID")
+					return err
+				},
+				wantStatus: acme.StatusPending,
+			}
+		},
+		"fail/fn-error": func(t *testing.T) test {
+			return test{
+				data: newData(),
+				fn: func(ctx context.Context, txDB acme.DB) error {
+					if err := update(ctx, txDB); err != nil {
+						return err
+					}
+					return errors.New("force")
+				},
+				wantStatus: acme.StatusPending,
+				err:        errors.New("force"),
+			}
+		},
+		"fail/single-write-changed-since-read": func(t *testing.T) test {
+			data := newData()
+			return test{
+				data: data,
+				fn: func(ctx context.Context, txDB acme.DB) error {
+					ch, err := txDB.GetChallenge(ctx, "chID", "azID")
+					if err != nil {
+						return err
+					}
+					ch.Status = acme.StatusValid
+					if err := txDB.UpdateChallenge(ctx, ch); err != nil {
+						return err
+					}
+					// Concurrent update of the challenge.
+					clone := dbch.clone()
+					clone.Status = acme.StatusInvalid
+					b, err := json.Marshal(clone)
+					assert.FatalError(t, err)
+					data[string(challengeTable)+"/chID"] = b
+					return nil
+				},
+				wantStatus: acme.StatusInvalid,
+				err:        errors.New("error committing acme transaction; acme_challenges/chID changed since last read"),
+			}
+		},
+		"fail/changed-since-read": func(t *testing.T) test {
+			data := newData()
+			return test{
+				data: data,
+				fn: func(ctx context.Context, txDB acme.DB) error {
+					if err := update(ctx, txDB); err != nil {
+						return err
+					}
+					// Concurrent update of the challenge.
+					clone := dbch.clone()
+					clone.Status = acme.StatusInvalid
+					b, err := json.Marshal(clone)
+					assert.FatalError(t, err)
+					data[string(challengeTable)+"/chID"] = b
+					return nil
+				},
+				wantStatus: acme.StatusInvalid,
+				err:        errors.New("error committing acme transaction; acme_challenges/chID changed since last read"),
+			}
+		},
+	}
+	for name, run := range tests {
+		tc := run(t)
+		t.Run(name, func(t *testing.T) {
+			var updates int
+			d := DB{db: newMapDB(t, tc.data, &updates)}
+			ctx := context.Background()
+			err := d.RunTransaction(ctx, func(txDB acme.DB) error {
+				return tc.fn(ctx, txDB)
+			})
+			if tc.err != nil {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tc.err.Error(), err.Error())
+				}
+			} else {
+				assert.FatalError(t, err)
+			}
+			assert.Equals(t, tc.wantUpdates, updates)
+
+			ch, err := d.GetChallenge(ctx, "chID", "azID")
+			assert.FatalError(t, err)
+			assert.Equals(t, tc.wantStatus, ch.Status)
+			if tc.wantUpdates > 0 {
+				az, err := d.getDBAuthz(ctx, "azID")
+				assert.FatalError(t, err)
+				assert.Equals(t, "fingerprint", az.Fingerprint)
+			}
+		})
+	}
+}
+
+func TestDB_RunTransaction_concurrentSave(t *testing.T) {
+	dbch := &dbChallenge{ID: "chID", Status: acme.StatusPending, Type: "device-attest-01", Value: "12345678"}
+	chB, err := json.Marshal(dbch)
+	assert.FatalError(t, err)
+	dbaz := &dbAuthz{ID: "azID", Status: acme.StatusPending, ChallengeIDs: []string{"chID"}}
+	azB, err := json.Marshal(dbaz)
+	assert.FatalError(t, err)
+
+	var (
+		mu         sync.Mutex
+		ops        []string
+		committing bool
+		saveErr    = make(chan error, 1)
+	)
+	data := map[string][]byte{
+		string(challengeTable) + "/chID": chB,
+		string(authzTable) + "/azID":     azB,
+	}
+	d := &DB{}
+	d.db = &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			mu.Lock()
+			v, ok := data[string(bucket)+"/"+string(key)]
+			start := committing
+			committing = false
+			mu.Unlock()
+			if start {
+				// Update the challenge outside the transaction while it is
+				// being verified.
+				go func() {
+					ch := &acme.Challenge{ID: "chID", Status: acme.StatusInvalid, Type: "device-attest-01", Value: "12345678"}
+					saveErr <- d.UpdateChallenge(context.Background(), ch)
+				}()
+				time.Sleep(50 * time.Millisecond)
+			}
+			if !ok {
+				return nil, nosqldb.ErrNotFound
+			}
+			return v, nil
+		},
+		MCmpAndSwap: func(bucket, key, old, nu []byte) ([]byte, bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			ops = append(ops, "save")
+			k := string(bucket) + "/" + string(key)
+			if !bytes.Equal(data[k], old) {
+				return data[k], false, nil
+			}
+			data[k] = nu
+			return nu, true, nil
+		},
+		MUpdate: func(tx *nosqldb.Tx) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ops = append(ops, "commit")
+			for _, op := range tx.Operations {
+				data[string(op.Bucket)+"/"+string(op.Key)] = op.Value
+			}
+			return nil
+		},
+	}
+
+	ctx := context.Background()
+	err = d.RunTransaction(ctx, func(txDB acme.DB) error {
+		az, err := txDB.GetAuthorization(ctx, "azID")
+		if err != nil {
+			return err
+		}
+		ch := az.Challenges[0]
+		ch.Status = acme.StatusValid
+		az.Fingerprint = "fingerprint"
+		if err := txDB.UpdateAuthorization(ctx, az); err != nil {
+			return err
+		}
+		if err := txDB.UpdateChallenge(ctx, ch); err != nil {
+			return err
+		}
+		mu.Lock()
+		committing = true
+		mu.Unlock()
+		return nil
+	})
+	assert.FatalError(t, err)
+
+	// The concurrent save waits for the commit and fails.
+	err = <-saveErr
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error saving acme challenge; changed since last read", err.Error())
+	}
+	assert.Equals(t, []string{"commit", "save"}, ops)
+
+	ch, err := d.GetChallenge(ctx, "chID", "azID")
+	assert.FatalError(t, err)
+	assert.Equals(t, acme.StatusValid, ch.Status)
+}
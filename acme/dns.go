@@ -0,0 +1,454 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	defaultDNSTimeout = 10 * time.Second
+	maxDNSMessageSize = 65535
+	maxCNAMEChain     = 8
+)
+
+// DNSResolverOptions are the options used to create a DNSResolver.
+type DNSResolverOptions struct {
+	// Servers is the list of DNS servers used to resolve names. They are tried
+	// in order until one of them returns an answer. Each server can be an IP
+	// address or a host with an optional port, that will be queried using UDP
+	// falling back to TCP, or a URL with one of the following schemes:
+	//
+	//   - udp://host[:port] to use UDP, falling back to TCP.
+	//   - tcp://host[:port] to use TCP.
+	//   - tls://host[:port] to use DNS over TLS (DoT), the default port is 853.
+	//   - https://host[:port]/path to use DNS over HTTPS (DoH).
+	//
+	// If no servers are configured, the system resolver is used.
+	Servers []string
+	// Timeout is the maximum time to wait for the answer of a single query.
+	Timeout time.Duration
+	// Authoritative enables sending the queries directly to the authoritative
+	// name servers of the zone, instead of using a recursive resolver. The
+	// configured servers or the system resolver are only used to find the
+	// name servers.
+	Authoritative bool
+}
+
+// DNSResolver is a DNS resolver used to look up the records required to
+// validate the dns-01 challenge. Unlike the system resolver, it can use
+// explicit recursive resolvers, DNS over TLS, DNS over HTTPS, or query the
+// authoritative name servers of a zone.
+type DNSResolver struct {
+	servers       []dnsServer
+	timeout       time.Duration
+	authoritative bool
+	httpClient    *http.Client
+	// nsPort is the port used to query the authoritative name servers.
+	nsPort string
+}
+
+type dnsServer struct {
+	network string
+	addr    string
+}
+
+// NewDNSResolver creates a new DNSResolver with the given options.
+func NewDNSResolver(opts DNSResolverOptions) (*DNSResolver, error) {
+	if opts.Timeout < 0 {
+		return nil, errors.New("dns timeout cannot be negative")
+	}
+	r := &DNSResolver{
+		timeout:       opts.Timeout,
+		authoritative: opts.Authoritative,
+		httpClient:    &http.Client{},
+		nsPort:        "53",
+	}
+	if r.timeout == 0 {
+		r.timeout = defaultDNSTimeout
+	}
+	for _, s := range opts.Servers {
+		srv, err := parseDNSServer(s)
+		if err != nil {
+			return nil, err
+		}
+		r.servers = append(r.servers, srv)
+	}
+	return r, nil
+}
+
+func parseDNSServer(s string) (dnsServer, error) {
+	network, addr := "udp", s
+	if i := strings.Index(s, "://"); i >= 0 {
+		network, addr = s[:i], s[i+3:]
+	}
+
+	switch network {
+	case "https":
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return dnsServer{}, fmt.Errorf("dns server %q is not a valid URL", s)
+		}
+		return dnsServer{network: network, addr: u.String()}, nil
+	case "udp", "tcp":
+		addr = withDefaultPort(addr, "53")
+	case "tls":
+		addr = withDefaultPort(addr, "853")
+	default:
+		return dnsServer{}, fmt.Errorf("dns server %q uses an unsupported scheme %q", s, network)
+	}
+
+	if host, _, err := net.SplitHostPort(addr); err != nil || host == "" {
+		return dnsServer{}, fmt.Errorf("dns server %q is not a valid address", s)
+	}
+	return dnsServer{network: network, addr: addr}, nil
+}
+
+func withDefaultPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+	}
+	return addr
+}
+
+// LookupTXT returns the DNS TXT records for the given domain name. CNAME
+// records are followed, and the strings of each record are concatenated.
+func (r *DNSResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	answers, err := r.lookup(ctx, name, dnsmessage.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	var txts []string
+	for _, a := range answers {
+		if body, ok := a.Body.(*dnsmessage.TXTResource); ok {
+			txts = append(txts, strings.Join(body.TXT, ""))
+		}
+	}
+	return txts, nil
+}
+
+// lookup returns the answers of the given type for the domain name, following
+// the CNAME records.
+func (r *DNSResolver) lookup(ctx context.Context, name string, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	fqdn := name
+	for i := 0; i < maxCNAMEChain; i++ {
+		servers, recursive := r.recursiveServers(), true
+		if r.authoritative {
+			var err error
+			if servers, err = r.authoritativeServers(ctx, fqdn); err != nil {
+				return nil, err
+			}
+			recursive = false
+		}
+
+		m, err := r.query(ctx, servers, fqdn, qtype, recursive)
+		if err != nil {
+			return nil, err
+		}
+		if m.RCode == dnsmessage.RCodeNameError {
+			return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+
+		var answers []dnsmessage.Resource
+		var cname string
+		for _, a := range m.Answers {
+			switch {
+			case a.Header.Type == qtype:
+				answers = append(answers, a)
+			case a.Header.Type == dnsmessage.TypeCNAME:
+				if body, ok := a.Body.(*dnsmessage.CNAMEResource); ok {
+					cname = body.CNAME.String()
+				}
+			}
+		}
+		if len(answers) > 0 || cname == "" {
+			return answers, nil
+		}
+		fqdn = cname
+	}
+	return nil, fmt.Errorf("too many CNAME records looking up %s", name)
+}
+
+// authoritativeServers returns the addresses of the authoritative name
+// servers of the zone containing the given name.
+func (r *DNSResolver) authoritativeServers(ctx context.Context, name string) ([]dnsServer, error) {
+	nsNames, err := r.lookupZoneNS(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var servers []dnsServer
+	for _, ns := range nsNames {
+		ips, err := r.lookupIP(ctx, ns)
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			servers = append(servers, dnsServer{
+				network: "udp",
+				addr:    net.JoinHostPort(ip.String(), r.nsPort),
+			})
+		}
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no authoritative name servers found for %s", name)
+	}
+	return servers, nil
+}
+
+// lookupZoneNS returns the name servers of the closest zone containing the
+// given name.
+func (r *DNSResolver) lookupZoneNS(ctx context.Context, name string) ([]string, error) {
+	for n := strings.TrimSuffix(name, "."); n != ""; {
+		if ns := r.lookupNS(ctx, n); len(ns) > 0 {
+			return ns, nil
+		}
+		_, parent, ok := strings.Cut(n, ".")
+		if !ok {
+			break
+		}
+		n = parent
+	}
+	return nil, fmt.Errorf("no name servers found for %s", name)
+}
+
+func (r *DNSResolver) lookupNS(ctx context.Context, name string) []string {
+	var names []string
+	if len(r.servers) == 0 {
+		ns, _ := net.DefaultResolver.LookupNS(ctx, name)
+		for _, n := range ns {
+			names = append(names, n.Host)
+		}
+		return names
+	}
+
+	m, err := r.query(ctx, r.servers, name, dnsmessage.TypeNS, true)
+	if err != nil {
+		return nil
+	}
+	for _, a := range m.Answers {
+		if body, ok := a.Body.(*dnsmessage.NSResource); ok && equalDNSNames(a.Header.Name.String(), name) {
+			names = append(names, body.NS.String())
+		}
+	}
+	return names
+}
+
+func (r *DNSResolver) lookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if len(r.servers) == 0 {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		ips := make([]net.IP, len(addrs))
+		for i, a := range addrs {
+			ips[i] = a.IP
+		}
+		return ips, nil
+	}
+
+	var ips []net.IP
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		m, err := r.query(ctx, r.servers, host, qtype, true)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range m.Answers {
+			switch body := a.Body.(type) {
+			case *dnsmessage.AResource:
+				ips = append(ips, net.IP(body.A[:]))
+			case *dnsmessage.AAAAResource:
+				ips = append(ips, net.IP(body.AAAA[:]))
+			}
+		}
+	}
+	return ips, nil
+}
+
+// query sends the query to the given servers in order, and returns the first
+// response that is not a server failure.
+func (r *DNSResolver) query(ctx context.Context, servers []dnsServer, name string, qtype dnsmessage.Type, recursive bool) (*dnsmessage.Message, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dns query for %s: %w", name, err)
+	}
+
+	var errs []error
+	for _, srv := range servers {
+		m, err := r.queryServer(ctx, srv, qname, qtype, recursive)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		switch m.RCode {
+		case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+			return m, nil
+		default:
+			errs = append(errs, fmt.Errorf("dns server %s returned %s", srv.addr, m.RCode))
+		}
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no dns servers available to look up %s", name)
+	}
+	return nil, fmt.Errorf("error looking up %s: %w", name, errors.Join(errs...))
+}
+
+func (r *DNSResolver) queryServer(ctx context.Context, srv dnsServer, qname dnsmessage.Name, qtype dnsmessage.Type, recursive bool) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	// DNS over HTTPS should use the id 0 to be cache friendly.
+	var id uint16
+	if srv.network != "https" {
+		var b [2]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return nil, err
+		}
+		id = binary.BigEndian.Uint16(b[:])
+	}
+
+	q := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: recursive},
+		Questions: []dnsmessage.Question{
+			{Name: qname, Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+	b, err := q.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("error packing dns query: %w", err)
+	}
+
+	network := srv.network
+	for {
+		resp, err := r.exchange(ctx, network, srv.addr, b)
+		if err != nil {
+			return nil, fmt.Errorf("error querying dns server %s: %w", srv.addr, err)
+		}
+		m := new(dnsmessage.Message)
+		if err := m.Unpack(resp); err != nil {
+			return nil, fmt.Errorf("error parsing response of dns server %s: %w", srv.addr, err)
+		}
+		if m.ID != id {
+			return nil, fmt.Errorf("dns server %s returned an unexpected id", srv.addr)
+		}
+		// Retry truncated UDP responses using TCP.
+		if m.Truncated && network == "udp" {
+			network = "tcp"
+			continue
+		}
+		return m, nil
+	}
+}
+
+func (r *DNSResolver) exchange(ctx context.Context, network, addr string, msg []byte) ([]byte, error) {
+	switch network {
+	case "https":
+		return r.exchangeHTTPS(ctx, addr, msg)
+	case "udp":
+		return exchangeUDP(ctx, addr, msg)
+	default:
+		return exchangeStream(ctx, network, addr, msg)
+	}
+}
+
+func exchangeUDP(ctx context.Context, addr string, msg []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	b := make([]byte, maxDNSMessageSize)
+	n, err := conn.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+// exchangeStream sends the message using TCP or TLS, where messages are
+// prefixed by their two bytes length.
+func exchangeStream(ctx context.Context, network, addr string, msg []byte) ([]byte, error) {
+	var conn net.Conn
+	var err error
+	if network == "tls" {
+		host, _, _ := net.SplitHostPort(addr)
+		d := &tls.Dialer{Config: &tls.Config{
+			ServerName: host,
+			MinVersion: tls.VersionTLS12,
+		}}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	b := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(b, uint16(len(msg)))
+	copy(b[2:], msg)
+	if _, err := conn.Write(b); err != nil {
+		return nil, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// exchangeHTTPS sends the message using DNS over HTTPS as defined in RFC
+// 8484.
+func (r *DNSResolver) exchangeHTTPS(ctx context.Context, u string, msg []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDNSMessageSize))
+}
+
+func equalDNSNames(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
@@ -0,0 +1,272 @@
+package acme
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type testDNSHandler func(q dnsmessage.Question, recursive bool) (dnsmessage.RCode, []dnsmessage.Resource)
+
+func testDNSResponse(t *testing.T, req []byte, h testDNSHandler, truncate bool) []byte {
+	t.Helper()
+	var m dnsmessage.Message
+	require.NoError(t, m.Unpack(req))
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               m.ID,
+			Response:         true,
+			RecursionDesired: m.RecursionDesired,
+			Truncated:        truncate,
+		},
+		Questions: m.Questions,
+	}
+	if !truncate {
+		resp.RCode, resp.Answers = h(m.Questions[0], m.RecursionDesired)
+	}
+	b, err := resp.Pack()
+	require.NoError(t, err)
+	return b
+}
+
+// startTestDNSServer starts a DNS server listening on the same UDP and TCP
+// port and returns its address.
+func startTestDNSServer(t *testing.T, h testDNSHandler, truncateUDP bool) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		b := make([]byte, maxDNSMessageSize)
+		for {
+			n, addr, err := pc.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(testDNSResponse(t, b[:n], h, truncateUDP), addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err == nil {
+				req := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, req); err == nil {
+					resp := testDNSResponse(t, req, h, false)
+					binary.BigEndian.PutUint16(length[:], uint16(len(resp)))
+					conn.Write(append(length[:], resp...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func testResource(t *testing.T, name string, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	t.Helper()
+	n, err := dnsmessage.NewName(name)
+	require.NoError(t, err)
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: n, Class: dnsmessage.ClassINET, TTL: 60},
+		Body:   body,
+	}
+}
+
+func mustDNSName(t *testing.T, name string) dnsmessage.Name {
+	t.Helper()
+	n, err := dnsmessage.NewName(name)
+	require.NoError(t, err)
+	return n
+}
+
+func TestNewDNSResolver(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        DNSResolverOptions
+		wantServers []dnsServer
+		wantErr     bool
+	}{
+		{"ok empty", DNSResolverOptions{}, nil, false},
+		{"ok", DNSResolverOptions{Servers: []string{
+			"10.0.0.53", "10.0.0.53:5353", "[2001:db8::53]", "udp://dns.example.com", "tcp://dns.example.com",
+			"tls://dns.example.com", "tls://dns.example.com:8853", "https://dns.example.com/dns-query",
+		}}, []dnsServer{
+			{"udp", "10.0.0.53:53"}, {"udp", "10.0.0.53:5353"}, {"udp", "[2001:db8::53]:53"},
+			{"udp", "dns.example.com:53"}, {"tcp", "dns.example.com:53"}, {"tls", "dns.example.com:853"},
+			{"tls", "dns.example.com:8853"}, {"https", "https://dns.example.com/dns-query"},
+		}, false},
+		{"fail scheme", DNSResolverOptions{Servers: []string{"quic://dns.example.com"}}, nil, true},
+		{"fail https", DNSResolverOptions{Servers: []string{"https:///dns-query"}}, nil, true},
+		{"fail address", DNSResolverOptions{Servers: []string{"tcp://:53"}}, nil, true},
+		{"fail timeout", DNSResolverOptions{Timeout: -time.Second}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewDNSResolver(tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantServers, r.servers)
+			assert.Equal(t, defaultDNSTimeout, r.timeout)
+		})
+	}
+}
+
+func TestDNSResolver_LookupTXT(t *testing.T) {
+	records := func(t *testing.T) testDNSHandler {
+		return func(q dnsmessage.Question, recursive bool) (dnsmessage.RCode, []dnsmessage.Resource) {
+			assert.True(t, recursive)
+			switch {
+			case q.Type != dnsmessage.TypeTXT:
+				return dnsmessage.RCodeSuccess, nil
+			case q.Name.String() == "_acme-challenge.example.com.":
+				return dnsmessage.RCodeSuccess, []dnsmessage.Resource{
+					testResource(t, q.Name.String(), &dnsmessage.TXTResource{TXT: []string{"foo"}}),
+					testResource(t, q.Name.String(), &dnsmessage.TXTResource{TXT: []string{"ba", "r"}}),
+				}
+			case q.Name.String() == "_acme-challenge.alias.example.com.":
+				return dnsmessage.RCodeSuccess, []dnsmessage.Resource{
+					testResource(t, q.Name.String(), &dnsmessage.CNAMEResource{CNAME: mustDNSName(t, "_acme-challenge.example.com.")}),
+				}
+			default:
+				return dnsmessage.RCodeNameError, nil
+			}
+		}
+	}
+	serverFailure := func(q dnsmessage.Question, recursive bool) (dnsmessage.RCode, []dnsmessage.Resource) {
+		return dnsmessage.RCodeServerFailure, nil
+	}
+
+	tests := []struct {
+		name    string
+		servers func(t *testing.T) []string
+		lookup  string
+		want    []string
+		wantErr bool
+	}{
+		{"ok udp", func(t *testing.T) []string {
+			return []string{startTestDNSServer(t, records(t), false)}
+		}, "_acme-challenge.example.com", []string{"foo", "bar"}, false},
+		{"ok tcp", func(t *testing.T) []string {
+			return []string{"tcp://" + startTestDNSServer(t, records(t), false)}
+		}, "_acme-challenge.example.com", []string{"foo", "bar"}, false},
+		{"ok truncated", func(t *testing.T) []string {
+			return []string{startTestDNSServer(t, records(t), true)}
+		}, "_acme-challenge.example.com", []string{"foo", "bar"}, false},
+		{"ok cname", func(t *testing.T) []string {
+			return []string{startTestDNSServer(t, records(t), false)}
+		}, "_acme-challenge.alias.example.com", []string{"foo", "bar"}, false},
+		{"ok failover", func(t *testing.T) []string {
+			return []string{startTestDNSServer(t, serverFailure, false), startTestDNSServer(t, records(t), false)}
+		}, "_acme-challenge.example.com", []string{"foo", "bar"}, false},
+		{"fail not found", func(t *testing.T) []string {
+			return []string{startTestDNSServer(t, records(t), false)}
+		}, "_acme-challenge.missing.example.com", nil, true},
+		{"fail server failure", func(t *testing.T) []string {
+			return []string{startTestDNSServer(t, serverFailure, false)}
+		}, "_acme-challenge.example.com", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewDNSResolver(DNSResolverOptions{Servers: tt.servers(t), Timeout: 5 * time.Second})
+			require.NoError(t, err)
+			got, err := r.LookupTXT(context.Background(), tt.lookup)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDNSResolver_LookupTXT_https(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/dns-message", r.Header.Get("Content-Type"))
+		req, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(testDNSResponse(t, req, func(q dnsmessage.Question, recursive bool) (dnsmessage.RCode, []dnsmessage.Resource) {
+			return dnsmessage.RCodeSuccess, []dnsmessage.Resource{
+				testResource(t, q.Name.String(), &dnsmessage.TXTResource{TXT: []string{"foo"}}),
+			}
+		}, false))
+	}))
+	defer srv.Close()
+
+	r, err := NewDNSResolver(DNSResolverOptions{Servers: []string{srv.URL + "/dns-query"}})
+	require.NoError(t, err)
+	r.httpClient = srv.Client()
+
+	got, err := r.LookupTXT(context.Background(), "_acme-challenge.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, got)
+}
+
+func TestDNSResolver_LookupTXT_authoritative(t *testing.T) {
+	// The authoritative server must not receive recursive queries.
+	authoritative := startTestDNSServer(t, func(q dnsmessage.Question, recursive bool) (dnsmessage.RCode, []dnsmessage.Resource) {
+		assert.False(t, recursive)
+		if q.Type == dnsmessage.TypeTXT && q.Name.String() == "_acme-challenge.example.com." {
+			return dnsmessage.RCodeSuccess, []dnsmessage.Resource{
+				testResource(t, q.Name.String(), &dnsmessage.TXTResource{TXT: []string{"authoritative"}}),
+			}
+		}
+		return dnsmessage.RCodeNameError, nil
+	}, false)
+	_, nsPort, err := net.SplitHostPort(authoritative)
+	require.NoError(t, err)
+
+	// The recursive server returns a stale view of the record.
+	recursive := startTestDNSServer(t, func(q dnsmessage.Question, recursive bool) (dnsmessage.RCode, []dnsmessage.Resource) {
+		switch {
+		case q.Type == dnsmessage.TypeNS && q.Name.String() == "example.com.":
+			return dnsmessage.RCodeSuccess, []dnsmessage.Resource{
+				testResource(t, q.Name.String(), &dnsmessage.NSResource{NS: mustDNSName(t, "ns.example.com.")}),
+			}
+		case q.Type == dnsmessage.TypeA && q.Name.String() == "ns.example.com.":
+			return dnsmessage.RCodeSuccess, []dnsmessage.Resource{
+				testResource(t, q.Name.String(), &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}}),
+			}
+		case q.Type == dnsmessage.TypeTXT:
+			return dnsmessage.RCodeSuccess, []dnsmessage.Resource{
+				testResource(t, q.Name.String(), &dnsmessage.TXTResource{TXT: []string{"recursive"}}),
+			}
+		default:
+			return dnsmessage.RCodeSuccess, nil
+		}
+	}, false)
+
+	r, err := NewDNSResolver(DNSResolverOptions{Servers: []string{recursive}, Authoritative: true})
+	require.NoError(t, err)
+	r.nsPort = nsPort
+
+	got, err := r.LookupTXT(context.Background(), "_acme-challenge.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"authoritative"}, got)
+
+	_, err = r.LookupTXT(context.Background(), "_acme-challenge.example.org")
+	assert.ErrorContains(t, err, "no name servers found")
+}
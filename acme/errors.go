@@ -3,7 +3,10 @@ package acme
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/api/render"
@@ -65,6 +68,8 @@ const (
 	ErrorUserActionRequiredType
 	// ErrorNotImplementedType operation is not implemented
 	ErrorNotImplementedType
+	// ErrorAlreadyReplacedType request specified a certificate to be replaced that has already been replaced
+	ErrorAlreadyReplacedType
 )
 
 // String returns the string representation of the acme problem type,
@@ -97,8 +102,10 @@ func (ap ProblemType) String() string {
 		return "dns"
 	case ErrorExternalAccountRequiredType:
 		return "externalAccountRequired"
-	case ErrorInvalidContactType:
+	case ErrorIncorrectResponseType:
 		return "incorrectResponse"
+	case ErrorInvalidContactType:
+		return "invalidContact"
 	case ErrorMalformedType:
 		return "malformed"
 	case ErrorOrderNotReadyType:
@@ -121,6 +128,8 @@ func (ap ProblemType) String() string {
 		return "userActionRequired"
 	case ErrorNotImplementedType:
 		return "notImplemented"
+	case ErrorAlreadyReplacedType:
+		return "alreadyReplaced"
 	default:
 		return fmt.Sprintf("unsupported type ACME error type '%d'", int(ap))
 	}
@@ -241,6 +250,11 @@ var (
 			details: "The requested operation is not implemented",
 			status:  501,
 		},
+		ErrorAlreadyReplacedType: {
+			typ:     officialACMEPrefix + ErrorAlreadyReplacedType.String(),
+			details: "Certificate already replaced",
+			status:  409,
+		},
 		ErrorTLSType: {
 			typ:     officialACMEPrefix + ErrorTLSType.String(),
 			details: "The server received a TLS error during validation",
@@ -277,6 +291,9 @@ type Error struct {
 	Subproblems []Subproblem `json:"subproblems,omitempty"`
 	Err         error        `json:"-"`
 	Status      int          `json:"-"`
+	// RetryAfter is the time the client should wait before retrying the
+	// request, it is sent in the Retry-After header if it is set.
+	RetryAfter time.Duration `json:"-"`
 }
 
 // Subproblem represents an ACME subproblem. It's fairly
@@ -425,6 +442,9 @@ func (e *Error) ToLog() (interface{}, error) {
 
 // Render implements render.RenderableError for Error.
 func (e *Error) Render(w http.ResponseWriter) {
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	}
 	w.Header().Set("Content-Type", "application/problem+json")
 	render.JSONStatus(w, e, e.StatusCode())
 }
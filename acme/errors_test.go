@@ -52,3 +52,20 @@ func TestError_WithAdditionalErrorDetail(t *testing.T) {
 		})
 	}
 }
+
+func TestProblemType_String(t *testing.T) {
+	tests := []struct {
+		typ  ProblemType
+		want string
+	}{
+		{ErrorIncorrectResponseType, "incorrectResponse"},
+		{ErrorInvalidContactType, "invalidContact"},
+		{ErrorMalformedType, "malformed"},
+		{ErrorServerInternalType, "serverInternal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.typ.String())
+		})
+	}
+}
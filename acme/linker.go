@@ -46,6 +46,8 @@ const (
 	RevokeCertLinkType
 	// KeyChangeLinkType key rollover
 	KeyChangeLinkType
+	// RenewalInfoLinkType renewal information
+	RenewalInfoLinkType
 )
 
 func (l LinkType) String() string {
@@ -74,6 +76,8 @@ func (l LinkType) String() string {
 		return "revoke-cert"
 	case KeyChangeLinkType:
 		return "key-change"
+	case RenewalInfoLinkType:
+		return "renewal-info"
 	default:
 		return fmt.Sprintf("unexpected LinkType '%d'", int(l))
 	}
@@ -91,13 +95,31 @@ func GetUnescapedPathSuffix(typ LinkType, provisionerName string, inputs ...stri
 		return fmt.Sprintf("/%s/%s/%s/orders", provisionerName, AccountLinkType, inputs[0])
 	case FinalizeLinkType:
 		return fmt.Sprintf("/%s/%s/%s/finalize", provisionerName, OrderLinkType, inputs[0])
+	case RenewalInfoLinkType:
+		if len(inputs) == 0 {
+			return fmt.Sprintf("/%s/%s", provisionerName, typ)
+		}
+		return fmt.Sprintf("/%s/%s/%s", provisionerName, typ, inputs[0])
 	default:
 		return ""
 	}
 }
 
+// LinkerOption is the type of options passed to the NewLinker constructor.
+type LinkerOption func(l *linker)
+
+// WithBaseURL sets the base URL used to build the ACME links. If the scheme or
+// host of the base URL are empty, they will be derived from the request, and
+// the path will be prepended to the prefix of all links. It allows the CA to
+// run behind a reverse proxy that rewrites the path.
+func WithBaseURL(u *url.URL) LinkerOption {
+	return func(l *linker) {
+		l.baseURL = u
+	}
+}
+
 // NewLinker returns a new Directory type.
-func NewLinker(dns, prefix string) Linker {
+func NewLinker(dns, prefix string, opts ...LinkerOption) Linker {
 	_, _, err := net.SplitHostPort(dns)
 	if err != nil && strings.Contains(err.Error(), "too many colons in address") {
 		// this is most probably an IPv6 without brackets, e.g. ::1, 2001:0db8:85a3:0000:0000:8a2e:0370:7334
@@ -112,7 +134,11 @@ func NewLinker(dns, prefix string) Linker {
 			dns = "[" + dns + "]"
 		}
 	}
-	return &linker{prefix: prefix, dns: dns}
+	l := &linker{prefix: prefix, dns: dns}
+	for _, fn := range opts {
+		fn(l)
+	}
+	return l
 }
 
 // Linker interface for generating links for ACME resources.
@@ -168,8 +194,9 @@ func baseURLFromContext(ctx context.Context) *url.URL {
 
 // linker generates ACME links.
 type linker struct {
-	prefix string
-	dns    string
+	prefix  string
+	dns     string
+	baseURL *url.URL
 }
 
 // Middleware gets the provisioner and current url from the request and sets
@@ -215,6 +242,18 @@ func (l *linker) GetLink(ctx context.Context, typ LinkType, inputs ...string) st
 	if baseURL := baseURLFromContext(ctx); baseURL != nil {
 		u = *baseURL
 	}
+	var pathPrefix string
+	if l.baseURL != nil {
+		if l.baseURL.Scheme != "" {
+			u.Scheme = l.baseURL.Scheme
+		}
+		if l.baseURL.Host != "" {
+			u.Host = l.baseURL.Host
+		}
+		if p := strings.TrimSuffix(l.baseURL.Path, "/"); p != "" {
+			pathPrefix = p + "/"
+		}
+	}
 	if u.Scheme == "" {
 		u.Scheme = "https"
 	}
@@ -222,7 +261,7 @@ func (l *linker) GetLink(ctx context.Context, typ LinkType, inputs ...string) st
 		u.Host = l.dns
 	}
 
-	u.Path = l.prefix + GetUnescapedPathSuffix(typ, name, inputs...)
+	u.Path = pathPrefix + strings.TrimPrefix(l.prefix, "/") + GetUnescapedPathSuffix(typ, name, inputs...)
 	return u.String()
 }
 
@@ -39,6 +39,8 @@ func TestGetUnescapedPathSuffix(t *testing.T) {
 	assert.Equals(t, getPath(NewAccountLinkType, "{provisionerID}"), "/{provisionerID}/new-account")
 	assert.Equals(t, getPath(AccountLinkType, "{provisionerID}", "{accID}"), "/{provisionerID}/account/{accID}")
 	assert.Equals(t, getPath(KeyChangeLinkType, "{provisionerID}"), "/{provisionerID}/key-change")
+	assert.Equals(t, getPath(RenewalInfoLinkType, "{provisionerID}"), "/{provisionerID}/renewal-info")
+	assert.Equals(t, getPath(RenewalInfoLinkType, "{provisionerID}", "{certID}"), "/{provisionerID}/renewal-info/{certID}")
 	assert.Equals(t, getPath(NewOrderLinkType, "{provisionerID}"), "/{provisionerID}/new-order")
 	assert.Equals(t, getPath(OrderLinkType, "{provisionerID}", "{ordID}"), "/{provisionerID}/order/{ordID}")
 	assert.Equals(t, getPath(OrdersByAccountLinkType, "{provisionerID}", "{accID}"), "/{provisionerID}/account/{accID}/orders")
@@ -172,12 +174,36 @@ func TestLinker_GetLink(t *testing.T) {
 	assert.Equals(t, linker.GetLink(ctx, RevokeCertLinkType, id), fmt.Sprintf("%s/acme/%s/revoke-cert", baseURL, escProvName))
 
 	assert.Equals(t, linker.GetLink(ctx, KeyChangeLinkType), fmt.Sprintf("%s/acme/%s/key-change", baseURL, escProvName))
+	assert.Equals(t, linker.GetLink(ctx, RenewalInfoLinkType), fmt.Sprintf("%s/acme/%s/renewal-info", baseURL, escProvName))
 
 	assert.Equals(t, linker.GetLink(ctx, ChallengeLinkType, id, id), fmt.Sprintf("%s/acme/%s/challenge/%s/%s", baseURL, escProvName, id, id))
 
 	assert.Equals(t, linker.GetLink(ctx, CertificateLinkType, id), fmt.Sprintf("%s/acme/%s/certificate/1234", baseURL, escProvName))
 }
 
+func TestLinker_GetLink_withBaseURL(t *testing.T) {
+	prov := mockProvisioner(t)
+	escProvName := url.PathEscape(prov.GetName())
+	requestURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
+	ctx := NewProvisionerContext(context.Background(), prov)
+	ctx = context.WithValue(ctx, baseURLKey{}, requestURL)
+
+	// Full external url
+	linker := NewLinker("ca.smallstep.com", "acme", WithBaseURL(&url.URL{Scheme: "http", Host: "proxy.smallstep.com", Path: "/ca/"}))
+	assert.Equals(t, linker.GetLink(ctx, DirectoryLinkType), fmt.Sprintf("http://proxy.smallstep.com/ca/acme/%s/directory", escProvName))
+	assert.Equals(t, linker.GetLink(ctx, ChallengeLinkType, "1234", "5678"), fmt.Sprintf("http://proxy.smallstep.com/ca/acme/%s/challenge/1234/5678", escProvName))
+	assert.Equals(t, linker.GetLink(context.Background(), NewNonceLinkType), "http://proxy.smallstep.com/ca/acme//new-nonce")
+
+	// Only the path prefix, the host comes from the request
+	linker = NewLinker("ca.smallstep.com", "acme", WithBaseURL(&url.URL{Path: "/ca"}))
+	assert.Equals(t, linker.GetLink(ctx, DirectoryLinkType), fmt.Sprintf("https://test.ca.smallstep.com/ca/acme/%s/directory", escProvName))
+	assert.Equals(t, linker.GetLink(context.Background(), DirectoryLinkType), "https://ca.smallstep.com/ca/acme//directory")
+
+	// Nil base url
+	linker = NewLinker("ca.smallstep.com", "acme", WithBaseURL(nil))
+	assert.Equals(t, linker.GetLink(ctx, DirectoryLinkType), fmt.Sprintf("https://test.ca.smallstep.com/acme/%s/directory", escProvName))
+}
+
 func TestLinker_LinkOrder(t *testing.T) {
 	baseURL := &url.URL{Scheme: "https", Host: "test.ca.smallstep.com"}
 	prov := mockProvisioner(t)
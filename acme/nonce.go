@@ -1,5 +1,20 @@
 package acme
 
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+)
+
 // Nonce represents an ACME nonce type.
 type Nonce string
 
@@ -7,3 +22,260 @@ type Nonce string
 func (n Nonce) String() string {
 	return string(n)
 }
+
+const (
+	// defaultNonceTTL is the default time a nonce can be used.
+	defaultNonceTTL = time.Hour
+	// defaultNonceCleanupInterval is the default time between two deletions of
+	// the expired nonces.
+	defaultNonceCleanupInterval = time.Minute
+	// nonceShards is the number of shards used to keep the used nonces in
+	// memory.
+	nonceShards = 64
+	// nonceKeySize is the size of the key used to sign the nonces.
+	nonceKeySize = 32
+	// nonceSize is the size of a decoded nonce: an 8 bytes expiration, 16
+	// random bytes, and a 16 bytes HMAC.
+	nonceSize = 8 + 16 + 16
+)
+
+// NonceBackend is the type of storage used for the replay nonces.
+type NonceBackend string
+
+const (
+	// NonceBackendDB stores the nonces in the ACME database.
+	NonceBackendDB NonceBackend = "db"
+	// NonceBackendMemory creates stateless nonces signed with an HMAC key, and
+	// keeps the used nonces in memory until they expire. The key is generated
+	// on each start, so the backend cannot be shared by several CA instances,
+	// and the nonces created before a restart or a reload are rejected.
+	NonceBackendMemory NonceBackend = "memory"
+)
+
+// NonceService is the interface used to create and consume the replay nonces.
+// The DB interface implements it.
+type NonceService interface {
+	CreateNonce(ctx context.Context) (Nonce, error)
+	DeleteNonce(ctx context.Context, nonce Nonce) error
+}
+
+type nonceServiceKey struct{}
+
+// NewNonceServiceContext adds the given nonce service to the context.
+func NewNonceServiceContext(ctx context.Context, s NonceService) context.Context {
+	return context.WithValue(ctx, nonceServiceKey{}, s)
+}
+
+// NonceServiceFromContext returns the nonce service from the given context.
+func NonceServiceFromContext(ctx context.Context) (s NonceService, ok bool) {
+	s, ok = ctx.Value(nonceServiceKey{}).(NonceService)
+	return
+}
+
+// MustNonceServiceFromContext returns the nonce service from the given
+// context. If the context does not contain one, the database is used.
+func MustNonceServiceFromContext(ctx context.Context) NonceService {
+	if s, ok := NonceServiceFromContext(ctx); ok {
+		return s
+	}
+	return MustDatabaseFromContext(ctx)
+}
+
+// NonceOptions are the options used to create a NonceStore.
+type NonceOptions struct {
+	// Backend is the storage used for the nonces. Defaults to the database.
+	Backend NonceBackend
+	// TTL is the time a nonce can be used. Defaults to 1 hour.
+	TTL time.Duration
+	// CleanupInterval is the time between two deletions of the expired nonces.
+	// Defaults to 1 minute.
+	CleanupInterval time.Duration
+}
+
+// nonceCleaner is the interface implemented by the databases that can delete
+// the nonces created before a given time.
+type nonceCleaner interface {
+	DeleteExpiredNonces(ctx context.Context, before time.Time) (int, error)
+}
+
+// NonceStore creates and consumes the replay nonces, removing the expired
+// nonces in the background.
+type NonceStore struct {
+	service NonceService
+	cleanup func(now time.Time) error
+	done    chan struct{}
+	wg      sync.WaitGroup
+	stopped sync.Once
+}
+
+// NewNonceStore creates a NonceStore using the given options, and starts the
+// cleanup of the expired nonces. The database is only used by the db backend,
+// and the expired nonces are only deleted if it implements a
+// DeleteExpiredNonces method.
+func NewNonceStore(db DB, opts NonceOptions) (*NonceStore, error) {
+	if opts.TTL < 0 || opts.CleanupInterval < 0 {
+		return nil, errors.New("nonce ttl and cleanup interval cannot be negative")
+	}
+	if opts.TTL == 0 {
+		opts.TTL = defaultNonceTTL
+	}
+	if opts.CleanupInterval == 0 {
+		opts.CleanupInterval = defaultNonceCleanupInterval
+	}
+
+	s := &NonceStore{
+		done: make(chan struct{}),
+	}
+	switch opts.Backend {
+	case "", NonceBackendDB:
+		if db == nil {
+			return nil, errors.New("nonce backend db requires a database")
+		}
+		s.service = db
+		if c, ok := db.(nonceCleaner); ok {
+			s.cleanup = func(now time.Time) error {
+				_, err := c.DeleteExpiredNonces(context.Background(), now.Add(-opts.TTL))
+				return err
+			}
+		}
+	case NonceBackendMemory:
+		m, err := newMemoryNonces(opts.TTL)
+		if err != nil {
+			return nil, err
+		}
+		s.service = m
+		s.cleanup = func(now time.Time) error {
+			m.deleteExpired(now)
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("nonce backend %q is not supported", opts.Backend)
+	}
+
+	if s.cleanup != nil {
+		s.wg.Add(1)
+		go s.run(opts.CleanupInterval)
+	}
+	return s, nil
+}
+
+// CreateNonce creates a new nonce.
+func (s *NonceStore) CreateNonce(ctx context.Context) (Nonce, error) {
+	return s.service.CreateNonce(ctx)
+}
+
+// DeleteNonce consumes the given nonce, it returns a badNonce error if the
+// nonce is not valid or it has already been used.
+func (s *NonceStore) DeleteNonce(ctx context.Context, nonce Nonce) error {
+	return s.service.DeleteNonce(ctx, nonce)
+}
+
+// Stop stops the cleanup of the expired nonces.
+func (s *NonceStore) Stop() {
+	s.stopped.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+	})
+}
+
+func (s *NonceStore) run(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.cleanup(clock.Now()); err != nil {
+				log.Printf("error deleting expired nonces: %v", err)
+			}
+		}
+	}
+}
+
+// memoryNonces creates nonces containing their expiration time, signed with
+// an HMAC key, so they do not need to be stored. The nonces used are kept in
+// memory until they expire to prevent their reuse. The key is never shared or
+// persisted: a nonce used in an instance that does not know about it could be
+// replayed.
+type memoryNonces struct {
+	key    []byte
+	ttl    time.Duration
+	shards [nonceShards]nonceShard
+}
+
+type nonceShard struct {
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+func newMemoryNonces(ttl time.Duration) (*memoryNonces, error) {
+	key := make([]byte, nonceKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error generating nonce key: %w", err)
+	}
+	m := &memoryNonces{key: key, ttl: ttl}
+	for i := range m.shards {
+		m.shards[i].used = make(map[string]time.Time)
+	}
+	return m, nil
+}
+
+func (m *memoryNonces) sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write(data)
+	return mac.Sum(nil)[:16]
+}
+
+func (m *memoryNonces) CreateNonce(context.Context) (Nonce, error) {
+	b := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(b, uint64(clock.Now().Add(m.ttl).UnixNano()))
+	if _, err := rand.Read(b[8:24]); err != nil {
+		return "", WrapErrorISE(err, "error generating nonce")
+	}
+	copy(b[24:], m.sign(b[:24]))
+	return Nonce(base64.RawURLEncoding.EncodeToString(b)), nil
+}
+
+func (m *memoryNonces) DeleteNonce(_ context.Context, nonce Nonce) error {
+	b, err := base64.RawURLEncoding.DecodeString(string(nonce))
+	if err != nil || len(b) != nonceSize || !hmac.Equal(b[24:], m.sign(b[:24])) {
+		return NewError(ErrorBadNonceType, "nonce %s not found", string(nonce))
+	}
+	now := clock.Now()
+	expiresAt := time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+	if !now.Before(expiresAt) {
+		return NewError(ErrorBadNonceType, "nonce %s has expired", string(nonce))
+	}
+
+	shard := m.shard(string(nonce))
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, ok := shard.used[string(nonce)]; ok {
+		return NewError(ErrorBadNonceType, "nonce %s not found", string(nonce))
+	}
+	shard.used[string(nonce)] = expiresAt
+	return nil
+}
+
+func (m *memoryNonces) shard(nonce string) *nonceShard {
+	h := fnv.New32a()
+	h.Write([]byte(nonce))
+	return &m.shards[h.Sum32()%nonceShards]
+}
+
+// deleteExpired removes the used nonces that have expired, they will be
+// rejected because of their expiration time.
+func (m *memoryNonces) deleteExpired(now time.Time) {
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mu.Lock()
+		for nonce, expiresAt := range shard.used {
+			if !now.Before(expiresAt) {
+				delete(shard.used, nonce)
+			}
+		}
+		shard.mu.Unlock()
+	}
+}
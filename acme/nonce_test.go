@@ -0,0 +1,160 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nonceCleanerDB struct {
+	MockDB
+	mu     sync.Mutex
+	before []time.Time
+}
+
+func (db *nonceCleanerDB) DeleteExpiredNonces(_ context.Context, before time.Time) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.before = append(db.before, before)
+	return 1, nil
+}
+
+func (db *nonceCleanerDB) calls() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return len(db.before)
+}
+
+func assertBadNonce(t *testing.T, err error) {
+	t.Helper()
+	var acmeErr *Error
+	if assert.ErrorAs(t, err, &acmeErr) {
+		assert.Equal(t, "urn:ietf:params:acme:error:badNonce", acmeErr.Type)
+	}
+}
+
+func TestNewNonceStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		db      DB
+		opts    NonceOptions
+		wantErr bool
+	}{
+		{"ok db", &MockDB{}, NonceOptions{}, false},
+		{"ok memory", nil, NonceOptions{Backend: NonceBackendMemory}, false},
+		{"fail db", nil, NonceOptions{Backend: NonceBackendDB}, true},
+		{"fail backend", &MockDB{}, NonceOptions{Backend: "redis"}, true},
+		{"fail ttl", &MockDB{}, NonceOptions{TTL: -time.Second}, true},
+		{"fail cleanup interval", &MockDB{}, NonceOptions{CleanupInterval: -time.Second}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewNonceStore(tt.db, tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			s.Stop()
+			s.Stop()
+		})
+	}
+}
+
+func TestNonceStore_memory(t *testing.T) {
+	s, err := NewNonceStore(nil, NonceOptions{Backend: NonceBackendMemory})
+	require.NoError(t, err)
+	defer s.Stop()
+
+	ctx := context.Background()
+	n1, err := s.CreateNonce(ctx)
+	require.NoError(t, err)
+	n2, err := s.CreateNonce(ctx)
+	require.NoError(t, err)
+	assert.NotEqual(t, n1, n2)
+
+	// Nonces can only be used once.
+	assert.NoError(t, s.DeleteNonce(ctx, n1))
+	assertBadNonce(t, s.DeleteNonce(ctx, n1))
+	assert.NoError(t, s.DeleteNonce(ctx, n2))
+
+	// Nonces created by other instances, or before a restart, are rejected.
+	other, err := NewNonceStore(nil, NonceOptions{Backend: NonceBackendMemory})
+	require.NoError(t, err)
+	defer other.Stop()
+	n3, err := other.CreateNonce(ctx)
+	require.NoError(t, err)
+	assertBadNonce(t, s.DeleteNonce(ctx, n3))
+
+	// Malformed and tampered nonces are rejected.
+	assertBadNonce(t, s.DeleteNonce(ctx, "not-a-nonce"))
+	b := []byte(n2)
+	b[0] ^= 1
+	assertBadNonce(t, s.DeleteNonce(ctx, Nonce(b)))
+}
+
+func TestMemoryNonces_expired(t *testing.T) {
+	ctx := context.Background()
+	m, err := newMemoryNonces(-time.Second)
+	require.NoError(t, err)
+	n, err := m.CreateNonce(ctx)
+	require.NoError(t, err)
+	assertBadNonce(t, m.DeleteNonce(ctx, n))
+
+	m.ttl = time.Hour
+	n, err = m.CreateNonce(ctx)
+	require.NoError(t, err)
+	require.NoError(t, m.DeleteNonce(ctx, n))
+	assert.Len(t, m.shard(string(n)).used, 1)
+
+	// Used nonces are kept until they expire.
+	m.deleteExpired(time.Now())
+	assert.Len(t, m.shard(string(n)).used, 1)
+	m.deleteExpired(time.Now().Add(2 * time.Hour))
+	assert.Empty(t, m.shard(string(n)).used)
+}
+
+func TestNonceStore_cleanup(t *testing.T) {
+	db := &nonceCleanerDB{
+		MockDB: MockDB{
+			MockCreateNonce: func(ctx context.Context) (Nonce, error) {
+				return "nonce", nil
+			},
+			MockDeleteNonce: func(ctx context.Context, nonce Nonce) error {
+				return errors.New("force")
+			},
+		},
+	}
+	s, err := NewNonceStore(db, NonceOptions{TTL: time.Hour, CleanupInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	n, err := s.CreateNonce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Nonce("nonce"), n)
+	assert.EqualError(t, s.DeleteNonce(context.Background(), n), "force")
+
+	assert.Eventually(t, func() bool {
+		return db.calls() > 0
+	}, time.Second, 10*time.Millisecond)
+	s.Stop()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), db.before[0], 2*time.Second)
+}
+
+func TestMustNonceServiceFromContext(t *testing.T) {
+	db := &MockDB{}
+	ctx := NewDatabaseContext(context.Background(), db)
+	assert.Equal(t, db, MustNonceServiceFromContext(ctx))
+
+	s, err := NewNonceStore(nil, NonceOptions{Backend: NonceBackendMemory})
+	require.NoError(t, err)
+	defer s.Stop()
+	assert.Equal(t, s, MustNonceServiceFromContext(NewNonceServiceContext(ctx, s)))
+}
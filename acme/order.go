@@ -50,6 +50,7 @@ type Order struct {
 	FinalizeURL       string       `json:"finalize"`
 	CertificateID     string       `json:"-"`
 	CertificateURL    string       `json:"certificate,omitempty"`
+	Replaces          string       `json:"replaces,omitempty"`
 }
 
 // ToLog enables response logging.
@@ -62,8 +63,18 @@ func (o *Order) ToLog() (interface{}, error) {
 }
 
 // UpdateStatus updates the ACME Order Status if necessary.
-// Changes to the order are saved using the database interface.
+// Changes to the order and its authorizations are saved atomically using the
+// database interface.
 func (o *Order) UpdateStatus(ctx context.Context, db DB) error {
+	if o.Status != StatusReady && o.Status != StatusPending {
+		return o.updateStatus(ctx, db)
+	}
+	return db.RunTransaction(ctx, func(txDB DB) error {
+		return o.updateStatus(ctx, txDB)
+	})
+}
+
+func (o *Order) updateStatus(ctx context.Context, db DB) error {
 	now := clock.Now()
 
 	switch o.Status {
@@ -148,6 +159,34 @@ func (o *Order) getAuthorizationFingerprint(ctx context.Context, db DB) (string,
 	return "", nil
 }
 
+// checkCAA checks the CAA records of the dns identifiers of the order, using
+// the challenges that validated their authorizations.
+func (o *Order) checkCAA(ctx context.Context, db DB, p Provisioner) error {
+	if p.GetCAAOptions() == nil {
+		return nil
+	}
+	for _, azID := range o.AuthorizationIDs {
+		az, err := db.GetAuthorization(ctx, azID)
+		if err != nil {
+			return WrapErrorISE(err, "error getting authorization %q", azID)
+		}
+		if az.Identifier.Type != DNS {
+			continue
+		}
+		var method ChallengeType
+		for _, ch := range az.Challenges {
+			if ch.Status == StatusValid {
+				method = ch.Type
+				break
+			}
+		}
+		if err := checkCAA(ctx, p, o.AccountID, az.Identifier.Value, az.Wildcard, method); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Finalize signs a certificate if the necessary conditions for Order completion
 // have been met.
 //
@@ -238,6 +277,11 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		data.SetSubjectAlternativeNames(sans...)
 	}
 
+	// Check the CAA records of the dns identifiers if enabled.
+	if err := o.checkCAA(ctx, db, p); err != nil {
+		return err
+	}
+
 	// Get authorizations from the ACME provisioner.
 	ctx = provisioner.NewContextWithMethod(ctx, provisioner.SignMethod)
 	signOps, err := p.AuthorizeSign(ctx, "")
@@ -277,16 +321,19 @@ func (o *Order) Finalize(ctx context.Context, db DB, csr *x509.CertificateReques
 		Leaf:          certChain[0],
 		Intermediates: certChain[1:],
 	}
-	if err := db.CreateCertificate(ctx, cert); err != nil {
-		return WrapErrorISE(err, "error creating certificate for order %s", o.ID)
-	}
+	// Store the certificate and the valid order atomically.
+	return db.RunTransaction(ctx, func(txDB DB) error {
+		if err := txDB.CreateCertificate(ctx, cert); err != nil {
+			return WrapErrorISE(err, "error creating certificate for order %s", o.ID)
+		}
 
-	o.CertificateID = cert.ID
-	o.Status = StatusValid
-	if err = db.UpdateOrder(ctx, o); err != nil {
-		return WrapErrorISE(err, "error updating order %s", o.ID)
-	}
-	return nil
+		o.CertificateID = cert.ID
+		o.Status = StatusValid
+		if err := txDB.UpdateOrder(ctx, o); err != nil {
+			return WrapErrorISE(err, "error updating order %s", o.ID)
+		}
+		return nil
+	})
 }
 
 func (o *Order) sans(csr *x509.CertificateRequest) ([]x509util.SubjectAlternativeName, error) {
@@ -245,6 +245,41 @@ func TestOrder_UpdateStatus(t *testing.T) {
 				},
 			}
 		},
+		"fail/transaction-error": func(t *testing.T) test {
+			now := clock.Now()
+			o := &Order{
+				ID:               "oID",
+				Status:           StatusPending,
+				ExpiresAt:        now.Add(5 * time.Minute),
+				AuthorizationIDs: []string{"a"},
+			}
+			az := &Authorization{
+				ID:     "a",
+				Status: StatusValid,
+			}
+			mockdb := &MockDB{
+				MockGetAuthorization: func(ctx context.Context, id string) (*Authorization, error) {
+					return az, nil
+				},
+			}
+			var updated bool
+			mockdb.MockUpdateOrder = func(ctx context.Context, updo *Order) error {
+				updated = true
+				return nil
+			}
+			mockdb.MockRunTransaction = func(ctx context.Context, fn func(txDB DB) error) error {
+				if err := fn(mockdb); err != nil {
+					return err
+				}
+				assert.True(t, updated)
+				return NewErrorISE("force")
+			}
+			return test{
+				o:   o,
+				db:  mockdb,
+				err: NewErrorISE("force"),
+			}
+		},
 	}
 	for name, run := range tests {
 		t.Run(name, func(t *testing.T) {
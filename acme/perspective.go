@@ -0,0 +1,330 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.step.sm/crypto/jose"
+)
+
+// defaultPerspectiveTimeout is the default time to wait for the result of a
+// remote perspective.
+const defaultPerspectiveTimeout = 30 * time.Second
+
+// RemotePerspective is a network vantage point used to corroborate the
+// validation of a challenge. The URL is the endpoint of an agent that
+// implements the perspective protocol, see NewPerspectiveHandler.
+type RemotePerspective struct {
+	Name string
+	URL  string
+}
+
+// MultiPerspectiveOptions are the options used to create a
+// MultiPerspectiveValidator.
+type MultiPerspectiveOptions struct {
+	// Perspectives is the list of remote perspectives.
+	Perspectives []RemotePerspective
+	// Quorum is the number of remote perspectives that must corroborate the
+	// validation. If it is not set, a single failure is allowed with up to
+	// five remote perspectives, and two with more.
+	Quorum int
+	// Timeout is the maximum time to wait for the result of each remote
+	// perspective.
+	Timeout time.Duration
+	// HTTPClient is the client used to connect to the remote perspectives.
+	HTTPClient *http.Client
+	// Secret is the shared secret sent as a bearer token to the remote
+	// perspectives.
+	Secret string
+}
+
+// MultiPerspectiveValidator validates the http-01, dns-01, and tls-alpn-01
+// challenges from the CA and from multiple remote network perspectives. A
+// challenge is only valid if it is valid from the CA and from a quorum of
+// remote perspectives, so BGP or DNS hijacks local to the CA cannot be used
+// to validate a challenge.
+type MultiPerspectiveValidator struct {
+	perspectives []RemotePerspective
+	quorum       int
+	timeout      time.Duration
+	client       *http.Client
+	secret       string
+}
+
+// NewMultiPerspectiveValidator creates a new MultiPerspectiveValidator.
+func NewMultiPerspectiveValidator(opts MultiPerspectiveOptions) (*MultiPerspectiveValidator, error) {
+	n := len(opts.Perspectives)
+	if n == 0 {
+		return nil, errors.New("multi-perspective validation requires at least one remote perspective")
+	}
+	for _, p := range opts.Perspectives {
+		u, err := url.Parse(p.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("remote perspective %q has an invalid url %q", p.Name, p.URL)
+		}
+	}
+
+	quorum := opts.Quorum
+	switch {
+	case quorum < 0 || quorum > n:
+		return nil, fmt.Errorf("quorum must be between 1 and the number of remote perspectives (%d)", n)
+	case quorum > 0:
+	case n == 1:
+		quorum = 1
+	case n <= 5:
+		quorum = n - 1
+	default:
+		quorum = n - 2
+	}
+
+	v := &MultiPerspectiveValidator{
+		perspectives: opts.Perspectives,
+		quorum:       quorum,
+		timeout:      opts.Timeout,
+		client:       opts.HTTPClient,
+		secret:       opts.Secret,
+	}
+	if v.timeout <= 0 {
+		v.timeout = defaultPerspectiveTimeout
+	}
+	if v.client == nil {
+		v.client = http.DefaultClient
+	}
+	return v, nil
+}
+
+// validate validates the challenge from the CA, and if it is valid, from the
+// remote perspectives. The challenge is only stored as valid if the quorum of
+// remote perspectives is reached, otherwise it is stored with an
+// incorrectResponse error and it can be retried.
+func (v *MultiPerspectiveValidator) validate(ctx context.Context, ch *Challenge, db DB, jwk *jose.JSONWebKey) error {
+	status := ch.Status
+	rec := new(challengeRecorder)
+	if err := ch.validateLocal(ctx, rec, jwk, nil); err != nil || !rec.updated {
+		return err
+	}
+	if ch.Status != StatusValid {
+		if err := db.UpdateChallenge(ctx, ch); err != nil {
+			return WrapErrorISE(err, "error updating challenge")
+		}
+		return nil
+	}
+
+	req := &PerspectiveRequest{
+		Type:       ch.Type,
+		Identifier: ch.Value,
+		Token:      ch.Token,
+		JWK:        jwk,
+	}
+	corroborated, failures := v.validateRemote(ctx, req)
+	if corroborated < v.quorum {
+		ch.Status = status
+		ch.ValidatedAt = time.Time{}
+		return storeError(ctx, db, ch, false, NewError(ErrorIncorrectResponseType,
+			"challenge validated by %d of %d remote perspectives, %d required: %s",
+			corroborated, len(v.perspectives), v.quorum, strings.Join(failures, "; ")))
+	}
+
+	if err := db.UpdateChallenge(ctx, ch); err != nil {
+		return WrapErrorISE(err, "error updating challenge")
+	}
+	return nil
+}
+
+// validateRemote sends the request to all the remote perspectives and returns
+// the number of perspectives that validated the challenge, and the reasons of
+// the ones that did not.
+func (v *MultiPerspectiveValidator) validateRemote(ctx context.Context, req *PerspectiveRequest) (int, []string) {
+	var (
+		mu           sync.Mutex
+		wg           sync.WaitGroup
+		corroborated int
+		failures     []string
+	)
+	for _, p := range v.perspectives {
+		wg.Add(1)
+		go func(p RemotePerspective) {
+			defer wg.Done()
+			err := v.validatePerspective(ctx, p, req)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", p.Name, err))
+			} else {
+				corroborated++
+			}
+		}(p)
+	}
+	wg.Wait()
+	return corroborated, failures
+}
+
+func (v *MultiPerspectiveValidator) validatePerspective(ctx context.Context, p RemotePerspective, req *PerspectiveRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if v.secret != "" {
+		r.Header.Set("Authorization", "Bearer "+v.secret)
+	}
+
+	resp, err := v.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var pr PerspectiveResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&pr); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	if pr.Status != StatusValid {
+		if pr.Error != nil {
+			return errors.New(pr.Error.Detail)
+		}
+		return fmt.Errorf("challenge is %s", pr.Status)
+	}
+	return nil
+}
+
+// PerspectiveRequest is the request sent to a remote perspective to validate
+// a challenge.
+type PerspectiveRequest struct {
+	Type       ChallengeType    `json:"type"`
+	Identifier string           `json:"identifier"`
+	Token      string           `json:"token"`
+	JWK        *jose.JSONWebKey `json:"jwk"`
+}
+
+// PerspectiveResponse is the result of the validation of a challenge in a
+// remote perspective.
+type PerspectiveResponse struct {
+	Status Status `json:"status"`
+	Error  *Error `json:"error,omitempty"`
+}
+
+// PerspectiveHandlerOptions are the options used to authenticate the
+// requests to a remote perspective agent. At least one of them is required.
+type PerspectiveHandlerOptions struct {
+	// Secret is the shared secret the requests must send as a bearer token.
+	Secret string
+	// RequireClientCertificate requires the requests to use a client
+	// certificate verified by the TLS server.
+	RequireClientCertificate bool
+}
+
+// NewPerspectiveHandler returns the http.Handler of a remote perspective
+// agent. The agent validates the challenges in the requests using the given
+// client and returns the resulting status and error. Requests are
+// authenticated using a shared secret, a client certificate, or both.
+func NewPerspectiveHandler(client Client, opts PerspectiveHandlerOptions) (http.Handler, error) {
+	if opts.Secret == "" && !opts.RequireClientCertificate {
+		return nil, errors.New("remote perspective requires a secret or a client certificate")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorizePerspectiveRequest(r, opts) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req PerspectiveRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+			http.Error(w, "error decoding request", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case req.Type != HTTP01 && req.Type != DNS01 && req.Type != TLSALPN01:
+			http.Error(w, fmt.Sprintf("unsupported challenge type %q", req.Type), http.StatusBadRequest)
+			return
+		case req.Identifier == "" || req.Token == "" || req.JWK == nil:
+			http.Error(w, "identifier, token, and jwk are required", http.StatusBadRequest)
+			return
+		}
+
+		ch := &Challenge{
+			Type:   req.Type,
+			Value:  req.Identifier,
+			Token:  req.Token,
+			Status: StatusPending,
+		}
+		ctx := NewClientContext(r.Context(), client)
+		if err := ch.validateLocal(ctx, new(challengeRecorder), req.JWK, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&PerspectiveResponse{
+			Status: ch.Status,
+			Error:  ch.Error,
+		})
+	}), nil
+}
+
+// authorizePerspectiveRequest returns if the request has the shared secret
+// and the client certificate required by the options.
+func authorizePerspectiveRequest(r *http.Request, opts PerspectiveHandlerOptions) bool {
+	if opts.RequireClientCertificate && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		return false
+	}
+	if opts.Secret != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(opts.Secret)) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// challengeRecorder is a DB that only records if the challenge was updated.
+// It is used to validate a challenge without storing the result.
+type challengeRecorder struct {
+	DB
+	updated bool
+}
+
+func (r *challengeRecorder) UpdateChallenge(context.Context, *Challenge) error {
+	r.updated = true
+	return nil
+}
+
+type multiPerspectiveKey struct{}
+
+// NewMultiPerspectiveContext adds the given multi-perspective validator to the
+// context.
+func NewMultiPerspectiveContext(ctx context.Context, v *MultiPerspectiveValidator) context.Context {
+	return context.WithValue(ctx, multiPerspectiveKey{}, v)
+}
+
+// MultiPerspectiveFromContext returns the multi-perspective validator from the
+// given context.
+func MultiPerspectiveFromContext(ctx context.Context) (v *MultiPerspectiveValidator, ok bool) {
+	v, ok = ctx.Value(multiPerspectiveKey{}).(*MultiPerspectiveValidator)
+	return
+}
@@ -0,0 +1,235 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+func TestNewMultiPerspectiveValidator(t *testing.T) {
+	perspectives := func(n int) []RemotePerspective {
+		ps := make([]RemotePerspective, n)
+		for i := range ps {
+			ps[i] = RemotePerspective{Name: "p", URL: "https://perspective.example.com/validate"}
+		}
+		return ps
+	}
+	tests := []struct {
+		name       string
+		opts       MultiPerspectiveOptions
+		wantQuorum int
+		wantErr    bool
+	}{
+		{"ok one", MultiPerspectiveOptions{Perspectives: perspectives(1)}, 1, false},
+		{"ok two", MultiPerspectiveOptions{Perspectives: perspectives(2)}, 1, false},
+		{"ok five", MultiPerspectiveOptions{Perspectives: perspectives(5)}, 4, false},
+		{"ok six", MultiPerspectiveOptions{Perspectives: perspectives(6)}, 4, false},
+		{"ok quorum", MultiPerspectiveOptions{Perspectives: perspectives(3), Quorum: 3}, 3, false},
+		{"fail empty", MultiPerspectiveOptions{}, 0, true},
+		{"fail url", MultiPerspectiveOptions{Perspectives: []RemotePerspective{{Name: "p", URL: "ftp://perspective.example.com"}}}, 0, true},
+		{"fail quorum", MultiPerspectiveOptions{Perspectives: perspectives(2), Quorum: 3}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewMultiPerspectiveValidator(tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantQuorum, v.quorum)
+			assert.Equal(t, defaultPerspectiveTimeout, v.timeout)
+		})
+	}
+}
+
+func TestMultiPerspectiveValidator_validate(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+
+	// newPerspective starts a remote perspective that sees the given TXT
+	// records.
+	newPerspective := func(t *testing.T, txt string) RemotePerspective {
+		handler, err := NewPerspectiveHandler(&mockClient{
+			lookupTxt: func(name string) ([]string, error) {
+				assert.Equal(t, "_acme-challenge.example.com", name)
+				return []string{txt}, nil
+			},
+		}, PerspectiveHandlerOptions{Secret: "secret"})
+		require.NoError(t, err)
+		srv := httptest.NewServer(handler)
+		t.Cleanup(srv.Close)
+		return RemotePerspective{Name: txt, URL: srv.URL}
+	}
+	newChallenge := func() *Challenge {
+		return &Challenge{
+			ID:     "chID",
+			Type:   DNS01,
+			Value:  "example.com",
+			Token:  "token",
+			Status: StatusProcessing,
+		}
+	}
+
+	tests := []struct {
+		name         string
+		localTxt     string
+		perspectives func(t *testing.T) []RemotePerspective
+		quorum       int
+		wantStatus   Status
+		wantErrType  string
+		wantUpdates  int
+	}{
+		{"ok", expected, func(t *testing.T) []RemotePerspective {
+			return []RemotePerspective{newPerspective(t, expected), newPerspective(t, expected)}
+		}, 2, StatusValid, "", 1},
+		{"ok quorum", expected, func(t *testing.T) []RemotePerspective {
+			return []RemotePerspective{newPerspective(t, expected), newPerspective(t, "hijacked")}
+		}, 1, StatusValid, "", 1},
+		{"fail quorum", expected, func(t *testing.T) []RemotePerspective {
+			return []RemotePerspective{newPerspective(t, expected), newPerspective(t, "hijacked")}
+		}, 2, StatusProcessing, "urn:ietf:params:acme:error:incorrectResponse", 1},
+		{"fail unauthorized", expected, func(t *testing.T) []RemotePerspective {
+			handler, err := NewPerspectiveHandler(&mockClient{}, PerspectiveHandlerOptions{Secret: "other"})
+			require.NoError(t, err)
+			srv := httptest.NewServer(handler)
+			t.Cleanup(srv.Close)
+			return []RemotePerspective{{Name: "other", URL: srv.URL}}
+		}, 1, StatusProcessing, "urn:ietf:params:acme:error:incorrectResponse", 1},
+		{"fail unavailable", expected, func(t *testing.T) []RemotePerspective {
+			return []RemotePerspective{{Name: "down", URL: "http://127.0.0.1:1"}}
+		}, 1, StatusProcessing, "urn:ietf:params:acme:error:incorrectResponse", 1},
+		{"fail local", "hijacked", func(t *testing.T) []RemotePerspective {
+			// The remote perspectives are not queried.
+			return []RemotePerspective{{Name: "unused", URL: "http://127.0.0.1:1"}}
+		}, 1, StatusProcessing, "urn:ietf:params:acme:error:rejectedIdentifier", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewMultiPerspectiveValidator(MultiPerspectiveOptions{
+				Perspectives: tt.perspectives(t),
+				Quorum:       tt.quorum,
+				Secret:       "secret",
+			})
+			require.NoError(t, err)
+
+			var updates int
+			db := &MockDB{
+				MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+					updates++
+					return nil
+				},
+			}
+			ctx := NewClientContext(context.Background(), &mockClient{
+				lookupTxt: func(name string) ([]string, error) {
+					return []string{tt.localTxt}, nil
+				},
+			})
+			ctx = NewMultiPerspectiveContext(ctx, v)
+
+			ch := newChallenge()
+			require.NoError(t, ch.validate(ctx, db, jwk, nil))
+			assert.Equal(t, tt.wantStatus, ch.Status)
+			assert.Equal(t, tt.wantUpdates, updates)
+			if tt.wantErrType == "" {
+				assert.Nil(t, ch.Error)
+				assert.False(t, ch.ValidatedAt.IsZero())
+			} else if assert.NotNil(t, ch.Error) {
+				assert.Equal(t, tt.wantErrType, ch.Error.Type)
+				assert.True(t, ch.ValidatedAt.IsZero())
+			}
+		})
+	}
+}
+
+func TestNewPerspectiveHandler(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	pub := jwk.Public()
+
+	_, err = NewPerspectiveHandler(&mockClient{}, PerspectiveHandlerOptions{})
+	assert.Error(t, err)
+
+	handler, err := NewPerspectiveHandler(&mockClient{
+		lookupTxt: func(name string) ([]string, error) {
+			return nil, errors.New("force")
+		},
+	}, PerspectiveHandlerOptions{Secret: "secret"})
+	require.NoError(t, err)
+	request := func(req *PerspectiveRequest) string {
+		b, err := json.Marshal(req)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		secret     string
+		body       string
+		wantStatus int
+		wantResp   *PerspectiveResponse
+	}{
+		{"ok", "POST", "secret", request(&PerspectiveRequest{Type: DNS01, Identifier: "example.com", Token: "token", JWK: &pub}), 200,
+			&PerspectiveResponse{Status: StatusPending, Error: NewError(ErrorDNSType, "error looking up TXT records for domain example.com")}},
+		{"fail secret", "POST", "other", request(&PerspectiveRequest{Type: DNS01, Identifier: "example.com", Token: "token", JWK: &pub}), 401, nil},
+		{"fail no secret", "POST", "", request(&PerspectiveRequest{Type: DNS01, Identifier: "example.com", Token: "token", JWK: &pub}), 401, nil},
+		{"fail method", "GET", "secret", "", 405, nil},
+		{"fail body", "POST", "secret", "{", 400, nil},
+		{"fail type", "POST", "secret", request(&PerspectiveRequest{Type: DEVICEATTEST01, Identifier: "example.com", Token: "token", JWK: &pub}), 400, nil},
+		{"fail jwk", "POST", "secret", request(&PerspectiveRequest{Type: DNS01, Identifier: "example.com", Token: "token"}), 400, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, "/validate", strings.NewReader(tt.body))
+			if tt.secret != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.secret)
+			}
+			handler.ServeHTTP(w, r)
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantResp != nil {
+				var resp PerspectiveResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&resp))
+				assert.Equal(t, tt.wantResp.Status, resp.Status)
+				if assert.NotNil(t, resp.Error) {
+					assert.Equal(t, tt.wantResp.Error.Type, resp.Error.Type)
+					assert.Equal(t, tt.wantResp.Error.Detail, resp.Error.Detail)
+				}
+			}
+		})
+	}
+}
+
+func TestNewPerspectiveHandler_clientCertificate(t *testing.T) {
+	handler, err := NewPerspectiveHandler(&mockClient{}, PerspectiveHandlerOptions{RequireClientCertificate: true})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/validate", http.NoBody))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r := httptest.NewRequest("GET", "/validate", http.NoBody)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,231 @@
+package acme
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// RateLimitCounter is the number of operations counted in the current window
+// of a rate limit. The window ends at ExpiresAt.
+type RateLimitCounter struct {
+	Key       string
+	Count     int
+	ExpiresAt time.Time
+}
+
+// RateLimitOperation is the type of the operations limited by the ACME rate
+// limits.
+type RateLimitOperation string
+
+const (
+	// RateLimitNewOrder limits the new-order requests.
+	RateLimitNewOrder RateLimitOperation = "new-order"
+	// RateLimitNewAccount limits the new-account requests creating accounts.
+	RateLimitNewAccount RateLimitOperation = "new-account"
+	// RateLimitFailedChallenge limits the failed challenge validations.
+	RateLimitFailedChallenge RateLimitOperation = "failed-challenge"
+)
+
+// RateLimitSubject is the account, client IP, and identifiers of a rate
+// limited operation. Empty values are not counted.
+type RateLimitSubject struct {
+	AccountID   string
+	IP          string
+	Identifiers []string
+}
+
+type rateLimitCheck struct {
+	key   string
+	limit *provisioner.ACMERateLimit
+}
+
+func (op RateLimitOperation) scopes(limits *provisioner.ACMERateLimits) *provisioner.ACMERateLimitScopes {
+	if limits == nil {
+		return nil
+	}
+	switch op {
+	case RateLimitNewOrder:
+		return limits.NewOrder
+	case RateLimitNewAccount:
+		return limits.NewAccount
+	case RateLimitFailedChallenge:
+		return limits.FailedChallenge
+	default:
+		return nil
+	}
+}
+
+// checks returns the counters and limits that apply to the operation.
+func (op RateLimitOperation) checks(prov Provisioner, subject RateLimitSubject) []rateLimitCheck {
+	scopes := op.scopes(prov.GetRateLimits())
+	if scopes == nil {
+		return nil
+	}
+	key := func(parts ...string) string {
+		return strings.Join(append([]string{prov.GetID(), string(op)}, parts...), "/")
+	}
+
+	var checks []rateLimitCheck
+	if scopes.Provisioner != nil {
+		checks = append(checks, rateLimitCheck{key("provisioner"), scopes.Provisioner})
+	}
+	if scopes.Account != nil && subject.AccountID != "" {
+		checks = append(checks, rateLimitCheck{key("account", subject.AccountID), scopes.Account})
+	}
+	if scopes.IP != nil && subject.IP != "" {
+		checks = append(checks, rateLimitCheck{key("ip", subject.IP), scopes.IP})
+	}
+	if scopes.Identifier != nil {
+		for _, id := range subject.Identifiers {
+			checks = append(checks, rateLimitCheck{key("identifier", strings.ToLower(id)), scopes.Identifier})
+		}
+	}
+	return checks
+}
+
+// CheckRateLimits returns a rateLimited error if any of the rate limits
+// configured in the provisioner has been reached. Otherwise, the operation is
+// counted in all of them. Rejected operations are not counted, so a client
+// exceeding a limit does not extend it, or consume the limits of other
+// scopes.
+func CheckRateLimits(ctx context.Context, db DB, prov Provisioner, op RateLimitOperation, subject RateLimitSubject) error {
+	checks := op.checks(prov, subject)
+	now := clock.Now()
+	for _, c := range checks {
+		counter, err := db.GetRateLimitCounter(ctx, c.key)
+		if err != nil {
+			return WrapErrorISE(err, "error retrieving rate limit")
+		}
+		if counter.Count >= c.limit.Limit && now.Before(counter.ExpiresAt) {
+			return newRateLimitedError(op, c, counter)
+		}
+	}
+	for _, c := range checks {
+		if _, err := db.IncrementRateLimitCounter(ctx, c.key, c.limit.Period.Value()); err != nil {
+			return WrapErrorISE(err, "error updating rate limit")
+		}
+	}
+	return nil
+}
+
+// CheckFailedChallengeRateLimits returns a rateLimited error if the failed
+// challenge validations of the subject have reached any of the rate limits
+// configured in the provisioner. The failed validations are counted by
+// Challenge.Validate.
+func CheckFailedChallengeRateLimits(ctx context.Context, db DB, prov Provisioner, subject RateLimitSubject) error {
+	now := clock.Now()
+	for _, c := range RateLimitFailedChallenge.checks(prov, subject) {
+		counter, err := db.GetRateLimitCounter(ctx, c.key)
+		if err != nil {
+			return WrapErrorISE(err, "error retrieving rate limit")
+		}
+		if counter.Count >= c.limit.Limit && now.Before(counter.ExpiresAt) {
+			return newRateLimitedError(RateLimitFailedChallenge, c, counter)
+		}
+	}
+	return nil
+}
+
+// recordFailedChallenge counts a failed validation of the challenge in the
+// rate limits of the provisioner in the context.
+func recordFailedChallenge(ctx context.Context, db DB, ch *Challenge) {
+	prov, ok := ProvisionerFromContext(ctx)
+	if !ok {
+		return
+	}
+	subject := RateLimitSubject{
+		AccountID:   ch.AccountID,
+		IP:          ClientIPFromContext(ctx),
+		Identifiers: []string{ch.Value},
+	}
+	for _, c := range RateLimitFailedChallenge.checks(prov, subject) {
+		if _, err := db.IncrementRateLimitCounter(ctx, c.key, c.limit.Period.Value()); err != nil {
+			log.Printf("error updating rate limit %s: %v", c.key, err)
+		}
+	}
+}
+
+// rateLimitCleaner is the interface implemented by the databases that can
+// delete the rate limit counters whose window has ended.
+type rateLimitCleaner interface {
+	DeleteExpiredRateLimitCounters(ctx context.Context, before time.Time) (int, error)
+}
+
+// RateLimitCleaner deletes the expired rate limit counters in the background.
+type RateLimitCleaner struct {
+	db      rateLimitCleaner
+	done    chan struct{}
+	wg      sync.WaitGroup
+	stopped sync.Once
+}
+
+// NewRateLimitCleaner starts the deletion of the expired rate limit counters
+// every interval. It returns nil if the database cannot delete them.
+func NewRateLimitCleaner(db DB, interval time.Duration) *RateLimitCleaner {
+	c, ok := db.(rateLimitCleaner)
+	if !ok {
+		return nil
+	}
+	rc := &RateLimitCleaner{
+		db:   c,
+		done: make(chan struct{}),
+	}
+	rc.wg.Add(1)
+	go rc.run(interval)
+	return rc
+}
+
+// Stop stops the deletion of the expired rate limit counters.
+func (rc *RateLimitCleaner) Stop() {
+	rc.stopped.Do(func() {
+		close(rc.done)
+		rc.wg.Wait()
+	})
+}
+
+func (rc *RateLimitCleaner) run(interval time.Duration) {
+	defer rc.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rc.done:
+			return
+		case <-ticker.C:
+			if _, err := rc.db.DeleteExpiredRateLimitCounters(context.Background(), clock.Now()); err != nil {
+				log.Printf("error deleting expired rate limits: %v", err)
+			}
+		}
+	}
+}
+
+func newRateLimitedError(op RateLimitOperation, c rateLimitCheck, counter *RateLimitCounter) *Error {
+	err := NewDetailedError(ErrorRateLimitedType, "%s rate limit of %d per %s exceeded for %s",
+		op, c.limit.Limit, c.limit.Period.Value(), c.key)
+	err.Status = http.StatusTooManyRequests
+	err.RetryAfter = time.Until(counter.ExpiresAt)
+	if err.RetryAfter < time.Second {
+		err.RetryAfter = time.Second
+	}
+	return err
+}
+
+type clientIPKey struct{}
+
+// NewClientIPContext adds the IP address of the ACME client to the context.
+func NewClientIPContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the IP address of the ACME client in the
+// context, or an empty string if it is not set.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
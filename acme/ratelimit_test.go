@@ -0,0 +1,195 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// newRateLimitDB returns a MockDB that keeps the rate limit counters in the
+// given map.
+func newRateLimitDB(counters map[string]*RateLimitCounter) *MockDB {
+	return &MockDB{
+		MockGetRateLimitCounter: func(ctx context.Context, key string) (*RateLimitCounter, error) {
+			if c, ok := counters[key]; ok {
+				return c, nil
+			}
+			return &RateLimitCounter{Key: key}, nil
+		},
+		MockIncrementRateLimitCounter: func(ctx context.Context, key string, period time.Duration) (*RateLimitCounter, error) {
+			c, ok := counters[key]
+			if !ok || !time.Now().Before(c.ExpiresAt) {
+				c = &RateLimitCounter{Key: key, ExpiresAt: time.Now().Add(period)}
+				counters[key] = c
+			}
+			c.Count++
+			return c, nil
+		},
+	}
+}
+
+func TestCheckRateLimits(t *testing.T) {
+	limit := func(n int) *provisioner.ACMERateLimit {
+		return &provisioner.ACMERateLimit{Limit: n, Period: &provisioner.Duration{Duration: time.Hour}}
+	}
+	prov := &MockProvisioner{
+		MgetID: func() string { return "provID" },
+		MgetRateLimits: func() *provisioner.ACMERateLimits {
+			return &provisioner.ACMERateLimits{
+				NewOrder: &provisioner.ACMERateLimitScopes{
+					Account:    limit(3),
+					IP:         limit(5),
+					Identifier: limit(2),
+				},
+			}
+		},
+	}
+	subject := func(accountID, ip string, identifiers ...string) RateLimitSubject {
+		return RateLimitSubject{AccountID: accountID, IP: ip, Identifiers: identifiers}
+	}
+
+	counters := map[string]*RateLimitCounter{}
+	db := newRateLimitDB(counters)
+	ctx := context.Background()
+
+	// The identifier limit is case insensitive.
+	require.NoError(t, CheckRateLimits(ctx, db, prov, RateLimitNewOrder, subject("acc1", "10.0.0.1", "example.com")))
+	require.NoError(t, CheckRateLimits(ctx, db, prov, RateLimitNewOrder, subject("acc1", "10.0.0.1", "EXAMPLE.com")))
+	err := CheckRateLimits(ctx, db, prov, RateLimitNewOrder, subject("acc2", "10.0.0.2", "example.com"))
+	var acmeErr *Error
+	require.ErrorAs(t, err, &acmeErr)
+	assert.Equal(t, "urn:ietf:params:acme:error:rateLimited", acmeErr.Type)
+	assert.Equal(t, http.StatusTooManyRequests, acmeErr.Status)
+	assert.Equal(t, "The request exceeds a rate limit: new-order rate limit of 2 per 1h0m0s exceeded for provID/new-order/identifier/example.com", acmeErr.Detail)
+	assert.InDelta(t, time.Hour, acmeErr.RetryAfter, float64(time.Minute))
+
+	// Rejected requests are not counted.
+	assert.Equal(t, 2, counters["provID/new-order/identifier/example.com"].Count)
+	assert.NotContains(t, counters, "provID/new-order/account/acc2")
+	assert.NotContains(t, counters, "provID/new-order/ip/10.0.0.2")
+
+	// The account limit.
+	require.NoError(t, CheckRateLimits(ctx, db, prov, RateLimitNewOrder, subject("acc1", "10.0.0.1", "a.example.com")))
+	err = CheckRateLimits(ctx, db, prov, RateLimitNewOrder, subject("acc1", "10.0.0.3", "b.example.com"))
+	require.ErrorAs(t, err, &acmeErr)
+	assert.Contains(t, acmeErr.Detail, "provID/new-order/account/acc1")
+	assert.NotContains(t, counters, "provID/new-order/identifier/b.example.com")
+
+	// Other operations are not limited.
+	for i := 0; i < 10; i++ {
+		require.NoError(t, CheckRateLimits(ctx, db, prov, RateLimitNewAccount, subject("", "10.0.0.1")))
+	}
+	assert.NotContains(t, counters, "provID/new-account/ip/10.0.0.1")
+
+	// The counter is reset after the period.
+	counters["provID/new-order/account/acc1"].ExpiresAt = time.Now().Add(-time.Second)
+	require.NoError(t, CheckRateLimits(ctx, db, prov, RateLimitNewOrder, subject("acc1", "10.0.0.3", "c.example.com")))
+
+	// Errors updating the counters.
+	err = CheckRateLimits(ctx, &MockDB{MockError: errors.New("force")}, prov, RateLimitNewOrder, subject("acc1", "", ""))
+	require.ErrorAs(t, err, &acmeErr)
+	assert.Equal(t, http.StatusInternalServerError, acmeErr.Status)
+}
+
+func TestChallenge_Validate_failedChallengeRateLimit(t *testing.T) {
+	prov := &MockProvisioner{
+		MgetID: func() string { return "provID" },
+		MgetRateLimits: func() *provisioner.ACMERateLimits {
+			return &provisioner.ACMERateLimits{
+				FailedChallenge: &provisioner.ACMERateLimitScopes{
+					Identifier: &provisioner.ACMERateLimit{Limit: 2, Period: &provisioner.Duration{Duration: time.Hour}},
+				},
+			}
+		},
+	}
+	subject := RateLimitSubject{AccountID: "accID", IP: "10.0.0.1", Identifiers: []string{"example.com"}}
+
+	counters := map[string]*RateLimitCounter{}
+	db := newRateLimitDB(counters)
+	db.MockUpdateChallenge = func(ctx context.Context, ch *Challenge) error {
+		return nil
+	}
+	ctx := NewProvisionerContext(context.Background(), prov)
+	ctx = NewClientIPContext(ctx, "10.0.0.1")
+	ctx = NewClientContext(ctx, &mockClient{
+		lookupTxt: func(name string) ([]string, error) {
+			return nil, errors.New("force")
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, CheckFailedChallengeRateLimits(ctx, db, prov, subject))
+		ch := &Challenge{ID: "chID", AccountID: "accID", Type: DNS01, Value: "example.com", Token: "token", Status: StatusPending}
+		require.NoError(t, ch.Validate(ctx, db, nil, nil))
+		require.NotNil(t, ch.Error)
+	}
+	assert.Equal(t, 2, counters["provID/failed-challenge/identifier/example.com"].Count)
+
+	err := CheckFailedChallengeRateLimits(ctx, db, prov, subject)
+	var acmeErr *Error
+	require.ErrorAs(t, err, &acmeErr)
+	assert.Equal(t, "urn:ietf:params:acme:error:rateLimited", acmeErr.Type)
+
+	// Other identifiers are not limited.
+	require.NoError(t, CheckFailedChallengeRateLimits(ctx, db, prov, RateLimitSubject{Identifiers: []string{"other.example.com"}}))
+
+	// The limit expires with the window.
+	counters["provID/failed-challenge/identifier/example.com"].ExpiresAt = time.Now().Add(-time.Second)
+	require.NoError(t, CheckFailedChallengeRateLimits(ctx, db, prov, subject))
+}
+
+func TestError_Render_retryAfter(t *testing.T) {
+	err := NewError(ErrorRateLimitedType, "rate limit exceeded")
+	err.Status = http.StatusTooManyRequests
+	err.RetryAfter = 1500 * time.Millisecond
+
+	w := httptest.NewRecorder()
+	err.Render(w)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+}
+
+type rateLimitCleanerDB struct {
+	MockDB
+	mu     sync.Mutex
+	before []time.Time
+}
+
+func (db *rateLimitCleanerDB) DeleteExpiredRateLimitCounters(_ context.Context, before time.Time) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.before = append(db.before, before)
+	return 1, nil
+}
+
+func (db *rateLimitCleanerDB) calls() int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return len(db.before)
+}
+
+func TestNewRateLimitCleaner(t *testing.T) {
+	assert.Nil(t, NewRateLimitCleaner(&MockDB{}, time.Millisecond))
+
+	db := &rateLimitCleanerDB{}
+	rc := NewRateLimitCleaner(db, 10*time.Millisecond)
+	require.NotNil(t, rc)
+	assert.Eventually(t, func() bool {
+		return db.calls() > 0
+	}, time.Second, 10*time.Millisecond)
+	rc.Stop()
+	rc.Stop()
+
+	calls := db.calls()
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, calls, db.calls())
+}
@@ -0,0 +1,118 @@
+package acme
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// RenewalInfoRetryAfter is the time ACME clients should wait before checking
+// the renewal information of a certificate again.
+const RenewalInfoRetryAfter = 6 * time.Hour
+
+// CertID is the unique identifier of a certificate defined in the ACME Renewal
+// Information (ARI) extension. It is composed by the key identifier of the
+// authority key identifier extension and the serial number of the
+// certificate.
+type CertID struct {
+	AuthorityKeyID []byte
+	SerialNumber   *big.Int
+}
+
+// NewCertID returns the CertID of the given certificate.
+func NewCertID(crt *x509.Certificate) CertID {
+	return CertID{
+		AuthorityKeyID: crt.AuthorityKeyId,
+		SerialNumber:   crt.SerialNumber,
+	}
+}
+
+// ParseCertID parses the string representation of a CertID, the base64url
+// encoded authority key identifier and the base64url encoded DER serial number
+// joined by a period.
+func ParseCertID(s string) (CertID, error) {
+	aki, serial, ok := strings.Cut(s, ".")
+	if !ok || aki == "" || serial == "" {
+		return CertID{}, NewError(ErrorMalformedType, "certID %q is not valid", s)
+	}
+	akiBytes, err := base64.RawURLEncoding.DecodeString(aki)
+	if err != nil {
+		return CertID{}, WrapError(ErrorMalformedType, err, "error decoding authority key identifier of certID %q", s)
+	}
+	serialBytes, err := base64.RawURLEncoding.DecodeString(serial)
+	if err != nil {
+		return CertID{}, WrapError(ErrorMalformedType, err, "error decoding serial number of certID %q", s)
+	}
+	// The serial number is the content of a DER encoded positive integer.
+	if len(serialBytes) == 0 || serialBytes[0]&0x80 != 0 {
+		return CertID{}, NewError(ErrorMalformedType, "serial number of certID %q is not valid", s)
+	}
+	return CertID{
+		AuthorityKeyID: akiBytes,
+		SerialNumber:   new(big.Int).SetBytes(serialBytes),
+	}, nil
+}
+
+// String returns the string representation of the CertID.
+func (c CertID) String() string {
+	serial := c.SerialNumber.Bytes()
+	// Add a leading zero to keep the DER encoding of the integer positive.
+	if len(serial) == 0 || serial[0]&0x80 != 0 {
+		serial = append([]byte{0}, serial...)
+	}
+	return base64.RawURLEncoding.EncodeToString(c.AuthorityKeyID) + "." +
+		base64.RawURLEncoding.EncodeToString(serial)
+}
+
+// Matches returns true if the CertID identifies the given certificate.
+func (c CertID) Matches(crt *x509.Certificate) bool {
+	return crt.SerialNumber.Cmp(c.SerialNumber) == 0 &&
+		bytes.Equal(crt.AuthorityKeyId, c.AuthorityKeyID)
+}
+
+// RenewalWindow is the time window in which a certificate should be renewed.
+type RenewalWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// RenewalInfo is the renewal information of a certificate.
+type RenewalInfo struct {
+	SuggestedWindow RenewalWindow `json:"suggestedWindow"`
+	ExplanationURL  string        `json:"explanationURL,omitempty"`
+}
+
+// NewRenewalInfo returns the renewal information of the given certificate.
+// The suggested window of a valid certificate covers the first half of the
+// last third of its lifetime. The suggested window of a revoked certificate is
+// in the past so clients renew it immediately.
+func NewRenewalInfo(crt *x509.Certificate, revoked bool, now time.Time) *RenewalInfo {
+	if revoked {
+		return &RenewalInfo{
+			SuggestedWindow: RenewalWindow{
+				Start: now.Add(-2 * RenewalInfoRetryAfter).UTC().Truncate(time.Second),
+				End:   now.Add(-RenewalInfoRetryAfter).UTC().Truncate(time.Second),
+			},
+		}
+	}
+	lifetime := crt.NotAfter.Sub(crt.NotBefore)
+	return &RenewalInfo{
+		SuggestedWindow: RenewalWindow{
+			Start: crt.NotBefore.Add(lifetime * 2 / 3).UTC().Truncate(time.Second),
+			End:   crt.NotBefore.Add(lifetime * 5 / 6).UTC().Truncate(time.Second),
+		},
+	}
+}
+
+// ToLog enables response logging.
+func (r *RenewalInfo) ToLog() (interface{}, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, WrapErrorISE(err, "error marshaling renewal information for logging")
+	}
+	return string(b), nil
+}
@@ -0,0 +1,80 @@
+package acme
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCertID(t *testing.T) {
+	// Example from draft-ietf-acme-ari.
+	aki := []byte{0x69, 0x88, 0x5b, 0x6b, 0x87, 0x46, 0x40, 0x41, 0xe1, 0xb3, 0x7b, 0x84, 0x7b, 0xa0, 0xae, 0x2c, 0xde, 0x01, 0xc8, 0xd4}
+	serial := new(big.Int).SetBytes([]byte{0x00, 0x87, 0x65, 0x43, 0x21})
+
+	tests := []struct {
+		name    string
+		s       string
+		want    CertID
+		wantErr bool
+	}{
+		{"ok", "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE", CertID{AuthorityKeyID: aki, SerialNumber: serial}, false},
+		{"fail no period", "aYhba4dGQEHhs3uEe6CuLN4ByNQ", CertID{}, true},
+		{"fail empty serial", "aYhba4dGQEHhs3uEe6CuLN4ByNQ.", CertID{}, true},
+		{"fail aki encoding", "aYhba4dGQEHhs3uEe6CuLN4ByNQ=.AIdlQyE", CertID{}, true},
+		{"fail serial encoding", "aYhba4dGQEHhs3uEe6CuLN4ByNQ.AIdlQyE=", CertID{}, true},
+		{"fail negative serial", "aYhba4dGQEHhs3uEe6CuLN4ByNQ.h2VDIQ", CertID{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCertID(tt.s)
+			if tt.wantErr {
+				var acmeErr *Error
+				if assert.ErrorAs(t, err, &acmeErr) {
+					assert.Equal(t, "urn:ietf:params:acme:error:malformed", acmeErr.Type)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.s, got.String())
+		})
+	}
+}
+
+func TestCertID_Matches(t *testing.T) {
+	crt := &x509.Certificate{
+		SerialNumber:   big.NewInt(1234),
+		AuthorityKeyId: []byte{1, 2, 3, 4},
+	}
+	certID, err := ParseCertID(NewCertID(crt).String())
+	require.NoError(t, err)
+	assert.True(t, certID.Matches(crt))
+	assert.False(t, CertID{AuthorityKeyID: []byte{1, 2, 3, 4}, SerialNumber: big.NewInt(1)}.Matches(crt))
+	assert.False(t, CertID{AuthorityKeyID: []byte{4, 3, 2, 1}, SerialNumber: big.NewInt(1234)}.Matches(crt))
+}
+
+func TestNewRenewalInfo(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	crt := &x509.Certificate{
+		NotBefore: now,
+		NotAfter:  now.Add(24 * time.Hour),
+	}
+
+	assert.Equal(t, &RenewalInfo{
+		SuggestedWindow: RenewalWindow{
+			Start: now.Add(16 * time.Hour),
+			End:   now.Add(20 * time.Hour),
+		},
+	}, NewRenewalInfo(crt, false, now))
+
+	assert.Equal(t, &RenewalInfo{
+		SuggestedWindow: RenewalWindow{
+			Start: now.Add(-12 * time.Hour),
+			End:   now.Add(-6 * time.Hour),
+		},
+	}, NewRenewalInfo(crt, true, now))
+}
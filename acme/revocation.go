@@ -0,0 +1,404 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// defaultRevocationCacheDuration is the time a CRL or an OCSP response
+	// without a next update time is cached.
+	defaultRevocationCacheDuration = time.Hour
+	// maxCRLSize is the maximum size of a CRL.
+	maxCRLSize = 10 << 20
+	// maxOCSPResponseSize is the maximum size of an OCSP response.
+	maxOCSPResponseSize = 1 << 20
+	// defaultRevocationCacheSize is the default maximum number of CRLs, and
+	// of OCSP responses, kept in the cache.
+	defaultRevocationCacheSize = 100
+)
+
+// androidAttestationStatusURL is the URL of the list of revoked and suspended
+// Android attestation certificates published by Google.
+var androidAttestationStatusURL = "https://android.googleapis.com/attestation/status"
+
+var (
+	// ErrCertificateRevoked is returned by the RevocationChecker when one of
+	// the certificates in the chain is revoked.
+	ErrCertificateRevoked = errors.New("certificate is revoked")
+
+	// ErrRevocationUnknown is returned by the RevocationChecker when the
+	// revocation status of one of the certificates in the chain cannot be
+	// determined.
+	ErrRevocationUnknown = errors.New("certificate revocation status is unknown")
+
+	// errNoRevocationInfo is returned by isRevoked if the certificate has no
+	// OCSP servers or CRL distribution points.
+	errNoRevocationInfo = errors.New("certificate has no ocsp server or crl distribution point")
+)
+
+// RevocationChecker checks the revocation status of certificate chains using
+// OCSP and CRLs. OCSP responses and CRLs are cached until their next update
+// time.
+type RevocationChecker struct {
+	client    *http.Client
+	cacheSize int
+	mu        sync.Mutex
+	crls      map[string]*cachedCRL
+	ocsp      map[string]*cachedOCSP
+	android   *cachedAndroidStatus
+}
+
+type cachedCRL struct {
+	crl       *x509.RevocationList
+	expiresAt time.Time
+}
+
+type cachedOCSP struct {
+	status    int
+	expiresAt time.Time
+}
+
+type cachedAndroidStatus struct {
+	entries   map[string]androidAttestationStatusEntry
+	expiresAt time.Time
+}
+
+// androidAttestationStatus is the list of revoked and suspended Android
+// attestation certificates, indexed by the serial number in hexadecimal.
+type androidAttestationStatus struct {
+	Entries map[string]androidAttestationStatusEntry `json:"entries"`
+}
+
+type androidAttestationStatusEntry struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// RevocationCheckerOption is the type of options passed to
+// NewRevocationChecker.
+type RevocationCheckerOption func(c *RevocationChecker)
+
+// WithRevocationCacheSize sets the maximum number of CRLs, and of OCSP
+// responses, kept in the cache. Defaults to 100.
+func WithRevocationCacheSize(n int) RevocationCheckerOption {
+	return func(c *RevocationChecker) {
+		if n > 0 {
+			c.cacheSize = n
+		}
+	}
+}
+
+// NewRevocationChecker creates a new RevocationChecker that uses the given
+// HTTP client. If the client is nil a client with a 10 seconds timeout will be
+// used.
+func NewRevocationChecker(client *http.Client, opts ...RevocationCheckerOption) *RevocationChecker {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	c := &RevocationChecker{
+		client:    client,
+		cacheSize: defaultRevocationCacheSize,
+		crls:      make(map[string]*cachedCRL),
+		ocsp:      make(map[string]*cachedOCSP),
+	}
+	for _, fn := range opts {
+		fn(c)
+	}
+	return c
+}
+
+// Check checks the revocation status of all the certificates in the given
+// verified chain except the root. The chain must start with the leaf and end
+// with the root. OCSP is used if available, and CRLs are used if OCSP is not
+// available or it cannot determine the status of a certificate.
+//
+// It returns an error wrapping ErrCertificateRevoked if a certificate is
+// revoked. If strict is true, it returns an error wrapping
+// ErrRevocationUnknown if the status of a certificate cannot be determined.
+// Intermediates without OCSP servers or CRL distribution points are not
+// checked, but the leaf must have them in strict mode.
+func (c *RevocationChecker) Check(ctx context.Context, chain []*x509.Certificate, strict bool) error {
+	for i := 0; i < len(chain)-1; i++ {
+		crt, issuer := chain[i], chain[i+1]
+		revoked, err := c.isRevoked(ctx, crt, issuer)
+		switch {
+		case i > 0 && errors.Is(err, errNoRevocationInfo):
+			continue
+		case err != nil && strict:
+			return fmt.Errorf("%w: %s: %v", ErrRevocationUnknown, crt.Subject, err)
+		case revoked:
+			return fmt.Errorf("%w: %s", ErrCertificateRevoked, crt.Subject)
+		}
+	}
+	return nil
+}
+
+// CheckAndroidKey checks the certificates in the given verified Android key
+// attestation chain against the status list published by Google. Android
+// attestation certificates do not have OCSP servers or CRL distribution
+// points, their revocation is only published in this list.
+//
+// It returns an error wrapping ErrCertificateRevoked if a certificate is
+// revoked or suspended. If strict is true, it returns an error wrapping
+// ErrRevocationUnknown if the status list cannot be retrieved.
+func (c *RevocationChecker) CheckAndroidKey(ctx context.Context, chain []*x509.Certificate, strict bool) error {
+	entries, err := c.androidStatus(ctx)
+	if err != nil {
+		if strict {
+			return fmt.Errorf("%w: %v", ErrRevocationUnknown, err)
+		}
+		return nil
+	}
+	for _, crt := range chain {
+		if e, ok := entries[crt.SerialNumber.Text(16)]; ok {
+			return fmt.Errorf("%w: %s: %s %s", ErrCertificateRevoked, crt.Subject, strings.ToLower(e.Status), e.Reason)
+		}
+	}
+	return nil
+}
+
+func (c *RevocationChecker) androidStatus(ctx context.Context) (map[string]androidAttestationStatusEntry, error) {
+	c.mu.Lock()
+	cached := c.android
+	c.mu.Unlock()
+	if cached != nil && time.Now().Before(cached.expiresAt) {
+		return cached.entries, nil
+	}
+
+	b, err := c.fetch(ctx, http.MethodGet, androidAttestationStatusURL, nil, maxCRLSize)
+	if err != nil {
+		return nil, err
+	}
+	var status androidAttestationStatus
+	if err := json.Unmarshal(b, &status); err != nil {
+		return nil, fmt.Errorf("error parsing android attestation status from %s: %w", androidAttestationStatusURL, err)
+	}
+	entries := make(map[string]androidAttestationStatusEntry, len(status.Entries))
+	for k, v := range status.Entries {
+		entries[strings.ToLower(strings.TrimLeft(k, "0"))] = v
+	}
+
+	c.mu.Lock()
+	c.android = &cachedAndroidStatus{
+		entries:   entries,
+		expiresAt: time.Now().Add(defaultRevocationCacheDuration),
+	}
+	c.mu.Unlock()
+	return entries, nil
+}
+
+// isRevoked returns if the certificate is revoked, or an error if the status
+// cannot be determined.
+func (c *RevocationChecker) isRevoked(ctx context.Context, crt, issuer *x509.Certificate) (bool, error) {
+	var errs []error
+	if len(crt.OCSPServer) > 0 {
+		status, err := c.ocspStatus(ctx, crt, issuer)
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case status == ocsp.Good:
+			return false, nil
+		case status == ocsp.Revoked:
+			return true, nil
+		default:
+			errs = append(errs, errors.New("ocsp status is unknown"))
+		}
+	}
+	for _, u := range crt.CRLDistributionPoints {
+		crl, err := c.getCRL(ctx, u, issuer)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, rc := range crl.RevokedCertificates {
+			if rc.SerialNumber.Cmp(crt.SerialNumber) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	if len(errs) == 0 {
+		return false, errNoRevocationInfo
+	}
+	return false, errors.Join(errs...)
+}
+
+func (c *RevocationChecker) ocspStatus(ctx context.Context, crt, issuer *x509.Certificate) (int, error) {
+	sum := sha256.Sum256(append(append([]byte{}, issuer.Raw...), crt.SerialNumber.Bytes()...))
+	key := hex.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	cached, ok := c.ocsp[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.status, nil
+	}
+
+	req, err := ocsp.CreateRequest(crt, issuer, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating ocsp request: %w", err)
+	}
+
+	var errs []error
+	for _, server := range crt.OCSPServer {
+		b, err := c.fetch(ctx, http.MethodPost, server, req, maxOCSPResponseSize)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp, err := ocsp.ParseResponseForCert(b, crt, issuer)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error parsing ocsp response from %s: %w", server, err))
+			continue
+		}
+		c.mu.Lock()
+		evictExpired(c.ocsp, c.cacheSize, func(v *cachedOCSP) time.Time { return v.expiresAt })
+		c.ocsp[key] = &cachedOCSP{
+			status:    resp.Status,
+			expiresAt: expiresAt(resp.NextUpdate),
+		}
+		c.mu.Unlock()
+		return resp.Status, nil
+	}
+	return 0, errors.Join(errs...)
+}
+
+func (c *RevocationChecker) getCRL(ctx context.Context, u string, issuer *x509.Certificate) (*x509.RevocationList, error) {
+	c.mu.Lock()
+	cached, ok := c.crls[u]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		if err := cached.crl.CheckSignatureFrom(issuer); err == nil {
+			return cached.crl, nil
+		}
+	}
+
+	b, err := c.fetch(ctx, http.MethodGet, u, nil, maxCRLSize)
+	if err != nil {
+		return nil, err
+	}
+	crl, err := x509.ParseRevocationList(b)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing crl from %s: %w", u, err)
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("error verifying crl from %s: %w", u, err)
+	}
+	if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+		return nil, fmt.Errorf("crl from %s has expired", u)
+	}
+
+	c.mu.Lock()
+	evictExpired(c.crls, c.cacheSize, func(v *cachedCRL) time.Time { return v.expiresAt })
+	c.crls[u] = &cachedCRL{
+		crl:       crl,
+		expiresAt: expiresAt(crl.NextUpdate),
+	}
+	c.mu.Unlock()
+	return crl, nil
+}
+
+func (c *RevocationChecker) fetch(ctx context.Context, method, u string, body []byte, maxSize int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request for %s: %w", u, err)
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/ocsp-request")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error doing %s %s: %w", method, u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("error doing %s %s: status code %d", method, u, resp.StatusCode)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", u, err)
+	}
+	return b, nil
+}
+
+// evictExpired makes room for a new entry in a cache with the given maximum
+// size. It removes the expired entries, and if the cache is still full, the
+// entry that expires first.
+func evictExpired[T any](m map[string]T, size int, expiresAt func(T) time.Time) {
+	if len(m) < size {
+		return
+	}
+	now := time.Now()
+	var (
+		first    string
+		firstExp time.Time
+	)
+	for k, v := range m {
+		exp := expiresAt(v)
+		if !now.Before(exp) {
+			delete(m, k)
+			continue
+		}
+		if first == "" || exp.Before(firstExp) {
+			first, firstExp = k, exp
+		}
+	}
+	if len(m) >= size && first != "" {
+		delete(m, first)
+	}
+}
+
+// expiresAt returns the time a revocation response with the given next update
+// is cached.
+func expiresAt(nextUpdate time.Time) time.Time {
+	if nextUpdate.IsZero() {
+		return time.Now().Add(defaultRevocationCacheDuration)
+	}
+	return nextUpdate
+}
+
+type revocationCheckerKey struct{}
+
+var (
+	defaultRevocationChecker     *RevocationChecker
+	defaultRevocationCheckerOnce sync.Once
+)
+
+// NewRevocationCheckerContext adds the given revocation checker to the context.
+func NewRevocationCheckerContext(ctx context.Context, c *RevocationChecker) context.Context {
+	return context.WithValue(ctx, revocationCheckerKey{}, c)
+}
+
+// RevocationCheckerFromContext returns the revocation checker from the given
+// context.
+func RevocationCheckerFromContext(ctx context.Context) (c *RevocationChecker, ok bool) {
+	c, ok = ctx.Value(revocationCheckerKey{}).(*RevocationChecker)
+	return
+}
+
+// MustRevocationCheckerFromContext returns the revocation checker from the
+// given context. It will return a shared default instance if it does not
+// exist.
+func MustRevocationCheckerFromContext(ctx context.Context) *RevocationChecker {
+	if c, ok := RevocationCheckerFromContext(ctx); ok {
+		return c
+	}
+	defaultRevocationCheckerOnce.Do(func() {
+		defaultRevocationChecker = NewRevocationChecker(nil)
+	})
+	return defaultRevocationChecker
+}
@@ -0,0 +1,237 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func TestRevocationChecker_Check(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	var crlRequests, ocspRequests int32
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mustLeaf := func(t *testing.T, serial int64, crl, ocspServer bool) *x509.Certificate {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "attestation cert"},
+			PublicKey:    key.Public(),
+		}
+		if crl {
+			tmpl.CRLDistributionPoints = []string{srv.URL + "/crl"}
+		}
+		if ocspServer {
+			tmpl.OCSPServer = []string{srv.URL + "/ocsp"}
+		}
+		crt, err := ca.Sign(tmpl)
+		require.NoError(t, err)
+		return crt
+	}
+
+	good := mustLeaf(t, 1, true, true)
+	revoked := mustLeaf(t, 2, true, true)
+	crlOnly := mustLeaf(t, 3, true, false)
+	crlRevoked := mustLeaf(t, 4, true, false)
+	ocspUnknown := mustLeaf(t, 5, false, true)
+	noURLs := mustLeaf(t, 6, false, false)
+
+	now := time.Now()
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: now.Add(-time.Minute),
+		NextUpdate: now.Add(time.Hour),
+		RevokedCertificates: []pkix.RevokedCertificate{
+			{SerialNumber: crlRevoked.SerialNumber, RevocationTime: now.Add(-time.Minute)},
+		},
+	}, ca.Intermediate, ca.Signer)
+	require.NoError(t, err)
+
+	mux.HandleFunc("/crl", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&crlRequests, 1)
+		w.Write(crl)
+	})
+	mux.HandleFunc("/ocsp", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ocspRequests, 1)
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req, err := ocsp.ParseRequest(b)
+		require.NoError(t, err)
+
+		status := ocsp.Good
+		switch req.SerialNumber.Int64() {
+		case 2:
+			status = ocsp.Revoked
+		case 5:
+			status = ocsp.Unknown
+		}
+		resp, err := ocsp.CreateResponse(ca.Intermediate, ca.Intermediate, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   now.Add(-time.Minute),
+			NextUpdate:   now.Add(time.Hour),
+			RevokedAt:    now.Add(-time.Minute),
+		}, ca.Signer)
+		require.NoError(t, err)
+		w.Write(resp)
+	})
+
+	chain := func(crt *x509.Certificate) []*x509.Certificate {
+		return []*x509.Certificate{crt, ca.Intermediate, ca.Root}
+	}
+
+	ctx := context.Background()
+	c := NewRevocationChecker(srv.Client())
+	tests := []struct {
+		name    string
+		chain   []*x509.Certificate
+		strict  bool
+		wantErr error
+	}{
+		{"ok ocsp", chain(good), true, nil},
+		{"ok crl", chain(crlOnly), true, nil},
+		{"ok unknown soft-fail", chain(ocspUnknown), false, nil},
+		{"ok no urls soft-fail", chain(noURLs), false, nil},
+		{"fail ocsp revoked", chain(revoked), false, ErrCertificateRevoked},
+		{"fail crl revoked", chain(crlRevoked), false, ErrCertificateRevoked},
+		{"fail unknown", chain(ocspUnknown), true, ErrRevocationUnknown},
+		{"fail no urls", chain(noURLs), true, ErrRevocationUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.Check(ctx, tt.chain, tt.strict)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	// Responses are cached
+	crls, responses := atomic.LoadInt32(&crlRequests), atomic.LoadInt32(&ocspRequests)
+	assert.NoError(t, c.Check(ctx, chain(good), true))
+	assert.NoError(t, c.Check(ctx, chain(crlOnly), true))
+	assert.Equal(t, crls, atomic.LoadInt32(&crlRequests))
+	assert.Equal(t, responses, atomic.LoadInt32(&ocspRequests))
+}
+
+func TestRevocationChecker_CheckAndroidKey(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	mustLeaf := func(t *testing.T, serial int64) *x509.Certificate {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		crt, err := ca.Sign(&x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "Android Keystore Key"},
+			PublicKey:    key.Public(),
+		})
+		require.NoError(t, err)
+		return crt
+	}
+	good := mustLeaf(t, 0x1a)
+	revoked := mustLeaf(t, 0x2b)
+	suspended := mustLeaf(t, 0x3c)
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, `{"entries":{"2B":{"status":"REVOKED","reason":"KEY_COMPROMISE"},"3c":{"status":"SUSPENDED"}}}`)
+	}))
+	defer srv.Close()
+
+	tmp := androidAttestationStatusURL
+	t.Cleanup(func() { androidAttestationStatusURL = tmp })
+	androidAttestationStatusURL = srv.URL
+
+	c := NewRevocationChecker(srv.Client())
+	ctx := context.Background()
+	assert.NoError(t, c.CheckAndroidKey(ctx, []*x509.Certificate{good, ca.Intermediate, ca.Root}, true))
+	assert.ErrorIs(t, c.CheckAndroidKey(ctx, []*x509.Certificate{revoked, ca.Intermediate, ca.Root}, true), ErrCertificateRevoked)
+	assert.ErrorIs(t, c.CheckAndroidKey(ctx, []*x509.Certificate{suspended, ca.Intermediate, ca.Root}, false), ErrCertificateRevoked)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// The status list cannot be retrieved.
+	androidAttestationStatusURL = srv.URL + "/missing"
+	srv.Config.Handler = http.NotFoundHandler()
+	c = NewRevocationChecker(srv.Client())
+	assert.NoError(t, c.CheckAndroidKey(ctx, []*x509.Certificate{revoked}, false))
+	assert.ErrorIs(t, c.CheckAndroidKey(ctx, []*x509.Certificate{revoked}, true), ErrRevocationUnknown)
+}
+
+func Test_evictExpired(t *testing.T) {
+	now := time.Now()
+	m := map[string]time.Time{
+		"expired": now.Add(-time.Minute),
+		"first":   now.Add(time.Minute),
+		"second":  now.Add(time.Hour),
+	}
+	get := func(v time.Time) time.Time { return v }
+
+	evictExpired(m, 5, get)
+	assert.Len(t, m, 3)
+
+	// Removing the expired entry makes room for a new one.
+	evictExpired(m, 3, get)
+	assert.Len(t, m, 2)
+	assert.NotContains(t, m, "expired")
+
+	// The entry that expires first is removed.
+	evictExpired(m, 2, get)
+	assert.Len(t, m, 1)
+	assert.Contains(t, m, "second")
+}
+
+func Test_checkAttestationRevocation(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "attestation cert"},
+		PublicKey: key.Public(),
+	})
+	require.NoError(t, err)
+	chains := [][]*x509.Certificate{{leaf, ca.Intermediate, ca.Root}}
+
+	withPolicy := func(policy provisioner.ACMERevocationPolicy) Provisioner {
+		return &MockProvisioner{
+			MgetRevocationPolicy: func() provisioner.ACMERevocationPolicy { return policy },
+		}
+	}
+
+	ctx := NewRevocationCheckerContext(context.Background(), NewRevocationChecker(nil))
+	assert.NoError(t, checkAttestationRevocation(ctx, withPolicy(provisioner.RevocationPolicyDisable), "step", chains))
+	assert.NoError(t, checkAttestationRevocation(ctx, withPolicy(provisioner.RevocationPolicySoftFail), "step", chains))
+	err = checkAttestationRevocation(ctx, withPolicy(provisioner.RevocationPolicyRequire), "step", chains)
+	var acmeErr *Error
+	if assert.ErrorAs(t, err, &acmeErr) {
+		assert.Equal(t, "urn:ietf:params:acme:error:badAttestationStatement", acmeErr.Type)
+	}
+}
@@ -0,0 +1,251 @@
+package acme
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.step.sm/crypto/jose"
+)
+
+const (
+	// defaultValidationWorkers is the default number of challenges validated
+	// concurrently by a ValidationQueue.
+	defaultValidationWorkers = 10
+	// maxValidationRetryInterval is the maximum time to wait between two
+	// validation attempts of a challenge.
+	maxValidationRetryInterval = 10 * time.Minute
+)
+
+// ValidationQueue validates challenges in the background using a pool of
+// workers. Challenges that fail because of a connection or DNS error are kept
+// in the processing status and retried with an exponential backoff until the
+// number of retries is exhausted, then they are marked as invalid.
+type ValidationQueue struct {
+	jobs    chan *validationJob
+	mu      sync.Mutex
+	queued  map[string]bool
+	timers  map[string]*time.Timer
+	done    chan struct{}
+	wg      sync.WaitGroup
+	stopped sync.Once
+}
+
+type validationJob struct {
+	ctx      context.Context
+	db       DB
+	ch       *Challenge
+	jwk      *jose.JSONWebKey
+	retries  int
+	interval time.Duration
+}
+
+// NewValidationQueue creates a new ValidationQueue and starts the given number
+// of workers. If workers is not a positive number, a default number of workers
+// will be used.
+func NewValidationQueue(workers int) *ValidationQueue {
+	if workers <= 0 {
+		workers = defaultValidationWorkers
+	}
+	q := &ValidationQueue{
+		jobs:   make(chan *validationJob, workers),
+		queued: make(map[string]bool),
+		timers: make(map[string]*time.Timer),
+		done:   make(chan struct{}),
+	}
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+// Enqueue schedules the validation of the given challenge. Pending challenges
+// are moved to the processing status and stored before being queued.
+// Challenges already processing are only queued if they are not already in
+// the queue, for example after a restart of the server. Challenges in any
+// other status are ignored.
+func (q *ValidationQueue) Enqueue(ctx context.Context, db DB, ch *Challenge, jwk *jose.JSONWebKey, retries int, interval time.Duration) error {
+	if ch.Status != StatusPending && ch.Status != StatusProcessing {
+		return nil
+	}
+	if !q.markQueued(ch.ID) {
+		return nil
+	}
+	if ch.Status == StatusPending {
+		ch.Status = StatusProcessing
+		ch.RetryCount = 0
+		ch.RetryAfter = clock.Now()
+		if err := db.UpdateChallenge(ctx, ch); err != nil {
+			q.unmarkQueued(ch.ID)
+			return WrapErrorISE(err, "error updating challenge")
+		}
+		if err := auditChallenge(ctx, ch, StatusPending); err != nil {
+			q.unmarkQueued(ch.ID)
+			return WrapErrorISE(err, "error writing audit log")
+		}
+	}
+
+	// The copy of the challenge used by the worker must not be shared with
+	// the request.
+	c := *ch
+	q.push(&validationJob{
+		ctx:      detachedContext{ctx},
+		db:       db,
+		ch:       &c,
+		jwk:      jwk,
+		retries:  retries,
+		interval: interval,
+	}, 0)
+	return nil
+}
+
+// Stop stops the workers and the scheduled retries. Challenges that were not
+// validated remain in the processing status and will be queued again the
+// next time they are requested.
+func (q *ValidationQueue) Stop() {
+	q.stopped.Do(func() {
+		close(q.done)
+		q.mu.Lock()
+		for id, t := range q.timers {
+			t.Stop()
+			delete(q.timers, id)
+		}
+		q.mu.Unlock()
+		q.wg.Wait()
+	})
+}
+
+// markQueued marks the challenge as queued, it returns false if it was
+// already queued.
+func (q *ValidationQueue) markQueued(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queued[id] {
+		return false
+	}
+	q.queued[id] = true
+	return true
+}
+
+func (q *ValidationQueue) unmarkQueued(id string) {
+	q.mu.Lock()
+	delete(q.queued, id)
+	delete(q.timers, id)
+	q.mu.Unlock()
+}
+
+// push sends the job to the workers after the given delay.
+func (q *ValidationQueue) push(job *validationJob, delay time.Duration) {
+	send := func() {
+		select {
+		case q.jobs <- job:
+		case <-q.done:
+			q.unmarkQueued(job.ch.ID)
+		}
+	}
+	if delay <= 0 {
+		go send()
+		return
+	}
+	q.mu.Lock()
+	q.timers[job.ch.ID] = time.AfterFunc(delay, send)
+	q.mu.Unlock()
+}
+
+func (q *ValidationQueue) worker() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.done:
+			return
+		case job := <-q.jobs:
+			q.process(job)
+		}
+	}
+}
+
+func (q *ValidationQueue) process(job *validationJob) {
+	ch := job.ch
+	if err := ch.validate(job.ctx, job.db, job.jwk, nil); err != nil {
+		log.Printf("error validating acme challenge %s: %v", ch.ID, err)
+	}
+	if ch.Status != StatusProcessing {
+		q.unmarkQueued(ch.ID)
+		return
+	}
+
+	// Give up if the retries have been exhausted.
+	if ch.RetryCount >= job.retries {
+		if err := ch.invalidateProcessing(job.ctx, job.db); err != nil {
+			log.Printf("error invalidating acme challenge %s: %v", ch.ID, err)
+		}
+		q.unmarkQueued(ch.ID)
+		return
+	}
+
+	ch.RetryCount++
+	delay := retryInterval(job.interval, ch.RetryCount)
+	ch.RetryAfter = clock.Now().Add(delay)
+	if err := job.db.UpdateChallenge(job.ctx, ch); err != nil {
+		log.Printf("error updating acme challenge %s: %v", ch.ID, err)
+	}
+	q.push(job, delay)
+}
+
+// invalidateProcessing marks a challenge in the processing status that cannot
+// be retried anymore as invalid, keeping the error of the last validation.
+func (ch *Challenge) invalidateProcessing(ctx context.Context, db DB) error {
+	ch.Status = StatusInvalid
+	ch.RetryAfter = time.Time{}
+	if ch.Error == nil {
+		ch.Error = NewErrorISE("challenge validation failed after %d retries", ch.RetryCount)
+	}
+	if err := db.UpdateChallenge(ctx, ch); err != nil {
+		return WrapErrorISE(err, "error updating challenge")
+	}
+	if err := auditChallenge(ctx, ch, StatusProcessing); err != nil {
+		return WrapErrorISE(err, "error writing audit log")
+	}
+	return nil
+}
+
+// retryInterval returns the time to wait before the given retry, doubling the
+// initial interval on every retry.
+func retryInterval(interval time.Duration, retry int) time.Duration {
+	d := interval
+	for i := 1; i < retry && d < maxValidationRetryInterval; i++ {
+		d *= 2
+	}
+	if d > maxValidationRetryInterval {
+		d = maxValidationRetryInterval
+	}
+	return d
+}
+
+// detachedContext is a context that keeps the values of the parent context but
+// is never canceled. It is used to validate challenges after the request that
+// queued them has finished.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+func (c detachedContext) Value(key any) any                     { return c.parent.Value(key) }
+
+type validationQueueKey struct{}
+
+// NewValidationQueueContext adds the given validation queue to the context.
+func NewValidationQueueContext(ctx context.Context, q *ValidationQueue) context.Context {
+	return context.WithValue(ctx, validationQueueKey{}, q)
+}
+
+// ValidationQueueFromContext returns the validation queue from the given
+// context.
+func ValidationQueueFromContext(ctx context.Context) (q *ValidationQueue, ok bool) {
+	q, ok = ctx.Value(validationQueueKey{}).(*ValidationQueue)
+	return
+}
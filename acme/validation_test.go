@@ -0,0 +1,173 @@
+package acme
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+)
+
+func TestValidationQueue_Enqueue(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	txtRecord := base64.RawURLEncoding.EncodeToString(h[:])
+
+	// run enqueues a dns-01 challenge that fails the given number of lookups
+	// and returns the stored challenges and the final one.
+	run := func(t *testing.T, failures, retries int) ([]Challenge, Challenge) {
+		var mu sync.Mutex
+		var updates []Challenge
+		done := make(chan Challenge, 1)
+		db := &MockDB{
+			MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+				mu.Lock()
+				defer mu.Unlock()
+				updates = append(updates, *ch)
+				if ch.Status == StatusValid || ch.Status == StatusInvalid {
+					done <- *ch
+				}
+				return nil
+			},
+		}
+
+		var lookups int
+		ctx := NewClientContext(context.Background(), &mockClient{
+			lookupTxt: func(name string) ([]string, error) {
+				assert.Equal(t, "_acme-challenge.example.com", name)
+				if lookups++; lookups <= failures {
+					return nil, errors.New("force")
+				}
+				return []string{txtRecord}, nil
+			},
+		})
+
+		q := NewValidationQueue(1)
+		defer q.Stop()
+
+		ch := &Challenge{ID: "chID", Type: DNS01, Status: StatusPending, Token: "token", Value: "example.com"}
+		require.NoError(t, q.Enqueue(ctx, db, ch, jwk, retries, time.Millisecond))
+		assert.Equal(t, StatusProcessing, ch.Status)
+		// Enqueuing the same challenge again is a no-op.
+		require.NoError(t, q.Enqueue(ctx, db, ch, jwk, retries, time.Millisecond))
+
+		select {
+		case got := <-done:
+			mu.Lock()
+			defer mu.Unlock()
+			return updates, got
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for challenge validation")
+		}
+		return nil, Challenge{}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		updates, got := run(t, 0, 3)
+		assert.Equal(t, StatusValid, got.Status)
+		assert.Equal(t, 0, got.RetryCount)
+		assert.Len(t, updates, 2)
+	})
+
+	t.Run("ok after retries", func(t *testing.T) {
+		updates, got := run(t, 2, 3)
+		assert.Equal(t, StatusValid, got.Status)
+		assert.Equal(t, 2, got.RetryCount)
+		assert.Nil(t, got.Error)
+		for _, u := range updates[:len(updates)-1] {
+			assert.Equal(t, StatusProcessing, u.Status)
+		}
+	})
+
+	t.Run("fail retries exhausted", func(t *testing.T) {
+		_, got := run(t, 10, 2)
+		assert.Equal(t, StatusInvalid, got.Status)
+		assert.Equal(t, 2, got.RetryCount)
+		assert.True(t, got.RetryAfter.IsZero())
+		if assert.NotNil(t, got.Error) {
+			assert.Equal(t, "urn:ietf:params:acme:error:dns", got.Error.Type)
+		}
+	})
+
+	t.Run("ignore valid", func(t *testing.T) {
+		q := NewValidationQueue(1)
+		defer q.Stop()
+		ch := &Challenge{ID: "chID", Type: DNS01, Status: StatusValid}
+		assert.NoError(t, q.Enqueue(context.Background(), &MockDB{}, ch, jwk, 3, time.Millisecond))
+		assert.Equal(t, StatusValid, ch.Status)
+	})
+
+	t.Run("fail update", func(t *testing.T) {
+		q := NewValidationQueue(1)
+		defer q.Stop()
+		ch := &Challenge{ID: "chID", Type: DNS01, Status: StatusPending}
+		err := q.Enqueue(context.Background(), &MockDB{MockError: errors.New("force")}, ch, jwk, 3, time.Millisecond)
+		assert.Error(t, err)
+	})
+}
+
+func TestChallenge_Validate_processing(t *testing.T) {
+	jwk, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	require.NoError(t, err)
+	keyAuth, err := KeyAuthorization("token", jwk)
+	require.NoError(t, err)
+	h := sha256.Sum256([]byte(keyAuth))
+	txtRecord := base64.RawURLEncoding.EncodeToString(h[:])
+
+	// run validates a dns-01 challenge left in the processing status by a
+	// validation queue and returns the last stored challenge.
+	run := func(t *testing.T, lookupErr error) *Challenge {
+		var stored *Challenge
+		db := &MockDB{
+			MockUpdateChallenge: func(ctx context.Context, ch *Challenge) error {
+				c := *ch
+				stored = &c
+				return nil
+			},
+		}
+		ctx := NewClientContext(context.Background(), &mockClient{
+			lookupTxt: func(name string) ([]string, error) {
+				return []string{txtRecord}, lookupErr
+			},
+		})
+		ch := &Challenge{
+			ID: "chID", Type: DNS01, Status: StatusProcessing, Token: "token", Value: "example.com",
+			RetryCount: 1, RetryAfter: time.Now().Add(time.Minute),
+		}
+		require.NoError(t, ch.Validate(ctx, db, jwk, nil))
+		require.NotNil(t, stored)
+		assert.Equal(t, ch.Status, stored.Status)
+		return stored
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		got := run(t, nil)
+		assert.Equal(t, StatusValid, got.Status)
+		assert.Nil(t, got.Error)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		got := run(t, errors.New("force"))
+		assert.Equal(t, StatusInvalid, got.Status)
+		assert.True(t, got.RetryAfter.IsZero())
+		if assert.NotNil(t, got.Error) {
+			assert.Equal(t, "urn:ietf:params:acme:error:dns", got.Error.Type)
+		}
+	})
+}
+
+func Test_retryInterval(t *testing.T) {
+	assert.Equal(t, 10*time.Second, retryInterval(10*time.Second, 1))
+	assert.Equal(t, 20*time.Second, retryInterval(10*time.Second, 2))
+	assert.Equal(t, 40*time.Second, retryInterval(10*time.Second, 3))
+	assert.Equal(t, maxValidationRetryInterval, retryInterval(10*time.Second, 100))
+}
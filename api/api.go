@@ -53,8 +53,10 @@ type Authority interface {
 	GetEncryptedKey(kid string) (string, error)
 	GetRoots() ([]*x509.Certificate, error)
 	GetFederation() ([]*x509.Certificate, error)
+	GetIntermediates() ([]*x509.Certificate, error)
 	Version() authority.Version
 	GetCertificateRevocationList() ([]byte, error)
+	Health() error
 }
 
 // mustAuthority will be replaced on unit tests.
@@ -218,6 +220,7 @@ type VersionResponse struct {
 // HealthResponse is the response object that returns the health of the server.
 type HealthResponse struct {
 	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
 }
 
 // RootResponse is the response object that returns the PEM of a root certificate.
@@ -255,22 +258,38 @@ func scepFromProvisioner(p *provisioner.SCEP) *models.SCEP {
 	}
 }
 
+// acmeFromProvisioner returns a copy of the ACME provisioner with the client
+// secret of the device inventory redacted.
+func acmeFromProvisioner(p *provisioner.ACME) *provisioner.ACME {
+	if p.DeviceInventory == nil {
+		return p
+	}
+	cp := *p
+	inventory := *p.DeviceInventory
+	inventory.ClientSecret = redacted
+	cp.DeviceInventory = &inventory
+	return &cp
+}
+
 // MarshalJSON implements json.Marshaler. It marshals the ProvisionersResponse
 // into a byte slice.
 //
 // Special treatment is given to the SCEP provisioner, as it contains a
 // challenge secret that MUST NOT be leaked in (public) HTTP responses. The
-// challenge value is thus redacted in HTTP responses.
+// challenge value is thus redacted in HTTP responses. For the same reason,
+// the client secret of the device inventory of the ACME provisioner is
+// redacted.
 func (p ProvisionersResponse) MarshalJSON() ([]byte, error) {
 	var responseProvisioners provisioner.List
 	for _, item := range p.Provisioners {
-		scepProv, ok := item.(*provisioner.SCEP)
-		if !ok {
+		switch prov := item.(type) {
+		case *provisioner.SCEP:
+			responseProvisioners = append(responseProvisioners, scepFromProvisioner(prov))
+		case *provisioner.ACME:
+			responseProvisioners = append(responseProvisioners, acmeFromProvisioner(prov))
+		default:
 			responseProvisioners = append(responseProvisioners, item)
-			continue
 		}
-
-		responseProvisioners = append(responseProvisioners, scepFromProvisioner(scepProv))
 	}
 
 	var list = struct {
@@ -290,14 +309,19 @@ type ProvisionerKeyResponse struct {
 	Key string `json:"key"`
 }
 
-// RootsResponse is the response object of the roots request.
+// RootsResponse is the response object of the roots request. The next cursor
+// is only set if the request was paginated and there are more certificates.
 type RootsResponse struct {
 	Certificates []Certificate `json:"crts"`
+	NextCursor   string        `json:"nextCursor,omitempty"`
 }
 
-// FederationResponse is the response object of the federation request.
+// FederationResponse is the response object of the federation request. The
+// next cursor is only set if the request was paginated and there are more
+// certificates.
 type FederationResponse struct {
 	Certificates []Certificate `json:"crts"`
+	NextCursor   string        `json:"nextCursor,omitempty"`
 }
 
 // caHandler is the type used to implement the different CA HTTP endpoints.
@@ -326,11 +350,14 @@ func Route(r Router) {
 	r.MethodFunc("POST", "/rekey", Rekey)
 	r.MethodFunc("POST", "/revoke", Revoke)
 	r.MethodFunc("GET", "/crl", CRL)
+	r.MethodFunc("GET", "/intermediate", Intermediate)
 	r.MethodFunc("GET", "/provisioners", Provisioners)
 	r.MethodFunc("GET", "/provisioners/{kid}/encrypted-key", ProvisionerKey)
-	r.MethodFunc("GET", "/roots", Roots)
-	r.MethodFunc("GET", "/roots.pem", RootsPEM)
-	r.MethodFunc("GET", "/federation", Federation)
+	r.MethodFunc("GET", "/roots", compress(Roots))
+	r.MethodFunc("GET", "/roots.pem", compress(RootsPEM))
+	r.MethodFunc("GET", "/roots/digest", RootsDigest)
+	r.MethodFunc("GET", "/federation", compress(Federation))
+	r.MethodFunc("GET", "/federation/digest", FederationDigest)
 	// SSH CA
 	r.MethodFunc("POST", "/ssh/sign", SSHSign)
 	r.MethodFunc("POST", "/ssh/renew", SSHRenew)
@@ -359,8 +386,14 @@ func Version(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Health is an HTTP handler that returns the status of the server.
-func Health(w http.ResponseWriter, _ *http.Request) {
+// Health is an HTTP handler that returns the status of the server. If the
+// server is running in degraded mode, the status will be "degraded", but the
+// status code will still be 200 as the server can still serve some requests.
+func Health(w http.ResponseWriter, r *http.Request) {
+	if err := mustAuthority(r.Context()).Health(); err != nil {
+		render.JSON(w, HealthResponse{Status: "degraded", Reason: err.Error()})
+		return
+	}
 	render.JSON(w, HealthResponse{Status: "ok"})
 }
 
@@ -419,7 +452,9 @@ func ProvisionerKey(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, &ProvisionerKeyResponse{key})
 }
 
-// Roots returns all the root certificates for the CA.
+// Roots returns the root certificates for the CA. The response can be
+// paginated using the cursor and limit query parameters, and supports
+// conditional requests using the ETag and If-None-Match headers.
 func Roots(w http.ResponseWriter, r *http.Request) {
 	roots, err := mustAuthority(r.Context()).GetRoots()
 	if err != nil {
@@ -427,13 +462,25 @@ func Roots(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	certs := make([]Certificate, len(roots))
-	for i := range roots {
-		certs[i] = Certificate{roots[i]}
+	// Invalid pagination parameters fail even if the bundle is not modified.
+	cursor, limit, err := ParseCursor(r)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	certs, next, err := paginateBundle(roots, cursor, limit)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	if notModified(w, r, bundleDigest(roots)) {
+		return
 	}
 
 	render.JSONStatus(w, &RootsResponse{
 		Certificates: certs,
+		NextCursor:   next,
 	}, http.StatusCreated)
 }
 
@@ -445,6 +492,10 @@ func RootsPEM(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if notModified(w, r, bundleDigest(roots)) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/x-pem-file")
 
 	for _, root := range roots {
@@ -460,7 +511,9 @@ func RootsPEM(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Federation returns all the public certificates in the federation.
+// Federation returns the public certificates in the federation. The response
+// can be paginated using the cursor and limit query parameters, and supports
+// conditional requests using the ETag and If-None-Match headers.
 func Federation(w http.ResponseWriter, r *http.Request) {
 	federated, err := mustAuthority(r.Context()).GetFederation()
 	if err != nil {
@@ -468,13 +521,24 @@ func Federation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	certs := make([]Certificate, len(federated))
-	for i := range federated {
-		certs[i] = Certificate{federated[i]}
+	cursor, limit, err := ParseCursor(r)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	certs, next, err := paginateBundle(federated, cursor, limit)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	if notModified(w, r, bundleDigest(federated)) {
+		return
 	}
 
 	render.JSONStatus(w, &FederationResponse{
 		Certificates: certs,
+		NextCursor:   next,
 	}, http.StatusCreated)
 }
 
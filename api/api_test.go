@@ -41,6 +41,7 @@ import (
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/errs"
 	"github.com/smallstep/certificates/logging"
+	"github.com/smallstep/certificates/mdm"
 	"github.com/smallstep/certificates/templates"
 )
 
@@ -203,6 +204,7 @@ type mockAuthority struct {
 	getEncryptedKey              func(kid string) (string, error)
 	getRoots                     func() ([]*x509.Certificate, error)
 	getFederation                func() ([]*x509.Certificate, error)
+	getIntermediates             func() ([]*x509.Certificate, error)
 	getCRL                       func() ([]byte, error)
 	signSSH                      func(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	signSSHAddUser               func(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
@@ -215,6 +217,14 @@ type mockAuthority struct {
 	checkSSHHost                 func(ctx context.Context, principal, token string) (bool, error)
 	getSSHBastion                func(ctx context.Context, user string, hostname string) (*authority.Bastion, error)
 	version                      func() authority.Version
+	health                       func() error
+}
+
+func (m *mockAuthority) Health() error {
+	if m.health != nil {
+		return m.health()
+	}
+	return nil
 }
 
 func (m *mockAuthority) GetCertificateRevocationList() ([]byte, error) {
@@ -331,6 +341,13 @@ func (m *mockAuthority) GetFederation() ([]*x509.Certificate, error) {
 	return m.ret1.([]*x509.Certificate), m.err
 }
 
+func (m *mockAuthority) GetIntermediates() ([]*x509.Certificate, error) {
+	if m.getIntermediates != nil {
+		return m.getIntermediates()
+	}
+	return m.ret1.([]*x509.Certificate), m.err
+}
+
 func (m *mockAuthority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	if m.signSSH != nil {
 		return m.signSSH(ctx, key, opts, signOpts...)
@@ -856,23 +873,35 @@ func Test_caHandler_Route(t *testing.T) {
 }
 
 func Test_Health(t *testing.T) {
-	req := httptest.NewRequest("GET", "http://example.com/health", http.NoBody)
-	w := httptest.NewRecorder()
-	Health(w, req)
-
-	res := w.Result()
-	if res.StatusCode != 200 {
-		t.Errorf("caHandler.Health StatusCode = %d, wants 200", res.StatusCode)
+	tests := []struct {
+		name     string
+		health   func() error
+		expected []byte
+	}{
+		{"ok", nil, []byte("{\"status\":\"ok\"}\n")},
+		{"degraded", func() error { return errors.New("database is not writable") }, []byte("{\"status\":\"degraded\",\"reason\":\"database is not writable\"}\n")},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{health: tt.health})
+			req := httptest.NewRequest("GET", "http://example.com/health", http.NoBody)
+			w := httptest.NewRecorder()
+			Health(w, req)
 
-	body, err := io.ReadAll(res.Body)
-	res.Body.Close()
-	if err != nil {
-		t.Errorf("caHandler.Health unexpected error = %v", err)
-	}
-	expected := []byte("{\"status\":\"ok\"}\n")
-	if !bytes.Equal(body, expected) {
-		t.Errorf("caHandler.Health Body = %s, wants %s", body, expected)
+			res := w.Result()
+			if res.StatusCode != 200 {
+				t.Errorf("caHandler.Health StatusCode = %d, wants 200", res.StatusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("caHandler.Health unexpected error = %v", err)
+			}
+			if !bytes.Equal(body, tt.expected) {
+				t.Errorf("caHandler.Health Body = %s, wants %s", body, tt.expected)
+			}
+		})
 	}
 }
 
@@ -1445,6 +1474,51 @@ func Test_caHandler_RootsPEM(t *testing.T) {
 	}
 }
 
+func Test_Intermediate(t *testing.T) {
+	parsedCert := parseCertificate(certPEM)
+	tests := []struct {
+		name        string
+		query       string
+		certs       []*x509.Certificate
+		err         error
+		statusCode  int
+		contentType string
+		expect      []byte
+	}{
+		{"ok", "", []*x509.Certificate{parsedCert}, nil, http.StatusOK, "application/pkix-cert", parsedCert.Raw},
+		{"ok pem", "?pem", []*x509.Certificate{parsedCert}, nil, http.StatusOK, "application/x-pem-file", []byte(certPEM)},
+		{"fail", "", nil, errs.NotFound("intermediate certificates are not available"), http.StatusNotFound, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMustAuthority(t, &mockAuthority{ret1: tt.certs, err: tt.err})
+			req := httptest.NewRequest("GET", "http://example.com/1.0/intermediate"+tt.query, http.NoBody)
+			w := httptest.NewRecorder()
+			Intermediate(w, req)
+			res := w.Result()
+
+			if res.StatusCode != tt.statusCode {
+				t.Errorf("Intermediate StatusCode = %d, wants %d", res.StatusCode, tt.statusCode)
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Errorf("Intermediate unexpected error = %v", err)
+			}
+			if tt.statusCode < http.StatusBadRequest {
+				if ct := res.Header.Get("Content-Type"); ct != tt.contentType {
+					t.Errorf("Intermediate Content-Type = %s, wants %s", ct, tt.contentType)
+				}
+				if !bytes.Equal(bytes.TrimSpace(body), bytes.TrimSpace(tt.expect)) {
+					t.Errorf("Intermediate Body = %s, wants %s", body, tt.expect)
+				}
+			}
+		})
+	}
+}
+
 func Test_Federation(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
@@ -1677,6 +1751,32 @@ func TestProvisionersResponse_MarshalJSON(t *testing.T) {
 	sassert.Equal(t, expList, r.Provisioners)
 }
 
+func Test_Provisioners_redactsDeviceInventory(t *testing.T) {
+	acmeProv := &provisioner.ACME{
+		Type: "ACME",
+		Name: "acme",
+		DeviceInventory: &mdm.Config{
+			Type:         mdm.Jamf,
+			URL:          "https://jamf.example.com",
+			ClientID:     "client-id",
+			ClientSecret: "jamf-client-secret",
+		},
+	}
+	mockMustAuthority(t, &mockAuthority{ret1: provisioner.List{acmeProv}, ret2: ""})
+
+	w := httptest.NewRecorder()
+	Provisioners(w, httptest.NewRequest("GET", "http://example.com/provisioners", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.String()
+	sassert.NotContains(t, body, "jamf-client-secret")
+	sassert.Contains(t, body, `"clientSecret":"*** REDACTED ***"`)
+	sassert.Contains(t, body, `"clientID":"client-id"`)
+
+	// The provisioner itself is not modified.
+	sassert.Equal(t, "jamf-client-secret", acmeProv.DeviceInventory.ClientSecret)
+}
+
 const (
 	fixtureECDSACertificate = `ecdsa-sha2-nistp256-cert-v01@openssh.com AAAAKGVjZHNhLXNoYTItbmlzdHAyNTYtY2VydC12MDFAb3BlbnNzaC5jb20AAAAgLnkvSk4odlo3b1R+RDw+LmorL3RkN354IilCIVFVen4AAAAIbmlzdHAyNTYAAABBBHjKHss8WM2ffMYlavisoLXR0I6UEIU+cidV1ogEH1U6+/SYaFPrlzQo0tGLM5CNkMbhInbyasQsrHzn8F1Rt7nHg5/tcSf9qwAAAAEAAAAGaGVybWFuAAAACgAAAAZoZXJtYW4AAAAAY8kvJwAAAABjyhBjAAAAAAAAAIIAAAAVcGVybWl0LVgxMS1mb3J3YXJkaW5nAAAAAAAAABdwZXJtaXQtYWdlbnQtZm9yd2FyZGluZwAAAAAAAAAWcGVybWl0LXBvcnQtZm9yd2FyZGluZwAAAAAAAAAKcGVybWl0LXB0eQAAAAAAAAAOcGVybWl0LXVzZXItcmMAAAAAAAAAAAAAAGgAAAATZWNkc2Etc2hhMi1uaXN0cDI1NgAAAAhuaXN0cDI1NgAAAEEE/ayqpPrZZF5uA1UlDt4FreTf15agztQIzpxnWq/XoxAHzagRSkFGkdgFpjgsfiRpP8URHH3BZScqc0ZDCTxhoQAAAGQAAAATZWNkc2Etc2hhMi1uaXN0cDI1NgAAAEkAAAAhAJuP1wCVwoyrKrEtHGfFXrVbRHySDjvXtS1tVTdHyqymAAAAIBa/CSSzfZb4D2NLP+eEmOOMJwSjYOiNM8fiOoAaqglI herman`
 )
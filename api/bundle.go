@@ -0,0 +1,119 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/errs"
+)
+
+// BundleDigestResponse is the response object of the roots and federation
+// digest requests. Clients can poll these endpoints and only fetch the full
+// bundle if the digest has changed.
+type BundleDigestResponse struct {
+	Digest string `json:"digest"`
+	Count  int    `json:"count"`
+}
+
+// compress compresses the response of the given handler if the client
+// supports it.
+func compress(h http.HandlerFunc) http.HandlerFunc {
+	return middleware.Compress(5, "application/json", "application/x-pem-file")(h).ServeHTTP
+}
+
+// RootsDigest returns the digest of the root certificates of the CA.
+func RootsDigest(w http.ResponseWriter, r *http.Request) {
+	roots, err := mustAuthority(r.Context()).GetRoots()
+	if err != nil {
+		render.Error(w, errs.ForbiddenErr(err, "error getting roots"))
+		return
+	}
+	renderBundleDigest(w, r, roots)
+}
+
+// FederationDigest returns the digest of the certificates in the federation.
+func FederationDigest(w http.ResponseWriter, r *http.Request) {
+	federated, err := mustAuthority(r.Context()).GetFederation()
+	if err != nil {
+		render.Error(w, errs.ForbiddenErr(err, "error getting federated roots"))
+		return
+	}
+	renderBundleDigest(w, r, federated)
+}
+
+func renderBundleDigest(w http.ResponseWriter, r *http.Request, certs []*x509.Certificate) {
+	digest := bundleDigest(certs)
+	if notModified(w, r, digest) {
+		return
+	}
+	render.JSON(w, &BundleDigestResponse{
+		Digest: digest,
+		Count:  len(certs),
+	})
+}
+
+// bundleDigest returns the hex-encoded SHA-256 of the given certificates. It
+// is used as the version of a bundle.
+func bundleDigest(certs []*x509.Certificate) string {
+	h := sha256.New()
+	for _, crt := range certs {
+		h.Write(crt.Raw)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// notModified sets the ETag header with the given digest, and if the request
+// If-None-Match header matches it, writes a 304 Not Modified response and
+// returns true.
+func notModified(w http.ResponseWriter, r *http.Request, digest string) bool {
+	etag := `W/"` + digest + `"`
+	w.Header().Set("ETag", etag)
+	for _, v := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// paginateBundle returns the page of certificates starting at the given
+// cursor, with at most limit elements, and the cursor of the next page. The
+// cursor is the position of the first certificate in the page. If limit is 0,
+// all the remaining certificates are returned.
+func paginateBundle(certs []*x509.Certificate, cursor string, limit int) ([]Certificate, string, error) {
+	var start int
+	if cursor != "" {
+		var err error
+		if start, err = strconv.Atoi(cursor); err != nil || start < 0 || start > len(certs) {
+			return nil, "", errs.BadRequest("cursor '%s' is not valid", cursor)
+		}
+	}
+	if limit < 0 {
+		return nil, "", errs.BadRequest("limit '%d' is not valid", limit)
+	}
+
+	end := len(certs)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	page := make([]Certificate, 0, end-start)
+	for _, crt := range certs[start:end] {
+		page = append(page, Certificate{crt})
+	}
+
+	var next string
+	if end < len(certs) {
+		next = strconv.Itoa(end)
+	}
+	return page, next, nil
+}
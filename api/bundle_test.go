@@ -0,0 +1,169 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_paginateBundle(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	cert := parseCertificate(certPEM)
+	certs := []*x509.Certificate{root, cert, root}
+
+	tests := []struct {
+		name     string
+		cursor   string
+		limit    int
+		want     []Certificate
+		wantNext string
+		wantErr  bool
+	}{
+		{"ok all", "", 0, []Certificate{{root}, {cert}, {root}}, "", false},
+		{"ok first page", "", 2, []Certificate{{root}, {cert}}, "2", false},
+		{"ok last page", "2", 2, []Certificate{{root}}, "", false},
+		{"ok exact page", "1", 2, []Certificate{{cert}, {root}}, "", false},
+		{"ok end", "3", 2, []Certificate{}, "", false},
+		{"fail cursor", "foo", 0, nil, "", true},
+		{"fail negative cursor", "-1", 0, nil, "", true},
+		{"fail cursor out of range", "4", 0, nil, "", true},
+		{"fail limit", "", -1, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := paginateBundle(certs, tt.cursor, tt.limit)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantNext, next)
+		})
+	}
+}
+
+func Test_notModified(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{"ok no header", "", false},
+		{"ok other", `W/"other"`, false},
+		{"ok weak", `W/"digest"`, true},
+		{"ok strong", `"digest"`, true},
+		{"ok list", `"other", W/"digest"`, true},
+		{"ok wildcard", "*", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/roots", http.NoBody)
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			assert.Equal(t, tt.want, notModified(w, r, "digest"))
+			assert.Equal(t, `W/"digest"`, w.Header().Get("ETag"))
+			if tt.want {
+				assert.Equal(t, http.StatusNotModified, w.Code)
+			}
+		})
+	}
+}
+
+func Test_RootsDigest(t *testing.T) {
+	roots := []*x509.Certificate{parseCertificate(rootPEM), parseCertificate(certPEM)}
+	digest := bundleDigest(roots)
+
+	t.Run("ok", func(t *testing.T) {
+		mockMustAuthority(t, &mockAuthority{ret1: roots})
+		w := httptest.NewRecorder()
+		RootsDigest(w, httptest.NewRequest("GET", "/roots/digest", http.NoBody))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `W/"`+digest+`"`, w.Header().Get("ETag"))
+
+		var resp BundleDigestResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, BundleDigestResponse{Digest: digest, Count: 2}, resp)
+	})
+
+	t.Run("ok not modified", func(t *testing.T) {
+		mockMustAuthority(t, &mockAuthority{ret1: roots})
+		r := httptest.NewRequest("GET", "/roots/digest", http.NoBody)
+		r.Header.Set("If-None-Match", `W/"`+digest+`"`)
+		w := httptest.NewRecorder()
+		RootsDigest(w, r)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.Bytes())
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		mockMustAuthority(t, &mockAuthority{getRoots: func() ([]*x509.Certificate, error) {
+			return nil, errors.New("an error")
+		}})
+		w := httptest.NewRecorder()
+		RootsDigest(w, httptest.NewRequest("GET", "/roots/digest", http.NoBody))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func Test_Federation_pagination(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	cert := parseCertificate(certPEM)
+	federated := []*x509.Certificate{root, cert, root}
+	mockMustAuthority(t, &mockAuthority{ret1: federated})
+
+	var (
+		cursor string
+		got    []Certificate
+	)
+	for i := 0; i < len(federated); i++ {
+		w := httptest.NewRecorder()
+		Federation(w, httptest.NewRequest("GET", "/federation?limit=2&cursor="+cursor, http.NoBody))
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		var resp FederationResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		got = append(got, resp.Certificates...)
+		if cursor = resp.NextCursor; cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []Certificate{{root}, {cert}, {root}}, got)
+
+	w := httptest.NewRecorder()
+	Federation(w, httptest.NewRequest("GET", "/federation?cursor=foo", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_Roots_notModifiedInvalidCursor(t *testing.T) {
+	roots := []*x509.Certificate{parseCertificate(rootPEM)}
+	mockMustAuthority(t, &mockAuthority{ret1: roots})
+
+	for _, query := range []string{"?cursor=foo", "?limit=foo"} {
+		r := httptest.NewRequest("GET", "/roots"+query, http.NoBody)
+		r.Header.Set("If-None-Match", `W/"`+bundleDigest(roots)+`"`)
+		w := httptest.NewRecorder()
+		Roots(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+
+		r = httptest.NewRequest("GET", "/federation"+query, http.NoBody)
+		r.Header.Set("If-None-Match", `W/"`+bundleDigest(roots)+`"`)
+		w = httptest.NewRecorder()
+		Federation(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	r := httptest.NewRequest("GET", "/roots?limit=1", http.NoBody)
+	r.Header.Set("If-None-Match", `W/"`+bundleDigest(roots)+`"`)
+	w := httptest.NewRecorder()
+	Roots(w, r)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
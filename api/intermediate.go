@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/pem"
+	"net/http"
+
+	"github.com/smallstep/certificates/api/render"
+)
+
+// Intermediate is an HTTP handler that returns the issuing intermediate
+// certificate in DER or PEM format. It is the URL used in the caIssuers access
+// method of the issued certificates.
+func Intermediate(w http.ResponseWriter, r *http.Request) {
+	intermediates, err := mustAuthority(r.Context()).GetIntermediates()
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	_, formatAsPEM := r.URL.Query()["pem"]
+	if formatAsPEM {
+		w.Header().Add("Content-Type", "application/x-pem-file")
+		w.Header().Add("Content-Disposition", "attachment; filename=\"intermediate.pem\"")
+
+		_ = pem.Encode(w, &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: intermediates[0].Raw,
+		})
+	} else {
+		w.Header().Add("Content-Type", "application/pkix-cert")
+		w.Header().Add("Content-Disposition", "attachment; filename=\"intermediate.crt\"")
+		w.Write(intermediates[0].Raw)
+	}
+}
@@ -0,0 +1,227 @@
+// Package audit implements a tamper-evident audit log for the operations
+// performed by the authority. Events are written as JSON lines to one or more
+// sinks, and each event includes the hash of the previous one, so removing or
+// modifying an event breaks the chain. If a key is configured, the hashes are
+// HMAC-SHA256 values, so the chain cannot be rebuilt without the key.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// EventType is the type of an audit event.
+type EventType string
+
+const (
+	// X509Sign is the event type used when an X.509 certificate is signed.
+	X509Sign EventType = "x509.sign"
+	// X509Renew is the event type used when an X.509 certificate is renewed.
+	X509Renew EventType = "x509.renew"
+	// X509Rekey is the event type used when an X.509 certificate is rekeyed.
+	X509Rekey EventType = "x509.rekey"
+	// X509Revoke is the event type used when an X.509 certificate is revoked.
+	X509Revoke EventType = "x509.revoke"
+	// SSHSign is the event type used when an SSH certificate is signed.
+	SSHSign EventType = "ssh.sign"
+	// SSHRenew is the event type used when an SSH certificate is renewed.
+	SSHRenew EventType = "ssh.renew"
+	// SSHRekey is the event type used when an SSH certificate is rekeyed.
+	SSHRekey EventType = "ssh.rekey"
+	// SSHRevoke is the event type used when an SSH certificate is revoked.
+	SSHRevoke EventType = "ssh.revoke"
+	// ACMEChallenge is the event type used when the status of an ACME
+	// challenge changes.
+	ACMEChallenge EventType = "acme.challenge"
+	// X509WebhookDecision is the event type used when an authorizing webhook
+	// modifies an X.509 certificate.
+	X509WebhookDecision EventType = "x509.webhookDecision"
+	// SCEPEnroll is the event type used when a SCEP enrollment succeeds.
+	SCEPEnroll EventType = "scep.enroll"
+	// SCEPLegacyAlgorithms is the event type used when a SCEP request is
+	// allowed to use legacy algorithms.
+	SCEPLegacyAlgorithms EventType = "scep.legacyAlgorithms"
+)
+
+// Event is an entry in the audit log.
+type Event struct {
+	Time            time.Time         `json:"time"`
+	Type            EventType         `json:"type"`
+	Provisioner     string            `json:"provisioner,omitempty"`
+	ProvisionerType string            `json:"provisionerType,omitempty"`
+	KeyFingerprint  string            `json:"keyFingerprint,omitempty"`
+	SerialNumber    string            `json:"serialNumber,omitempty"`
+	Subject         string            `json:"subject,omitempty"`
+	SANs            []string          `json:"sans,omitempty"`
+	Details         map[string]string `json:"details,omitempty"`
+	PrevHash        string            `json:"prevHash"`
+	Hash            string            `json:"hash"`
+}
+
+// hash returns the hex encoded SHA-256 of the event without the hash field, or
+// the HMAC-SHA256 if a key is given.
+func (e *Event) hash(key []byte) (string, error) {
+	ev := *e
+	ev.Hash = ""
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return "", err
+	}
+	if len(key) > 0 {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(b)
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sink is the interface implemented by the destinations of the audit log.
+// Write must not return until the line is persisted.
+type Sink interface {
+	Write(line []byte) error
+	Close() error
+}
+
+// Logger writes audit events to a list of sinks. A nil Logger is valid and
+// discards all the events.
+type Logger struct {
+	mu       sync.Mutex
+	sinks    []Sink
+	key      []byte
+	prevHash string
+	now      func() time.Time
+}
+
+// New creates a new audit logger that writes to the given sinks. If the key
+// is not empty, the events are chained using HMAC-SHA256 with it. If a sink
+// implements LastHash() string, the chain continues from the hash returned by
+// the first of them.
+func New(key []byte, sinks ...Sink) *Logger {
+	l := &Logger{
+		sinks: sinks,
+		key:   key,
+		now:   time.Now,
+	}
+	for _, s := range sinks {
+		if h, ok := s.(interface{ LastHash() string }); ok {
+			l.prevHash = h.LastHash()
+			break
+		}
+	}
+	return l
+}
+
+// Log adds the given event to the chain and writes it to all the sinks. It
+// only returns after all the sinks have persisted the event, and returns an
+// error if any of them fails. A failed write leaves a gap in the chain of the
+// failing sink.
+func (l *Logger) Log(ev *Event) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if ev.Time.IsZero() {
+		ev.Time = l.now()
+	}
+	ev.Time = ev.Time.UTC()
+	ev.PrevHash = l.prevHash
+	h, err := ev.hash(l.key)
+	if err != nil {
+		return fmt.Errorf("error hashing audit event: %w", err)
+	}
+	ev.Hash = h
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("error marshaling audit event: %w", err)
+	}
+	l.prevHash = h
+
+	var errs []error
+	for _, s := range l.sinks {
+		if err := s.Write(line); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error writing audit event: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Close closes all the sinks of the logger.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var errs []error
+	for _, s := range l.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Verify reads an audit log in the JSON lines format and checks that the
+// chain of hashes is not broken. The key must be the one used by the logger,
+// or empty if the log was written without one. The first event is trusted to
+// link to any previous event.
+func Verify(r io.Reader, key []byte) error {
+	var prevHash string
+	first := true
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return fmt.Errorf("error parsing audit event on line %d: %w", n, err)
+		}
+		if !first && ev.PrevHash != prevHash {
+			return fmt.Errorf("audit event on line %d does not link to the previous event", n)
+		}
+		h, err := ev.hash(key)
+		if err != nil {
+			return fmt.Errorf("error hashing audit event on line %d: %w", n, err)
+		}
+		if !hmac.Equal([]byte(h), []byte(ev.Hash)) {
+			return fmt.Errorf("audit event on line %d has been modified", n)
+		}
+		prevHash = ev.Hash
+		first = false
+	}
+	return scanner.Err()
+}
+
+type loggerKey struct{}
+
+// NewContext adds the given audit logger to the context.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the audit logger in the context, or nil if there is
+// none. The returned logger can always be used.
+func FromContext(ctx context.Context) *Logger {
+	l, _ := ctx.Value(loggerKey{}).(*Logger)
+	return l
+}
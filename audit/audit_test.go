@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memorySink struct {
+	lines  [][]byte
+	err    error
+	closed bool
+}
+
+func (s *memorySink) Write(line []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.lines = append(s.lines, append([]byte{}, line...))
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *memorySink) bytes() []byte {
+	return append(bytes.Join(s.lines, []byte("\n")), '\n')
+}
+
+type hashSink struct {
+	memorySink
+	lastHash string
+}
+
+func (s *hashSink) LastHash() string {
+	return s.lastHash
+}
+
+func TestLogger_Log(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	sink := &memorySink{}
+	l := New(nil, sink)
+	l.now = func() time.Time { return now }
+
+	require.NoError(t, l.Log(&Event{Type: X509Sign, SerialNumber: "1", SANs: []string{"foo.example.com"}}))
+	require.NoError(t, l.Log(&Event{Type: X509Revoke, SerialNumber: "1", Details: map[string]string{"reason": "keyCompromise"}}))
+	require.Len(t, sink.lines, 2)
+
+	var first, second Event
+	require.NoError(t, json.Unmarshal(sink.lines[0], &first))
+	require.NoError(t, json.Unmarshal(sink.lines[1], &second))
+	assert.Equal(t, now, first.Time)
+	assert.Equal(t, X509Sign, first.Type)
+	assert.Empty(t, first.PrevHash)
+	assert.NotEmpty(t, first.Hash)
+	assert.Equal(t, first.Hash, second.PrevHash)
+	assert.NotEqual(t, first.Hash, second.Hash)
+	assert.NoError(t, Verify(bytes.NewReader(sink.bytes()), nil))
+
+	// Continue the chain of a sink.
+	hs := &hashSink{lastHash: second.Hash}
+	l = New(nil, &memorySink{}, hs)
+	require.NoError(t, l.Log(&Event{Type: SSHSign}))
+	require.NoError(t, l.Close())
+	var third Event
+	require.NoError(t, json.Unmarshal(hs.lines[0], &third))
+	assert.Equal(t, second.Hash, third.PrevHash)
+
+	// A nil logger discards the events.
+	var nl *Logger
+	assert.NoError(t, nl.Log(&Event{Type: X509Sign}))
+	assert.NoError(t, nl.Close())
+}
+
+func TestLogger_Log_error(t *testing.T) {
+	ok := &memorySink{}
+	fail := &memorySink{err: errors.New("disk full")}
+	l := New(nil, ok, fail)
+	err := l.Log(&Event{Type: X509Sign})
+	assert.ErrorContains(t, err, "disk full")
+	assert.Len(t, ok.lines, 1)
+
+	require.NoError(t, l.Close())
+	assert.True(t, ok.closed)
+	assert.True(t, fail.closed)
+}
+
+func TestLogger_Log_key(t *testing.T) {
+	key := []byte("secret")
+	sink := &memorySink{}
+	l := New(key, sink)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, l.Log(&Event{Type: X509Sign, SerialNumber: string(rune('1' + i))}))
+	}
+	require.NoError(t, l.Close())
+
+	assert.NoError(t, Verify(bytes.NewReader(sink.bytes()), key))
+	assert.ErrorContains(t, Verify(bytes.NewReader(sink.bytes()), nil), "has been modified")
+	assert.ErrorContains(t, Verify(bytes.NewReader(sink.bytes()), []byte("other")), "has been modified")
+}
+
+func TestVerify(t *testing.T) {
+	sink := &memorySink{}
+	l := New(nil, sink)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Log(&Event{Type: X509Sign, SerialNumber: string(rune('1' + i))}))
+	}
+	log := sink.bytes()
+
+	modified := bytes.Replace(log, []byte(`"serialNumber":"2"`), []byte(`"serialNumber":"4"`), 1)
+	removed := bytes.Join([][]byte{sink.lines[0], sink.lines[2]}, []byte("\n"))
+
+	tests := []struct {
+		name    string
+		log     []byte
+		wantErr string
+	}{
+		{"ok", log, ""},
+		{"ok empty", nil, ""},
+		{"ok truncated", sink.lines[2], ""},
+		{"fail modified", modified, "audit event on line 2 has been modified"},
+		{"fail removed", removed, "audit event on line 2 does not link to the previous event"},
+		{"fail json", []byte("{"), "error parsing audit event on line 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(bytes.NewReader(tt.log), nil)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()))
+	l := New(nil)
+	assert.Equal(t, l, FromContext(NewContext(context.Background(), l)))
+}
@@ -0,0 +1,153 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSink writes the audit events to a file in the JSON lines format. Each
+// event is synced to disk before Write returns.
+type FileSink struct {
+	mu       sync.Mutex
+	file     *os.File
+	lastHash string
+}
+
+// NewFileSink opens the given file in append mode, creating it if it does not
+// exist. The hash of the last event in the file is used to continue the chain.
+func NewFileSink(filename string) (*FileSink, error) {
+	lastHash, err := readLastHash(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log %s: %w", filename, err)
+	}
+	return &FileSink{
+		file:     f,
+		lastHash: lastHash,
+	}, nil
+}
+
+// LastHash returns the hash of the last event in the file when it was opened.
+func (s *FileSink) LastHash() string {
+	return s.lastHash
+}
+
+// Write appends the line to the file and syncs it to disk.
+func (s *FileSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func readLastHash(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("error opening audit log %s: %w", filename, err)
+	}
+	defer f.Close()
+
+	var last []byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("error reading audit log %s: %w", filename, err)
+	}
+	if last == nil {
+		return "", nil
+	}
+	var ev Event
+	if err := json.Unmarshal(last, &ev); err != nil {
+		return "", fmt.Errorf("error parsing last event of audit log %s: %w", filename, err)
+	}
+	return ev.Hash, nil
+}
+
+// DefaultWebhookTimeout is the timeout used by the webhook sink if none is
+// configured.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookSink posts each audit event to an HTTP endpoint. An event is
+// persisted when the endpoint responds with a 2xx status code.
+type WebhookSink struct {
+	url         string
+	bearerToken string
+	client      *http.Client
+	timeout     time.Duration
+}
+
+// NewWebhookSink creates a new sink that posts the events to the given url. If
+// the bearer token is not empty, it's sent in the Authorization header.
+func NewWebhookSink(url, bearerToken string, client *http.Client, timeout time.Duration) *WebhookSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	return &WebhookSink{
+		url:         url,
+		bearerToken: bearerToken,
+		client:      client,
+		timeout:     timeout,
+	}
+}
+
+// Write posts the line to the webhook endpoint.
+func (s *WebhookSink) Write(line []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(line))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.bearerToken)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting audit event: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook responded with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close is a noop.
+func (s *WebhookSink) Close() error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+
+	s, err := NewFileSink(filename)
+	require.NoError(t, err)
+	assert.Empty(t, s.LastHash())
+	l := New(nil, s)
+	require.NoError(t, l.Log(&Event{Type: X509Sign, SerialNumber: "1"}))
+	require.NoError(t, l.Log(&Event{Type: X509Sign, SerialNumber: "2"}))
+	require.NoError(t, l.Close())
+
+	// The chain continues after a restart.
+	s, err = NewFileSink(filename)
+	require.NoError(t, err)
+	assert.NotEmpty(t, s.LastHash())
+	l = New(nil, s)
+	require.NoError(t, l.Log(&Event{Type: X509Revoke, SerialNumber: "1"}))
+	require.NoError(t, l.Close())
+
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, Verify(f, nil))
+
+	b, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(b)), "\n"), 3)
+
+	// Fail with a corrupted log.
+	bad := filepath.Join(t.TempDir(), "bad.log")
+	require.NoError(t, os.WriteFile(bad, []byte("not json\n"), 0600))
+	_, err = NewFileSink(bad)
+	assert.ErrorContains(t, err, "error parsing last event of audit log")
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		got, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	s := NewWebhookSink(srv.URL, "token", nil, 0)
+	assert.Equal(t, DefaultWebhookTimeout, s.timeout)
+	require.NoError(t, s.Write([]byte(`{"type":"x509.sign"}`)))
+	assert.Equal(t, `{"type":"x509.sign"}`, string(got))
+	assert.NoError(t, s.Close())
+
+	s = NewWebhookSink(srv.URL, "", srv.Client(), time.Second)
+	assert.ErrorContains(t, s.Write([]byte(`{}`)), "audit webhook responded with 401")
+
+	s = NewWebhookSink("http://127.0.0.1:0", "", nil, time.Second)
+	assert.ErrorContains(t, s.Write([]byte(`{}`)), "error posting audit event")
+}
@@ -0,0 +1,37 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// SyslogSink writes the audit events to a syslog server with the auth
+// facility.
+type SyslogSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogSink connects to the syslog server at the given address. If the
+// network is empty, it connects to the local syslog server.
+func NewSyslogSink(network, address, tag string) (*SyslogSink, error) {
+	if tag == "" {
+		tag = "step-ca"
+	}
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to syslog: %w", err)
+	}
+	return &SyslogSink{w: w}, nil
+}
+
+// Write sends the line to the syslog server.
+func (s *SyslogSink) Write(line []byte) error {
+	return s.w.Info(string(line))
+}
+
+// Close closes the connection with the syslog server.
+func (s *SyslogSink) Close() error {
+	return s.w.Close()
+}
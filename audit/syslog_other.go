@@ -0,0 +1,23 @@
+//go:build windows || plan9
+
+package audit
+
+import "errors"
+
+// SyslogSink is not supported on this platform.
+type SyslogSink struct{}
+
+// NewSyslogSink returns an error, syslog is not supported on this platform.
+func NewSyslogSink(network, address, tag string) (*SyslogSink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+// Write is a noop.
+func (s *SyslogSink) Write([]byte) error {
+	return nil
+}
+
+// Close is a noop.
+func (s *SyslogSink) Close() error {
+	return nil
+}
@@ -1,20 +1,28 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"go.step.sm/linkedca"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"github.com/smallstep/certificates/acme"
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/admin"
 )
 
 // CreateExternalAccountKeyRequest is the type for POST /admin/acme/eab requests
 type CreateExternalAccountKeyRequest struct {
-	Reference string `json:"reference"`
+	Reference string    `json:"reference"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
 }
 
 // Validate validates a new ACME EAB Key request body.
@@ -22,13 +30,48 @@ func (r *CreateExternalAccountKeyRequest) Validate() error {
 	if len(r.Reference) > 256 { // an arbitrary, but sensible (IMO), limit
 		return fmt.Errorf("reference length %d exceeds the maximum (256)", len(r.Reference))
 	}
+	if !r.ExpiresAt.IsZero() && !r.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expiresAt %s is not in the future", r.ExpiresAt.Format(time.RFC3339))
+	}
 	return nil
 }
 
+// ExternalAccountKey is the type used for the ACME EAB keys in the GET
+// /admin/acme/eab responses. It adds the expiration of the key, not available
+// in linkedca.EABKey.
+type ExternalAccountKey struct {
+	*linkedca.EABKey
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
 // GetExternalAccountKeysResponse is the type for GET /admin/acme/eab responses
 type GetExternalAccountKeysResponse struct {
-	EAKs       []*linkedca.EABKey `json:"eaks"`
-	NextCursor string             `json:"nextCursor"`
+	EAKs       []*ExternalAccountKey `json:"eaks"`
+	NextCursor string                `json:"nextCursor"`
+}
+
+// CreateExternalAccountKeyResponse is the type for POST /admin/acme/eab
+// responses. The key is encoded as a linkedca.EABKey, with an additional
+// expiresAt property if the key expires.
+type CreateExternalAccountKeyResponse struct {
+	*linkedca.EABKey
+	ExpiresAt *time.Time
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r *CreateExternalAccountKeyResponse) MarshalJSON() ([]byte, error) {
+	b, err := protojson.Marshal(r.EABKey)
+	if err != nil || r.ExpiresAt == nil {
+		return b, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if m["expiresAt"], err = json.Marshal(r.ExpiresAt.UTC()); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
 }
 
 // requireEABEnabled is a middleware that ensures ACME EAB is enabled
@@ -68,19 +111,135 @@ func NewACMEAdminResponder() ACMEAdminResponder {
 	return &acmeAdminResponder{}
 }
 
-// GetExternalAccountKeys writes the response for the EAB keys GET endpoint
-func (h *acmeAdminResponder) GetExternalAccountKeys(w http.ResponseWriter, _ *http.Request) {
-	render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+// GetExternalAccountKeys writes the response for the EAB keys GET endpoint. It
+// returns the key with the reference in the path, or all the keys of the
+// provisioner. The HMAC keys are never included.
+func (h *acmeAdminResponder) GetExternalAccountKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	var (
+		keys       []*acme.ExternalAccountKey
+		nextCursor string
+	)
+	if reference := chi.URLParam(r, "reference"); reference != "" {
+		key, err := acmeDB.GetExternalAccountKeyByReference(ctx, prov.GetId(), reference)
+		switch {
+		case errors.Is(err, acme.ErrNotFound):
+		case err != nil:
+			render.Error(w, admin.WrapErrorISE(err, "error retrieving external account key with reference '%s'", reference))
+			return
+		case key != nil:
+			keys = []*acme.ExternalAccountKey{key}
+		}
+	} else {
+		cursor, limit, err := api.ParseCursor(r)
+		if err != nil {
+			render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing cursor and limit from query params"))
+			return
+		}
+		if keys, nextCursor, err = acmeDB.GetExternalAccountKeys(ctx, prov.GetId(), cursor, limit); err != nil {
+			render.Error(w, admin.WrapErrorISE(err, "error retrieving external account keys"))
+			return
+		}
+	}
+
+	eaks := make([]*ExternalAccountKey, len(keys))
+	for i, k := range keys {
+		eak := eakToLinked(k)
+		eak.HmacKey = []byte{}
+		eak.Provisioner = prov.GetName()
+		eaks[i] = &ExternalAccountKey{
+			EABKey:    eak,
+			ExpiresAt: expiresAtOrNil(k.ExpiresAt),
+		}
+	}
+
+	render.JSON(w, &GetExternalAccountKeysResponse{
+		EAKs:       eaks,
+		NextCursor: nextCursor,
+	})
+}
+
+// CreateExternalAccountKey writes the response for the EAB key POST endpoint.
+// The HMAC key is only returned in this response.
+func (h *acmeAdminResponder) CreateExternalAccountKey(w http.ResponseWriter, r *http.Request) {
+	var body CreateExternalAccountKeyRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error validating request body"))
+		return
+	}
+
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	if reference := body.Reference; reference != "" {
+		k, err := acmeDB.GetExternalAccountKeyByReference(ctx, prov.GetId(), reference)
+		if err != nil && !errors.Is(err, acme.ErrNotFound) {
+			render.Error(w, admin.WrapErrorISE(err, "could not lookup external account key by reference"))
+			return
+		}
+		if k != nil {
+			err := admin.NewError(admin.ErrorBadRequestType, "an ACME EAB key for provisioner '%s' with reference '%s' already exists", prov.GetName(), reference)
+			err.Status = http.StatusConflict
+			render.Error(w, err)
+			return
+		}
+	}
+
+	eak, err := acmeDB.CreateExternalAccountKey(ctx, prov.GetId(), body.Reference, body.ExpiresAt)
+	if err != nil {
+		render.Error(w, admin.WrapErrorISE(err, "error creating ACME EAB key for provisioner '%s'", prov.GetName()))
+		return
+	}
+
+	render.JSONStatus(w, &CreateExternalAccountKeyResponse{
+		EABKey: &linkedca.EABKey{
+			Id:          eak.ID,
+			HmacKey:     eak.HmacKey,
+			Provisioner: prov.GetName(),
+			Reference:   eak.Reference,
+			CreatedAt:   timestamppb.New(eak.CreatedAt),
+		},
+		ExpiresAt: expiresAtOrNil(eak.ExpiresAt),
+	}, http.StatusCreated)
 }
 
-// CreateExternalAccountKey writes the response for the EAB key POST endpoint
-func (h *acmeAdminResponder) CreateExternalAccountKey(w http.ResponseWriter, _ *http.Request) {
-	render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+// expiresAtOrNil returns nil if the given expiration is not set.
+func expiresAtOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
 }
 
-// DeleteExternalAccountKey writes the response for the EAB key DELETE endpoint
-func (h *acmeAdminResponder) DeleteExternalAccountKey(w http.ResponseWriter, _ *http.Request) {
-	render.Error(w, admin.NewError(admin.ErrorNotImplementedType, "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm"))
+// DeleteExternalAccountKey writes the response for the EAB key DELETE
+// endpoint. Deleting a key revokes it, but if the key is already bound, the
+// ACME account is not deactivated.
+func (h *acmeAdminResponder) DeleteExternalAccountKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	prov := linkedca.MustProvisionerFromContext(ctx)
+	acmeDB := acme.MustDatabaseFromContext(ctx)
+
+	keyID := chi.URLParam(r, "id")
+	if err := acmeDB.DeleteExternalAccountKey(ctx, prov.GetId(), keyID); err != nil {
+		if errors.Is(err, acme.ErrNotFound) {
+			render.Error(w, admin.NewError(admin.ErrorNotFoundType, "ACME EAB key '%s' not found", keyID))
+			return
+		}
+		render.Error(w, admin.WrapErrorISE(err, "error deleting ACME EAB key '%s'", keyID))
+		return
+	}
+
+	render.JSON(w, &DeleteResponse{Status: "ok"})
 }
 
 func eakToLinked(k *acme.ExternalAccountKey) *linkedca.EABKey {
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -30,7 +32,7 @@ func readProtoJSON(r io.ReadCloser, m proto.Message) error {
 	if err != nil {
 		return err
 	}
-	return protojson.Unmarshal(data, m)
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
 }
 
 func mockMustAuthority(t *testing.T, a adminAuthority) {
@@ -197,24 +199,146 @@ func TestCreateExternalAccountKeyRequest_Validate(t *testing.T) {
 	}
 }
 
+func eabRequest(method, body string, params map[string]string, acmeDB acme.DB) *http.Request {
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("provisionerName", "provName")
+	for k, v := range params {
+		chiCtx.URLParams.Add(k, v)
+	}
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+	ctx = linkedca.NewContextWithProvisioner(ctx, &linkedca.Provisioner{Id: "provID", Name: "provName"})
+	if acmeDB == nil {
+		acmeDB = &acme.MockDB{}
+	}
+	ctx = acme.NewDatabaseContext(ctx, acmeDB)
+	req := httptest.NewRequest(method, "/foo", strings.NewReader(body))
+	return req.WithContext(ctx)
+}
+
 func TestHandler_CreateExternalAccountKey(t *testing.T) {
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	expiresAt := createdAt.Add(time.Hour)
 	type test struct {
-		ctx        context.Context
+		body       string
+		acmeDB     acme.DB
 		statusCode int
 		err        *admin.Error
+		eak        *linkedca.EABKey
+		expiresAt  *time.Time
 	}
 	var tests = map[string]func(t *testing.T) test{
-		"ok": func(t *testing.T) test {
-			chiCtx := chi.NewRouteContext()
-			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		"fail/read.JSON": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
+				body:       "{",
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Message: "error reading request body: error decoding json: unexpected EOF",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				body:       `{"reference":"` + strings.Repeat("A", 257) + `"}`,
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Message: "error validating request body: reference length 257 exceeds the maximum (256)",
+				},
+			}
+		},
+		"fail/reference-conflict": func(t *testing.T) test {
+			return test{
+				body: `{"reference":"ref"}`,
+				acmeDB: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "ref", reference)
+						return &acme.ExternalAccountKey{ID: "eakID"}, nil
+					},
+				},
+				statusCode: 409,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Message: "an ACME EAB key for provisioner 'provName' with reference 'ref' already exists",
+				},
+			}
+		},
+		"fail/db.CreateExternalAccountKey": func(t *testing.T) test {
+			return test{
+				body: `{"reference":"ref"}`,
+				acmeDB: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockCreateExternalAccountKey: func(ctx context.Context, provisionerID, reference string, expiresAt time.Time) (*acme.ExternalAccountKey, error) {
+						return nil, errors.New("force")
+					},
+				},
+				statusCode: 500,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorServerInternalType.String(),
+					Message: "error creating ACME EAB key for provisioner 'provName': force",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				body: `{"reference":"ref","expiresAt":"` + expiresAt.Format(time.RFC3339) + `"}`,
+				acmeDB: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockCreateExternalAccountKey: func(ctx context.Context, provisionerID, reference string, e time.Time) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "ref", reference)
+						assert.True(t, expiresAt.Equal(e))
+						return &acme.ExternalAccountKey{
+							ID:            "eakID",
+							ProvisionerID: provisionerID,
+							Reference:     reference,
+							HmacKey:       []byte{1, 3, 3, 7},
+							CreatedAt:     createdAt,
+							ExpiresAt:     e,
+						}, nil
+					},
+				},
+				statusCode: 201,
+				eak: &linkedca.EABKey{
+					Id:          "eakID",
+					HmacKey:     []byte{1, 3, 3, 7},
+					Provisioner: "provName",
+					Reference:   "ref",
+					CreatedAt:   timestamppb.New(createdAt),
+				},
+				expiresAt: &expiresAt,
+			}
+		},
+		"ok/no-expiration": func(t *testing.T) test {
+			return test{
+				body: `{"reference":"ref"}`,
+				acmeDB: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+					MockCreateExternalAccountKey: func(ctx context.Context, provisionerID, reference string, e time.Time) (*acme.ExternalAccountKey, error) {
+						assert.True(t, e.IsZero())
+						return &acme.ExternalAccountKey{
+							ID:            "eakID",
+							ProvisionerID: provisionerID,
+							Reference:     reference,
+							HmacKey:       []byte{1, 3, 3, 7},
+							CreatedAt:     createdAt,
+						}, nil
+					},
+				},
+				statusCode: 201,
+				eak: &linkedca.EABKey{
+					Id:          "eakID",
+					HmacKey:     []byte{1, 3, 3, 7},
+					Provisioner: "provName",
+					Reference:   "ref",
+					CreatedAt:   timestamppb.New(createdAt),
 				},
 			}
 		},
@@ -222,62 +346,92 @@ func TestHandler_CreateExternalAccountKey(t *testing.T) {
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := httptest.NewRequest("POST", "/foo", http.NoBody) // chi routing is prepared in test setup
-			req = req.WithContext(tc.ctx)
+			req := eabRequest("POST", tc.body, nil, tc.acmeDB)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
 			acmeResponder.CreateExternalAccountKey(w, req)
 			res := w.Result()
 			assert.Equals(t, tc.statusCode, res.StatusCode)
+			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+
+			if res.StatusCode >= 400 {
+				body, err := io.ReadAll(res.Body)
+				res.Body.Close()
+				assert.FatalError(t, err)
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				return
+			}
 
 			body, err := io.ReadAll(res.Body)
 			res.Body.Close()
 			assert.FatalError(t, err)
-
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
-
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
-
+			eak := &linkedca.EABKey{}
+			assert.FatalError(t, readProtoJSON(io.NopCloser(bytes.NewReader(body)), eak))
+			assert.True(t, proto.Equal(tc.eak, eak))
+			var v struct {
+				ExpiresAt *time.Time `json:"expiresAt"`
+			}
+			assert.FatalError(t, json.Unmarshal(body, &v))
+			assert.Equals(t, tc.expiresAt, v.ExpiresAt)
 		})
 	}
 }
 
 func TestHandler_DeleteExternalAccountKey(t *testing.T) {
 	type test struct {
-		ctx        context.Context
+		acmeDB     acme.DB
 		statusCode int
 		err        *admin.Error
 	}
 	var tests = map[string]func(t *testing.T) test{
-		"ok": func(t *testing.T) test {
-			chiCtx := chi.NewRouteContext()
-			chiCtx.URLParams.Add("provisionerName", "provName")
-			chiCtx.URLParams.Add("id", "keyID")
-			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		"fail/not-found": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
+				acmeDB: &acme.MockDB{
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						return fmt.Errorf("error loading ACME EAB Key with Key ID %s: %w", keyID, acme.ErrNotFound)
+					},
+				},
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Message: "ACME EAB key 'keyID' not found",
+				},
+			}
+		},
+		"fail/db.DeleteExternalAccountKey": func(t *testing.T) test {
+			return test{
+				acmeDB: &acme.MockDB{
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						return errors.New("force")
+					},
+				},
+				statusCode: 500,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorServerInternalType.String(),
+					Message: "error deleting ACME EAB key 'keyID': force",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				acmeDB: &acme.MockDB{
+					MockDeleteExternalAccountKey: func(ctx context.Context, provisionerID, keyID string) error {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "keyID", keyID)
+						return nil
+					},
 				},
+				statusCode: 200,
 			}
 		},
 	}
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := httptest.NewRequest("DELETE", "/foo", http.NoBody) // chi routing is prepared in test setup
-			req = req.WithContext(tc.ctx)
+			req := eabRequest("DELETE", "", map[string]string{"id": "keyID"}, tc.acmeDB)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
 			acmeResponder.DeleteExternalAccountKey(w, req)
@@ -288,49 +442,143 @@ func TestHandler_DeleteExternalAccountKey(t *testing.T) {
 			res.Body.Close()
 			assert.FatalError(t, err)
 
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				return
+			}
 
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+			response := DeleteResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, "ok", response.Status)
 		})
 	}
 }
 
 func TestHandler_GetExternalAccountKeys(t *testing.T) {
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	boundAt := createdAt.Add(time.Minute)
+	expiresAt := createdAt.Add(time.Hour)
+	eak := &acme.ExternalAccountKey{
+		ID:            "eakID",
+		ProvisionerID: "provID",
+		Reference:     "ref",
+		AccountID:     "accountID",
+		HmacKey:       []byte{1, 3, 3, 7},
+		CreatedAt:     createdAt,
+		BoundAt:       boundAt,
+		ExpiresAt:     expiresAt,
+	}
+	linkedEAK := &linkedca.EABKey{
+		Id:          "eakID",
+		HmacKey:     []byte{},
+		Provisioner: "provName",
+		Reference:   "ref",
+		Account:     "accountID",
+		CreatedAt:   timestamppb.New(createdAt),
+		BoundAt:     timestamppb.New(boundAt),
+	}
 	type test struct {
-		ctx        context.Context
+		target     string
+		params     map[string]string
+		acmeDB     acme.DB
 		statusCode int
-		req        *http.Request
 		err        *admin.Error
+		resp       GetExternalAccountKeysResponse
 	}
 	var tests = map[string]func(t *testing.T) test{
-		"ok": func(t *testing.T) test {
-			chiCtx := chi.NewRouteContext()
-			chiCtx.URLParams.Add("provisionerName", "provName")
-			req := httptest.NewRequest("GET", "/foo", http.NoBody)
-			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+		"fail/parse-cursor": func(t *testing.T) test {
 			return test{
-				ctx:        ctx,
-				statusCode: 501,
-				req:        req,
+				target:     "/foo?limit=A",
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Message: "error parsing cursor and limit from query params: limit 'A' is not an integer: strconv.Atoi: parsing \"A\": invalid syntax",
+				},
+			}
+		},
+		"fail/db.GetExternalAccountKeyByReference": func(t *testing.T) test {
+			return test{
+				target: "/foo",
+				params: map[string]string{"reference": "ref"},
+				acmeDB: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, errors.New("force")
+					},
+				},
+				statusCode: 500,
+				err: &admin.Error{
+					Type:    admin.ErrorServerInternalType.String(),
+					Message: "error retrieving external account key with reference 'ref': force",
+				},
+			}
+		},
+		"fail/db.GetExternalAccountKeys": func(t *testing.T) test {
+			return test{
+				target: "/foo",
+				acmeDB: &acme.MockDB{
+					MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+						return nil, "", errors.New("force")
+					},
+				},
+				statusCode: 500,
 				err: &admin.Error{
-					Type:    admin.ErrorNotImplementedType.String(),
-					Status:  http.StatusNotImplemented,
-					Message: "this functionality is currently only available in Certificate Manager: https://u.step.sm/cm",
-					Detail:  "not implemented",
+					Type:    admin.ErrorServerInternalType.String(),
+					Message: "error retrieving external account keys: force",
+				},
+			}
+		},
+		"ok/reference-not-found": func(t *testing.T) test {
+			return test{
+				target: "/foo",
+				params: map[string]string{"reference": "ref"},
+				acmeDB: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						return nil, acme.ErrNotFound
+					},
+				},
+				statusCode: 200,
+				resp:       GetExternalAccountKeysResponse{EAKs: []*ExternalAccountKey{}},
+			}
+		},
+		"ok/reference": func(t *testing.T) test {
+			return test{
+				target: "/foo",
+				params: map[string]string{"reference": "ref"},
+				acmeDB: &acme.MockDB{
+					MockGetExternalAccountKeyByReference: func(ctx context.Context, provisionerID, reference string) (*acme.ExternalAccountKey, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "ref", reference)
+						return eak, nil
+					},
+				},
+				statusCode: 200,
+				resp:       GetExternalAccountKeysResponse{EAKs: []*ExternalAccountKey{{EABKey: linkedEAK, ExpiresAt: &expiresAt}}},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				target: "/foo?cursor=next&limit=10",
+				acmeDB: &acme.MockDB{
+					MockGetExternalAccountKeys: func(ctx context.Context, provisionerID, cursor string, limit int) ([]*acme.ExternalAccountKey, string, error) {
+						assert.Equals(t, "provID", provisionerID)
+						assert.Equals(t, "next", cursor)
+						assert.Equals(t, 10, limit)
+						return []*acme.ExternalAccountKey{eak}, "last", nil
+					},
 				},
+				statusCode: 200,
+				resp:       GetExternalAccountKeysResponse{EAKs: []*ExternalAccountKey{{EABKey: linkedEAK, ExpiresAt: &expiresAt}}, NextCursor: "last"},
 			}
 		},
 	}
 	for name, prep := range tests {
 		tc := prep(t)
 		t.Run(name, func(t *testing.T) {
-
-			req := tc.req.WithContext(tc.ctx)
+			req := eabRequest("GET", "", tc.params, tc.acmeDB)
+			req.URL, _ = req.URL.Parse(tc.target)
 			w := httptest.NewRecorder()
 			acmeResponder := NewACMEAdminResponder()
 			acmeResponder.GetExternalAccountKeys(w, req)
@@ -342,14 +590,22 @@ func TestHandler_GetExternalAccountKeys(t *testing.T) {
 			res.Body.Close()
 			assert.FatalError(t, err)
 
-			adminErr := admin.Error{}
-			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				return
+			}
 
-			assert.Equals(t, tc.err.Type, adminErr.Type)
-			assert.Equals(t, tc.err.Message, adminErr.Message)
-			assert.Equals(t, tc.err.StatusCode(), res.StatusCode)
-			assert.Equals(t, tc.err.Detail, adminErr.Detail)
-			assert.Equals(t, []string{"application/json"}, res.Header["Content-Type"])
+			response := GetExternalAccountKeysResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, tc.resp.NextCursor, response.NextCursor)
+			assert.Equals(t, len(tc.resp.EAKs), len(response.EAKs))
+			for i := range tc.resp.EAKs {
+				assert.True(t, proto.Equal(tc.resp.EAKs[i].EABKey, response.EAKs[i].EABKey))
+				assert.Equals(t, tc.resp.EAKs[i].ExpiresAt, response.EAKs[i].ExpiresAt)
+			}
 		})
 	}
 }
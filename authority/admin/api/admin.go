@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -11,8 +12,10 @@ import (
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/api/read"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 type adminAuthority interface {
@@ -33,6 +36,10 @@ type adminAuthority interface {
 	CreateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	UpdateAuthorityPolicy(ctx context.Context, admin *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	RemoveAuthorityPolicy(ctx context.Context) error
+	QueryCertificates(q *authority.CertificateQuery) ([]*authority.CertificateInfo, string, error)
+	CreateSCEPChallenge(ctx context.Context, provisionerName, reference string, expiresAt time.Time) (string, *db.SCEPChallenge, error)
+	GetSCEPChallenges(ctx context.Context, provisionerName, cursor string, limit int) ([]*db.SCEPChallenge, string, error)
+	RevokeSCEPChallenge(ctx context.Context, provisionerName, id string) (*db.SCEPChallenge, error)
 }
 
 // CreateAdminRequest represents the body for a CreateAdmin request.
@@ -19,8 +19,10 @@ import (
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
 )
 
 type mockAdminAuthority struct {
@@ -44,6 +46,12 @@ type mockAdminAuthority struct {
 	MockCreateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockUpdateAuthorityPolicy func(ctx context.Context, adm *linkedca.Admin, policy *linkedca.Policy) (*linkedca.Policy, error)
 	MockRemoveAuthorityPolicy func(ctx context.Context) error
+
+	MockQueryCertificates func(q *authority.CertificateQuery) ([]*authority.CertificateInfo, string, error)
+
+	MockCreateSCEPChallenge func(ctx context.Context, provisionerName, reference string, expiresAt time.Time) (string, *db.SCEPChallenge, error)
+	MockGetSCEPChallenges   func(ctx context.Context, provisionerName, cursor string, limit int) ([]*db.SCEPChallenge, string, error)
+	MockRevokeSCEPChallenge func(ctx context.Context, provisionerName, id string) (*db.SCEPChallenge, error)
 }
 
 func (m *mockAdminAuthority) IsAdminAPIEnabled() bool {
@@ -165,6 +173,34 @@ func (m *mockAdminAuthority) RemoveAuthorityPolicy(ctx context.Context) error {
 	return m.MockErr
 }
 
+func (m *mockAdminAuthority) QueryCertificates(q *authority.CertificateQuery) ([]*authority.CertificateInfo, string, error) {
+	if m.MockQueryCertificates != nil {
+		return m.MockQueryCertificates(q)
+	}
+	return m.MockRet1.([]*authority.CertificateInfo), "", m.MockErr
+}
+
+func (m *mockAdminAuthority) CreateSCEPChallenge(ctx context.Context, provisionerName, reference string, expiresAt time.Time) (string, *db.SCEPChallenge, error) {
+	if m.MockCreateSCEPChallenge != nil {
+		return m.MockCreateSCEPChallenge(ctx, provisionerName, reference, expiresAt)
+	}
+	return m.MockRet1.(string), m.MockRet2.(*db.SCEPChallenge), m.MockErr
+}
+
+func (m *mockAdminAuthority) GetSCEPChallenges(ctx context.Context, provisionerName, cursor string, limit int) ([]*db.SCEPChallenge, string, error) {
+	if m.MockGetSCEPChallenges != nil {
+		return m.MockGetSCEPChallenges(ctx, provisionerName, cursor, limit)
+	}
+	return m.MockRet1.([]*db.SCEPChallenge), "", m.MockErr
+}
+
+func (m *mockAdminAuthority) RevokeSCEPChallenge(ctx context.Context, provisionerName, id string) (*db.SCEPChallenge, error) {
+	if m.MockRevokeSCEPChallenge != nil {
+		return m.MockRevokeSCEPChallenge(ctx, provisionerName, id)
+	}
+	return m.MockRet1.(*db.SCEPChallenge), m.MockErr
+}
+
 func TestCreateAdminRequest_Validate(t *testing.T) {
 	type fields struct {
 		Subject     string
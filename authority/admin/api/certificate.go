@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+)
+
+// GetCertificatesResponse is the type for GET /admin/certificates responses.
+type GetCertificatesResponse struct {
+	Certificates []*authority.CertificateInfo `json:"certificates"`
+	NextCursor   string                       `json:"nextCursor"`
+}
+
+// GetCertificates returns the X.509 certificates in the inventory that match
+// the san, serial, provisioner, status, expiresAfter and expiresBefore query
+// parameters. The dates use the RFC 3339 format. The results are paginated
+// using the cursor and limit query parameters.
+func GetCertificates(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := &authority.CertificateQuery{
+		SAN:          q.Get("san"),
+		SerialNumber: q.Get("serial"),
+		Provisioner:  q.Get("provisioner"),
+		Status:       q.Get("status"),
+	}
+
+	switch query.Status {
+	case "", authority.CertificateStatusActive, authority.CertificateStatusExpired,
+		authority.CertificateStatusRenewed, authority.CertificateStatusRevoked:
+	default:
+		render.Error(w, admin.NewError(admin.ErrorBadRequestType, "status %q is not valid", query.Status))
+		return
+	}
+
+	var err error
+	if query.ExpiresAfter, err = parseTimeParam(q.Get("expiresAfter")); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing expiresAfter"))
+		return
+	}
+	if query.ExpiresBefore, err = parseTimeParam(q.Get("expiresBefore")); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error parsing expiresBefore"))
+		return
+	}
+
+	cursor, limit, err := api.ParseCursor(r)
+	if err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err,
+			"error parsing cursor and limit from query params"))
+		return
+	}
+	switch {
+	case limit <= 0:
+		limit = authority.DefaultCertificatesLimit
+	case limit > authority.DefaultCertificatesMax:
+		limit = authority.DefaultCertificatesMax
+	}
+	query.Cursor, query.Limit = cursor, limit
+
+	certs, nextCursor, err := mustAuthority(r.Context()).QueryCertificates(query)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	render.JSON(w, &GetCertificatesResponse{
+		Certificates: certs,
+		NextCursor:   nextCursor,
+	})
+}
+
+func parseTimeParam(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestGetCertificates(t *testing.T) {
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	certs := []*authority.CertificateInfo{
+		{
+			SerialNumber: "1234",
+			Subject:      "foo.example.com",
+			SANs:         []string{"foo.example.com"},
+			NotBefore:    notAfter.Add(-24 * time.Hour),
+			NotAfter:     notAfter,
+			Provisioner:  &db.ProvisionerData{ID: "acme-id", Name: "acme", Type: "ACME"},
+			Status:       authority.CertificateStatusActive,
+		},
+	}
+	type test struct {
+		req        *http.Request
+		auth       adminAuthority
+		statusCode int
+		err        *admin.Error
+		resp       GetCertificatesResponse
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/status": func(t *testing.T) test {
+			return test{
+				req:        httptest.NewRequest("GET", "/foo?status=foo", http.NoBody),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: `status "foo" is not valid`,
+				},
+			}
+		},
+		"fail/expiresBefore": func(t *testing.T) test {
+			return test{
+				req:        httptest.NewRequest("GET", "/foo?expiresBefore=tomorrow", http.NoBody),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: `error parsing expiresBefore: parsing time "tomorrow" as "2006-01-02T15:04:05Z07:00": cannot parse "tomorrow" as "2006"`,
+				},
+			}
+		},
+		"fail/auth.QueryCertificates": func(t *testing.T) test {
+			return test{
+				req: httptest.NewRequest("GET", "/foo", http.NoBody),
+				auth: &mockAdminAuthority{
+					MockQueryCertificates: func(q *authority.CertificateQuery) ([]*authority.CertificateInfo, string, error) {
+						return nil, "", admin.NewError(admin.ErrorNotImplementedType, "the database does not support the certificate inventory")
+					},
+				},
+				statusCode: 501,
+				err: &admin.Error{
+					Type:    admin.ErrorNotImplementedType.String(),
+					Detail:  "not implemented",
+					Message: "the database does not support the certificate inventory",
+				},
+			}
+		},
+		"fail/limit": func(t *testing.T) test {
+			return test{
+				req:        httptest.NewRequest("GET", "/foo?limit=all", http.NoBody),
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: `error parsing cursor and limit from query params: limit 'all' is not an integer: strconv.Atoi: parsing "all": invalid syntax`,
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				req: httptest.NewRequest("GET", "/foo?san=foo.example.com&serial=1234&provisioner=acme&status=active&expiresAfter=2029-12-01T00:00:00Z&expiresBefore=2030-02-01T00:00:00Z&cursor=abc&limit=5000", http.NoBody),
+				auth: &mockAdminAuthority{
+					MockQueryCertificates: func(q *authority.CertificateQuery) ([]*authority.CertificateInfo, string, error) {
+						assert.Equals(t, &authority.CertificateQuery{
+							SAN:           "foo.example.com",
+							SerialNumber:  "1234",
+							Provisioner:   "acme",
+							Status:        "active",
+							ExpiresAfter:  time.Date(2029, 12, 1, 0, 0, 0, 0, time.UTC),
+							ExpiresBefore: time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC),
+							Cursor:        "abc",
+							Limit:         authority.DefaultCertificatesMax,
+						}, q)
+						return certs, "def", nil
+					},
+				},
+				statusCode: 200,
+				resp:       GetCertificatesResponse{Certificates: certs, NextCursor: "def"},
+			}
+		},
+		"ok/default-limit": func(t *testing.T) test {
+			return test{
+				req: httptest.NewRequest("GET", "/foo", http.NoBody),
+				auth: &mockAdminAuthority{
+					MockQueryCertificates: func(q *authority.CertificateQuery) ([]*authority.CertificateInfo, string, error) {
+						assert.Equals(t, &authority.CertificateQuery{Limit: authority.DefaultCertificatesLimit}, q)
+						return certs, "", nil
+					},
+				},
+				statusCode: 200,
+				resp:       GetCertificatesResponse{Certificates: certs},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			w := httptest.NewRecorder()
+			GetCertificates(w, tc.req.WithContext(context.Background()))
+			res := w.Result()
+
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+
+			if res.StatusCode >= 400 {
+				adminErr := admin.Error{}
+				assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+				assert.Equals(t, tc.err.Type, adminErr.Type)
+				assert.Equals(t, tc.err.Message, adminErr.Message)
+				assert.Equals(t, tc.err.Detail, adminErr.Detail)
+				return
+			}
+
+			response := GetCertificatesResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			if !cmp.Equal(tc.resp, response) {
+				t.Errorf("GetCertificates diff =\n%s", cmp.Diff(tc.resp, response))
+			}
+		})
+	}
+}
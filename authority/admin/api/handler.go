@@ -91,6 +91,14 @@ func Route(r api.Router, options ...RouterOption) {
 	r.MethodFunc("PATCH", "/admins/{id}", authnz(UpdateAdmin))
 	r.MethodFunc("DELETE", "/admins/{id}", authnz(DeleteAdmin))
 
+	// Certificates
+	r.MethodFunc("GET", "/certificates", authnz(GetCertificates))
+
+	// SCEP one-time challenges
+	r.MethodFunc("GET", "/scep/{provisionerName}/challenges", authnz(GetSCEPChallenges))
+	r.MethodFunc("POST", "/scep/{provisionerName}/challenges", authnz(CreateSCEPChallenge))
+	r.MethodFunc("DELETE", "/scep/{provisionerName}/challenges/{id}", authnz(RevokeSCEPChallenge))
+
 	// ACME responder
 	if router.acmeResponder != nil {
 		// ACME External Account Binding Keys
@@ -757,11 +757,11 @@ func TestHandler_UpdateProvisioner(t *testing.T) {
 				body:       body,
 				auth:       auth,
 				adminDB:    db,
-				statusCode: 500,
+				statusCode: 400,
 				err: &admin.Error{
-					Type:    admin.ErrorServerInternalType.String(),
-					Status:  500,
-					Detail:  "the server experienced an internal error",
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  400,
+					Detail:  "bad request",
 					Message: "cannot change provisioner ID",
 				},
 			}
@@ -801,11 +801,11 @@ func TestHandler_UpdateProvisioner(t *testing.T) {
 				body:       body,
 				auth:       auth,
 				adminDB:    db,
-				statusCode: 500,
+				statusCode: 400,
 				err: &admin.Error{
-					Type:    admin.ErrorServerInternalType.String(),
-					Status:  500,
-					Detail:  "the server experienced an internal error",
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  400,
+					Detail:  "bad request",
 					Message: "cannot change provisioner type",
 				},
 			}
@@ -847,11 +847,11 @@ func TestHandler_UpdateProvisioner(t *testing.T) {
 				body:       body,
 				auth:       auth,
 				adminDB:    db,
-				statusCode: 500,
+				statusCode: 400,
 				err: &admin.Error{
-					Type:    admin.ErrorServerInternalType.String(),
-					Status:  500,
-					Detail:  "the server experienced an internal error",
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  400,
+					Detail:  "bad request",
 					Message: "cannot change provisioner authorityID",
 				},
 			}
@@ -896,11 +896,11 @@ func TestHandler_UpdateProvisioner(t *testing.T) {
 				body:       body,
 				auth:       auth,
 				adminDB:    db,
-				statusCode: 500,
+				statusCode: 400,
 				err: &admin.Error{
-					Type:    admin.ErrorServerInternalType.String(),
-					Status:  500,
-					Detail:  "the server experienced an internal error",
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  400,
+					Detail:  "bad request",
 					Message: "cannot change provisioner createdAt",
 				},
 			}
@@ -948,11 +948,11 @@ func TestHandler_UpdateProvisioner(t *testing.T) {
 				body:       body,
 				auth:       auth,
 				adminDB:    db,
-				statusCode: 500,
+				statusCode: 400,
 				err: &admin.Error{
-					Type:    admin.ErrorServerInternalType.String(),
-					Status:  500,
-					Detail:  "the server experienced an internal error",
+					Type:    admin.ErrorBadRequestType.String(),
+					Status:  400,
+					Detail:  "bad request",
 					Message: "cannot change provisioner deletedAt",
 				},
 			}
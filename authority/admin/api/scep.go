@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+// CreateSCEPChallengeRequest is the type for POST
+// /admin/scep/{provisionerName}/challenges requests.
+type CreateSCEPChallengeRequest struct {
+	Reference string    `json:"reference"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// Validate validates a new SCEP challenge request body.
+func (r *CreateSCEPChallengeRequest) Validate() error {
+	if len(r.Reference) > 256 {
+		return admin.NewError(admin.ErrorBadRequestType, "reference length %d exceeds the maximum (256)", len(r.Reference))
+	}
+	if !r.ExpiresAt.IsZero() && !r.ExpiresAt.After(time.Now()) {
+		return admin.NewError(admin.ErrorBadRequestType, "expiresAt %s is not in the future", r.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CreateSCEPChallengeResponse is the type for POST
+// /admin/scep/{provisionerName}/challenges responses. The challenge is only
+// returned in this response.
+type CreateSCEPChallengeResponse struct {
+	*db.SCEPChallenge
+	Challenge string `json:"challenge"`
+}
+
+// GetSCEPChallengesResponse is the type for GET
+// /admin/scep/{provisionerName}/challenges responses.
+type GetSCEPChallengesResponse struct {
+	Challenges []*db.SCEPChallenge `json:"challenges"`
+	NextCursor string              `json:"nextCursor"`
+}
+
+// GetSCEPChallenges returns a page of the one-time challenges of a SCEP
+// provisioner, including the transaction ID and the subject of the request
+// that used them.
+func GetSCEPChallenges(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := api.ParseCursor(r)
+	if err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err,
+			"error parsing cursor and limit from query params"))
+		return
+	}
+
+	name := chi.URLParam(r, "provisionerName")
+	challenges, nextCursor, err := mustAuthority(r.Context()).GetSCEPChallenges(r.Context(), name, cursor, limit)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	render.JSON(w, &GetSCEPChallengesResponse{
+		Challenges: challenges,
+		NextCursor: nextCursor,
+	})
+}
+
+// CreateSCEPChallenge creates a one-time challenge for a SCEP provisioner.
+func CreateSCEPChallenge(w http.ResponseWriter, r *http.Request) {
+	var body CreateSCEPChallengeRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, admin.WrapError(admin.ErrorBadRequestType, err, "error reading request body"))
+		return
+	}
+
+	if err := body.Validate(); err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	name := chi.URLParam(r, "provisionerName")
+	challenge, sc, err := mustAuthority(r.Context()).CreateSCEPChallenge(r.Context(), name, body.Reference, body.ExpiresAt)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+	render.JSONStatus(w, &CreateSCEPChallengeResponse{
+		SCEPChallenge: sc,
+		Challenge:     challenge,
+	}, http.StatusCreated)
+}
+
+// RevokeSCEPChallenge revokes an unused one-time challenge of a SCEP
+// provisioner.
+func RevokeSCEPChallenge(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provisionerName")
+	id := chi.URLParam(r, "id")
+	if _, err := mustAuthority(r.Context()).RevokeSCEPChallenge(r.Context(), name, id); err != nil {
+		render.Error(w, err)
+		return
+	}
+	render.JSON(w, &DeleteResponse{Status: "ok"})
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/db"
+)
+
+func scepChallengeRequest(method, body string) *http.Request {
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("provisionerName", "scep")
+	chiCtx.URLParams.Add("id", "challengeID")
+	req := httptest.NewRequest(method, "/foo", strings.NewReader(body))
+	return req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+}
+
+func assertAdminError(t *testing.T, res *http.Response, want *admin.Error) {
+	t.Helper()
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.FatalError(t, err)
+
+	adminErr := admin.Error{}
+	assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &adminErr))
+	assert.Equals(t, want.Type, adminErr.Type)
+	assert.Equals(t, want.Message, adminErr.Message)
+	assert.Equals(t, want.Detail, adminErr.Detail)
+}
+
+func TestCreateSCEPChallengeRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     CreateSCEPChallengeRequest
+		wantErr bool
+	}{
+		{"ok", CreateSCEPChallengeRequest{Reference: "device-1", ExpiresAt: time.Now().Add(time.Hour)}, false},
+		{"ok/empty", CreateSCEPChallengeRequest{}, false},
+		{"fail/reference-too-long", CreateSCEPChallengeRequest{Reference: strings.Repeat("A", 257)}, true},
+		{"fail/expired", CreateSCEPChallengeRequest{ExpiresAt: time.Now().Add(-time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("CreateSCEPChallengeRequest.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateSCEPChallenge(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	sc := &db.SCEPChallenge{
+		ID:            "challengeID",
+		ProvisionerID: "scep/scep",
+		Reference:     "device-1",
+		ExpiresAt:     expiresAt,
+	}
+	type test struct {
+		body       string
+		auth       adminAuthority
+		statusCode int
+		err        *admin.Error
+		resp       *CreateSCEPChallengeResponse
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/read.JSON": func(t *testing.T) test {
+			return test{
+				body:       "{",
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "error reading request body: error decoding json: unexpected EOF",
+				},
+			}
+		},
+		"fail/validate": func(t *testing.T) test {
+			return test{
+				body:       `{"expiresAt":"2020-01-01T00:00:00Z"}`,
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "expiresAt 2020-01-01T00:00:00Z is not in the future",
+				},
+			}
+		},
+		"fail/auth.CreateSCEPChallenge": func(t *testing.T) test {
+			return test{
+				body: `{}`,
+				auth: &mockAdminAuthority{
+					MockCreateSCEPChallenge: func(ctx context.Context, provisionerName, reference string, expiresAt time.Time) (string, *db.SCEPChallenge, error) {
+						return "", nil, admin.NewError(admin.ErrorBadRequestType, "provisioner scep does not have one-time challenges enabled")
+					},
+				},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "provisioner scep does not have one-time challenges enabled",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				body: `{"reference":"device-1","expiresAt":"` + expiresAt.Format(time.RFC3339) + `"}`,
+				auth: &mockAdminAuthority{
+					MockCreateSCEPChallenge: func(ctx context.Context, provisionerName, reference string, e time.Time) (string, *db.SCEPChallenge, error) {
+						assert.Equals(t, "scep", provisionerName)
+						assert.Equals(t, "device-1", reference)
+						assert.True(t, expiresAt.Equal(e))
+						return "secret", sc, nil
+					},
+				},
+				statusCode: 201,
+				resp:       &CreateSCEPChallengeResponse{SCEPChallenge: sc, Challenge: "secret"},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			w := httptest.NewRecorder()
+			CreateSCEPChallenge(w, scepChallengeRequest("POST", tc.body))
+			res := w.Result()
+
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if res.StatusCode >= 400 {
+				assertAdminError(t, res, tc.err)
+				return
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			response := &CreateSCEPChallengeResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), response))
+			if !cmp.Equal(tc.resp, response) {
+				t.Errorf("CreateSCEPChallenge diff =\n%s", cmp.Diff(tc.resp, response))
+			}
+		})
+	}
+}
+
+func TestGetSCEPChallenges(t *testing.T) {
+	usedAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	challenges := []*db.SCEPChallenge{
+		{
+			ID:            "challengeID",
+			ProvisionerID: "scep/scep",
+			ExpiresAt:     usedAt.Add(time.Hour),
+			UsedAt:        usedAt,
+			TransactionID: "transaction-1",
+			Subject:       "CN=device-1",
+		},
+	}
+	type test struct {
+		query      string
+		auth       adminAuthority
+		statusCode int
+		err        *admin.Error
+		resp       GetSCEPChallengesResponse
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/parse-cursor": func(t *testing.T) test {
+			return test{
+				query:      "limit=A",
+				auth:       &mockAdminAuthority{},
+				statusCode: 400,
+				err: &admin.Error{
+					Type:    admin.ErrorBadRequestType.String(),
+					Detail:  "bad request",
+					Message: "error parsing cursor and limit from query params: limit 'A' is not an integer: strconv.Atoi: parsing \"A\": invalid syntax",
+				},
+			}
+		},
+		"fail/auth.GetSCEPChallenges": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockGetSCEPChallenges: func(ctx context.Context, provisionerName, cursor string, limit int) ([]*db.SCEPChallenge, string, error) {
+						return nil, "", admin.NewError(admin.ErrorNotImplementedType, "database does not support SCEP one-time challenges")
+					},
+				},
+				statusCode: 501,
+				err: &admin.Error{
+					Type:    admin.ErrorNotImplementedType.String(),
+					Detail:  "not implemented",
+					Message: "database does not support SCEP one-time challenges",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockGetSCEPChallenges: func(ctx context.Context, provisionerName, cursor string, limit int) ([]*db.SCEPChallenge, string, error) {
+						assert.Equals(t, "scep", provisionerName)
+						assert.Equals(t, "", cursor)
+						assert.Equals(t, 0, limit)
+						return challenges, "", nil
+					},
+				},
+				statusCode: 200,
+				resp:       GetSCEPChallengesResponse{Challenges: challenges},
+			}
+		},
+		"ok/cursor": func(t *testing.T) test {
+			return test{
+				query: "cursor=challengeID&limit=1",
+				auth: &mockAdminAuthority{
+					MockGetSCEPChallenges: func(ctx context.Context, provisionerName, cursor string, limit int) ([]*db.SCEPChallenge, string, error) {
+						assert.Equals(t, "scep", provisionerName)
+						assert.Equals(t, "challengeID", cursor)
+						assert.Equals(t, 1, limit)
+						return challenges, "nextID", nil
+					},
+				},
+				statusCode: 200,
+				resp:       GetSCEPChallengesResponse{Challenges: challenges, NextCursor: "nextID"},
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			w := httptest.NewRecorder()
+			req := scepChallengeRequest("GET", "")
+			req.URL.RawQuery = tc.query
+			GetSCEPChallenges(w, req)
+			res := w.Result()
+
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if res.StatusCode >= 400 {
+				assertAdminError(t, res, tc.err)
+				return
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			response := GetSCEPChallengesResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			if !cmp.Equal(tc.resp, response) {
+				t.Errorf("GetSCEPChallenges diff =\n%s", cmp.Diff(tc.resp, response))
+			}
+		})
+	}
+}
+
+func TestRevokeSCEPChallenge(t *testing.T) {
+	type test struct {
+		auth       adminAuthority
+		statusCode int
+		err        *admin.Error
+	}
+	var tests = map[string]func(t *testing.T) test{
+		"fail/auth.RevokeSCEPChallenge": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockRevokeSCEPChallenge: func(ctx context.Context, provisionerName, id string) (*db.SCEPChallenge, error) {
+						return nil, admin.NewError(admin.ErrorNotFoundType, "SCEP challenge %s not found", id)
+					},
+				},
+				statusCode: 404,
+				err: &admin.Error{
+					Type:    admin.ErrorNotFoundType.String(),
+					Detail:  "resource not found",
+					Message: "SCEP challenge challengeID not found",
+				},
+			}
+		},
+		"ok": func(t *testing.T) test {
+			return test{
+				auth: &mockAdminAuthority{
+					MockRevokeSCEPChallenge: func(ctx context.Context, provisionerName, id string) (*db.SCEPChallenge, error) {
+						assert.Equals(t, "scep", provisionerName)
+						assert.Equals(t, "challengeID", id)
+						return &db.SCEPChallenge{ID: id, RevokedAt: time.Now()}, nil
+					},
+				},
+				statusCode: 200,
+			}
+		},
+	}
+	for name, prep := range tests {
+		tc := prep(t)
+		t.Run(name, func(t *testing.T) {
+			mockMustAuthority(t, tc.auth)
+			w := httptest.NewRecorder()
+			RevokeSCEPChallenge(w, scepChallengeRequest("DELETE", ""))
+			res := w.Result()
+
+			assert.Equals(t, tc.statusCode, res.StatusCode)
+			if res.StatusCode >= 400 {
+				assertAdminError(t, res, tc.err)
+				return
+			}
+
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			response := DeleteResponse{}
+			assert.FatalError(t, json.Unmarshal(bytes.TrimSpace(body), &response))
+			assert.Equals(t, "ok", response.Status)
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/stretchr/testify/assert"
 	"go.step.sm/linkedca"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -252,6 +253,29 @@ func TestWebhookAdminResponder_CreateProvisionerWebhook(t *testing.T) {
 				statusCode: 201,
 			}
 		},
+		"ok/device-attestation": func(t *testing.T) test {
+			prov := &linkedca.Provisioner{
+				Name: "provName",
+			}
+			ctx := linkedca.NewContextWithProvisioner(context.Background(), prov)
+			body := []byte(`{"name": "inventory", "url": "https://example.com", "kind": 5}`)
+			return test{
+				ctx: ctx,
+				auth: &mockAdminAuthority{
+					MockUpdateProvisioner: func(ctx context.Context, nu *linkedca.Provisioner) error {
+						assert.Equal(t, provisioner.WebhookKindDeviceAttestationValue, nu.Webhooks[0].Kind)
+						return nil
+					},
+				},
+				body: body,
+				response: &linkedca.Webhook{
+					Name: "inventory",
+					Url:  "https://example.com",
+					Kind: provisioner.WebhookKindDeviceAttestationValue,
+				},
+				statusCode: 201,
+			}
+		},
 	}
 	for name, prep := range tests {
 		tc := prep(t)
@@ -7,6 +7,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/nosql"
 	"go.step.sm/linkedca"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -240,7 +241,7 @@ func dbWebhooksToLinkedca(dbwhs []dbWebhook) []*linkedca.Webhook {
 			Name:                 dbwh.Name,
 			Id:                   dbwh.ID,
 			Url:                  dbwh.URL,
-			Kind:                 linkedca.Webhook_Kind(linkedca.Webhook_Kind_value[dbwh.Kind]),
+			Kind:                 provisioner.WebhookKindValue(dbwh.Kind),
 			Secret:               dbwh.Secret,
 			DisableTlsClientAuth: dbwh.DisableTLSClientAuth,
 			CertType:             linkedca.Webhook_CertType(linkedca.Webhook_CertType_value[dbwh.CertType]),
@@ -276,7 +277,7 @@ func linkedcaWebhooksToDB(lwhs []*linkedca.Webhook) []dbWebhook {
 			Name:                 lwh.Name,
 			ID:                   lwh.Id,
 			URL:                  lwh.Url,
-			Kind:                 lwh.Kind.String(),
+			Kind:                 provisioner.WebhookKindName(lwh.Kind),
 			Secret:               lwh.Secret,
 			DisableTLSClientAuth: lwh.DisableTlsClientAuth,
 			CertType:             lwh.CertType.String(),
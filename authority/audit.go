@@ -0,0 +1,167 @@
+package authority
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/audit"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+// GetAuditLogger returns the audit logger, or nil if the audit log is not
+// enabled.
+func (a *Authority) GetAuditLogger() *audit.Logger {
+	return a.auditLogger
+}
+
+// initAudit creates the audit logger with the configured sinks and key.
+func (a *Authority) initAudit() error {
+	var key []byte
+	if fn := a.config.Audit.KeyFile; fn != "" {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			return fmt.Errorf("error reading audit.keyFile: %w", err)
+		}
+		if key = bytes.TrimSpace(b); len(key) == 0 {
+			return fmt.Errorf("audit.keyFile %s is empty", fn)
+		}
+	}
+
+	var sinks []audit.Sink
+	for i, c := range a.config.Audit.Sinks {
+		var (
+			s   audit.Sink
+			err error
+		)
+		switch c.Type {
+		case config.AuditSinkFile:
+			s, err = audit.NewFileSink(c.Path)
+		case config.AuditSinkSyslog:
+			s, err = audit.NewSyslogSink(c.Network, c.Address, c.Tag)
+		case config.AuditSinkWebhook:
+			var timeout = audit.DefaultWebhookTimeout
+			if c.Timeout != nil {
+				timeout = c.Timeout.Duration
+			}
+			s = audit.NewWebhookSink(c.URL, c.BearerToken, nil, timeout)
+		default:
+			err = fmt.Errorf("unsupported audit sink type %q", c.Type)
+		}
+		if err != nil {
+			for _, s := range sinks {
+				s.Close()
+			}
+			return fmt.Errorf("error initializing audit.sinks[%d]: %w", i, err)
+		}
+		sinks = append(sinks, s)
+	}
+	a.auditLogger = audit.New(key, sinks...)
+	return nil
+}
+
+// auditX509 writes an event for the given X.509 certificate in the audit log.
+func (a *Authority) auditX509(typ audit.EventType, prov provisioner.Interface, cert *x509.Certificate, details map[string]string) error {
+	if a.auditLogger == nil {
+		return nil
+	}
+
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	ev := &audit.Event{
+		Type:           typ,
+		KeyFingerprint: hex.EncodeToString(sum[:]),
+		SerialNumber:   cert.SerialNumber.String(),
+		Subject:        cert.Subject.CommonName,
+		SANs:           certificateSANs(cert),
+		Details:        details,
+	}
+	setAuditProvisioner(ev, prov)
+	return a.auditLogger.Log(ev)
+}
+
+// auditX509WebhookDecisions writes an event for each decision of an authorizing
+// webhook applied to the given issued X.509 certificate in the audit log.
+func (a *Authority) auditX509WebhookDecisions(prov provisioner.Interface, leaf *x509.Certificate, decisions []*provisioner.WebhookDecision) error {
+	if a.auditLogger == nil {
+		return nil
+	}
+
+	for _, d := range decisions {
+		details := map[string]string{
+			"webhook":  d.Webhook,
+			"notAfter": leaf.NotAfter.UTC().Format(time.RFC3339),
+		}
+		if d.Reason != "" {
+			details["reason"] = d.Reason
+		}
+		ev := &audit.Event{
+			Type:         audit.X509WebhookDecision,
+			SerialNumber: leaf.SerialNumber.String(),
+			Subject:      leaf.Subject.CommonName,
+			SANs:         d.SANs,
+			Details:      details,
+		}
+		setAuditProvisioner(ev, prov)
+		if err := a.auditLogger.Log(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditSSH writes an event for the given SSH certificate in the audit log.
+func (a *Authority) auditSSH(typ audit.EventType, prov provisioner.Interface, cert *ssh.Certificate) error {
+	if a.auditLogger == nil {
+		return nil
+	}
+
+	certType := "user"
+	if cert.CertType == ssh.HostCert {
+		certType = "host"
+	}
+	ev := &audit.Event{
+		Type:           typ,
+		KeyFingerprint: ssh.FingerprintSHA256(cert.Key),
+		SerialNumber:   strconv.FormatUint(cert.Serial, 10),
+		Subject:        cert.KeyId,
+		SANs:           cert.ValidPrincipals,
+		Details:        map[string]string{"certType": certType},
+	}
+	setAuditProvisioner(ev, prov)
+	return a.auditLogger.Log(ev)
+}
+
+// auditRevoke writes the revocation of a certificate in the audit log. The
+// certificate is optional.
+func (a *Authority) auditRevoke(typ audit.EventType, serialNumber string, cert *x509.Certificate, details map[string]string) error {
+	if a.auditLogger == nil {
+		return nil
+	}
+	if cert != nil {
+		return a.auditX509(typ, nil, cert, details)
+	}
+	return a.auditLogger.Log(&audit.Event{
+		Type:         typ,
+		SerialNumber: serialNumber,
+		Details:      details,
+	})
+}
+
+func setAuditProvisioner(ev *audit.Event, prov provisioner.Interface) {
+	if prov == nil {
+		return
+	}
+	if p, ok := prov.(*wrappedProvisioner); ok && p.Interface == nil {
+		return
+	}
+	ev.Provisioner = prov.GetName()
+	ev.ProvisionerType = prov.GetType().String()
+}
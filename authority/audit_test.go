@@ -0,0 +1,247 @@
+package authority
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/keyutil"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/smallstep/certificates/audit"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/webhook"
+)
+
+func readAuditLog(t *testing.T, filename string) []audit.Event {
+	t.Helper()
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var events []audit.Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev audit.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		events = append(events, ev)
+	}
+	require.NoError(t, scanner.Err())
+	return events
+}
+
+func TestAuthority_initAudit(t *testing.T) {
+	dir := t.TempDir()
+	a := testAuthority(t)
+	assert.Nil(t, a.GetAuditLogger())
+
+	a.config.Audit = &config.AuditConfig{Sinks: []config.AuditSinkConfig{
+		{Type: "file", Path: filepath.Join(dir, "audit.log")},
+		{Type: "webhook", URL: "https://audit.example.com"},
+	}}
+	require.NoError(t, a.initAudit())
+	assert.NotNil(t, a.GetAuditLogger())
+	require.NoError(t, a.GetAuditLogger().Close())
+
+	a.config.Audit = &config.AuditConfig{Sinks: []config.AuditSinkConfig{
+		{Type: "file", Path: filepath.Join(dir, "missing", "audit.log")},
+	}}
+	assert.ErrorContains(t, a.initAudit(), "error initializing audit.sinks[0]")
+
+	keyFile := filepath.Join(dir, "audit.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("secret\n"), 0600))
+	a.config.Audit = &config.AuditConfig{
+		Sinks:   []config.AuditSinkConfig{{Type: "file", Path: filepath.Join(dir, "audit.log")}},
+		KeyFile: keyFile,
+	}
+	require.NoError(t, a.initAudit())
+	require.NoError(t, a.GetAuditLogger().Log(&audit.Event{Type: audit.X509Sign}))
+	require.NoError(t, a.GetAuditLogger().Close())
+	f, err := os.Open(filepath.Join(dir, "audit.log"))
+	require.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, audit.Verify(f, []byte("secret")))
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("\n"), 0600))
+	assert.ErrorContains(t, a.initAudit(), "is empty")
+	a.config.Audit.KeyFile = filepath.Join(dir, "missing.key")
+	assert.ErrorContains(t, a.initAudit(), "error reading audit.keyFile")
+}
+
+func TestAuthority_audit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := audit.NewFileSink(filename)
+	require.NoError(t, err)
+	a := testAuthority(t, WithAuditLogger(audit.New(nil, sink)))
+
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	require.NoError(t, err)
+	cert := &x509.Certificate{
+		SerialNumber:            big.NewInt(1234),
+		Subject:                 pkix.Name{CommonName: "foo.example.com"},
+		DNSNames:                []string{"foo.example.com"},
+		IPAddresses:             []net.IP{net.ParseIP("10.0.0.1")},
+		EmailAddresses:          []string{"foo@example.com"},
+		RawSubjectPublicKeyInfo: pub,
+		NotAfter:                time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	sshPub, err := ssh.NewPublicKey(signer.Public())
+	require.NoError(t, err)
+	sshCert := &ssh.Certificate{
+		Key:             sshPub,
+		Serial:          5678,
+		CertType:        ssh.HostCert,
+		KeyId:           "foo.example.com",
+		ValidPrincipals: []string{"foo.example.com", "foo"},
+	}
+	prov := &provisioner.JWK{Name: "jwk", Type: "JWK"}
+
+	require.NoError(t, a.auditX509(audit.X509Sign, wrapProvisioner(prov, nil), cert, nil))
+	require.NoError(t, a.auditX509(audit.X509Sign, wrapProvisioner(nil, nil), cert, nil))
+	require.NoError(t, a.auditSSH(audit.SSHSign, prov, sshCert))
+	require.NoError(t, a.auditRevoke(audit.X509Revoke, "1234", cert, map[string]string{"method": "token"}))
+	require.NoError(t, a.auditRevoke(audit.SSHRevoke, "5678", nil, map[string]string{"method": "token"}))
+	require.NoError(t, a.auditX509WebhookDecisions(prov, cert, []*provisioner.WebhookDecision{
+		{Webhook: "inventory", Decision: &webhook.Decision{SANs: []string{"foo.example.com"}, Reason: "unknown IP"}},
+	}))
+	require.NoError(t, a.GetAuditLogger().Close())
+
+	events := readAuditLog(t, filename)
+	require.Len(t, events, 6)
+
+	assert.Equal(t, audit.X509Sign, events[0].Type)
+	assert.Equal(t, "jwk", events[0].Provisioner)
+	assert.Equal(t, "JWK", events[0].ProvisionerType)
+	assert.Equal(t, "1234", events[0].SerialNumber)
+	assert.Equal(t, "foo.example.com", events[0].Subject)
+	assert.Equal(t, []string{"foo.example.com", "10.0.0.1", "foo@example.com"}, events[0].SANs)
+	assert.Len(t, events[0].KeyFingerprint, 64)
+
+	assert.Empty(t, events[1].Provisioner)
+
+	assert.Equal(t, audit.SSHSign, events[2].Type)
+	assert.Equal(t, "5678", events[2].SerialNumber)
+	assert.Equal(t, ssh.FingerprintSHA256(sshPub), events[2].KeyFingerprint)
+	assert.Equal(t, []string{"foo.example.com", "foo"}, events[2].SANs)
+	assert.Equal(t, map[string]string{"certType": "host"}, events[2].Details)
+
+	assert.Equal(t, audit.X509Revoke, events[3].Type)
+	assert.Equal(t, events[0].KeyFingerprint, events[3].KeyFingerprint)
+	assert.Equal(t, audit.SSHRevoke, events[4].Type)
+	assert.Equal(t, "5678", events[4].SerialNumber)
+
+	assert.Equal(t, audit.X509WebhookDecision, events[5].Type)
+	assert.Equal(t, "jwk", events[5].Provisioner)
+	assert.Equal(t, "1234", events[5].SerialNumber)
+	assert.Equal(t, "foo.example.com", events[5].Subject)
+	assert.Equal(t, []string{"foo.example.com"}, events[5].SANs)
+	assert.Equal(t, map[string]string{
+		"webhook":  "inventory",
+		"notAfter": "2030-01-01T00:00:00Z",
+		"reason":   "unknown IP",
+	}, events[5].Details)
+
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, audit.Verify(f, nil))
+
+	// Without an audit log nothing is written.
+	a.auditLogger = nil
+	assert.NoError(t, a.auditX509(audit.X509Sign, prov, cert, nil))
+}
+
+type mockX509WebhookController struct {
+	mockWebhookController
+	decisions []*provisioner.WebhookDecision
+}
+
+func (wc *mockX509WebhookController) AuthorizeX509(*webhook.RequestBody) ([]*provisioner.WebhookDecision, error) {
+	return wc.decisions, wc.authorizeErr
+}
+
+func TestAuthority_Sign_auditWebhookDecisions(t *testing.T) {
+	signer, err := keyutil.GenerateDefaultSigner()
+	require.NoError(t, err)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "smallstep test"},
+		DNSNames: []string{"test.smallstep.com"},
+	}, signer)
+	require.NoError(t, err)
+	cr, err := x509.ParseCertificateRequest(csr)
+	require.NoError(t, err)
+
+	now := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(now),
+		NotAfter:  provisioner.NewTimeDuration(now.Add(5 * time.Minute)),
+	}
+	key, err := jose.ReadKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	whCtl := &mockX509WebhookController{
+		decisions: []*provisioner.WebhookDecision{
+			{Webhook: "inventory", Decision: &webhook.Decision{NotAfter: now.Add(time.Minute).Truncate(time.Second)}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		storeErr   error
+		wantErr    bool
+		wantEvents []audit.EventType
+	}{
+		{"ok", nil, false, []audit.EventType{audit.X509WebhookDecision, audit.X509Sign}},
+		{"fail store", errors.New("force"), true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "audit.log")
+			sink, err := audit.NewFileSink(filename)
+			require.NoError(t, err)
+			a := testAuthority(t, WithAuditLogger(audit.New(nil, sink)))
+			token, err := generateToken("smallstep test", "step-cli", testAudiences.Sign[0], []string{"test.smallstep.com"}, now, key)
+			require.NoError(t, err)
+			ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+			extraOpts, err := a.Authorize(ctx, token)
+			require.NoError(t, err)
+
+			a.db = &db.MockAuthDB{
+				MStoreCertificate: func(*x509.Certificate) error {
+					return tt.storeErr
+				},
+			}
+
+			certs, err := a.Sign(cr, signOpts, append(extraOpts, whCtl)...)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NoError(t, a.GetAuditLogger().Close())
+
+			events := readAuditLog(t, filename)
+			require.Len(t, events, len(tt.wantEvents))
+			for i, typ := range tt.wantEvents {
+				assert.Equal(t, typ, events[i].Type)
+				assert.Equal(t, certs[0].SerialNumber.String(), events[i].SerialNumber)
+			}
+		})
+	}
+}
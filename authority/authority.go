@@ -23,6 +23,7 @@ import (
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/linkedca"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/admin"
 	adminDBNosql "github.com/smallstep/certificates/authority/admin/db/nosql"
 	"github.com/smallstep/certificates/authority/administrator"
@@ -33,6 +34,8 @@ import (
 	"github.com/smallstep/certificates/cas"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/internal/metrix"
+	"github.com/smallstep/certificates/ocsp"
 	"github.com/smallstep/certificates/scep"
 	"github.com/smallstep/certificates/templates"
 	"github.com/smallstep/nosql"
@@ -45,6 +48,7 @@ type Authority struct {
 	provisioners  *provisioner.Collection
 	admins        *administrator.Collection
 	db            db.AuthDB
+	dbHealth      dbHealth
 	adminDB       admin.DB
 	templates     *templates.Templates
 	linkedCAToken string
@@ -81,6 +85,22 @@ type Authority struct {
 	crlStopper chan struct{}
 	crlMutex   sync.Mutex
 
+	// OCSP responder
+	ocspResponder *ocsp.Responder
+
+	// Audit log
+	auditLogger *audit.Logger
+
+	// Metrics
+	meter *metrix.Meter
+
+	// Expiry notifications
+	expiryNotifier *expiryNotifier
+
+	// SCEP one-time challenges cleanup
+	scepChallengeTicker  *time.Ticker
+	scepChallengeStopper chan struct{}
+
 	// If true, do not re-initialize
 	initOnce  bool
 	startTime time.Time
@@ -785,6 +805,31 @@ func (a *Authority) init() error {
 		}
 	}
 
+	// Initialize the OCSP responder, the configuration is validated.
+	if a.config.OCSP.IsEnabled() {
+		if err := a.initOCSP(); err != nil {
+			return err
+		}
+	}
+
+	// Initialize the audit log, the configuration is validated.
+	if a.auditLogger == nil && a.config.Audit.IsEnabled() {
+		if err := a.initAudit(); err != nil {
+			return err
+		}
+	}
+
+	// Start the expiry notifications, the configuration is validated.
+	if err := a.startExpiryNotifier(); err != nil {
+		return err
+	}
+
+	// Start the deletion of the SCEP one-time challenges no longer usable.
+	a.startSCEPChallengeCleaner()
+
+	// Export the expiration of the intermediates.
+	a.meter.SetIntermediates(a.intermediateX509Certs)
+
 	// JWT numeric dates are seconds.
 	a.startTime = time.Now().Truncate(time.Second)
 	// Set flag indicating that initialization has been completed, and should
@@ -855,10 +900,15 @@ func (a *Authority) Shutdown() error {
 		a.crlTicker.Stop()
 		close(a.crlStopper)
 	}
+	a.stopExpiryNotifier()
+	a.stopSCEPChallengeCleaner()
 
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
+	if err := a.auditLogger.Close(); err != nil {
+		log.Printf("error closing the audit log: %v", err)
+	}
 	return a.db.Shutdown()
 }
 
@@ -868,10 +918,15 @@ func (a *Authority) CloseForReload() {
 		a.crlTicker.Stop()
 		close(a.crlStopper)
 	}
+	a.stopExpiryNotifier()
+	a.stopSCEPChallengeCleaner()
 
 	if err := a.keyManager.Close(); err != nil {
 		log.Printf("error closing the key manager: %v", err)
 	}
+	if err := a.auditLogger.Close(); err != nil {
+		log.Printf("error closing the audit log: %v", err)
+	}
 	if client, ok := a.adminDB.(*linkedCaClient); ok {
 		client.Stop()
 	}
@@ -879,7 +934,11 @@ func (a *Authority) CloseForReload() {
 
 // IsRevoked returns whether or not a certificate has been
 // revoked before.
-func (a *Authority) IsRevoked(sn string) (bool, error) {
+func (a *Authority) IsRevoked(sn string) (_ bool, err error) {
+	defer func(start time.Time) {
+		a.observeDB("is_revoked", start, err)
+	}(time.Now())
+
 	// Check the passive revocation table.
 	if lca, ok := a.adminDB.(interface {
 		IsRevoked(string) (bool, error)
@@ -197,10 +197,15 @@ func (a *Authority) UseToken(token string, prov provisioner.Interface) error {
 			sum := sha256.Sum256([]byte(token))
 			reuseKey = strings.ToLower(hex.EncodeToString(sum[:]))
 		}
+		if err := a.dbHealth.check(); err != nil {
+			return err
+		}
 		ok, err := a.db.UseToken(reuseKey, token)
 		if err != nil {
+			a.dbHealth.failure(err)
 			return errs.Wrap(http.StatusInternalServerError, err, "failed when attempting to store token")
 		}
+		a.dbHealth.success()
 		if !ok {
 			return errs.Unauthorized("token already used")
 		}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -71,6 +73,7 @@ type Config struct {
 	IntermediateKey  string               `json:"key"`
 	Address          string               `json:"address"`
 	InsecureAddress  string               `json:"insecureAddress"`
+	MetricsAddress   string               `json:"metricsAddress,omitempty"`
 	DNSNames         []string             `json:"dnsNames"`
 	KMS              *kms.Options         `json:"kms,omitempty"`
 	SSH              *SSHConfig           `json:"ssh,omitempty"`
@@ -83,12 +86,92 @@ type Config struct {
 	Templates        *templates.Templates `json:"templates,omitempty"`
 	CommonName       string               `json:"commonName,omitempty"`
 	CRL              *CRLConfig           `json:"crl,omitempty"`
+	OCSP             *OCSPConfig          `json:"ocsp,omitempty"`
+	Audit            *AuditConfig         `json:"audit,omitempty"`
+	Notifications    *NotificationsConfig `json:"notifications,omitempty"`
+	ExternalURL      *ExternalURL         `json:"externalURL,omitempty"`
+	ACME             *ACMEConfig          `json:"acme,omitempty"`
 	SkipValidation   bool                 `json:"-"`
 
 	// Keeps record of the filename the Config is read from
 	loadedFromFilepath string
 }
 
+// ExternalURL is the URL where the CA is reachable by its clients. It is used
+// to build the absolute URLs returned by the CA, instead of deriving them from
+// the request, when the CA runs behind a reverse proxy that rewrites the path.
+// If the host is not set, the host in the request is used, so multiple vanity
+// hostnames can share the same path prefix. If it is configured, the issued
+// certificates include the URL of the issuing intermediate as the caIssuers
+// access method, and the CRL distribution point and OCSP server, if enabled,
+// are resolved with it. SCEP certificates are issued by the same authority, so
+// they get the same URLs.
+type ExternalURL struct {
+	Scheme     string `json:"scheme,omitempty"`
+	Host       string `json:"host,omitempty"`
+	PathPrefix string `json:"pathPrefix,omitempty"`
+}
+
+// Validate validates the external URL configuration.
+func (e *ExternalURL) Validate() error {
+	if e == nil {
+		return nil
+	}
+
+	switch e.Scheme {
+	case "", "http", "https":
+	default:
+		return errors.Errorf("externalURL.scheme %q is not supported", e.Scheme)
+	}
+
+	if e.Host != "" {
+		if u, err := url.Parse("https://" + e.Host); err != nil || u.Host != e.Host || u.Path != "" {
+			return errors.Errorf("externalURL.host %q is not valid", e.Host)
+		}
+	}
+
+	if e.PathPrefix != "" {
+		if !strings.HasPrefix(e.PathPrefix, "/") {
+			return errors.New("externalURL.pathPrefix must start with a '/'")
+		}
+		if strings.ContainsAny(e.PathPrefix, "?#") {
+			return errors.Errorf("externalURL.pathPrefix %q is not valid", e.PathPrefix)
+		}
+	}
+
+	return nil
+}
+
+// BaseURL returns the base URL of the CA, the scheme and host will be empty if
+// they are not configured.
+func (e *ExternalURL) BaseURL() *url.URL {
+	if e == nil {
+		return nil
+	}
+	return &url.URL{
+		Scheme: e.Scheme,
+		Host:   e.Host,
+		Path:   strings.TrimSuffix(e.PathPrefix, "/"),
+	}
+}
+
+// Resolve returns the absolute URL of the given path, using the configured
+// scheme, host and path prefix. The scheme defaults to https, and the host to
+// the given one.
+func (e *ExternalURL) Resolve(host, path string) string {
+	u := url.URL{Scheme: "https", Host: toHostname(host), Path: path}
+	if e != nil {
+		if e.Scheme != "" {
+			u.Scheme = e.Scheme
+		}
+		if e.Host != "" {
+			u.Host = e.Host
+		}
+		u.Path = strings.TrimSuffix(e.PathPrefix, "/") + path
+	}
+	return u.String()
+}
+
 // CRLConfig represents config options for CRL generation
 type CRLConfig struct {
 	Enabled          bool                  `json:"enabled"`
@@ -96,6 +179,18 @@ type CRLConfig struct {
 	CacheDuration    *provisioner.Duration `json:"cacheDuration,omitempty"`
 	RenewPeriod      *provisioner.Duration `json:"renewPeriod,omitempty"`
 	IDPurl           string                `json:"idpURL,omitempty"`
+
+	// Path is an additional path where the CRL is served, besides /crl and
+	// /1.0/crl. If idpURL is not set, it's used in the distribution points.
+	Path string `json:"path,omitempty"`
+
+	// File is the name of the file where the CRL is written, in DER format,
+	// every time it's generated, so it can be published by other means.
+	File string `json:"file,omitempty"`
+
+	// EmbedDistributionPoint adds the URL of the CRL to the CRL distribution
+	// points of the issued certificates, unless the template sets them.
+	EmbedDistributionPoint bool `json:"embedDistributionPoint,omitempty"`
 }
 
 // IsEnabled returns if the CRL is enabled.
@@ -122,6 +217,10 @@ func (c *CRLConfig) Validate() error {
 		return errors.New("crl.cacheDuration must be greater than or equal to crl.renewPeriod")
 	}
 
+	if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+		return errors.New("crl.path must start with /")
+	}
+
 	return nil
 }
 
@@ -139,6 +238,435 @@ func (c *CRLConfig) TickerDuration() time.Duration {
 	return (c.CacheDuration.Duration / 3) * 2
 }
 
+// OCSPConfig represents the configuration of the built-in OCSP responder. The
+// responses are signed using a dedicated certificate, with the OCSPSigning
+// extended key usage, issued by the intermediate certificate.
+type OCSPConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// Certificate is the path to the PEM encoded certificate of the responder.
+	Certificate string `json:"certificate"`
+
+	// Key is the path or KMS URI of the key of the responder certificate.
+	Key string `json:"key"`
+
+	// CacheDuration is the validity of the responses, they are cached for
+	// half of this time. It defaults to 1 hour.
+	CacheDuration *provisioner.Duration `json:"cacheDuration,omitempty"`
+
+	// Path is an additional path where the responder is served, besides
+	// /ocsp and /1.0/ocsp.
+	Path string `json:"path,omitempty"`
+
+	// URL is the URL of the responder added to the authority information
+	// access extension of the issued certificates, unless the template sets
+	// it. If not set, it's built using the first DNS name, the insecure
+	// address and the path.
+	URL string `json:"url,omitempty"`
+}
+
+// IsEnabled returns if the OCSP responder is enabled.
+func (c *OCSPConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+// Validate validates the OCSP responder configuration.
+func (c *OCSPConfig) Validate() error {
+	if !c.IsEnabled() {
+		return nil
+	}
+
+	if c.Certificate == "" {
+		return errors.New("ocsp.certificate cannot be empty")
+	}
+
+	if c.Key == "" {
+		return errors.New("ocsp.key cannot be empty")
+	}
+
+	if c.CacheDuration != nil && c.CacheDuration.Duration < 0 {
+		return errors.New("ocsp.cacheDuration must be greater than or equal to 0")
+	}
+
+	if c.Path != "" && !strings.HasPrefix(c.Path, "/") {
+		return errors.New("ocsp.path must start with /")
+	}
+
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("ocsp.url must be an absolute URL")
+		}
+	}
+
+	return nil
+}
+
+// Audit sink types.
+const (
+	AuditSinkFile    = "file"
+	AuditSinkSyslog  = "syslog"
+	AuditSinkWebhook = "webhook"
+)
+
+// AuditConfig represents the configuration of the audit log. Every sign,
+// renew, rekey and revoke operation, ACME challenge transition and SCEP
+// enrollment is written to all the sinks before the CA responds. If keyFile is
+// set, the chain uses HMAC-SHA256 with the contents of the file as the key.
+type AuditConfig struct {
+	Sinks   []AuditSinkConfig `json:"sinks"`
+	KeyFile string            `json:"keyFile,omitempty"`
+}
+
+// AuditSinkConfig represents the configuration of a destination of the audit
+// log. The type is one of "file", "syslog" or "webhook".
+type AuditSinkConfig struct {
+	Type string `json:"type"`
+
+	// Path is the file where the events are appended, for the file sink.
+	Path string `json:"path,omitempty"`
+
+	// Network, Address and Tag are the syslog server and the tag used, for
+	// the syslog sink. If the network is empty, the local server is used.
+	Network string `json:"network,omitempty"`
+	Address string `json:"address,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+
+	// URL, BearerToken and Timeout configure the endpoint the events are
+	// posted to, for the webhook sink.
+	URL         string                `json:"url,omitempty"`
+	BearerToken string                `json:"bearerToken,omitempty"`
+	Timeout     *provisioner.Duration `json:"timeout,omitempty"`
+}
+
+// IsEnabled returns if the audit log is enabled.
+func (c *AuditConfig) IsEnabled() bool {
+	return c != nil && len(c.Sinks) > 0
+}
+
+// Validate validates the audit log configuration.
+func (c *AuditConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	for i, s := range c.Sinks {
+		switch s.Type {
+		case AuditSinkFile:
+			if s.Path == "" {
+				return errors.Errorf("audit.sinks[%d].path cannot be empty", i)
+			}
+		case AuditSinkSyslog:
+			if s.Network != "" && s.Address == "" {
+				return errors.Errorf("audit.sinks[%d].address cannot be empty", i)
+			}
+		case AuditSinkWebhook:
+			u, err := url.Parse(s.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.Errorf("audit.sinks[%d].url %q is not a valid http(s) url", i, s.URL)
+			}
+			if s.Timeout != nil && s.Timeout.Duration < 0 {
+				return errors.Errorf("audit.sinks[%d].timeout must be greater than or equal to 0", i)
+			}
+		default:
+			return errors.Errorf("audit.sinks[%d].type %q is not supported", i, s.Type)
+		}
+	}
+
+	return nil
+}
+
+var (
+	// DefaultExpiryWindow is the default time before the expiration of a
+	// certificate when the expiry notification is sent.
+	DefaultExpiryWindow = 7 * 24 * time.Hour
+	// DefaultExpiryInterval is the default interval between the checks of the
+	// expiring certificates.
+	DefaultExpiryInterval = time.Hour
+)
+
+// NotificationsConfig represents the configuration of the notifications sent
+// by the CA.
+type NotificationsConfig struct {
+	Expiry *ExpiryNotificationsConfig `json:"expiry,omitempty"`
+}
+
+// ExpiryNotificationsConfig represents the configuration of the notifications
+// sent when the X.509 certificates in the database are about to expire without
+// having been renewed or revoked. The notifications are posted to all the
+// webhooks and sent to the email recipients.
+type ExpiryNotificationsConfig struct {
+	// Window is how long before the expiration the notification is sent.
+	Window *provisioner.Duration `json:"window,omitempty"`
+	// Interval is how often the certificates are checked.
+	Interval *provisioner.Duration `json:"interval,omitempty"`
+
+	Webhooks []NotificationWebhookConfig `json:"webhooks,omitempty"`
+	Email    *NotificationEmailConfig    `json:"email,omitempty"`
+}
+
+// NotificationWebhookConfig represents an endpoint the notifications are
+// posted to.
+type NotificationWebhookConfig struct {
+	URL         string                `json:"url"`
+	BearerToken string                `json:"bearerToken,omitempty"`
+	Timeout     *provisioner.Duration `json:"timeout,omitempty"`
+}
+
+// NotificationEmailConfig represents the SMTP server used to send the
+// notifications by email, and the recipients. The username and password are
+// optional, and if set they are sent using the PLAIN authentication.
+type NotificationEmailConfig struct {
+	Address  string   `json:"address"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// ExpiryEnabled returns if the expiry notifications are enabled.
+func (c *NotificationsConfig) ExpiryEnabled() bool {
+	return c != nil && c.Expiry != nil &&
+		(len(c.Expiry.Webhooks) > 0 || c.Expiry.Email != nil)
+}
+
+// WindowDuration returns how long before the expiration of a certificate the
+// notification is sent.
+func (c *ExpiryNotificationsConfig) WindowDuration() time.Duration {
+	if c == nil || c.Window == nil || c.Window.Duration == 0 {
+		return DefaultExpiryWindow
+	}
+	return c.Window.Duration
+}
+
+// IntervalDuration returns the interval between the checks of the expiring
+// certificates.
+func (c *ExpiryNotificationsConfig) IntervalDuration() time.Duration {
+	if c == nil || c.Interval == nil || c.Interval.Duration == 0 {
+		return DefaultExpiryInterval
+	}
+	return c.Interval.Duration
+}
+
+// Validate validates the notifications configuration.
+func (c *NotificationsConfig) Validate() error {
+	if c == nil || c.Expiry == nil {
+		return nil
+	}
+
+	e := c.Expiry
+	if e.Window != nil && e.Window.Duration < 0 {
+		return errors.New("notifications.expiry.window must be greater than or equal to 0")
+	}
+	if e.Interval != nil && e.Interval.Duration < 0 {
+		return errors.New("notifications.expiry.interval must be greater than or equal to 0")
+	}
+	for i, w := range e.Webhooks {
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("notifications.expiry.webhooks[%d].url %q is not a valid http(s) url", i, w.URL)
+		}
+		if w.Timeout != nil && w.Timeout.Duration < 0 {
+			return errors.Errorf("notifications.expiry.webhooks[%d].timeout must be greater than or equal to 0", i)
+		}
+	}
+	if m := e.Email; m != nil {
+		if _, _, err := net.SplitHostPort(m.Address); err != nil {
+			return errors.Errorf("notifications.expiry.email.address %q must be a host:port", m.Address)
+		}
+		if m.From == "" {
+			return errors.New("notifications.expiry.email.from cannot be empty")
+		}
+		if len(m.To) == 0 {
+			return errors.New("notifications.expiry.email.to cannot be empty")
+		}
+	}
+
+	return nil
+}
+
+// ACMEConfig represents the global configuration options of the ACME server.
+type ACMEConfig struct {
+	Validation *ACMEValidationConfig `json:"validation,omitempty"`
+	Nonces     *ACMENoncesConfig     `json:"nonces,omitempty"`
+	Revocation *ACMERevocationConfig `json:"revocation,omitempty"`
+}
+
+// ACMERevocationConfig represents the configuration of the client used to
+// check the revocation status of the device attestation certificates. The
+// cacheSize is the maximum number of CRLs, and of OCSP responses, kept in
+// memory.
+type ACMERevocationConfig struct {
+	Timeout   *provisioner.Duration `json:"timeout,omitempty"`
+	CacheSize int                   `json:"cacheSize,omitempty"`
+}
+
+// ACMENoncesConfig represents the configuration of the replay nonces. The
+// backend can be "db", the default, that stores the nonces in the database, or
+// "memory", that creates stateless nonces signed with a random key generated
+// on each start and keeps the used nonces in memory until they expire. The
+// memory backend cannot be shared by several CA instances, the nonces of an
+// instance are rejected by the others. The expired nonces are deleted every
+// cleanupInterval.
+type ACMENoncesConfig struct {
+	Backend         string                `json:"backend,omitempty"`
+	TTL             *provisioner.Duration `json:"ttl,omitempty"`
+	CleanupInterval *provisioner.Duration `json:"cleanupInterval,omitempty"`
+}
+
+// ACMEValidationConfig represents the configuration of the client used to
+// validate the ACME challenges.
+type ACMEValidationConfig struct {
+	DNS          *ACMEDNSConfig          `json:"dns,omitempty"`
+	Perspectives *ACMEPerspectivesConfig `json:"perspectives,omitempty"`
+	Egress       *ACMEEgressConfig       `json:"egress,omitempty"`
+}
+
+// ACMEEgressConfig represents the network configuration used to connect to the
+// targets of the http-01 and tls-alpn-01 challenges. The proxy is a URL with
+// the http, https, socks5 or socks5h schemes, and the source address is the IP
+// address or the name of the network interface used for the outgoing
+// connections. For interfaces, an address of each family is used, so IPv4 and
+// IPv6 targets can be reached. If maxRedirects is set, the http-01 validation will not follow
+// more than the given number of redirects.
+type ACMEEgressConfig struct {
+	Proxy         string                `json:"proxy,omitempty"`
+	SourceAddress string                `json:"sourceAddress,omitempty"`
+	DialTimeout   *provisioner.Duration `json:"dialTimeout,omitempty"`
+	Timeout       *provisioner.Duration `json:"timeout,omitempty"`
+	MaxRedirects  *int                  `json:"maxRedirects,omitempty"`
+}
+
+// ACMEDNSConfig represents the configuration of the resolver used to validate
+// the dns-01 challenge. Resolvers are tried in order and can be IP addresses,
+// "host:port" pairs, or URLs with the udp, tcp, tls (DNS over TLS) or https
+// (DNS over HTTPS) schemes. If authoritative is set, the TXT records are
+// looked up directly on the authoritative name servers of the zone.
+type ACMEDNSConfig struct {
+	Resolvers     []string              `json:"resolvers,omitempty"`
+	Timeout       *provisioner.Duration `json:"timeout,omitempty"`
+	Authoritative bool                  `json:"authoritative,omitempty"`
+}
+
+// ACMEPerspectivesConfig represents the configuration of the multi-perspective
+// validation of the http-01, dns-01, and tls-alpn-01 challenges. Challenges
+// validated by the CA must also be validated by a quorum of the remote
+// perspectives. The root, crt, and key files are used to authenticate the
+// connections with the remote perspectives, and the secret, if set, is sent
+// to them as a bearer token. The remote perspectives require a client
+// certificate, a secret, or both.
+type ACMEPerspectivesConfig struct {
+	Remotes     []ACMERemotePerspective `json:"remotes"`
+	Quorum      int                     `json:"quorum,omitempty"`
+	Timeout     *provisioner.Duration   `json:"timeout,omitempty"`
+	Root        string                  `json:"root,omitempty"`
+	Certificate string                  `json:"crt,omitempty"`
+	Key         string                  `json:"key,omitempty"`
+	Secret      string                  `json:"secret,omitempty"`
+}
+
+// ACMERemotePerspective is the name and url of a remote perspective agent.
+type ACMERemotePerspective struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Validate validates the ACME configuration.
+func (c *ACMEConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	if n := c.Nonces; n != nil {
+		switch n.Backend {
+		case "", "db", "memory":
+		default:
+			return errors.Errorf("acme.nonces.backend %q is not supported", n.Backend)
+		}
+		if n.TTL != nil && n.TTL.Duration < 0 {
+			return errors.New("acme.nonces.ttl must be greater than or equal to 0")
+		}
+		if n.CleanupInterval != nil && n.CleanupInterval.Duration < 0 {
+			return errors.New("acme.nonces.cleanupInterval must be greater than or equal to 0")
+		}
+	}
+
+	if r := c.Revocation; r != nil {
+		if r.Timeout != nil && r.Timeout.Duration < 0 {
+			return errors.New("acme.revocation.timeout must be greater than or equal to 0")
+		}
+		if r.CacheSize < 0 {
+			return errors.New("acme.revocation.cacheSize must be greater than or equal to 0")
+		}
+	}
+
+	if c.Validation == nil {
+		return nil
+	}
+
+	if dns := c.Validation.DNS; dns != nil {
+		for _, r := range dns.Resolvers {
+			if strings.TrimSpace(r) == "" {
+				return errors.New("acme.validation.dns.resolvers cannot contain empty values")
+			}
+		}
+		if dns.Timeout != nil && dns.Timeout.Duration < 0 {
+			return errors.New("acme.validation.dns.timeout must be greater than or equal to 0")
+		}
+	}
+
+	if p := c.Validation.Perspectives; p != nil {
+		if len(p.Remotes) == 0 {
+			return errors.New("acme.validation.perspectives.remotes cannot be empty")
+		}
+		for _, r := range p.Remotes {
+			if r.Name == "" || r.URL == "" {
+				return errors.New("acme.validation.perspectives.remotes require a name and url")
+			}
+		}
+		if p.Quorum < 0 || p.Quorum > len(p.Remotes) {
+			return errors.New("acme.validation.perspectives.quorum must be between 0 and the number of remotes")
+		}
+		if p.Timeout != nil && p.Timeout.Duration < 0 {
+			return errors.New("acme.validation.perspectives.timeout must be greater than or equal to 0")
+		}
+		if (p.Certificate == "") != (p.Key == "") {
+			return errors.New("acme.validation.perspectives.crt and acme.validation.perspectives.key must be set together")
+		}
+		if p.Certificate == "" && p.Secret == "" {
+			return errors.New("acme.validation.perspectives requires crt and key, or secret")
+		}
+	}
+
+	if e := c.Validation.Egress; e != nil {
+		if e.Proxy != "" {
+			u, err := url.Parse(e.Proxy)
+			if err != nil {
+				return errors.Wrap(err, "acme.validation.egress.proxy is not valid")
+			}
+			switch u.Scheme {
+			case "http", "https", "socks5", "socks5h":
+			default:
+				return errors.Errorf("acme.validation.egress.proxy scheme %q is not supported", u.Scheme)
+			}
+			if u.Hostname() == "" {
+				return errors.New("acme.validation.egress.proxy must contain a host")
+			}
+		}
+		if e.DialTimeout != nil && e.DialTimeout.Duration < 0 {
+			return errors.New("acme.validation.egress.dialTimeout must be greater than or equal to 0")
+		}
+		if e.Timeout != nil && e.Timeout.Duration < 0 {
+			return errors.New("acme.validation.egress.timeout must be greater than or equal to 0")
+		}
+		if e.MaxRedirects != nil && *e.MaxRedirects < 0 {
+			return errors.New("acme.validation.egress.maxRedirects must be greater than or equal to 0")
+		}
+	}
+
+	return nil
+}
+
 // ASN1DN contains ASN1.DN attributes that are used in Subject and Issuer
 // x509 Certificate blocks.
 type ASN1DN struct {
@@ -327,6 +855,14 @@ func (c *Config) Validate() error {
 		return errors.Errorf("invalid address %s", c.Address)
 	}
 
+	// Validate the metrics address, the metrics are served on a separate
+	// listener.
+	if c.MetricsAddress != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddress); err != nil {
+			return errors.Errorf("invalid metricsAddress %s", c.MetricsAddress)
+		}
+	}
+
 	if c.TLS == nil {
 		c.TLS = &DefaultTLSOptions
 	} else {
@@ -345,6 +881,11 @@ func (c *Config) Validate() error {
 		c.TLS.Renegotiation = c.TLS.Renegotiation || DefaultTLSOptions.Renegotiation
 	}
 
+	// Validate db options, nil is ok.
+	if err := c.DB.Validate(); err != nil {
+		return err
+	}
+
 	// Validate KMS options, nil is ok.
 	if err := c.KMS.Validate(); err != nil {
 		return err
@@ -370,6 +911,31 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	// Validate ocsp config: nil is ok
+	if err := c.OCSP.Validate(); err != nil {
+		return err
+	}
+
+	// Validate audit config: nil is ok
+	if err := c.Audit.Validate(); err != nil {
+		return err
+	}
+
+	// Validate notifications config: nil is ok
+	if err := c.Notifications.Validate(); err != nil {
+		return err
+	}
+
+	// Validate the external url: nil is ok
+	if err := c.ExternalURL.Validate(); err != nil {
+		return err
+	}
+
+	// Validate acme config: nil is ok
+	if err := c.ACME.Validate(); err != nil {
+		return err
+	}
+
 	return c.AuthorityConfig.Validate(c.GetAudiences())
 }
 
@@ -385,33 +951,42 @@ func (c *Config) GetAudiences() provisioner.Audiences {
 		SSHRenew:  []string{},
 	}
 
+	// The audiences of the external url are also accepted, so tokens can be
+	// created with the url used by the clients.
+	bases := make([]string, 0, len(c.DNSNames)+1)
 	for _, name := range c.DNSNames {
-		hostname := toHostname(name)
+		bases = append(bases, "https://"+toHostname(name))
+	}
+	if c.ExternalURL != nil && c.ExternalURL.Host != "" {
+		bases = append(bases, c.ExternalURL.Resolve("", ""))
+	}
+
+	for _, base := range bases {
 		audiences.Sign = append(audiences.Sign,
-			fmt.Sprintf("https://%s/1.0/sign", hostname),
-			fmt.Sprintf("https://%s/sign", hostname),
-			fmt.Sprintf("https://%s/1.0/ssh/sign", hostname),
-			fmt.Sprintf("https://%s/ssh/sign", hostname))
+			base+"/1.0/sign",
+			base+"/sign",
+			base+"/1.0/ssh/sign",
+			base+"/ssh/sign")
 		audiences.Renew = append(audiences.Renew,
-			fmt.Sprintf("https://%s/1.0/renew", hostname),
-			fmt.Sprintf("https://%s/renew", hostname))
+			base+"/1.0/renew",
+			base+"/renew")
 		audiences.Revoke = append(audiences.Revoke,
-			fmt.Sprintf("https://%s/1.0/revoke", hostname),
-			fmt.Sprintf("https://%s/revoke", hostname))
+			base+"/1.0/revoke",
+			base+"/revoke")
 		audiences.SSHSign = append(audiences.SSHSign,
-			fmt.Sprintf("https://%s/1.0/ssh/sign", hostname),
-			fmt.Sprintf("https://%s/ssh/sign", hostname),
-			fmt.Sprintf("https://%s/1.0/sign", hostname),
-			fmt.Sprintf("https://%s/sign", hostname))
+			base+"/1.0/ssh/sign",
+			base+"/ssh/sign",
+			base+"/1.0/sign",
+			base+"/sign")
 		audiences.SSHRevoke = append(audiences.SSHRevoke,
-			fmt.Sprintf("https://%s/1.0/ssh/revoke", hostname),
-			fmt.Sprintf("https://%s/ssh/revoke", hostname))
+			base+"/1.0/ssh/revoke",
+			base+"/ssh/revoke")
 		audiences.SSHRenew = append(audiences.SSHRenew,
-			fmt.Sprintf("https://%s/1.0/ssh/renew", hostname),
-			fmt.Sprintf("https://%s/ssh/renew", hostname))
+			base+"/1.0/ssh/renew",
+			base+"/ssh/renew")
 		audiences.SSHRekey = append(audiences.SSHRekey,
-			fmt.Sprintf("https://%s/1.0/ssh/rekey", hostname),
-			fmt.Sprintf("https://%s/ssh/rekey", hostname))
+			base+"/1.0/ssh/rekey",
+			base+"/ssh/rekey")
 	}
 
 	return audiences
@@ -0,0 +1,95 @@
+package authority
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// degradedRetryInterval is the time during which requests that require writes
+// to the database will fail fast after a write has failed. After this time, a
+// new request will be attempted, and if it succeeds the authority will leave
+// the degraded mode.
+var degradedRetryInterval = 30 * time.Second
+
+// dbHealth keeps track of the writes to the database. The authority enters the
+// degraded mode when a write fails, and it leaves it after a write succeeds.
+type dbHealth struct {
+	mu      sync.RWMutex
+	err     error
+	since   time.Time
+	retryAt time.Time
+}
+
+// failure records a failed write and puts the authority in degraded mode.
+func (h *dbHealth) failure(err error) {
+	now := time.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err == nil {
+		log.Printf("database write failed, entering degraded mode: %v", err)
+		h.since = now
+	}
+	h.err = err
+	h.retryAt = now.Add(degradedRetryInterval)
+}
+
+// success records a successful write and leaves the degraded mode.
+func (h *dbHealth) success() {
+	h.mu.RLock()
+	degraded := h.err != nil
+	h.mu.RUnlock()
+	if !degraded {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil {
+		log.Printf("database write succeeded, leaving degraded mode after %s", time.Since(h.since).Round(time.Second))
+		h.err = nil
+		h.since = time.Time{}
+		h.retryAt = time.Time{}
+	}
+}
+
+// status returns the last write error and the time since the authority is in
+// degraded mode. The error is nil if the authority is not degraded.
+func (h *dbHealth) status() (time.Time, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.since, h.err
+}
+
+// check returns an error if the authority is in degraded mode and the last
+// failure was too recent to attempt a new write.
+func (h *dbHealth) check() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.err != nil && time.Now().Before(h.retryAt) {
+		return errs.New(http.StatusServiceUnavailable,
+			"the certificate authority is running in degraded mode: the database is not writable")
+	}
+	return nil
+}
+
+// Health returns an error if the authority is running in degraded mode because
+// the database is read-only or unreachable.
+func (a *Authority) Health() error {
+	since, err := a.dbHealth.status()
+	if err != nil {
+		return errors.Wrapf(err, "database is not writable since %s", since.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// allowDegradedRenewals returns true if renewals can succeed without storing
+// the renewed certificate.
+func (a *Authority) allowDegradedRenewals() bool {
+	return a.config.DB != nil && a.config.DB.AllowDegradedRenewals
+}
@@ -0,0 +1,105 @@
+package authority
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func Test_dbHealth(t *testing.T) {
+	var h dbHealth
+	assert.NoError(t, h.check())
+	since, err := h.status()
+	assert.NoError(t, err)
+	assert.True(t, since.IsZero())
+
+	h.failure(errors.New("read-only"))
+	err = h.check()
+	var sc render.StatusCodedError
+	if assert.ErrorAs(t, err, &sc) {
+		assert.Equal(t, http.StatusServiceUnavailable, sc.StatusCode())
+	}
+	since, err = h.status()
+	assert.EqualError(t, err, "read-only")
+	assert.False(t, since.IsZero())
+
+	// After the retry interval a new write can be attempted.
+	h.retryAt = time.Now().Add(-time.Second)
+	assert.NoError(t, h.check())
+
+	// A new failure keeps the original time.
+	h.failure(errors.New("unreachable"))
+	since2, err := h.status()
+	assert.EqualError(t, err, "unreachable")
+	assert.Equal(t, since, since2)
+
+	h.success()
+	assert.NoError(t, h.check())
+	_, err = h.status()
+	assert.NoError(t, err)
+}
+
+func TestAuthority_degradedMode(t *testing.T) {
+	a := testAuthority(t)
+	assert.NoError(t, a.Health())
+
+	now := time.Now().UTC()
+	cert := generateCertificate(t, "renew", []string{"test.smallstep.com"},
+		withNotBeforeNotAfter(now.Add(-time.Minute), now.Add(time.Hour)),
+		withProvisionerOID("Max", a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK).Key.KeyID),
+		withSigner(getDefaultIssuer(a), getDefaultSigner(a)))
+
+	storeErr := errors.New("database is read-only")
+	a.db = &db.MockAuthDB{
+		MIsRevoked: func(string) (bool, error) {
+			return false, nil
+		},
+		MStoreCertificate: func(crt *x509.Certificate) error {
+			return storeErr
+		},
+	}
+
+	t.Run("fail renew", func(t *testing.T) {
+		_, err := a.Renew(cert)
+		assert.Error(t, err)
+		assert.ErrorContains(t, a.Health(), "database is read-only")
+	})
+
+	t.Run("fail sign fast", func(t *testing.T) {
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		_, err = a.Sign(getCSR(t, priv), provisioner.SignOptions{})
+		var sc render.StatusCodedError
+		if assert.ErrorAs(t, err, &sc) {
+			assert.Equal(t, http.StatusServiceUnavailable, sc.StatusCode())
+		}
+	})
+
+	t.Run("ok renew degraded", func(t *testing.T) {
+		a.config.DB = &db.Config{AllowDegradedRenewals: true}
+		t.Cleanup(func() { a.config.DB = nil })
+		chain, err := a.Renew(cert)
+		assert.NoError(t, err)
+		assert.Len(t, chain, 2)
+		assert.Error(t, a.Health())
+	})
+
+	t.Run("ok recovered", func(t *testing.T) {
+		storeErr = nil
+		_, err := a.Renew(cert)
+		assert.NoError(t, err)
+		assert.NoError(t, a.Health())
+	})
+}
@@ -0,0 +1,408 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+)
+
+// Status of the certificates in the inventory.
+const (
+	CertificateStatusActive  = "active"
+	CertificateStatusExpired = "expired"
+	CertificateStatusRenewed = "renewed"
+	CertificateStatusRevoked = "revoked"
+)
+
+// defaultNotificationTimeout is the default timeout of the requests to the
+// notification webhooks.
+const defaultNotificationTimeout = 10 * time.Second
+
+const (
+	// DefaultCertificatesLimit is the default limit for listing certificates.
+	DefaultCertificatesLimit = 100
+	// DefaultCertificatesMax is the maximum limit for listing certificates.
+	DefaultCertificatesMax = 1000
+)
+
+// sendMail is the function used to send the notification emails.
+var sendMail = smtp.SendMail
+
+// CertificateQuery is the filter used to find certificates in the inventory.
+// Empty fields match all the certificates.
+type CertificateQuery struct {
+	// SAN matches the common name or any of the subject alternative names,
+	// ignoring case.
+	SAN string
+	// SerialNumber matches the decimal serial number.
+	SerialNumber string
+	// Provisioner matches the name or the id of the provisioner.
+	Provisioner string
+	// ExpiresAfter and ExpiresBefore define the window where the certificate
+	// expires.
+	ExpiresAfter  time.Time
+	ExpiresBefore time.Time
+	// Status is one of active, expired, renewed or revoked.
+	Status string
+	// Cursor is the position of the first certificate returned, as returned
+	// by a previous query, and Limit is the maximum number of certificates
+	// returned. All the certificates are returned if Limit is 0.
+	Cursor string
+	Limit  int
+}
+
+// CertificateInfo is the information about a certificate in the inventory.
+type CertificateInfo struct {
+	SerialNumber string              `json:"serialNumber"`
+	Subject      string              `json:"subject"`
+	SANs         []string            `json:"sans,omitempty"`
+	NotBefore    time.Time           `json:"notBefore"`
+	NotAfter     time.Time           `json:"notAfter"`
+	Provisioner  *db.ProvisionerData `json:"provisioner,omitempty"`
+	Status       string              `json:"status"`
+	RenewedBy    string              `json:"renewedBy,omitempty"`
+	RevokedAt    *time.Time          `json:"revokedAt,omitempty"`
+}
+
+func newCertificateInfo(e *db.CertificateEntry, now time.Time) *CertificateInfo {
+	crt := e.Certificate
+	info := &CertificateInfo{
+		SerialNumber: crt.SerialNumber.String(),
+		Subject:      crt.Subject.CommonName,
+		SANs:         certificateSANs(crt),
+		NotBefore:    crt.NotBefore,
+		NotAfter:     crt.NotAfter,
+		RenewedBy:    e.RenewedBy,
+	}
+	if e.Data != nil {
+		if e.Data.RaInfo != nil {
+			info.Provisioner = &db.ProvisionerData{
+				ID:   e.Data.RaInfo.ProvisionerID,
+				Name: e.Data.RaInfo.ProvisionerName,
+				Type: e.Data.RaInfo.ProvisionerType,
+			}
+		} else {
+			info.Provisioner = e.Data.Provisioner
+		}
+	}
+	switch {
+	case e.Revocation != nil:
+		info.Status = CertificateStatusRevoked
+		revokedAt := e.Revocation.RevokedAt
+		info.RevokedAt = &revokedAt
+	case !now.Before(crt.NotAfter):
+		info.Status = CertificateStatusExpired
+	case e.RenewedBy != "":
+		info.Status = CertificateStatusRenewed
+	default:
+		info.Status = CertificateStatusActive
+	}
+	return info
+}
+
+func (q *CertificateQuery) matches(info *CertificateInfo) bool {
+	if q.SerialNumber != "" && q.SerialNumber != info.SerialNumber {
+		return false
+	}
+	if q.Status != "" && q.Status != info.Status {
+		return false
+	}
+	if !q.ExpiresAfter.IsZero() && info.NotAfter.Before(q.ExpiresAfter) {
+		return false
+	}
+	if !q.ExpiresBefore.IsZero() && info.NotAfter.After(q.ExpiresBefore) {
+		return false
+	}
+	if q.Provisioner != "" {
+		if info.Provisioner == nil || (q.Provisioner != info.Provisioner.Name && q.Provisioner != info.Provisioner.ID) {
+			return false
+		}
+	}
+	if q.SAN != "" && !strings.EqualFold(q.SAN, info.Subject) {
+		var found bool
+		for _, san := range info.SANs {
+			if strings.EqualFold(q.SAN, san) {
+				found = true
+				break
+			}
+		}
+		return found
+	}
+	return true
+}
+
+// QueryCertificates returns the X.509 certificates in the database that match
+// the given query, sorted by expiration, and the cursor of the next page of
+// certificates, if any.
+func (a *Authority) QueryCertificates(q *CertificateQuery) ([]*CertificateInfo, string, error) {
+	return a.queryCertificates(q, time.Now())
+}
+
+func (a *Authority) queryCertificates(q *CertificateQuery, now time.Time) ([]*CertificateInfo, string, error) {
+	idb, ok := a.db.(db.CertificateInventoryDB)
+	if !ok {
+		return nil, "", admin.NewError(admin.ErrorNotImplementedType, "the database does not support the certificate inventory")
+	}
+
+	var entries []*db.CertificateEntry
+	if q != nil && q.SerialNumber != "" {
+		e, err := idb.GetCertificateEntry(q.SerialNumber)
+		switch {
+		case database.IsErrNotFound(err):
+		case err != nil:
+			return nil, "", admin.WrapErrorISE(err, "error loading certificate")
+		default:
+			entries = []*db.CertificateEntry{e}
+		}
+	} else {
+		var err error
+		if entries, err = idb.GetCertificates(); err != nil {
+			return nil, "", admin.WrapErrorISE(err, "error loading certificates")
+		}
+	}
+
+	certs := []*CertificateInfo{}
+	for _, e := range entries {
+		if info := newCertificateInfo(e, now); q == nil || q.matches(info) {
+			certs = append(certs, info)
+		}
+	}
+	sort.SliceStable(certs, func(i, j int) bool {
+		return certificateCursor(certs[i]) < certificateCursor(certs[j])
+	})
+	if q == nil || q.Limit <= 0 {
+		return certs, "", nil
+	}
+
+	i := sort.Search(len(certs), func(i int) bool {
+		return certificateCursor(certs[i]) >= q.Cursor
+	})
+	if n := i + q.Limit; n < len(certs) {
+		return certs[i:n], certificateCursor(certs[n]), nil
+	}
+	return certs[i:], "", nil
+}
+
+// certificateCursor returns the position of the certificate in the query
+// results, sorted by expiration and serial number.
+func certificateCursor(c *CertificateInfo) string {
+	return fmt.Sprintf("%020d-%050s", c.NotAfter.Unix(), c.SerialNumber)
+}
+
+// ExpiryNotification is the body of the expiry notifications posted to the
+// webhooks.
+type ExpiryNotification struct {
+	Certificates []*CertificateInfo `json:"certificates"`
+}
+
+// expiryNotifier periodically sends a notification with the certificates that
+// are about to expire and have not been renewed or revoked. Every certificate
+// is notified once.
+type expiryNotifier struct {
+	window   time.Duration
+	webhooks []config.NotificationWebhookConfig
+	email    *config.NotificationEmailConfig
+	client   *http.Client
+	ticker   *time.Ticker
+	stopper  chan struct{}
+	mu       sync.Mutex
+	notified map[string]time.Time
+}
+
+func (a *Authority) startExpiryNotifier() error {
+	if !a.config.Notifications.ExpiryEnabled() {
+		return nil
+	}
+	if _, ok := a.db.(db.CertificateInventoryDB); !ok {
+		return errors.New("expiry notifications requested, but the database does not support the certificate inventory")
+	}
+
+	cfg := a.config.Notifications.Expiry
+	n := &expiryNotifier{
+		window:   cfg.WindowDuration(),
+		webhooks: cfg.Webhooks,
+		email:    cfg.Email,
+		client:   http.DefaultClient,
+		ticker:   time.NewTicker(cfg.IntervalDuration()),
+		stopper:  make(chan struct{}, 1),
+		notified: make(map[string]time.Time),
+	}
+	a.expiryNotifier = n
+
+	go func() {
+		for {
+			select {
+			case <-n.ticker.C:
+				if err := a.notifyExpiringCertificates(n, time.Now()); err != nil {
+					log.Printf("error sending expiry notifications: %v", err)
+				}
+			case <-n.stopper:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (a *Authority) stopExpiryNotifier() {
+	if n := a.expiryNotifier; n != nil {
+		n.ticker.Stop()
+		close(n.stopper)
+		a.expiryNotifier = nil
+	}
+}
+
+// notifyExpiringCertificates sends the notification with the active
+// certificates expiring in the notification window that have not been
+// notified before. If a notification cannot be sent, the certificates will be
+// included in the next one.
+func (a *Authority) notifyExpiringCertificates(n *expiryNotifier, now time.Time) error {
+	certs, _, err := a.queryCertificates(&CertificateQuery{
+		Status:        CertificateStatusActive,
+		ExpiresBefore: now.Add(n.window),
+	}, now)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// Forget the certificates that have already expired.
+	for sn, notAfter := range n.notified {
+		if !now.Before(notAfter) {
+			delete(n.notified, sn)
+		}
+	}
+
+	pending := make([]*CertificateInfo, 0, len(certs))
+	for _, c := range certs {
+		if _, ok := n.notified[c.SerialNumber]; !ok {
+			pending = append(pending, c)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := n.send(pending); err != nil {
+		return err
+	}
+	for _, c := range pending {
+		n.notified[c.SerialNumber] = c.NotAfter
+	}
+	return nil
+}
+
+func (n *expiryNotifier) send(certs []*CertificateInfo) error {
+	body, err := json.Marshal(&ExpiryNotification{Certificates: certs})
+	if err != nil {
+		return fmt.Errorf("error marshaling expiry notification: %w", err)
+	}
+
+	var errs []error
+	for i := range n.webhooks {
+		if err := n.postWebhook(&n.webhooks[i], body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if n.email != nil {
+		if err := n.sendEmail(certs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *expiryNotifier) postWebhook(w *config.NotificationWebhookConfig, body []byte) error {
+	timeout := defaultNotificationTimeout
+	if w.Timeout != nil && w.Timeout.Duration > 0 {
+		timeout = w.Timeout.Duration
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request to %s: %w", w.URL, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.BearerToken)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting expiry notification to %s: %w", w.URL, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("expiry notification webhook %s responded with %d", w.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (n *expiryNotifier) sendEmail(certs []*CertificateInfo) error {
+	m := n.email
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := strings.Cut(m.Address, ":")
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %d certificate(s) about to expire\r\n", len(certs))
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString("The following certificates are about to expire and have not been renewed:\r\n\r\n")
+	for _, c := range certs {
+		fmt.Fprintf(&buf, "Serial number: %s\r\n", c.SerialNumber)
+		fmt.Fprintf(&buf, "Subject: %s\r\n", c.Subject)
+		if len(c.SANs) > 0 {
+			fmt.Fprintf(&buf, "SANs: %s\r\n", strings.Join(c.SANs, ", "))
+		}
+		if c.Provisioner != nil {
+			fmt.Fprintf(&buf, "Provisioner: %s (%s)\r\n", c.Provisioner.Name, c.Provisioner.Type)
+		}
+		fmt.Fprintf(&buf, "Expires: %s\r\n\r\n", c.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	if err := sendMail(m.Address, auth, m.From, m.To, buf.Bytes()); err != nil {
+		return fmt.Errorf("error sending expiry notification email using %s: %w", m.Address, err)
+	}
+	return nil
+}
+
+// certificateSANs returns the subject alternative names of the certificate as
+// strings.
+func certificateSANs(crt *x509.Certificate) []string {
+	sans := make([]string, 0, len(crt.DNSNames)+len(crt.IPAddresses)+len(crt.EmailAddresses)+len(crt.URIs))
+	sans = append(sans, crt.DNSNames...)
+	for _, ip := range crt.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, crt.EmailAddresses...)
+	for _, u := range crt.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
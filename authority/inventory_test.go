@@ -0,0 +1,231 @@
+package authority
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func testInventory(now time.Time) []*db.CertificateEntry {
+	newCert := func(sn int64, cn string, notAfter time.Time) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(sn),
+			Subject:      pkix.Name{CommonName: cn},
+			DNSNames:     []string{cn},
+			NotBefore:    notAfter.Add(-30 * 24 * time.Hour),
+			NotAfter:     notAfter,
+		}
+	}
+	acme := &db.CertificateData{Provisioner: &db.ProvisionerData{ID: "acme-id", Name: "acme", Type: "ACME"}}
+	scep := &db.CertificateData{Provisioner: &db.ProvisionerData{ID: "scep-id", Name: "scep", Type: "SCEP"}}
+	return []*db.CertificateEntry{
+		{Certificate: newCert(1, "active.example.com", now.Add(48*time.Hour)), Data: scep},
+		{Certificate: newCert(2, "renewed.example.com", now.Add(24*time.Hour)), Data: acme, RenewedBy: "5"},
+		{Certificate: newCert(3, "revoked.example.com", now.Add(24*time.Hour)), Data: acme, Revocation: &db.RevokedCertificateInfo{Serial: "3", RevokedAt: now}},
+		{Certificate: newCert(4, "expired.example.com", now.Add(-time.Hour)), Data: acme},
+		{Certificate: newCert(5, "renewed.example.com", now.Add(30*24*time.Hour)), Data: acme},
+		{Certificate: newCert(6, "ra.example.com", now.Add(72*time.Hour)), Data: &db.CertificateData{
+			Provisioner: &db.ProvisionerData{ID: "ra-id", Name: "ra", Type: "JWK"},
+			RaInfo:      &provisioner.RAInfo{ProvisionerID: "scep-id", ProvisionerName: "scep", ProvisionerType: "SCEP"},
+		}},
+	}
+}
+
+func serialNumbers(certs []*CertificateInfo) []string {
+	sns := make([]string, len(certs))
+	for i, c := range certs {
+		sns[i] = c.SerialNumber
+	}
+	return sns
+}
+
+func TestAuthority_queryCertificates(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	a := testAuthority(t)
+	a.db = &db.MockAuthDB{
+		MGetCertificates: func() ([]*db.CertificateEntry, error) {
+			return testInventory(now), nil
+		},
+		MGetCertificateEntry: func(serialNumber string) (*db.CertificateEntry, error) {
+			for _, e := range testInventory(now) {
+				if e.Certificate.SerialNumber.String() == serialNumber {
+					return e, nil
+				}
+			}
+			return nil, database.ErrNotFound
+		},
+	}
+
+	tests := []struct {
+		name  string
+		query *CertificateQuery
+		want  []string
+	}{
+		{"all", nil, []string{"4", "2", "3", "1", "6", "5"}},
+		{"san", &CertificateQuery{SAN: "RENEWED.example.com"}, []string{"2", "5"}},
+		{"serial", &CertificateQuery{SerialNumber: "3"}, []string{"3"}},
+		{"serial not found", &CertificateQuery{SerialNumber: "7"}, []string{}},
+		{"serial and status", &CertificateQuery{SerialNumber: "3", Status: CertificateStatusActive}, []string{}},
+		{"provisioner name", &CertificateQuery{Provisioner: "scep"}, []string{"1", "6"}},
+		{"provisioner id", &CertificateQuery{Provisioner: "acme-id"}, []string{"4", "2", "3", "5"}},
+		{"active", &CertificateQuery{Status: CertificateStatusActive}, []string{"1", "6", "5"}},
+		{"renewed", &CertificateQuery{Status: CertificateStatusRenewed}, []string{"2"}},
+		{"revoked", &CertificateQuery{Status: CertificateStatusRevoked}, []string{"3"}},
+		{"expired", &CertificateQuery{Status: CertificateStatusExpired}, []string{"4"}},
+		{"window", &CertificateQuery{ExpiresAfter: now, ExpiresBefore: now.Add(48 * time.Hour)}, []string{"2", "3", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := a.queryCertificates(tt.query, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, serialNumbers(got))
+			assert.Empty(t, next)
+		})
+	}
+
+	// Pagination.
+	var pages [][]string
+	q := &CertificateQuery{Limit: 4}
+	for {
+		got, next, err := a.queryCertificates(q, now)
+		require.NoError(t, err)
+		pages = append(pages, serialNumbers(got))
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+	assert.Equal(t, [][]string{{"4", "2", "3", "1"}, {"6", "5"}}, pages)
+
+	certs, _, err := a.QueryCertificates(&CertificateQuery{SerialNumber: "3"})
+	require.NoError(t, err)
+	require.Len(t, certs, 1)
+	assert.Equal(t, &CertificateInfo{
+		SerialNumber: "3",
+		Subject:      "revoked.example.com",
+		SANs:         []string{"revoked.example.com"},
+		NotBefore:    now.Add(-29 * 24 * time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+		Provisioner:  &db.ProvisionerData{ID: "acme-id", Name: "acme", Type: "ACME"},
+		Status:       CertificateStatusRevoked,
+		RevokedAt:    &now,
+	}, certs[0])
+
+	a.db = &db.MockAuthDB{Err: errors.New("force")}
+	_, _, err = a.QueryCertificates(nil)
+	assert.EqualError(t, err, "error loading certificates: force")
+	_, _, err = a.QueryCertificates(&CertificateQuery{SerialNumber: "3"})
+	assert.EqualError(t, err, "error loading certificate: force")
+}
+
+func TestAuthority_notifyExpiringCertificates(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	var (
+		bodies [][]byte
+		status = http.StatusOK
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		bodies = append(bodies, b)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	var emails []string
+	tmp := sendMail
+	t.Cleanup(func() { sendMail = tmp })
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		assert.Equal(t, "smtp.example.com:587", addr)
+		assert.NotNil(t, a)
+		assert.Equal(t, "ca@example.com", from)
+		assert.Equal(t, []string{"ops@example.com"}, to)
+		emails = append(emails, string(msg))
+		return nil
+	}
+
+	a := testAuthority(t)
+	a.db = &db.MockAuthDB{
+		MGetCertificates: func() ([]*db.CertificateEntry, error) {
+			return testInventory(now), nil
+		},
+	}
+	a.config.Notifications = &config.NotificationsConfig{
+		Expiry: &config.ExpiryNotificationsConfig{
+			Window:   &provisioner.Duration{Duration: 72 * time.Hour},
+			Webhooks: []config.NotificationWebhookConfig{{URL: srv.URL, BearerToken: "token"}},
+			Email: &config.NotificationEmailConfig{
+				Address:  "smtp.example.com:587",
+				Username: "ca",
+				Password: "pass",
+				From:     "ca@example.com",
+				To:       []string{"ops@example.com"},
+			},
+		},
+	}
+	require.NoError(t, a.startExpiryNotifier())
+	t.Cleanup(a.stopExpiryNotifier)
+	n := a.expiryNotifier
+	require.NotNil(t, n)
+
+	// Active certificates in the window are notified.
+	require.NoError(t, a.notifyExpiringCertificates(n, now))
+	require.Len(t, bodies, 1)
+	var msg ExpiryNotification
+	require.NoError(t, json.Unmarshal(bodies[0], &msg))
+	assert.Equal(t, []string{"1", "6"}, serialNumbers(msg.Certificates))
+	require.Len(t, emails, 1)
+	assert.Contains(t, emails[0], "Subject: 2 certificate(s) about to expire\r\n")
+	assert.Contains(t, emails[0], "Serial number: 6\r\n")
+	assert.Contains(t, emails[0], "Provisioner: scep (SCEP)\r\n")
+
+	// Certificates are notified once.
+	require.NoError(t, a.notifyExpiringCertificates(n, now.Add(time.Hour)))
+	assert.Len(t, bodies, 1)
+
+	// Failed notifications are retried.
+	status = http.StatusInternalServerError
+	err := a.notifyExpiringCertificates(n, now.Add(28*24*time.Hour))
+	assert.ErrorContains(t, err, "responded with 500")
+	status = http.StatusOK
+	require.NoError(t, a.notifyExpiringCertificates(n, now.Add(28*24*time.Hour)))
+	require.Len(t, bodies, 3)
+	require.NoError(t, json.Unmarshal(bodies[2], &msg))
+	assert.Equal(t, []string{"5"}, serialNumbers(msg.Certificates))
+
+	// Expired certificates are forgotten.
+	assert.NotContains(t, n.notified, "1")
+	assert.Contains(t, n.notified, "5")
+}
+
+func TestAuthority_startExpiryNotifier(t *testing.T) {
+	a := testAuthority(t)
+	require.NoError(t, a.startExpiryNotifier())
+	assert.Nil(t, a.expiryNotifier)
+
+	a.config.Notifications = &config.NotificationsConfig{
+		Expiry: &config.ExpiryNotificationsConfig{
+			Webhooks: []config.NotificationWebhookConfig{{URL: "https://example.com"}},
+		},
+	}
+	a.db = nil
+	assert.EqualError(t, a.startExpiryNotifier(), "expiry notifications requested, but the database does not support the certificate inventory")
+}
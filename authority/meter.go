@@ -0,0 +1,48 @@
+package authority
+
+import (
+	"errors"
+	"time"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/internal/metrix"
+)
+
+// GetMeter returns the meter used to collect the metrics, or nil if the
+// metrics are not enabled.
+func (a *Authority) GetMeter() *metrix.Meter {
+	return a.meter
+}
+
+// observeDB records the latency of a database operation started at the given
+// time. Operations not implemented by the database are ignored.
+func (a *Authority) observeDB(operation string, start time.Time, err error) {
+	if a.meter == nil || errors.Is(err, db.ErrNotImplemented) {
+		return
+	}
+	a.meter.DBOperation(operation, time.Since(start), err)
+}
+
+// signOptionsProvisioner returns the provisioner in the given sign options, or
+// nil if there is none.
+func signOptionsProvisioner(opts []provisioner.SignOption) provisioner.Interface {
+	for _, op := range opts {
+		if p, ok := op.(provisioner.Interface); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// provisionerName returns the name of the given provisioner, or an empty
+// string if it is nil.
+func provisionerName(p provisioner.Interface) string {
+	if p == nil {
+		return ""
+	}
+	if wp, ok := p.(*wrappedProvisioner); ok && wp.Interface == nil {
+		return ""
+	}
+	return p.GetName()
+}
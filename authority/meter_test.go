@@ -0,0 +1,54 @@
+package authority
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/internal/metrix"
+)
+
+func TestAuthority_observeDB(t *testing.T) {
+	m := metrix.New()
+	a := testAuthority(t, WithMeter(m))
+	assert.Equal(t, m, a.GetMeter())
+
+	start := time.Now()
+	a.observeDB("store_certificate", start, nil)
+	a.observeDB("store_certificate", start, errors.New("force"))
+	a.observeDB("revoke", start, db.ErrNotImplemented)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	out := rec.Body.String()
+	assert.Contains(t, out, `step_ca_db_operation_duration_seconds_count{operation="store_certificate"} 2`)
+	assert.Contains(t, out, `step_ca_db_operation_errors_total{operation="store_certificate"} 1`)
+	assert.False(t, strings.Contains(out, `operation="revoke"`))
+
+	// Intermediates are exported on init.
+	assert.Contains(t, out, "step_ca_intermediate_certificate_expiry_timestamp_seconds{")
+
+	// Without a meter nothing is recorded.
+	a.meter = nil
+	assert.NotPanics(t, func() { a.observeDB("revoke", start, nil) })
+}
+
+func Test_provisionerName(t *testing.T) {
+	prov := &provisioner.JWK{Name: "jwk", Type: "JWK"}
+	assert.Equal(t, "jwk", provisionerName(prov))
+	assert.Equal(t, "jwk", provisionerName(wrapProvisioner(prov, nil)))
+	assert.Empty(t, provisionerName(wrapProvisioner(nil, nil)))
+	assert.Empty(t, provisionerName(nil))
+
+	assert.Equal(t, prov, signOptionsProvisioner([]provisioner.SignOption{
+		provisioner.CertificateEnforcerFunc(nil), prov,
+	}))
+	assert.Nil(t, signOptionsProvisioner(nil))
+}
@@ -0,0 +1,81 @@
+package authority
+
+import (
+	"errors"
+	"fmt"
+
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/ocsp"
+	"github.com/smallstep/nosql/database"
+)
+
+// GetOCSP returns the OCSP responder, or nil if it is not enabled.
+func (a *Authority) GetOCSP() *ocsp.Responder {
+	return a.ocspResponder
+}
+
+// GetCertificateStatus returns the revocation status of the certificate with
+// the given serial number. The status is unknown if the certificate was not
+// issued by the authority or the database does not store certificates.
+func (a *Authority) GetCertificateStatus(serialNumber string) (*ocsp.CertificateStatus, error) {
+	if rdb, ok := a.db.(db.RevokedCertificateDB); ok {
+		rci, err := rdb.GetRevokedCertificate(serialNumber)
+		switch {
+		case err == nil:
+			return &ocsp.CertificateStatus{
+				Status:           ocsp.Revoked,
+				RevokedAt:        rci.RevokedAt,
+				RevocationReason: rci.ReasonCode,
+			}, nil
+		case !database.IsErrNotFound(err) && !errors.Is(err, db.ErrNotImplemented):
+			return nil, err
+		}
+	}
+
+	if _, err := a.db.GetCertificate(serialNumber); err != nil {
+		if database.IsErrNotFound(err) || errors.Is(err, db.ErrNotImplemented) {
+			return &ocsp.CertificateStatus{Status: ocsp.Unknown}, nil
+		}
+		return nil, err
+	}
+	return &ocsp.CertificateStatus{Status: ocsp.Good}, nil
+}
+
+// initOCSP creates the OCSP responder using the responder certificate and key
+// in the configuration.
+func (a *Authority) initOCSP() error {
+	// Revocations in a linked CA are not stored in the local database.
+	if _, ok := a.adminDB.(*linkedCaClient); ok {
+		return errors.New("the OCSP responder is not supported with a linked CA")
+	}
+	if len(a.intermediateX509Certs) == 0 {
+		return errors.New("the OCSP responder requires an intermediate certificate")
+	}
+
+	cfg := a.config.OCSP
+	cert, err := pemutil.ReadCertificate(cfg.Certificate)
+	if err != nil {
+		return fmt.Errorf("error reading OCSP responder certificate: %w", err)
+	}
+	signer, err := a.keyManager.CreateSigner(&kmsapi.CreateSignerRequest{
+		SigningKey: cfg.Key,
+		Password:   a.password,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating OCSP responder signer: %w", err)
+	}
+
+	opts := ocsp.Options{
+		Issuer:        a.intermediateX509Certs[0],
+		ResponderCert: cert,
+		Signer:        signer,
+	}
+	if cfg.CacheDuration != nil {
+		opts.Validity = cfg.CacheDuration.Duration
+	}
+	a.ocspResponder, err = ocsp.New(a, opts)
+	return err
+}
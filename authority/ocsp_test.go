@@ -0,0 +1,121 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/ocsp"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestAuthority_GetCertificateStatus(t *testing.T) {
+	revokedAt := time.Now().Add(-time.Hour).UTC()
+	a := testAuthority(t)
+	a.db = &db.MockAuthDB{
+		MGetRevokedCertificate: func(sn string) (*db.RevokedCertificateInfo, error) {
+			switch sn {
+			case "revoked":
+				return &db.RevokedCertificateInfo{Serial: sn, ReasonCode: 1, RevokedAt: revokedAt}, nil
+			case "fail-revoked":
+				return nil, errors.New("force")
+			default:
+				return nil, database.ErrNotFound
+			}
+		},
+		MGetCertificate: func(sn string) (*x509.Certificate, error) {
+			switch sn {
+			case "good":
+				return &x509.Certificate{}, nil
+			case "fail-certificate":
+				return nil, errors.New("force")
+			default:
+				return nil, database.ErrNotFound
+			}
+		},
+	}
+
+	tests := []struct {
+		name    string
+		sn      string
+		want    *ocsp.CertificateStatus
+		wantErr bool
+	}{
+		{"good", "good", &ocsp.CertificateStatus{Status: ocsp.Good}, false},
+		{"revoked", "revoked", &ocsp.CertificateStatus{Status: ocsp.Revoked, RevokedAt: revokedAt, RevocationReason: 1}, false},
+		{"unknown", "unknown", &ocsp.CertificateStatus{Status: ocsp.Unknown}, false},
+		{"fail revoked", "fail-revoked", nil, true},
+		{"fail certificate", "fail-certificate", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.GetCertificateStatus(tt.sn)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// Without persistence the status of every certificate is unknown.
+	a.db = &db.SimpleDB{}
+	got, err := a.GetCertificateStatus("good")
+	require.NoError(t, err)
+	assert.Equal(t, &ocsp.CertificateStatus{Status: ocsp.Unknown}, got)
+}
+
+func TestAuthority_initOCSP(t *testing.T) {
+	a := testAuthority(t)
+	issuerKey, err := pemutil.Read("testdata/secrets/intermediate_ca_key", pemutil.WithPassword([]byte("pass")))
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificate(nil, &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: "OCSP Responder"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}, a.intermediateX509Certs[0], signer.Public(), issuerKey.(crypto.Signer))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "ocsp.crt")
+	keyFile := filepath.Join(dir, "ocsp.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	_, err = pemutil.Serialize(signer, pemutil.ToFile(keyFile, 0600))
+	require.NoError(t, err)
+
+	a.config.OCSP = &config.OCSPConfig{Enabled: true, Certificate: certFile, Key: keyFile}
+	require.NoError(t, a.initOCSP())
+	assert.NotNil(t, a.GetOCSP())
+
+	a.config.OCSP.Certificate = filepath.Join(dir, "missing.crt")
+	assert.ErrorContains(t, a.initOCSP(), "error reading OCSP responder certificate")
+
+	a.config.OCSP.Certificate = certFile
+	a.config.OCSP.Key = filepath.Join(dir, "missing.key")
+	assert.ErrorContains(t, a.initOCSP(), "error creating OCSP responder signer")
+
+	// The responder certificate must be issued by the intermediate.
+	a.config.OCSP.Certificate = "testdata/certs/intermediate_ca.crt"
+	a.config.OCSP.Key = "testdata/secrets/intermediate_ca_key"
+	assert.ErrorContains(t, a.initOCSP(), "ocsp: responder certificate is not issued by the CA")
+}
@@ -12,12 +12,14 @@ import (
 
 	"go.step.sm/crypto/kms"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/admin"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/cas"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/internal/metrix"
 	"github.com/smallstep/certificates/scep"
 )
 
@@ -87,6 +89,23 @@ func WithDatabase(d db.AuthDB) Option {
 	}
 }
 
+// WithAuditLogger sets the audit logger used by the authority. If set, the
+// audit configuration in ca.json is ignored.
+func WithAuditLogger(l *audit.Logger) Option {
+	return func(a *Authority) error {
+		a.auditLogger = l
+		return nil
+	}
+}
+
+// WithMeter sets the meter used to collect the metrics of the authority.
+func WithMeter(m *metrix.Meter) Option {
+	return func(a *Authority) error {
+		a.meter = m
+		return nil
+	}
+}
+
 // WithQuietInit disables log output when the authority is initialized.
 func WithQuietInit() Option {
 	return func(a *Authority) error {
@@ -54,6 +54,7 @@ type X509NameOptions struct {
 	IPRanges       []string `json:"ip,omitempty"`
 	EmailAddresses []string `json:"email,omitempty"`
 	URIDomains     []string `json:"uri,omitempty"`
+	URISchemes     []string `json:"uriSchemes,omitempty"`
 }
 
 // HasNames checks if the AllowedNameOptions has one or more
@@ -63,7 +64,8 @@ func (o *X509NameOptions) HasNames() bool {
 		len(o.DNSDomains) > 0 ||
 		len(o.IPRanges) > 0 ||
 		len(o.EmailAddresses) > 0 ||
-		len(o.URIDomains) > 0
+		len(o.URIDomains) > 0 ||
+		len(o.URISchemes) > 0
 }
 
 // GetAllowedNameOptions returns x509 allowed name policy configuration
@@ -34,6 +34,7 @@ func NewX509PolicyEngine(policyOptions X509PolicyOptionsInterface) (X509Policy,
 			policy.WithPermittedIPsOrCIDRs(allowed.IPRanges...),
 			policy.WithPermittedEmailAddresses(allowed.EmailAddresses...),
 			policy.WithPermittedURIDomains(allowed.URIDomains...),
+			policy.WithPermittedURISchemes(allowed.URISchemes...),
 		)
 	}
 
@@ -45,6 +46,7 @@ func NewX509PolicyEngine(policyOptions X509PolicyOptionsInterface) (X509Policy,
 			policy.WithExcludedIPsOrCIDRs(denied.IPRanges...),
 			policy.WithExcludedEmailAddresses(denied.EmailAddresses...),
 			policy.WithExcludedURIDomains(denied.URIDomains...),
+			policy.WithExcludedURISchemes(denied.URISchemes...),
 		)
 	}
 
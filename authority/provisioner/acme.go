@@ -11,6 +11,9 @@ import (
 
 	"github.com/pkg/errors"
 	"go.step.sm/linkedca"
+
+	"github.com/smallstep/certificates/mdm"
+	"github.com/smallstep/certificates/webhook"
 )
 
 // ACMEChallenge represents the supported acme challenges.
@@ -59,6 +62,12 @@ const (
 
 	// TPM is the format used to enable device-attest-01 with TPMs.
 	TPM ACMEAttestationFormat = "tpm"
+
+	// ANDROID_KEY is the format used to enable device-attest-01 on Android
+	// devices using hardware key attestation. This format is not enabled by
+	// default, and it requires the Google hardware attestation roots to be
+	// configured in the androidKeyAttestationRoots property.
+	ANDROID_KEY ACMEAttestationFormat = "android-key" //nolint:stylecheck,revive // better names
 )
 
 // String returns a normalized version of the attestation format.
@@ -69,13 +78,258 @@ func (f ACMEAttestationFormat) String() string {
 // Validate returns an error if the attestation format is not a valid one.
 func (f ACMEAttestationFormat) Validate() error {
 	switch ACMEAttestationFormat(f.String()) {
-	case APPLE, STEP, TPM:
+	case APPLE, STEP, TPM, ANDROID_KEY:
 		return nil
 	default:
 		return fmt.Errorf("acme attestation format %q is not supported", f)
 	}
 }
 
+// ACMERevocationPolicy is the policy used to check the revocation status of the
+// attestation certificates in a device-attest-01 challenge.
+type ACMERevocationPolicy string
+
+const (
+	// RevocationPolicyDisable disables the revocation checks. This is the
+	// default policy.
+	RevocationPolicyDisable ACMERevocationPolicy = "disable"
+
+	// RevocationPolicySoftFail rejects revoked certificates, but accepts
+	// certificates whose revocation status cannot be determined.
+	RevocationPolicySoftFail ACMERevocationPolicy = "soft-fail"
+
+	// RevocationPolicyRequire rejects revoked certificates and certificates
+	// whose revocation status cannot be determined.
+	RevocationPolicyRequire ACMERevocationPolicy = "require"
+)
+
+// Validate returns an error if the revocation policy is not a valid one.
+func (r ACMERevocationPolicy) Validate() error {
+	switch r {
+	case "", RevocationPolicyDisable, RevocationPolicySoftFail, RevocationPolicyRequire:
+		return nil
+	default:
+		return fmt.Errorf("acme attestation revocation policy %q is not supported", r)
+	}
+}
+
+// ACMECAAPolicy is the action taken when the CAA records of a dns identifier
+// do not authorize the issuance, or they cannot be looked up.
+type ACMECAAPolicy string
+
+const (
+	// CAAPolicyEnforce rejects the issuance. This is the default policy.
+	CAAPolicyEnforce ACMECAAPolicy = "enforce"
+
+	// CAAPolicyLog logs the failure and continues with the issuance.
+	CAAPolicyLog ACMECAAPolicy = "log"
+)
+
+// ACMECAAOptions enables the checking of the CAA records (RFC 8659) of the dns
+// identifiers before issuing a certificate. The issuer domain names of the
+// provisioner are the ones in caaIdentities.
+type ACMECAAOptions struct {
+	// Policy is the action taken when the CAA records do not authorize the
+	// issuance. Supported values are "enforce" and "log". Defaults to
+	// "enforce".
+	Policy ACMECAAPolicy `json:"policy,omitempty"`
+	// CheckChallenges enables the checking of the CAA records when the
+	// http-01, dns-01 and tls-alpn-01 challenges are validated. The records
+	// are always checked when the order is finalized.
+	CheckChallenges bool `json:"checkChallenges,omitempty"`
+}
+
+func (o *ACMECAAOptions) validate(identities []string) error {
+	if o == nil {
+		return nil
+	}
+	switch o.Policy {
+	case "", CAAPolicyEnforce, CAAPolicyLog:
+	default:
+		return errors.Errorf("caa: policy %q is not supported", o.Policy)
+	}
+	if len(identities) == 0 {
+		return errors.New("caa: caaIdentities cannot be empty")
+	}
+	return nil
+}
+
+// IsCheckChallenges returns true if the CAA records are checked when the
+// challenges are validated.
+func (o *ACMECAAOptions) IsCheckChallenges() bool {
+	return o != nil && o.CheckChallenges
+}
+
+// IsLogOnly returns true if the CAA failures are only logged.
+func (o *ACMECAAOptions) IsLogOnly() bool {
+	return o != nil && o.Policy == CAAPolicyLog
+}
+
+// ACMERateLimit limits the number of operations in a period of time.
+type ACMERateLimit struct {
+	Limit  int       `json:"limit"`
+	Period *Duration `json:"period"`
+}
+
+func (l *ACMERateLimit) validate(name string) error {
+	switch {
+	case l == nil:
+		return nil
+	case l.Limit <= 0:
+		return errors.Errorf("rateLimits: %s limit must be greater than 0", name)
+	case l.Period.Value() <= 0:
+		return errors.Errorf("rateLimits: %s period must be greater than 0", name)
+	default:
+		return nil
+	}
+}
+
+// ACMERateLimitScopes are the rate limits of an operation. The limits are
+// counted per account, per client IP, per identifier, and for all the
+// operations in the provisioner.
+type ACMERateLimitScopes struct {
+	Account     *ACMERateLimit `json:"account,omitempty"`
+	IP          *ACMERateLimit `json:"ip,omitempty"`
+	Identifier  *ACMERateLimit `json:"identifier,omitempty"`
+	Provisioner *ACMERateLimit `json:"provisioner,omitempty"`
+}
+
+func (s *ACMERateLimitScopes) validate(name string) error {
+	if s == nil {
+		return nil
+	}
+	if err := s.Account.validate(name + ".account"); err != nil {
+		return err
+	}
+	if err := s.IP.validate(name + ".ip"); err != nil {
+		return err
+	}
+	if err := s.Identifier.validate(name + ".identifier"); err != nil {
+		return err
+	}
+	return s.Provisioner.validate(name + ".provisioner")
+}
+
+// ACMERateLimits configures the rate limits of the new-order, new-account,
+// and failed challenge validation operations. When a limit is exceeded, the
+// request is rejected with a rateLimited error.
+type ACMERateLimits struct {
+	NewOrder        *ACMERateLimitScopes `json:"newOrder,omitempty"`
+	NewAccount      *ACMERateLimitScopes `json:"newAccount,omitempty"`
+	FailedChallenge *ACMERateLimitScopes `json:"failedChallenge,omitempty"`
+}
+
+func (r *ACMERateLimits) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.NewAccount != nil && (r.NewAccount.Account != nil || r.NewAccount.Identifier != nil) {
+		return errors.New("rateLimits: newAccount only supports the ip and provisioner limits")
+	}
+	if err := r.NewOrder.validate("newOrder"); err != nil {
+		return err
+	}
+	if err := r.NewAccount.validate("newAccount"); err != nil {
+		return err
+	}
+	return r.FailedChallenge.validate("failedChallenge")
+}
+
+// ACMEIdentifierOptions restricts the classes of identifiers an ACME
+// provisioner can issue certificates for. All the identifiers are allowed by
+// default.
+type ACMEIdentifierOptions struct {
+	// DisableIP rejects orders with ip identifiers.
+	DisableIP bool `json:"disableIP,omitempty"`
+	// DisableWildcard rejects orders with wildcard dns identifiers.
+	DisableWildcard bool `json:"disableWildcard,omitempty"`
+	// DisablePermanentIdentifier rejects orders with permanent-identifier
+	// identifiers.
+	DisablePermanentIdentifier bool `json:"disablePermanentIdentifier,omitempty"`
+	// AllowedIPRanges is a list of CIDRs. If set, ip identifiers must be in
+	// one of the ranges.
+	AllowedIPRanges []string `json:"allowedIPRanges,omitempty"`
+	// AllowedDomains is a list of domain suffixes. If set, dns identifiers
+	// must be one of the domains or a subdomain of them.
+	AllowedDomains []string `json:"allowedDomains,omitempty"`
+	ipNets         []*net.IPNet
+	domains        []string
+}
+
+func (o *ACMEIdentifierOptions) init() error {
+	if o == nil {
+		return nil
+	}
+	o.ipNets = make([]*net.IPNet, 0, len(o.AllowedIPRanges))
+	for _, s := range o.AllowedIPRanges {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return errors.Errorf("identifiers: allowedIPRanges %q is not a valid CIDR", s)
+		}
+		o.ipNets = append(o.ipNets, ipNet)
+	}
+	o.domains = make([]string, 0, len(o.AllowedDomains))
+	for _, s := range o.AllowedDomains {
+		domain := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "*"), ".")
+		if domain == "" {
+			return errors.Errorf("identifiers: allowedDomains %q is not a valid domain", s)
+		}
+		o.domains = append(o.domains, domain)
+	}
+	return nil
+}
+
+// authorize returns an error if the identifier is not allowed by the options.
+func (o *ACMEIdentifierOptions) authorize(identifier ACMEIdentifier) error {
+	if o == nil {
+		return nil
+	}
+	switch identifier.Type {
+	case IP:
+		if o.DisableIP {
+			return errors.New("ip identifiers are not allowed")
+		}
+		if len(o.ipNets) == 0 {
+			return nil
+		}
+		ip := net.ParseIP(identifier.Value)
+		for _, ipNet := range o.ipNets {
+			if ipNet.Contains(ip) {
+				return nil
+			}
+		}
+		return errors.Errorf("ip %q is not in the allowed ranges", identifier.Value)
+	case DNS:
+		name := strings.ToLower(identifier.Value)
+		if strings.HasPrefix(name, "*.") {
+			if o.DisableWildcard {
+				return errors.New("wildcard dns identifiers are not allowed")
+			}
+			name = name[2:]
+		}
+		if len(o.domains) == 0 {
+			return nil
+		}
+		for _, domain := range o.domains {
+			if name == domain || strings.HasSuffix(name, "."+domain) {
+				return nil
+			}
+		}
+		return errors.Errorf("dns name %q is not in the allowed domains", identifier.Value)
+	case PermanentIdentifier:
+		if o.DisablePermanentIdentifier {
+			return errors.New("permanent-identifier identifiers are not allowed")
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+// defaultChallengeRetryInterval is the time to wait before the first retry of a
+// challenge validation.
+const defaultChallengeRetryInterval = 10 * time.Second
+
 // ACME is the acme provisioner type, an entity that can authorize the ACME
 // provisioning flow.
 type ACME struct {
@@ -106,15 +360,69 @@ type ACME struct {
 	Challenges []ACMEChallenge `json:"challenges,omitempty"`
 	// AttestationFormats contains the enabled attestation formats for this
 	// provisioner. If this value is not set the default apple, step and tpm
-	// will be used.
+	// will be used. The android-key format must be explicitly enabled.
 	AttestationFormats []ACMEAttestationFormat `json:"attestationFormats,omitempty"`
 	// AttestationRoots contains a bundle of root certificates in PEM format
 	// that will be used to verify the attestation certificates. If provided,
 	// this bundle will be used even for well-known CAs like Apple and Yubico.
-	AttestationRoots    []byte   `json:"attestationRoots,omitempty"`
-	Claims              *Claims  `json:"claims,omitempty"`
-	Options             *Options `json:"options,omitempty"`
+	AttestationRoots []byte `json:"attestationRoots,omitempty"`
+	// TPMEndorsementRoots contains a bundle of TPM manufacturer root
+	// certificates in PEM format. If provided, the tpm attestation format
+	// requires the Endorsement Key certificate chain, the AK must be bound to
+	// the EK with a credential activation, and the device is identified by the
+	// permanent identifier, or the issuer and serial number, of the EK
+	// certificate.
+	TPMEndorsementRoots []byte `json:"tpmEndorsementRoots,omitempty"`
+	// AndroidKeyAttestationRoots contains a bundle of Google hardware
+	// attestation root certificates in PEM format used to verify the
+	// android-key attestation format. Unlike attestationRoots, it does not
+	// replace the default roots of the other formats. If not provided, the
+	// attestationRoots are used.
+	AndroidKeyAttestationRoots []byte `json:"androidKeyAttestationRoots,omitempty"`
+	// AttestationRevocation is the policy used to check the revocation status
+	// of the attestation certificate chains using CRLs and OCSP. Supported
+	// values are "disable", "soft-fail" and "require". Defaults to "disable".
+	AttestationRevocation ACMERevocationPolicy `json:"attestationRevocation,omitempty"`
+	// DeviceInventory configures an MDM used to verify that the devices
+	// validated with the apple attestation format are enrolled and compliant.
+	// If this value is not set, no external lookup is done.
+	DeviceInventory *mdm.Config `json:"deviceInventory,omitempty"`
+	// AuthorizationReuseDuration is the time since its validation that a valid
+	// authorization can be reused by new orders of the same account. If this
+	// value is not set or set to 0, every order requires a new validation.
+	AuthorizationReuseDuration *Duration `json:"authorizationReuseDuration,omitempty"`
+	// PreAuthorizationDuration enables the pre-authorization flow using the
+	// newAuthz resource, and it is the time since its validation that a
+	// pre-authorization can be reused by new orders of the same account. If
+	// this value is not set or set to 0, pre-authorization is disabled.
+	PreAuthorizationDuration *Duration `json:"preAuthorizationDuration,omitempty"`
+	// ChallengeRetries is the number of times the validation of a challenge
+	// that failed because of a connection or DNS error is retried in the
+	// background before the challenge is marked as invalid. If this value is
+	// not set or set to 0, challenges are validated in the request.
+	ChallengeRetries int `json:"challengeRetries,omitempty"`
+	// ChallengeRetryInterval is the time to wait before the first retry of a
+	// challenge validation, it is doubled after every retry. Defaults to 10
+	// seconds.
+	ChallengeRetryInterval *Duration `json:"challengeRetryInterval,omitempty"`
+	// Identifiers restricts the ip, wildcard and permanent-identifier
+	// identifiers allowed in new orders, and the ranges and domains they can
+	// be in. If this value is not set all the identifiers are allowed.
+	Identifiers *ACMEIdentifierOptions `json:"identifiers,omitempty"`
+	// RateLimits limits the number of new orders, new accounts, and failed
+	// challenge validations. If this value is not set, the operations are
+	// not limited.
+	RateLimits *ACMERateLimits `json:"rateLimits,omitempty"`
+	// CAA enables the checking of the CAA records of the dns identifiers
+	// before issuing a certificate. If this value is not set, the records are
+	// not checked.
+	CAA                 *ACMECAAOptions `json:"caa,omitempty"`
+	Claims              *Claims         `json:"claims,omitempty"`
+	Options             *Options        `json:"options,omitempty"`
 	attestationRootPool *x509.CertPool
+	tpmEndorsementPool  *x509.CertPool
+	androidKeyRootPool  *x509.CertPool
+	deviceInventory     mdm.Provider
 	ctl                 *Controller
 }
 
@@ -163,6 +471,41 @@ func (p *ACME) DefaultTLSCertDuration() time.Duration {
 	return p.ctl.Claimer.DefaultTLSCertDuration()
 }
 
+// GetAuthorizationReuseDuration returns the time since its validation that a
+// valid authorization can be reused by new orders. A value of 0 disables the
+// reuse of authorizations.
+func (p *ACME) GetAuthorizationReuseDuration() time.Duration {
+	return p.AuthorizationReuseDuration.Value()
+}
+
+// GetPreAuthorizationDuration returns the time since its validation that a
+// pre-authorization can be reused by new orders. A value of 0 disables the
+// pre-authorization flow.
+func (p *ACME) GetPreAuthorizationDuration() time.Duration {
+	return p.PreAuthorizationDuration.Value()
+}
+
+// GetRateLimits returns the rate limits of the provisioner, or nil if the
+// operations are not limited.
+func (p *ACME) GetRateLimits() *ACMERateLimits {
+	return p.RateLimits
+}
+
+// GetChallengeRetries returns the number of times a challenge validation is
+// retried in the background. A value of 0 disables the background validation.
+func (p *ACME) GetChallengeRetries() int {
+	return p.ChallengeRetries
+}
+
+// GetChallengeRetryInterval returns the time to wait before the first retry of
+// a challenge validation.
+func (p *ACME) GetChallengeRetryInterval() time.Duration {
+	if d := p.ChallengeRetryInterval.Value(); d > 0 {
+		return d
+	}
+	return defaultChallengeRetryInterval
+}
+
 // Init initializes and validates the fields of an ACME type.
 func (p *ACME) Init(config Config) (err error) {
 	switch {
@@ -181,28 +524,50 @@ func (p *ACME) Init(config Config) (err error) {
 		if err := f.Validate(); err != nil {
 			return err
 		}
+		if ACMEAttestationFormat(f.String()) == ANDROID_KEY && len(p.AndroidKeyAttestationRoots) == 0 && len(p.AttestationRoots) == 0 {
+			return errors.New("attestation format android-key requires androidKeyAttestationRoots")
+		}
+	}
+	if err := p.AttestationRevocation.Validate(); err != nil {
+		return err
+	}
+	if p.AuthorizationReuseDuration.Value() < 0 {
+		return errors.New("authorizationReuseDuration cannot be negative")
+	}
+	if p.PreAuthorizationDuration.Value() < 0 {
+		return errors.New("preAuthorizationDuration cannot be negative")
+	}
+	if p.ChallengeRetries < 0 {
+		return errors.New("challengeRetries cannot be negative")
+	}
+	if p.ChallengeRetryInterval.Value() < 0 {
+		return errors.New("challengeRetryInterval cannot be negative")
+	}
+	if err := p.Identifiers.init(); err != nil {
+		return err
+	}
+	if err := p.RateLimits.validate(); err != nil {
+		return err
+	}
+	if err := p.CAA.validate(p.CaaIdentities); err != nil {
+		return err
 	}
 
-	// Parse attestation roots.
-	// The pool will be nil if there are no roots.
-	if rest := p.AttestationRoots; len(rest) > 0 {
-		var block *pem.Block
-		var hasCert bool
-		p.attestationRootPool = x509.NewCertPool()
-		for rest != nil {
-			block, rest = pem.Decode(rest)
-			if block == nil {
-				break
-			}
-			cert, err := x509.ParseCertificate(block.Bytes)
-			if err != nil {
-				return errors.New("error parsing attestationRoots: malformed certificate")
-			}
-			p.attestationRootPool.AddCert(cert)
-			hasCert = true
-		}
-		if !hasCert {
-			return errors.New("error parsing attestationRoots: no certificates found")
+	// Parse attestation, TPM endorsement and android-key roots.
+	// The pools will be nil if there are no roots.
+	if p.attestationRootPool, err = parseRootPool("attestationRoots", p.AttestationRoots); err != nil {
+		return err
+	}
+	if p.tpmEndorsementPool, err = parseRootPool("tpmEndorsementRoots", p.TPMEndorsementRoots); err != nil {
+		return err
+	}
+	if p.androidKeyRootPool, err = parseRootPool("androidKeyAttestationRoots", p.AndroidKeyAttestationRoots); err != nil {
+		return err
+	}
+
+	if p.DeviceInventory != nil {
+		if p.deviceInventory, err = mdm.New(p.DeviceInventory); err != nil {
+			return errors.Wrap(err, "error initializing deviceInventory")
 		}
 	}
 
@@ -218,6 +583,8 @@ const (
 	IP ACMEIdentifierType = "ip"
 	// DNS is the ACME dns identifier type
 	DNS ACMEIdentifierType = "dns"
+	// PermanentIdentifier is the ACME permanent-identifier identifier type
+	PermanentIdentifier ACMEIdentifierType = "permanent-identifier"
 )
 
 // ACMEIdentifier encodes ACME Order Identifiers
@@ -229,6 +596,11 @@ type ACMEIdentifier struct {
 // AuthorizeOrderIdentifier verifies the provisioner is allowed to issue a
 // certificate for an ACME Order Identifier.
 func (p *ACME) AuthorizeOrderIdentifier(_ context.Context, identifier ACMEIdentifier) error {
+	// identifier must be allowed by the identifier options
+	if err := p.Identifiers.authorize(identifier); err != nil {
+		return err
+	}
+
 	x509Policy := p.ctl.getPolicy().getX509()
 
 	// identifier is allowed if no policy is configured
@@ -270,6 +642,17 @@ func (p *ACME) AuthorizeSign(context.Context, string) ([]SignOption, error) {
 	return opts, nil
 }
 
+// AuthorizeDeviceAttestation calls the device attestation webhooks with the
+// data attested in a device-attest-01 challenge. It returns an error if any of
+// the webhooks does not allow the device.
+func (p *ACME) AuthorizeDeviceAttestation(ctx context.Context, data *webhook.DeviceAttestationData) error {
+	req, err := webhook.NewRequestBody(webhook.WithDeviceAttestationData(data))
+	if err != nil {
+		return errors.Wrap(err, "error creating webhook request")
+	}
+	return p.ctl.newWebhookController(nil, linkedca.Webhook_X509).AuthorizeDeviceAttestation(ctx, req)
+}
+
 // AuthorizeRevoke is called just before the certificate is to be revoked by
 // the CA. It can be used to authorize revocation of a certificate. With the
 // ACME protocol, revocation authorization is specified and performed as part
@@ -330,3 +713,70 @@ func (p *ACME) IsAttestationFormatEnabled(_ context.Context, format ACMEAttestat
 func (p *ACME) GetAttestationRoots() (*x509.CertPool, bool) {
 	return p.attestationRootPool, p.attestationRootPool != nil
 }
+
+// GetTPMEndorsementRoots returns the certificate pool with the configured TPM
+// manufacturer roots and reports if the pool contains at least one
+// certificate.
+func (p *ACME) GetTPMEndorsementRoots() (*x509.CertPool, bool) {
+	return p.tpmEndorsementPool, p.tpmEndorsementPool != nil
+}
+
+// GetAndroidKeyAttestationRoots returns the certificate pool with the
+// configured Google hardware attestation roots and reports if the pool
+// contains at least one certificate.
+func (p *ACME) GetAndroidKeyAttestationRoots() (*x509.CertPool, bool) {
+	return p.androidKeyRootPool, p.androidKeyRootPool != nil
+}
+
+// GetCAAIdentities returns the issuer domain names of the provisioner.
+func (p *ACME) GetCAAIdentities() []string {
+	return p.CaaIdentities
+}
+
+// GetCAAOptions returns the options used to check the CAA records, or nil if
+// they are not checked.
+func (p *ACME) GetCAAOptions() *ACMECAAOptions {
+	return p.CAA
+}
+
+// GetAttestationRevocationPolicy returns the policy used to check the
+// revocation status of the attestation certificates.
+func (p *ACME) GetAttestationRevocationPolicy() ACMERevocationPolicy {
+	if p.AttestationRevocation == "" {
+		return RevocationPolicyDisable
+	}
+	return p.AttestationRevocation
+}
+
+// GetDeviceInventory returns the MDM lookup provider used to verify the
+// attested devices, or nil if none is configured.
+func (p *ACME) GetDeviceInventory() mdm.Provider {
+	return p.deviceInventory
+}
+
+// parseRootPool returns a certificate pool with the certificates in the given
+// PEM bundle, or nil if the bundle is empty.
+func parseRootPool(name string, rest []byte) (*x509.CertPool, error) {
+	if len(rest) == 0 {
+		return nil, nil
+	}
+	var block *pem.Block
+	pool := x509.NewCertPool()
+	hasCert := false
+	for rest != nil {
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Errorf("error parsing %s: malformed certificate", name)
+		}
+		pool.AddCert(cert)
+		hasCert = true
+	}
+	if !hasCert {
+		return nil, errors.Errorf("error parsing %s: no certificates found", name)
+	}
+	return pool, nil
+}
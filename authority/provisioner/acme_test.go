@@ -16,6 +16,7 @@ import (
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/mdm"
 )
 
 func TestACMEChallenge_Validate(t *testing.T) {
@@ -134,6 +135,24 @@ func TestACME_Init(t *testing.T) {
 				err: errors.New("acme attestation format \"zar\" is not supported"),
 			}
 		},
+		"fail-attestation-revocation": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", AttestationRevocation: "strict"},
+				err: errors.New("acme attestation revocation policy \"strict\" is not supported"),
+			}
+		},
+		"fail-android-key-without-roots": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", AttestationFormats: []ACMEAttestationFormat{APPLE, ANDROID_KEY}},
+				err: errors.New("attestation format android-key requires androidKeyAttestationRoots"),
+			}
+		},
+		"fail-parse-android-key-attestation-roots": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", AndroidKeyAttestationRoots: []byte("-----BEGIN CERTIFICATE-----\nZm9v\n-----END CERTIFICATE-----")},
+				err: errors.New("error parsing androidKeyAttestationRoots: malformed certificate"),
+			}
+		},
 		"fail-parse-attestation-roots": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p:   &ACME{Name: "foo", Type: "bar", AttestationRoots: []byte("-----BEGIN CERTIFICATE-----\nZm9v\n-----END CERTIFICATE-----")},
@@ -146,11 +165,144 @@ func TestACME_Init(t *testing.T) {
 				err: errors.New("error parsing attestationRoots: no certificates found"),
 			}
 		},
+		"fail-parse-tpm-endorsement-roots": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", TPMEndorsementRoots: []byte("-----BEGIN CERTIFICATE-----\nZm9v\n-----END CERTIFICATE-----")},
+				err: errors.New("error parsing tpmEndorsementRoots: malformed certificate"),
+			}
+		},
+		"fail-empty-tpm-endorsement-roots": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", TPMEndorsementRoots: []byte("\n")},
+				err: errors.New("error parsing tpmEndorsementRoots: no certificates found"),
+			}
+		},
+		"fail-negative-authorization-reuse-duration": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", AuthorizationReuseDuration: &Duration{-time.Minute}},
+				err: errors.New("authorizationReuseDuration cannot be negative"),
+			}
+		},
+		"fail-negative-pre-authorization-duration": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", PreAuthorizationDuration: &Duration{-time.Minute}},
+				err: errors.New("preAuthorizationDuration cannot be negative"),
+			}
+		},
+		"fail-negative-challenge-retries": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", ChallengeRetries: -1},
+				err: errors.New("challengeRetries cannot be negative"),
+			}
+		},
+		"fail-negative-challenge-retry-interval": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", ChallengeRetryInterval: &Duration{-time.Second}},
+				err: errors.New("challengeRetryInterval cannot be negative"),
+			}
+		},
+		"fail-identifiers-ip-range": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", Identifiers: &ACMEIdentifierOptions{AllowedIPRanges: []string{"10.0.0.0"}}},
+				err: errors.New("identifiers: allowedIPRanges \"10.0.0.0\" is not a valid CIDR"),
+			}
+		},
+		"fail-identifiers-domain": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", Identifiers: &ACMEIdentifierOptions{AllowedDomains: []string{"*."}}},
+				err: errors.New("identifiers: allowedDomains \"*.\" is not a valid domain"),
+			}
+		},
+		"fail-rate-limits-limit": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", RateLimits: &ACMERateLimits{
+					NewOrder: &ACMERateLimitScopes{Account: &ACMERateLimit{Period: &Duration{time.Hour}}},
+				}},
+				err: errors.New("rateLimits: newOrder.account limit must be greater than 0"),
+			}
+		},
+		"fail-rate-limits-period": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", RateLimits: &ACMERateLimits{
+					FailedChallenge: &ACMERateLimitScopes{Identifier: &ACMERateLimit{Limit: 5}},
+				}},
+				err: errors.New("rateLimits: failedChallenge.identifier period must be greater than 0"),
+			}
+		},
+		"fail-rate-limits-new-account-scope": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", RateLimits: &ACMERateLimits{
+					NewAccount: &ACMERateLimitScopes{Account: &ACMERateLimit{Limit: 5, Period: &Duration{time.Hour}}},
+				}},
+				err: errors.New("rateLimits: newAccount only supports the ip and provisioner limits"),
+			}
+		},
+		"fail-caa-policy": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", CaaIdentities: []string{"ca.example.com"}, CAA: &ACMECAAOptions{Policy: "ignore"}},
+				err: errors.New("caa: policy \"ignore\" is not supported"),
+			}
+		},
+		"fail-caa-identities": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", CAA: &ACMECAAOptions{}},
+				err: errors.New("caa: caaIdentities cannot be empty"),
+			}
+		},
+		"ok caa": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", CaaIdentities: []string{"ca.example.com"}, CAA: &ACMECAAOptions{Policy: CAAPolicyLog, CheckChallenges: true}},
+			}
+		},
+		"ok rate limits": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", RateLimits: &ACMERateLimits{
+					NewOrder:        &ACMERateLimitScopes{Account: &ACMERateLimit{Limit: 300, Period: &Duration{3 * time.Hour}}},
+					NewAccount:      &ACMERateLimitScopes{IP: &ACMERateLimit{Limit: 10, Period: &Duration{3 * time.Hour}}},
+					FailedChallenge: &ACMERateLimitScopes{Identifier: &ACMERateLimit{Limit: 5, Period: &Duration{time.Hour}}},
+				}},
+			}
+		},
+		"ok identifiers": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", Identifiers: &ACMEIdentifierOptions{
+					DisableWildcard: true,
+					AllowedIPRanges: []string{"10.0.0.0/8", "fd00::/8"},
+					AllowedDomains:  []string{"internal", ".example.com"},
+				}},
+			}
+		},
+		"ok attestation revocation": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", AttestationRevocation: RevocationPolicySoftFail},
+			}
+		},
+		"ok challenge retries": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", ChallengeRetries: 3, ChallengeRetryInterval: &Duration{time.Minute}},
+			}
+		},
 		"ok": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p: &ACME{Name: "foo", Type: "bar"},
 			}
 		},
+		"fail-device-inventory": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p:   &ACME{Name: "foo", Type: "bar", DeviceInventory: &mdm.Config{Type: "jamf", ClientID: "id", ClientSecret: "secret"}},
+				err: errors.New("error initializing deviceInventory: mdm url cannot be empty"),
+			}
+		},
+		"ok device inventory": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", DeviceInventory: &mdm.Config{Type: "intune", TenantID: "tenant", ClientID: "id", ClientSecret: "secret"}},
+			}
+		},
+		"ok authorization reuse duration": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{Name: "foo", Type: "bar", AuthorizationReuseDuration: &Duration{24 * time.Hour}},
+			}
+		},
 		"ok attestation": func(t *testing.T) ProvisionerValidateTest {
 			return ProvisionerValidateTest{
 				p: &ACME{
@@ -162,6 +314,28 @@ func TestACME_Init(t *testing.T) {
 				},
 			}
 		},
+		"ok tpm endorsement roots": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{
+					Name:                "foo",
+					Type:                "bar",
+					Challenges:          []ACMEChallenge{DEVICE_ATTEST_01},
+					AttestationFormats:  []ACMEAttestationFormat{TPM},
+					TPMEndorsementRoots: yubicoCA,
+				},
+			}
+		},
+		"ok android-key attestation roots": func(t *testing.T) ProvisionerValidateTest {
+			return ProvisionerValidateTest{
+				p: &ACME{
+					Name:                       "foo",
+					Type:                       "bar",
+					Challenges:                 []ACMEChallenge{DEVICE_ATTEST_01},
+					AttestationFormats:         []ACMEAttestationFormat{APPLE, ANDROID_KEY},
+					AndroidKeyAttestationRoots: yubicoCA,
+				},
+			}
+		},
 	}
 
 	config := Config{
@@ -300,6 +474,57 @@ func TestACME_AuthorizeSign(t *testing.T) {
 	}
 }
 
+func TestACME_AuthorizeOrderIdentifier(t *testing.T) {
+	ipOnly := &ACMEIdentifierOptions{
+		AllowedIPRanges: []string{"10.0.0.0/8"},
+		AllowedDomains:  []string{"internal"},
+	}
+	noWildcards := &ACMEIdentifierOptions{
+		DisableIP:                  true,
+		DisableWildcard:            true,
+		DisablePermanentIdentifier: true,
+	}
+	domains := &ACMEIdentifierOptions{
+		AllowedDomains: []string{"*.Example.com"},
+	}
+
+	tests := []struct {
+		name        string
+		identifiers *ACMEIdentifierOptions
+		identifier  ACMEIdentifier
+		wantErr     bool
+	}{
+		{"ok no options", nil, ACMEIdentifier{Type: DNS, Value: "*.example.com"}, false},
+		{"ok no options ip", nil, ACMEIdentifier{Type: IP, Value: "192.168.0.1"}, false},
+		{"ok ip range", ipOnly, ACMEIdentifier{Type: IP, Value: "10.1.2.3"}, false},
+		{"ok domain", ipOnly, ACMEIdentifier{Type: DNS, Value: "host.internal"}, false},
+		{"ok wildcard domain", ipOnly, ACMEIdentifier{Type: DNS, Value: "*.internal"}, false},
+		{"ok dns", noWildcards, ACMEIdentifier{Type: DNS, Value: "example.com"}, false},
+		{"ok domain suffix", domains, ACMEIdentifier{Type: DNS, Value: "example.com"}, false},
+		{"ok subdomain suffix", domains, ACMEIdentifier{Type: DNS, Value: "www.EXAMPLE.com"}, false},
+		{"ok permanent identifier", ipOnly, ACMEIdentifier{Type: PermanentIdentifier, Value: "12345678"}, false},
+		{"fail ip range", ipOnly, ACMEIdentifier{Type: IP, Value: "192.168.0.1"}, true},
+		{"fail ipv6 range", ipOnly, ACMEIdentifier{Type: IP, Value: "::1"}, true},
+		{"fail domain", ipOnly, ACMEIdentifier{Type: DNS, Value: "example.com"}, true},
+		{"fail domain suffix", domains, ACMEIdentifier{Type: DNS, Value: "badexample.com"}, true},
+		{"fail ip disabled", noWildcards, ACMEIdentifier{Type: IP, Value: "10.1.2.3"}, true},
+		{"fail wildcard disabled", noWildcards, ACMEIdentifier{Type: DNS, Value: "*.example.com"}, true},
+		{"fail permanent identifier disabled", noWildcards, ACMEIdentifier{Type: PermanentIdentifier, Value: "12345678"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ACME{Name: "foo", Type: "ACME", Identifiers: tt.identifiers}
+			if err := p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}); err != nil {
+				t.Fatal(err)
+			}
+			err := p.AuthorizeOrderIdentifier(context.Background(), tt.identifier)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ACME.AuthorizeOrderIdentifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestACME_IsChallengeEnabled(t *testing.T) {
 	ctx := context.Background()
 	type fields struct {
@@ -82,6 +82,12 @@ func (c *Controller) newWebhookController(templateData WebhookSetter, certType l
 	if client == nil {
 		client = http.DefaultClient
 	}
+	// Let the webhook servers know which provisioner authorized the request.
+	if c.Interface != nil {
+		opts = append([]webhook.RequestBodyOption{
+			webhook.WithProvisioner(c.GetID(), c.GetName(), c.GetType().String()),
+		}, opts...)
+	}
 	return &WebhookController{
 		TemplateData: templateData,
 		client:       client,
@@ -494,3 +494,20 @@ func Test_newWebhookController(t *testing.T) {
 		}
 	}
 }
+
+func Test_newWebhookController_provisioner(t *testing.T) {
+	p := &JWK{ID: "jwk-id", Name: "jwk-name", Type: "JWK"}
+	c := &Controller{Interface: p}
+	wc := c.newWebhookController(x509util.TemplateData{}, linkedca.Webhook_X509)
+
+	req := &webhook.RequestBody{}
+	for _, fn := range wc.options {
+		if err := fn(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := &webhook.ProvisionerInfo{ID: "jwk-id", Name: "jwk-name", Type: "JWK"}
+	if !reflect.DeepEqual(req.Provisioner, want) {
+		t.Errorf("RequestBody.Provisioner = %v, want %v", req.Provisioner, want)
+	}
+}
@@ -73,14 +73,14 @@ type X509Options struct {
 	TemplateData json.RawMessage `json:"templateData,omitempty"`
 
 	// AllowedNames contains the SANs the provisioner is authorized to sign
-	AllowedNames *policy.X509NameOptions `json:"-"`
+	AllowedNames *policy.X509NameOptions `json:"allow,omitempty"`
 
 	// DeniedNames contains the SANs the provisioner is not authorized to sign
-	DeniedNames *policy.X509NameOptions `json:"-"`
+	DeniedNames *policy.X509NameOptions `json:"deny,omitempty"`
 
 	// AllowWildcardNames indicates if literal wildcard names
 	// like *.example.com are allowed. Defaults to false.
-	AllowWildcardNames bool `json:"-"`
+	AllowWildcardNames bool `json:"allowWildcardNames,omitempty"`
 }
 
 // HasTemplate returns true if a template is defined in the provisioner options.
@@ -2,6 +2,7 @@ package provisioner
 
 import (
 	"bytes"
+	"context"
 	"crypto/x509"
 	"encoding/json"
 	"reflect"
@@ -353,3 +354,41 @@ func TestX509Options_IsWildcardLiteralAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestX509Options_policy(t *testing.T) {
+	var p ACME
+	if err := json.Unmarshal([]byte(`{
+		"type": "ACME",
+		"name": "bu1",
+		"options": {
+			"x509": {
+				"allow": {"dns": ["*.bu1.example.com"]},
+				"deny": {"dns": ["admin.bu1.example.com"]}
+			}
+		}
+	}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(Config{Claims: globalProvisionerClaims, Audiences: testAudiences}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		identifier ACMEIdentifier
+		wantErr    bool
+	}{
+		{"ok", ACMEIdentifier{Type: DNS, Value: "www.bu1.example.com"}, false},
+		{"fail other domain", ACMEIdentifier{Type: DNS, Value: "www.bu2.example.com"}, true},
+		{"fail denied", ACMEIdentifier{Type: DNS, Value: "admin.bu1.example.com"}, true},
+		{"fail ip", ACMEIdentifier{Type: IP, Value: "10.1.2.3"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.AuthorizeOrderIdentifier(context.Background(), tt.identifier)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ACME.AuthorizeOrderIdentifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -226,6 +226,9 @@ type Config struct {
 	AuthorizeSSHRenewFunc AuthorizeSSHRenewFunc
 	// WebhookClient is an http client to use in webhook request
 	WebhookClient *http.Client
+	// UseSCEPChallengeFunc is a function that consumes the one-time challenges
+	// of the SCEP provisioners.
+	UseSCEPChallengeFunc UseSCEPChallengeFunc
 }
 
 type provisioner struct {
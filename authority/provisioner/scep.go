@@ -9,6 +9,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -16,6 +17,7 @@ import (
 	"go.step.sm/crypto/kms"
 	kmsapi "go.step.sm/crypto/kms/apiv1"
 	"go.step.sm/crypto/kms/uri"
+	"go.step.sm/crypto/pemutil"
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/certificates/webhook"
@@ -52,20 +54,128 @@ type SCEP struct {
 	// Numerical identifier for the ContentEncryptionAlgorithm as defined in github.com/mozilla-services/pkcs7
 	// at https://github.com/mozilla-services/pkcs7/blob/33d05740a3526e382af6395d3513e73d4e66d1cb/encrypt.go#L63
 	// Defaults to 0, being DES-CBC
-	EncryptionAlgorithmIdentifier int      `json:"encryptionAlgorithmIdentifier,omitempty"`
+	EncryptionAlgorithmIdentifier int `json:"encryptionAlgorithmIdentifier,omitempty"`
+
+	// MinimumHashAlgorithm is the weakest hash algorithm accepted in requests,
+	// one of SHA-1, SHA-256, SHA-384 or SHA-512. Defaults to SHA-256.
+	MinimumHashAlgorithm string `json:"minimumHashAlgorithm,omitempty"`
+
+	// MinimumEncryptionAlgorithm is the weakest content encryption algorithm
+	// accepted in requests, one of DES, DES3, AES-128 or AES-256. Defaults to
+	// AES-128.
+	MinimumEncryptionAlgorithm string `json:"minimumEncryptionAlgorithm,omitempty"`
+
+	// DisableRenewal rejects RenewalReq messages and stops advertising the
+	// Renewal capability.
+	DisableRenewal bool `json:"disableRenewal,omitempty"`
+
+	// DisablePOSTPKIOperation rejects PKIOperation requests using POST and
+	// stops advertising the POSTPKIOperation capability.
+	DisablePOSTPKIOperation bool `json:"disablePOSTPKIOperation,omitempty"`
+
+	// LegacyDevices lists the devices that are allowed to use SHA-1 and DES or
+	// 3DES in their requests. Requests using these algorithms from any other
+	// device are rejected.
+	LegacyDevices []SCEPLegacyDevice `json:"legacyDevices,omitempty"`
+
+	// NextCACertificates is a PEM bundle with the certificates of the CA that
+	// will replace the current one. They are returned in the GetNextCACert
+	// responses during a CA rollover.
+	NextCACertificates []byte `json:"nextCACertificates,omitempty"`
+
+	// DynamicChallenge enables one-time challenges generated by the CA for
+	// each device, in addition to the static challenge password. It cannot be
+	// used with a SCEPCHALLENGE webhook.
+	DynamicChallenge *SCEPDynamicChallenge `json:"dynamicChallenge,omitempty"`
+
 	Options                       *Options `json:"options,omitempty"`
 	Claims                        *Claims  `json:"claims,omitempty"`
 	ctl                           *Controller
 	encryptionAlgorithm           int
+	minimumHashAlgorithm          int
+	minimumEncryptionAlgorithm    int
 	challengeValidationController *challengeValidationController
+	useChallengeFunc              UseSCEPChallengeFunc
 	notificationController        *notificationController
 	keyManager                    kmsapi.KeyManager
 	decrypter                     crypto.Decrypter
 	decrypterCertificate          *x509.Certificate
 	signer                        crypto.Signer
 	signerCertificate             *x509.Certificate
+	nextCACertificates            []*x509.Certificate
 }
 
+// scepHashAlgorithms and scepEncryptionAlgorithms are the algorithms that can
+// be used in SCEP requests, from the weakest to the strongest.
+var (
+	scepHashAlgorithms       = []string{"SHA-1", "SHA-256", "SHA-384", "SHA-512"}
+	scepEncryptionAlgorithms = []string{"DES", "DES3", "AES-128", "AES-256"}
+)
+
+// scepContentEncryptionAlgorithms maps the pkcs7 content encryption algorithm
+// identifiers to the position of the algorithm in scepEncryptionAlgorithms.
+var scepContentEncryptionAlgorithms = []int{
+	0, // DES-CBC
+	2, // AES-128-CBC
+	3, // AES-256-CBC
+	2, // AES-128-GCM
+	3, // AES-256-GCM
+}
+
+// algorithmIndex returns the position of the named algorithm in the list, or
+// -1 if it's not in the list.
+func algorithmIndex(algorithms []string, name string) int {
+	for i, alg := range algorithms {
+		if strings.EqualFold(alg, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SCEPLegacyDevice identifies a device that is allowed to use legacy
+// algorithms in its SCEP requests until the given expiration. A device is
+// matched by the common name and the serial number in the subject of its CSR;
+// all the properties set must match.
+type SCEPLegacyDevice struct {
+	Subject      string    `json:"subject,omitempty"`
+	SerialNumber string    `json:"serialNumber,omitempty"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// matches returns true if the given CSR was created by the device and the
+// exception has not expired.
+func (d *SCEPLegacyDevice) matches(csr *x509.CertificateRequest, t time.Time) bool {
+	switch {
+	case t.After(d.ExpiresAt):
+		return false
+	case d.Subject != "" && d.Subject != csr.Subject.CommonName:
+		return false
+	case d.SerialNumber != "" && d.SerialNumber != csr.Subject.SerialNumber:
+		return false
+	default:
+		return true
+	}
+}
+
+// SCEPDynamicChallenge configures the one-time challenges of a SCEP
+// provisioner. One-time challenges are generated by the CA, usually requested
+// by an MDM platform for each device, and they are consumed on first use.
+type SCEPDynamicChallenge struct {
+	// Lifetime is the time a one-time challenge can be used after it has been
+	// generated. It defaults to 1 hour.
+	Lifetime *Duration `json:"lifetime,omitempty"`
+}
+
+// UseSCEPChallengeFunc is a function that consumes a one-time challenge of the
+// given provisioner. The certificate request and the transaction ID identify
+// the device using the challenge. It returns true if the challenge was valid.
+type UseSCEPChallengeFunc func(ctx context.Context, p Interface, csr *x509.CertificateRequest, challenge, transactionID string) (bool, error)
+
+// DefaultSCEPChallengeLifetime is the default lifetime of the SCEP one-time
+// challenges.
+const DefaultSCEPChallengeLifetime = time.Hour
+
 // GetID returns the provisioner unique identifier.
 func (s *SCEP) GetID() string {
 	if s.ID != "" {
@@ -255,6 +365,51 @@ func (s *SCEP) Init(config Config) (err error) {
 		return errors.New("only encryption algorithm identifiers from 0 to 4 are valid")
 	}
 
+	// Set the weakest algorithms accepted in requests
+	minimumHashAlgorithm := s.MinimumHashAlgorithm
+	if minimumHashAlgorithm == "" {
+		minimumHashAlgorithm = "SHA-256"
+	}
+	if s.minimumHashAlgorithm = algorithmIndex(scepHashAlgorithms, minimumHashAlgorithm); s.minimumHashAlgorithm < 0 {
+		return errors.Errorf("minimumHashAlgorithm %q is not supported", s.MinimumHashAlgorithm)
+	}
+	minimumEncryptionAlgorithm := s.MinimumEncryptionAlgorithm
+	if minimumEncryptionAlgorithm == "" {
+		minimumEncryptionAlgorithm = "AES-128"
+	}
+	if s.minimumEncryptionAlgorithm = algorithmIndex(scepEncryptionAlgorithms, minimumEncryptionAlgorithm); s.minimumEncryptionAlgorithm < 0 {
+		return errors.Errorf("minimumEncryptionAlgorithm %q is not supported", s.MinimumEncryptionAlgorithm)
+	}
+
+	// Responses are not encrypted with an algorithm weaker than the explicit
+	// minimum required from the clients. If the algorithm for the responses
+	// is not set, the default DES-CBC is replaced with AES-CBC.
+	if s.MinimumEncryptionAlgorithm != "" && scepContentEncryptionAlgorithms[s.encryptionAlgorithm] < s.minimumEncryptionAlgorithm {
+		switch {
+		case s.EncryptionAlgorithmIdentifier != 0:
+			return errors.Errorf("encryptionAlgorithmIdentifier %d is weaker than minimumEncryptionAlgorithm %q",
+				s.EncryptionAlgorithmIdentifier, s.MinimumEncryptionAlgorithm)
+		case strings.EqualFold(s.MinimumEncryptionAlgorithm, "AES-256"):
+			s.encryptionAlgorithm = 2 // AES-256-CBC
+		default:
+			s.encryptionAlgorithm = 1 // AES-128-CBC
+		}
+	}
+
+	for i, d := range s.LegacyDevices {
+		if d.Subject == "" && d.SerialNumber == "" {
+			return errors.Errorf("legacyDevices[%d] must define a subject or a serialNumber", i)
+		}
+		if d.ExpiresAt.IsZero() {
+			return errors.Errorf("legacyDevices[%d] must define an expiration", i)
+		}
+	}
+
+	if s.DynamicChallenge != nil && s.DynamicChallenge.Lifetime.Value() < 0 {
+		return errors.New("dynamicChallenge lifetime cannot be negative")
+	}
+	s.useChallengeFunc = config.UseSCEPChallengeFunc
+
 	// Prepare the SCEP challenge validator
 	s.challengeValidationController = newChallengeValidationController(
 		config.WebhookClient,
@@ -266,6 +421,9 @@ func (s *SCEP) Init(config Config) (err error) {
 		config.WebhookClient,
 		s.GetOptions().GetWebhooks(),
 	)
+	if s.DynamicChallenge != nil && len(s.challengeValidationController.webhooks) > 0 {
+		return errors.New("dynamicChallenge cannot be used with a SCEPCHALLENGE webhook")
+	}
 
 	// parse the decrypter key PEM contents if available
 	if decryptionKeyPEM := s.DecrypterKeyPEM; len(decryptionKeyPEM) > 0 {
@@ -361,8 +519,19 @@ func (s *SCEP) Init(config Config) (err error) {
 		s.signerCertificate = s.decrypterCertificate
 	}
 
-	// TODO(hs): alternatively, check if the KMS keyManager is a CertificateManager
-	// and load the certificate corresponding to the decryption key?
+	// load the decrypter certificate from the KMS if it was not provided, so
+	// that both the key and the certificate can be kept in an HSM.
+	if s.decrypterCertificate == nil && s.DecrypterKeyURI != "" {
+		if cm, ok := s.keyManager.(kmsapi.CertificateManager); ok {
+			if s.decrypterCertificate, err = cm.LoadCertificate(&kmsapi.LoadCertificateRequest{
+				Name: s.DecrypterKeyURI,
+			}); err != nil {
+				return fmt.Errorf("failed loading decrypter certificate: %w", err)
+			}
+			// the decrypter certificate is also the signer certificate
+			s.signerCertificate = s.decrypterCertificate
+		}
+	}
 
 	// Final validation for the decrypter.
 	if s.decrypter != nil {
@@ -378,6 +547,13 @@ func (s *SCEP) Init(config Config) (err error) {
 		}
 	}
 
+	// parse the certificates of the next CA if available
+	if len(s.NextCACertificates) > 0 {
+		if s.nextCACertificates, err = pemutil.ParseCertificateBundle(s.NextCACertificates); err != nil {
+			return fmt.Errorf("failed parsing next CA certificates: %w", err)
+		}
+	}
+
 	// TODO: add other, SCEP specific, options?
 
 	s.ctl, err = NewController(s, s.Claims, config, s.Options)
@@ -424,6 +600,51 @@ func (s *SCEP) ShouldIncludeIntermediateInChain() bool {
 	return !s.ExcludeIntermediate
 }
 
+// HasLegacyDevices returns true if any device is allowed to use legacy
+// algorithms.
+func (s *SCEP) HasLegacyDevices() bool {
+	return len(s.LegacyDevices) > 0
+}
+
+// AllowsLegacyAlgorithms returns true if the device that created the given CSR
+// is allowed to use SHA-1 and DES or 3DES in its requests.
+func (s *SCEP) AllowsLegacyAlgorithms(csr *x509.CertificateRequest) bool {
+	if csr == nil {
+		return false
+	}
+	t := now()
+	for i := range s.LegacyDevices {
+		if s.LegacyDevices[i].matches(csr, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAlgorithm returns true if the named hash or content encryption
+// algorithm is not weaker than the minimum configured in the provisioner.
+// Unknown algorithms, like MD5, are never allowed.
+func (s *SCEP) AllowsAlgorithm(name string) bool {
+	if i := algorithmIndex(scepHashAlgorithms, name); i >= 0 {
+		return i >= s.minimumHashAlgorithm
+	}
+	if i := algorithmIndex(scepEncryptionAlgorithms, name); i >= 0 {
+		return i >= s.minimumEncryptionAlgorithm
+	}
+	return false
+}
+
+// AllowsRenewal returns true if RenewalReq messages are allowed.
+func (s *SCEP) AllowsRenewal() bool {
+	return !s.DisableRenewal
+}
+
+// AllowsPOSTPKIOperation returns true if PKIOperation requests can use the
+// POST method.
+func (s *SCEP) AllowsPOSTPKIOperation() bool {
+	return !s.DisablePOSTPKIOperation
+}
+
 // GetContentEncryptionAlgorithm returns the numeric identifier
 // for the pkcs7 package encryption algorithm to use.
 func (s *SCEP) GetContentEncryptionAlgorithm() int {
@@ -440,6 +661,22 @@ func (s *SCEP) ValidateChallenge(ctx context.Context, csr *x509.CertificateReque
 	switch s.selectValidationMethod() {
 	case validationMethodWebhook:
 		return s.challengeValidationController.Validate(ctx, csr, challenge, transactionID)
+	case validationMethodDynamic:
+		if s.useChallengeFunc == nil {
+			return fmt.Errorf("provisioner %q does not support one-time challenges", s.Name)
+		}
+		ok, err := s.useChallengeFunc(ctx, s, csr, challenge, transactionID)
+		if err != nil {
+			return fmt.Errorf("error validating one-time challenge: %w", err)
+		}
+		if ok {
+			return nil
+		}
+		// The static challenge password is still accepted if it is set.
+		if s.ChallengePassword == "" || subtle.ConstantTimeCompare([]byte(s.ChallengePassword), []byte(challenge)) == 0 {
+			return errors.New("invalid challenge password provided")
+		}
+		return nil
 	default:
 		if subtle.ConstantTimeCompare([]byte(s.ChallengePassword), []byte(challenge)) == 0 {
 			return errors.New("invalid challenge password provided")
@@ -468,22 +705,46 @@ const (
 	validationMethodNone    validationMethod = "none"
 	validationMethodStatic  validationMethod = "static"
 	validationMethodWebhook validationMethod = "webhook"
+	validationMethodDynamic validationMethod = "dynamic"
 )
 
 // selectValidationMethod returns the method to validate SCEP
 // challenges. If a webhook is configured with kind `SCEPCHALLENGE`,
-// the webhook method will be used. If a challenge password is set,
+// the webhook method will be used. If one-time challenges are enabled,
+// the dynamic method is used. If a challenge password is set,
 // the static method is used. It will default to the `none` method.
 func (s *SCEP) selectValidationMethod() validationMethod {
 	if len(s.challengeValidationController.webhooks) > 0 {
 		return validationMethodWebhook
 	}
+	if s.DynamicChallenge != nil {
+		return validationMethodDynamic
+	}
 	if s.ChallengePassword != "" {
 		return validationMethodStatic
 	}
 	return validationMethodNone
 }
 
+// GetNextCACertificates returns the certificates of the CA that will replace
+// the current one, or nil if a CA rollover is not configured.
+func (s *SCEP) GetNextCACertificates() []*x509.Certificate {
+	return s.nextCACertificates
+}
+
+// GetChallengeLifetime returns the lifetime of the one-time challenges, or 0 if
+// one-time challenges are not enabled.
+func (s *SCEP) GetChallengeLifetime() time.Duration {
+	switch {
+	case s.DynamicChallenge == nil:
+		return 0
+	case s.DynamicChallenge.Lifetime.Value() > 0:
+		return s.DynamicChallenge.Lifetime.Value()
+	default:
+		return DefaultSCEPChallengeLifetime
+	}
+}
+
 // GetDecrypter returns the provisioner specific decrypter,
 // used to decrypt SCEP request messages sent by a SCEP client.
 // The decrypter consists of a crypto.Decrypter (a private key)
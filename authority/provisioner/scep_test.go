@@ -2,16 +2,25 @@ package provisioner
 
 import (
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	kmsapi "go.step.sm/crypto/kms/apiv1"
+	"go.step.sm/crypto/minica"
 	"go.step.sm/linkedca"
 
 	"github.com/smallstep/certificates/webhook"
@@ -204,6 +213,12 @@ func Test_selectValidationMethod(t *testing.T) {
 			},
 			ChallengePassword: "pass",
 		}, "static"},
+		{"dynamic", &SCEP{
+			Name:              "SCEP",
+			Type:              "SCEP",
+			ChallengePassword: "pass",
+			DynamicChallenge:  &SCEPDynamicChallenge{},
+		}, "dynamic"},
 		{"none", &SCEP{
 			Name: "SCEP",
 			Type: "SCEP",
@@ -357,3 +372,251 @@ func TestSCEP_ValidateChallenge(t *testing.T) {
 		})
 	}
 }
+
+func TestSCEP_ValidateChallenge_dynamic(t *testing.T) {
+	challenges := map[string]bool{"one-time": true}
+	useChallenge := func(ctx context.Context, p Interface, csr *x509.CertificateRequest, challenge, transactionID string) (bool, error) {
+		assert.Equal(t, "scep/SCEP", p.GetID())
+		assert.Equal(t, "transaction-1", transactionID)
+		switch challenge {
+		case "fail":
+			return false, errors.New("force")
+		default:
+			ok := challenges[challenge]
+			delete(challenges, challenge)
+			return ok, nil
+		}
+	}
+
+	tests := []struct {
+		name      string
+		p         *SCEP
+		useFunc   UseSCEPChallengeFunc
+		challenge string
+		expErr    error
+	}{
+		{"ok", &SCEP{Name: "SCEP", Type: "SCEP", DynamicChallenge: &SCEPDynamicChallenge{}}, useChallenge, "one-time", nil},
+		{"fail/used", &SCEP{Name: "SCEP", Type: "SCEP", DynamicChallenge: &SCEPDynamicChallenge{}}, useChallenge, "one-time",
+			errors.New("invalid challenge password provided")},
+		{"ok/static", &SCEP{Name: "SCEP", Type: "SCEP", ChallengePassword: "static", DynamicChallenge: &SCEPDynamicChallenge{}}, useChallenge, "static", nil},
+		{"fail/empty", &SCEP{Name: "SCEP", Type: "SCEP", DynamicChallenge: &SCEPDynamicChallenge{}}, useChallenge, "",
+			errors.New("invalid challenge password provided")},
+		{"fail/error", &SCEP{Name: "SCEP", Type: "SCEP", DynamicChallenge: &SCEPDynamicChallenge{}}, useChallenge, "fail",
+			errors.New("error validating one-time challenge: force")},
+		{"fail/not-supported", &SCEP{Name: "SCEP", Type: "SCEP", DynamicChallenge: &SCEPDynamicChallenge{}}, nil, "one-time",
+			errors.New(`provisioner "SCEP" does not support one-time challenges`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims, UseSCEPChallengeFunc: tt.useFunc})
+			require.NoError(t, err)
+
+			err = tt.p.ValidateChallenge(context.Background(), &x509.CertificateRequest{}, tt.challenge, "transaction-1")
+			if tt.expErr != nil {
+				assert.EqualError(t, err, tt.expErr.Error())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSCEP_GetChallengeLifetime(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *SCEP
+		want    time.Duration
+		wantErr bool
+	}{
+		{"disabled", &SCEP{Name: "SCEP", Type: "SCEP"}, 0, false},
+		{"default", &SCEP{Name: "SCEP", Type: "SCEP", DynamicChallenge: &SCEPDynamicChallenge{}}, time.Hour, false},
+		{"lifetime", &SCEP{Name: "SCEP", Type: "SCEP", DynamicChallenge: &SCEPDynamicChallenge{
+			Lifetime: &Duration{Duration: 10 * time.Minute},
+		}}, 10 * time.Minute, false},
+		{"fail/negative", &SCEP{Name: "SCEP", Type: "SCEP", DynamicChallenge: &SCEPDynamicChallenge{
+			Lifetime: &Duration{Duration: -time.Minute},
+		}}, 0, true},
+		{"fail/webhook", &SCEP{Name: "SCEP", Type: "SCEP", DynamicChallenge: &SCEPDynamicChallenge{}, Options: &Options{
+			Webhooks: []*Webhook{{Kind: linkedca.Webhook_SCEPCHALLENGE.String()}},
+		}}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, tt.p.GetChallengeLifetime())
+		})
+	}
+}
+
+func TestSCEP_AllowsLegacyAlgorithms(t *testing.T) {
+	p := &SCEP{
+		Name: "SCEP",
+		Type: "SCEP",
+		LegacyDevices: []SCEPLegacyDevice{
+			{Subject: "printer", ExpiresAt: time.Now().Add(time.Hour)},
+			{Subject: "phone", SerialNumber: "1234", ExpiresAt: time.Now().Add(time.Hour)},
+			{SerialNumber: "5678", ExpiresAt: time.Now().Add(-time.Hour)},
+		},
+	}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.True(t, p.HasLegacyDevices())
+
+	csr := func(cn, serialNumber string) *x509.CertificateRequest {
+		return &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn, SerialNumber: serialNumber}}
+	}
+	assert.True(t, p.AllowsLegacyAlgorithms(csr("printer", "")))
+	assert.True(t, p.AllowsLegacyAlgorithms(csr("printer", "0000")))
+	assert.True(t, p.AllowsLegacyAlgorithms(csr("phone", "1234")))
+	assert.False(t, p.AllowsLegacyAlgorithms(csr("phone", "")))
+	assert.False(t, p.AllowsLegacyAlgorithms(csr("scanner", "5678")))
+	assert.False(t, p.AllowsLegacyAlgorithms(csr("other", "")))
+	assert.False(t, p.AllowsLegacyAlgorithms(nil))
+
+	assert.EqualError(t, (&SCEP{Name: "SCEP", Type: "SCEP", LegacyDevices: []SCEPLegacyDevice{
+		{ExpiresAt: time.Now()},
+	}}).Init(Config{Claims: globalProvisionerClaims}), "legacyDevices[0] must define a subject or a serialNumber")
+	assert.EqualError(t, (&SCEP{Name: "SCEP", Type: "SCEP", LegacyDevices: []SCEPLegacyDevice{
+		{Subject: "printer"},
+	}}).Init(Config{Claims: globalProvisionerClaims}), "legacyDevices[0] must define an expiration")
+}
+
+func TestSCEP_GetNextCACertificates(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	bundle := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Intermediate.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Root.Raw})...)
+
+	p := &SCEP{Name: "SCEP", Type: "SCEP"}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Nil(t, p.GetNextCACertificates())
+
+	p = &SCEP{Name: "SCEP", Type: "SCEP", NextCACertificates: bundle}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	assert.Equal(t, []*x509.Certificate{ca.Intermediate, ca.Root}, p.GetNextCACertificates())
+
+	p = &SCEP{Name: "SCEP", Type: "SCEP", NextCACertificates: []byte("not a certificate")}
+	assert.ErrorContains(t, p.Init(Config{Claims: globalProvisionerClaims}), "failed parsing next CA certificates")
+}
+
+func TestSCEP_AllowsAlgorithm(t *testing.T) {
+	tests := []struct {
+		name                    string
+		p                       *SCEP
+		allowed                 []string
+		notAllowed              []string
+		wantEncryptionAlgorithm int
+		wantErr                 string
+	}{
+		{"default", &SCEP{}, []string{"SHA-256", "SHA-512", "AES-128", "AES-256"}, []string{"MD5", "SHA-1", "DES", "DES3", "foo"}, 0, ""},
+		{"weak", &SCEP{MinimumHashAlgorithm: "SHA-1", MinimumEncryptionAlgorithm: "DES"}, []string{"SHA-1", "SHA-256", "DES", "DES3", "AES-128"}, []string{"MD5"}, 0, ""},
+		{"strict", &SCEP{MinimumHashAlgorithm: "sha-384", MinimumEncryptionAlgorithm: "AES-256"}, []string{"SHA-384", "SHA-512", "AES-256"}, []string{"SHA-1", "SHA-256", "DES3", "AES-128"}, 2, ""},
+		{"aes128", &SCEP{MinimumEncryptionAlgorithm: "AES-128"}, []string{"AES-128"}, []string{"DES3"}, 1, ""},
+		{"aes256-gcm", &SCEP{MinimumEncryptionAlgorithm: "AES-256", EncryptionAlgorithmIdentifier: 4}, []string{"AES-256"}, []string{"AES-128"}, 4, ""},
+		{"fail/hash", &SCEP{MinimumHashAlgorithm: "MD5"}, nil, nil, 0, `minimumHashAlgorithm "MD5" is not supported`},
+		{"fail/encryption", &SCEP{MinimumEncryptionAlgorithm: "RC2"}, nil, nil, 0, `minimumEncryptionAlgorithm "RC2" is not supported`},
+		{"fail/response-encryption", &SCEP{MinimumEncryptionAlgorithm: "AES-256", EncryptionAlgorithmIdentifier: 3}, nil, nil, 0,
+			`encryptionAlgorithmIdentifier 3 is weaker than minimumEncryptionAlgorithm "AES-256"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.p.Name, tt.p.Type = "SCEP", "SCEP"
+			err := tt.p.Init(Config{Claims: globalProvisionerClaims})
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			for _, alg := range tt.allowed {
+				assert.True(t, tt.p.AllowsAlgorithm(alg), alg)
+			}
+			for _, alg := range tt.notAllowed {
+				assert.False(t, tt.p.AllowsAlgorithm(alg), alg)
+			}
+			assert.Equal(t, tt.wantEncryptionAlgorithm, tt.p.GetContentEncryptionAlgorithm())
+		})
+	}
+}
+
+// certificateKMS is a KMS that keeps a decrypter and its certificate, like a
+// YubiKey or a PKCS#11 module.
+type certificateKMS struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func (k *certificateKMS) GetPublicKey(*kmsapi.GetPublicKeyRequest) (crypto.PublicKey, error) {
+	return k.key.Public(), nil
+}
+
+func (k *certificateKMS) CreateKey(*kmsapi.CreateKeyRequest) (*kmsapi.CreateKeyResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (k *certificateKMS) CreateSigner(*kmsapi.CreateSignerRequest) (crypto.Signer, error) {
+	return k.key, nil
+}
+
+func (k *certificateKMS) CreateDecrypter(*kmsapi.CreateDecrypterRequest) (crypto.Decrypter, error) {
+	return k.key, nil
+}
+
+func (k *certificateKMS) LoadCertificate(req *kmsapi.LoadCertificateRequest) (*x509.Certificate, error) {
+	if req.Name != "tpmkms:name=scep" {
+		return nil, errors.New("certificate not found")
+	}
+	return k.cert, nil
+}
+
+func (k *certificateKMS) StoreCertificate(*kmsapi.StoreCertificateRequest) error {
+	return errors.New("not implemented")
+}
+
+func (k *certificateKMS) Close() error {
+	return nil
+}
+
+func TestSCEP_Init_decrypterCertificateFromKMS(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	cert, err := ca.Sign(&x509.Certificate{
+		PublicKey: key.Public(),
+		Subject:   pkix.Name{CommonName: "SCEP Decrypter"},
+	})
+	require.NoError(t, err)
+	km := &certificateKMS{key: key, cert: cert}
+
+	// The registry does not support removing a KMS, so the original one is
+	// restored, or replaced by one failing like an unregistered KMS.
+	fn, ok := kmsapi.LoadKeyManagerNewFunc(kmsapi.TPMKMS)
+	t.Cleanup(func() {
+		if ok {
+			kmsapi.Register(kmsapi.TPMKMS, fn)
+			return
+		}
+		kmsapi.Register(kmsapi.TPMKMS, func(ctx context.Context, opts kmsapi.Options) (kmsapi.KeyManager, error) {
+			return nil, fmt.Errorf("unsupported kms type '%s'", kmsapi.TPMKMS)
+		})
+	})
+	kmsapi.Register(kmsapi.TPMKMS, func(ctx context.Context, opts kmsapi.Options) (kmsapi.KeyManager, error) {
+		return km, nil
+	})
+
+	p := &SCEP{Name: "SCEP", Type: "SCEP", DecrypterKeyURI: "tpmkms:name=scep"}
+	require.NoError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+	decrypterCert, decrypter := p.GetDecrypter()
+	assert.Equal(t, cert, decrypterCert)
+	assert.Equal(t, key, decrypter)
+	signerCert, signer := p.GetSigner()
+	assert.Equal(t, cert, signerCert)
+	assert.Equal(t, key, signer)
+
+	p = &SCEP{Name: "SCEP", Type: "SCEP", DecrypterKeyURI: "tpmkms:name=missing"}
+	assert.EqualError(t, p.Init(Config{Claims: globalProvisionerClaims}), "failed loading decrypter certificate: certificate not found")
+}
@@ -22,6 +22,33 @@ import (
 
 var ErrWebhookDenied = errors.New("webhook server did not allow request")
 
+// WebhookKindDeviceAttestation is the kind of the webhooks called to approve
+// the devices attested in an acme device-attest-01 challenge.
+const WebhookKindDeviceAttestation = "DEVICEATTESTATION"
+
+// WebhookKindDeviceAttestationValue is the linkedca value of the device
+// attestation webhooks. The linkedca enum does not define it, so it takes the
+// next free value.
+const WebhookKindDeviceAttestationValue linkedca.Webhook_Kind = 5
+
+// WebhookKindName returns the name of the given linkedca webhook kind, it
+// supports the device attestation kind not defined by linkedca.
+func WebhookKindName(kind linkedca.Webhook_Kind) string {
+	if kind == WebhookKindDeviceAttestationValue {
+		return WebhookKindDeviceAttestation
+	}
+	return kind.String()
+}
+
+// WebhookKindValue returns the linkedca webhook kind with the given name, it
+// supports the device attestation kind not defined by linkedca.
+func WebhookKindValue(name string) linkedca.Webhook_Kind {
+	if name == WebhookKindDeviceAttestation {
+		return WebhookKindDeviceAttestationValue
+	}
+	return linkedca.Webhook_Kind(linkedca.Webhook_Kind_value[name])
+}
+
 type WebhookSetter interface {
 	SetWebhook(string, any)
 }
@@ -60,6 +87,9 @@ func (wc *WebhookController) Enrich(req *webhook.RequestBody) error {
 			return err
 		}
 		if !resp.Allow {
+			if resp.Decision != nil && resp.Decision.Reason != "" {
+				return fmt.Errorf("%w: %s", ErrWebhookDenied, resp.Decision.Reason)
+			}
 			return ErrWebhookDenied
 		}
 		wc.TemplateData.SetWebhook(wh.Name, resp.Data)
@@ -67,19 +97,42 @@ func (wc *WebhookController) Enrich(req *webhook.RequestBody) error {
 	return nil
 }
 
-// Authorize checks that all remote servers allow the request
+// Authorize checks that all remote servers allow the request. It fails if a
+// webhook returns modifications, as they cannot be applied to the request.
 func (wc *WebhookController) Authorize(req *webhook.RequestBody) error {
+	decisions, err := wc.AuthorizeX509(req)
+	if err != nil {
+		return err
+	}
+	if len(decisions) > 0 {
+		return errors.Errorf("webhook %s returned modifications that cannot be applied to this request", decisions[0].Webhook)
+	}
+	return nil
+}
+
+// WebhookDecision is a decision with modifications returned by an authorizing
+// webhook allowed to mutate certificates.
+type WebhookDecision struct {
+	Webhook string
+	*webhook.Decision
+}
+
+// AuthorizeX509 checks that all remote servers allow the request and returns
+// the decisions with modifications returned by the webhooks allowed to mutate
+// certificates. The modifications must be applied by the caller.
+func (wc *WebhookController) AuthorizeX509(req *webhook.RequestBody) ([]*WebhookDecision, error) {
 	if wc == nil {
-		return nil
+		return nil, nil
 	}
 
 	// Apply extra options in the webhook controller
 	for _, fn := range wc.options {
 		if err := fn(req); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
+	var decisions []*WebhookDecision
 	for _, wh := range wc.webhooks {
 		if wh.Kind != linkedca.Webhook_AUTHORIZING.String() {
 			continue
@@ -88,10 +141,50 @@ func (wc *WebhookController) Authorize(req *webhook.RequestBody) error {
 			continue
 		}
 		resp, err := wh.Do(wc.client, req, wc.TemplateData)
+		if err != nil {
+			return nil, err
+		}
+		if !resp.Allow {
+			if resp.Decision != nil && resp.Decision.Reason != "" {
+				return nil, fmt.Errorf("%w: %s", ErrWebhookDenied, resp.Decision.Reason)
+			}
+			return nil, ErrWebhookDenied
+		}
+		if resp.Decision.HasModifications() {
+			if !wh.AllowMutation {
+				return nil, errors.Errorf("webhook %s is not allowed to modify certificates", wh.Name)
+			}
+			decisions = append(decisions, &WebhookDecision{
+				Webhook:  wh.Name,
+				Decision: resp.Decision,
+			})
+		}
+	}
+	return decisions, nil
+}
+
+// AuthorizeDeviceAttestation checks that all the device attestation webhooks
+// allow the attested device.
+func (wc *WebhookController) AuthorizeDeviceAttestation(ctx context.Context, req *webhook.RequestBody) error {
+	if wc == nil {
+		return nil
+	}
+
+	for _, wh := range wc.webhooks {
+		if wh.Kind != WebhookKindDeviceAttestation {
+			continue
+		}
+		if !wc.isCertTypeOK(wh) {
+			continue
+		}
+		resp, err := wh.DoWithContext(ctx, wc.client, req, nil)
 		if err != nil {
 			return err
 		}
 		if !resp.Allow {
+			if resp.Decision != nil && resp.Decision.Reason != "" {
+				return fmt.Errorf("%w: %s", ErrWebhookDenied, resp.Decision.Reason)
+			}
 			return ErrWebhookDenied
 		}
 	}
@@ -115,9 +208,12 @@ type Webhook struct {
 	Kind                 string `json:"kind"`
 	DisableTLSClientAuth bool   `json:"disableTLSClientAuth,omitempty"`
 	CertType             string `json:"certType"`
-	Secret               string `json:"-"`
-	BearerToken          string `json:"-"`
-	BasicAuth            struct {
+	// AllowMutation allows an authorizing webhook to modify the subject
+	// alternative names and the lifetime of X.509 certificates.
+	AllowMutation bool   `json:"allowMutation,omitempty"`
+	Secret        string `json:"-"`
+	BearerToken   string `json:"-"`
+	BasicAuth     struct {
 		Username string
 		Password string
 	} `json:"-"`
@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"crypto/tls"
@@ -13,6 +14,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
@@ -212,6 +214,17 @@ func TestWebhookController_Enrich(t *testing.T) {
 			expectErr:          true,
 			expectTemplateData: x509util.TemplateData{},
 		},
+		"deny/with reason": {
+			ctl: &WebhookController{
+				client:       http.DefaultClient,
+				webhooks:     []*Webhook{{Name: "people", Kind: "ENRICHING"}},
+				TemplateData: x509util.TemplateData{},
+			},
+			req:                &webhook.RequestBody{},
+			responses:          []*webhook.ResponseBody{{Allow: false, Decision: &webhook.Decision{Reason: "unknown owner"}}},
+			expectErr:          true,
+			expectTemplateData: x509util.TemplateData{},
+		},
 		"fail/with options": {
 			ctl: &WebhookController{
 				client:       http.DefaultClient,
@@ -336,6 +349,15 @@ func TestWebhookController_Authorize(t *testing.T) {
 			responses: []*webhook.ResponseBody{{Allow: false}},
 			expectErr: true,
 		},
+		"fail/modifications": {
+			ctl: &WebhookController{
+				client:   http.DefaultClient,
+				webhooks: []*Webhook{{Name: "people", Kind: "AUTHORIZING", AllowMutation: true}},
+			},
+			req:       &webhook.RequestBody{},
+			responses: []*webhook.ResponseBody{{Allow: true, Decision: &webhook.Decision{SANs: []string{"foo.internal"}}}},
+			expectErr: true,
+		},
 	}
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -361,6 +383,169 @@ func TestWebhookController_Authorize(t *testing.T) {
 	}
 }
 
+func TestWebhookController_AuthorizeX509(t *testing.T) {
+	notAfter := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	type test struct {
+		webhooks  []*Webhook
+		responses []*webhook.ResponseBody
+		want      []*WebhookDecision
+		wantErr   error
+	}
+	tests := map[string]test{
+		"ok/no decision": {
+			webhooks:  []*Webhook{{Name: "people", Kind: "AUTHORIZING"}},
+			responses: []*webhook.ResponseBody{{Allow: true}},
+		},
+		"ok/reason only": {
+			webhooks:  []*Webhook{{Name: "people", Kind: "AUTHORIZING"}},
+			responses: []*webhook.ResponseBody{{Allow: true, Decision: &webhook.Decision{Reason: "looks good"}}},
+		},
+		"ok/modifications": {
+			webhooks: []*Webhook{
+				{Name: "people", Kind: "AUTHORIZING"},
+				{Name: "inventory", Kind: "AUTHORIZING", AllowMutation: true},
+			},
+			responses: []*webhook.ResponseBody{
+				{Allow: true},
+				{Allow: true, Decision: &webhook.Decision{Reason: "not in inventory", SANs: []string{"foo.internal"}, NotAfter: notAfter}},
+			},
+			want: []*WebhookDecision{{
+				Webhook:  "inventory",
+				Decision: &webhook.Decision{Reason: "not in inventory", SANs: []string{"foo.internal"}, NotAfter: notAfter},
+			}},
+		},
+		"fail/deny with reason": {
+			webhooks:  []*Webhook{{Name: "people", Kind: "AUTHORIZING"}},
+			responses: []*webhook.ResponseBody{{Allow: false, Decision: &webhook.Decision{Reason: "device is not managed"}}},
+			wantErr:   fmt.Errorf("%w: device is not managed", ErrWebhookDenied),
+		},
+		"fail/mutation not allowed": {
+			webhooks:  []*Webhook{{Name: "people", Kind: "AUTHORIZING"}},
+			responses: []*webhook.ResponseBody{{Allow: true, Decision: &webhook.Decision{NotAfter: notAfter}}},
+			wantErr:   errors.New("webhook people is not allowed to modify certificates"),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for i, wh := range test.webhooks {
+				var j = i
+				ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					err := json.NewEncoder(w).Encode(test.responses[j])
+					assert.FatalError(t, err)
+				}))
+				// nolint: gocritic // defer in loop isn't a memory leak
+				defer ts.Close()
+				wh.URL = ts.URL
+			}
+
+			wc := &WebhookController{client: http.DefaultClient, webhooks: test.webhooks}
+			got, err := wc.AuthorizeX509(&webhook.RequestBody{})
+			if test.wantErr != nil {
+				if assert.Error(t, err) {
+					assert.Equals(t, test.wantErr.Error(), err.Error())
+					assert.True(t, errors.Is(err, ErrWebhookDenied) == errors.Is(test.wantErr, ErrWebhookDenied))
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equals(t, test.want, got)
+		})
+	}
+}
+
+func TestWebhookController_AuthorizeDeviceAttestation(t *testing.T) {
+	data := &webhook.DeviceAttestationData{
+		Format:               "apple",
+		Identifier:           "serial-number",
+		PermanentIdentifiers: []string{"udid", "serial-number"},
+		SerialNumber:         "serial-number",
+		UDID:                 "udid",
+		Fingerprint:          "fingerprint",
+	}
+	type test struct {
+		webhooks  []*Webhook
+		responses []*webhook.ResponseBody
+		wantErr   error
+	}
+	tests := map[string]test{
+		"ok/no device attestation webhooks": {
+			webhooks:  []*Webhook{{Name: "people", Kind: "AUTHORIZING"}},
+			responses: []*webhook.ResponseBody{{Allow: false}},
+		},
+		"ok": {
+			webhooks: []*Webhook{
+				{Name: "inventory", Kind: WebhookKindDeviceAttestation},
+				{Name: "assets", Kind: WebhookKindDeviceAttestation},
+			},
+			responses: []*webhook.ResponseBody{{Allow: true}, {Allow: true}},
+		},
+		"fail/deny": {
+			webhooks: []*Webhook{
+				{Name: "inventory", Kind: WebhookKindDeviceAttestation},
+				{Name: "assets", Kind: WebhookKindDeviceAttestation},
+			},
+			responses: []*webhook.ResponseBody{{Allow: true}, {Allow: false}},
+			wantErr:   ErrWebhookDenied,
+		},
+		"fail/deny with reason": {
+			webhooks:  []*Webhook{{Name: "inventory", Kind: WebhookKindDeviceAttestation}},
+			responses: []*webhook.ResponseBody{{Allow: false, Decision: &webhook.Decision{Reason: "device is not in inventory"}}},
+			wantErr:   fmt.Errorf("%w: device is not in inventory", ErrWebhookDenied),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for i, wh := range test.webhooks {
+				var j = i
+				ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var req webhook.RequestBody
+					assert.FatalError(t, json.NewDecoder(r.Body).Decode(&req))
+					assert.Equals(t, data, req.DeviceAttestationData)
+					err := json.NewEncoder(w).Encode(test.responses[j])
+					assert.FatalError(t, err)
+				}))
+				// nolint: gocritic // defer in loop isn't a memory leak
+				defer ts.Close()
+				wh.URL = ts.URL
+			}
+
+			wc := &WebhookController{client: http.DefaultClient, webhooks: test.webhooks, certType: linkedca.Webhook_X509}
+			req, err := webhook.NewRequestBody(webhook.WithDeviceAttestationData(data))
+			assert.FatalError(t, err)
+			err = wc.AuthorizeDeviceAttestation(context.Background(), req)
+			if test.wantErr != nil {
+				if assert.Error(t, err) {
+					assert.Equals(t, test.wantErr.Error(), err.Error())
+					assert.True(t, errors.Is(err, ErrWebhookDenied))
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWebhookKind(t *testing.T) {
+	tests := []struct {
+		name string
+		kind linkedca.Webhook_Kind
+	}{
+		{"NO_KIND", linkedca.Webhook_NO_KIND},
+		{"ENRICHING", linkedca.Webhook_ENRICHING},
+		{"AUTHORIZING", linkedca.Webhook_AUTHORIZING},
+		{"SCEPCHALLENGE", linkedca.Webhook_SCEPCHALLENGE},
+		{"NOTIFYING", linkedca.Webhook_NOTIFYING},
+		{"DEVICEATTESTATION", WebhookKindDeviceAttestationValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.name, WebhookKindName(tt.kind))
+			assert.Equals(t, tt.kind, WebhookKindValue(tt.name))
+		})
+	}
+	assert.Equals(t, linkedca.Webhook_NO_KIND, WebhookKindValue("UNSUPPORTED"))
+}
+
 func TestWebhook_Do(t *testing.T) {
 	csr := parseCertificateRequest(t, "testdata/certs/ecdsa.csr")
 	type test struct {
@@ -26,18 +26,34 @@ type x5cPayload struct {
 	chains [][]*x509.Certificate
 }
 
+// ChainLifetimePolicy defines which certificates of the x5c chain bound the
+// validity of the certificates issued by an X5C provisioner.
+type ChainLifetimePolicy string
+
+const (
+	// ChainLifetimeLeaf limits the validity of the issued certificates to the
+	// validity of the leaf in the x5c chain. This is the default.
+	ChainLifetimeLeaf ChainLifetimePolicy = "leaf"
+	// ChainLifetimeChain limits the validity of the issued certificates to the
+	// validity of all the certificates in the x5c chain, including the
+	// intermediates and the root. Use it when the issued certificates are used
+	// for delegation, so they cannot outlive any of their issuers.
+	ChainLifetimeChain ChainLifetimePolicy = "chain"
+)
+
 // X5C is the default provisioner, an entity that can sign tokens necessary for
 // signature requests.
 type X5C struct {
 	*base
-	ID       string   `json:"-"`
-	Type     string   `json:"type"`
-	Name     string   `json:"name"`
-	Roots    []byte   `json:"roots"`
-	Claims   *Claims  `json:"claims,omitempty"`
-	Options  *Options `json:"options,omitempty"`
-	ctl      *Controller
-	rootPool *x509.CertPool
+	ID            string              `json:"-"`
+	Type          string              `json:"type"`
+	Name          string              `json:"name"`
+	Roots         []byte              `json:"roots"`
+	ChainLifetime ChainLifetimePolicy `json:"chainLifetime,omitempty"`
+	Claims        *Claims             `json:"claims,omitempty"`
+	Options       *Options            `json:"options,omitempty"`
+	ctl           *Controller
+	rootPool      *x509.CertPool
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -99,6 +115,12 @@ func (p *X5C) Init(config Config) (err error) {
 		return errors.New("provisioner root(s) cannot be empty")
 	}
 
+	switch p.ChainLifetime {
+	case "", ChainLifetimeLeaf, ChainLifetimeChain:
+	default:
+		return errors.Errorf("provisioner chainLifetime %q is not supported", p.ChainLifetime)
+	}
+
 	p.rootPool = x509.NewCertPool()
 
 	var (
@@ -186,6 +208,32 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 	return &claims, nil
 }
 
+// chainNotAfter returns the time after which the certificates issued using the
+// given verified chains cannot be valid. By default this is the expiration of
+// the leaf, but if the chain lifetime policy is enforced, it is the earliest
+// expiration in the chain. If there are multiple valid chains, the one that
+// lasts the longest is used.
+func (p *X5C) chainNotAfter(chains [][]*x509.Certificate) time.Time {
+	leaf := chains[0][0]
+	if p.ChainLifetime != ChainLifetimeChain {
+		return leaf.NotAfter
+	}
+
+	var notAfter time.Time
+	for _, chain := range chains {
+		t := leaf.NotAfter
+		for _, crt := range chain {
+			if crt.NotAfter.Before(t) {
+				t = crt.NotAfter
+			}
+		}
+		if t.After(notAfter) {
+			notAfter = t
+		}
+	}
+	return notAfter
+}
+
 // AuthorizeRevoke returns an error if the provisioner does not have rights to
 // revoke the certificate with serial number in the `sub` property.
 func (p *X5C) AuthorizeRevoke(_ context.Context, token string) error {
@@ -240,7 +288,7 @@ func (p *X5C) AuthorizeSign(_ context.Context, token string) ([]SignOption, erro
 		newProvisionerExtensionOption(TypeX5C, p.Name, "").WithControllerOptions(p.ctl),
 		profileLimitDuration{
 			p.ctl.Claimer.DefaultTLSCertDuration(),
-			x5cLeaf.NotBefore, x5cLeaf.NotAfter,
+			x5cLeaf.NotBefore, p.chainNotAfter(claims.chains),
 		},
 		// validators
 		commonNameValidator(claims.Subject),
@@ -333,7 +381,7 @@ func (p *X5C) AuthorizeSSHSign(_ context.Context, token string) ([]SignOption, e
 	return append(signOptions,
 		p,
 		// Checks the validity bounds, and set the validity if has not been set.
-		&sshLimitDuration{p.ctl.Claimer, x5cLeaf.NotAfter},
+		&sshLimitDuration{p.ctl.Claimer, p.chainNotAfter(claims.chains)},
 		// Validate public key.
 		&sshDefaultPublicKeyValidator{},
 		// Validate the validity period.
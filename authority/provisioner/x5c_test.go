@@ -86,6 +86,15 @@ func TestX5C_Init(t *testing.T) {
 				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
 			}
 		},
+		"fail/chain-lifetime": func(t *testing.T) ProvisionerValidateTest {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.ChainLifetime = "foo"
+			return ProvisionerValidateTest{
+				p:   p,
+				err: errors.New(`provisioner chainLifetime "foo" is not supported`),
+			}
+		},
 		"ok": func(t *testing.T) ProvisionerValidateTest {
 			p, err := generateX5C(nil)
 			assert.FatalError(t, err)
@@ -93,6 +102,14 @@ func TestX5C_Init(t *testing.T) {
 				p: p,
 			}
 		},
+		"ok/chain-lifetime": func(t *testing.T) ProvisionerValidateTest {
+			p, err := generateX5C(nil)
+			assert.FatalError(t, err)
+			p.ChainLifetime = ChainLifetimeChain
+			return ProvisionerValidateTest{
+				p: p,
+			}
+		},
 		"ok/root-chain": func(t *testing.T) ProvisionerValidateTest {
 			p, err := generateX5C([]byte(`-----BEGIN CERTIFICATE-----
 MIIBtjCCAVygAwIBAgIQNr+f4IkABY2n4wx4sLOMrTAKBggqhkjOPQQDAjAUMRIw
@@ -157,6 +174,38 @@ M46l92gdOozT
 	}
 }
 
+func TestX5C_chainNotAfter(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	leaf := &x509.Certificate{NotAfter: now.Add(24 * time.Hour)}
+	shortIntermediate := &x509.Certificate{NotAfter: now.Add(time.Hour)}
+	longIntermediate := &x509.Certificate{NotAfter: now.Add(48 * time.Hour)}
+	shortRoot := &x509.Certificate{NotAfter: now.Add(2 * time.Hour)}
+	longRoot := &x509.Certificate{NotAfter: now.Add(72 * time.Hour)}
+
+	tests := []struct {
+		name   string
+		policy ChainLifetimePolicy
+		chains [][]*x509.Certificate
+		want   time.Time
+	}{
+		{"ok/default", "", [][]*x509.Certificate{{leaf, shortIntermediate, longRoot}}, leaf.NotAfter},
+		{"ok/leaf", ChainLifetimeLeaf, [][]*x509.Certificate{{leaf, shortIntermediate, longRoot}}, leaf.NotAfter},
+		{"ok/chain-intermediate", ChainLifetimeChain, [][]*x509.Certificate{{leaf, shortIntermediate, longRoot}}, shortIntermediate.NotAfter},
+		{"ok/chain-root", ChainLifetimeChain, [][]*x509.Certificate{{leaf, longIntermediate, shortRoot}}, shortRoot.NotAfter},
+		{"ok/chain-leaf", ChainLifetimeChain, [][]*x509.Certificate{{leaf, longIntermediate, longRoot}}, leaf.NotAfter},
+		{"ok/chain-multiple", ChainLifetimeChain, [][]*x509.Certificate{
+			{leaf, shortIntermediate, longRoot},
+			{leaf, longIntermediate, shortRoot},
+		}, shortRoot.NotAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &X5C{ChainLifetime: tt.policy}
+			assert.Equals(t, tt.want, p.chainNotAfter(tt.chains))
+		})
+	}
+}
+
 func TestX5C_authorizeToken(t *testing.T) {
 	x5cCerts, err := pemutil.ReadCertificateBundle("./testdata/certs/x5c-leaf.crt")
 	assert.FatalError(t, err)
@@ -499,7 +548,7 @@ func TestX5C_AuthorizeSign(t *testing.T) {
 							case *WebhookController:
 								assert.Len(t, 0, v.webhooks)
 								assert.Equals(t, linkedca.Webhook_X509, v.certType)
-								assert.Len(t, 2, v.options)
+								assert.Len(t, 3, v.options)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
@@ -805,7 +854,7 @@ func TestX5C_AuthorizeSSHSign(t *testing.T) {
 							case *WebhookController:
 								assert.Len(t, 0, v.webhooks)
 								assert.Equals(t, linkedca.Webhook_SSH, v.certType)
-								assert.Len(t, 2, v.options)
+								assert.Len(t, 3, v.options)
 							default:
 								assert.FatalError(t, fmt.Errorf("unexpected sign option of type %T", v))
 							}
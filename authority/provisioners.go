@@ -202,6 +202,7 @@ func (a *Authority) generateProvisionerConfig(ctx context.Context) (provisioner.
 		AuthorizeRenewFunc:    a.authorizeRenewFunc,
 		AuthorizeSSHRenewFunc: a.authorizeSSHRenewFunc,
 		WebhookClient:         a.webhookClient,
+		UseSCEPChallengeFunc:  a.useSCEPChallenge,
 	}, nil
 }
 
@@ -284,7 +285,7 @@ func (a *Authority) UpdateProvisioner(ctx context.Context, nu *linkedca.Provisio
 	}
 
 	if err := certProv.Init(provisionerConfig); err != nil {
-		return admin.WrapErrorISE(err, "error initializing provisioner %s", nu.Name)
+		return admin.WrapError(admin.ErrorBadRequestType, err, "error validating configuration for provisioner %q", nu.Name)
 	}
 
 	if err := a.provisioners.Update(certProv); err != nil {
@@ -501,6 +502,7 @@ func optionsToCertificates(p *linkedca.Provisioner) *provisioner.Options {
 		if x := pol.GetX509(); x != nil {
 			if allow := x.GetAllow(); allow != nil {
 				ops.X509.AllowedNames = &policy.X509NameOptions{
+					CommonNames:    allow.CommonNames,
 					DNSDomains:     allow.Dns,
 					IPRanges:       allow.Ips,
 					EmailAddresses: allow.Emails,
@@ -509,12 +511,14 @@ func optionsToCertificates(p *linkedca.Provisioner) *provisioner.Options {
 			}
 			if deny := x.GetDeny(); deny != nil {
 				ops.X509.DeniedNames = &policy.X509NameOptions{
+					CommonNames:    deny.CommonNames,
 					DNSDomains:     deny.Dns,
 					IPRanges:       deny.Ips,
 					EmailAddresses: deny.Emails,
 					URIDomains:     deny.Uris,
 				}
 			}
+			ops.X509.AllowWildcardNames = x.GetAllowWildcardNames()
 		}
 		if ssh := pol.GetSsh(); ssh != nil {
 			if host := ssh.GetHost(); host != nil {
@@ -563,7 +567,7 @@ func webhookToCertificates(wh *linkedca.Webhook) *provisioner.Webhook {
 		ID:                   wh.Id,
 		Name:                 wh.Name,
 		URL:                  wh.Url,
-		Kind:                 wh.Kind.String(),
+		Kind:                 provisioner.WebhookKindName(wh.Kind),
 		Secret:               wh.Secret,
 		DisableTLSClientAuth: wh.DisableTlsClientAuth,
 		CertType:             wh.CertType.String(),
@@ -585,7 +589,7 @@ func provisionerWebhookToLinkedca(pwh *provisioner.Webhook) *linkedca.Webhook {
 		Id:                   pwh.ID,
 		Name:                 pwh.Name,
 		Url:                  pwh.URL,
-		Kind:                 linkedca.Webhook_Kind(linkedca.Webhook_Kind_value[pwh.Kind]),
+		Kind:                 provisioner.WebhookKindValue(pwh.Kind),
 		Secret:               pwh.Secret,
 		DisableTlsClientAuth: pwh.DisableTLSClientAuth,
 		CertType:             linkedca.Webhook_CertType(linkedca.Webhook_CertType_value[pwh.CertType]),
@@ -1016,6 +1020,34 @@ func ProvisionerToCertificates(p *linkedca.Provisioner) (provisioner.Interface,
 	}
 }
 
+// provisionerPolicyToLinkedca converts the X.509 name policy in the provisioner
+// options to a linkedca.Policy. URI schemes are not supported by linkedca and
+// are not converted.
+func provisionerPolicyToLinkedca(p *provisioner.Options) *linkedca.Policy {
+	if p == nil || p.X509 == nil || (p.X509.AllowedNames == nil && p.X509.DeniedNames == nil) {
+		return nil
+	}
+	x509NamesToLinkedca := func(o *policy.X509NameOptions) *linkedca.X509Names {
+		if o == nil {
+			return nil
+		}
+		return &linkedca.X509Names{
+			CommonNames: o.CommonNames,
+			Dns:         o.DNSDomains,
+			Ips:         o.IPRanges,
+			Emails:      o.EmailAddresses,
+			Uris:        o.URIDomains,
+		}
+	}
+	return &linkedca.Policy{
+		X509: &linkedca.X509Policy{
+			Allow:              x509NamesToLinkedca(p.X509.AllowedNames),
+			Deny:               x509NamesToLinkedca(p.X509.DeniedNames),
+			AllowWildcardNames: p.X509.AllowWildcardNames,
+		},
+	}
+}
+
 // ProvisionerToLinkedca converts a provisioner.Interface to a
 // linkedca.Provisioner type.
 func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, error) {
@@ -1045,6 +1077,7 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			X509Template: x509Template,
 			SshTemplate:  sshTemplate,
 			Webhooks:     webhooks,
+			Policy:       provisionerPolicyToLinkedca(p.Options),
 		}, nil
 	case *provisioner.OIDC:
 		x509Template, sshTemplate, webhooks, err := provisionerOptionsToLinkedca(p.Options)
@@ -1073,6 +1106,7 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			X509Template: x509Template,
 			SshTemplate:  sshTemplate,
 			Webhooks:     webhooks,
+			Policy:       provisionerPolicyToLinkedca(p.Options),
 		}, nil
 	case *provisioner.GCP:
 		x509Template, sshTemplate, webhooks, err := provisionerOptionsToLinkedca(p.Options)
@@ -1098,6 +1132,7 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			X509Template: x509Template,
 			SshTemplate:  sshTemplate,
 			Webhooks:     webhooks,
+			Policy:       provisionerPolicyToLinkedca(p.Options),
 		}, nil
 	case *provisioner.AWS:
 		x509Template, sshTemplate, webhooks, err := provisionerOptionsToLinkedca(p.Options)
@@ -1122,6 +1157,7 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			X509Template: x509Template,
 			SshTemplate:  sshTemplate,
 			Webhooks:     webhooks,
+			Policy:       provisionerPolicyToLinkedca(p.Options),
 		}, nil
 	case *provisioner.Azure:
 		x509Template, sshTemplate, webhooks, err := provisionerOptionsToLinkedca(p.Options)
@@ -1149,6 +1185,7 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			X509Template: x509Template,
 			SshTemplate:  sshTemplate,
 			Webhooks:     webhooks,
+			Policy:       provisionerPolicyToLinkedca(p.Options),
 		}, nil
 	case *provisioner.ACME:
 		x509Template, sshTemplate, webhooks, err := provisionerOptionsToLinkedca(p.Options)
@@ -1177,6 +1214,7 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			X509Template: x509Template,
 			SshTemplate:  sshTemplate,
 			Webhooks:     webhooks,
+			Policy:       provisionerPolicyToLinkedca(p.Options),
 		}, nil
 	case *provisioner.X5C:
 		x509Template, sshTemplate, webhooks, err := provisionerOptionsToLinkedca(p.Options)
@@ -1198,6 +1236,7 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			X509Template: x509Template,
 			SshTemplate:  sshTemplate,
 			Webhooks:     webhooks,
+			Policy:       provisionerPolicyToLinkedca(p.Options),
 		}, nil
 	case *provisioner.K8sSA:
 		x509Template, sshTemplate, webhooks, err := provisionerOptionsToLinkedca(p.Options)
@@ -1219,6 +1258,7 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			X509Template: x509Template,
 			SshTemplate:  sshTemplate,
 			Webhooks:     webhooks,
+			Policy:       provisionerPolicyToLinkedca(p.Options),
 		}, nil
 	case *provisioner.SSHPOP:
 		return &linkedca.Provisioner{
@@ -1264,6 +1304,7 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			X509Template: x509Template,
 			SshTemplate:  sshTemplate,
 			Webhooks:     webhooks,
+			Policy:       provisionerPolicyToLinkedca(p.Options),
 		}, nil
 	case *provisioner.Nebula:
 		x509Template, sshTemplate, webhooks, err := provisionerOptionsToLinkedca(p.Options)
@@ -1285,6 +1326,7 @@ func ProvisionerToLinkedca(p provisioner.Interface) (*linkedca.Provisioner, erro
 			X509Template: x509Template,
 			SshTemplate:  sshTemplate,
 			Webhooks:     webhooks,
+			Policy:       provisionerPolicyToLinkedca(p.Options),
 		}, nil
 	default:
 		return nil, fmt.Errorf("provisioner %s not implemented", p.GetType())
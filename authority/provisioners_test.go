@@ -18,6 +18,7 @@ import (
 	"github.com/smallstep/assert"
 	"github.com/smallstep/certificates/api/render"
 	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/policy"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
 )
@@ -135,6 +136,31 @@ func TestGetProvisioners(t *testing.T) {
 	}
 }
 
+func TestAuthority_UpdateProvisioner_invalidConfig(t *testing.T) {
+	a := testAuthority(t)
+	err := a.UpdateProvisioner(context.Background(), &linkedca.Provisioner{
+		Id:   "scep-id",
+		Type: linkedca.Provisioner_SCEP,
+		Name: "scep",
+		Details: &linkedca.ProvisionerDetails{
+			Data: &linkedca.ProvisionerDetails_SCEP{
+				SCEP: &linkedca.SCEPProvisioner{
+					Challenge: "new-password",
+					Decrypter: &linkedca.SCEPDecrypter{
+						Key: []byte("not a key"),
+					},
+				},
+			},
+		},
+	})
+
+	var adminErr *admin.Error
+	if assert.True(t, errors.As(err, &adminErr)) {
+		assert.Equals(t, http.StatusBadRequest, adminErr.StatusCode())
+		assert.HasPrefix(t, err.Error(), `error validating configuration for provisioner "scep"`)
+	}
+}
+
 func TestAuthority_LoadProvisionerByCertificate(t *testing.T) {
 	_, priv, err := keyutil.GenerateDefaultKeyPair()
 	require.NoError(t, err)
@@ -340,6 +366,58 @@ func TestProvisionerWebhookToLinkedca(t *testing.T) {
 	}
 }
 
+func TestProvisionerPolicyToLinkedca(t *testing.T) {
+	type test struct {
+		lp *linkedca.Policy
+		po *provisioner.Options
+	}
+	tests := map[string]test{
+		"empty": {
+			lp: nil,
+			po: &provisioner.Options{X509: &provisioner.X509Options{}, SSH: &provisioner.SSHOptions{}},
+		},
+		"allow and deny": {
+			lp: &linkedca.Policy{
+				X509: &linkedca.X509Policy{
+					Allow: &linkedca.X509Names{
+						CommonNames: []string{"bu1"},
+						Dns:         []string{"*.bu1.example.com"},
+						Ips:         []string{"10.0.0.0/8"},
+						Emails:      []string{"@bu1.example.com"},
+						Uris:        []string{"*.bu1.example.com"},
+					},
+					Deny: &linkedca.X509Names{
+						Dns: []string{"admin.bu1.example.com"},
+					},
+					AllowWildcardNames: true,
+				},
+			},
+			po: &provisioner.Options{
+				X509: &provisioner.X509Options{
+					AllowedNames: &policy.X509NameOptions{
+						CommonNames:    []string{"bu1"},
+						DNSDomains:     []string{"*.bu1.example.com"},
+						IPRanges:       []string{"10.0.0.0/8"},
+						EmailAddresses: []string{"@bu1.example.com"},
+						URIDomains:     []string{"*.bu1.example.com"},
+					},
+					DeniedNames: &policy.X509NameOptions{
+						DNSDomains: []string{"admin.bu1.example.com"},
+					},
+					AllowWildcardNames: true,
+				},
+				SSH: &provisioner.SSHOptions{},
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equals(t, test.lp, provisionerPolicyToLinkedca(test.po))
+			assert.Equals(t, test.po, optionsToCertificates(&linkedca.Provisioner{Policy: test.lp}))
+		})
+	}
+}
+
 func Test_wrapRAProvisioner(t *testing.T) {
 	type args struct {
 		p      provisioner.Interface
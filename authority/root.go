@@ -42,6 +42,16 @@ func (a *Authority) GetRoots() ([]*x509.Certificate, error) {
 	return a.rootX509Certs, nil
 }
 
+// GetIntermediates returns the intermediate certificates used to sign the
+// certificates issued by the CA, starting with the issuer.
+// This method implements the Authority interface.
+func (a *Authority) GetIntermediates() ([]*x509.Certificate, error) {
+	if len(a.intermediateX509Certs) == 0 {
+		return nil, errs.NotFound("intermediate certificates are not available")
+	}
+	return a.intermediateX509Certs, nil
+}
+
 // GetFederation returns all the root certificates in the federation.
 // This method implements the Authority interface.
 func (a *Authority) GetFederation() (federation []*x509.Certificate, err error) {
@@ -0,0 +1,159 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/authority/admin"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+const (
+	// scepChallengeLength is the length of the generated SCEP one-time
+	// challenges.
+	scepChallengeLength = 32
+
+	// scepChallengeCleanupInterval is the interval between the deletions of
+	// the SCEP one-time challenges no longer usable.
+	scepChallengeCleanupInterval = time.Hour
+
+	// scepChallengeRetention is the time the SCEP one-time challenges are kept
+	// after they expire, are used, or are revoked.
+	scepChallengeRetention = 24 * time.Hour
+)
+
+// CreateSCEPChallenge generates and stores a one-time challenge for the SCEP
+// provisioner with the given name. The challenge can be used once to enroll a
+// device before it expires. If expiresAt is zero, the challenge lifetime of
+// the provisioner is used. The reference is an optional name used to link the
+// challenge to an external system.
+func (a *Authority) CreateSCEPChallenge(_ context.Context, provisionerName, reference string, expiresAt time.Time) (string, *db.SCEPChallenge, error) {
+	prov, challengeDB, err := a.loadSCEPChallengeProvisioner(provisionerName)
+	if err != nil {
+		return "", nil, err
+	}
+	lifetime := prov.GetChallengeLifetime()
+	if lifetime == 0 {
+		return "", nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s does not have one-time challenges enabled", provisionerName)
+	}
+
+	challenge, err := randutil.Alphanumeric(scepChallengeLength)
+	if err != nil {
+		return "", nil, admin.WrapErrorISE(err, "error generating SCEP challenge")
+	}
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(lifetime)
+	}
+	sc, err := challengeDB.StoreSCEPChallenge(prov.GetID(), challenge, reference, expiresAt.UTC().Truncate(time.Second))
+	if err != nil {
+		return "", nil, admin.WrapErrorISE(err, "error storing SCEP challenge")
+	}
+	return challenge, sc, nil
+}
+
+// GetSCEPChallenges returns a page of the one-time challenges of the SCEP
+// provisioner with the given name, and the cursor of the next page.
+func (a *Authority) GetSCEPChallenges(_ context.Context, provisionerName, cursor string, limit int) ([]*db.SCEPChallenge, string, error) {
+	prov, challengeDB, err := a.loadSCEPChallengeProvisioner(provisionerName)
+	if err != nil {
+		return nil, "", err
+	}
+	challenges, nextCursor, err := challengeDB.GetSCEPChallenges(prov.GetID(), cursor, limit)
+	if err != nil {
+		return nil, "", admin.WrapErrorISE(err, "error retrieving SCEP challenges")
+	}
+	return challenges, nextCursor, nil
+}
+
+// RevokeSCEPChallenge revokes the one-time challenge with the given ID of the
+// SCEP provisioner with the given name. Challenges that have already been
+// used cannot be revoked.
+func (a *Authority) RevokeSCEPChallenge(_ context.Context, provisionerName, id string) (*db.SCEPChallenge, error) {
+	prov, challengeDB, err := a.loadSCEPChallengeProvisioner(provisionerName)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := challengeDB.RevokeSCEPChallenge(prov.GetID(), id)
+	switch {
+	case database.IsErrNotFound(err):
+		return nil, admin.NewError(admin.ErrorNotFoundType, "SCEP challenge %s not found", id)
+	case errors.Is(err, db.ErrSCEPChallengeUsed):
+		return nil, admin.NewError(admin.ErrorBadRequestType, "SCEP challenge %s has already been used", id)
+	case err != nil:
+		return nil, admin.WrapErrorISE(err, "error revoking SCEP challenge %s", id)
+	default:
+		return sc, nil
+	}
+}
+
+func (a *Authority) loadSCEPChallengeProvisioner(provisionerName string) (*provisioner.SCEP, db.SCEPChallengeDB, error) {
+	p, err := a.LoadProvisionerByName(provisionerName)
+	if err != nil {
+		return nil, nil, err
+	}
+	prov, ok := p.(*provisioner.SCEP)
+	if !ok {
+		return nil, nil, admin.NewError(admin.ErrorBadRequestType, "provisioner %s is not a SCEP provisioner", provisionerName)
+	}
+	challengeDB, ok := a.db.(db.SCEPChallengeDB)
+	if !ok {
+		return nil, nil, admin.NewError(admin.ErrorNotImplementedType, "database does not support SCEP one-time challenges")
+	}
+	return prov, challengeDB, nil
+}
+
+// useSCEPChallenge consumes a one-time challenge of the given SCEP
+// provisioner. It implements provisioner.UseSCEPChallengeFunc.
+func (a *Authority) useSCEPChallenge(_ context.Context, p provisioner.Interface, csr *x509.CertificateRequest, challenge, transactionID string) (bool, error) {
+	challengeDB, ok := a.db.(db.SCEPChallengeDB)
+	if !ok {
+		return false, nil
+	}
+	var subject string
+	if csr != nil {
+		subject = csr.Subject.String()
+	}
+	return challengeDB.UseSCEPChallenge(p.GetID(), challenge, transactionID, subject)
+}
+
+// startSCEPChallengeCleaner starts the periodic deletion of the SCEP one-time
+// challenges that expired, were used, or were revoked more than
+// scepChallengeRetention ago.
+func (a *Authority) startSCEPChallengeCleaner() {
+	challengeDB, ok := a.db.(db.SCEPChallengeDB)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(scepChallengeCleanupInterval)
+	stopper := make(chan struct{}, 1)
+	a.scepChallengeTicker, a.scepChallengeStopper = ticker, stopper
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := challengeDB.DeleteSCEPChallenges(time.Now().Add(-scepChallengeRetention)); err != nil {
+					log.Printf("error deleting SCEP challenges: %v", err)
+				}
+			case <-stopper:
+				return
+			}
+		}
+	}()
+}
+
+func (a *Authority) stopSCEPChallengeCleaner() {
+	if a.scepChallengeTicker != nil {
+		a.scepChallengeTicker.Stop()
+		close(a.scepChallengeStopper)
+		a.scepChallengeTicker, a.scepChallengeStopper = nil, nil
+	}
+}
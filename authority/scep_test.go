@@ -0,0 +1,143 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/smallstep/nosql/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/db"
+)
+
+func TestAuthority_CreateSCEPChallenge(t *testing.T) {
+	challenges := map[string]*db.SCEPChallenge{}
+	mockDB := &db.MockAuthDB{
+		MStoreSCEPChallenge: func(provisionerID, value, reference string, expiresAt time.Time) (*db.SCEPChallenge, error) {
+			sc := &db.SCEPChallenge{ID: "id-" + value, ProvisionerID: provisionerID, Reference: reference, ExpiresAt: expiresAt}
+			challenges[value] = sc
+			return sc, nil
+		},
+		MUseSCEPChallenge: func(provisionerID, value, transactionID, subject string) (bool, error) {
+			c, ok := challenges[value]
+			if !ok || !c.UsedAt.IsZero() || c.ProvisionerID != provisionerID || !time.Now().Before(c.ExpiresAt) {
+				return false, nil
+			}
+			c.UsedAt = time.Now()
+			c.TransactionID = transactionID
+			c.Subject = subject
+			return true, nil
+		},
+	}
+
+	ctx := context.Background()
+	a := testAuthority(t, WithDatabase(mockDB))
+	config, err := a.generateProvisionerConfig(ctx)
+	require.NoError(t, err)
+	for _, p := range []provisioner.Interface{
+		&provisioner.SCEP{Name: "scep", Type: "SCEP", DynamicChallenge: &provisioner.SCEPDynamicChallenge{
+			Lifetime: &provisioner.Duration{Duration: 10 * time.Minute},
+		}},
+		&provisioner.SCEP{Name: "scep-static", Type: "SCEP", ChallengePassword: "password"},
+	} {
+		require.NoError(t, p.Init(config))
+		require.NoError(t, a.provisioners.Store(p))
+	}
+
+	value, sc, err := a.CreateSCEPChallenge(ctx, "scep", "device-1", time.Time{})
+	require.NoError(t, err)
+	assert.Len(t, value, scepChallengeLength)
+	assert.Equal(t, "device-1", sc.Reference)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), sc.ExpiresAt, 2*time.Second)
+
+	// The challenge can only be used once, and the device using it is recorded.
+	p, err := a.LoadProvisionerByName("scep")
+	require.NoError(t, err)
+	scepProv := p.(*provisioner.SCEP)
+	csr := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device-1"}}
+	assert.NoError(t, scepProv.ValidateChallenge(ctx, csr, value, "transaction-1"))
+	assert.EqualError(t, scepProv.ValidateChallenge(ctx, nil, value, "transaction-2"), "invalid challenge password provided")
+	assert.Equal(t, "transaction-1", sc.TransactionID)
+	assert.Equal(t, "CN=device-1", sc.Subject)
+
+	// The expiration can be set explicitly.
+	expiresAt := time.Now().Add(24 * time.Hour)
+	_, sc, err = a.CreateSCEPChallenge(ctx, "scep", "", expiresAt)
+	require.NoError(t, err)
+	assert.Equal(t, expiresAt.UTC().Truncate(time.Second), sc.ExpiresAt)
+
+	_, _, err = a.CreateSCEPChallenge(ctx, "scep-static", "", time.Time{})
+	assert.EqualError(t, err, "provisioner scep-static does not have one-time challenges enabled")
+	_, _, err = a.CreateSCEPChallenge(ctx, "Max", "", time.Time{})
+	assert.EqualError(t, err, "provisioner Max is not a SCEP provisioner")
+	_, _, err = a.CreateSCEPChallenge(ctx, "missing", "", time.Time{})
+	assert.EqualError(t, err, "provisioner missing not found")
+
+	a.db = nil
+	_, _, err = a.CreateSCEPChallenge(ctx, "scep", "", time.Time{})
+	assert.EqualError(t, err, "database does not support SCEP one-time challenges")
+}
+
+func TestAuthority_RevokeSCEPChallenge(t *testing.T) {
+	revoked := &db.SCEPChallenge{ID: "revoked", ProvisionerID: "scep/scep", RevokedAt: time.Now()}
+	mockDB := &db.MockAuthDB{
+		MGetSCEPChallenges: func(provisionerID, cursor string, limit int) ([]*db.SCEPChallenge, string, error) {
+			assert.Equal(t, "scep/scep", provisionerID)
+			assert.Equal(t, "cursor", cursor)
+			assert.Equal(t, 10, limit)
+			return []*db.SCEPChallenge{revoked}, "next", nil
+		},
+		MRevokeSCEPChallenge: func(provisionerID, id string) (*db.SCEPChallenge, error) {
+			assert.Equal(t, "scep/scep", provisionerID)
+			switch id {
+			case "revoked":
+				return revoked, nil
+			case "used":
+				return nil, db.ErrSCEPChallengeUsed
+			default:
+				return nil, database.ErrNotFound
+			}
+		},
+	}
+
+	ctx := context.Background()
+	a := testAuthority(t, WithDatabase(mockDB))
+	config, err := a.generateProvisionerConfig(ctx)
+	require.NoError(t, err)
+	p := &provisioner.SCEP{Name: "scep", Type: "SCEP", DynamicChallenge: &provisioner.SCEPDynamicChallenge{}}
+	require.NoError(t, p.Init(config))
+	require.NoError(t, a.provisioners.Store(p))
+
+	challenges, nextCursor, err := a.GetSCEPChallenges(ctx, "scep", "cursor", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []*db.SCEPChallenge{revoked}, challenges)
+	assert.Equal(t, "next", nextCursor)
+	_, _, err = a.GetSCEPChallenges(ctx, "Max", "", 0)
+	assert.EqualError(t, err, "provisioner Max is not a SCEP provisioner")
+
+	sc, err := a.RevokeSCEPChallenge(ctx, "scep", "revoked")
+	require.NoError(t, err)
+	assert.Equal(t, revoked, sc)
+	_, err = a.RevokeSCEPChallenge(ctx, "scep", "used")
+	assert.EqualError(t, err, "SCEP challenge used has already been used")
+	_, err = a.RevokeSCEPChallenge(ctx, "scep", "missing")
+	assert.EqualError(t, err, "SCEP challenge missing not found")
+}
+
+func TestAuthority_startSCEPChallengeCleaner(t *testing.T) {
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{}))
+	require.NotNil(t, a.scepChallengeTicker)
+	a.stopSCEPChallengeCleaner()
+	assert.Nil(t, a.scepChallengeTicker)
+	assert.Nil(t, a.scepChallengeStopper)
+
+	// Databases without one-time challenges do not start the cleaner.
+	a.db = nil
+	a.startSCEPChallengeCleaner()
+	assert.Nil(t, a.scepChallengeTicker)
+}
@@ -15,6 +15,7 @@ import (
 	"go.step.sm/crypto/randutil"
 	"go.step.sm/crypto/sshutil"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/db"
@@ -146,7 +147,13 @@ func (a *Authority) GetSSHBastion(ctx context.Context, user, hostname string) (*
 }
 
 // SignSSH creates a signed SSH certificate with the given public key and options.
-func (a *Authority) SignSSH(_ context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+	cert, err := a.signSSH(ctx, key, opts, signOpts...)
+	a.meter.CertificateOperation("ssh", "sign", provisionerName(signOptionsProvisioner(signOpts)), err)
+	return cert, err
+}
+
+func (a *Authority) signSSH(_ context.Context, key ssh.PublicKey, opts provisioner.SignSSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	var (
 		certOptions []sshutil.Option
 		mods        []provisioner.SSHCertModifier
@@ -300,6 +307,10 @@ func (a *Authority) SignSSH(_ context.Context, key ssh.PublicKey, opts provision
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error storing certificate in db")
 	}
 
+	if err = a.auditSSH(audit.SSHSign, prov, cert); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "authority.SignSSH: error writing audit log")
+	}
+
 	return cert, nil
 }
 
@@ -370,6 +381,10 @@ func (a *Authority) RenewSSH(ctx context.Context, oldCert *ssh.Certificate) (*ss
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "renewSSH: error storing certificate in db")
 	}
 
+	if err = a.auditSSH(audit.SSHRenew, prov, cert); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "renewSSH: error writing audit log")
+	}
+
 	return cert, nil
 }
 
@@ -453,10 +468,18 @@ func (a *Authority) RekeySSH(ctx context.Context, oldCert *ssh.Certificate, pub
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "rekeySSH; error storing certificate in db")
 	}
 
+	if err = a.auditSSH(audit.SSHRekey, prov, cert); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "rekeySSH; error writing audit log")
+	}
+
 	return cert, nil
 }
 
-func (a *Authority) storeSSHCertificate(prov provisioner.Interface, cert *ssh.Certificate) error {
+func (a *Authority) storeSSHCertificate(prov provisioner.Interface, cert *ssh.Certificate) (err error) {
+	defer func(start time.Time) {
+		a.observeDB("store_ssh_certificate", start, err)
+	}(time.Now())
+
 	type sshCertificateStorer interface {
 		StoreSSHCertificate(provisioner.Interface, *ssh.Certificate) error
 	}
@@ -480,7 +503,11 @@ func (a *Authority) storeSSHCertificate(prov provisioner.Interface, cert *ssh.Ce
 	}
 }
 
-func (a *Authority) storeRenewedSSHCertificate(prov provisioner.Interface, parent, cert *ssh.Certificate) error {
+func (a *Authority) storeRenewedSSHCertificate(prov provisioner.Interface, parent, cert *ssh.Certificate) (err error) {
+	defer func(start time.Time) {
+		a.observeDB("store_renewed_ssh_certificate", start, err)
+	}(time.Now())
+
 	type sshRenewerCertificateStorer interface {
 		StoreRenewedSSHCertificate(p provisioner.Interface, parent, cert *ssh.Certificate) error
 	}
@@ -589,6 +616,10 @@ func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subje
 		return nil, errs.Wrap(http.StatusInternalServerError, err, "signSSHAddUser: error storing certificate in db")
 	}
 
+	if err = a.auditSSH(audit.SSHSign, prov, cert); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err, "signSSHAddUser: error writing audit log")
+	}
+
 	return cert, nil
 }
 
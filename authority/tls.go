@@ -11,9 +11,14 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"log"
 	"math/big"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,6 +30,7 @@ import (
 	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
 
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/authority/provisioner"
 	casapi "github.com/smallstep/certificates/cas/apiv1"
@@ -93,6 +99,12 @@ func withDefaultASN1DN(def *config.ASN1DN) provisioner.CertificateModifierFunc {
 
 // Sign creates a signed certificate from a certificate signing request.
 func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	fullchain, err := a.sign(csr, signOpts, extraOpts...)
+	a.meter.CertificateOperation("x509", "sign", provisionerName(signOptionsProvisioner(extraOpts)), err)
+	return fullchain, err
+}
+
+func (a *Authority) sign(csr *x509.CertificateRequest, signOpts provisioner.SignOptions, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
 	var (
 		certOptions    []x509util.Option
 		certValidators []provisioner.CertificateValidator
@@ -108,6 +120,11 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		)
 	}
 
+	// Fail fast if the certificate cannot be stored.
+	if err := a.dbHealth.check(); err != nil {
+		return nil, errs.ApplyOptions(err, opts...)
+	}
+
 	// Set backdate with the configured value
 	signOpts.Backdate = a.config.AuthorityConfig.Backdate.Duration
 
@@ -203,6 +220,37 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 		)
 	}
 
+	// Set default CRL distribution point
+	if a.config.CRL.IsEnabled() && a.config.CRL.EmbedDistributionPoint {
+		if err := withDefaultCRLDistributionPoint(a.crlURL()).Modify(leaf, signOpts); err != nil {
+			return nil, errs.ApplyOptions(
+				errs.ForbiddenErr(err, "error creating certificate"),
+				opts...,
+			)
+		}
+	}
+
+	// Set default OCSP server
+	if a.config.OCSP.IsEnabled() {
+		if err := withDefaultOCSPServer(a.ocspURL()).Modify(leaf, signOpts); err != nil {
+			return nil, errs.ApplyOptions(
+				errs.ForbiddenErr(err, "error creating certificate"),
+				opts...,
+			)
+		}
+	}
+
+	// Set default issuing certificate URL, the intermediate is only published
+	// at a well known URL if the external URL of the CA is configured.
+	if a.config.ExternalURL != nil && len(a.intermediateX509Certs) > 0 {
+		if err := withDefaultIssuingCertificateURL(a.issuerURL()).Modify(leaf, signOpts); err != nil {
+			return nil, errs.ApplyOptions(
+				errs.ForbiddenErr(err, "error creating certificate"),
+				opts...,
+			)
+		}
+	}
+
 	for _, m := range certModifiers {
 		if err := m.Modify(leaf, signOpts); err != nil {
 			return nil, errs.ApplyOptions(
@@ -256,13 +304,13 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 	}
 
 	// Send certificate to webhooks for authorization
-	if err := callAuthorizingWebhooksX509(webhookCtl, cert, leaf, attData); err != nil {
+	decisions, err := callAuthorizingWebhooksX509(webhookCtl, cert, leaf, attData)
+	if err != nil {
 		return nil, errs.ApplyOptions(
 			errs.ForbiddenErr(err, "error creating certificate"),
 			opts...,
 		)
 	}
-
 	// Sign certificate
 	lifetime := leaf.NotAfter.Sub(leaf.NotBefore.Add(signOpts.Backdate))
 	resp, err := a.x509CAService.CreateCertificate(&casapi.CreateCertificateRequest{
@@ -284,9 +332,24 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Sign
 	// Store certificate in the db.
 	if err = a.storeCertificate(prov, fullchain); err != nil {
 		if !errors.Is(err, db.ErrNotImplemented) {
+			a.dbHealth.failure(err)
 			return nil, errs.Wrap(http.StatusInternalServerError, err,
 				"authority.Sign; error storing certificate in db", opts...)
 		}
+	} else {
+		a.dbHealth.success()
+	}
+
+	// Write the events in the audit log before returning the certificate. The
+	// webhook decisions are only written once they have been applied to an
+	// issued certificate.
+	if err := a.auditX509WebhookDecisions(prov, fullchain[0], decisions); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err,
+			"authority.Sign; error writing audit log", opts...)
+	}
+	if err := a.auditX509(audit.X509Sign, prov, fullchain[0], nil); err != nil {
+		return nil, errs.Wrap(http.StatusInternalServerError, err,
+			"authority.Sign; error writing audit log", opts...)
 	}
 
 	return fullchain, nil
@@ -337,6 +400,19 @@ func (a *Authority) Rekey(oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x5
 // of rekey), and 'NotBefore/NotAfter' (the validity duration of the new
 // certificate should be equal to the old one, but starting 'now').
 func (a *Authority) RenewContext(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	fullchain, err := a.renewContext(ctx, oldCert, pk)
+	if a.meter != nil {
+		operation := "renew"
+		if pk != nil {
+			operation = "rekey"
+		}
+		prov, _ := a.LoadProvisionerByCertificate(oldCert)
+		a.meter.CertificateOperation("x509", operation, provisionerName(prov), err)
+	}
+	return fullchain, err
+}
+
+func (a *Authority) renewContext(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
 	isRekey := (pk != nil)
 	opts := []errs.Option{
 		errs.WithKeyVal("serialNumber", oldCert.SerialNumber.String()),
@@ -442,6 +518,28 @@ func (a *Authority) RenewContext(ctx context.Context, oldCert *x509.Certificate,
 	fullchain := append([]*x509.Certificate{resp.Certificate}, resp.CertificateChain...)
 	if err = a.storeRenewedCertificate(oldCert, fullchain); err != nil {
 		if !errors.Is(err, db.ErrNotImplemented) {
+			a.dbHealth.failure(err)
+			// In degraded mode, renewals can succeed without storing the
+			// certificate.
+			if !a.allowDegradedRenewals() {
+				return nil, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
+			}
+			log.Printf("error storing renewed certificate %s in degraded mode: %v", resp.Certificate.SerialNumber, err)
+		}
+	} else {
+		a.dbHealth.success()
+	}
+
+	// Write the event in the audit log before returning the certificate.
+	if a.auditLogger != nil {
+		typ := audit.X509Renew
+		if isRekey {
+			typ = audit.X509Rekey
+		}
+		prov, _ := a.LoadProvisionerByCertificate(oldCert)
+		if err := a.auditX509(typ, prov, fullchain[0], map[string]string{
+			"previousSerialNumber": oldCert.SerialNumber.String(),
+		}); err != nil {
 			return nil, errs.StatusCodeError(http.StatusInternalServerError, err, opts...)
 		}
 	}
@@ -455,7 +553,11 @@ func (a *Authority) RenewContext(ctx context.Context, oldCert *x509.Certificate,
 // TODO: at some point we should replace the db.AuthDB interface to implement
 // `StoreCertificate(...*x509.Certificate) error` instead of just
 // `StoreCertificate(*x509.Certificate) error`.
-func (a *Authority) storeCertificate(prov provisioner.Interface, fullchain []*x509.Certificate) error {
+func (a *Authority) storeCertificate(prov provisioner.Interface, fullchain []*x509.Certificate) (err error) {
+	defer func(start time.Time) {
+		a.observeDB("store_certificate", start, err)
+	}(time.Now())
+
 	type certificateChainStorer interface {
 		StoreCertificateChain(provisioner.Interface, ...*x509.Certificate) error
 	}
@@ -488,7 +590,11 @@ func (a *Authority) storeCertificate(prov provisioner.Interface, fullchain []*x5
 // that can log if a certificate has been renewed or rekeyed.
 //
 // TODO: at some point we should implement this in the standard implementation.
-func (a *Authority) storeRenewedCertificate(oldCert *x509.Certificate, fullchain []*x509.Certificate) error {
+func (a *Authority) storeRenewedCertificate(oldCert *x509.Certificate, fullchain []*x509.Certificate) (err error) {
+	defer func(start time.Time) {
+		a.observeDB("store_renewed_certificate", start, err)
+	}(time.Now())
+
 	type renewedCertificateChainStorer interface {
 		StoreRenewedCertificate(*x509.Certificate, ...*x509.Certificate) error
 	}
@@ -525,9 +631,7 @@ type RevokeOptions struct {
 //
 // NOTE: Only supports passive revocation - prevent existing certificates from
 // being renewed.
-//
-// TODO: Add OCSP and CRL support.
-func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error {
+func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) (err error) {
 	opts := []interface{}{
 		errs.WithKeyVal("serialNumber", revokeOpts.Serial),
 		errs.WithKeyVal("reasonCode", revokeOpts.ReasonCode),
@@ -551,6 +655,19 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 		ACME:       revokeOpts.ACME,
 		RevokedAt:  time.Now().UTC(),
 	}
+	if a.meter != nil {
+		defer func() {
+			certType := "x509"
+			if provisioner.MethodFromContext(ctx) == provisioner.SSHRevokeMethod {
+				certType = "ssh"
+			}
+			var name string
+			if p, ok := a.provisioners.Load(rci.ProvisionerID); ok {
+				name = p.GetName()
+			}
+			a.meter.CertificateOperation(certType, "revoke", name, err)
+		}()
+	}
 
 	// For X509 CRLs attempt to get the expiration date of the certificate.
 	if provisioner.MethodFromContext(ctx) == provisioner.RevokeMethod {
@@ -611,7 +728,10 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 		}
 	}
 
+	auditType := audit.X509Revoke
+	var revokedCert *x509.Certificate
 	if provisioner.MethodFromContext(ctx) == provisioner.SSHRevokeMethod {
+		auditType = audit.SSHRevoke
 		if err := a.revokeSSH(nil, rci); err != nil {
 			return failRevoke(err)
 		}
@@ -620,7 +740,6 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 		// provided we will try to read it from the db. If the read fails we
 		// won't throw an error as it will be responsibility of the CAS
 		// implementation to require a certificate.
-		var revokedCert *x509.Certificate
 		if revokeOpts.Crt != nil {
 			revokedCert = revokeOpts.Crt
 		} else if rci.Serial != "" {
@@ -645,6 +764,11 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 			return failRevoke(err)
 		}
 
+		// Make the OCSP responder answer with the new status right away.
+		if a.ocspResponder != nil {
+			a.ocspResponder.Invalidate(rci.Serial)
+		}
+
 		// Generate a new CRL so CRL requesters will always get an up-to-date
 		// CRL whenever they request it.
 		if a.config.CRL.IsEnabled() && a.config.CRL.GenerateOnRevoke {
@@ -654,10 +778,36 @@ func (a *Authority) Revoke(ctx context.Context, revokeOpts *RevokeOptions) error
 		}
 	}
 
+	// Write the event in the audit log before responding.
+	if err := a.auditRevoke(auditType, rci.Serial, revokedCert, map[string]string{
+		"provisionerID": rci.ProvisionerID,
+		"reason":        rci.Reason,
+		"reasonCode":    strconv.Itoa(rci.ReasonCode),
+		"method":        revokeMethod(revokeOpts),
+	}); err != nil {
+		return errs.Wrap(http.StatusInternalServerError, err, "authority.Revoke; error writing audit log", opts...)
+	}
+
 	return nil
 }
 
-func (a *Authority) revoke(crt *x509.Certificate, rci *db.RevokedCertificateInfo) error {
+// revokeMethod returns how the revocation request was authenticated.
+func revokeMethod(opts *RevokeOptions) string {
+	switch {
+	case opts.MTLS:
+		return "mtls"
+	case opts.ACME:
+		return "acme"
+	default:
+		return "token"
+	}
+}
+
+func (a *Authority) revoke(crt *x509.Certificate, rci *db.RevokedCertificateInfo) (err error) {
+	defer func(start time.Time) {
+		a.observeDB("revoke", start, err)
+	}(time.Now())
+
 	if lca, ok := a.adminDB.(interface {
 		Revoke(*x509.Certificate, *db.RevokedCertificateInfo) error
 	}); ok {
@@ -666,7 +816,11 @@ func (a *Authority) revoke(crt *x509.Certificate, rci *db.RevokedCertificateInfo
 	return a.db.Revoke(rci)
 }
 
-func (a *Authority) revokeSSH(crt *ssh.Certificate, rci *db.RevokedCertificateInfo) error {
+func (a *Authority) revokeSSH(crt *ssh.Certificate, rci *db.RevokedCertificateInfo) (err error) {
+	defer func(start time.Time) {
+		a.observeDB("revoke_ssh", start, err)
+	}(time.Now())
+
 	if lca, ok := a.adminDB.(interface {
 		RevokeSSH(*ssh.Certificate, *db.RevokedCertificateInfo) error
 	}); ok {
@@ -773,18 +927,10 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 		NextUpdate:          now.Add(updateDuration),
 	}
 
-	// Set CRL IDP to config item, otherwise, leave as default
-	var fullName string
-	if a.config.CRL.IDPurl != "" {
-		fullName = a.config.CRL.IDPurl
-	} else {
-		fullName = a.config.Audience("/1.0/crl")[0]
-	}
-
 	// Add distribution point.
 	//
 	// Note that this is currently using the port 443 by default.
-	if b, err := marshalDistributionPoint(fullName, false); err == nil {
+	if b, err := marshalDistributionPoint(a.crlURL(), false); err == nil {
 		revocationList.ExtraExtensions = []pkix.Extension{
 			{Id: oidExtensionIssuingDistributionPoint, Critical: true, Value: b},
 		}
@@ -810,9 +956,119 @@ func (a *Authority) GenerateCertificateRevocationList() error {
 		return errors.Wrap(err, "could not store CRL in database")
 	}
 
+	// Write the CRL to the configured file, so it can be published by other
+	// means
+	if a.config.CRL.File != "" {
+		if err := writeCRLFile(a.config.CRL.File, newCRLInfo.DER); err != nil {
+			return errors.Wrap(err, "could not write CRL file")
+		}
+	}
+
 	return nil
 }
 
+// crlURL returns the URL of the CRL. It's the configured idpURL, or the URL of
+// the CRL endpoint of the CA.
+func (a *Authority) crlURL() string {
+	if a.config.CRL.IDPurl != "" {
+		return a.config.CRL.IDPurl
+	}
+	path := "/1.0/crl"
+	if a.config.CRL.Path != "" {
+		path = a.config.CRL.Path
+	}
+	if a.config.ExternalURL != nil {
+		return a.config.ExternalURL.Resolve(a.config.DNSNames[0], path)
+	}
+	return a.config.Audience(path)[0]
+}
+
+// ocspURL returns the URL of the OCSP responder. The responder is only served
+// by the insecure server, so the URL uses the http scheme and the port of the
+// insecure address.
+func (a *Authority) ocspURL() string {
+	if a.config.OCSP.URL != "" {
+		return a.config.OCSP.URL
+	}
+	path := "/1.0/ocsp"
+	if a.config.OCSP.Path != "" {
+		path = a.config.OCSP.Path
+	}
+	if a.config.ExternalURL != nil {
+		return a.config.ExternalURL.Resolve(a.config.DNSNames[0], path)
+	}
+	u := url.URL{Scheme: "http", Host: a.config.DNSNames[0], Path: path}
+	if _, port, err := net.SplitHostPort(a.config.InsecureAddress); err == nil && port != "" && port != "80" {
+		u.Host = net.JoinHostPort(a.config.DNSNames[0], port)
+	} else if ip := net.ParseIP(u.Host); ip != nil && ip.To4() == nil {
+		u.Host = "[" + u.Host + "]"
+	}
+	return u.String()
+}
+
+// issuerURL returns the URL of the issuing intermediate certificate, used in
+// the caIssuers access method of the authority information access extension.
+func (a *Authority) issuerURL() string {
+	return a.config.ExternalURL.Resolve(a.config.DNSNames[0], "/1.0/intermediate")
+}
+
+// writeCRLFile writes the CRL to the given file. The CRL is first written to a
+// temporary file that replaces the given one, so readers never see a partial
+// CRL.
+func writeCRLFile(filename string, der []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), ".crl-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(der); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// withDefaultCRLDistributionPoint sets the given URL as the CRL distribution
+// point of the certificate if the template didn't set any.
+func withDefaultCRLDistributionPoint(crlURL string) provisioner.CertificateModifierFunc {
+	return func(crt *x509.Certificate, opts provisioner.SignOptions) error {
+		if len(crt.CRLDistributionPoints) == 0 {
+			crt.CRLDistributionPoints = []string{crlURL}
+		}
+		return nil
+	}
+}
+
+// withDefaultIssuingCertificateURL sets the given URL as the issuing
+// certificate URL of the certificate if the template didn't set any.
+func withDefaultIssuingCertificateURL(issuerURL string) provisioner.CertificateModifierFunc {
+	return func(crt *x509.Certificate, opts provisioner.SignOptions) error {
+		if len(crt.IssuingCertificateURL) == 0 {
+			crt.IssuingCertificateURL = []string{issuerURL}
+		}
+		return nil
+	}
+}
+
+// withDefaultOCSPServer sets the given URL as the OCSP server of the
+// certificate if the template didn't set any.
+func withDefaultOCSPServer(ocspURL string) provisioner.CertificateModifierFunc {
+	return func(crt *x509.Certificate, opts provisioner.SignOptions) error {
+		if len(crt.OCSPServer) == 0 {
+			crt.OCSPServer = []string{ocspURL}
+		}
+		return nil
+	}
+}
+
 // GetTLSCertificate creates a new leaf certificate to be used by the CA HTTPS server.
 func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
 	fatal := func(err error) (*tls.Certificate, error) {
@@ -972,9 +1228,9 @@ func callEnrichingWebhooksX509(webhookCtl webhookController, attData *provisione
 	return webhookCtl.Enrich(whEnrichReq)
 }
 
-func callAuthorizingWebhooksX509(webhookCtl webhookController, cert *x509util.Certificate, leaf *x509.Certificate, attData *provisioner.AttestationData) error {
+func callAuthorizingWebhooksX509(webhookCtl webhookController, cert *x509util.Certificate, leaf *x509.Certificate, attData *provisioner.AttestationData) ([]*provisioner.WebhookDecision, error) {
 	if webhookCtl == nil {
-		return nil
+		return nil, nil
 	}
 	var attested *webhook.AttestationData
 	if attData != nil {
@@ -987,7 +1243,19 @@ func callAuthorizingWebhooksX509(webhookCtl webhookController, cert *x509util.Ce
 		webhook.WithAttestationData(attested),
 	)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// Webhooks allowed to mutate certificates can modify the SANs and the
+	// lifetime of the certificate.
+	if ctl, ok := webhookCtl.(x509WebhookController); ok {
+		decisions, err := ctl.AuthorizeX509(whAuthBody)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyX509WebhookDecisions(leaf, decisions); err != nil {
+			return nil, err
+		}
+		return decisions, nil
 	}
-	return webhookCtl.Authorize(whAuthBody)
+	return nil, webhookCtl.Authorize(whAuthBody)
 }
@@ -14,6 +14,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -1952,3 +1954,177 @@ func TestAuthority_CRL(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_GenerateCertificateRevocationList_file(t *testing.T) {
+	var stored *db.CertificateRevocationListInfo
+	a := testAuthority(t, WithDatabase(&db.MockAuthDB{
+		MGetCRL: func() (*db.CertificateRevocationListInfo, error) {
+			if stored == nil {
+				return nil, database.ErrNotFound
+			}
+			return stored, nil
+		},
+		MStoreCRL: func(info *db.CertificateRevocationListInfo) error {
+			stored = info
+			return nil
+		},
+		MGetRevokedCertificates: func() (*[]db.RevokedCertificateInfo, error) {
+			return &[]db.RevokedCertificateInfo{
+				{Serial: "1234", RevokedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)},
+			}, nil
+		},
+	}))
+	filename := filepath.Join(t.TempDir(), "ca.crl")
+	a.config.CRL = &config.CRLConfig{
+		Enabled:       true,
+		CacheDuration: &provisioner.Duration{Duration: time.Hour},
+		Path:          "/ca.crl",
+		File:          filename,
+	}
+
+	assert.FatalError(t, a.GenerateCertificateRevocationList())
+	b, err := os.ReadFile(filename)
+	assert.FatalError(t, err)
+	assert.Equals(t, stored.DER, b)
+
+	crl, err := x509.ParseRevocationList(b)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, crl.RevokedCertificates)
+	assert.Equals(t, "1234", crl.RevokedCertificates[0].SerialNumber.String())
+	assert.Equals(t, "https://example.com/ca.crl", a.crlURL())
+
+	// A new CRL replaces the file.
+	assert.FatalError(t, a.GenerateCertificateRevocationList())
+	b, err = os.ReadFile(filename)
+	assert.FatalError(t, err)
+	crl, err = x509.ParseRevocationList(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(1), crl.Number.Int64())
+}
+
+func TestAuthority_Sign_crlDistributionPoint(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+
+	a := testAuthority(t)
+	a.config.CRL = &config.CRLConfig{
+		Enabled:                true,
+		IDPurl:                 "http://crl.example.com/ca.crl",
+		EmbedDistributionPoint: true,
+	}
+	nb := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(nb),
+		NotAfter:  provisioner.NewTimeDuration(nb.Add(5 * time.Minute)),
+	}
+
+	certs, err := a.Sign(getCSR(t, priv), signOpts)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"http://crl.example.com/ca.crl"}, certs[0].CRLDistributionPoints)
+
+	// Distribution points set by the template are not replaced.
+	tmpl, err := provisioner.CustomTemplateOptions(nil, x509util.CreateTemplateData("smallstep test", nil),
+		`{"subject": {{ toJson .Subject }}, "crlDistributionPoints": ["http://other.example.com/ca.crl"]}`)
+	assert.FatalError(t, err)
+	certs, err = a.Sign(getCSR(t, priv), signOpts, tmpl)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"http://other.example.com/ca.crl"}, certs[0].CRLDistributionPoints)
+
+	a.config.CRL.EmbedDistributionPoint = false
+	certs, err = a.Sign(getCSR(t, priv), signOpts)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, certs[0].CRLDistributionPoints)
+}
+
+func TestAuthority_Sign_ocspServer(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+
+	a := testAuthority(t)
+	a.config.OCSP = &config.OCSPConfig{
+		Enabled: true,
+		URL:     "http://ocsp.example.com",
+	}
+	nb := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(nb),
+		NotAfter:  provisioner.NewTimeDuration(nb.Add(5 * time.Minute)),
+	}
+
+	certs, err := a.Sign(getCSR(t, priv), signOpts)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"http://ocsp.example.com"}, certs[0].OCSPServer)
+
+	// OCSP servers set by the template are not replaced.
+	tmpl, err := provisioner.CustomTemplateOptions(nil, x509util.CreateTemplateData("smallstep test", nil),
+		`{"subject": {{ toJson .Subject }}, "ocspServer": ["http://other.example.com"]}`)
+	assert.FatalError(t, err)
+	certs, err = a.Sign(getCSR(t, priv), signOpts, tmpl)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"http://other.example.com"}, certs[0].OCSPServer)
+
+	a.config.OCSP.Enabled = false
+	certs, err = a.Sign(getCSR(t, priv), signOpts)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, certs[0].OCSPServer)
+}
+
+func TestAuthority_Sign_issuingCertificateURL(t *testing.T) {
+	_, priv, err := keyutil.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+
+	a := testAuthority(t)
+	nb := time.Now()
+	signOpts := provisioner.SignOptions{
+		NotBefore: provisioner.NewTimeDuration(nb),
+		NotAfter:  provisioner.NewTimeDuration(nb.Add(5 * time.Minute)),
+	}
+
+	// The intermediate is not published without an external URL.
+	certs, err := a.Sign(getCSR(t, priv), signOpts)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, certs[0].IssuingCertificateURL)
+
+	a.config.ExternalURL = &config.ExternalURL{Host: "ca.example.com", PathPrefix: "/pki"}
+	certs, err = a.Sign(getCSR(t, priv), signOpts)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"https://ca.example.com/pki/1.0/intermediate"}, certs[0].IssuingCertificateURL)
+
+	// Issuing certificate URLs set by the template are not replaced.
+	tmpl, err := provisioner.CustomTemplateOptions(nil, x509util.CreateTemplateData("smallstep test", nil),
+		`{"subject": {{ toJson .Subject }}, "issuingCertificateURL": ["http://other.example.com/ca.crt"]}`)
+	assert.FatalError(t, err)
+	certs, err = a.Sign(getCSR(t, priv), signOpts, tmpl)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"http://other.example.com/ca.crt"}, certs[0].IssuingCertificateURL)
+}
+
+func TestAuthority_GetIntermediates(t *testing.T) {
+	a := testAuthority(t)
+	certs, err := a.GetIntermediates()
+	assert.FatalError(t, err)
+	assert.Equals(t, a.intermediateX509Certs, certs)
+
+	a.intermediateX509Certs = nil
+	_, err = a.GetIntermediates()
+	assert.Error(t, err)
+}
+
+func TestAuthority_ocspURL(t *testing.T) {
+	a := testAuthority(t)
+	a.config.OCSP = &config.OCSPConfig{Enabled: true}
+	assert.Equals(t, "http://example.com/1.0/ocsp", a.ocspURL())
+
+	a.config.InsecureAddress = ":8080"
+	assert.Equals(t, "http://example.com:8080/1.0/ocsp", a.ocspURL())
+
+	a.config.OCSP.Path = "/ca/ocsp"
+	a.config.DNSNames = []string{"::1"}
+	assert.Equals(t, "http://[::1]:8080/ca/ocsp", a.ocspURL())
+
+	a.config.ExternalURL = &config.ExternalURL{Scheme: "http", Host: "ca.example.com", PathPrefix: "/pki"}
+	assert.Equals(t, "http://ca.example.com/pki/ca/ocsp", a.ocspURL())
+
+	a.config.OCSP.URL = "http://ocsp.example.com"
+	assert.Equals(t, "http://ocsp.example.com", a.ocspURL())
+}
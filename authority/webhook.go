@@ -1,8 +1,114 @@
 package authority
 
-import "github.com/smallstep/certificates/webhook"
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"net"
+	"net/url"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/webhook"
+)
 
 type webhookController interface {
 	Enrich(*webhook.RequestBody) error
 	Authorize(*webhook.RequestBody) error
 }
+
+// x509WebhookController is implemented by webhook controllers that support
+// authorizing webhooks that can modify X.509 certificates.
+type x509WebhookController interface {
+	AuthorizeX509(*webhook.RequestBody) ([]*provisioner.WebhookDecision, error)
+}
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// applyX509WebhookDecisions applies the modifications returned by authorizing
+// webhooks to the certificate. Webhooks can only remove subject alternative
+// names and shorten the lifetime of the certificate. The applied decisions are
+// written in the audit log by the caller.
+func applyX509WebhookDecisions(leaf *x509.Certificate, decisions []*provisioner.WebhookDecision) error {
+	for _, d := range decisions {
+		if len(d.SANs) > 0 {
+			if err := filterX509SANs(leaf, d.SANs); err != nil {
+				return errors.Wrapf(err, "error applying decision of webhook %s", d.Webhook)
+			}
+		}
+		if !d.NotAfter.IsZero() {
+			switch {
+			case d.NotAfter.After(leaf.NotAfter):
+				return errors.Errorf("error applying decision of webhook %s: notAfter cannot extend the certificate lifetime", d.Webhook)
+			case !d.NotAfter.After(leaf.NotBefore):
+				return errors.Errorf("error applying decision of webhook %s: notAfter must be after notBefore", d.Webhook)
+			}
+			leaf.NotAfter = d.NotAfter
+		}
+	}
+	return nil
+}
+
+// filterX509SANs removes the subject alternative names of the certificate that
+// are not in the given list. It fails if the list contains names that are not
+// in the certificate.
+func filterX509SANs(leaf *x509.Certificate, sans []string) error {
+	for _, ext := range leaf.ExtraExtensions {
+		if ext.Id.Equal(oidExtensionSubjectAltName) {
+			return errors.New("subject alternative names extension cannot be modified")
+		}
+	}
+
+	keep := make(map[string]bool, len(sans))
+	for _, s := range sans {
+		keep[s] = false
+	}
+	var removed []string
+	match := func(s string) bool {
+		if _, ok := keep[s]; ok {
+			keep[s] = true
+			return true
+		}
+		removed = append(removed, s)
+		return false
+	}
+
+	var dnsNames, emails []string
+	var ips []net.IP
+	var uris []*url.URL
+	for _, s := range leaf.DNSNames {
+		if match(s) {
+			dnsNames = append(dnsNames, s)
+		}
+	}
+	for _, ip := range leaf.IPAddresses {
+		if match(ip.String()) {
+			ips = append(ips, ip)
+		}
+	}
+	for _, s := range leaf.EmailAddresses {
+		if match(s) {
+			emails = append(emails, s)
+		}
+	}
+	for _, u := range leaf.URIs {
+		if match(u.String()) {
+			uris = append(uris, u)
+		}
+	}
+	for s, found := range keep {
+		if !found {
+			return errors.Errorf("subject alternative name %s was not requested", s)
+		}
+	}
+
+	leaf.DNSNames, leaf.IPAddresses, leaf.EmailAddresses, leaf.URIs = dnsNames, ips, emails, uris
+	// Remove the common name if it was one of the removed names.
+	for _, s := range removed {
+		if leaf.Subject.CommonName == s {
+			leaf.Subject.CommonName = ""
+			break
+		}
+	}
+	return nil
+}
@@ -1,6 +1,16 @@
 package authority
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
 	"github.com/smallstep/certificates/authority/provisioner"
 	"github.com/smallstep/certificates/webhook"
 )
@@ -25,3 +35,69 @@ func (wc *mockWebhookController) Enrich(*webhook.RequestBody) error {
 func (wc *mockWebhookController) Authorize(*webhook.RequestBody) error {
 	return wc.authorizeErr
 }
+
+func Test_applyX509WebhookDecisions(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	uri, err := url.Parse("spiffe://example.com/foo")
+	assert.NoError(t, err)
+
+	newLeaf := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject:        pkix.Name{CommonName: "foo.internal"},
+			DNSNames:       []string{"foo.internal", "bar.internal"},
+			IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+			EmailAddresses: []string{"foo@internal"},
+			URIs:           []*url.URL{uri},
+			NotBefore:      now,
+			NotAfter:       now.Add(24 * time.Hour),
+		}
+	}
+	decision := func(d webhook.Decision) []*provisioner.WebhookDecision {
+		return []*provisioner.WebhookDecision{{Webhook: "inventory", Decision: &d}}
+	}
+
+	tests := []struct {
+		name      string
+		decisions []*provisioner.WebhookDecision
+		leaf      *x509.Certificate
+		want      *x509.Certificate
+		wantErr   string
+	}{
+		{"ok/no decisions", nil, newLeaf(), newLeaf(), ""},
+		{"ok/reason only", decision(webhook.Decision{Reason: "ok"}), newLeaf(), newLeaf(), ""},
+		{"ok/sans", decision(webhook.Decision{SANs: []string{"bar.internal", "10.0.0.1", "spiffe://example.com/foo"}}), newLeaf(), &x509.Certificate{
+			DNSNames:    []string{"bar.internal"},
+			IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+			URIs:        []*url.URL{uri},
+			NotBefore:   now,
+			NotAfter:    now.Add(24 * time.Hour),
+		}, ""},
+		{"ok/notAfter", decision(webhook.Decision{NotAfter: now.Add(time.Hour)}), newLeaf(), func() *x509.Certificate {
+			leaf := newLeaf()
+			leaf.NotAfter = now.Add(time.Hour)
+			return leaf
+		}(), ""},
+		{"fail/new san", decision(webhook.Decision{SANs: []string{"foo.internal", "zap.internal"}}), newLeaf(), nil,
+			"error applying decision of webhook inventory: subject alternative name zap.internal was not requested"},
+		{"fail/extend lifetime", decision(webhook.Decision{NotAfter: now.Add(48 * time.Hour)}), newLeaf(), nil,
+			"error applying decision of webhook inventory: notAfter cannot extend the certificate lifetime"},
+		{"fail/before notBefore", decision(webhook.Decision{NotAfter: now.Add(-time.Hour)}), newLeaf(), nil,
+			"error applying decision of webhook inventory: notAfter must be after notBefore"},
+		{"fail/san extension", decision(webhook.Decision{SANs: []string{"foo.internal"}}), func() *x509.Certificate {
+			leaf := newLeaf()
+			leaf.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{2, 5, 29, 17}}}
+			return leaf
+		}(), nil, "error applying decision of webhook inventory: subject alternative names extension cannot be modified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := applyX509WebhookDecisions(tt.leaf, tt.decisions)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, tt.leaf)
+		})
+	}
+}
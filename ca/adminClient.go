@@ -679,8 +679,15 @@ retry:
 		}
 		return nil, readAdminError(resp.Body)
 	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	// The response includes the expiration of the key, not available in
+	// linkedca.EABKey.
 	var eabKey = new(linkedca.EABKey)
-	if err := readProtoJSON(resp.Body, eabKey); err != nil {
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, eabKey); err != nil {
 		return nil, errors.Wrapf(err, "error reading %s", u)
 	}
 	return eabKey, nil
@@ -0,0 +1,225 @@
+// Package agent implements a local certificate agent. The agent listens on a
+// unix socket, or a named pipe on Windows, and allows local processes that
+// cannot embed the Go client to request and renew certificates for the
+// identity of the machine it runs on.
+package agent
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/ca"
+	"github.com/smallstep/certificates/errs"
+)
+
+// Signer is the interface used by the agent to communicate with the CA. It's
+// implemented by *ca.Provisioner.
+type Signer interface {
+	Token(subject string, sans ...string) (string, error)
+	SignWithContext(ctx context.Context, req *api.SignRequest) (*api.SignResponse, error)
+	RenewWithTokenAndContext(ctx context.Context, token string) (*api.SignResponse, error)
+	RootsWithContext(ctx context.Context) (*api.RootsResponse, error)
+}
+
+var _ Signer = (*ca.Provisioner)(nil)
+
+// Option is the type of options passed to the Agent constructor.
+type Option func(a *Agent)
+
+// WithAllowedNames sets the names the agent is allowed to request
+// certificates for. If not set, the hostname of the machine will be used.
+func WithAllowedNames(names ...string) Option {
+	return func(a *Agent) {
+		a.names = names
+	}
+}
+
+// Agent is the local agent that requests and renews certificates on behalf of
+// local processes.
+type Agent struct {
+	signer Signer
+	names  []string
+}
+
+// New creates a new Agent using the given signer.
+func New(signer Signer, opts ...Option) (*Agent, error) {
+	a := &Agent{
+		signer: signer,
+	}
+	for _, fn := range opts {
+		fn(a)
+	}
+	if len(a.names) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting hostname")
+		}
+		a.names = []string{hostname}
+	}
+	return a, nil
+}
+
+// Route configures the http request router.
+func (a *Agent) Route(r api.Router) {
+	r.MethodFunc("GET", "/health", a.Health)
+	r.MethodFunc("GET", "/roots", a.Roots)
+	r.MethodFunc("POST", "/sign", a.Sign)
+	r.MethodFunc("POST", "/renew", a.Renew)
+}
+
+// Serve serves the agent endpoints on the given listener until the context is
+// done.
+func (a *Agent) Serve(ctx context.Context, l net.Listener) error {
+	mux := chi.NewRouter()
+	a.Route(mux)
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 15 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// Health is an HTTP handler that returns the status of the agent.
+func (a *Agent) Health(w http.ResponseWriter, _ *http.Request) {
+	render.JSON(w, api.HealthResponse{Status: "ok"})
+}
+
+// Roots is an HTTP handler that returns the roots of the CA.
+func (a *Agent) Roots(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.signer.RootsWithContext(r.Context())
+	if err != nil {
+		render.Error(w, errs.Wrap(http.StatusBadGateway, err, "agent.Roots"))
+		return
+	}
+	render.JSON(w, resp)
+}
+
+// Sign is an HTTP handler that signs the certificate request in the body if
+// all the names in it are allowed for this machine. The ott in the request is
+// ignored, the agent creates one using its provisioner.
+func (a *Agent) Sign(w http.ResponseWriter, r *http.Request) {
+	var body api.SignRequest
+	if err := read.JSON(r.Body, &body); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+		return
+	}
+
+	csr := body.CsrPEM.CertificateRequest
+	if csr == nil {
+		render.Error(w, errs.BadRequest("missing csr"))
+		return
+	}
+	if err := csr.CheckSignature(); err != nil {
+		render.Error(w, errs.BadRequestErr(err, "invalid csr"))
+		return
+	}
+
+	sans, err := a.authorizeNames(csr)
+	if err != nil {
+		render.Error(w, err)
+		return
+	}
+
+	subject := csr.Subject.CommonName
+	if subject == "" {
+		subject = sans[0]
+	}
+	token, err := a.signer.Token(subject, sans...)
+	if err != nil {
+		render.Error(w, errs.InternalServerErr(err, errs.WithMessage("error creating token")))
+		return
+	}
+	body.OTT = token
+
+	resp, err := a.signer.SignWithContext(r.Context(), &body)
+	if err != nil {
+		render.Error(w, errs.Wrap(http.StatusBadGateway, err, "agent.Sign"))
+		return
+	}
+	render.JSONStatus(w, resp, http.StatusCreated)
+}
+
+// Renew is an HTTP handler that renews a certificate using the renew token in
+// the Authorization header. The token must be signed by the key of the
+// certificate to renew.
+func (a *Agent) Renew(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		render.Error(w, errs.BadRequest("missing renew token"))
+		return
+	}
+	resp, err := a.signer.RenewWithTokenAndContext(r.Context(), token)
+	if err != nil {
+		render.Error(w, errs.Wrap(http.StatusBadGateway, err, "agent.Renew"))
+		return
+	}
+	render.JSONStatus(w, resp, http.StatusCreated)
+}
+
+// authorizeNames checks that all the names in the certificate request are
+// allowed and returns them.
+func (a *Agent) authorizeNames(csr *x509.CertificateRequest) ([]string, error) {
+	var sans []string
+	sans = append(sans, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, csr.EmailAddresses...)
+	for _, u := range csr.URIs {
+		sans = append(sans, u.String())
+	}
+
+	names := sans
+	if cn := csr.Subject.CommonName; cn != "" {
+		names = append(names, cn)
+	}
+	if len(names) == 0 {
+		return nil, errs.BadRequest("certificate request does not contain any name")
+	}
+	for _, name := range names {
+		if !a.isAllowed(name) {
+			return nil, errs.Forbidden("name %q is not allowed for this machine", name)
+		}
+	}
+	if len(sans) == 0 {
+		sans = []string{csr.Subject.CommonName}
+	}
+	return sans, nil
+}
+
+func (a *Agent) isAllowed(name string) bool {
+	for _, n := range a.names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
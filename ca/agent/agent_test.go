@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/api"
+)
+
+type mockSigner struct {
+	token    func(subject string, sans ...string) (string, error)
+	sign     func(ctx context.Context, req *api.SignRequest) (*api.SignResponse, error)
+	renew    func(ctx context.Context, token string) (*api.SignResponse, error)
+	getRoots func(ctx context.Context) (*api.RootsResponse, error)
+}
+
+func (m *mockSigner) Token(subject string, sans ...string) (string, error) {
+	return m.token(subject, sans...)
+}
+
+func (m *mockSigner) SignWithContext(ctx context.Context, req *api.SignRequest) (*api.SignResponse, error) {
+	return m.sign(ctx, req)
+}
+
+func (m *mockSigner) RenewWithTokenAndContext(ctx context.Context, token string) (*api.SignResponse, error) {
+	return m.renew(ctx, token)
+}
+
+func (m *mockSigner) RootsWithContext(ctx context.Context) (*api.RootsResponse, error) {
+	return m.getRoots(ctx)
+}
+
+func mustCSR(t *testing.T, cn string, dnsNames ...string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: dnsNames,
+	}, key)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	b, err := json.Marshal(api.SignRequest{CsrPEM: api.NewCertificateRequest(csr)})
+	require.NoError(t, err)
+	return b
+}
+
+func TestAgent_Sign(t *testing.T) {
+	signer := &mockSigner{
+		token: func(subject string, sans ...string) (string, error) {
+			assert.Equal(t, "host.example.com", strings.ToLower(subject))
+			return "the-token", nil
+		},
+		sign: func(ctx context.Context, req *api.SignRequest) (*api.SignResponse, error) {
+			assert.Equal(t, "the-token", req.OTT)
+			return &api.SignResponse{}, nil
+		},
+	}
+	a, err := New(signer, WithAllowedNames("host.example.com"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       []byte
+		wantStatus int
+	}{
+		{"ok", mustCSR(t, "host.example.com", "host.example.com"), http.StatusCreated},
+		{"ok case insensitive", mustCSR(t, "HOST.example.com"), http.StatusCreated},
+		{"fail forbidden", mustCSR(t, "host.example.com", "other.example.com"), http.StatusForbidden},
+		{"fail no names", mustCSR(t, ""), http.StatusBadRequest},
+		{"fail body", []byte("{"), http.StatusBadRequest},
+		{"fail no csr", []byte("{}"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			a.Sign(w, httptest.NewRequest("POST", "/sign", bytes.NewReader(tt.body)))
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestAgent_Renew(t *testing.T) {
+	a, err := New(&mockSigner{
+		renew: func(ctx context.Context, token string) (*api.SignResponse, error) {
+			if token != "the-token" {
+				return nil, errors.New("bad token")
+			}
+			return &api.SignResponse{}, nil
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{"ok", "Bearer the-token", http.StatusCreated},
+		{"fail missing", "", http.StatusBadRequest},
+		{"fail ca", "Bearer other-token", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/renew", http.NoBody)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			a.Renew(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+
+package agent
+
+import (
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultAddress is the default path of the unix socket used by the agent.
+const DefaultAddress = "/var/run/step-agent.sock"
+
+// Listen creates a unix socket listener on the given path. A stale socket
+// left by a previous run is removed. The socket is only accessible by the
+// owner and the group of the agent process, or the given group if not empty.
+func Listen(address, group string) (net.Listener, error) {
+	gid := -1
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error looking up group %s", group)
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return nil, errors.Wrapf(err, "error parsing id of group %s", group)
+		}
+	}
+
+	if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "error removing %s", address)
+	}
+
+	// Create the socket only accessible by the owner, so it cannot be opened
+	// by others before the permissions are set.
+	mask := syscall.Umask(0177)
+	l, err := net.Listen("unix", address)
+	syscall.Umask(mask)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listening on %s", address)
+	}
+	if gid != -1 {
+		if err := os.Chown(address, -1, gid); err != nil {
+			l.Close()
+			return nil, errors.Wrapf(err, "error setting group on %s", address)
+		}
+	}
+	if err := os.Chmod(address, 0660); err != nil {
+		l.Close()
+		return nil, errors.Wrapf(err, "error setting permissions on %s", address)
+	}
+	return l, nil
+}
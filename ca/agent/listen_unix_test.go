@@ -0,0 +1,90 @@
+//go:build !windows
+
+package agent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/smallstep/certificates/api"
+)
+
+func TestAgent_Serve(t *testing.T) {
+	a, err := New(&mockSigner{
+		getRoots: func(ctx context.Context) (*api.RootsResponse, error) {
+			return &api.RootsResponse{}, nil
+		},
+	})
+	require.NoError(t, err)
+
+	address := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := Listen(address, "")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- a.Serve(ctx, l)
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", address)
+			},
+		},
+	}
+	for _, path := range []string{"/health", "/roots"} {
+		resp, err := client.Get("http://agent" + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	cancel()
+	assert.NoError(t, <-errCh)
+}
+
+func TestListen(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := Listen(address, "")
+	require.NoError(t, err)
+	defer l.Close()
+
+	fi, err := os.Stat(address)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), fi.Mode().Perm())
+
+	_, err = Listen(filepath.Join(t.TempDir(), "agent.sock"), "step-agent-missing-group")
+	assert.Error(t, err)
+}
+
+func TestListen_group(t *testing.T) {
+	u, err := user.Current()
+	require.NoError(t, err)
+	g, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		t.Skipf("error looking up group %s: %v", u.Gid, err)
+	}
+
+	address := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := Listen(address, g.Name)
+	require.NoError(t, err)
+	defer l.Close()
+
+	fi, err := os.Stat(address)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), fi.Mode().Perm())
+	assert.Equal(t, u.Gid, strconv.FormatUint(uint64(fi.Sys().(*syscall.Stat_t).Gid), 10))
+}
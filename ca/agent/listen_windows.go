@@ -0,0 +1,38 @@
+//go:build windows
+
+package agent
+
+import (
+	"net"
+
+	"github.com/Microsoft/go-winio"
+	"github.com/pkg/errors"
+)
+
+// DefaultAddress is the default named pipe used by the agent.
+const DefaultAddress = `\\.\pipe\step-agent`
+
+// pipeSecurityDescriptor grants full access to SYSTEM and the built-in
+// administrators.
+const pipeSecurityDescriptor = "D:P(A;;GA;;;SY)(A;;GA;;;BA)"
+
+// Listen creates a named pipe listener with the given name. The pipe is only
+// accessible by SYSTEM and the administrators, and the given group if not
+// empty.
+func Listen(address, group string) (net.Listener, error) {
+	sd := pipeSecurityDescriptor
+	if group != "" {
+		sid, err := winio.LookupSidByName(group)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error looking up group %s", group)
+		}
+		sd += "(A;;GRGW;;;" + sid + ")"
+	}
+	l, err := winio.ListenPipe(address, &winio.PipeConfig{
+		SecurityDescriptor: sd,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listening on %s", address)
+	}
+	return l, nil
+}
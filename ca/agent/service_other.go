@@ -0,0 +1,12 @@
+//go:build !windows
+
+package agent
+
+import "context"
+
+// RunService runs the given function. Services are only supported on
+// Windows, on other platforms fn is run directly and the process is expected
+// to be managed by the init system.
+func RunService(ctx context.Context, _ string, fn func(context.Context) error) error {
+	return fn(ctx)
+}
@@ -0,0 +1,70 @@
+//go:build windows
+
+package agent
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows/svc"
+)
+
+// RunService runs the given function. If the process has been started by the
+// Windows service manager, it will run as a service with the given name, and
+// the context passed to fn will be canceled when the service is stopped.
+func RunService(ctx context.Context, name string, fn func(context.Context) error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return errors.Wrap(err, "error checking windows service")
+	}
+	if !isService {
+		return fn(ctx)
+	}
+
+	h := &serviceHandler{fn: fn, ctx: ctx}
+	if err := svc.Run(name, h); err != nil {
+		return errors.Wrapf(err, "error running service %s", name)
+	}
+	return h.err
+}
+
+type serviceHandler struct {
+	ctx context.Context
+	fn  func(context.Context) error
+	err error
+}
+
+// Execute implements the svc.Handler interface.
+func (h *serviceHandler) Execute(_ []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	s <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(h.ctx)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- h.fn(ctx)
+	}()
+
+	s <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case h.err = <-errCh:
+			s <- svc.Status{State: svc.StopPending}
+			if h.err != nil {
+				return true, 1
+			}
+			return false, 0
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				s <- svc.Status{State: svc.StopPending}
+				cancel()
+				h.err = <-errCh
+				return false, 0
+			}
+		}
+	}
+}
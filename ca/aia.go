@@ -0,0 +1,273 @@
+package ca
+
+import (
+	"container/list"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultAIAMaxDepth is the default maximum number of intermediates that
+	// will be fetched while verifying a chain.
+	defaultAIAMaxDepth = 5
+	// maxAIAResponseSize is the maximum size of an AIA response, certificates
+	// larger than this are not expected.
+	maxAIAResponseSize = 1 << 20
+	// defaultAIACacheSize is the default maximum number of fetched
+	// certificates kept in the cache.
+	defaultAIACacheSize = 100
+	// defaultAIACacheTTL is the default time a fetched certificate is kept in
+	// the cache.
+	defaultAIACacheTTL = 24 * time.Hour
+)
+
+// AIAChaserOption is the type of options passed to the AIAChaser constructor.
+type AIAChaserOption func(a *AIAChaser)
+
+// WithAIAMaxDepth sets the maximum number of intermediate certificates that
+// will be fetched to complete a chain.
+func WithAIAMaxDepth(depth int) AIAChaserOption {
+	return func(a *AIAChaser) {
+		a.maxDepth = depth
+	}
+}
+
+// WithAIAHTTPClient sets the HTTP client used to fetch the issuing
+// certificates.
+func WithAIAHTTPClient(client *http.Client) AIAChaserOption {
+	return func(a *AIAChaser) {
+		a.client = client
+	}
+}
+
+// WithAIACache sets the maximum number of fetched certificates kept in the
+// cache and the time they are kept. The least recently used certificate is
+// removed when the cache is full.
+func WithAIACache(size int, ttl time.Duration) AIAChaserOption {
+	return func(a *AIAChaser) {
+		if size > 0 {
+			a.cacheSize = size
+		}
+		if ttl > 0 {
+			a.cacheTTL = ttl
+		}
+	}
+}
+
+// AIAChaser verifies certificate chains and, if an issuer is missing, fetches
+// it from the URLs in the Authority Information Access extension. Fetched
+// certificates are cached by URL in a bounded LRU cache until they expire or
+// the cache TTL passes, and the same URL is never fetched twice while
+// verifying a chain, preventing loops.
+type AIAChaser struct {
+	client    *http.Client
+	maxDepth  int
+	cacheSize int
+	cacheTTL  time.Duration
+	mu        sync.Mutex
+	cache     map[string]*list.Element
+	lru       *list.List
+}
+
+type aiaCacheEntry struct {
+	url       string
+	crt       *x509.Certificate
+	expiresAt time.Time
+}
+
+// NewAIAChaser creates a new AIAChaser with the given options.
+func NewAIAChaser(opts ...AIAChaserOption) *AIAChaser {
+	a := &AIAChaser{
+		client:    &http.Client{Timeout: 10 * time.Second},
+		maxDepth:  defaultAIAMaxDepth,
+		cacheSize: defaultAIACacheSize,
+		cacheTTL:  defaultAIACacheTTL,
+		cache:     make(map[string]*list.Element),
+		lru:       list.New(),
+	}
+	for _, fn := range opts {
+		fn(a)
+	}
+	return a
+}
+
+// Verify verifies the leaf certificate using the given intermediates and
+// options. If the chain cannot be built because an issuer is missing, the
+// issuing certificates will be fetched following the AIA extension until the
+// chain is completed or the maximum depth is reached.
+func (a *AIAChaser) Verify(ctx context.Context, leaf *x509.Certificate, intermediates []*x509.Certificate, opts x509.VerifyOptions) ([][]*x509.Certificate, error) {
+	if leaf == nil {
+		return nil, errors.New("leaf certificate cannot be nil")
+	}
+
+	pool := x509.NewCertPool()
+	for _, crt := range intermediates {
+		pool.AddCert(crt)
+	}
+	opts.Intermediates = pool
+
+	chains, err := leaf.Verify(opts)
+	if err == nil {
+		return chains, nil
+	}
+	var unknownAuthority x509.UnknownAuthorityError
+	if !errors.As(err, &unknownAuthority) {
+		return nil, err
+	}
+
+	// Fetch the issuers breadth first, starting with the leaf and the given
+	// intermediates, as any of them can be the one with the missing issuer.
+	var fetchErr error
+	visited := make(map[string]bool)
+	pending := append([]*x509.Certificate{leaf}, intermediates...)
+	for depth := 0; depth < a.maxDepth && len(pending) > 0; depth++ {
+		var next []*x509.Certificate
+		for _, crt := range pending {
+			for _, u := range crt.IssuingCertificateURL {
+				if visited[u] {
+					continue
+				}
+				visited[u] = true
+				issuer, ferr := a.fetch(ctx, u)
+				if ferr != nil {
+					fetchErr = ferr
+					continue
+				}
+				pool.AddCert(issuer)
+				next = append(next, issuer)
+			}
+		}
+		if len(next) == 0 {
+			break
+		}
+		if chains, err = leaf.Verify(opts); err == nil {
+			return chains, nil
+		}
+		pending = next
+	}
+
+	if fetchErr != nil {
+		return nil, errors.Wrapf(err, "error verifying certificate chain: last AIA fetch failed: %v", fetchErr)
+	}
+	return nil, errors.Wrap(err, "error verifying certificate chain")
+}
+
+// fetch returns the certificate in the given url, using the cache if
+// available.
+func (a *AIAChaser) fetch(ctx context.Context, u string) (*x509.Certificate, error) {
+	if crt, ok := a.cached(u); ok {
+		return crt, nil
+	}
+
+	if uu, err := url.Parse(u); err != nil || (uu.Scheme != "http" && uu.Scheme != "https") {
+		return nil, errors.Errorf("unsupported AIA url %s", u)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create GET %s request failed", u)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, clientError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error fetching %s: status code %d", u, resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxAIAResponseSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	// RFC 5280 requires DER, but some servers use PEM.
+	if block, _ := pem.Decode(b); block != nil && block.Type == "CERTIFICATE" {
+		b = block.Bytes
+	}
+	crt, err := x509.ParseCertificate(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing certificate from %s", u)
+	}
+
+	a.store(u, crt)
+	return crt, nil
+}
+
+// cached returns the certificate cached for the given url if it has not
+// expired, and marks it as the most recently used.
+func (a *AIAChaser) cached(u string) (*x509.Certificate, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	e, ok := a.cache[u]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*aiaCacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		a.lru.Remove(e)
+		delete(a.cache, u)
+		return nil, false
+	}
+	a.lru.MoveToFront(e)
+	return entry.crt, true
+}
+
+// store adds the certificate to the cache, removing the least recently used
+// one if the cache is full. Certificates are not cached after they expire.
+func (a *AIAChaser) store(u string, crt *x509.Certificate) {
+	expiresAt := time.Now().Add(a.cacheTTL)
+	if crt.NotAfter.Before(expiresAt) {
+		expiresAt = crt.NotAfter
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if e, ok := a.cache[u]; ok {
+		a.lru.Remove(e)
+	}
+	a.cache[u] = a.lru.PushFront(&aiaCacheEntry{url: u, crt: crt, expiresAt: expiresAt})
+	for a.lru.Len() > a.cacheSize {
+		e := a.lru.Back()
+		a.lru.Remove(e)
+		delete(a.cache, e.Value.(*aiaCacheEntry).url)
+	}
+}
+
+// VerifyChain verifies the given certificate chain against the roots and
+// federated roots of the CA, completing it with the AIA extension if
+// necessary. The first certificate in the chain must be the leaf.
+func (c *Client) VerifyChain(ctx context.Context, chain []*x509.Certificate, keyUsages ...x509.ExtKeyUsage) ([][]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, errors.New("certificate chain cannot be empty")
+	}
+
+	federation, err := c.FederationWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	for _, crt := range federation.Certificates {
+		roots.AddCert(crt.Certificate)
+	}
+
+	if len(keyUsages) == 0 {
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+
+	c.aiaOnce.Do(func() {
+		c.aia = NewAIAChaser()
+	})
+	return c.aia.Verify(ctx, chain[0], chain[1:], x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: keyUsages,
+	})
+}
@@ -0,0 +1,165 @@
+package ca
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+)
+
+func mustAIACertificate(t *testing.T, cn string, isCA bool, aia string, parent *x509.Certificate, signer *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if aia != "" {
+		tmpl.IssuingCertificateURL = []string{aia}
+	}
+	if parent == nil {
+		parent, signer = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), signer)
+	require.NoError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return crt, key
+}
+
+func TestAIAChaser_Verify(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	var requests int32
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/intermediate.crt", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(ca.Intermediate.Raw)
+	})
+
+	// Leaf with an AIA pointing to the intermediate.
+	leaf, _ := mustAIACertificate(t, "leaf", false, srv.URL+"/intermediate.crt", ca.Intermediate, ca.Signer.(*ecdsa.PrivateKey))
+	// Leaf with an AIA pointing to nowhere.
+	orphan, _ := mustAIACertificate(t, "orphan", false, srv.URL+"/missing.crt", ca.Intermediate, ca.Signer.(*ecdsa.PrivateKey))
+
+	// Two intermediates signing each other with AIAs pointing to each
+	// other.
+	loopRoot, loopKey := mustAIACertificate(t, "loop root", true, "", nil, nil)
+	loopA, loopAKey := mustAIACertificate(t, "loop a", true, srv.URL+"/b.crt", loopRoot, loopKey)
+	loopB, _ := mustAIACertificate(t, "loop b", true, srv.URL+"/a.crt", loopA, loopAKey)
+	loopLeaf, _ := mustAIACertificate(t, "loop leaf", false, srv.URL+"/a.crt", loopA, loopAKey)
+	mux.HandleFunc("/a.crt", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(loopB.Raw)
+	})
+	mux.HandleFunc("/b.crt", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(loopB.Raw)
+	})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Root)
+	opts := x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+
+	ctx := context.Background()
+	a := NewAIAChaser(WithAIAHTTPClient(srv.Client()))
+
+	t.Run("ok with intermediates", func(t *testing.T) {
+		chains, err := a.Verify(ctx, leaf, []*x509.Certificate{ca.Intermediate}, opts)
+		require.NoError(t, err)
+		assert.Len(t, chains[0], 3)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("ok with aia", func(t *testing.T) {
+		chains, err := a.Verify(ctx, leaf, nil, opts)
+		require.NoError(t, err)
+		assert.Equal(t, []*x509.Certificate{leaf, ca.Intermediate, ca.Root}, chains[0])
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("ok cached", func(t *testing.T) {
+		_, err := a.Verify(ctx, leaf, nil, opts)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	})
+
+	t.Run("fail missing", func(t *testing.T) {
+		_, err := a.Verify(ctx, orphan, nil, opts)
+		assert.ErrorContains(t, err, "last AIA fetch failed")
+		assert.ErrorContains(t, err, "status code 404")
+	})
+
+	t.Run("fail loop", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		_, err := a.Verify(ctx, loopLeaf, nil, opts)
+		assert.Error(t, err)
+		assert.LessOrEqual(t, atomic.LoadInt32(&requests), int32(2))
+	})
+
+	t.Run("fail nil", func(t *testing.T) {
+		_, err := a.Verify(ctx, nil, nil, opts)
+		assert.Error(t, err)
+	})
+}
+
+func TestAIAChaser_cache(t *testing.T) {
+	crt := func(notAfter time.Time) *x509.Certificate {
+		return &x509.Certificate{NotAfter: notAfter}
+	}
+	later := time.Now().Add(time.Hour)
+
+	a := NewAIAChaser(WithAIACache(2, time.Minute))
+	a.store("a", crt(later))
+	a.store("b", crt(later))
+
+	// The least recently used certificate is removed.
+	_, ok := a.cached("a")
+	assert.True(t, ok)
+	a.store("c", crt(later))
+	_, ok = a.cached("b")
+	assert.False(t, ok)
+	_, ok = a.cached("a")
+	assert.True(t, ok)
+	_, ok = a.cached("c")
+	assert.True(t, ok)
+
+	// Certificates are not cached after the TTL or after they expire.
+	a.mu.Lock()
+	a.cache["a"].Value.(*aiaCacheEntry).expiresAt = time.Now().Add(-time.Second)
+	a.mu.Unlock()
+	_, ok = a.cached("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, a.lru.Len())
+
+	expired := crt(time.Now().Add(-time.Second))
+	a.store("expired", expired)
+	_, ok = a.cached("expired")
+	assert.False(t, ok)
+}
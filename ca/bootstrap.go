@@ -4,23 +4,47 @@ import (
 	"context"
 	"crypto"
 	"crypto/tls"
+	"encoding/pem"
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/api"
 	"go.step.sm/crypto/jose"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 type tokenClaims struct {
-	SHA string `json:"sha"`
+	SHA  string   `json:"sha"`
+	SHAs []string `json:"shas,omitempty"`
 	jose.Claims
 }
 
+// fingerprints returns the fingerprints of all the roots in the token.
+func (c *tokenClaims) fingerprints() []string {
+	return append([]string{c.SHA}, c.SHAs...)
+}
+
 // Bootstrap is a helper function that initializes a client with the
 // configuration in the bootstrap token.
+//
+// If the aud claim contains multiple URLs, the first one is used as the CA
+// endpoint and the rest as failover endpoints. The optional shas claim can
+// contain the fingerprints of additional roots.
 func Bootstrap(token string) (*Client, error) {
+	claims, err := parseBootstrapToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(claims.Audience[0],
+		WithRootFingerprints(claims.fingerprints()...),
+		WithFailoverEndpoints(claims.Audience[1:]...))
+}
+
+func parseBootstrapToken(token string) (*tokenClaims, error) {
 	tok, err := jose.ParseSigned(token)
 	if err != nil {
 		return nil, errors.Wrap(err, "error parsing token")
@@ -34,11 +58,16 @@ func Bootstrap(token string) (*Client, error) {
 	switch {
 	case claims.SHA == "":
 		return nil, errors.New("invalid bootstrap token: sha claim is not present")
-	case !strings.HasPrefix(strings.ToLower(claims.Audience[0]), "http"):
-		return nil, errors.New("invalid bootstrap token: aud claim is not a url")
+	case len(claims.Audience) == 0:
+		return nil, errors.New("invalid bootstrap token: aud claim is not present")
+	}
+	for _, aud := range claims.Audience {
+		if !strings.HasPrefix(strings.ToLower(aud), "http") {
+			return nil, errors.New("invalid bootstrap token: aud claim is not a url")
+		}
 	}
 
-	return NewClient(claims.Audience[0], WithRootSHA256(claims.SHA))
+	return &claims, nil
 }
 
 // BootstrapClient is a helper function that using the given bootstrap token
@@ -61,7 +90,7 @@ func Bootstrap(token string) (*Client, error) {
 //	}
 //	resp, err := client.Get("https://internal.smallstep.com")
 func BootstrapClient(ctx context.Context, token string, options ...TLSOption) (*http.Client, error) {
-	b, err := createBootstrap(token) //nolint:contextcheck // deeply nested context; temporary
+	b, err := createBootstrap(ctx, token)
 	if err != nil {
 		return nil, err
 	}
@@ -120,7 +149,7 @@ func BootstrapServer(ctx context.Context, token string, base *http.Server, optio
 		return nil, errors.New("server TLSConfig is already set")
 	}
 
-	b, err := createBootstrap(token) //nolint:contextcheck // deeply nested context; temporary
+	b, err := createBootstrap(ctx, token)
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +198,7 @@ func BootstrapServer(ctx context.Context, token string, base *http.Server, optio
 //	... // register services
 //	srv.Serve(lis)
 func BootstrapListener(ctx context.Context, token string, inner net.Listener, options ...TLSOption) (net.Listener, error) {
-	b, err := createBootstrap(token) //nolint:contextcheck // deeply nested context; temporary
+	b, err := createBootstrap(ctx, token)
 	if err != nil {
 		return nil, err
 	}
@@ -191,6 +220,91 @@ func BootstrapListener(ctx context.Context, token string, inner net.Listener, op
 	return tls.NewListener(inner, tlsConfig), nil
 }
 
+// BootstrapGRPCServer is a helper function that using the given token returns
+// a grpc.ServerOption that configures a gRPC server with a TLS certificate
+// signed by the Certificate Authority. By default the server will kick off a
+// routine that will renew the certificate after 2/3rd of the certificate's
+// lifetime has expired.
+//
+// Without any extra option the server will be configured for mTLS, it will
+// require and verify clients certificates, but options can be used to drop this
+// requirement, the most common will be only verify the certs if given with
+// ca.VerifyClientCertIfGiven(), or add extra CAs with
+// ca.AddClientCA(*x509.Certificate).
+//
+// Usage:
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	defer cancel()
+//	creds, err := ca.BootstrapGRPCServer(ctx, token)
+//	if err != nil {
+//	    return err
+//	}
+//	srv := grpc.NewServer(creds)
+//	... // register services
+//	srv.Serve(lis)
+func BootstrapGRPCServer(ctx context.Context, token string, options ...TLSOption) (grpc.ServerOption, error) {
+	b, err := createBootstrap(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the tlsConfig has all supported roots on ClientCAs.
+	//
+	// The roots request is only supported if identity certificates are not
+	// required. In all cases the current root is also added after applying all
+	// options too.
+	if !b.RequireClientAuth {
+		options = append(options, AddRootsToCAs())
+	}
+
+	tlsConfig, err := b.Client.GetServerTLSConfig(ctx, b.SignResponse, b.PrivateKey, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpc.Creds(credentials.NewTLS(tlsConfig)), nil
+}
+
+// BootstrapGRPCClientCredentials is a helper function that using the given
+// bootstrap token returns the transport credentials of a gRPC client, prepared
+// to do TLS connections using the client certificate returned by the
+// certificate authority. By default the credentials will kick off a routine
+// that will renew the certificate after 2/3rd of the certificate's lifetime
+// has expired.
+//
+// Usage:
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	defer cancel()
+//	creds, err := ca.BootstrapGRPCClientCredentials(ctx, token)
+//	if err != nil {
+//	    return err
+//	}
+//	conn, err := grpc.Dial("internal.smallstep.com:443", grpc.WithTransportCredentials(creds))
+func BootstrapGRPCClientCredentials(ctx context.Context, token string, options ...TLSOption) (credentials.TransportCredentials, error) {
+	b, err := createBootstrap(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the tlsConfig has all supported roots on RootCAs.
+	//
+	// The roots request is only supported if identity certificates are not
+	// required. In all cases the current root is also added after applying all
+	// options too.
+	if !b.RequireClientAuth {
+		options = append(options, AddRootsToRootCAs())
+	}
+
+	tlsConfig, err := b.Client.GetClientTLSConfig(ctx, b.SignResponse, b.PrivateKey, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
 type bootstrap struct {
 	Client            *Client
 	RequireClientAuth bool
@@ -198,12 +312,46 @@ type bootstrap struct {
 	PrivateKey        crypto.PrivateKey
 }
 
-func createBootstrap(token string) (*bootstrap, error) {
-	client, err := Bootstrap(token)
+func createBootstrap(ctx context.Context, token string) (*bootstrap, error) {
+	claims, err := parseBootstrapToken(token)
 	if err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
+	cache := certificateCacheFromContext(ctx)
+	cached, err := cache.load(claims.fingerprints())
+	if err != nil || !cached.isValid(now) {
+		client, err := Bootstrap(token)
+		if err != nil {
+			return nil, err
+		}
+		b, err := signBootstrap(client, token)
+		if err != nil {
+			return nil, err
+		}
+		if err := cache.store(b.SignResponse, b.PrivateKey); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	// The cached root matches the bootstrap token, so it can be used without
+	// requesting it to the CA.
+	client, err := NewClient(claims.Audience[0], WithCABundle(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cached.Root.Raw,
+	})), WithFailoverEndpoints(claims.Audience[1:]...))
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the cached certificate, the renewer will renew it if it has reached
+	// the renewal time. This allows to start while the CA is not reachable.
+	return createCachedBootstrap(client, cached), nil
+}
+
+func signBootstrap(client *Client, token string) (*bootstrap, error) {
 	version, err := client.Version()
 	if err != nil {
 		return nil, err
@@ -226,3 +374,19 @@ func createBootstrap(token string) (*bootstrap, error) {
 		PrivateKey:        pk,
 	}, nil
 }
+
+// createCachedBootstrap returns the bootstrap for a cached certificate. If
+// the CA is not reachable, it will assume that client authentication is
+// required, so the roots are not requested.
+func createCachedBootstrap(client *Client, cached *cachedCertificate) *bootstrap {
+	requireClientAuth := true
+	if version, err := client.Version(); err == nil {
+		requireClientAuth = version.RequireClientAuthentication
+	}
+	return &bootstrap{
+		Client:            client,
+		RequireClientAuth: requireClientAuth,
+		SignResponse:      cached.SignResponse,
+		PrivateKey:        cached.PrivateKey,
+	}
+}
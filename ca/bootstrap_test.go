@@ -18,6 +18,9 @@ import (
 
 	"go.step.sm/crypto/jose"
 	"go.step.sm/crypto/randutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/api/render"
@@ -54,7 +57,7 @@ func startCABootstrapServer() *httptest.Server {
 	if err != nil {
 		panic(err)
 	}
-	baseContext := buildContext(ca.auth, nil, nil, nil)
+	baseContext := buildContext(ca.auth, nil, nil, nil, nil)
 	srv.Config.Handler = ca.srv.Handler
 	srv.Config.BaseContext = func(net.Listener) context.Context {
 		return baseContext
@@ -691,3 +694,81 @@ func TestBootstrapListener(t *testing.T) {
 		})
 	}
 }
+
+func TestBootstrapGRPC(t *testing.T) {
+	srv := startCABootstrapServer()
+	defer srv.Close()
+	token := func() string {
+		return generateBootstrapToken(srv.URL, "127.0.0.1", "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7")
+	}
+
+	mtlsServer := startCABootstrapServer()
+	next := mtlsServer.Config.Handler
+	mtlsServer.Config.Handler = mTLSMiddleware(next, "/root/", "/sign")
+	defer mtlsServer.Close()
+	mtlsToken := func() string {
+		return generateBootstrapToken(mtlsServer.URL, "127.0.0.1", "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7")
+	}
+
+	type args struct {
+		token string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{"ok", args{token()}, false},
+		{"ok mtls", args{mtlsToken()}, false},
+		{"fail", args{"bad-token"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			opt, err := BootstrapGRPCServer(ctx, tt.args.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BootstrapGRPCServer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				if opt != nil {
+					t.Errorf("BootstrapGRPCServer() = %v, want nil", opt)
+				}
+				return
+			}
+
+			lis := newLocalListener()
+			s := grpc.NewServer(opt)
+			healthpb.RegisterHealthServer(s, health.NewServer())
+			go s.Serve(lis)
+			defer s.Stop()
+
+			creds, err := BootstrapGRPCClientCredentials(ctx, token())
+			if err != nil {
+				t.Errorf("BootstrapGRPCClientCredentials() error = %v", err)
+				return
+			}
+			conn, err := grpc.DialContext(ctx, lis.Addr().String(), grpc.WithTransportCredentials(creds))
+			if err != nil {
+				t.Errorf("grpc.DialContext() error = %v", err)
+				return
+			}
+			defer conn.Close()
+
+			resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+			if err != nil {
+				t.Errorf("HealthClient.Check() error = %v", err)
+				return
+			}
+			if resp.Status != healthpb.HealthCheckResponse_SERVING {
+				t.Errorf("HealthClient.Check() = %v, want %v", resp.Status, healthpb.HealthCheckResponse_SERVING)
+			}
+		})
+	}
+
+	if _, err := BootstrapGRPCClientCredentials(context.Background(), "bad-token"); err == nil {
+		t.Error("BootstrapGRPCClientCredentials() error = nil, wantErr true")
+	}
+}
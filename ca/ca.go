@@ -22,18 +22,22 @@ import (
 	acmeAPI "github.com/smallstep/certificates/acme/api"
 	acmeNoSQL "github.com/smallstep/certificates/acme/db/nosql"
 	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/admin"
 	adminAPI "github.com/smallstep/certificates/authority/admin/api"
 	"github.com/smallstep/certificates/authority/config"
 	"github.com/smallstep/certificates/db"
+	"github.com/smallstep/certificates/internal/metrix"
 	"github.com/smallstep/certificates/logging"
 	"github.com/smallstep/certificates/monitoring"
+	"github.com/smallstep/certificates/ocsp"
 	"github.com/smallstep/certificates/scep"
 	scepAPI "github.com/smallstep/certificates/scep/api"
 	"github.com/smallstep/certificates/server"
 	"github.com/smallstep/nosql"
 	"go.step.sm/cli-utils/step"
+	"go.step.sm/crypto/pemutil"
 	"go.step.sm/crypto/x509util"
 )
 
@@ -46,6 +50,7 @@ type options struct {
 	sshHostPassword []byte
 	sshUserPassword []byte
 	database        db.AuthDB
+	meter           *metrix.Meter
 }
 
 func (o *options) apply(opts []Option) {
@@ -111,6 +116,14 @@ func WithLinkedCAToken(token string) Option {
 	}
 }
 
+// withMeter sets the meter used to collect the metrics, it's used to keep the
+// metrics on reloads.
+func withMeter(m *metrix.Meter) Option {
+	return func(o *options) {
+		o.meter = m
+	}
+}
+
 // WithQuiet sets the quiet flag.
 func WithQuiet(quiet bool) Option {
 	return func(o *options) {
@@ -125,8 +138,12 @@ type CA struct {
 	config      *config.Config
 	srv         *server.Server
 	insecureSrv *server.Server
+	metricsSrv  *server.Server
 	opts        *options
 	renewer     *TLSRenewer
+	acmeQueue   *acme.ValidationQueue
+	acmeNonces  *acme.NonceStore
+	acmeLimits  *acme.RateLimitCleaner
 	compactStop chan struct{}
 }
 
@@ -163,6 +180,14 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		opts = append(opts, authority.WithQuietInit())
 	}
 
+	// Collect metrics if the metrics listener is configured.
+	if cfg.MetricsAddress != "" {
+		if ca.opts.meter == nil {
+			ca.opts.meter = metrix.New()
+		}
+		opts = append(opts, authority.WithMeter(ca.opts.meter))
+	}
+
 	webhookTransport := http.DefaultTransport.(*http.Transport).Clone()
 	opts = append(opts, authority.WithWebhookClient(&http.Client{Transport: webhookTransport}))
 
@@ -199,6 +224,25 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	// Mount the CRL to the insecure mux
 	insecureMux.Get("/crl", api.CRL)
 	insecureMux.Get("/1.0/crl", api.CRL)
+	if cfg.CRL.IsEnabled() && cfg.CRL.Path != "" {
+		insecureMux.Get(cfg.CRL.Path, api.CRL)
+	}
+
+	// Mount the issuing intermediate to the insecure mux, it's the caIssuers
+	// URL of the issued certificates.
+	insecureMux.Get("/intermediate", api.Intermediate)
+	insecureMux.Get("/1.0/intermediate", api.Intermediate)
+
+	// Mount the OCSP responder to the insecure mux, OCSP requests are
+	// usually sent using HTTP. See RFC 6960, appendix A.1.
+	if responder := auth.GetOCSP(); responder != nil {
+		ocspHandler := ocsp.NewHandler(responder)
+		insecureMux.Route("/ocsp", ocspHandler.Route)
+		insecureMux.Route("/1.0/ocsp", ocspHandler.Route)
+		if cfg.OCSP.Path != "" {
+			insecureMux.Route(cfg.OCSP.Path, ocspHandler.Route)
+		}
+	}
 
 	// Add ACME api endpoints in /acme and /1.0/acme
 	dns := cfg.DNSNames[0]
@@ -214,12 +258,30 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	// ACME Router is only available if we have a database.
 	var acmeDB acme.DB
 	var acmeLinker acme.Linker
+	var acmeClient acme.Client
+	var acmePerspectives *acme.MultiPerspectiveValidator
+	var acmeRevocation *acme.RevocationChecker
 	if cfg.DB != nil {
 		acmeDB, err = acmeNoSQL.New(auth.GetDatabase().(nosql.DB))
 		if err != nil {
 			return nil, errors.Wrap(err, "error configuring ACME DB interface")
 		}
-		acmeLinker = acme.NewLinker(dns, "acme")
+		acmeLinker = acme.NewLinker(dns, "acme", acme.WithBaseURL(cfg.ExternalURL.BaseURL()))
+		acmeClient, err = newACMEClient(cfg.ACME)
+		if err != nil {
+			return nil, errors.Wrap(err, "error configuring ACME validation client")
+		}
+		acmePerspectives, err = newACMEPerspectives(cfg.ACME)
+		if err != nil {
+			return nil, errors.Wrap(err, "error configuring ACME multi-perspective validation")
+		}
+		acmeRevocation = newACMERevocationChecker(cfg.ACME)
+		ca.acmeNonces, err = newACMENonces(cfg.ACME, acmeDB)
+		if err != nil {
+			return nil, errors.Wrap(err, "error configuring ACME nonces")
+		}
+		ca.acmeQueue = acme.NewValidationQueue(0)
+		ca.acmeLimits = acme.NewRateLimitCleaner(acmeDB, time.Hour)
 		mux.Route("/acme", func(r chi.Router) {
 			acmeAPI.Route(r)
 		})
@@ -298,7 +360,19 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 	}
 
 	// Create context with all the necessary values.
-	baseContext := buildContext(auth, scepAuthority, acmeDB, acmeLinker)
+	baseContext := buildContext(auth, scepAuthority, acmeDB, acmeClient, acmeLinker)
+	if ca.acmeQueue != nil {
+		baseContext = acme.NewValidationQueueContext(baseContext, ca.acmeQueue)
+	}
+	if ca.acmeNonces != nil {
+		baseContext = acme.NewNonceServiceContext(baseContext, ca.acmeNonces)
+	}
+	if acmePerspectives != nil {
+		baseContext = acme.NewMultiPerspectiveContext(baseContext, acmePerspectives)
+	}
+	if acmeRevocation != nil {
+		baseContext = acme.NewRevocationCheckerContext(baseContext, acmeRevocation)
+	}
 
 	ca.srv = server.New(cfg.Address, handler, tlsConfig)
 	ca.srv.BaseContext = func(net.Listener) context.Context {
@@ -318,13 +392,23 @@ func (ca *CA) Init(cfg *config.Config) (*CA, error) {
 		}
 	}
 
+	// Serve the metrics on a separate listener, so they are not exposed with
+	// the CA endpoints.
+	if meter := auth.GetMeter(); meter != nil {
+		metricsMux := chi.NewRouter()
+		metricsMux.Method(http.MethodGet, "/metrics", meter)
+		metricsMux.Method(http.MethodHead, "/metrics", meter)
+		ca.metricsSrv = server.New(cfg.MetricsAddress, metricsMux, nil)
+	}
+
 	return ca, nil
 }
 
 // shouldServeInsecureServer returns whether or not the insecure
 // server should also be started. This is (currently) only the case
 // if the insecure address has been configured AND when a SCEP
-// provisioner is configured or when a CRL is configured.
+// provisioner is configured, when a CRL is configured, or when the
+// OCSP responder is enabled.
 func (ca *CA) shouldServeInsecureServer() bool {
 	switch {
 	case ca.config.InsecureAddress == "":
@@ -333,13 +417,15 @@ func (ca *CA) shouldServeInsecureServer() bool {
 		return true
 	case ca.config.CRL.IsEnabled():
 		return true
+	case ca.config.OCSP.IsEnabled():
+		return true
 	default:
 		return false
 	}
 }
 
 // buildContext builds the server base context.
-func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB acme.DB, acmeLinker acme.Linker) context.Context {
+func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB acme.DB, acmeClient acme.Client, acmeLinker acme.Linker) context.Context {
 	ctx := authority.NewContext(context.Background(), a)
 	if authDB := a.GetDatabase(); authDB != nil {
 		ctx = db.NewContext(ctx, authDB)
@@ -347,15 +433,212 @@ func buildContext(a *authority.Authority, scepAuthority *scep.Authority, acmeDB
 	if adminDB := a.GetAdminDatabase(); adminDB != nil {
 		ctx = admin.NewContext(ctx, adminDB)
 	}
+	if auditLogger := a.GetAuditLogger(); auditLogger != nil {
+		ctx = audit.NewContext(ctx, auditLogger)
+	}
+	if meter := a.GetMeter(); meter != nil {
+		ctx = metrix.NewContext(ctx, meter)
+	}
 	if scepAuthority != nil {
 		ctx = scep.NewContext(ctx, scepAuthority)
 	}
 	if acmeDB != nil {
-		ctx = acme.NewContext(ctx, acmeDB, acme.NewClient(), acmeLinker, nil)
+		if acmeClient == nil {
+			acmeClient = acme.NewClient()
+		}
+		ctx = acme.NewContext(ctx, acmeDB, acmeClient, acmeLinker, nil)
 	}
 	return ctx
 }
 
+// newACMEClient creates the client used to validate the ACME challenges.
+func newACMEClient(cfg *config.ACMEConfig) (acme.Client, error) {
+	if cfg == nil || cfg.Validation == nil {
+		return acme.NewClient(), nil
+	}
+
+	var clientOpts []acme.ClientOption
+	if dns := cfg.Validation.DNS; dns != nil {
+		opts := acme.DNSResolverOptions{
+			Servers:       dns.Resolvers,
+			Authoritative: dns.Authoritative,
+		}
+		if dns.Timeout != nil {
+			opts.Timeout = dns.Timeout.Duration
+		}
+		resolver, err := acme.NewDNSResolver(opts)
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, acme.WithDNSResolver(resolver))
+	}
+
+	if e := cfg.Validation.Egress; e != nil {
+		if e.Proxy != "" {
+			u, err := url.Parse(e.Proxy)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing acme.validation.egress.proxy")
+			}
+			clientOpts = append(clientOpts, acme.WithProxy(u))
+		}
+		if e.SourceAddress != "" {
+			ips, err := sourceAddress(e.SourceAddress)
+			if err != nil {
+				return nil, err
+			}
+			clientOpts = append(clientOpts, acme.WithSourceAddress(ips...))
+		}
+		if e.DialTimeout != nil && e.DialTimeout.Duration > 0 {
+			clientOpts = append(clientOpts, acme.WithDialTimeout(e.DialTimeout.Duration))
+		}
+		if e.Timeout != nil && e.Timeout.Duration > 0 {
+			clientOpts = append(clientOpts, acme.WithTimeout(e.Timeout.Duration))
+		}
+		if e.MaxRedirects != nil {
+			clientOpts = append(clientOpts, acme.WithMaxRedirects(*e.MaxRedirects))
+		}
+	}
+
+	return acme.NewClient(clientOpts...), nil
+}
+
+// sourceAddress returns the IP addresses for the given source address, an IP
+// address or the name of a network interface. For interfaces, it returns the
+// first IPv4 and the first IPv6 address, so destinations of both families can
+// be reached.
+func sourceAddress(s string) ([]net.IP, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	iface, err := net.InterfaceByName(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error looking up acme.validation.egress.sourceAddress %q", s)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error looking up acme.validation.egress.sourceAddress %q", s)
+	}
+	return interfaceSourceAddresses(s, addrs)
+}
+
+// interfaceSourceAddresses returns the first IPv4 and IPv6 addresses of the
+// given interface addresses. IPv6 link-local addresses are skipped, they
+// cannot be used without a zone.
+func interfaceSourceAddresses(name string, addrs []net.Addr) ([]net.IP, error) {
+	var ipv4, ipv6 net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			switch {
+			case ipNet.IP.To4() != nil:
+				if ipv4 == nil {
+					ipv4 = ipNet.IP
+				}
+			case ipv6 == nil && !ipNet.IP.IsLinkLocalUnicast():
+				ipv6 = ipNet.IP
+			}
+		}
+	}
+	var ips []net.IP
+	if ipv4 != nil {
+		ips = append(ips, ipv4)
+	}
+	if ipv6 != nil {
+		ips = append(ips, ipv6)
+	}
+	if len(ips) == 0 {
+		return nil, errors.Errorf("network interface %q does not have an IP address", name)
+	}
+	return ips, nil
+}
+
+// newACMENonces creates the store used for the ACME replay nonces. If the
+// nonces are not configured, the nonces are stored in the database and the
+// expired ones are deleted using the default options.
+func newACMENonces(cfg *config.ACMEConfig, db acme.DB) (*acme.NonceStore, error) {
+	if cfg == nil || cfg.Nonces == nil {
+		return acme.NewNonceStore(db, acme.NonceOptions{})
+	}
+
+	n := cfg.Nonces
+	opts := acme.NonceOptions{
+		Backend: acme.NonceBackend(n.Backend),
+	}
+	if n.TTL != nil {
+		opts.TTL = n.TTL.Duration
+	}
+	if n.CleanupInterval != nil {
+		opts.CleanupInterval = n.CleanupInterval.Duration
+	}
+	return acme.NewNonceStore(db, opts)
+}
+
+// newACMERevocationChecker creates the checker used to verify the revocation
+// status of the device attestation certificates.
+func newACMERevocationChecker(cfg *config.ACMEConfig) *acme.RevocationChecker {
+	if cfg == nil || cfg.Revocation == nil {
+		return acme.NewRevocationChecker(nil)
+	}
+
+	r := cfg.Revocation
+	var client *http.Client
+	if r.Timeout != nil && r.Timeout.Duration > 0 {
+		client = &http.Client{Timeout: r.Timeout.Duration}
+	}
+	return acme.NewRevocationChecker(client, acme.WithRevocationCacheSize(r.CacheSize))
+}
+
+// newACMEPerspectives creates the validator used to validate the ACME
+// challenges from multiple network perspectives. It returns nil if
+// multi-perspective validation is not configured.
+func newACMEPerspectives(cfg *config.ACMEConfig) (*acme.MultiPerspectiveValidator, error) {
+	if cfg == nil || cfg.Validation == nil || cfg.Validation.Perspectives == nil {
+		return nil, nil
+	}
+
+	p := cfg.Validation.Perspectives
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if p.Root != "" {
+		roots, err := pemutil.ReadCertificateBundle(p.Root)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		for _, crt := range roots {
+			tlsConfig.RootCAs.AddCert(crt)
+		}
+	}
+	if p.Certificate != "" {
+		cert, err := tls.LoadX509KeyPair(p.Certificate, p.Key)
+		if err != nil {
+			return nil, errors.Wrap(err, "error loading perspectives certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	opts := acme.MultiPerspectiveOptions{
+		Quorum: p.Quorum,
+		Secret: p.Secret,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+	for _, r := range p.Remotes {
+		opts.Perspectives = append(opts.Perspectives, acme.RemotePerspective{
+			Name: r.Name,
+			URL:  r.URL,
+		})
+	}
+	if p.Timeout != nil {
+		opts.Timeout = p.Timeout.Duration
+	}
+	return acme.NewMultiPerspectiveValidator(opts)
+}
+
 // Run starts the CA calling to the server ListenAndServe method.
 func (ca *CA) Run() error {
 	var wg sync.WaitGroup
@@ -404,6 +687,14 @@ func (ca *CA) Run() error {
 		}()
 	}
 
+	if ca.metricsSrv != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- ca.metricsSrv.ListenAndServe()
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -422,6 +713,15 @@ func (ca *CA) Run() error {
 func (ca *CA) Stop() error {
 	close(ca.compactStop)
 	ca.renewer.Stop()
+	if ca.acmeQueue != nil {
+		ca.acmeQueue.Stop()
+	}
+	if ca.acmeNonces != nil {
+		ca.acmeNonces.Stop()
+	}
+	if ca.acmeLimits != nil {
+		ca.acmeLimits.Stop()
+	}
 	if err := ca.auth.Shutdown(); err != nil {
 		log.Printf("error stopping ca.Authority: %+v\n", err)
 	}
@@ -429,6 +729,11 @@ func (ca *CA) Stop() error {
 	if ca.insecureSrv != nil {
 		insecureShutdownErr = ca.insecureSrv.Shutdown()
 	}
+	if ca.metricsSrv != nil {
+		if err := ca.metricsSrv.Shutdown(); err != nil {
+			log.Printf("error stopping the metrics server: %v", err)
+		}
+	}
 
 	secureErr := ca.srv.Shutdown()
 
@@ -458,6 +763,13 @@ func (ca *CA) Reload() error {
 		return errors.New("error reloading ca: database configuration cannot change")
 	}
 
+	// The metrics listener is not reloaded, the same meter is used by the
+	// new CA.
+	if ca.config.MetricsAddress != cfg.MetricsAddress {
+		logContinue("Reload failed because the metrics address has changed.")
+		return errors.New("error reloading ca: metricsAddress cannot change")
+	}
+
 	newCA, err := New(cfg,
 		WithPassword(ca.opts.password),
 		WithSSHHostPassword(ca.opts.sshHostPassword),
@@ -467,6 +779,7 @@ func (ca *CA) Reload() error {
 		WithQuiet(ca.opts.quiet),
 		WithConfigFile(ca.opts.configFile),
 		WithDatabase(ca.auth.GetDatabase()),
+		withMeter(ca.opts.meter),
 	)
 	if err != nil {
 		logContinue("Reload failed because the CA with new configuration could not be initialized.")
@@ -490,11 +803,23 @@ func (ca *CA) Reload() error {
 	// 3. Replace ca properties
 	// Do not replace ca.srv
 	ca.renewer.Stop()
+	if ca.acmeQueue != nil {
+		ca.acmeQueue.Stop()
+	}
+	if ca.acmeNonces != nil {
+		ca.acmeNonces.Stop()
+	}
+	if ca.acmeLimits != nil {
+		ca.acmeLimits.Stop()
+	}
 	ca.auth.CloseForReload()
 	ca.auth = newCA.auth
 	ca.config = newCA.config
 	ca.opts = newCA.opts
 	ca.renewer = newCA.renewer
+	ca.acmeQueue = newCA.acmeQueue
+	ca.acmeNonces = newCA.acmeNonces
+	ca.acmeLimits = newCA.acmeLimits
 	return nil
 }
 
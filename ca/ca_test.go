@@ -13,6 +13,7 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -683,3 +684,36 @@ func TestCARenew(t *testing.T) {
 		})
 	}
 }
+
+func Test_interfaceSourceAddresses(t *testing.T) {
+	ipNet := func(s string) net.Addr {
+		ip, n, err := net.ParseCIDR(s)
+		assert.FatalError(t, err)
+		n.IP = ip
+		return n
+	}
+	tests := []struct {
+		name    string
+		addrs   []net.Addr
+		want    []net.IP
+		wantErr bool
+	}{
+		{"ipv4", []net.Addr{ipNet("192.168.1.10/24"), ipNet("192.168.1.11/24")}, []net.IP{net.ParseIP("192.168.1.10")}, false},
+		{"ipv6", []net.Addr{ipNet("fe80::1/64"), ipNet("2001:db8::10/64")}, []net.IP{net.ParseIP("2001:db8::10")}, false},
+		{"dual stack", []net.Addr{ipNet("2001:db8::10/64"), ipNet("192.168.1.10/24")}, []net.IP{net.ParseIP("192.168.1.10"), net.ParseIP("2001:db8::10")}, false},
+		{"fail link-local", []net.Addr{ipNet("fe80::1/64")}, nil, true},
+		{"fail empty", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interfaceSourceAddresses("eth0", tt.addrs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("interfaceSourceAddresses() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Len(t, len(tt.want), got)
+			for i := range tt.want {
+				assert.True(t, tt.want[i].Equal(got[i]), fmt.Sprintf("interfaceSourceAddresses() = %v, want %v", got, tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package ca
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/pemutil"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api"
+)
+
+// Names of the files written in the certificate cache directory.
+const (
+	cacheCertificateFile = "cert.pem"
+	cacheRootFile        = "root.pem"
+	cacheKeyFile         = "key.pem"
+)
+
+type certificateCacheKey struct{}
+
+// WithCertificateCache returns a context that makes the bootstrap helpers,
+// like BootstrapClient or BootstrapServer, persist the certificate and private
+// key obtained from the CA in the given directory.
+//
+// On startup, a cached certificate that is still valid is used without
+// signing a new one, even if the CA is not reachable. If the certificate has
+// reached its renewal time, configured with RenewAtFraction, it is renewed
+// right away, and the renewal will be retried until the CA is reachable.
+// Renewed certificates are also written to the cache.
+//
+// Usage:
+//
+//	ctx := ca.WithCertificateCache(context.Background(), "/var/lib/app/certs")
+//	srv, err := ca.BootstrapServer(ctx, token, &http.Server{
+//	    Addr: ":443",
+//	    Handler: handler,
+//	})
+func WithCertificateCache(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, certificateCacheKey{}, &certificateCache{dir: dir})
+}
+
+func certificateCacheFromContext(ctx context.Context) *certificateCache {
+	c, _ := ctx.Value(certificateCacheKey{}).(*certificateCache)
+	return c
+}
+
+// certificateCache stores a certificate chain, its root and its private key in
+// a directory. A nil certificateCache is valid and does not store anything.
+type certificateCache struct {
+	dir string
+}
+
+// cachedCertificate is a certificate loaded from the cache.
+type cachedCertificate struct {
+	SignResponse *api.SignResponse
+	PrivateKey   crypto.PrivateKey
+	Leaf         *x509.Certificate
+	Root         *x509.Certificate
+}
+
+// needsRenewal returns true if the certificate has reached the given fraction
+// of its lifetime. If the fraction is not set, the default of the renewer,
+// 2/3rd of the lifetime, is used.
+func needsRenewal(leaf *x509.Certificate, fraction float64, now time.Time) bool {
+	if fraction <= 0 || fraction >= 1 {
+		fraction = 2.0 / 3
+	}
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return !now.Before(leaf.NotBefore.Add(time.Duration(float64(lifetime) * fraction)))
+}
+
+// isValid returns true if the certificate can still be used by the renewer.
+func (c *cachedCertificate) isValid(now time.Time) bool {
+	return !now.Before(c.Leaf.NotBefore) && c.Leaf.NotAfter.Sub(now) >= minCertDuration
+}
+
+// load reads the cached certificate. The root certificate must match one of
+// the given fingerprints.
+func (c *certificateCache) load(fingerprints []string) (*cachedCertificate, error) {
+	if c == nil {
+		return nil, errors.New("certificate cache is not enabled")
+	}
+	chain, err := pemutil.ReadCertificateBundle(filepath.Join(c.dir, cacheCertificateFile))
+	if err != nil {
+		return nil, err
+	}
+	root, err := pemutil.ReadCertificate(filepath.Join(c.dir, cacheRootFile))
+	if err != nil {
+		return nil, err
+	}
+	if !containsFingerprint(fingerprints, x509util.Fingerprint(root)) {
+		return nil, errors.New("cached root certificate does not match the bootstrap token")
+	}
+	pk, err := pemutil.Read(filepath.Join(c.dir, cacheKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) < 2 {
+		return nil, errors.Errorf("%s does not contain an intermediate certificate", filepath.Join(c.dir, cacheCertificateFile))
+	}
+
+	sign := &api.SignResponse{
+		ServerPEM:    api.NewCertificate(chain[0]),
+		CaPEM:        api.NewCertificate(chain[1]),
+		CertChainPEM: make([]api.Certificate, len(chain)),
+		TLS: &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{append(chain[:len(chain):len(chain)], root)},
+		},
+	}
+	for i, crt := range chain {
+		sign.CertChainPEM[i] = api.NewCertificate(crt)
+	}
+	// Make sure that the certificate and the key match.
+	if _, err := TLSCertificate(sign, pk); err != nil {
+		return nil, err
+	}
+
+	return &cachedCertificate{
+		SignResponse: sign,
+		PrivateKey:   pk,
+		Leaf:         chain[0],
+		Root:         root,
+	}, nil
+}
+
+func containsFingerprint(fingerprints []string, fp string) bool {
+	for _, sum := range fingerprints {
+		if strings.EqualFold(strings.ReplaceAll(sum, "-", ""), fp) {
+			return true
+		}
+	}
+	return false
+}
+
+// store writes the certificate chain in the sign response, its root and the
+// private key in the cache.
+func (c *certificateCache) store(sign *api.SignResponse, pk crypto.PrivateKey) error {
+	if c == nil {
+		return nil
+	}
+	root, err := RootCertificate(sign)
+	if err != nil {
+		return errors.Wrap(err, "error storing certificate in cache")
+	}
+
+	var chain []byte
+	certs := sign.CertChainPEM
+	if len(certs) == 0 {
+		certs = []api.Certificate{sign.ServerPEM, sign.CaPEM}
+	}
+	for _, crt := range certs {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+	}
+	block, err := pemutil.Serialize(pk)
+	if err != nil {
+		return errors.Wrap(err, "error storing certificate in cache")
+	}
+
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return errors.Wrap(err, "error creating certificate cache directory")
+	}
+	// Write the key first, a certificate is only loaded with a matching key.
+	if err := writeCacheFile(filepath.Join(c.dir, cacheKeyFile), pem.EncodeToMemory(block), 0600); err != nil {
+		return err
+	}
+	if err := writeCacheFile(filepath.Join(c.dir, cacheRootFile), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}), 0600); err != nil {
+		return err
+	}
+	return writeCacheFile(filepath.Join(c.dir, cacheCertificateFile), chain, 0600)
+}
+
+// writeCacheFile atomically replaces the given file.
+func writeCacheFile(name string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	return errors.Wrapf(os.Rename(f.Name(), name), "error writing %s", name)
+}
@@ -0,0 +1,240 @@
+package ca
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.step.sm/crypto/minica"
+	"go.step.sm/crypto/x509util"
+
+	"github.com/smallstep/certificates/api"
+)
+
+func TestBootstrapClient_certificateCache(t *testing.T) {
+	srv := startCABootstrapServer()
+	defer srv.Close()
+	token := generateBootstrapToken(srv.URL, "subject", "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7")
+
+	dir := filepath.Join(t.TempDir(), "certs")
+	ctx, cancel := context.WithCancel(WithCertificateCache(context.Background(), dir))
+	defer cancel()
+
+	clientCertificate := func(client *http.Client) *x509.Certificate {
+		t.Helper()
+		crt, err := client.Transport.(*http.Transport).TLSClientConfig.GetClientCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetClientCertificate() error = %v", err)
+		}
+		return crt.Leaf
+	}
+
+	// The first bootstrap signs and caches the certificate.
+	client, err := BootstrapClient(ctx, token)
+	if err != nil {
+		t.Fatalf("BootstrapClient() error = %v", err)
+	}
+	for _, name := range []string{"cert.pem", "root.pem", "key.pem"} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("os.Stat() error = %v", err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, want 0600", name, fi.Mode().Perm())
+		}
+	}
+	want := clientCertificate(client)
+
+	// Restarts use the cached certificate.
+	client, err = BootstrapClient(ctx, token)
+	if err != nil {
+		t.Fatalf("BootstrapClient() error = %v", err)
+	}
+	if got := clientCertificate(client); !got.Equal(want) {
+		t.Errorf("BootstrapClient() certificate = %v, want %v", got.SerialNumber, want.SerialNumber)
+	}
+
+	// Even if the CA is not reachable.
+	srv.Close()
+	client, err = BootstrapClient(ctx, token)
+	if err != nil {
+		t.Fatalf("BootstrapClient() error = %v", err)
+	}
+	if got := clientCertificate(client); !got.Equal(want) {
+		t.Errorf("BootstrapClient() certificate = %v, want %v", got.SerialNumber, want.SerialNumber)
+	}
+}
+
+func TestCreateBootstrap_certificateCache(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := startCABootstrapServer()
+	srv.Close()
+	sha := x509util.Fingerprint(ca.Root)
+
+	writeCache := func(t *testing.T, notBefore, notAfter time.Time) string {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := ca.Sign(&x509.Certificate{
+			Subject:   pkix.Name{CommonName: "subject"},
+			DNSNames:  []string{"subject"},
+			PublicKey: key.Public(),
+			NotBefore: notBefore,
+			NotAfter:  notAfter,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := t.TempDir()
+		cache := &certificateCache{dir: dir}
+		if err := cache.store(&api.SignResponse{
+			ServerPEM:    api.NewCertificate(leaf),
+			CaPEM:        api.NewCertificate(ca.Intermediate),
+			CertChainPEM: []api.Certificate{api.NewCertificate(leaf), api.NewCertificate(ca.Intermediate)},
+			TLS: &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{ca.Intermediate, ca.Root}},
+			},
+		}, key); err != nil {
+			t.Fatalf("certificateCache.store() error = %v", err)
+		}
+		return dir
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name      string
+		dir       string
+		sha       string
+		wantErr   bool
+		wantCache bool
+	}{
+		{"ok fallback", writeCache(t, now.Add(-time.Hour), now.Add(10*time.Minute)), sha, false, true},
+		{"fail expired", writeCache(t, now.Add(-time.Hour), now.Add(10*time.Second)), sha, true, false},
+		{"fail other root", writeCache(t, now.Add(-time.Hour), now.Add(10*time.Minute)), "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7", true, false},
+		{"fail empty", t.TempDir(), sha, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithCertificateCache(context.Background(), tt.dir)
+			got, err := createBootstrap(ctx, generateBootstrapToken(srv.URL, "subject", tt.sha))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createBootstrap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantCache {
+				return
+			}
+			if got.SignResponse.ServerPEM.Subject.CommonName != "subject" {
+				t.Errorf("createBootstrap() certificate = %v, want subject", got.SignResponse.ServerPEM.Subject)
+			}
+			if !got.RequireClientAuth {
+				t.Error("createBootstrap() RequireClientAuth = false, want true")
+			}
+			root, err := RootCertificate(got.SignResponse)
+			if err != nil || !root.Equal(ca.Root) {
+				t.Errorf("RootCertificate() = %v, %v, want %v", root, err, ca.Root.Subject)
+			}
+			if _, err := TLSCertificate(got.SignResponse, got.PrivateKey); err != nil {
+				t.Errorf("TLSCertificate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestNeedsRenewal(t *testing.T) {
+	now := time.Now()
+	leaf := &x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}
+	tests := []struct {
+		name     string
+		fraction float64
+		want     bool
+	}{
+		{"default", 0, false},
+		{"before", 0.6, false},
+		{"after", 0.4, true},
+		{"exact", 0.5, true},
+		{"invalid", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := needsRenewal(leaf, tt.fraction, now); got != tt.want {
+				t.Errorf("needsRenewal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunRenewer_certificateCache(t *testing.T) {
+	ca, err := minica.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	leaf, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "subject"},
+		PublicKey: key.Public(),
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		cache    *certificateCache
+		fraction float64
+		want     bool
+	}{
+		{"renew", &certificateCache{dir: t.TempDir()}, 0.4, true},
+		{"not yet", &certificateCache{dir: t.TempDir()}, 0.6, false},
+		{"no cache", nil, 0.4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renewed := make(chan struct{}, 1)
+			r, err := NewTLSRenewer(&tls.Certificate{Leaf: leaf, PrivateKey: key}, func() (*tls.Certificate, error) {
+				renewed <- struct{}{}
+				return &tls.Certificate{Leaf: leaf, PrivateKey: key}, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tlsCtx := &TLSOptionCtx{cache: tt.cache}
+			if err := RenewAtFraction(tt.fraction)(tlsCtx); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			runRenewer(ctx, tlsCtx, r)
+			select {
+			case <-renewed:
+				if !tt.want {
+					t.Error("runRenewer() renewed the certificate")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.want {
+					t.Error("runRenewer() did not renew the certificate")
+				}
+			}
+		})
+	}
+}
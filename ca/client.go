@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/smallstep/certificates/api"
@@ -116,7 +117,8 @@ type ClientOption func(o *clientOptions) error
 
 type clientOptions struct {
 	transport            http.RoundTripper
-	rootSHA256           string
+	rootSHA256           []string
+	endpoints            []string
 	rootFilename         string
 	rootBundle           []byte
 	certificate          tls.Certificate
@@ -165,7 +167,7 @@ func (o *clientOptions) applyDefaultIdentity() {
 // checkTransport checks if other ways to set up a transport have been provided.
 // If they have it returns an error.
 func (o *clientOptions) checkTransport() error {
-	if o.transport != nil || o.rootFilename != "" || o.rootSHA256 != "" || o.rootBundle != nil {
+	if o.transport != nil || o.rootFilename != "" || len(o.rootSHA256) > 0 || o.rootBundle != nil {
 		return errors.New("multiple transport methods have been configured")
 	}
 	return nil
@@ -181,8 +183,9 @@ func (o *clientOptions) getTransport(endpoint string) (tr http.RoundTripper, err
 			return nil, err
 		}
 	}
-	if o.rootSHA256 != "" {
-		if tr, err = getTransportFromSHA256(endpoint, o.rootSHA256); err != nil {
+	if len(o.rootSHA256) > 0 {
+		endpoints := append([]string{endpoint}, o.endpoints...)
+		if tr, err = getTransportFromSHA256(endpoints, o.rootSHA256); err != nil {
 			return nil, err
 		}
 	}
@@ -282,7 +285,36 @@ func WithRootSHA256(sum string) ClientOption {
 		if err := o.checkTransport(); err != nil {
 			return err
 		}
-		o.rootSHA256 = sum
+		o.rootSHA256 = []string{sum}
+		return nil
+	}
+}
+
+// WithRootFingerprints will create the transport using an insecure client to
+// retrieve the root certificates with the given SHA-256 fingerprints. All the
+// roots will be trusted. It will fail if a previous option to create the
+// transport has been configured.
+func WithRootFingerprints(sums ...string) ClientOption {
+	return func(o *clientOptions) error {
+		if err := o.checkTransport(); err != nil {
+			return err
+		}
+		if len(sums) == 0 {
+			return errors.New("root fingerprints cannot be empty")
+		}
+		o.rootSHA256 = sums
+		return nil
+	}
+}
+
+// WithFailoverEndpoints defines additional CA endpoints. If a request to the
+// CA fails because the endpoint in use is not reachable, the request will be
+// sent to the next endpoint, and the client will keep using the one that
+// responded. GET and HEAD requests are also sent to the next endpoint if the
+// endpoint in use is not available.
+func WithFailoverEndpoints(endpoints ...string) ClientOption {
+	return func(o *clientOptions) error {
+		o.endpoints = append(o.endpoints, endpoints...)
 		return nil
 	}
 }
@@ -371,18 +403,15 @@ func getTransportFromFile(filename string) (http.RoundTripper, error) {
 	}), nil
 }
 
-func getTransportFromSHA256(endpoint, sum string) (http.RoundTripper, error) {
-	u, err := parseEndpoint(endpoint)
-	if err != nil {
-		return nil, err
-	}
-	client := &Client{endpoint: u}
-	root, err := client.Root(sum)
-	if err != nil {
-		return nil, err
-	}
+func getTransportFromSHA256(endpoints, sums []string) (http.RoundTripper, error) {
 	pool := x509.NewCertPool()
-	pool.AddCert(root.RootPEM.Certificate)
+	for _, sum := range sums {
+		root, err := getRootFromEndpoints(endpoints, sum)
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCert(root.RootPEM.Certificate)
+	}
 	return getDefaultTransport(&tls.Config{
 		MinVersion:               tls.VersionTLS12,
 		PreferServerCipherSuites: true,
@@ -390,6 +419,22 @@ func getTransportFromSHA256(endpoint, sum string) (http.RoundTripper, error) {
 	}), nil
 }
 
+// getRootFromEndpoints retrieves the root certificate with the given
+// fingerprint from the first endpoint that returns it.
+func getRootFromEndpoints(endpoints []string, sum string) (root *api.RootResponse, err error) {
+	for _, endpoint := range endpoints {
+		var u *url.URL
+		if u, err = parseEndpoint(endpoint); err != nil {
+			return nil, err
+		}
+		client := &Client{endpoint: u}
+		if root, err = client.Root(sum); err == nil {
+			return root, nil
+		}
+	}
+	return nil, err
+}
+
 func getTransportFromCABundle(bundle []byte) (http.RoundTripper, error) {
 	pool := x509.NewCertPool()
 	if !pool.AppendCertsFromPEM(bundle) {
@@ -514,8 +559,11 @@ func WithProvisionerName(name string) ProvisionerOption {
 type Client struct {
 	client    *uaClient
 	endpoint  *url.URL
+	failover  *failover
 	retryFunc RetryFunc
 	opts      []ClientOption
+	aia       *AIAChaser
+	aiaOnce   sync.Once
 }
 
 // NewClient creates a new Client with the given endpoint and options.
@@ -533,10 +581,15 @@ func NewClient(endpoint string, opts ...ClientOption) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	fo, err := newFailover(u, o.endpoints)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Client{
-		client:    newClient(tr),
+		client:    newClient(fo.wrap(tr)),
 		endpoint:  u,
+		failover:  fo,
 		retryFunc: o.retryFunc,
 		opts:      opts,
 	}, nil
@@ -554,7 +607,7 @@ func (c *Client) retryOnError(r *http.Response) bool {
 				return false
 			}
 			r.Body.Close()
-			c.client.SetTransport(tr)
+			c.SetTransport(tr)
 			return true
 		}
 	}
@@ -569,7 +622,7 @@ func (c *Client) GetCaURL() string {
 // GetRootCAs returns the RootCAs certificate pool from the configured
 // transport.
 func (c *Client) GetRootCAs() *x509.CertPool {
-	switch t := c.client.GetTransport().(type) {
+	switch t := unwrapTransport(c.client.GetTransport()).(type) {
 	case *http.Transport:
 		if t.TLSClientConfig != nil {
 			return t.TLSClientConfig.RootCAs
@@ -587,7 +640,7 @@ func (c *Client) GetRootCAs() *x509.CertPool {
 
 // SetTransport updates the transport of the internal HTTP client.
 func (c *Client) SetTransport(tr http.RoundTripper) {
-	c.client.SetTransport(tr)
+	c.client.SetTransport(c.failover.wrap(tr))
 }
 
 // Version performs the version request to the CA with an empty context and returns the
@@ -738,7 +791,7 @@ func (c *Client) Renew(tr http.RoundTripper) (*api.SignResponse, error) {
 func (c *Client) RenewWithContext(ctx context.Context, tr http.RoundTripper) (*api.SignResponse, error) {
 	var retried bool
 	u := c.endpoint.ResolveReference(&url.URL{Path: "/renew"})
-	client := &http.Client{Transport: tr}
+	client := &http.Client{Transport: c.failover.wrap(tr)}
 retry:
 	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), http.NoBody)
 	if err != nil {
@@ -815,7 +868,7 @@ func (c *Client) RekeyWithContext(ctx context.Context, req *api.RekeyRequest, tr
 		return nil, errors.Wrap(err, "error marshaling request")
 	}
 	u := c.endpoint.ResolveReference(&url.URL{Path: "/rekey"})
-	client := &http.Client{Transport: tr}
+	client := &http.Client{Transport: c.failover.wrap(tr)}
 retry:
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(body))
 	if err != nil {
@@ -857,7 +910,7 @@ func (c *Client) RevokeWithContext(ctx context.Context, req *api.RevokeRequest,
 	var client *uaClient
 retry:
 	if tr != nil {
-		client = newClient(tr)
+		client = newClient(c.failover.wrap(tr))
 	} else {
 		client = c.client
 	}
@@ -1016,6 +1069,53 @@ retry:
 	return &federation, nil
 }
 
+// RootsDigest performs the get roots digest request to the CA with an empty
+// context and returns the api.BundleDigestResponse struct.
+func (c *Client) RootsDigest() (*api.BundleDigestResponse, error) {
+	return c.RootsDigestWithContext(context.Background())
+}
+
+// RootsDigestWithContext performs the get roots digest request to the CA with
+// the provided context and returns the api.BundleDigestResponse struct.
+func (c *Client) RootsDigestWithContext(ctx context.Context) (*api.BundleDigestResponse, error) {
+	return c.bundleDigest(ctx, "/roots/digest")
+}
+
+// FederationDigest performs the get federation digest request to the CA with
+// an empty context and returns the api.BundleDigestResponse struct.
+func (c *Client) FederationDigest() (*api.BundleDigestResponse, error) {
+	return c.FederationDigestWithContext(context.Background())
+}
+
+// FederationDigestWithContext performs the get federation digest request to the
+// CA with the provided context and returns the api.BundleDigestResponse
+// struct.
+func (c *Client) FederationDigestWithContext(ctx context.Context) (*api.BundleDigestResponse, error) {
+	return c.bundleDigest(ctx, "/federation/digest")
+}
+
+func (c *Client) bundleDigest(ctx context.Context, path string) (*api.BundleDigestResponse, error) {
+	var retried bool
+	u := c.endpoint.ResolveReference(&url.URL{Path: path})
+retry:
+	resp, err := c.client.GetWithContext(ctx, u.String())
+	if err != nil {
+		return nil, clientError(err)
+	}
+	if resp.StatusCode >= 400 {
+		if !retried && c.retryOnError(resp) { //nolint:contextcheck // deeply nested context; retry using the same context
+			retried = true
+			goto retry
+		}
+		return nil, readError(resp.Body)
+	}
+	var digest api.BundleDigestResponse
+	if err := readJSON(resp.Body, &digest); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return &digest, nil
+}
+
 // SSHSign performs the POST /ssh/sign request to the CA with an empty context
 // and returns the api.SSHSignResponse struct.
 func (c *Client) SSHSign(req *api.SSHSignRequest) (*api.SSHSignResponse, error) {
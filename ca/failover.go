@@ -0,0 +1,173 @@
+package ca
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// failover keeps the list of CA endpoints and the one currently in use. It is
+// shared by all the transports of a client, so requests stick to the last
+// endpoint that responded. A nil failover does not modify the transports.
+type failover struct {
+	mu        sync.Mutex
+	endpoints []*url.URL
+	current   int
+}
+
+// newFailover returns the failover for the given endpoint and the additional
+// endpoints. It returns nil if there are no additional endpoints.
+func newFailover(endpoint *url.URL, endpoints []string) (*failover, error) {
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+	f := &failover{endpoints: []*url.URL{endpoint}}
+	for _, e := range endpoints {
+		u, err := parseEndpoint(e)
+		if err != nil {
+			return nil, err
+		}
+		f.endpoints = append(f.endpoints, u)
+	}
+	return f, nil
+}
+
+// wrap returns a transport that sends the requests to the CA to the current
+// endpoint, failing over to the next one if the endpoint is not available.
+func (f *failover) wrap(tr http.RoundTripper) http.RoundTripper {
+	if f == nil || tr == nil {
+		return tr
+	}
+	if ft, ok := tr.(*failoverTransport); ok {
+		tr = ft.next
+	}
+	return &failoverTransport{failover: f, next: tr}
+}
+
+func (f *failover) get() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current
+}
+
+func (f *failover) set(i int) {
+	f.mu.Lock()
+	f.current = i
+	f.mu.Unlock()
+}
+
+// index returns the index of the endpoint with the host of the given URL, or
+// -1 if the URL is not for a CA endpoint.
+func (f *failover) index(u *url.URL) int {
+	for i, e := range f.endpoints {
+		if e.Scheme == u.Scheme && e.Host == u.Host {
+			return i
+		}
+	}
+	return -1
+}
+
+// failoverTransport is the http.RoundTripper that implements the failover
+// between the CA endpoints.
+type failoverTransport struct {
+	*failover
+	next http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface. Requests to a CA
+// endpoint are sent to the current one. If the connection to the endpoint
+// fails, the request is sent to the next endpoint. GET and HEAD requests are
+// also sent to the next endpoint if the request fails after it was sent, or
+// if the endpoint is not available. Other requests, like a sign with a
+// one-time token, might have been processed, so they are not retried.
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.index(req.URL) == -1 {
+		return t.next.RoundTrip(req)
+	}
+
+	var lastErr error
+	idempotent := isIdempotent(req)
+	start, n := t.get(), len(t.endpoints)
+	for i := 0; i < n; i++ {
+		idx := (start + i) % n
+		r, err := rewriteRequest(req, t.endpoints[idx], i > 0)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.next.RoundTrip(r)
+		switch {
+		case err != nil:
+			if !idempotent && !isDialError(err) {
+				return nil, err
+			}
+			lastErr = err
+		case idempotent && isUnavailable(resp.StatusCode) && i < n-1:
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			lastErr = errors.Errorf("%s responded with %d", t.endpoints[idx].Host, resp.StatusCode)
+		default:
+			if idx != start {
+				t.set(idx)
+			}
+			return resp, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// rewriteRequest returns a copy of the request sent to the given endpoint. If
+// the body has already been sent, a new copy of it is used.
+func rewriteRequest(req *http.Request, endpoint *url.URL, retry bool) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = endpoint.Scheme
+	r.URL.Host = endpoint.Host
+	r.Host = ""
+	if retry && req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errors.New("cannot retry request: request body cannot be read again")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot retry request")
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+func isIdempotent(req *http.Request) bool {
+	return req.Method == "" || req.Method == http.MethodGet || req.Method == http.MethodHead
+}
+
+// isDialError returns true if the error happened connecting to the endpoint,
+// before the request was sent.
+func isDialError(err error) bool {
+	var (
+		opErr  *net.OpError
+		dnsErr *net.DNSError
+	)
+	switch {
+	case errors.As(err, &opErr):
+		return opErr.Op == "dial"
+	case errors.As(err, &dnsErr):
+		return true
+	default:
+		return false
+	}
+}
+
+func isUnavailable(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// unwrapTransport returns the transport wrapped by the failover transport.
+func unwrapTransport(tr http.RoundTripper) http.RoundTripper {
+	if ft, ok := tr.(*failoverTransport); ok {
+		return ft.next
+	}
+	return tr
+}
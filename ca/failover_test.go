@@ -0,0 +1,200 @@
+package ca
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/randutil"
+)
+
+func TestFailoverTransport(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	var unavailable bool
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if name == "primary" && unavailable {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			b, _ := io.ReadAll(r.Body)
+			io.WriteString(w, name+":"+string(b))
+		}))
+	}
+	primary := newServer("primary")
+	defer primary.Close()
+	secondary := newServer("secondary")
+	defer secondary.Close()
+
+	client, err := NewClient(down.URL, WithTransport(http.DefaultTransport), WithFailoverEndpoints(primary.URL, secondary.URL))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	post := func(u string) string {
+		t.Helper()
+		resp, err := client.client.Post(u, "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Fatalf("Post() error = %v", err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("io.ReadAll() error = %v", err)
+		}
+		return string(b)
+	}
+
+	// Fails over to the next endpoint and sticks to it.
+	if got := post(down.URL + "/sign"); got != "primary:body" {
+		t.Errorf("Post() = %s, want primary:body", got)
+	}
+	if got := client.failover.get(); got != 1 {
+		t.Errorf("failover.current = %d, want 1", got)
+	}
+
+	get := func(u string) string {
+		t.Helper()
+		resp, err := client.client.Get(u)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("io.ReadAll() error = %v", err)
+		}
+		return string(b)
+	}
+
+	// Unavailable endpoints are not retried for requests that are not
+	// idempotent, the request might have been processed.
+	unavailable = true
+	resp, err := client.client.Post(down.URL+"/sign", "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Post() status = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if got := client.failover.get(); got != 1 {
+		t.Errorf("failover.current = %d, want 1", got)
+	}
+
+	// Unavailable endpoints are skipped for idempotent requests.
+	if got := get(down.URL + "/roots"); got != "secondary:" {
+		t.Errorf("Get() = %s, want secondary:", got)
+	}
+	unavailable = false
+	if got := post(primary.URL + "/sign"); got != "secondary:body" {
+		t.Errorf("Post() = %s, want secondary:body", got)
+	}
+
+	// Other hosts are not modified.
+	other := newServer("other")
+	defer other.Close()
+	if got := post(other.URL); got != "other:body" {
+		t.Errorf("Post() = %s, want other:body", got)
+	}
+
+	// The transports used for renewals share the current endpoint.
+	tr := client.failover.wrap(http.DefaultTransport)
+	resp, err = (&http.Client{Transport: tr}).Get(down.URL + "/renew")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "secondary:" {
+		t.Errorf("Get() = %s, want secondary:", b)
+	}
+	if got := client.failover.wrap(tr).(*failoverTransport).next; got != http.DefaultTransport {
+		t.Errorf("failover.wrap() wraps %T, want *http.Transport", got)
+	}
+}
+
+func TestIsDialError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"dial", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"dns", &net.DNSError{Err: "no such host", Name: "ca.example.com"}, true},
+		{"read", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, false},
+		{"other", io.ErrUnexpectedEOF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDialError(tt.err); got != tt.want {
+				t.Errorf("isDialError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBootstrapClient_failover(t *testing.T) {
+	srv := startCABootstrapServer()
+	defer srv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	now := time.Now()
+	jwk, err := jose.ReadKey("testdata/secrets/ott_mariano_priv.jwk", jose.WithPassword([]byte("password")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		new(jose.SignerOptions).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := randutil.ASCII(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jose.Signed(sig).Claims(struct {
+		SHA string `json:"sha"`
+		jose.Claims
+		SANS []string `json:"sans"`
+	}{
+		SHA: "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7",
+		Claims: jose.Claims{
+			ID:        id,
+			Subject:   "subject",
+			Issuer:    "mariano",
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(time.Minute)),
+			Audience:  []string{down.URL + "/sign", srv.URL + "/sign"},
+		},
+		SANS: []string{"subject"},
+	}).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, err := BootstrapClient(ctx, token)
+	if err != nil {
+		t.Fatalf("BootstrapClient() error = %v", err)
+	}
+	resp, err := client.Post(srv.URL+"/renew", "application/json", http.NoBody)
+	if err != nil {
+		t.Fatalf("BootstrapClient() failed renewing certificate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("BootstrapClient() renew status = %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+}
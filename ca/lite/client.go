@@ -0,0 +1,203 @@
+// Package lite implements a subset of the step-ca client that does not depend
+// on the authority packages, and can be compiled for js/wasm and wasip1/wasm.
+//
+// It supports signing certificates with a one-time token, fetching the root
+// certificates and renewing certificates using a renew token, which, unlike
+// the mTLS renewal in the ca package, works over the browser fetch API.
+package lite
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/smallstep/certificates/errs"
+)
+
+// UserAgent will set the User-Agent header in the client requests.
+var UserAgent = "step-http-client/1.0"
+
+// ClientOption is the type of options passed to the Client constructor.
+type ClientOption func(o *clientOptions) error
+
+type clientOptions struct {
+	transport http.RoundTripper
+	roots     *x509.CertPool
+}
+
+// WithTransport sets the transport used by the Client. On wasip1 there's no
+// default network stack, so a transport provided by the host must be set.
+func WithTransport(tr http.RoundTripper) ClientOption {
+	return func(o *clientOptions) error {
+		if o.roots != nil {
+			return errors.New("multiple transport methods have been configured")
+		}
+		o.transport = tr
+		return nil
+	}
+}
+
+// WithRootCAs sets the root certificates used to verify the CA. This option
+// is ignored on js/wasm where TLS is handled by the browser.
+func WithRootCAs(roots *x509.CertPool) ClientOption {
+	return func(o *clientOptions) error {
+		if o.transport != nil {
+			return errors.New("multiple transport methods have been configured")
+		}
+		o.roots = roots
+		return nil
+	}
+}
+
+// Client implements a minimal HTTP client for the CA server.
+type Client struct {
+	client   *http.Client
+	endpoint *url.URL
+}
+
+// NewClient creates a new Client with the given endpoint and options.
+func NewClient(endpoint string, opts ...ClientOption) (*Client, error) {
+	u, err := parseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	o := new(clientOptions)
+	for _, fn := range opts {
+		if err := fn(o); err != nil {
+			return nil, err
+		}
+	}
+
+	tr := o.transport
+	if tr == nil {
+		if tr, err = defaultTransport(o.roots); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Client{
+		client:   &http.Client{Transport: tr},
+		endpoint: u,
+	}, nil
+}
+
+// GetCaURL returns the configured CA url.
+func (c *Client) GetCaURL() string {
+	return c.endpoint.String()
+}
+
+// Sign performs the sign request to the CA and returns the SignResponse.
+func (c *Client) Sign(ctx context.Context, req *SignRequest) (*SignResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling request")
+	}
+	var sign SignResponse
+	if err := c.do(ctx, "POST", "/sign", "", bytes.NewReader(body), &sign); err != nil {
+		return nil, err
+	}
+	return &sign, nil
+}
+
+// Renew performs the renew request to the CA using a renew token created with
+// the given certificate chain and its private key.
+func (c *Client) Renew(ctx context.Context, chain []*x509.Certificate, key interface{}) (*SignResponse, error) {
+	token, err := CreateRenewToken(c.renewURL(), chain, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.RenewWithToken(ctx, token)
+}
+
+// RenewWithToken performs the renew request to the CA with the given
+// authorization token and returns the SignResponse.
+func (c *Client) RenewWithToken(ctx context.Context, token string) (*SignResponse, error) {
+	var sign SignResponse
+	if err := c.do(ctx, "POST", "/renew", token, http.NoBody, &sign); err != nil {
+		return nil, err
+	}
+	return &sign, nil
+}
+
+// Roots performs the get roots request to the CA and returns the
+// RootsResponse.
+func (c *Client) Roots(ctx context.Context) (*RootsResponse, error) {
+	var roots RootsResponse
+	if err := c.do(ctx, "GET", "/roots", "", http.NoBody, &roots); err != nil {
+		return nil, err
+	}
+	return &roots, nil
+}
+
+func (c *Client) renewURL() string {
+	return c.endpoint.ResolveReference(&url.URL{Path: "/1.0/renew"}).String()
+}
+
+func (c *Client) do(ctx context.Context, method, path, token string, body io.Reader, v interface{}) error {
+	u := c.endpoint.ResolveReference(&url.URL{Path: path})
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return errors.Wrapf(err, "create %s %s request failed", method, u)
+	}
+	if method == "POST" && token == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return clientError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return readError(resp.Body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrapf(err, "error reading %s", u)
+	}
+	return nil
+}
+
+func parseEndpoint(endpoint string) (*url.URL, error) {
+	if !strings.Contains(endpoint, "//") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s", endpoint)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, errors.Errorf("error parsing %s: unsupported scheme %s", endpoint, u.Scheme)
+	}
+	return &url.URL{Scheme: u.Scheme, Host: u.Host}, nil
+}
+
+func readError(r io.Reader) error {
+	apiErr := new(errs.Error)
+	if err := json.NewDecoder(r).Decode(apiErr); err != nil {
+		return err
+	}
+	return apiErr
+}
+
+func clientError(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return fmt.Errorf("client %s %s failed: %w",
+			strings.ToUpper(uerr.Op), uerr.URL, uerr.Err)
+	}
+	return fmt.Errorf("client request failed: %w", err)
+}
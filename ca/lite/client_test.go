@@ -0,0 +1,166 @@
+package lite
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/api"
+	"github.com/smallstep/certificates/api/read"
+	"github.com/smallstep/certificates/api/render"
+	"github.com/smallstep/certificates/errs"
+)
+
+func mustSign(t *testing.T, ca *minica.CA) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	crt, err := ca.Sign(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: "test.example.com"},
+		DNSNames:  []string{"test.example.com"},
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+		PublicKey: key.Public(),
+	})
+	require.NoError(t, err)
+	return crt, key
+}
+
+func TestClient(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	leaf, key := mustSign(t, ca)
+
+	signResponse := &api.SignResponse{
+		ServerPEM: api.NewCertificate(leaf),
+		CaPEM:     api.NewCertificate(ca.Intermediate),
+		CertChainPEM: []api.Certificate{
+			api.NewCertificate(leaf), api.NewCertificate(ca.Intermediate),
+		},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, UserAgent, r.UserAgent())
+		switch r.URL.Path {
+		case "/sign":
+			var body api.SignRequest
+			if err := read.JSON(r.Body, &body); err != nil {
+				render.Error(w, errs.BadRequestErr(err, "error reading request body"))
+				return
+			}
+			if body.OTT != "the-ott" {
+				render.Error(w, errs.Unauthorized("bad token"))
+				return
+			}
+			render.JSONStatus(w, signResponse, http.StatusCreated)
+		case "/renew":
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			jwt, chain, err := jose.ParseX5cInsecure(token, []*x509.Certificate{ca.Root})
+			if err != nil {
+				render.Error(w, errs.UnauthorizedErr(err))
+				return
+			}
+			var claims jose.Claims
+			if err := jwt.Claims(chain[0][0].PublicKey, &claims); err != nil {
+				render.Error(w, errs.UnauthorizedErr(err))
+				return
+			}
+			assert.Equal(t, "step-ca-client/1.0", claims.Issuer)
+			assert.Equal(t, "test.example.com", claims.Subject)
+			render.JSONStatus(w, signResponse, http.StatusCreated)
+		case "/roots":
+			render.JSON(w, api.RootsResponse{
+				Certificates: []api.Certificate{api.NewCertificate(ca.Root)},
+			})
+		default:
+			render.Error(w, errs.NotFound("not found"))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL, c.GetCaURL())
+
+	t.Run("sign", func(t *testing.T) {
+		got, err := c.Sign(ctx, &SignRequest{OTT: "the-ott"})
+		require.NoError(t, err)
+		assert.Equal(t, leaf, got.ServerPEM.Certificate)
+		assert.Equal(t, ca.Intermediate, got.CaPEM.Certificate)
+		assert.Len(t, got.CertChainPEM, 2)
+	})
+
+	t.Run("sign unauthorized", func(t *testing.T) {
+		got, err := c.Sign(ctx, &SignRequest{OTT: "bad-ott"})
+		assert.Nil(t, got)
+		var apiErr *errs.Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode())
+	})
+
+	t.Run("renew", func(t *testing.T) {
+		got, err := c.Renew(ctx, []*x509.Certificate{leaf, ca.Intermediate}, key)
+		require.NoError(t, err)
+		assert.Equal(t, leaf, got.ServerPEM.Certificate)
+	})
+
+	t.Run("renew bad token", func(t *testing.T) {
+		got, err := c.RenewWithToken(ctx, "not-a-token")
+		assert.Nil(t, got)
+		assert.Error(t, err)
+	})
+
+	t.Run("roots", func(t *testing.T) {
+		got, err := c.Roots(ctx)
+		require.NoError(t, err)
+		require.Len(t, got.Certificates, 1)
+		assert.Equal(t, ca.Root, got.Certificates[0].Certificate)
+		assert.True(t, got.CertPool().Equal(func() *x509.CertPool {
+			p := x509.NewCertPool()
+			p.AddCert(ca.Root)
+			return p
+		}()))
+	})
+}
+
+func TestNewClient(t *testing.T) {
+	_, err := NewClient("ca.smallstep.com")
+	assert.NoError(t, err)
+	_, err = NewClient("ftp://ca.smallstep.com")
+	assert.Error(t, err)
+	_, err = NewClient("https://ca.smallstep.com", WithTransport(http.DefaultTransport), WithRootCAs(x509.NewCertPool()))
+	assert.Error(t, err)
+}
+
+func TestCreateRenewToken(t *testing.T) {
+	_, err := CreateRenewToken("https://ca/1.0/renew", nil, nil)
+	assert.Error(t, err)
+
+	ca, err := minica.New()
+	require.NoError(t, err)
+	leaf, key := mustSign(t, ca)
+
+	_, err = CreateRenewToken("https://ca/1.0/renew", []*x509.Certificate{leaf}, "not-a-key")
+	assert.Error(t, err)
+
+	tok, err := CreateRenewToken("https://ca/1.0/renew", []*x509.Certificate{leaf, ca.Intermediate}, key)
+	require.NoError(t, err)
+	jwt, _, err := jose.ParseX5cInsecure(tok, []*x509.Certificate{ca.Root})
+	require.NoError(t, err)
+	var claims jose.Claims
+	require.NoError(t, jwt.Claims(key.Public(), &claims))
+	assert.Equal(t, jose.Audience{"https://ca/1.0/renew"}, claims.Audience)
+	assert.NotEmpty(t, claims.ID)
+}
@@ -0,0 +1,94 @@
+package lite
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.step.sm/crypto/jose"
+	"go.step.sm/crypto/randutil"
+)
+
+// renewTokenDuration is the validity of the renew tokens.
+const renewTokenDuration = 5 * time.Minute
+
+// CreateRenewToken creates a token that can be used to renew the first
+// certificate in the given chain. The token is signed with the certificate key
+// and includes the chain in the x5cInsecure header, allowing the renewal of
+// certificates without an mTLS connection.
+func CreateRenewToken(audience string, chain []*x509.Certificate, key interface{}) (string, error) {
+	if len(chain) == 0 {
+		return "", errors.New("certificate chain cannot be empty")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", errors.Errorf("key %T is not a crypto.Signer", key)
+	}
+
+	alg, err := signatureAlgorithm(signer.Public())
+	if err != nil {
+		return "", err
+	}
+
+	x5c := make([]string, len(chain))
+	for i, crt := range chain {
+		x5c[i] = base64.StdEncoding.EncodeToString(crt.Raw)
+	}
+
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("x5cInsecure", x5c)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: signer}, so)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating jose.Signer")
+	}
+
+	jti, err := randutil.Hex(64)
+	if err != nil {
+		return "", errors.Wrap(err, "error generating token id")
+	}
+
+	now := time.Now()
+	claims := jose.Claims{
+		ID:        jti,
+		Issuer:    "step-ca-client/1.0",
+		Subject:   chain[0].Subject.CommonName,
+		Audience:  []string{audience},
+		NotBefore: jose.NewNumericDate(now),
+		IssuedAt:  jose.NewNumericDate(now),
+		Expiry:    jose.NewNumericDate(now.Add(renewTokenDuration)),
+	}
+
+	tok, err := jose.Signed(sig).Claims(claims).CompactSerialize()
+	if err != nil {
+		return "", errors.Wrap(err, "error signing token")
+	}
+	return tok, nil
+}
+
+func signatureAlgorithm(pub crypto.PublicKey) (jose.SignatureAlgorithm, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().Name {
+		case "P-256":
+			return jose.ES256, nil
+		case "P-384":
+			return jose.ES384, nil
+		case "P-521":
+			return jose.ES512, nil
+		default:
+			return "", errors.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		return jose.EdDSA, nil
+	case *rsa.PublicKey:
+		return jose.DefaultRSASigAlgorithm, nil
+	default:
+		return "", errors.Errorf("unsupported key type %T", k)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !js && !wasip1
+
+package lite
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+)
+
+// defaultTransport returns an HTTP transport that verifies the CA using the
+// given roots, or the system roots if none are given.
+func defaultTransport(roots *x509.CertPool) (http.RoundTripper, error) {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    roots,
+	}
+	return tr, nil
+}
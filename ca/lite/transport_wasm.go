@@ -0,0 +1,22 @@
+//go:build js || wasip1
+
+package lite
+
+import (
+	"crypto/x509"
+	"net/http"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// defaultTransport returns the transport used on WebAssembly targets. On
+// js/wasm the default transport uses the fetch API and TLS is verified by the
+// browser, so the roots are ignored. On wasip1 there's no network support in
+// the standard library and a transport must be set using WithTransport.
+func defaultTransport(*x509.CertPool) (http.RoundTripper, error) {
+	if runtime.GOOS == "wasip1" {
+		return nil, errors.New("a transport must be configured using lite.WithTransport on wasip1")
+	}
+	return http.DefaultTransport, nil
+}
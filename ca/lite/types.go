@@ -0,0 +1,104 @@
+package lite
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// Certificate wraps a *x509.Certificate and adds the json.Marshaler and
+// json.Unmarshaler interfaces. It's compatible with api.Certificate.
+type Certificate struct {
+	*x509.Certificate
+}
+
+// MarshalJSON implements the json.Marshaler interface. The certificate is
+// quoted string using the PEM encoding.
+func (c Certificate) MarshalJSON() ([]byte, error) {
+	if c.Certificate == nil {
+		return []byte("null"), nil
+	}
+	block := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: c.Raw,
+	})
+	return json.Marshal(string(block))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. The certificate is
+// expected to be a quoted string using the PEM encoding.
+func (c *Certificate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "error decoding certificate")
+	}
+	if s == "null" || s == "" {
+		c.Certificate = nil
+		return nil
+	}
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return errors.New("error decoding certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "error decoding certificate")
+	}
+	c.Certificate = cert
+	return nil
+}
+
+// CertificateRequest wraps a *x509.CertificateRequest and adds the
+// json.Marshaler interface. It's compatible with api.CertificateRequest.
+type CertificateRequest struct {
+	*x509.CertificateRequest
+}
+
+// MarshalJSON implements the json.Marshaler interface. The certificate request
+// is a quoted string using the PEM encoding.
+func (c CertificateRequest) MarshalJSON() ([]byte, error) {
+	if c.CertificateRequest == nil {
+		return []byte("null"), nil
+	}
+	block := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: c.Raw,
+	})
+	return json.Marshal(string(block))
+}
+
+// SignRequest is the request body for a certificate signature request. It's
+// compatible with api.SignRequest.
+type SignRequest struct {
+	CsrPEM       CertificateRequest `json:"csr"`
+	OTT          string             `json:"ott"`
+	NotAfter     string             `json:"notAfter,omitempty"`
+	NotBefore    string             `json:"notBefore,omitempty"`
+	TemplateData json.RawMessage    `json:"templateData,omitempty"`
+}
+
+// SignResponse is the response object of the certificate signature and
+// renewal requests.
+type SignResponse struct {
+	ServerPEM    Certificate   `json:"crt"`
+	CaPEM        Certificate   `json:"ca"`
+	CertChainPEM []Certificate `json:"certChain"`
+}
+
+// RootsResponse is the response object of the roots request.
+type RootsResponse struct {
+	Certificates []Certificate `json:"crts"`
+}
+
+// CertPool returns a certificate pool with the certificates in the response.
+func (r *RootsResponse) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, crt := range r.Certificates {
+		if crt.Certificate != nil {
+			pool.AddCert(crt.Certificate)
+		}
+	}
+	return pool
+}
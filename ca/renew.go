@@ -3,6 +3,7 @@ package ca
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"math/rand"
 	"sync"
 	"time"
@@ -24,7 +25,33 @@ type TLSRenewer struct {
 	timer            *time.Timer
 	renewBefore      time.Duration
 	renewJitter      time.Duration
+	renewBackoff     time.Duration
 	certNotAfter     time.Time
+	onRenew          []func(*tls.Certificate)
+	onRenewError     []func(error)
+	failedAttempts   int
+}
+
+// RenewError is the error passed to the OnRenewError hooks when a certificate
+// cannot be renewed.
+type RenewError struct {
+	// Err is the error returned by the renew function.
+	Err error
+	// Attempts is the number of consecutive failed renewals.
+	Attempts int
+	// NotAfter is the expiration of the certificate currently in use.
+	NotAfter time.Time
+}
+
+// Error implements the error interface.
+func (e *RenewError) Error() string {
+	return fmt.Sprintf("error renewing certificate expiring at %s after %d attempt(s): %v",
+		e.NotAfter.Format(time.RFC3339), e.Attempts, e.Err)
+}
+
+// Unwrap returns the error returned by the renew function.
+func (e *RenewError) Unwrap() error {
+	return e.Err
 }
 
 type tlsRenewerOptions func(r *TLSRenewer) error
@@ -45,6 +72,47 @@ func WithRenewJitter(j time.Duration) func(r *TLSRenewer) error {
 	}
 }
 
+// WithRenewFraction modifies a tlsRenewer by setting the renewBefore attribute
+// so the certificate is renewed once the given fraction of its validity
+// period has elapsed. The fraction must be between 0 and 1.
+func WithRenewFraction(f float64) func(r *TLSRenewer) error {
+	return func(r *TLSRenewer) error {
+		if f <= 0 || f >= 1 {
+			return errors.Errorf("renew fraction must be between 0 and 1, but got %v", f)
+		}
+		period := r.cert.Leaf.NotAfter.Sub(time.Now().Truncate(time.Second))
+		r.renewBefore = time.Duration(float64(period) * (1 - f))
+		return nil
+	}
+}
+
+// WithRenewBackoff modifies a tlsRenewer by setting the minimum time to wait
+// before retrying a failed renewal.
+func WithRenewBackoff(d time.Duration) func(r *TLSRenewer) error {
+	return func(r *TLSRenewer) error {
+		r.renewBackoff = d
+		return nil
+	}
+}
+
+// WithOnRenew modifies a tlsRenewer by adding a function that will be called
+// with every renewed certificate.
+func WithOnRenew(fn func(*tls.Certificate)) func(r *TLSRenewer) error {
+	return func(r *TLSRenewer) error {
+		r.onRenew = append(r.onRenew, fn)
+		return nil
+	}
+}
+
+// WithOnRenewError modifies a tlsRenewer by adding a function that will be
+// called with a *RenewError every time a renewal fails.
+func WithOnRenewError(fn func(error)) func(r *TLSRenewer) error {
+	return func(r *TLSRenewer) error {
+		r.onRenewError = append(r.onRenewError, fn)
+		return nil
+	}
+}
+
 // NewTLSRenewer creates a TLSRenewer for the given cert. It will use the given
 // RenewFunc to get a new certificate when required.
 func NewTLSRenewer(cert *tls.Certificate, fn RenewFunc, opts ...tlsRenewerOptions) (*TLSRenewer, error) {
@@ -83,15 +151,29 @@ func NewTLSRenewer(cert *tls.Certificate, fn RenewFunc, opts ...tlsRenewerOption
 // Run starts the certificate renewer for the given certificate.
 func (r *TLSRenewer) Run() {
 	cert := r.getCertificate()
-	next := r.nextRenewDuration(cert.Leaf.NotAfter)
-	r.renewMutex.Lock()
-	r.timer = time.AfterFunc(next, r.renewCertificate)
-	r.renewMutex.Unlock()
+	r.run(r.nextRenewDuration(cert.Leaf.NotAfter))
 }
 
 // RunContext starts the certificate renewer for the given certificate.
 func (r *TLSRenewer) RunContext(ctx context.Context) {
 	r.Run()
+	r.stopOnDone(ctx)
+}
+
+// runNowContext starts the certificate renewer renewing the certificate right
+// away.
+func (r *TLSRenewer) runNowContext(ctx context.Context) {
+	r.run(0)
+	r.stopOnDone(ctx)
+}
+
+func (r *TLSRenewer) run(next time.Duration) {
+	r.renewMutex.Lock()
+	r.timer = time.AfterFunc(next, r.renewCertificate)
+	r.renewMutex.Unlock()
+}
+
+func (r *TLSRenewer) stopOnDone(ctx context.Context) {
 	go func() {
 		<-ctx.Done()
 		r.Stop()
@@ -174,13 +256,39 @@ func (r *TLSRenewer) renewCertificate() {
 	if err != nil {
 		next = r.renewJitter / 2
 		next += time.Duration(mathRandInt63n(int64(next)))
+		if next < r.renewBackoff {
+			next = r.renewBackoff
+		}
 	} else {
 		r.setCertificate(cert)
 		next = r.nextRenewDuration(cert.Leaf.NotAfter)
 	}
+
 	r.renewMutex.Lock()
-	r.timer.Reset(next)
+	if err != nil {
+		r.failedAttempts++
+		err = &RenewError{
+			Err:      err,
+			Attempts: r.failedAttempts,
+			NotAfter: r.cert.Leaf.NotAfter,
+		}
+	} else {
+		r.failedAttempts = 0
+	}
+	if r.timer != nil {
+		r.timer.Reset(next)
+	}
 	r.renewMutex.Unlock()
+
+	if err != nil {
+		for _, fn := range r.onRenewError {
+			fn(err)
+		}
+	} else {
+		for _, fn := range r.onRenew {
+			fn(cert)
+		}
+	}
 }
 
 func (r *TLSRenewer) nextRenewDuration(notAfter time.Time) time.Duration {
@@ -193,7 +301,13 @@ func (r *TLSRenewer) nextRenewDuration(notAfter time.Time) time.Duration {
 	return d
 }
 
+// mathRandInt63n returns a random number in [0,n), or 0 if n is not positive,
+// a jitter of a few nanoseconds would make rand.Int63n panic.
+//
 //nolint:gosec // not used for cryptographic security
 func mathRandInt63n(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
 	return rand.Int63n(n)
 }
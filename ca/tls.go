@@ -9,6 +9,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"log"
 	"net"
 	"net/http"
 	"os"
@@ -127,9 +128,13 @@ func (c *Client) getClientTLSConfig(ctx context.Context, sign *api.SignResponse,
 
 	// Apply options and initialize mutable tls.Config
 	tlsCtx := newTLSOptionCtx(c, tlsConfig, sign)
+	tlsCtx.cache = certificateCacheFromContext(ctx)
 	if err := tlsCtx.apply(options); err != nil {
 		return nil, nil, err
 	}
+	if err := tlsCtx.applyRenewer(renewer); err != nil {
+		return nil, nil, err
+	}
 
 	tr := getDefaultTransport(tlsConfig)
 	//nolint:staticcheck // Use mutable tls.Config on renew
@@ -141,7 +146,7 @@ func (c *Client) getClientTLSConfig(ctx context.Context, sign *api.SignResponse,
 	c.SetTransport(tr)
 
 	// Start renewer
-	renewer.RunContext(ctx)
+	runRenewer(ctx, tlsCtx, renewer)
 	return tlsConfig, tr, nil
 }
 
@@ -169,9 +174,13 @@ func (c *Client) GetServerTLSConfig(ctx context.Context, sign *api.SignResponse,
 
 	// Apply options and initialize mutable tls.Config
 	tlsCtx := newTLSOptionCtx(c, tlsConfig, sign)
+	tlsCtx.cache = certificateCacheFromContext(ctx)
 	if err := tlsCtx.apply(options); err != nil {
 		return nil, err
 	}
+	if err := tlsCtx.applyRenewer(renewer); err != nil {
+		return nil, err
+	}
 
 	// GetConfigForClient allows seamless root and federated roots rotation.
 	// If the return of the callback is not-nil, it will use the returned
@@ -189,10 +198,20 @@ func (c *Client) GetServerTLSConfig(ctx context.Context, sign *api.SignResponse,
 	c.SetTransport(tr)
 
 	// Start renewer
-	renewer.RunContext(ctx)
+	runRenewer(ctx, tlsCtx, renewer)
 	return tlsConfig, nil
 }
 
+// runRenewer starts the renewer. A certificate loaded from the cache that has
+// reached the renewal time is renewed right away.
+func runRenewer(ctx context.Context, tlsCtx *TLSOptionCtx, r *TLSRenewer) {
+	if tlsCtx.cache != nil && needsRenewal(r.getCertificate().Leaf, tlsCtx.renewFraction, time.Now()) {
+		r.runNowContext(ctx)
+		return
+	}
+	r.RunContext(ctx)
+}
+
 // Transport returns an http.Transport configured to use the client certificate from the sign response.
 func (c *Client) Transport(ctx context.Context, sign *api.SignResponse, pk crypto.PrivateKey, options ...TLSOption) (*http.Transport, error) {
 	_, tr, err := c.getClientTLSConfig(ctx, sign, pk, options)
@@ -387,6 +406,15 @@ func getRenewFunc(ctx *TLSOptionCtx, client *Client, tr *http.Transport, pk cryp
 		if err != nil {
 			return nil, err
 		}
-		return TLSCertificate(sign, pk)
+		cert, err := TLSCertificate(sign, pk)
+		if err != nil {
+			return nil, err
+		}
+		// A failure writing the cache must not prevent the use of the new
+		// certificate.
+		if err := ctx.cache.store(sign, pk); err != nil {
+			log.Printf("error caching renewed certificate: %v", err)
+		}
+		return cert, nil
 	}
 }
@@ -3,6 +3,9 @@ package ca
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/smallstep/certificates/api"
 )
@@ -19,6 +22,9 @@ type TLSOptionCtx struct {
 	mutableConfig *mutableTLSConfig
 	hasRootCA     bool
 	hasClientCA   bool
+	cache         *certificateCache
+	renewOptions  []tlsRenewerOptions
+	renewFraction float64
 }
 
 // newTLSOptionCtx creates the TLSOption context.
@@ -89,6 +95,69 @@ func (ctx *TLSOptionCtx) applyRenew() error {
 	return nil
 }
 
+// applyRenewer applies the renewer options to the given renewer.
+func (ctx *TLSOptionCtx) applyRenewer(r *TLSRenewer) error {
+	for _, fn := range ctx.renewOptions {
+		if err := fn(r); err != nil {
+			return errors.Wrap(err, "error applying renewer options")
+		}
+	}
+	return nil
+}
+
+// RenewAtFraction is an option used to renew the certificate once the given
+// fraction of its validity period has elapsed. The fraction must be between 0
+// and 1, by default the certificate is renewed after 2/3rd of its lifetime.
+func RenewAtFraction(f float64) TLSOption {
+	return func(ctx *TLSOptionCtx) error {
+		ctx.renewOptions = append(ctx.renewOptions, WithRenewFraction(f))
+		ctx.renewFraction = f
+		return nil
+	}
+}
+
+// RenewJitter is an option used to set the maximum random time subtracted from
+// the renewal time, by default it's 1/20th of the certificate lifetime.
+func RenewJitter(d time.Duration) TLSOption {
+	return func(ctx *TLSOptionCtx) error {
+		if d <= 0 {
+			return errors.Errorf("renew jitter must be greater than 0, but got %v", d)
+		}
+		ctx.renewOptions = append(ctx.renewOptions, WithRenewJitter(d))
+		return nil
+	}
+}
+
+// RenewBackoff is an option used to set the minimum time to wait before
+// retrying a failed renewal.
+func RenewBackoff(d time.Duration) TLSOption {
+	return func(ctx *TLSOptionCtx) error {
+		ctx.renewOptions = append(ctx.renewOptions, WithRenewBackoff(d))
+		return nil
+	}
+}
+
+// OnRenew is an option used to add a function that will be called with every
+// renewed certificate. It can be used to log the rotation or to reload any
+// resource that depends on the certificate.
+func OnRenew(fn func(*tls.Certificate)) TLSOption {
+	return func(ctx *TLSOptionCtx) error {
+		ctx.renewOptions = append(ctx.renewOptions, WithOnRenew(fn))
+		return nil
+	}
+}
+
+// OnRenewError is an option used to add a function that will be called with a
+// *RenewError every time the certificate cannot be renewed. The error contains
+// the number of consecutive failures and the expiration of the current
+// certificate.
+func OnRenewError(fn func(error)) TLSOption {
+	return func(ctx *TLSOptionCtx) error {
+		ctx.renewOptions = append(ctx.renewOptions, WithOnRenewError(fn))
+		return nil
+	}
+}
+
 // RequireAndVerifyClientCert is a tls.Config option used on servers to enforce
 // a valid TLS client certificate. This is the default option for mTLS servers.
 func RequireAndVerifyClientCert() TLSOption {
@@ -3,12 +3,14 @@ package ca
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/smallstep/certificates/api"
 )
@@ -573,3 +575,120 @@ func equalPools(a, b *x509.CertPool) bool {
 	sort.Strings(sB)
 	return reflect.DeepEqual(sA, sB)
 }
+
+func TestTLSOptionCtx_applyRenewer(t *testing.T) {
+	newRenewer := func(fn RenewFunc) *TLSRenewer {
+		t.Helper()
+		r, err := NewTLSRenewer(&tls.Certificate{Leaf: &x509.Certificate{NotAfter: time.Now().Add(time.Hour)}}, fn)
+		if err != nil {
+			t.Fatalf("NewTLSRenewer() error = %v", err)
+		}
+		return r
+	}
+
+	type args struct {
+		options []TLSOption
+	}
+	tests := []struct {
+		name            string
+		args            args
+		wantRenewBefore time.Duration
+		wantJitter      time.Duration
+		wantBackoff     time.Duration
+		wantErr         bool
+	}{
+		{"ok default", args{nil}, 20 * time.Minute, 3 * time.Minute, 0, false},
+		{"ok", args{[]TLSOption{RenewAtFraction(0.5), RenewJitter(time.Minute), RenewBackoff(5 * time.Minute)}}, 30 * time.Minute, time.Minute, 5 * time.Minute, false},
+		{"fail fraction", args{[]TLSOption{RenewAtFraction(1)}}, 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &TLSOptionCtx{
+				Config:        &tls.Config{},
+				mutableConfig: newMutableTLSConfig(),
+			}
+			if err := ctx.apply(tt.args.options); err != nil {
+				t.Fatalf("TLSOptionCtx.apply() error = %v", err)
+			}
+			r := newRenewer(nil)
+			if err := ctx.applyRenewer(r); (err != nil) != tt.wantErr {
+				t.Fatalf("TLSOptionCtx.applyRenewer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if d := r.renewBefore - tt.wantRenewBefore; d < -time.Second || d > time.Second {
+				t.Errorf("TLSRenewer.renewBefore = %v, want %v", r.renewBefore, tt.wantRenewBefore)
+			}
+			if d := r.renewJitter - tt.wantJitter; d < -time.Second || d > time.Second {
+				t.Errorf("TLSRenewer.renewJitter = %v, want %v", r.renewJitter, tt.wantJitter)
+			}
+			if r.renewBackoff != tt.wantBackoff {
+				t.Errorf("TLSRenewer.renewBackoff = %v, want %v", r.renewBackoff, tt.wantBackoff)
+			}
+		})
+	}
+
+	if err := RenewJitter(0)(&TLSOptionCtx{}); err == nil {
+		t.Error("RenewJitter() error = nil, wantErr true")
+	}
+
+	// A jitter too small to be halved does not panic.
+	jr := newRenewer(func() (*tls.Certificate, error) {
+		return nil, fmt.Errorf("an error")
+	})
+	jctx := &TLSOptionCtx{Config: &tls.Config{}, mutableConfig: newMutableTLSConfig()}
+	if err := jctx.apply([]TLSOption{RenewJitter(time.Nanosecond)}); err != nil {
+		t.Fatalf("TLSOptionCtx.apply() error = %v", err)
+	}
+	if err := jctx.applyRenewer(jr); err != nil {
+		t.Fatalf("TLSOptionCtx.applyRenewer() error = %v", err)
+	}
+	jr.renewCertificate()
+	if d := jr.nextRenewDuration(time.Now().Add(time.Hour)); d <= 0 {
+		t.Errorf("TLSRenewer.nextRenewDuration() = %v, want > 0", d)
+	}
+
+	// Hooks
+	var (
+		renewed []*tls.Certificate
+		errs    []error
+		fail    = true
+	)
+	crt := &tls.Certificate{Leaf: &x509.Certificate{NotAfter: time.Now().Add(2 * time.Hour)}}
+	r := newRenewer(func() (*tls.Certificate, error) {
+		if fail {
+			return nil, fmt.Errorf("an error")
+		}
+		return crt, nil
+	})
+	ctx := &TLSOptionCtx{Config: &tls.Config{}, mutableConfig: newMutableTLSConfig()}
+	if err := ctx.apply([]TLSOption{
+		OnRenew(func(c *tls.Certificate) { renewed = append(renewed, c) }),
+		OnRenewError(func(err error) { errs = append(errs, err) }),
+	}); err != nil {
+		t.Fatalf("TLSOptionCtx.apply() error = %v", err)
+	}
+	if err := ctx.applyRenewer(r); err != nil {
+		t.Fatalf("TLSOptionCtx.applyRenewer() error = %v", err)
+	}
+
+	r.renewCertificate()
+	r.renewCertificate()
+	if len(errs) != 2 || len(renewed) != 0 {
+		t.Fatalf("hooks called with %v and %v", renewed, errs)
+	}
+	var renewErr *RenewError
+	if !errors.As(errs[1], &renewErr) || renewErr.Attempts != 2 || renewErr.Err.Error() != "an error" {
+		t.Errorf("OnRenewError() error = %v, want *RenewError with 2 attempts", errs[1])
+	}
+
+	fail = false
+	r.renewCertificate()
+	if len(renewed) != 1 || renewed[0] != crt || r.getCertificate() != crt {
+		t.Errorf("OnRenew() certificates = %v, want %v", renewed, crt)
+	}
+	if r.failedAttempts != 0 {
+		t.Errorf("TLSRenewer.failedAttempts = %d, want 0", r.failedAttempts)
+	}
+}
@@ -0,0 +1,143 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"go.step.sm/cli-utils/command"
+	"go.step.sm/cli-utils/errs"
+
+	"github.com/smallstep/certificates/ca"
+	"github.com/smallstep/certificates/ca/agent"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:      "agent",
+		Usage:     "run a local agent that requests certificates for this machine",
+		UsageText: "**step-ca agent** --ca-url=<uri> --root=<file> --provisioner=<name> --password-file=<file>",
+		Action:    agentAction,
+		Description: `**step-ca agent** runs a local agent that exposes the sign, renew and
+roots endpoints of the CA on a unix socket, or a named pipe on Windows. Local
+processes that cannot embed the Go client can use it to get certificates for
+the identity of the machine. The agent uses a JWK provisioner to authorize the
+certificate requests, and only allows the names configured with the --san flag,
+or the hostname if none is given.
+
+On Windows, the agent can be registered and run as a service.
+
+## EXAMPLES
+
+Run the agent on the default address:
+'''
+$ step-ca agent --ca-url https://ca.example.com --root root_ca.crt \
+  --provisioner agent@example.com --password-file password.txt
+'''
+
+Run the agent on a custom socket allowing two names:
+'''
+$ step-ca agent --ca-url https://ca.example.com --root root_ca.crt \
+  --provisioner agent@example.com --password-file password.txt \
+  --address /run/step/agent.sock --san host.example.com --san 10.0.0.1
+'''
+
+Run the agent allowing the members of the step group to connect:
+'''
+$ step-ca agent --ca-url https://ca.example.com --root root_ca.crt \
+  --provisioner agent@example.com --password-file password.txt --group step
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "ca-url",
+				Usage: "<URI> of the targeted Step Certificate Authority.",
+			},
+			cli.StringFlag{
+				Name:  "root",
+				Usage: "The path to the PEM <file> used as the root certificate authority.",
+			},
+			cli.StringFlag{
+				Name:  "provisioner",
+				Usage: "The <name> of the JWK provisioner used to authorize the requests.",
+			},
+			cli.StringFlag{
+				Name:  "kid",
+				Usage: "The provisioner key <id> to use, if not set the first key that decrypts will be used.",
+			},
+			cli.StringFlag{
+				Name:  "password-file",
+				Usage: "The path to the <file> containing the password to decrypt the provisioner key.",
+			},
+			cli.StringFlag{
+				Name:  "address",
+				Usage: "The unix socket or named pipe <address> the agent will listen on.",
+				Value: agent.DefaultAddress,
+			},
+			cli.StringFlag{
+				Name: "group",
+				Usage: `The <name> of the group allowed to connect to the agent. By default, the unix
+socket is only accessible by the user and group of the agent, and the named pipe
+by SYSTEM and the administrators.`,
+			},
+			cli.StringSliceFlag{
+				Name: "san",
+				Usage: `The <name> that local processes are allowed to request certificates for.
+Use the flag multiple times to allow multiple names.`,
+			},
+			cli.StringFlag{
+				Name:  "service-name",
+				Usage: "The <name> of the service when running as a Windows service.",
+				Value: "step-agent",
+			},
+		},
+	})
+}
+
+func agentAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+	for _, name := range []string{"ca-url", "root", "provisioner", "password-file"} {
+		if ctx.String(name) == "" {
+			return errs.RequiredFlag(ctx, name)
+		}
+	}
+
+	passwordFile := ctx.String("password-file")
+	b, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", passwordFile)
+	}
+	password := bytes.TrimRightFunc(b, unicode.IsSpace)
+
+	p, err := ca.NewProvisioner(ctx.String("provisioner"), ctx.String("kid"), ctx.String("ca-url"),
+		password, ca.WithRootFile(ctx.String("root")))
+	if err != nil {
+		return err
+	}
+
+	a, err := agent.New(p, agent.WithAllowedNames(ctx.StringSlice("san")...))
+	if err != nil {
+		return err
+	}
+
+	sigCtx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	address, group := ctx.String("address"), ctx.String("group")
+	return agent.RunService(sigCtx, ctx.String("service-name"), func(ctx context.Context) error {
+		l, err := agent.Listen(address, group)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Serving agent on %s ...\n", address)
+		return a.Serve(ctx, l)
+	})
+}
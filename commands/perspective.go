@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"go.step.sm/cli-utils/command"
+	"go.step.sm/cli-utils/errs"
+	"go.step.sm/crypto/pemutil"
+
+	"github.com/smallstep/certificates/acme"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:      "perspective",
+		Usage:     "run a remote perspective agent for multi-perspective ACME validation",
+		UsageText: "**step-ca perspective** --crt=<file> --key=<file> [--client-ca=<file>] [--secret-file=<file>]",
+		Action:    perspectiveAction,
+		Description: `**step-ca perspective** runs a remote perspective agent. The CA sends the
+http-01, dns-01 and tls-alpn-01 challenges to the agents configured in
+acme.validation.perspectives, and the agents validate them from their own
+network location.
+
+The agent is served over HTTPS. Requests must be authenticated with a client
+certificate issued by the --client-ca roots, with the secret in --secret-file
+sent as a bearer token, or with both.
+
+## EXAMPLES
+
+Run an agent that requires a client certificate:
+'''
+$ step-ca perspective --crt perspective.crt --key perspective.key \
+  --client-ca root_ca.crt
+'''
+
+Run an agent that requires a shared secret and uses a custom resolver:
+'''
+$ step-ca perspective --crt perspective.crt --key perspective.key \
+  --secret-file secret.txt --resolver 1.1.1.1
+'''`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "address",
+				Usage: "The <address> the agent will listen on.",
+				Value: ":8443",
+			},
+			cli.StringFlag{
+				Name:  "crt",
+				Usage: "The path to the PEM <file> with the TLS certificate of the agent.",
+			},
+			cli.StringFlag{
+				Name:  "key",
+				Usage: "The path to the PEM <file> with the TLS key of the agent.",
+			},
+			cli.StringFlag{
+				Name:  "client-ca",
+				Usage: "The path to the PEM <file> with the roots used to verify the client certificates.",
+			},
+			cli.StringFlag{
+				Name:  "secret-file",
+				Usage: "The path to the <file> containing the secret the requests must send as a bearer token.",
+			},
+			cli.StringSliceFlag{
+				Name: "resolver",
+				Usage: `The <address> of the DNS resolver used to validate the challenges.
+Use the flag multiple times to configure multiple resolvers.`,
+			},
+		},
+	})
+}
+
+func perspectiveAction(ctx *cli.Context) error {
+	if err := errs.NumberOfArguments(ctx, 0); err != nil {
+		return err
+	}
+	for _, name := range []string{"crt", "key"} {
+		if ctx.String(name) == "" {
+			return errs.RequiredFlag(ctx, name)
+		}
+	}
+	clientCA, secretFile := ctx.String("client-ca"), ctx.String("secret-file")
+	if clientCA == "" && secretFile == "" {
+		return errs.RequiredOrFlag(ctx, "client-ca", "secret-file")
+	}
+
+	cert, err := tls.LoadX509KeyPair(ctx.String("crt"), ctx.String("key"))
+	if err != nil {
+		return errors.Wrap(err, "error loading certificate")
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	var opts acme.PerspectiveHandlerOptions
+	if clientCA != "" {
+		roots, err := pemutil.ReadCertificateBundle(clientCA)
+		if err != nil {
+			return err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		for _, crt := range roots {
+			tlsConfig.ClientCAs.AddCert(crt)
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		opts.RequireClientCertificate = true
+	}
+	if secretFile != "" {
+		b, err := os.ReadFile(secretFile)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", secretFile)
+		}
+		if opts.Secret = string(bytes.TrimRightFunc(b, unicode.IsSpace)); opts.Secret == "" {
+			return errors.Errorf("%s is empty", secretFile)
+		}
+	}
+
+	var clientOpts []acme.ClientOption
+	if resolvers := ctx.StringSlice("resolver"); len(resolvers) > 0 {
+		resolver, err := acme.NewDNSResolver(acme.DNSResolverOptions{Servers: resolvers})
+		if err != nil {
+			return err
+		}
+		clientOpts = append(clientOpts, acme.WithDNSResolver(resolver))
+	}
+	handler, err := acme.NewPerspectiveHandler(acme.NewClient(clientOpts...), opts)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              ctx.String("address"),
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 15 * time.Second,
+	}
+	sigCtx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go func() {
+		<-sigCtx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving remote perspective on %s ...\n", srv.Addr)
+	if err := srv.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
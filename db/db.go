@@ -1,9 +1,13 @@
 package db
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +22,7 @@ import (
 var (
 	certsTable             = []byte("x509_certs")
 	certsDataTable         = []byte("x509_certs_data")
+	renewedCertsTable      = []byte("x509_renewed_certs")
 	revokedCertsTable      = []byte("revoked_x509_certs")
 	crlTable               = []byte("x509_crl")
 	revokedSSHCertsTable   = []byte("revoked_ssh_certs")
@@ -26,6 +31,9 @@ var (
 	sshHostsTable          = []byte("ssh_hosts")
 	sshUsersTable          = []byte("ssh_users")
 	sshHostPrincipalsTable = []byte("ssh_host_principals")
+	scepChallengesTable    = []byte("scep_challenges")
+	scepChallengeIDsTable  = []byte("scep_challenge_ids_by_provisioner")
+	latestCertsTable       = []byte("x509_latest_certs")
 )
 
 // TODO: at the moment we store a single CRL in the database, in a dedicated table.
@@ -36,6 +44,10 @@ var crlKey = []byte("crl")
 // been previously set.
 var ErrAlreadyExists = errors.New("already exists")
 
+// ErrSCEPChallengeUsed is returned when revoking a SCEP one-time challenge
+// that has already been used.
+var ErrSCEPChallengeUsed = errors.New("scep challenge has already been used")
+
 // Config represents the JSON attributes used for configuring a step-ca DB.
 type Config struct {
 	Type       string `json:"type"`
@@ -47,6 +59,34 @@ type Config struct {
 	// 'MemoryMap') to avoid memory-mapping log files. This can be useful
 	// in environments with low RAM
 	BadgerFileLoadingMode string `json:"badgerFileLoadingMode"`
+
+	// AllowDegradedRenewals allows renewals to succeed if the database is
+	// read-only or unreachable and the renewed certificate cannot be stored.
+	// Requests that require writes, like enrollments, will always fail.
+	AllowDegradedRenewals bool `json:"allowDegradedRenewals,omitempty"`
+}
+
+// Validate validates the database configuration. A nil configuration is
+// valid and uses an in-memory database. Multiple CA instances can share a
+// database only with the "mysql" and "postgresql" types.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	switch strings.ToLower(c.Type) {
+	case nosql.BadgerDriver, nosql.BadgerV1Driver, nosql.BadgerV2Driver,
+		nosql.BBoltDriver, nosql.MySQLDriver, nosql.PostgreSQLDriver:
+	case "":
+		return errors.New("db.type cannot be empty")
+	default:
+		return errors.Errorf("unsupported db.type %q", c.Type)
+	}
+
+	if c.DataSource == "" {
+		return errors.New("db.dataSource cannot be empty")
+	}
+	return nil
 }
 
 // AuthDB is an interface over an Authority DB client that implements a nosql.DB interface.
@@ -99,6 +139,30 @@ type CertificateRevocationListDB interface {
 	StoreCRL(*CertificateRevocationListInfo) error
 }
 
+// RevokedCertificateDB is an interface to indicate whether the DB can return
+// the revocation information of a certificate, required to answer OCSP
+// requests.
+type RevokedCertificateDB interface {
+	GetRevokedCertificate(sn string) (*RevokedCertificateInfo, error)
+}
+
+// CertificateInventoryDB is an interface to indicate whether the DB can list
+// all the X.509 certificates it stores.
+type CertificateInventoryDB interface {
+	GetCertificates() ([]*CertificateEntry, error)
+	GetCertificateEntry(serialNumber string) (*CertificateEntry, error)
+}
+
+// SCEPChallengeDB is an interface to indicate whether the DB supports the
+// one-time challenges of the SCEP provisioners.
+type SCEPChallengeDB interface {
+	StoreSCEPChallenge(provisionerID, challenge, reference string, expiresAt time.Time) (*SCEPChallenge, error)
+	UseSCEPChallenge(provisionerID, challenge, transactionID, subject string) (bool, error)
+	GetSCEPChallenges(provisionerID, cursor string, limit int) ([]*SCEPChallenge, string, error)
+	RevokeSCEPChallenge(provisionerID, id string) (*SCEPChallenge, error)
+	DeleteSCEPChallenges(before time.Time) (int, error)
+}
+
 // DB is a wrapper over the nosql.DB interface.
 type DB struct {
 	nosql.DB
@@ -125,7 +189,8 @@ func New(c *Config) (AuthDB, error) {
 	tables := [][]byte{
 		revokedCertsTable, certsTable, usedOTTTable,
 		sshCertsTable, sshHostsTable, sshHostPrincipalsTable, sshUsersTable,
-		revokedSSHCertsTable, certsDataTable, crlTable,
+		revokedSSHCertsTable, certsDataTable, crlTable, scepChallengesTable,
+		scepChallengeIDsTable, renewedCertsTable, latestCertsTable,
 	}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
@@ -259,6 +324,21 @@ func (db *DB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error) {
 	return &revokedCerts, nil
 }
 
+// GetRevokedCertificate returns the revocation information of the certificate
+// with the given serial number. It returns a not found error if the
+// certificate has not been revoked.
+func (db *DB) GetRevokedCertificate(sn string) (*RevokedCertificateInfo, error) {
+	b, err := db.Get(revokedCertsTable, []byte(sn))
+	if err != nil {
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	var rci RevokedCertificateInfo
+	if err := json.Unmarshal(b, &rci); err != nil {
+		return nil, errors.Wrap(err, "json Unmarshal error")
+	}
+	return &rci, nil
+}
+
 // StoreCRL stores a CRL in the DB
 func (db *DB) StoreCRL(crlInfo *CertificateRevocationListInfo) error {
 	crlInfoBytes, err := json.Marshal(crlInfo)
@@ -313,6 +393,149 @@ func (db *DB) GetCertificateData(serialNumber string) (*CertificateData, error)
 	return &data, nil
 }
 
+// CertificateEntry is an X.509 certificate stored in the database with its
+// provisioner, and whether it has been renewed or revoked.
+type CertificateEntry struct {
+	Certificate *x509.Certificate
+	Data        *CertificateData
+	RenewedBy   string
+	Revocation  *RevokedCertificateInfo
+}
+
+// GetCertificates returns all the X.509 certificates in the database.
+func (db *DB) GetCertificates() ([]*CertificateEntry, error) {
+	certs, err := db.List(certsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing certificates")
+	}
+	data, err := db.List(certsDataTable)
+	if err != nil && !database.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error listing certificates data")
+	}
+	renewed, err := db.List(renewedCertsTable)
+	if err != nil && !database.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error listing renewed certificates")
+	}
+	revoked, err := db.List(revokedCertsTable)
+	if err != nil && !database.IsErrNotFound(err) {
+		return nil, errors.Wrap(err, "error listing revoked certificates")
+	}
+
+	entries := make([]*CertificateEntry, 0, len(certs))
+	bySerial := make(map[string]*CertificateEntry, len(certs))
+	for _, e := range certs {
+		crt, err := x509.ParseCertificate(e.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing certificate with serial number %s", e.Key)
+		}
+		entry := &CertificateEntry{Certificate: crt}
+		entries = append(entries, entry)
+		bySerial[string(e.Key)] = entry
+	}
+	for _, e := range data {
+		if entry, ok := bySerial[string(e.Key)]; ok {
+			var cd CertificateData
+			if err := json.Unmarshal(e.Value, &cd); err != nil {
+				return nil, errors.Wrapf(err, "error unmarshaling data of certificate %s", e.Key)
+			}
+			entry.Data = &cd
+		}
+	}
+	for _, e := range renewed {
+		if entry, ok := bySerial[string(e.Key)]; ok {
+			entry.RenewedBy = string(e.Value)
+		}
+	}
+	for _, e := range revoked {
+		if entry, ok := bySerial[string(e.Key)]; ok {
+			var rci RevokedCertificateInfo
+			if err := json.Unmarshal(e.Value, &rci); err != nil {
+				return nil, errors.Wrapf(err, "error unmarshaling revocation of certificate %s", e.Key)
+			}
+			entry.Revocation = &rci
+		}
+	}
+	return entries, nil
+}
+
+// GetCertificateEntry returns the X.509 certificate with the given serial
+// number, with its provisioner, and whether it has been renewed or revoked.
+func (db *DB) GetCertificateEntry(serialNumber string) (*CertificateEntry, error) {
+	crt, err := db.GetCertificate(serialNumber)
+	if err != nil {
+		return nil, err
+	}
+	entry := &CertificateEntry{Certificate: crt}
+	key := []byte(serialNumber)
+	if entry.Data, err = db.GetCertificateData(serialNumber); err != nil && !database.IsErrNotFound(err) {
+		return nil, errors.Wrapf(err, "error loading data of certificate %s", serialNumber)
+	}
+	switch b, err := db.Get(renewedCertsTable, key); {
+	case err == nil:
+		entry.RenewedBy = string(b)
+	case !database.IsErrNotFound(err):
+		return nil, errors.Wrapf(err, "error loading renewal of certificate %s", serialNumber)
+	}
+	switch b, err := db.Get(revokedCertsTable, key); {
+	case err == nil:
+		var rci RevokedCertificateInfo
+		if err := json.Unmarshal(b, &rci); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling revocation of certificate %s", serialNumber)
+		}
+		entry.Revocation = &rci
+	case !database.IsErrNotFound(err):
+		return nil, errors.Wrapf(err, "error loading revocation of certificate %s", serialNumber)
+	}
+	return entry, nil
+}
+
+// certificateIdentity returns the key used to find the latest certificate
+// issued by a provisioner to the same subject and SANs. It returns nil if the
+// certificate does not have a subject or SANs.
+func certificateIdentity(provisionerID string, crt *x509.Certificate) []byte {
+	names := make([]string, 0, len(crt.DNSNames)+len(crt.EmailAddresses)+len(crt.IPAddresses)+len(crt.URIs))
+	for _, n := range crt.DNSNames {
+		names = append(names, "dns:"+strings.ToLower(n))
+	}
+	for _, n := range crt.EmailAddresses {
+		names = append(names, "email:"+strings.ToLower(n))
+	}
+	for _, ip := range crt.IPAddresses {
+		names = append(names, "ip:"+ip.String())
+	}
+	for _, u := range crt.URIs {
+		names = append(names, "uri:"+u.String())
+	}
+	if provisionerID == "" || (crt.Subject.CommonName == "" && len(names) == 0) {
+		return nil
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, v := range append([]string{provisionerID, crt.Subject.String()}, names...) {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return []byte(hex.EncodeToString(h.Sum(nil)))
+}
+
+// linkLatestCertificate adds to the transaction the operations that make the
+// given certificate the latest one of its subject, SANs, and provisioner. The
+// previous certificate, if any, is marked as renewed by the new one, so
+// certificates renewed by requesting a new one, like in ACME or SCEP, are not
+// reported as active in the inventory.
+func (db *DB) linkLatestCertificate(tx *database.Tx, provisionerID string, leaf *x509.Certificate) {
+	key := certificateIdentity(provisionerID, leaf)
+	if key == nil {
+		return
+	}
+	serialNumber := []byte(leaf.SerialNumber.String())
+	if prev, err := db.Get(latestCertsTable, key); err == nil && len(prev) > 0 && !bytes.Equal(prev, serialNumber) {
+		tx.Set(renewedCertsTable, prev, serialNumber)
+	}
+	tx.Set(latestCertsTable, key, serialNumber)
+}
+
 // StoreCertificate stores a certificate PEM.
 func (db *DB) StoreCertificate(crt *x509.Certificate) error {
 	if err := db.Set(certsTable, []byte(crt.SerialNumber.String()), crt.Raw); err != nil {
@@ -364,6 +587,9 @@ func (db *DB) StoreCertificateChain(p provisioner.Interface, chain ...*x509.Cert
 	tx := new(database.Tx)
 	tx.Set(certsTable, serialNumber, leaf.Raw)
 	tx.Set(certsDataTable, serialNumber, b)
+	if data.Provisioner != nil {
+		db.linkLatestCertificate(tx, data.Provisioner.ID, leaf)
+	}
 	if err := db.Update(tx); err != nil {
 		return errors.Wrap(err, "database Update error")
 	}
@@ -373,22 +599,33 @@ func (db *DB) StoreCertificateChain(p provisioner.Interface, chain ...*x509.Cert
 // StoreRenewedCertificate stores the leaf certificate and the provisioner that
 // authorized the old certificate if available.
 func (db *DB) StoreRenewedCertificate(oldCert *x509.Certificate, chain ...*x509.Certificate) error {
-	var certificateData []byte
+	var (
+		certificateData []byte
+		provisionerID   string
+	)
 	if data, err := db.GetCertificateData(oldCert.SerialNumber.String()); err == nil {
 		if b, err := json.Marshal(data); err == nil {
 			certificateData = b
 		}
+		if data.Provisioner != nil {
+			provisionerID = data.Provisioner.ID
+		}
 	}
 
 	leaf := chain[0]
 	serialNumber := []byte(leaf.SerialNumber.String())
 
-	// Add certificate and certificate data in one transaction.
+	// Add certificate and certificate data in one transaction, and link the
+	// old certificate with the new one.
 	tx := new(database.Tx)
 	tx.Set(certsTable, serialNumber, leaf.Raw)
 	if certificateData != nil {
 		tx.Set(certsDataTable, serialNumber, certificateData)
 	}
+	tx.Set(renewedCertsTable, []byte(oldCert.SerialNumber.String()), serialNumber)
+	if key := certificateIdentity(provisionerID, leaf); key != nil {
+		tx.Set(latestCertsTable, key, serialNumber)
+	}
 	if err := db.Update(tx); err != nil {
 		return errors.Wrap(err, "database Update error")
 	}
@@ -406,6 +643,249 @@ func (db *DB) UseToken(id, tok string) (bool, error) {
 	return swapped, nil
 }
 
+// SCEPChallenge is the data stored for a SCEP one-time challenge. The
+// challenge itself is not stored, only its hash is used as the key and the ID
+// of the challenge. The transaction ID and the subject of the certificate
+// request are stored when the challenge is used.
+type SCEPChallenge struct {
+	ID            string    `json:"id"`
+	ProvisionerID string    `json:"provisionerID"`
+	Reference     string    `json:"reference,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	UsedAt        time.Time `json:"usedAt,omitempty"`
+	TransactionID string    `json:"transactionID,omitempty"`
+	Subject       string    `json:"subject,omitempty"`
+	RevokedAt     time.Time `json:"revokedAt,omitempty"`
+}
+
+func scepChallengeID(challenge string) string {
+	sum := sha256.Sum256([]byte(challenge))
+	return hex.EncodeToString(sum[:])
+}
+
+func scepChallengeKey(provisionerID, id string) []byte {
+	return []byte(provisionerID + "." + id)
+}
+
+// StoreSCEPChallenge stores a one-time challenge for the given SCEP
+// provisioner. The reference is an optional name used to link the challenge
+// to an external system.
+func (db *DB) StoreSCEPChallenge(provisionerID, challenge, reference string, expiresAt time.Time) (*SCEPChallenge, error) {
+	sc := &SCEPChallenge{
+		ID:            scepChallengeID(challenge),
+		ProvisionerID: provisionerID,
+		Reference:     reference,
+		CreatedAt:     time.Now().UTC(),
+		ExpiresAt:     expiresAt,
+	}
+	b, err := json.Marshal(sc)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling scep challenge")
+	}
+	key := scepChallengeKey(provisionerID, sc.ID)
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, key, nil, b)
+	switch {
+	case err != nil:
+		return nil, errors.Wrap(err, "error storing scep challenge")
+	case !swapped:
+		return nil, errors.New("error storing scep challenge: challenge already exists")
+	}
+	// Index the challenge by provisioner, so the challenges of a provisioner
+	// can be listed. The challenge is deleted if it cannot be indexed.
+	if err := db.Set(scepChallengeIDsTable, key, []byte(sc.ID)); err != nil {
+		// Ignore the error from delete, we tried our best.
+		_ = db.Del(scepChallengesTable, key)
+		return nil, errors.Wrap(err, "error indexing scep challenge")
+	}
+	return sc, nil
+}
+
+const (
+	// DefaultSCEPChallengesLimit is the default limit for listing the
+	// one-time challenges of a SCEP provisioner.
+	DefaultSCEPChallengesLimit = 100
+	// DefaultSCEPChallengesMax is the maximum limit for listing the one-time
+	// challenges of a SCEP provisioner.
+	DefaultSCEPChallengesMax = 1000
+)
+
+// getSCEPChallengeIDs returns the sorted IDs of the one-time challenges of the
+// given SCEP provisioner. The index has one entry per challenge, with the
+// provisioner ID as the prefix of the key.
+func (db *DB) getSCEPChallengeIDs(provisionerID string) ([]string, error) {
+	entries, err := db.List(scepChallengeIDsTable)
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "error loading scep challenge ids for provisioner %s", provisionerID)
+	}
+	prefix := provisionerID + "."
+	var ids []string
+	for _, e := range entries {
+		id, ok := strings.CutPrefix(string(e.Key), prefix)
+		// The IDs are hex encoded, a dot belongs to another provisioner
+		// with the same prefix.
+		if ok && id != "" && !strings.Contains(id, ".") {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// UseSCEPChallenge consumes a one-time challenge of the given SCEP
+// provisioner, recording the transaction ID and the subject of the request
+// that used it. It returns true if the challenge exists, it has not expired
+// or been revoked, and it has not been used before.
+func (db *DB) UseSCEPChallenge(provisionerID, challenge, transactionID, subject string) (bool, error) {
+	key := scepChallengeKey(provisionerID, scepChallengeID(challenge))
+	b, err := db.Get(scepChallengesTable, key)
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "error loading scep challenge")
+	}
+	var sc SCEPChallenge
+	if err := json.Unmarshal(b, &sc); err != nil {
+		return false, errors.Wrap(err, "error unmarshaling scep challenge")
+	}
+	now := time.Now().UTC()
+	if !sc.UsedAt.IsZero() || !sc.RevokedAt.IsZero() || !now.Before(sc.ExpiresAt) {
+		return false, nil
+	}
+
+	// Mark the challenge as used, only one of the concurrent requests using
+	// it will succeed.
+	sc.UsedAt = now
+	sc.TransactionID = transactionID
+	sc.Subject = subject
+	nu, err := json.Marshal(&sc)
+	if err != nil {
+		return false, errors.Wrap(err, "error marshaling scep challenge")
+	}
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, key, b, nu)
+	if err != nil {
+		return false, errors.Wrap(err, "error storing scep challenge")
+	}
+	return swapped, nil
+}
+
+// GetSCEPChallenges returns a page of the one-time challenges of the given
+// SCEP provisioner, including the ones used, expired or revoked, until they
+// are deleted. The challenges are sorted by ID, starting with the cursor, and
+// the cursor of the next page is returned if there are more challenges.
+func (db *DB) GetSCEPChallenges(provisionerID, cursor string, limit int) ([]*SCEPChallenge, string, error) {
+	switch {
+	case limit <= 0:
+		limit = DefaultSCEPChallengesLimit
+	case limit > DefaultSCEPChallengesMax:
+		limit = DefaultSCEPChallengesMax
+	}
+
+	ids, err := db.getSCEPChallengeIDs(provisionerID)
+	if err != nil {
+		return nil, "", err
+	}
+	i := sort.SearchStrings(ids, cursor)
+	challenges := []*SCEPChallenge{}
+	for ; i < len(ids) && len(challenges) < limit; i++ {
+		id := ids[i]
+		b, err := db.Get(scepChallengesTable, scepChallengeKey(provisionerID, id))
+		if err != nil {
+			if database.IsErrNotFound(err) {
+				continue
+			}
+			return nil, "", errors.Wrapf(err, "error loading scep challenge %s", id)
+		}
+		sc := new(SCEPChallenge)
+		if err := json.Unmarshal(b, sc); err != nil {
+			return nil, "", errors.Wrapf(err, "error unmarshaling scep challenge %s", id)
+		}
+		sc.ID = id
+		challenges = append(challenges, sc)
+	}
+	if i < len(ids) {
+		return challenges, ids[i], nil
+	}
+	return challenges, "", nil
+}
+
+// RevokeSCEPChallenge revokes the one-time challenge with the given ID, so it
+// cannot be used anymore. It returns an error if the challenge is not found,
+// or if it has already been used.
+func (db *DB) RevokeSCEPChallenge(provisionerID, id string) (*SCEPChallenge, error) {
+	key := scepChallengeKey(provisionerID, id)
+	b, err := db.Get(scepChallengesTable, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading scep challenge %s", id)
+	}
+	sc := new(SCEPChallenge)
+	if err := json.Unmarshal(b, sc); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling scep challenge %s", id)
+	}
+	sc.ID = id
+	switch {
+	case !sc.UsedAt.IsZero():
+		return nil, ErrSCEPChallengeUsed
+	case !sc.RevokedAt.IsZero():
+		return sc, nil
+	}
+
+	sc.RevokedAt = time.Now().UTC()
+	nu, err := json.Marshal(sc)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling scep challenge")
+	}
+	_, swapped, err := db.CmpAndSwap(scepChallengesTable, key, b, nu)
+	switch {
+	case err != nil:
+		return nil, errors.Wrapf(err, "error storing scep challenge %s", id)
+	case !swapped:
+		return nil, ErrSCEPChallengeUsed
+	default:
+		return sc, nil
+	}
+}
+
+// DeleteSCEPChallenges deletes the one-time challenges of all the SCEP
+// provisioners that expired, were used, or were revoked before the given time,
+// and returns the number of challenges deleted.
+func (db *DB) DeleteSCEPChallenges(before time.Time) (int, error) {
+	entries, err := db.List(scepChallengesTable)
+	if err != nil {
+		if database.IsErrNotFound(err) {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "error loading scep challenges")
+	}
+	var deleted int
+	for _, e := range entries {
+		sc := new(SCEPChallenge)
+		if err := json.Unmarshal(e.Value, sc); err != nil {
+			return deleted, errors.Wrapf(err, "error unmarshaling scep challenge %s", e.Key)
+		}
+		if !sc.ExpiresAt.Before(before) && !isBefore(sc.UsedAt, before) && !isBefore(sc.RevokedAt, before) {
+			continue
+		}
+		if err := db.Del(scepChallengesTable, e.Key); err != nil && !database.IsErrNotFound(err) {
+			return deleted, errors.Wrapf(err, "error deleting scep challenge %s", e.Key)
+		}
+		if err := db.Del(scepChallengeIDsTable, e.Key); err != nil && !database.IsErrNotFound(err) {
+			return deleted, errors.Wrapf(err, "error deleting scep challenge index %s", e.Key)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// isBefore returns true if t is set and it is before the given time.
+func isBefore(t, before time.Time) bool {
+	return !t.IsZero() && t.Before(before)
+}
+
 // IsSSHHost returns if a principal is present in the ssh hosts table.
 func (db *DB) IsSSHHost(principal string) (bool, error) {
 	if _, err := db.Get(sshHostsTable, []byte(strings.ToLower(principal))); err != nil {
@@ -497,8 +977,93 @@ type MockAuthDB struct {
 	MGetSSHHostPrincipals   func() ([]string, error)
 	MShutdown               func() error
 	MGetRevokedCertificates func() (*[]RevokedCertificateInfo, error)
+	MGetRevokedCertificate  func(sn string) (*RevokedCertificateInfo, error)
 	MGetCRL                 func() (*CertificateRevocationListInfo, error)
 	MStoreCRL               func(*CertificateRevocationListInfo) error
+	MStoreSCEPChallenge     func(provisionerID, challenge, reference string, expiresAt time.Time) (*SCEPChallenge, error)
+	MUseSCEPChallenge       func(provisionerID, challenge, transactionID, subject string) (bool, error)
+	MGetSCEPChallenges      func(provisionerID, cursor string, limit int) ([]*SCEPChallenge, string, error)
+	MRevokeSCEPChallenge    func(provisionerID, id string) (*SCEPChallenge, error)
+	MDeleteSCEPChallenges   func(before time.Time) (int, error)
+	MGetCertificates        func() ([]*CertificateEntry, error)
+	MGetCertificateEntry    func(serialNumber string) (*CertificateEntry, error)
+}
+
+// GetCertificateEntry mock.
+func (m *MockAuthDB) GetCertificateEntry(serialNumber string) (*CertificateEntry, error) {
+	if m.MGetCertificateEntry != nil {
+		return m.MGetCertificateEntry(serialNumber)
+	}
+	if m.Ret1 == nil {
+		return nil, m.Err
+	}
+	return m.Ret1.(*CertificateEntry), m.Err
+}
+
+// GetCertificates mock.
+func (m *MockAuthDB) GetCertificates() ([]*CertificateEntry, error) {
+	if m.MGetCertificates != nil {
+		return m.MGetCertificates()
+	}
+	if m.Ret1 == nil {
+		return nil, m.Err
+	}
+	return m.Ret1.([]*CertificateEntry), m.Err
+}
+
+// StoreSCEPChallenge mock.
+func (m *MockAuthDB) StoreSCEPChallenge(provisionerID, challenge, reference string, expiresAt time.Time) (*SCEPChallenge, error) {
+	if m.MStoreSCEPChallenge != nil {
+		return m.MStoreSCEPChallenge(provisionerID, challenge, reference, expiresAt)
+	}
+	if m.Ret1 == nil {
+		return nil, m.Err
+	}
+	return m.Ret1.(*SCEPChallenge), m.Err
+}
+
+// UseSCEPChallenge mock.
+func (m *MockAuthDB) UseSCEPChallenge(provisionerID, challenge, transactionID, subject string) (bool, error) {
+	if m.MUseSCEPChallenge != nil {
+		return m.MUseSCEPChallenge(provisionerID, challenge, transactionID, subject)
+	}
+	if m.Ret1 == nil {
+		return false, m.Err
+	}
+	return m.Ret1.(bool), m.Err
+}
+
+// GetSCEPChallenges mock.
+func (m *MockAuthDB) GetSCEPChallenges(provisionerID, cursor string, limit int) ([]*SCEPChallenge, string, error) {
+	if m.MGetSCEPChallenges != nil {
+		return m.MGetSCEPChallenges(provisionerID, cursor, limit)
+	}
+	if m.Ret1 == nil {
+		return nil, "", m.Err
+	}
+	return m.Ret1.([]*SCEPChallenge), "", m.Err
+}
+
+// RevokeSCEPChallenge mock.
+func (m *MockAuthDB) RevokeSCEPChallenge(provisionerID, id string) (*SCEPChallenge, error) {
+	if m.MRevokeSCEPChallenge != nil {
+		return m.MRevokeSCEPChallenge(provisionerID, id)
+	}
+	if m.Ret1 == nil {
+		return nil, m.Err
+	}
+	return m.Ret1.(*SCEPChallenge), m.Err
+}
+
+// DeleteSCEPChallenges mock.
+func (m *MockAuthDB) DeleteSCEPChallenges(before time.Time) (int, error) {
+	if m.MDeleteSCEPChallenges != nil {
+		return m.MDeleteSCEPChallenges(before)
+	}
+	if m.Ret1 == nil {
+		return 0, m.Err
+	}
+	return m.Ret1.(int), m.Err
 }
 
 func (m *MockAuthDB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error) {
@@ -508,6 +1073,14 @@ func (m *MockAuthDB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error)
 	return m.Ret1.(*[]RevokedCertificateInfo), m.Err
 }
 
+// GetRevokedCertificate mock.
+func (m *MockAuthDB) GetRevokedCertificate(sn string) (*RevokedCertificateInfo, error) {
+	if m.MGetRevokedCertificate != nil {
+		return m.MGetRevokedCertificate(sn)
+	}
+	return m.Ret1.(*RevokedCertificateInfo), m.Err
+}
+
 func (m *MockAuthDB) GetCRL() (*CertificateRevocationListInfo, error) {
 	if m.MGetCRL != nil {
 		return m.MGetCRL()
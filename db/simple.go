@@ -46,6 +46,11 @@ func (s *SimpleDB) GetRevokedCertificates() (*[]RevokedCertificateInfo, error) {
 	return nil, ErrNotImplemented
 }
 
+// GetRevokedCertificate returns a "NotImplemented" error.
+func (s *SimpleDB) GetRevokedCertificate(string) (*RevokedCertificateInfo, error) {
+	return nil, ErrNotImplemented
+}
+
 // GetCRL returns a "NotImplemented" error.
 func (s *SimpleDB) GetCRL() (*CertificateRevocationListInfo, error) {
 	return nil, ErrNotImplemented
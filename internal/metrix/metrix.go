@@ -0,0 +1,302 @@
+// Package metrix implements the Prometheus metrics exported by the CA. The
+// metrics are written using the Prometheus text exposition format.
+package metrix
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const namespace = "step_ca"
+
+var (
+	challengeBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	dbBuckets        = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+)
+
+// Meter collects the metrics of the CA operations. A nil Meter is valid and
+// discards all the observations.
+type Meter struct {
+	certificates         *counterVec
+	challengeValidations *counterVec
+	challengeDuration    *histogramVec
+	scepOperations       *counterVec
+	dbDuration           *histogramVec
+	dbErrors             *counterVec
+
+	mu            sync.RWMutex
+	intermediates []*x509.Certificate
+}
+
+// New creates a new Meter.
+func New() *Meter {
+	return &Meter{
+		certificates: newCounterVec("certificates_total",
+			"Number of certificate operations by certificate type, operation, provisioner and result.",
+			"type", "operation", "provisioner", "success"),
+		challengeValidations: newCounterVec("acme_challenge_validations_total",
+			"Number of ACME challenge validations by challenge type and outcome.",
+			"type", "outcome"),
+		challengeDuration: newHistogramVec("acme_challenge_validation_duration_seconds",
+			"Latency of the ACME challenge validations by challenge type.",
+			challengeBuckets, "type"),
+		scepOperations: newCounterVec("scep_operations_total",
+			"Number of SCEP operations by operation and outcome.",
+			"operation", "outcome"),
+		dbDuration: newHistogramVec("db_operation_duration_seconds",
+			"Latency of the database operations by operation.",
+			dbBuckets, "operation"),
+		dbErrors: newCounterVec("db_operation_errors_total",
+			"Number of failed database operations by operation.",
+			"operation"),
+	}
+}
+
+// CertificateOperation records an X.509 or SSH certificate operation, like
+// sign, renew, rekey or revoke, performed with the given provisioner.
+func (m *Meter) CertificateOperation(certType, operation, provisioner string, err error) {
+	if m == nil {
+		return
+	}
+	m.certificates.inc(certType, operation, provisioner, strconv.FormatBool(err == nil))
+}
+
+// ACMEChallengeValidated records the outcome and the latency of the
+// validation of an ACME challenge.
+func (m *Meter) ACMEChallengeValidated(challengeType, outcome string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.challengeValidations.inc(challengeType, outcome)
+	m.challengeDuration.observe(d.Seconds(), challengeType)
+}
+
+// SCEPOperation records the outcome of a SCEP operation.
+func (m *Meter) SCEPOperation(operation, outcome string) {
+	if m == nil {
+		return
+	}
+	m.scepOperations.inc(operation, outcome)
+}
+
+// DBOperation records the latency of a database operation, and whether it
+// failed.
+func (m *Meter) DBOperation(operation string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.dbDuration.observe(d.Seconds(), operation)
+	if err != nil {
+		m.dbErrors.inc(operation)
+	}
+}
+
+// SetIntermediates sets the intermediate certificates of the CA, their
+// expiration is exported as a gauge.
+func (m *Meter) SetIntermediates(certs []*x509.Certificate) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.intermediates = certs
+	m.mu.Unlock()
+}
+
+// ServeHTTP writes all the metrics using the Prometheus text format.
+func (m *Meter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var buf bytes.Buffer
+	m.certificates.write(&buf)
+	m.challengeValidations.write(&buf)
+	m.challengeDuration.write(&buf)
+	m.scepOperations.write(&buf)
+	m.dbDuration.write(&buf)
+	m.dbErrors.write(&buf)
+	m.writeIntermediates(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (m *Meter) writeIntermediates(buf *bytes.Buffer) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	name := namespace + "_intermediate_certificate_expiry_timestamp_seconds"
+	writeHeader(buf, name, "Expiration of the intermediate certificates of the CA as a unix timestamp.", "gauge")
+	for _, crt := range m.intermediates {
+		fmt.Fprintf(buf, "%s%s %d\n", name,
+			formatLabels([]string{"subject", "serial"}, []string{crt.Subject.CommonName, crt.SerialNumber.String()}, ""),
+			crt.NotAfter.Unix())
+	}
+}
+
+type metricsKey struct{}
+
+// NewContext adds the given meter to the context.
+func NewContext(ctx context.Context, m *Meter) context.Context {
+	return context.WithValue(ctx, metricsKey{}, m)
+}
+
+// FromContext returns the meter in the context, or nil if there is none. The
+// returned meter can always be used.
+func FromContext(ctx context.Context) *Meter {
+	m, _ := ctx.Value(metricsKey{}).(*Meter)
+	return m
+}
+
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]*counter
+}
+
+type counter struct {
+	labels []string
+	value  float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{
+		name:   namespace + "_" + name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*counter),
+	}
+}
+
+func (c *counterVec) inc(values ...string) {
+	key := strings.Join(values, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	if !ok {
+		v = &counter{labels: values}
+		c.values[key] = v
+	}
+	v.value++
+}
+
+func (c *counterVec) write(buf *bytes.Buffer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(buf, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		v := c.values[key]
+		fmt.Fprintf(buf, "%s%s %s\n", c.name, formatLabels(c.labels, v.labels, ""), formatFloat(v.value))
+	}
+}
+
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{
+		name:    namespace + "_" + name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*histogram),
+	}
+}
+
+func (h *histogramVec) observe(v float64, values ...string) {
+	key := strings.Join(values, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	o, ok := h.values[key]
+	if !ok {
+		o = &histogram{labels: values, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = o
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			o.counts[i]++
+		}
+	}
+	o.count++
+	o.sum += v
+}
+
+func (h *histogramVec) write(buf *bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(buf, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		o := h.values[key]
+		for i, b := range h.buckets {
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, o.labels, formatFloat(b)), o.counts[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, o.labels, "+Inf"), o.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", h.name, formatLabels(h.labels, o.labels, ""), formatFloat(o.sum))
+		fmt.Fprintf(buf, "%s_count%s %d\n", h.name, formatLabels(h.labels, o.labels, ""), o.count)
+	}
+}
+
+func writeHeader(buf *bytes.Buffer, name, help, typ string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+}
+
+// formatLabels returns the label set of a sample. If le is not empty it's
+// added as the bucket label of an histogram.
+func formatLabels(names, values []string, le string) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		parts = append(parts, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if le != "" {
+		parts = append(parts, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value as required by the text format.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(strings.ToValidUTF8(s, "\uFFFD"))
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
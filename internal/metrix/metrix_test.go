@@ -0,0 +1,102 @@
+package metrix
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, m *Meter) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	res := rec.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", res.Header.Get("Content-Type"))
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestMeter(t *testing.T) {
+	m := New()
+	m.CertificateOperation("x509", "sign", "jwk", nil)
+	m.CertificateOperation("x509", "sign", "jwk", nil)
+	m.CertificateOperation("x509", "sign", "acme", errors.New("force"))
+	m.CertificateOperation("ssh", "revoke", `my "prov"`, nil)
+	m.ACMEChallengeValidated("http-01", "valid", 300*time.Millisecond)
+	m.ACMEChallengeValidated("http-01", "retry", 2*time.Second)
+	m.SCEPOperation("PKIOperation", "success")
+	m.DBOperation("store_certificate", time.Millisecond, nil)
+	m.DBOperation("store_certificate", 20*time.Millisecond, errors.New("force"))
+	m.SetIntermediates([]*x509.Certificate{{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: "Intermediate CA"},
+		NotAfter:     time.Unix(1700000000, 0),
+	}})
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		"# TYPE step_ca_certificates_total counter\n",
+		`step_ca_certificates_total{type="x509",operation="sign",provisioner="jwk",success="true"} 2` + "\n",
+		`step_ca_certificates_total{type="x509",operation="sign",provisioner="acme",success="false"} 1` + "\n",
+		`step_ca_certificates_total{type="ssh",operation="revoke",provisioner="my \"prov\"",success="true"} 1` + "\n",
+		`step_ca_acme_challenge_validations_total{type="http-01",outcome="valid"} 1` + "\n",
+		"# TYPE step_ca_acme_challenge_validation_duration_seconds histogram\n",
+		`step_ca_acme_challenge_validation_duration_seconds_bucket{type="http-01",le="0.25"} 0` + "\n",
+		`step_ca_acme_challenge_validation_duration_seconds_bucket{type="http-01",le="0.5"} 1` + "\n",
+		`step_ca_acme_challenge_validation_duration_seconds_bucket{type="http-01",le="2.5"} 2` + "\n",
+		`step_ca_acme_challenge_validation_duration_seconds_bucket{type="http-01",le="+Inf"} 2` + "\n",
+		`step_ca_acme_challenge_validation_duration_seconds_sum{type="http-01"} 2.3` + "\n",
+		`step_ca_acme_challenge_validation_duration_seconds_count{type="http-01"} 2` + "\n",
+		`step_ca_scep_operations_total{operation="PKIOperation",outcome="success"} 1` + "\n",
+		`step_ca_db_operation_duration_seconds_count{operation="store_certificate"} 2` + "\n",
+		`step_ca_db_operation_errors_total{operation="store_certificate"} 1` + "\n",
+		"# TYPE step_ca_intermediate_certificate_expiry_timestamp_seconds gauge\n",
+		`step_ca_intermediate_certificate_expiry_timestamp_seconds{subject="Intermediate CA",serial="1234"} 1700000000` + "\n",
+	} {
+		assert.Contains(t, out, want)
+	}
+
+	// Samples are sorted, so the output is stable.
+	assert.Equal(t, out, scrape(t, m))
+	assert.Less(t, strings.Index(out, `provisioner="acme"`), strings.Index(out, `provisioner="jwk"`))
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", http.NoBody))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestMeter_nil(t *testing.T) {
+	var m *Meter
+	assert.NotPanics(t, func() {
+		m.CertificateOperation("x509", "sign", "jwk", nil)
+		m.ACMEChallengeValidated("http-01", "valid", time.Second)
+		m.SCEPOperation("GetCACert", "success")
+		m.DBOperation("revoke", time.Second, nil)
+		m.SetIntermediates(nil)
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()))
+	m := New()
+	assert.Equal(t, m, FromContext(NewContext(context.Background(), m)))
+}
+
+func Test_escapeLabel(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\nd`, escapeLabel("a\\b\"c\nd"))
+	assert.Equal(t, "a�b", escapeLabel("a\xffb"))
+}
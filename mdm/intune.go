@@ -0,0 +1,112 @@
+package mdm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	defaultGraphURL = "https://graph.microsoft.com"
+	defaultLoginURL = "https://login.microsoftonline.com"
+)
+
+// intune implements a Provider for Microsoft Intune using the Microsoft Graph
+// API with an application registered in Azure AD.
+type intune struct {
+	graphURL string
+	client   *http.Client
+}
+
+func newIntune(c *Config, tokenURL string) *intune {
+	graphURL := strings.TrimSuffix(c.URL, "/")
+	if graphURL == "" {
+		graphURL = defaultGraphURL
+	}
+	if tokenURL == "" {
+		tokenURL = fmt.Sprintf("%s/%s/oauth2/v2.0/token", defaultLoginURL, url.PathEscape(c.TenantID))
+	}
+	cc := &clientcredentials.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		TokenURL:     tokenURL,
+		Scopes:       []string{graphURL + "/.default"},
+		AuthStyle:    oauth2.AuthStyleInParams,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{
+		Timeout: defaultTimeout,
+	})
+	client := cc.Client(ctx)
+	client.Timeout = defaultTimeout
+	return &intune{
+		graphURL: graphURL,
+		client:   client,
+	}
+}
+
+type intuneManagedDevicesResponse struct {
+	Value []struct {
+		ID              string `json:"id"`
+		SerialNumber    string `json:"serialNumber"`
+		UDID            string `json:"udid"`
+		ComplianceState string `json:"complianceState"`
+		ManagementState string `json:"managementState"`
+	} `json:"value"`
+}
+
+// Lookup looks for the device in the managed devices of Intune. A device is
+// considered compliant if its compliance state is "compliant".
+func (i *intune) Lookup(ctx context.Context, serialNumber, udid string) (*Device, error) {
+	var filters []string
+	if serialNumber != "" {
+		filters = append(filters, fmt.Sprintf("serialNumber eq '%s'", odataEscape(serialNumber)))
+	}
+	if udid != "" {
+		filters = append(filters, fmt.Sprintf("udid eq '%s'", odataEscape(udid)))
+	}
+	if len(filters) == 0 {
+		return nil, errors.New("serial number or udid is required")
+	}
+
+	q := url.Values{}
+	q.Set("$filter", strings.Join(filters, " or "))
+	q.Set("$select", "id,serialNumber,udid,complianceState,managementState")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.graphURL+"/v1.0/deviceManagement/managedDevices?"+q.Encode(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating intune request")
+	}
+	resp, err := doJSON(i.client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying intune")
+	}
+	defer resp.Body.Close()
+
+	var devices intuneManagedDevicesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		return nil, errors.Wrap(err, "error decoding intune response")
+	}
+	if len(devices.Value) == 0 {
+		return nil, ErrDeviceNotFound
+	}
+
+	d := devices.Value[0]
+	return &Device{
+		ID:           d.ID,
+		SerialNumber: d.SerialNumber,
+		UDID:         d.UDID,
+		Managed:      strings.EqualFold(d.ManagementState, "managed"),
+		Compliant:    strings.EqualFold(d.ComplianceState, "compliant"),
+	}, nil
+}
+
+// odataEscape escapes single quotes in OData string literals.
+func odataEscape(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
@@ -0,0 +1,86 @@
+package mdm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntune_Lookup(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, srv.URL+"/.default", r.Form.Get("scope"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"the-token","token_type":"Bearer","expires_in":300}`))
+	})
+	mux.HandleFunc("/v1.0/deviceManagement/managedDevices", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer the-token", r.Header.Get("Authorization"))
+		value := []any{}
+		switch r.URL.Query().Get("$filter") {
+		case "serialNumber eq 'COMPLIANT' or udid eq 'UDID-1'":
+			value = append(value, map[string]any{
+				"id": "1", "serialNumber": "COMPLIANT", "udid": "UDID-1",
+				"complianceState": "compliant", "managementState": "managed",
+			})
+		case "serialNumber eq 'NONCOMPLIANT'":
+			value = append(value, map[string]any{
+				"id": "2", "serialNumber": "NONCOMPLIANT",
+				"complianceState": "noncompliant", "managementState": "managed",
+			})
+		case "serialNumber eq 'O''BRIEN'":
+			value = append(value, map[string]any{
+				"id": "3", "serialNumber": "O'BRIEN",
+				"complianceState": "compliant", "managementState": "retirePending",
+			})
+		case "serialNumber eq 'ERROR'":
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"value": value})
+	})
+
+	i := newIntune(&Config{Type: Intune, URL: srv.URL, TenantID: "tenant", ClientID: "id", ClientSecret: "secret"}, srv.URL+"/tenant/oauth2/v2.0/token")
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		serialNumber string
+		udid         string
+		want         *Device
+		wantErr      error
+	}{
+		{"ok compliant", "COMPLIANT", "UDID-1", &Device{ID: "1", SerialNumber: "COMPLIANT", UDID: "UDID-1", Managed: true, Compliant: true}, nil},
+		{"ok noncompliant", "NONCOMPLIANT", "", &Device{ID: "2", SerialNumber: "NONCOMPLIANT", Managed: true}, nil},
+		{"ok escaped", "O'BRIEN", "", &Device{ID: "3", SerialNumber: "O'BRIEN", Compliant: true}, nil},
+		{"fail not found", "MISSING", "", nil, ErrDeviceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := i.Lookup(ctx, tt.serialNumber, tt.udid)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("fail error", func(t *testing.T) {
+		_, err := i.Lookup(ctx, "ERROR", "")
+		assert.Error(t, err)
+	})
+	t.Run("fail empty", func(t *testing.T) {
+		_, err := i.Lookup(ctx, "", "")
+		assert.Error(t, err)
+	})
+}
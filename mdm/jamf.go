@@ -0,0 +1,148 @@
+package mdm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// jamf implements a Provider for Jamf Pro using the Jamf Pro API with an API
+// client.
+type jamf struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newJamf(c *Config, tokenURL string) *jamf {
+	baseURL := strings.TrimSuffix(c.URL, "/")
+	if tokenURL == "" {
+		tokenURL = baseURL + "/api/oauth/token"
+	}
+	cc := &clientcredentials.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		TokenURL:     tokenURL,
+		AuthStyle:    oauth2.AuthStyleInParams,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{
+		Timeout: defaultTimeout,
+	})
+	client := cc.Client(ctx)
+	client.Timeout = defaultTimeout
+	return &jamf{
+		baseURL: baseURL,
+		client:  client,
+	}
+}
+
+type jamfComputersResponse struct {
+	TotalCount int `json:"totalCount"`
+	Results    []struct {
+		ID      string `json:"id"`
+		UDID    string `json:"udid"`
+		General struct {
+			RemoteManagement struct {
+				Managed bool `json:"managed"`
+			} `json:"remoteManagement"`
+		} `json:"general"`
+		Hardware struct {
+			SerialNumber string `json:"serialNumber"`
+		} `json:"hardware"`
+	} `json:"results"`
+}
+
+type jamfMobileDevicesResponse struct {
+	TotalCount int `json:"totalCount"`
+	Results    []struct {
+		ID      string `json:"mobileDeviceId"`
+		General struct {
+			UDID    string `json:"udid"`
+			Managed bool   `json:"managed"`
+		} `json:"general"`
+		Hardware struct {
+			SerialNumber string `json:"serialNumber"`
+		} `json:"hardware"`
+	} `json:"results"`
+}
+
+// Lookup looks for the device in the computers inventory and, if not found, in
+// the mobile devices inventory. Jamf does not have a concept of compliance, a
+// managed device is considered compliant.
+func (j *jamf) Lookup(ctx context.Context, serialNumber, udid string) (*Device, error) {
+	if serialNumber == "" && udid == "" {
+		return nil, errors.New("serial number or udid is required")
+	}
+
+	var computers jamfComputersResponse
+	filter := jamfFilter("hardware.serialNumber", serialNumber, "udid", udid)
+	if err := j.get(ctx, "/api/v1/computers-inventory", filter, &computers); err != nil {
+		return nil, err
+	}
+	if len(computers.Results) > 0 {
+		r := computers.Results[0]
+		return &Device{
+			ID:           r.ID,
+			SerialNumber: r.Hardware.SerialNumber,
+			UDID:         r.UDID,
+			Managed:      r.General.RemoteManagement.Managed,
+			Compliant:    r.General.RemoteManagement.Managed,
+		}, nil
+	}
+
+	var devices jamfMobileDevicesResponse
+	filter = jamfFilter("hardware.serialNumber", serialNumber, "general.udid", udid)
+	if err := j.get(ctx, "/api/v2/mobile-devices/detail", filter, &devices); err != nil {
+		return nil, err
+	}
+	if len(devices.Results) > 0 {
+		r := devices.Results[0]
+		return &Device{
+			ID:           r.ID,
+			SerialNumber: r.Hardware.SerialNumber,
+			UDID:         r.General.UDID,
+			Managed:      r.General.Managed,
+			Compliant:    r.General.Managed,
+		}, nil
+	}
+
+	return nil, ErrDeviceNotFound
+}
+
+func (j *jamf) get(ctx context.Context, path, filter string, v any) error {
+	q := url.Values{}
+	q.Add("section", "GENERAL")
+	q.Add("section", "HARDWARE")
+	q.Set("filter", filter)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.baseURL+path+"?"+q.Encode(), http.NoBody)
+	if err != nil {
+		return errors.Wrap(err, "error creating jamf request")
+	}
+	resp, err := doJSON(j.client, req)
+	if err != nil {
+		return errors.Wrap(err, "error querying jamf")
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrap(err, "error decoding jamf response")
+	}
+	return nil
+}
+
+// jamfFilter returns an RSQL filter matching any of the non-empty values.
+func jamfFilter(serialField, serialNumber, udidField, udid string) string {
+	var parts []string
+	if serialNumber != "" {
+		parts = append(parts, fmt.Sprintf("%s==%q", serialField, serialNumber))
+	}
+	if udid != "" {
+		parts = append(parts, fmt.Sprintf("%s==%q", udidField, udid))
+	}
+	return strings.Join(parts, ",")
+}
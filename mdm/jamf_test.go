@@ -0,0 +1,85 @@
+package mdm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJamf_Lookup(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/api/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "id", r.Form.Get("client_id"))
+		assert.Equal(t, "secret", r.Form.Get("client_secret"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"the-token","token_type":"Bearer","expires_in":300}`))
+	})
+	mux.HandleFunc("/api/v1/computers-inventory", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer the-token", r.Header.Get("Authorization"))
+		var resp any = map[string]any{"totalCount": 0, "results": []any{}}
+		switch r.URL.Query().Get("filter") {
+		case `hardware.serialNumber=="C02MANAGED",udid=="UDID-1"`:
+			resp = map[string]any{"totalCount": 1, "results": []any{map[string]any{
+				"id": "1", "udid": "UDID-1",
+				"general":  map[string]any{"remoteManagement": map[string]any{"managed": true}},
+				"hardware": map[string]any{"serialNumber": "C02MANAGED"},
+			}}}
+		case `hardware.serialNumber=="ERROR"`:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/api/v2/mobile-devices/detail", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer the-token", r.Header.Get("Authorization"))
+		var resp any = map[string]any{"totalCount": 0, "results": []any{}}
+		if r.URL.Query().Get("filter") == `hardware.serialNumber=="DMPHONE"` {
+			resp = map[string]any{"totalCount": 1, "results": []any{map[string]any{
+				"mobileDeviceId": "2",
+				"general":        map[string]any{"udid": "UDID-2", "managed": false},
+				"hardware":       map[string]any{"serialNumber": "DMPHONE"},
+			}}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	j := newJamf(&Config{Type: Jamf, URL: srv.URL + "/", ClientID: "id", ClientSecret: "secret"}, "")
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		serialNumber string
+		udid         string
+		want         *Device
+		wantErr      bool
+	}{
+		{"ok computer", "C02MANAGED", "UDID-1", &Device{ID: "1", SerialNumber: "C02MANAGED", UDID: "UDID-1", Managed: true, Compliant: true}, false},
+		{"ok mobile device", "DMPHONE", "", &Device{ID: "2", SerialNumber: "DMPHONE", UDID: "UDID-2"}, false},
+		{"fail not found", "MISSING", "", nil, true},
+		{"fail error", "ERROR", "", nil, true},
+		{"fail empty", "", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := j.Lookup(ctx, tt.serialNumber, tt.udid)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := j.Lookup(ctx, "MISSING", "")
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+}
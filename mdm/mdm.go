@@ -0,0 +1,113 @@
+// Package mdm implements lookup providers that query a mobile device
+// management (MDM) service to verify that a device is enrolled and compliant.
+package mdm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDeviceNotFound is the error returned when a device is not enrolled in the
+// MDM.
+var ErrDeviceNotFound = errors.New("device not found")
+
+// Device is the device information returned by an MDM.
+type Device struct {
+	ID           string
+	SerialNumber string
+	UDID         string
+	Managed      bool
+	Compliant    bool
+}
+
+// Provider is the interface implemented by the MDM lookup providers.
+type Provider interface {
+	// Lookup returns the device with the given serial number or UDID. It
+	// returns ErrDeviceNotFound if the device is not enrolled.
+	Lookup(ctx context.Context, serialNumber, udid string) (*Device, error)
+}
+
+// Type is the type of MDM lookup provider.
+type Type string
+
+const (
+	// Jamf is the type used for Jamf Pro.
+	Jamf Type = "jamf"
+	// Intune is the type used for Microsoft Intune.
+	Intune Type = "intune"
+)
+
+// Config is the configuration of an MDM lookup provider.
+type Config struct {
+	// Type is the MDM type, jamf or intune.
+	Type Type `json:"type"`
+	// URL is the base URL of the Jamf Pro server. For Intune it defaults to
+	// the Microsoft Graph API endpoint.
+	URL string `json:"url,omitempty"`
+	// TenantID is the Azure AD tenant. It is only used by Intune.
+	TenantID string `json:"tenantID,omitempty"`
+	// ClientID and ClientSecret are the credentials of the API client.
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+}
+
+// Validate validates the MDM configuration.
+func (c *Config) Validate() error {
+	switch {
+	case c == nil:
+		return errors.New("mdm config cannot be nil")
+	case c.ClientID == "":
+		return errors.New("mdm clientID cannot be empty")
+	case c.ClientSecret == "":
+		return errors.New("mdm clientSecret cannot be empty")
+	}
+
+	switch Type(strings.ToLower(string(c.Type))) {
+	case Jamf:
+		if c.URL == "" {
+			return errors.New("mdm url cannot be empty")
+		}
+	case Intune:
+		if c.TenantID == "" {
+			return errors.New("mdm tenantID cannot be empty")
+		}
+	default:
+		return fmt.Errorf("mdm type %q is not supported", c.Type)
+	}
+	return nil
+}
+
+// New creates a new MDM lookup provider using the given configuration.
+func New(c *Config) (Provider, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	switch Type(strings.ToLower(string(c.Type))) {
+	case Jamf:
+		return newJamf(c, ""), nil
+	default:
+		return newIntune(c, ""), nil
+	}
+}
+
+var defaultTimeout = 15 * time.Second
+
+// doJSON executes the request and returns an error if the status code is not
+// a 2xx.
+func doJSON(client *http.Client, req *http.Request) (*http.Response, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error doing %s %s", req.Method, req.URL.Path)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, errors.Errorf("error doing %s %s: status code %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return resp, nil
+}
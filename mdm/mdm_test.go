@@ -0,0 +1,38 @@
+package mdm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		want    Provider
+		wantErr string
+	}{
+		{"ok jamf", &Config{Type: "jamf", URL: "https://jamf.example.com", ClientID: "id", ClientSecret: "secret"}, &jamf{}, ""},
+		{"ok jamf uppercase", &Config{Type: "JAMF", URL: "https://jamf.example.com", ClientID: "id", ClientSecret: "secret"}, &jamf{}, ""},
+		{"ok intune", &Config{Type: "intune", TenantID: "tenant", ClientID: "id", ClientSecret: "secret"}, &intune{}, ""},
+		{"fail nil", nil, nil, "mdm config cannot be nil"},
+		{"fail clientID", &Config{Type: "jamf", URL: "https://jamf.example.com", ClientSecret: "secret"}, nil, "mdm clientID cannot be empty"},
+		{"fail clientSecret", &Config{Type: "jamf", URL: "https://jamf.example.com", ClientID: "id"}, nil, "mdm clientSecret cannot be empty"},
+		{"fail jamf url", &Config{Type: "jamf", ClientID: "id", ClientSecret: "secret"}, nil, "mdm url cannot be empty"},
+		{"fail intune tenant", &Config{Type: "intune", ClientID: "id", ClientSecret: "secret"}, nil, "mdm tenantID cannot be empty"},
+		{"fail type", &Config{Type: "kandji", ClientID: "id", ClientSecret: "secret"}, nil, `mdm type "kandji" is not supported`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.config)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			assert.IsType(t, tt.want, got)
+		})
+	}
+}
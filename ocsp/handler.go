@@ -0,0 +1,116 @@
+package ocsp
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	requestContentType  = "application/ocsp-request"
+	responseContentType = "application/ocsp-response"
+
+	// maxRequestSize is the maximum size of the OCSP requests sent using
+	// POST. Requests for a single certificate are much smaller.
+	maxRequestSize = 16 * 1024
+)
+
+// Handler is the HTTP handler for the OCSP responder. It supports the GET and
+// POST requests defined in appendix A of RFC 6960.
+type Handler struct {
+	responder *Responder
+}
+
+// NewHandler returns a new HTTP handler for the given responder.
+func NewHandler(responder *Responder) *Handler {
+	return &Handler{responder: responder}
+}
+
+// Route sets up the OCSP endpoints in the given router.
+func (h *Handler) Route(r chi.Router) {
+	r.Post("/", h.Post)
+	r.Get("/*", h.Get)
+}
+
+// Get answers an OCSP request sent as the base64 encoded path of the URL.
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	param := strings.TrimPrefix(chi.URLParam(r, "*"), "/")
+	req, err := url.PathUnescape(param)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %v", ErrMalformedRequest, err))
+		return
+	}
+	der, err := base64.StdEncoding.DecodeString(req)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: error decoding request: %v", ErrMalformedRequest, err))
+		return
+	}
+	h.respond(w, der, true)
+}
+
+// Post answers an OCSP request sent in the body of the request.
+func (h *Handler) Post(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "" && ct != requestContentType {
+		writeError(w, fmt.Errorf("%w: unexpected content type %q", ErrMalformedRequest, ct))
+		return
+	}
+	der, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil {
+		writeError(w, fmt.Errorf("error reading request: %w", err))
+		return
+	}
+	if len(der) > maxRequestSize {
+		writeError(w, fmt.Errorf("%w: request is too large", ErrMalformedRequest))
+		return
+	}
+	h.respond(w, der, false)
+}
+
+func (h *Handler) respond(w http.ResponseWriter, der []byte, cacheable bool) {
+	resp, err := h.responder.Respond(der)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", responseContentType)
+	// Responses to GET requests without a nonce can be cached by the HTTP
+	// caches as described in section 6 of RFC 5019.
+	if cacheable && resp.nonce == nil {
+		maxAge := time.Until(resp.NextUpdate) / time.Second
+		if maxAge < 0 {
+			maxAge = 0
+		}
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatInt(int64(maxAge), 10)+", public, no-transform, must-revalidate")
+		w.Header().Set("Last-Modified", resp.ThisUpdate.Format(http.TimeFormat))
+		w.Header().Set("Expires", resp.NextUpdate.Format(http.TimeFormat))
+	}
+	w.Write(resp.DER)
+}
+
+// writeError writes the unsigned OCSP error response for the given error.
+// OCSP clients expect OCSP responses, so the HTTP status is always 200.
+func writeError(w http.ResponseWriter, err error) {
+	var der []byte
+	switch {
+	case errors.Is(err, ErrMalformedRequest):
+		der = ocsp.MalformedRequestErrorResponse
+	case errors.Is(err, ErrUnauthorized):
+		der = ocsp.UnauthorizedErrorResponse
+	default:
+		log.Printf("ocsp: %v", err)
+		der = ocsp.InternalErrorErrorResponse
+	}
+	w.Header().Set("Content-Type", responseContentType)
+	w.Write(der)
+}
@@ -0,0 +1,78 @@
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestHandler(t *testing.T) {
+	p := newTestPKI(t)
+	other := newTestPKI(t)
+	r, _ := p.newResponder(t)
+
+	mux := chi.NewRouter()
+	mux.Route("/ocsp", NewHandler(r).Route)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	req := createRequest(t, p.leaf, p.ca.Intermediate, crypto.SHA1)
+	encoded := base64.StdEncoding.EncodeToString(req)
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		body      []byte
+		wantErr   error
+		wantCache bool
+	}{
+		{"get", http.MethodGet, "/ocsp/" + url.PathEscape(encoded), nil, nil, true},
+		{"get/unescaped", http.MethodGet, "/ocsp/" + encoded, nil, nil, true},
+		{"post", http.MethodPost, "/ocsp", req, nil, false},
+		{"get/nonce", http.MethodGet, "/ocsp/" + url.PathEscape(base64.StdEncoding.EncodeToString(createRequestWithNonce(t, p.leaf, p.ca.Intermediate, []byte("nonce")))), nil, nil, false},
+		{"fail/get/base64", http.MethodGet, "/ocsp/foo!", nil, ocsp.ResponseError{Status: ocsp.Malformed}, false},
+		{"fail/post/malformed", http.MethodPost, "/ocsp", []byte("foo"), ocsp.ResponseError{Status: ocsp.Malformed}, false},
+		{"fail/post/unauthorized", http.MethodPost, "/ocsp", createRequest(t, other.leaf, other.ca.Intermediate, crypto.SHA1), ocsp.ResponseError{Status: ocsp.Unauthorized}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpReq, err := http.NewRequest(tt.method, srv.URL+tt.path, bytes.NewReader(tt.body))
+			require.NoError(t, err)
+			if tt.method == http.MethodPost {
+				httpReq.Header.Set("Content-Type", requestContentType)
+			}
+			res, err := http.DefaultClient.Do(httpReq)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			b, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, responseContentType, res.Header.Get("Content-Type"))
+			got, err := ocsp.ParseResponseForCert(b, p.leaf, p.ca.Intermediate)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, ocsp.Good, got.Status)
+			if tt.wantCache {
+				assert.Contains(t, res.Header.Get("Cache-Control"), "public")
+				assert.NotEmpty(t, res.Header.Get("Expires"))
+			} else {
+				assert.Empty(t, res.Header.Get("Cache-Control"))
+			}
+		})
+	}
+}
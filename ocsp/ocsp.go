@@ -0,0 +1,330 @@
+// Package ocsp implements an OCSP responder, as defined in RFC 6960, for the
+// X.509 certificates issued by the authority. The responses are signed by a
+// dedicated OCSP responder certificate issued by the CA.
+package ocsp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// DefaultValidity is the time between the thisUpdate and nextUpdate fields of
+// the responses if none is configured.
+const DefaultValidity = time.Hour
+
+// The certificate statuses, as defined in the package golang.org/x/crypto/ocsp.
+const (
+	Good    = ocsp.Good
+	Revoked = ocsp.Revoked
+	Unknown = ocsp.Unknown
+)
+
+// ErrMalformedRequest is the error returned when the OCSP request cannot be
+// parsed or is not supported.
+var ErrMalformedRequest = errors.New("malformed OCSP request")
+
+// ErrUnauthorized is the error returned when the OCSP request is for a
+// certificate not issued by the CA.
+var ErrUnauthorized = errors.New("unauthorized OCSP request")
+
+// CertificateStatus is the revocation status of a certificate. The status is
+// one of Good, Revoked or Unknown.
+type CertificateStatus struct {
+	Status           int
+	RevokedAt        time.Time
+	RevocationReason int
+}
+
+// Authority is the interface used by the responder to get the status of the
+// certificates issued by the CA.
+type Authority interface {
+	GetCertificateStatus(serialNumber string) (*CertificateStatus, error)
+}
+
+// Options are the options used to create a Responder.
+type Options struct {
+	// Issuer is the CA certificate that issued the certificates.
+	Issuer *x509.Certificate
+	// ResponderCert is the certificate used to sign the responses. It must
+	// be issued by the Issuer and include the OCSPSigning extended key usage.
+	ResponderCert *x509.Certificate
+	// Signer is the key of the ResponderCert.
+	Signer crypto.Signer
+	// Validity is the time between the thisUpdate and nextUpdate fields of
+	// the responses. The responses are cached for half of this time.
+	Validity time.Duration
+}
+
+// Response is a signed OCSP response, and the validity of the certificate
+// status in it.
+type Response struct {
+	DER        []byte
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	nonce      []byte
+}
+
+// Responder creates the signed OCSP responses for the certificates issued by
+// the CA.
+type Responder struct {
+	auth               Authority
+	issuer             *x509.Certificate
+	responderCert      *x509.Certificate
+	signer             crypto.Signer
+	validity           time.Duration
+	signatureAlgorithm pkix.AlgorithmIdentifier
+	signatureHash      crypto.Hash
+	issuerKey          []byte
+
+	mu    sync.Mutex
+	cache map[string]map[crypto.Hash]*Response
+	now   func() time.Time
+}
+
+// New creates a new OCSP responder that gets the status of the certificates
+// from the given authority.
+func New(auth Authority, opts Options) (*Responder, error) {
+	switch {
+	case auth == nil:
+		return nil, errors.New("ocsp: authority cannot be nil")
+	case opts.Issuer == nil:
+		return nil, errors.New("ocsp: issuer certificate cannot be nil")
+	case opts.ResponderCert == nil:
+		return nil, errors.New("ocsp: responder certificate cannot be nil")
+	case opts.Signer == nil:
+		return nil, errors.New("ocsp: signer cannot be nil")
+	}
+
+	if err := opts.ResponderCert.CheckSignatureFrom(opts.Issuer); err != nil {
+		return nil, fmt.Errorf("ocsp: responder certificate is not issued by the CA: %w", err)
+	}
+	if now := time.Now(); now.Before(opts.ResponderCert.NotBefore) || now.After(opts.ResponderCert.NotAfter) {
+		return nil, fmt.Errorf("ocsp: responder certificate is not valid between %s and %s",
+			opts.ResponderCert.NotBefore.Format(time.RFC3339), opts.ResponderCert.NotAfter.Format(time.RFC3339))
+	}
+	if !hasExtKeyUsage(opts.ResponderCert, x509.ExtKeyUsageOCSPSigning) {
+		return nil, errors.New("ocsp: responder certificate does not have the OCSPSigning extended key usage")
+	}
+	if pub, ok := opts.Signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(opts.ResponderCert.PublicKey) {
+		return nil, errors.New("ocsp: signer does not match the responder certificate")
+	}
+
+	sigAlg, sigHash, err := signatureAlgorithm(opts.Signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("ocsp: %w", err)
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(opts.Issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, fmt.Errorf("ocsp: error parsing issuer public key: %w", err)
+	}
+
+	validity := opts.Validity
+	if validity <= 0 {
+		validity = DefaultValidity
+	}
+
+	return &Responder{
+		auth:               auth,
+		issuer:             opts.Issuer,
+		responderCert:      opts.ResponderCert,
+		signer:             opts.Signer,
+		validity:           validity,
+		signatureAlgorithm: sigAlg,
+		signatureHash:      sigHash,
+		issuerKey:          spki.PublicKey.RightAlign(),
+		cache:              make(map[string]map[crypto.Hash]*Response),
+		now:                time.Now,
+	}, nil
+}
+
+// Respond parses the given DER encoded OCSP request and returns the signed
+// response for it. It returns an error wrapping ErrMalformedRequest if the
+// request is not valid, and ErrUnauthorized if it is for a certificate not
+// issued by the CA. Responses to requests without a nonce are cached.
+func (r *Responder) Respond(der []byte) (*Response, error) {
+	id, nonce, err := parseRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedRequest, err)
+	}
+	hash := hashFromOID(id.HashAlgorithm.Algorithm)
+	if hash == 0 || !hash.Available() {
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %s", ErrMalformedRequest, id.HashAlgorithm.Algorithm)
+	}
+	if !r.isIssuer(hash, id) {
+		return nil, ErrUnauthorized
+	}
+
+	now := r.now().UTC().Truncate(time.Second)
+	if now.After(r.responderCert.NotAfter) {
+		return nil, errors.New("ocsp: responder certificate has expired")
+	}
+	serialNumber := id.SerialNumber.String()
+	if nonce == nil {
+		if resp := r.cached(serialNumber, hash, now); resp != nil {
+			return resp, nil
+		}
+	}
+
+	status, err := r.auth.GetCertificateStatus(serialNumber)
+	if err != nil {
+		return nil, fmt.Errorf("error getting status of certificate %s: %w", serialNumber, err)
+	}
+
+	resp, err := r.createResponse(id, status, nonce, now)
+	if err != nil {
+		return nil, err
+	}
+	if nonce == nil && status.Status != Unknown {
+		r.store(serialNumber, hash, resp)
+	}
+	return resp, nil
+}
+
+// Invalidate removes the cached responses for the certificate with the given
+// serial number. It must be called when a certificate is revoked.
+func (r *Responder) Invalidate(serialNumber string) {
+	r.mu.Lock()
+	delete(r.cache, serialNumber)
+	r.mu.Unlock()
+}
+
+// isIssuer returns whether the issuer in the certificate id is the CA.
+func (r *Responder) isIssuer(hash crypto.Hash, id *certID) bool {
+	h := hash.New()
+	h.Write(r.issuer.RawSubject)
+	if !bytes.Equal(h.Sum(nil), id.NameHash) {
+		return false
+	}
+	h.Reset()
+	h.Write(r.issuerKey)
+	return bytes.Equal(h.Sum(nil), id.IssuerKeyHash)
+}
+
+// cached returns the cached response for the given serial number and hash if
+// less than half of its validity has passed.
+func (r *Responder) cached(serialNumber string, hash crypto.Hash, now time.Time) *Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resp, ok := r.cache[serialNumber][hash]
+	if !ok {
+		return nil
+	}
+	if now.Before(resp.ThisUpdate.Add(r.validity / 2)) {
+		return resp
+	}
+	delete(r.cache[serialNumber], hash)
+	return nil
+}
+
+func (r *Responder) store(serialNumber string, hash crypto.Hash, resp *Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache[serialNumber] == nil {
+		r.cache[serialNumber] = make(map[crypto.Hash]*Response)
+	}
+	r.cache[serialNumber][hash] = resp
+}
+
+// createResponse creates and signs the response for the given certificate id
+// and status. If the request contains a nonce, it's added to the response.
+func (r *Responder) createResponse(id *certID, status *CertificateStatus, nonce []byte, now time.Time) (*Response, error) {
+	single := singleResponse{
+		CertID:     *id,
+		ThisUpdate: now,
+		NextUpdate: now.Add(r.validity),
+	}
+	// Responses cannot be valid after the responder certificate.
+	if single.NextUpdate.After(r.responderCert.NotAfter) {
+		single.NextUpdate = r.responderCert.NotAfter.UTC().Truncate(time.Second)
+	}
+	switch status.Status {
+	case Good:
+		single.Good = true
+	case Revoked:
+		single.Revoked = revokedInfo{
+			RevocationTime: status.RevokedAt.UTC(),
+			Reason:         asn1.Enumerated(status.RevocationReason),
+		}
+	default:
+		single.Unknown = true
+	}
+
+	tbs := responseData{
+		RawResponderID: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        1, // byName
+			IsCompound: true,
+			Bytes:      r.responderCert.RawSubject,
+		},
+		ProducedAt: now,
+		Responses:  []singleResponse{single},
+	}
+	if nonce != nil {
+		tbs.ResponseExtensions = []pkix.Extension{{Id: oidOCSPNonce, Value: nonce}}
+	}
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling OCSP response: %w", err)
+	}
+
+	digest := tbsDER
+	if r.signatureHash != 0 {
+		h := r.signatureHash.New()
+		h.Write(tbsDER)
+		digest = h.Sum(nil)
+	}
+	signature, err := r.signer.Sign(rand.Reader, digest, r.signatureHash)
+	if err != nil {
+		return nil, fmt.Errorf("error signing OCSP response: %w", err)
+	}
+
+	basic, err := asn1.Marshal(basicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbsDER},
+		SignatureAlgorithm: r.signatureAlgorithm,
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+		Certificates:       []asn1.RawValue{{FullBytes: r.responderCert.Raw}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling OCSP response: %w", err)
+	}
+	der, err := asn1.Marshal(responseASN1{
+		Status: asn1.Enumerated(ocsp.Success),
+		Response: responseBytes{
+			ResponseType: oidOCSPBasic,
+			Response:     basic,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling OCSP response: %w", err)
+	}
+
+	return &Response{
+		DER:        der,
+		ThisUpdate: single.ThisUpdate,
+		NextUpdate: single.NextUpdate,
+		nonce:      nonce,
+	}, nil
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package ocsp
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+	"golang.org/x/crypto/ocsp"
+)
+
+type mockAuthority struct {
+	statuses map[string]*CertificateStatus
+	calls    int
+	err      error
+}
+
+func (m *mockAuthority) GetCertificateStatus(serialNumber string) (*CertificateStatus, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	if s, ok := m.statuses[serialNumber]; ok {
+		return s, nil
+	}
+	return &CertificateStatus{Status: ocsp.Unknown}, nil
+}
+
+type testPKI struct {
+	ca            *minica.CA
+	responderCert *x509.Certificate
+	signer        crypto.Signer
+	leaf          *x509.Certificate
+	revoked       *x509.Certificate
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	ca, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+	require.NoError(t, err)
+	responderCert, err := ca.Sign(&x509.Certificate{
+		PublicKey:   signer.Public(),
+		Subject:     pkix.Name{CommonName: "OCSP Responder"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	})
+	require.NoError(t, err)
+	sign := func(cn string) *x509.Certificate {
+		key, err := keyutil.GenerateSigner("EC", "P-256", 0)
+		require.NoError(t, err)
+		cert, err := ca.Sign(&x509.Certificate{
+			PublicKey: key.Public(),
+			Subject:   pkix.Name{CommonName: cn},
+		})
+		require.NoError(t, err)
+		return cert
+	}
+	return &testPKI{
+		ca:            ca,
+		responderCert: responderCert,
+		signer:        signer,
+		leaf:          sign("leaf"),
+		revoked:       sign("revoked"),
+	}
+}
+
+func (p *testPKI) newResponder(t *testing.T) (*Responder, *mockAuthority) {
+	t.Helper()
+	auth := &mockAuthority{statuses: map[string]*CertificateStatus{
+		p.leaf.SerialNumber.String(): {Status: ocsp.Good},
+		p.revoked.SerialNumber.String(): {
+			Status:           ocsp.Revoked,
+			RevokedAt:        time.Now().Add(-time.Hour).Truncate(time.Second),
+			RevocationReason: ocsp.KeyCompromise,
+		},
+	}}
+	r, err := New(auth, Options{
+		Issuer:        p.ca.Intermediate,
+		ResponderCert: p.responderCert,
+		Signer:        p.signer,
+	})
+	require.NoError(t, err)
+	return r, auth
+}
+
+func createRequest(t *testing.T, cert, issuer *x509.Certificate, hash crypto.Hash) []byte {
+	t.Helper()
+	b, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: hash})
+	require.NoError(t, err)
+	return b
+}
+
+func createRequestWithNonce(t *testing.T, cert, issuer *x509.Certificate, nonce []byte) []byte {
+	t.Helper()
+	b, err := ocsp.CreateRequest(cert, issuer, nil)
+	require.NoError(t, err)
+	var req ocspRequest
+	_, err = asn1.Unmarshal(b, &req)
+	require.NoError(t, err)
+	value, err := asn1.Marshal(nonce)
+	require.NoError(t, err)
+	req.TBSRequest.RequestExtensions = []pkix.Extension{{Id: oidOCSPNonce, Value: value}}
+	b, err = asn1.Marshal(req)
+	require.NoError(t, err)
+	return b
+}
+
+func responseNonce(t *testing.T, der []byte) []byte {
+	t.Helper()
+	var resp responseASN1
+	_, err := asn1.Unmarshal(der, &resp)
+	require.NoError(t, err)
+	var basic basicResponse
+	_, err = asn1.Unmarshal(resp.Response.Response, &basic)
+	require.NoError(t, err)
+	var tbs responseData
+	_, err = asn1.Unmarshal(basic.TBSResponseData.FullBytes, &tbs)
+	require.NoError(t, err)
+	for _, ext := range tbs.ResponseExtensions {
+		if ext.Id.Equal(oidOCSPNonce) {
+			var nonce []byte
+			_, err := asn1.Unmarshal(ext.Value, &nonce)
+			require.NoError(t, err)
+			return nonce
+		}
+	}
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	p := newTestPKI(t)
+	other := newTestPKI(t)
+	auth := &mockAuthority{}
+
+	leafKey, err := keyutil.GenerateSigner("EC", "P-256", 0)
+	require.NoError(t, err)
+	noEKU, err := p.ca.Sign(&x509.Certificate{
+		PublicKey: leafKey.Public(),
+		Subject:   pkix.Name{CommonName: "No EKU"},
+	})
+	require.NoError(t, err)
+	withValidity := func(notBefore, notAfter time.Time) *x509.Certificate {
+		cert, err := p.ca.Sign(&x509.Certificate{
+			PublicKey:   p.signer.Public(),
+			Subject:     pkix.Name{CommonName: "OCSP Responder"},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+			NotBefore:   notBefore,
+			NotAfter:    notAfter,
+		})
+		require.NoError(t, err)
+		return cert
+	}
+	now := time.Now()
+	expired := withValidity(now.Add(-2*time.Hour), now.Add(-time.Hour))
+	notYetValid := withValidity(now.Add(time.Hour), now.Add(2*time.Hour))
+
+	tests := []struct {
+		name   string
+		auth   Authority
+		opts   Options
+		errMsg string
+	}{
+		{"ok", auth, Options{Issuer: p.ca.Intermediate, ResponderCert: p.responderCert, Signer: p.signer}, ""},
+		{"fail/authority", nil, Options{Issuer: p.ca.Intermediate, ResponderCert: p.responderCert, Signer: p.signer}, "ocsp: authority cannot be nil"},
+		{"fail/issuer", auth, Options{ResponderCert: p.responderCert, Signer: p.signer}, "ocsp: issuer certificate cannot be nil"},
+		{"fail/responderCert", auth, Options{Issuer: p.ca.Intermediate, Signer: p.signer}, "ocsp: responder certificate cannot be nil"},
+		{"fail/signer", auth, Options{Issuer: p.ca.Intermediate, ResponderCert: p.responderCert}, "ocsp: signer cannot be nil"},
+		{"fail/other-issuer", auth, Options{Issuer: other.ca.Intermediate, ResponderCert: p.responderCert, Signer: p.signer}, "ocsp: responder certificate is not issued by the CA"},
+		{"fail/eku", auth, Options{Issuer: p.ca.Intermediate, ResponderCert: noEKU, Signer: leafKey}, "ocsp: responder certificate does not have the OCSPSigning extended key usage"},
+		{"fail/key", auth, Options{Issuer: p.ca.Intermediate, ResponderCert: p.responderCert, Signer: leafKey}, "ocsp: signer does not match the responder certificate"},
+		{"fail/expired", auth, Options{Issuer: p.ca.Intermediate, ResponderCert: expired, Signer: p.signer}, "ocsp: responder certificate is not valid"},
+		{"fail/not-yet-valid", auth, Options{Issuer: p.ca.Intermediate, ResponderCert: notYetValid, Signer: p.signer}, "ocsp: responder certificate is not valid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.auth, tt.opts)
+			if tt.errMsg != "" {
+				assert.ErrorContains(t, err, tt.errMsg)
+				assert.Nil(t, got)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, DefaultValidity, got.validity)
+		})
+	}
+}
+
+func TestResponder_Respond(t *testing.T) {
+	p := newTestPKI(t)
+	other := newTestPKI(t)
+	r, _ := p.newResponder(t)
+
+	tests := []struct {
+		name       string
+		cert       *x509.Certificate
+		issuer     *x509.Certificate
+		hash       crypto.Hash
+		wantStatus int
+	}{
+		{"good", p.leaf, p.ca.Intermediate, crypto.SHA1, ocsp.Good},
+		{"good/sha256", p.leaf, p.ca.Intermediate, crypto.SHA256, ocsp.Good},
+		{"revoked", p.revoked, p.ca.Intermediate, crypto.SHA1, ocsp.Revoked},
+		{"unknown", p.responderCert, p.ca.Intermediate, crypto.SHA1, ocsp.Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := r.Respond(createRequest(t, tt.cert, tt.issuer, tt.hash))
+			require.NoError(t, err)
+			got, err := ocsp.ParseResponseForCert(resp.DER, tt.cert, tt.issuer)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, got.Status)
+			assert.Equal(t, tt.cert.SerialNumber, got.SerialNumber)
+			assert.Equal(t, tt.hash, got.IssuerHash)
+			assert.Equal(t, p.responderCert, got.Certificate)
+			assert.Equal(t, resp.ThisUpdate, got.ThisUpdate)
+			assert.Equal(t, resp.NextUpdate, got.NextUpdate)
+			assert.Equal(t, DefaultValidity, got.NextUpdate.Sub(got.ThisUpdate))
+			if tt.wantStatus == ocsp.Revoked {
+				assert.Equal(t, ocsp.KeyCompromise, got.RevocationReason)
+				assert.False(t, got.RevokedAt.IsZero())
+			}
+		})
+	}
+
+	t.Run("fail/unauthorized", func(t *testing.T) {
+		_, err := r.Respond(createRequest(t, other.leaf, other.ca.Intermediate, crypto.SHA1))
+		assert.ErrorIs(t, err, ErrUnauthorized)
+	})
+
+	t.Run("fail/malformed", func(t *testing.T) {
+		_, err := r.Respond([]byte("foo"))
+		assert.ErrorIs(t, err, ErrMalformedRequest)
+		_, err = r.Respond(createRequestWithNonce(t, p.leaf, p.ca.Intermediate, make([]byte, 64)))
+		assert.ErrorIs(t, err, ErrMalformedRequest)
+	})
+
+	t.Run("fail/authority", func(t *testing.T) {
+		r, auth := p.newResponder(t)
+		auth.err = errors.New("database is down")
+		_, err := r.Respond(createRequest(t, p.leaf, p.ca.Intermediate, crypto.SHA1))
+		assert.EqualError(t, err, "error getting status of certificate "+p.leaf.SerialNumber.String()+": database is down")
+	})
+}
+
+func TestResponder_Respond_nonce(t *testing.T) {
+	p := newTestPKI(t)
+	r, auth := p.newResponder(t)
+
+	nonce := []byte("0123456789abcdef")
+	req := createRequestWithNonce(t, p.leaf, p.ca.Intermediate, nonce)
+	resp, err := r.Respond(req)
+	require.NoError(t, err)
+	got, err := ocsp.ParseResponseForCert(resp.DER, p.leaf, p.ca.Intermediate)
+	require.NoError(t, err)
+	assert.Equal(t, ocsp.Good, got.Status)
+	assert.Equal(t, nonce, responseNonce(t, resp.DER))
+
+	// Responses with a nonce are never cached.
+	_, err = r.Respond(req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, auth.calls)
+
+	resp, err = r.Respond(createRequest(t, p.leaf, p.ca.Intermediate, crypto.SHA1))
+	require.NoError(t, err)
+	assert.Nil(t, responseNonce(t, resp.DER))
+}
+
+func TestResponder_Respond_cache(t *testing.T) {
+	p := newTestPKI(t)
+	r, auth := p.newResponder(t)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	req := createRequest(t, p.leaf, p.ca.Intermediate, crypto.SHA1)
+	first, err := r.Respond(req)
+	require.NoError(t, err)
+	second, err := r.Respond(req)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Equal(t, 1, auth.calls)
+
+	// Responses are cached per hash algorithm.
+	_, err = r.Respond(createRequest(t, p.leaf, p.ca.Intermediate, crypto.SHA256))
+	require.NoError(t, err)
+	assert.Equal(t, 2, auth.calls)
+
+	// Unknown certificates are not cached.
+	unknown := createRequest(t, p.responderCert, p.ca.Intermediate, crypto.SHA1)
+	_, err = r.Respond(unknown)
+	require.NoError(t, err)
+	_, err = r.Respond(unknown)
+	require.NoError(t, err)
+	assert.Equal(t, 4, auth.calls)
+
+	// Responses are refreshed after half of the validity.
+	now = now.Add(DefaultValidity/2 + time.Second)
+	third, err := r.Respond(req)
+	require.NoError(t, err)
+	assert.NotSame(t, first, third)
+	assert.Equal(t, 5, auth.calls)
+
+	// Revoking a certificate invalidates the cache.
+	auth.statuses[p.leaf.SerialNumber.String()] = &CertificateStatus{Status: ocsp.Revoked, RevokedAt: now}
+	r.Invalidate(p.leaf.SerialNumber.String())
+	resp, err := r.Respond(req)
+	require.NoError(t, err)
+	got, err := ocsp.ParseResponseForCert(resp.DER, p.leaf, p.ca.Intermediate)
+	require.NoError(t, err)
+	assert.Equal(t, ocsp.Revoked, got.Status)
+	assert.Equal(t, 6, auth.calls)
+}
+
+func TestResponder_Respond_responderExpiration(t *testing.T) {
+	p := newTestPKI(t)
+	r, _ := p.newResponder(t)
+	req := createRequest(t, p.leaf, p.ca.Intermediate, crypto.SHA1)
+
+	// Responses are not valid after the responder certificate.
+	now := p.responderCert.NotAfter.Add(-time.Minute)
+	r.now = func() time.Time { return now }
+	resp, err := r.Respond(req)
+	require.NoError(t, err)
+	assert.Equal(t, p.responderCert.NotAfter.UTC().Truncate(time.Second), resp.NextUpdate)
+
+	now = p.responderCert.NotAfter.Add(time.Minute)
+	_, err = r.Respond(req)
+	assert.EqualError(t, err, "ocsp: responder certificate has expired")
+}
@@ -88,7 +88,7 @@ func (e *NamePolicyError) Detail() string {
 // denied names before a CA creates and/or signs the Certificate.
 // TODO(hs): the X509 RFC also defines name checks on directory name; support that?
 // TODO(hs): implement Stringer interface: describe the contents of the NamePolicyEngine?
-// TODO(hs): implement matching URI schemes, paths, etc; not just the domain part of URI domains
+// TODO(hs): implement matching URI paths, etc; not just the scheme and domain part of URIs
 
 type NamePolicyEngine struct {
 	// verifySubjectCommonName is set when Subject Common Name must be verified
@@ -107,6 +107,8 @@ type NamePolicyEngine struct {
 	excludedEmailAddresses  []string
 	permittedURIDomains     []string
 	excludedURIDomains      []string
+	permittedURISchemes     []string
+	excludedURISchemes      []string
 	permittedPrincipals     []string
 	excludedPrincipals      []string
 
@@ -116,6 +118,7 @@ type NamePolicyEngine struct {
 	numberOfIPRangeConstraints        int
 	numberOfEmailAddressConstraints   int
 	numberOfURIDomainConstraints      int
+	numberOfURISchemeConstraints      int
 	numberOfPrincipalConstraints      int
 	totalNumberOfPermittedConstraints int
 	totalNumberOfExcludedConstraints  int
@@ -136,6 +139,7 @@ func New(opts ...NamePolicyOption) (*NamePolicyEngine, error) {
 	e.permittedIPRanges = removeDuplicateIPNets(e.permittedIPRanges)
 	e.permittedEmailAddresses = removeDuplicates(e.permittedEmailAddresses)
 	e.permittedURIDomains = removeDuplicates(e.permittedURIDomains)
+	e.permittedURISchemes = removeDuplicates(e.permittedURISchemes)
 	e.permittedPrincipals = removeDuplicates(e.permittedPrincipals)
 
 	e.excludedCommonNames = removeDuplicates(e.excludedCommonNames)
@@ -143,6 +147,7 @@ func New(opts ...NamePolicyOption) (*NamePolicyEngine, error) {
 	e.excludedIPRanges = removeDuplicateIPNets(e.excludedIPRanges)
 	e.excludedEmailAddresses = removeDuplicates(e.excludedEmailAddresses)
 	e.excludedURIDomains = removeDuplicates(e.excludedURIDomains)
+	e.excludedURISchemes = removeDuplicates(e.excludedURISchemes)
 	e.excludedPrincipals = removeDuplicates(e.excludedPrincipals)
 
 	e.numberOfCommonNameConstraints = len(e.permittedCommonNames) + len(e.excludedCommonNames)
@@ -150,15 +155,16 @@ func New(opts ...NamePolicyOption) (*NamePolicyEngine, error) {
 	e.numberOfIPRangeConstraints = len(e.permittedIPRanges) + len(e.excludedIPRanges)
 	e.numberOfEmailAddressConstraints = len(e.permittedEmailAddresses) + len(e.excludedEmailAddresses)
 	e.numberOfURIDomainConstraints = len(e.permittedURIDomains) + len(e.excludedURIDomains)
+	e.numberOfURISchemeConstraints = len(e.permittedURISchemes) + len(e.excludedURISchemes)
 	e.numberOfPrincipalConstraints = len(e.permittedPrincipals) + len(e.excludedPrincipals)
 
 	e.totalNumberOfPermittedConstraints = len(e.permittedCommonNames) + len(e.permittedDNSDomains) +
 		len(e.permittedIPRanges) + len(e.permittedEmailAddresses) + len(e.permittedURIDomains) +
-		len(e.permittedPrincipals)
+		len(e.permittedURISchemes) + len(e.permittedPrincipals)
 
 	e.totalNumberOfExcludedConstraints = len(e.excludedCommonNames) + len(e.excludedDNSDomains) +
 		len(e.excludedIPRanges) + len(e.excludedEmailAddresses) + len(e.excludedURIDomains) +
-		len(e.excludedPrincipals)
+		len(e.excludedURISchemes) + len(e.excludedPrincipals)
 
 	e.totalNumberOfConstraints = e.totalNumberOfPermittedConstraints + e.totalNumberOfExcludedConstraints
 
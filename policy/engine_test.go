@@ -979,6 +979,82 @@ func TestNamePolicyEngine_X509_AllAllowed(t *testing.T) {
 				Name:     "https://bad.local",
 			},
 		},
+		{
+			name: "fail/uri-permitted-scheme",
+			options: []NamePolicyOption{
+				WithPermittedURISchemes("spiffe"),
+			},
+			cert: &x509.Certificate{
+				URIs: []*url.URL{
+					{
+						Scheme: "https",
+						Host:   "example.local",
+					},
+				},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: URINameType,
+				Name:     "https://example.local",
+			},
+		},
+		{
+			name: "fail/uri-permitted-scheme-and-domain",
+			options: []NamePolicyOption{
+				WithPermittedURISchemes("spiffe"),
+				WithPermittedURIDomains("example.local"),
+			},
+			cert: &x509.Certificate{
+				URIs: []*url.URL{
+					{
+						Scheme: "spiffe",
+						Host:   "bad.local",
+					},
+				},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: URINameType,
+				Name:     "spiffe://bad.local",
+			},
+		},
+		{
+			name: "fail/uri-excluded-scheme",
+			options: []NamePolicyOption{
+				WithExcludedURISchemes("http"),
+			},
+			cert: &x509.Certificate{
+				URIs: []*url.URL{
+					{
+						Scheme: "HTTP",
+						Host:   "example.local",
+					},
+				},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: URINameType,
+				Name:     "HTTP://example.local",
+			},
+		},
+		{
+			name: "fail/uri-permitted-scheme-with-dns",
+			options: []NamePolicyOption{
+				WithPermittedURISchemes("spiffe"),
+			},
+			cert: &x509.Certificate{
+				DNSNames: []string{"example.local"},
+			},
+			want: false,
+			wantErr: &NamePolicyError{
+				Reason:   NotAllowed,
+				NameType: DNSNameType,
+				Name:     "example.local",
+			},
+		},
 		{
 			name: "fail/uri-permitted-with-literal-wildcard", // don't allow literal wildcard in URI, e.g. xxxx://*.domain.tld
 			options: []NamePolicyOption{
@@ -1977,6 +2053,57 @@ func TestNamePolicyEngine_X509_AllAllowed(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "ok/uri-permitted-scheme",
+			options: []NamePolicyOption{
+				WithPermittedURISchemes("spiffe", "urn"),
+			},
+			cert: &x509.Certificate{
+				URIs: []*url.URL{
+					{
+						Scheme: "spiffe",
+						Host:   "example.local",
+						Path:   "/workload",
+					},
+					{
+						Scheme: "urn",
+						Opaque: "uuid:f81d4fae-7dec-11d0-a765-00a0c91e6bf6",
+					},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "ok/uri-permitted-scheme-and-domain",
+			options: []NamePolicyOption{
+				WithPermittedURISchemes("spiffe"),
+				WithPermittedURIDomains("*.example.local"),
+			},
+			cert: &x509.Certificate{
+				URIs: []*url.URL{
+					{
+						Scheme: "spiffe",
+						Host:   "bu1.example.local",
+					},
+				},
+			},
+			want: true,
+		},
+		{
+			name: "ok/uri-excluded-scheme",
+			options: []NamePolicyOption{
+				WithExcludedURISchemes("http"),
+			},
+			cert: &x509.Certificate{
+				URIs: []*url.URL{
+					{
+						Scheme: "https",
+						Host:   "example.local",
+					},
+				},
+			},
+			want: true,
+		},
 		{
 			name: "ok/uri-permitted-with-port",
 			options: []NamePolicyOption{
@@ -226,6 +226,36 @@ func WithExcludedURIDomains(domains ...string) NamePolicyOption {
 	}
 }
 
+func WithPermittedURISchemes(schemes ...string) NamePolicyOption {
+	return func(e *NamePolicyEngine) error {
+		normalizedSchemes := make([]string, len(schemes))
+		for i, scheme := range schemes {
+			normalizedScheme, err := normalizeAndValidateURISchemeConstraint(scheme)
+			if err != nil {
+				return fmt.Errorf("cannot parse permitted URI scheme constraint %q: %w", scheme, err)
+			}
+			normalizedSchemes[i] = normalizedScheme
+		}
+		e.permittedURISchemes = normalizedSchemes
+		return nil
+	}
+}
+
+func WithExcludedURISchemes(schemes ...string) NamePolicyOption {
+	return func(e *NamePolicyEngine) error {
+		normalizedSchemes := make([]string, len(schemes))
+		for i, scheme := range schemes {
+			normalizedScheme, err := normalizeAndValidateURISchemeConstraint(scheme)
+			if err != nil {
+				return fmt.Errorf("cannot parse excluded URI scheme constraint %q: %w", scheme, err)
+			}
+			normalizedSchemes[i] = normalizedScheme
+		}
+		e.excludedURISchemes = normalizedSchemes
+		return nil
+	}
+}
+
 func WithPermittedPrincipals(principals ...string) NamePolicyOption {
 	return func(g *NamePolicyEngine) error {
 		g.permittedPrincipals = principals
@@ -342,6 +372,24 @@ func normalizeAndValidateEmailConstraint(constraint string) (string, error) {
 	return normalizedConstraint, nil
 }
 
+// normalizeAndValidateURISchemeConstraint validates a URI scheme constraint
+// using the syntax in RFC 3986, section 3.1. Schemes are case-insensitive.
+func normalizeAndValidateURISchemeConstraint(constraint string) (string, error) {
+	normalizedConstraint := strings.ToLower(strings.TrimSpace(constraint))
+	if normalizedConstraint == "" {
+		return "", fmt.Errorf("URI scheme constraint %q cannot be empty or white space string", constraint)
+	}
+	for i, c := range normalizedConstraint {
+		switch {
+		case 'a' <= c && c <= 'z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return "", fmt.Errorf("URI scheme constraint %q is not a valid scheme", constraint)
+		}
+	}
+	return normalizedConstraint, nil
+}
+
 func normalizeAndValidateURIDomainConstraint(constraint string) (string, error) {
 	normalizedConstraint := strings.ToLower(strings.TrimSpace(constraint))
 	if normalizedConstraint == "" {
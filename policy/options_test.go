@@ -777,3 +777,32 @@ func Test_normalizeAndValidateURIDomainConstraint(t *testing.T) {
 		})
 	}
 }
+
+func Test_normalizeAndValidateURISchemeConstraint(t *testing.T) {
+	tests := []struct {
+		name       string
+		constraint string
+		want       string
+		wantErr    bool
+	}{
+		{"fail/empty-constraint", "", "", true},
+		{"fail/white-space", "  ", "", true},
+		{"fail/starts-with-digit", "1http", "", true},
+		{"fail/with-separator", "https://", "", true},
+		{"fail/invalid-character", "ht_tp", "", true},
+		{"ok", "spiffe", "spiffe", false},
+		{"ok/uppercase", " HTTPS ", "https", false},
+		{"ok/special-characters", "coap+tcp", "coap+tcp", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeAndValidateURISchemeConstraint(tt.constraint)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("normalizeAndValidateURISchemeConstraint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeAndValidateURISchemeConstraint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
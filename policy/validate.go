@@ -140,7 +140,7 @@ func (e *NamePolicyEngine) validateNames(dnsNames []string, ips []net.IP, emailA
 	// TODO(hs): fix internationalization for URIs (IRIs)
 
 	for _, uri := range uris {
-		if e.numberOfURIDomainConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
+		if e.numberOfURIDomainConstraints == 0 && e.numberOfURISchemeConstraints == 0 && e.totalNumberOfPermittedConstraints > 0 {
 			return &NamePolicyError{
 				Reason:   NotAllowed,
 				NameType: URINameType,
@@ -148,6 +148,12 @@ func (e *NamePolicyEngine) validateNames(dnsNames []string, ips []net.IP, emailA
 				detail:   fmt.Sprintf("uri %q is not explicitly permitted by any constraint", uri.String()),
 			}
 		}
+		if err := checkNameConstraints(URINameType, uri.String(), uri,
+			func(parsedName, constraint interface{}) (bool, error) {
+				return matchURISchemeConstraint(parsedName.(*url.URL), constraint.(string))
+			}, e.permittedURISchemes, e.excludedURISchemes); err != nil {
+			return err
+		}
 		// TODO(hs): ideally we'd like the uri.String() to be the original contents; now
 		// it's transformed into ASCII. Prevent that here?
 		if err := checkNameConstraints(URINameType, uri.String(), uri,
@@ -626,6 +632,15 @@ func (e *NamePolicyEngine) matchURIConstraint(uri *url.URL, constraint string) (
 	return e.matchDomainConstraint(host, constraint)
 }
 
+// matchURISchemeConstraint performs a case-insensitive equality check of the
+// URI scheme against the constraint.
+func matchURISchemeConstraint(uri *url.URL, constraint string) (bool, error) {
+	if uri.Scheme == "" {
+		return false, fmt.Errorf("URI without scheme (%q) cannot be matched against constraints", uri.String())
+	}
+	return strings.EqualFold(uri.Scheme, constraint), nil
+}
+
 // matchPrincipalConstraint performs a string literal equality check against a constraint.
 func matchPrincipalConstraint(principal, constraint string) (bool, error) {
 	// allow any plain principal when wildcard constraint is used
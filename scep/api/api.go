@@ -18,15 +18,19 @@ import (
 
 	"github.com/smallstep/certificates/api"
 	"github.com/smallstep/certificates/api/log"
+	"github.com/smallstep/certificates/audit"
 	"github.com/smallstep/certificates/authority"
 	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/errs"
+	"github.com/smallstep/certificates/internal/metrix"
 	"github.com/smallstep/certificates/scep"
 )
 
 const (
-	opnGetCACert    = "GetCACert"
-	opnGetCACaps    = "GetCACaps"
-	opnPKIOperation = "PKIOperation"
+	opnGetCACert     = "GetCACert"
+	opnGetCACaps     = "GetCACaps"
+	opnGetNextCACert = "GetNextCACert"
+	opnPKIOperation  = "PKIOperation"
 
 	// TODO: add other (more optional) operations and handling
 )
@@ -97,7 +101,7 @@ func route(r api.Router, middleware func(next http.HandlerFunc) http.HandlerFunc
 func Get(w http.ResponseWriter, r *http.Request) {
 	req, err := decodeRequest(r)
 	if err != nil {
-		fail(w, fmt.Errorf("invalid scep get request: %w", err))
+		failWithStatus(w, http.StatusBadRequest, fmt.Errorf("invalid scep get request: %w", err))
 		return
 	}
 
@@ -109,11 +113,14 @@ func Get(w http.ResponseWriter, r *http.Request) {
 		res, err = GetCACert(ctx)
 	case opnGetCACaps:
 		res, err = GetCACaps(ctx)
+	case opnGetNextCACert:
+		res, err = GetNextCACert(ctx)
 	case opnPKIOperation:
 		res, err = PKIOperation(ctx, req)
 	default:
-		err = fmt.Errorf("unknown operation: %s", req.Operation)
+		err = errs.BadRequest("unknown operation: %s", req.Operation)
 	}
+	observeOperation(ctx, req.Operation, res, err)
 
 	if err != nil {
 		fail(w, fmt.Errorf("scep get request failed: %w", err))
@@ -127,17 +134,22 @@ func Get(w http.ResponseWriter, r *http.Request) {
 func Post(w http.ResponseWriter, r *http.Request) {
 	req, err := decodeRequest(r)
 	if err != nil {
-		fail(w, fmt.Errorf("invalid scep post request: %w", err))
+		failWithStatus(w, http.StatusBadRequest, fmt.Errorf("invalid scep post request: %w", err))
 		return
 	}
 
 	var res Response
 	switch req.Operation {
 	case opnPKIOperation:
+		if p, ok := scep.ProvisionerFromContext(r.Context()); ok && !p.AllowsPOSTPKIOperation() {
+			failWithStatus(w, http.StatusMethodNotAllowed, errors.New("scep post request failed: POST PKIOperation is not allowed"))
+			return
+		}
 		res, err = PKIOperation(r.Context(), req)
 	default:
-		err = fmt.Errorf("unknown operation: %s", req.Operation)
+		err = errs.BadRequest("unknown operation: %s", req.Operation)
 	}
+	observeOperation(r.Context(), req.Operation, res, err)
 
 	if err != nil {
 		fail(w, fmt.Errorf("scep post request failed: %w", err))
@@ -164,7 +176,7 @@ func decodeRequest(r *http.Request) (request, error) {
 	switch method {
 	case http.MethodGet:
 		switch operation {
-		case opnGetCACert, opnGetCACaps:
+		case opnGetCACert, opnGetCACaps, opnGetNextCACert:
 			return request{
 				Operation: operation,
 				Message:   []byte{},
@@ -268,13 +280,14 @@ func parseRawQueryWithoutUnescaping(m url.Values, query string) (err error) {
 }
 
 // lookupProvisioner loads the provisioner associated with the request.
-// Responds 404 if the provisioner does not exist.
+// Responds 404 if the provisioner does not exist or it is not a SCEP
+// provisioner.
 func lookupProvisioner(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		name := chi.URLParam(r, "provisionerName")
 		provisionerName, err := url.PathUnescape(name)
 		if err != nil {
-			fail(w, fmt.Errorf("error url unescaping provisioner name '%s'", name))
+			failWithStatus(w, http.StatusBadRequest, fmt.Errorf("error url unescaping provisioner name '%s'", name))
 			return
 		}
 
@@ -282,13 +295,13 @@ func lookupProvisioner(next http.HandlerFunc) http.HandlerFunc {
 		auth := authority.MustFromContext(ctx)
 		p, err := auth.LoadProvisionerByName(provisionerName)
 		if err != nil {
-			fail(w, err)
+			failWithStatus(w, http.StatusNotFound, fmt.Errorf("provisioner '%s' not found", provisionerName))
 			return
 		}
 
 		prov, ok := p.(*provisioner.SCEP)
 		if !ok {
-			fail(w, errors.New("provisioner must be of type SCEP"))
+			failWithStatus(w, http.StatusNotFound, fmt.Errorf("provisioner '%s' is not a SCEP provisioner", provisionerName))
 			return
 		}
 
@@ -343,13 +356,27 @@ func GetCACaps(ctx context.Context) (Response, error) {
 	return res, nil
 }
 
+// GetNextCACert returns the certificates of the next CA in a SCEP response
+func GetNextCACert(ctx context.Context) (Response, error) {
+	auth := scep.MustFromContext(ctx)
+	data, err := auth.GetNextCACert(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{
+		Operation: opnGetNextCACert,
+		Data:      data,
+	}, nil
+}
+
 // PKIOperation performs PKI operations and returns a SCEP response
 func PKIOperation(ctx context.Context, req request) (Response, error) {
 	// parse the message using microscep implementation
 	microMsg, err := microscep.ParsePKIMessage(req.Message)
 	if err != nil {
 		// return the error, because we can't use the msg for creating a CertRep
-		return Response{}, err
+		return Response{}, errs.BadRequestErr(err, "failed parsing SCEP message")
 	}
 
 	// this is essentially doing the same as microscep.ParsePKIMessage, but
@@ -357,7 +384,7 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 	// wrapper for the microscep implementation.
 	p7, err := pkcs7.Parse(microMsg.Raw)
 	if err != nil {
-		return Response{}, err
+		return Response{}, errs.BadRequestErr(err, "failed parsing SCEP message")
 	}
 
 	// copy over properties to our internal PKIMessage
@@ -369,45 +396,61 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 		P7:            p7,
 	}
 
+	// NOTE: at this point we have sufficient information for returning nicely signed CertReps
 	auth := scep.MustFromContext(ctx)
 	if err := auth.DecryptPKIEnvelope(ctx, msg); err != nil {
-		return Response{}, err
+		return createErrorResponse(ctx, nil, msg, err)
 	}
 
-	// NOTE: at this point we have sufficient information for returning nicely signed CertReps
 	csr := msg.CSRReqMessage.CSR
 	transactionID := string(msg.TransactionID)
 	challengePassword := msg.CSRReqMessage.ChallengePassword
 
-	// NOTE: we're blocking the RenewalReq if the challenge does not match, because otherwise we don't have any authentication.
-	// The macOS SCEP client performs renewals using PKCSreq. The CertNanny SCEP client will use PKCSreq with challenge too, it seems,
-	// even if using the renewal flow as described in the README.md. MicroMDM SCEP client also only does PKCSreq by default, unless
-	// a certificate exists; then it will use RenewalReq. Adding the challenge check here may be a small breaking change for clients.
-	// We'll have to see how it works out.
-	if msg.MessageType == microscep.PKCSReq || msg.MessageType == microscep.RenewalReq {
+	// SHA-1, DES and 3DES are only allowed for the devices explicitly allowed
+	// by the provisioner.
+	if err := auth.ValidateAlgorithms(ctx, msg); err != nil {
+		return createErrorResponse(ctx, csr, msg, err)
+	}
+
+	// NOTE: The macOS SCEP client performs renewals using PKCSreq. The CertNanny SCEP client will use PKCSreq with challenge too,
+	// it seems, even if using the renewal flow as described in the README.md. MicroMDM SCEP client also only does PKCSreq by
+	// default, unless a certificate exists; then it will use RenewalReq.
+	//
+	// A RenewalReq is authenticated with the existing certificate that signed the request. Renewals OPTIONALLY include the
+	// challenge, so if the certificate can't be used, the request is authenticated with the challenge like a PKCSReq.
+	validateChallenge := msg.MessageType == microscep.PKCSReq
+	if msg.MessageType == microscep.RenewalReq {
+		if p, ok := scep.ProvisionerFromContext(ctx); ok && !p.AllowsRenewal() {
+			return createFailureResponse(ctx, csr, msg, scep.BadRequest, errors.New("renewal requests are not allowed"))
+		}
+		if err := auth.ValidateRenewal(ctx, csr, msg); err != nil {
+			if challengePassword == "" {
+				return createErrorResponse(ctx, csr, msg, fmt.Errorf("failed validating renewal: %w", err))
+			}
+			validateChallenge = true
+		}
+	}
+	if validateChallenge {
 		if err := auth.ValidateChallenge(ctx, csr, challengePassword, transactionID); err != nil {
 			if errors.Is(err, provisioner.ErrSCEPChallengeInvalid) {
-				return createFailureResponse(ctx, csr, msg, microscep.BadRequest, err)
+				return createFailureResponse(ctx, csr, msg, scep.BadRequest, err)
 			}
-			return createFailureResponse(ctx, csr, msg, microscep.BadRequest, errors.New("failed validating challenge password"))
+			return createFailureResponse(ctx, csr, msg, scep.BadRequest, errors.New("failed validating challenge password"))
 		}
 	}
 
-	// TODO: authorize renewal: we can authorize renewals with the challenge password (if reusable secrets are used).
-	// Renewals OPTIONALLY include the challenge if the existing cert is used as authentication, but client SHOULD omit the challenge.
-	// This means that for renewal requests we should check the certificate provided to be signed before by the CA. We could
-	// enforce use of the challenge if we want too. That way we could be more flexible in terms of authentication scheme (i.e. reusing
-	// tokens from other provisioners, calling a webhook, storing multiple secrets, allowing them to be multi-use, etc).
-	// Authentication by the (self-signed) certificate with an optional challenge is required; supporting renewals incl. verification
-	// of the client cert is not.
-
 	certRep, err := auth.SignCSR(ctx, csr, msg)
 	if err != nil {
 		if notifyErr := auth.NotifyFailure(ctx, csr, transactionID, 0, err.Error()); notifyErr != nil {
 			// TODO(hs): ignore this error case? It's not critical if the notification fails; but logging it might be good
 			_ = notifyErr
 		}
-		return createFailureResponse(ctx, csr, msg, microscep.BadRequest, fmt.Errorf("error when signing new certificate: %w", err))
+		return createFailureResponse(ctx, csr, msg, scep.BadRequest, fmt.Errorf("error when signing new certificate: %w", err))
+	}
+
+	// Write the enrollment in the audit log before responding.
+	if err := auditEnrollment(ctx, certRep.Certificate, msg); err != nil {
+		return createFailureResponse(ctx, csr, msg, scep.BadRequest, fmt.Errorf("error writing audit log: %w", err))
 	}
 
 	if notifyErr := auth.NotifySuccess(ctx, csr, certRep.Certificate, transactionID); notifyErr != nil {
@@ -424,6 +467,43 @@ func PKIOperation(ctx context.Context, req request) (Response, error) {
 	return res, nil
 }
 
+// auditEnrollment writes the successful enrollment of the given certificate in
+// the audit log.
+func auditEnrollment(ctx context.Context, cert *x509.Certificate, msg *scep.PKIMessage) error {
+	ev := &audit.Event{
+		Type:         audit.SCEPEnroll,
+		SerialNumber: cert.SerialNumber.String(),
+		Subject:      cert.Subject.CommonName,
+		Details: map[string]string{
+			"transactionID": string(msg.TransactionID),
+			"messageType":   msg.MessageType.String(),
+		},
+	}
+	if p, ok := scep.ProvisionerFromContext(ctx); ok {
+		ev.Provisioner = p.GetName()
+		ev.ProvisionerType = provisioner.TypeSCEP.String()
+	}
+	return audit.FromContext(ctx).Log(ev)
+}
+
+// observeOperation records the outcome of a SCEP operation in the metrics.
+// The outcome is failure if a CertRep failure message is returned.
+func observeOperation(ctx context.Context, operation string, res Response, err error) {
+	switch operation {
+	case opnGetCACert, opnGetCACaps, opnGetNextCACert, opnPKIOperation:
+	default:
+		operation = "unknown"
+	}
+	outcome := "success"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case res.Error != nil:
+		outcome = "failure"
+	}
+	metrix.FromContext(ctx).SCEPOperation(operation, outcome)
+}
+
 func formatCapabilities(caps []string) []byte {
 	return []byte(strings.Join(caps, "\r\n"))
 }
@@ -442,15 +522,36 @@ func writeResponse(w http.ResponseWriter, res Response) {
 	_, _ = w.Write(res.Data)
 }
 
+// fail writes the error using the status code of the error if it has one, or
+// a 500 otherwise.
 func fail(w http.ResponseWriter, err error) {
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		failWithStatus(w, sc.StatusCode(), err)
+		return
+	}
+	failWithStatus(w, http.StatusInternalServerError, err)
+}
+
+func failWithStatus(w http.ResponseWriter, status int, err error) {
 	log.Error(w, err)
 
-	http.Error(w, err.Error(), http.StatusInternalServerError)
+	http.Error(w, err.Error(), status)
+}
+
+// createErrorResponse creates a CertRep failure message with the failInfo of
+// the given error if it's a scep.FailInfoError. Any other error is returned.
+func createErrorResponse(ctx context.Context, csr *x509.CertificateRequest, msg *scep.PKIMessage, err error) (Response, error) {
+	var fie *scep.FailInfoError
+	if errors.As(err, &fie) {
+		return createFailureResponse(ctx, csr, msg, fie.FailInfo, err)
+	}
+	return Response{}, err
 }
 
-func createFailureResponse(ctx context.Context, csr *x509.CertificateRequest, msg *scep.PKIMessage, info microscep.FailInfo, failError error) (Response, error) {
+func createFailureResponse(ctx context.Context, csr *x509.CertificateRequest, msg *scep.PKIMessage, info scep.FailInfoName, failError error) (Response, error) {
 	auth := scep.MustFromContext(ctx)
-	certRepMsg, err := auth.CreateFailureResponse(ctx, csr, msg, scep.FailInfoName(info), failError.Error())
+	certRepMsg, err := auth.CreateFailureResponse(ctx, csr, msg, info, failError.Error())
 	if err != nil {
 		return Response{}, err
 	}
@@ -470,6 +571,8 @@ func contentHeader(r Response) string {
 			return "application/x-x509-ca-ra-cert"
 		}
 		return "application/x-x509-ca-cert"
+	case opnGetNextCACert:
+		return "application/x-x509-next-ca-cert"
 	case opnPKIOperation:
 		return "application/x-pki-message"
 	}
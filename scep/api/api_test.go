@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -13,8 +14,14 @@ import (
 	"testing"
 	"testing/iotest"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/authority"
+	"github.com/smallstep/certificates/authority/provisioner"
+	"github.com/smallstep/certificates/scep"
 )
 
 func Test_decodeRequest(t *testing.T) {
@@ -111,6 +118,17 @@ func Test_decodeRequest(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "ok/get-GetNextCACert",
+			args: args{
+				r: httptest.NewRequest(http.MethodGet, "http://scep:8080/?operation=GetNextCACert", http.NoBody),
+			},
+			want: request{
+				Operation: "GetNextCACert",
+				Message:   []byte{},
+			},
+			wantErr: false,
+		},
 		{
 			name: "ok/get-PKIOperation",
 			args: args{
@@ -181,3 +199,101 @@ func Test_decodeRequest(t *testing.T) {
 		})
 	}
 }
+
+func Test_lookupProvisioner(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+
+	provisioners := provisioner.NewCollection(provisioner.Audiences{})
+	require.NoError(t, provisioners.Store(&provisioner.SCEP{Type: "SCEP", Name: "scep"}))
+	require.NoError(t, provisioners.Store(&provisioner.SCEP{Type: "SCEP", Name: "scep/devices"}))
+	require.NoError(t, provisioners.Store(&provisioner.ACME{Type: "ACME", Name: "acme"}))
+	auth, err := authority.NewEmbedded(
+		authority.WithSkipInit(),
+		authority.WithX509RootCerts(ca.Root),
+		authority.WithX509Signer(ca.Intermediate, ca.Signer),
+		authority.WithProvisioners(provisioners),
+	)
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.MethodFunc(http.MethodGet, "/{provisionerName}", lookupProvisioner(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := scep.ProvisionerFromContext(r.Context())
+		require.True(t, ok)
+		w.Write([]byte(p.GetName()))
+	}))
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"ok", "/scep", http.StatusOK, "scep"},
+		{"ok escaped", "/" + url.PathEscape("scep/devices"), http.StatusOK, "scep/devices"},
+		{"fail not found", "/missing", http.StatusNotFound, "provisioner 'missing' not found\n"},
+		{"fail not scep", "/acme", http.StatusNotFound, "provisioner 'acme' is not a SCEP provisioner\n"},
+		{"fail unescape", "/scep%2", http.StatusBadRequest, "error url unescaping provisioner name 'scep%2'\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://scep:8080/", http.NoBody)
+			req.URL.Path = tt.path
+			req.URL.RawPath = tt.path
+			req = req.WithContext(authority.NewContext(req.Context(), auth))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			res := w.Result()
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+}
+
+func TestPost_disablePOSTPKIOperation(t *testing.T) {
+	p := &provisioner.SCEP{Type: "SCEP", Name: "scep", DisablePOSTPKIOperation: true}
+	req := httptest.NewRequest(http.MethodPost, "http://scep:8080/scep?operation=PKIOperation", strings.NewReader("message"))
+	req = req.WithContext(scep.NewProvisionerContext(req.Context(), p))
+	w := httptest.NewRecorder()
+	Post(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	assert.Equal(t, "scep post request failed: POST PKIOperation is not allowed\n", string(body))
+}
+
+func TestPost_errors(t *testing.T) {
+	p := &provisioner.SCEP{Type: "SCEP", Name: "scep"}
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"fail/no-operation", "http://scep:8080/scep", http.StatusBadRequest, "invalid scep post request: no operation provided\n"},
+		{"fail/unknown-operation", "http://scep:8080/scep?operation=GetCert", http.StatusBadRequest, "scep post request failed: unknown operation: GetCert\n"},
+		{"fail/invalid-message", "http://scep:8080/scep?operation=PKIOperation", http.StatusBadRequest, "scep post request failed: failed parsing SCEP message: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader("message"))
+			req = req.WithContext(scep.NewProvisionerContext(req.Context(), p))
+			w := httptest.NewRecorder()
+			Post(w, req)
+
+			res := w.Result()
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			assert.True(t, strings.HasPrefix(string(body), tt.wantBody), string(body))
+		})
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"net/url"
 	"sync"
 
 	microx509util "github.com/micromdm/scep/v2/cryptoutil/x509util"
 	microscep "github.com/micromdm/scep/v2/scep"
 	"go.mozilla.org/pkcs7"
+	"golang.org/x/exp/slices"
 
 	"go.step.sm/crypto/x509util"
 
@@ -81,7 +83,8 @@ func New(signAuth SignAuthority, opts Options) (*Authority, error) {
 
 // Validate validates if the SCEP Authority has a valid configuration.
 // The validation includes a check if a decrypter is available, either
-// an authority wide decrypter, or a provisioner specific decrypter.
+// an authority wide decrypter, or a provisioner specific decrypter, and
+// if its public key matches the one in the decrypter certificate.
 func (a *Authority) Validate() error {
 	if a == nil {
 		return nil
@@ -90,6 +93,12 @@ func (a *Authority) Validate() error {
 	a.provisionersMutex.RLock()
 	defer a.provisionersMutex.RUnlock()
 
+	if a.defaultDecrypter != nil && a.decrypterCertificate != nil {
+		if err := validateDecrypter(a.decrypterCertificate, a.defaultDecrypter); err != nil {
+			return fmt.Errorf("SCEP authority has an invalid default decrypter: %w", err)
+		}
+	}
+
 	noDefaultDecrypterAvailable := a.defaultDecrypter == nil
 	for _, name := range a.scepProvisionerNames {
 		p, err := a.LoadProvisionerByName(name)
@@ -105,12 +114,27 @@ func (a *Authority) Validate() error {
 			if decrypter == nil && noDefaultDecrypterAvailable {
 				return fmt.Errorf("SCEP provisioner %q does not have decrypter", name)
 			}
+			if cert != nil && decrypter != nil {
+				if err := validateDecrypter(cert, decrypter); err != nil {
+					return fmt.Errorf("SCEP provisioner %q has an invalid decrypter: %w", name, err)
+				}
+			}
 		}
 	}
 
 	return nil
 }
 
+// validateDecrypter checks that the public key of the decrypter matches the
+// public key of the decrypter certificate.
+func validateDecrypter(cert *x509.Certificate, decrypter crypto.Decrypter) error {
+	pub, ok := decrypter.Public().(comparablePublicKey)
+	if !ok || !pub.Equal(cert.PublicKey) {
+		return errors.New("mismatch between decrypter certificate and decrypter public keys")
+	}
+	return nil
+}
+
 // UpdateProvisioners updates the SCEP Authority with the new, and hopefully
 // current SCEP provisioners configured. This allows the Authority to be
 // validated with the latest data.
@@ -125,19 +149,6 @@ func (a *Authority) UpdateProvisioners(scepProvisionerNames []string) {
 	a.scepProvisionerNames = scepProvisionerNames
 }
 
-var (
-	// TODO: check the default capabilities; https://tools.ietf.org/html/rfc8894#section-3.5.2
-	defaultCapabilities = []string{
-		"Renewal", // NOTE: removing this will result in macOS SCEP client stating the server doesn't support renewal, but it uses PKCSreq to do so.
-		"SHA-1",
-		"SHA-256",
-		"AES",
-		"DES3",
-		"SCEPStandard",
-		"POSTPKIOperation",
-	}
-)
-
 // LoadProvisionerByName calls out to the SignAuthority interface to load a
 // provisioner by name.
 func (a *Authority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
@@ -183,11 +194,148 @@ func (a *Authority) GetCACertificates(ctx context.Context) (certs []*x509.Certif
 	return certs, nil
 }
 
-// DecryptPKIEnvelope decrypts an enveloped message
+// GetNextCACert returns the certificates of the CA that will replace the
+// current one in a degenerate certificates-only PKCS#7 signed by the current
+// CA, as described in https://tools.ietf.org/html/rfc8894#section-4.7.
+func (a *Authority) GetNextCACert(ctx context.Context) ([]byte, error) {
+	p := provisionerFromContext(ctx)
+
+	certs := p.GetNextCACertificates()
+	if len(certs) == 0 {
+		return nil, errors.New("no next CA certificate available")
+	}
+
+	deg, err := microscep.DegenerateCertificates(certs)
+	if err != nil {
+		return nil, fmt.Errorf("failed generating degenerate certificates: %w", err)
+	}
+
+	signedData, err := pkcs7.NewSignedData(deg)
+	if err != nil {
+		return nil, err
+	}
+
+	signerCert, signer, err := a.selectSigner(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed selecting signer: %w", err)
+	}
+	if err := signedData.AddSigner(signerCert, signer, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+
+	return signedData.Finish()
+}
+
+// ValidateRenewal authenticates a RenewalReq message using the certificate
+// that signed it. The certificate must have been issued by the CA for the
+// SCEP provisioner in the context, it must not be expired or revoked, its
+// subject must match the subject of the CSR, and the CSR cannot request SANs
+// that are not in the certificate. Rejected certificates are returned as a
+// FailInfoError.
+func (a *Authority) ValidateRenewal(ctx context.Context, csr *x509.CertificateRequest, msg *PKIMessage) error {
+	cert := msg.P7.GetOnlySigner()
+	if cert == nil {
+		return NewFailInfoError(BadRequest, errors.New("renewal request must be signed by a single certificate"))
+	}
+
+	roots := x509.NewCertPool()
+	for _, root := range a.roots {
+		roots.AddCert(root)
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range a.intermediates {
+		intermediates.AddCert(intermediate)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		var (
+			cie x509.CertificateInvalidError
+			uae x509.UnknownAuthorityError
+		)
+		switch {
+		case errors.As(err, &cie) && cie.Reason == x509.Expired:
+			return NewFailInfoError(BadTime, fmt.Errorf("failed verifying renewal certificate: %w", err))
+		case errors.As(err, &uae):
+			// The issuer of the certificate is not this CA.
+			return NewFailInfoError(BadCertID, fmt.Errorf("failed verifying renewal certificate: %w", err))
+		}
+		return NewFailInfoError(BadRequest, fmt.Errorf("failed verifying renewal certificate: %w", err))
+	}
+
+	if r, ok := a.signAuth.(interface {
+		IsRevoked(sn string) (bool, error)
+	}); ok {
+		revoked, err := r.IsRevoked(cert.SerialNumber.String())
+		if err != nil {
+			return fmt.Errorf("failed checking revocation of renewal certificate: %w", err)
+		}
+		if revoked {
+			return NewFailInfoError(BadRequest, errors.New("renewal certificate has been revoked"))
+		}
+	}
+
+	// The certificate must have been issued by this provisioner, the data
+	// stored with the certificate is used to find it.
+	l, ok := a.signAuth.(interface {
+		LoadProvisionerByCertificate(*x509.Certificate) (provisioner.Interface, error)
+	})
+	if !ok {
+		return NewFailInfoError(BadRequest, errors.New("renewal certificate provisioner cannot be verified"))
+	}
+	certProv, err := l.LoadProvisionerByCertificate(cert)
+	if err != nil {
+		return NewFailInfoError(BadRequest, fmt.Errorf("failed loading provisioner of renewal certificate: %w", err))
+	}
+	if p := provisionerFromContext(ctx); certProv.GetID() != p.GetID() {
+		return NewFailInfoError(BadRequest, fmt.Errorf("renewal certificate was not issued by provisioner %q", p.GetName()))
+	}
+
+	if csr.Subject.CommonName != cert.Subject.CommonName {
+		return NewFailInfoError(BadRequest, fmt.Errorf("renewal request subject %q does not match certificate subject %q",
+			csr.Subject.CommonName, cert.Subject.CommonName))
+	}
+	if err := validateRenewalSANs(csr, cert); err != nil {
+		return NewFailInfoError(BadRequest, err)
+	}
+
+	return nil
+}
+
+// validateRenewalSANs returns an error if the CSR contains SANs that are not
+// in the certificate being renewed.
+func validateRenewalSANs(csr *x509.CertificateRequest, cert *x509.Certificate) error {
+	for _, name := range csr.DNSNames {
+		if !slices.Contains(cert.DNSNames, name) {
+			return fmt.Errorf("renewal request DNS name %q is not in the certificate", name)
+		}
+	}
+	for _, email := range csr.EmailAddresses {
+		if !slices.Contains(cert.EmailAddresses, email) {
+			return fmt.Errorf("renewal request email address %q is not in the certificate", email)
+		}
+	}
+	for _, ip := range csr.IPAddresses {
+		if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+			return fmt.Errorf("renewal request IP address %q is not in the certificate", ip)
+		}
+	}
+	for _, u := range csr.URIs {
+		if !slices.ContainsFunc(cert.URIs, func(v *url.URL) bool { return v.String() == u.String() }) {
+			return fmt.Errorf("renewal request URI %q is not in the certificate", u)
+		}
+	}
+	return nil
+}
+
+// DecryptPKIEnvelope decrypts an enveloped message. Errors caused by the
+// contents of the message are returned as a FailInfoError.
 func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) error {
 	p7c, err := pkcs7.Parse(msg.P7.Content)
 	if err != nil {
-		return fmt.Errorf("error parsing pkcs7 content: %w", err)
+		return NewFailInfoError(BadMessageCheck, fmt.Errorf("error parsing pkcs7 content: %w", err))
 	}
 
 	cert, decrypter, err := a.selectDecrypter(ctx)
@@ -197,7 +345,7 @@ func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) err
 
 	envelope, err := p7c.Decrypt(cert, decrypter)
 	if err != nil {
-		return fmt.Errorf("error decrypting encrypted pkcs7 content: %w", err)
+		return NewFailInfoError(BadMessageCheck, fmt.Errorf("error decrypting encrypted pkcs7 content: %w", err))
 	}
 
 	msg.pkiEnvelope = envelope
@@ -206,22 +354,22 @@ func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) err
 	case microscep.CertRep:
 		certs, err := microscep.CACerts(msg.pkiEnvelope)
 		if err != nil {
-			return fmt.Errorf("error extracting CA certs from pkcs7 degenerate data: %w", err)
+			return NewFailInfoError(BadMessageCheck, fmt.Errorf("error extracting CA certs from pkcs7 degenerate data: %w", err))
 		}
 		msg.CertRepMessage.Certificate = certs[0]
 		return nil
 	case microscep.PKCSReq, microscep.UpdateReq, microscep.RenewalReq:
 		csr, err := x509.ParseCertificateRequest(msg.pkiEnvelope)
 		if err != nil {
-			return fmt.Errorf("parse CSR from pkiEnvelope: %w", err)
+			return NewFailInfoError(BadMessageCheck, fmt.Errorf("parse CSR from pkiEnvelope: %w", err))
 		}
 		if err := csr.CheckSignature(); err != nil {
-			return fmt.Errorf("invalid CSR signature; %w", err)
+			return NewFailInfoError(BadMessageCheck, fmt.Errorf("invalid CSR signature; %w", err))
 		}
 		// extract the challenge password
 		cp, err := microx509util.ParseChallengePassword(msg.pkiEnvelope)
 		if err != nil {
-			return fmt.Errorf("parse challenge password in pkiEnvelope: %w", err)
+			return NewFailInfoError(BadMessageCheck, fmt.Errorf("parse challenge password in pkiEnvelope: %w", err))
 		}
 		msg.CSRReqMessage = &microscep.CSRReqMessage{
 			RawDecrypted:      msg.pkiEnvelope,
@@ -230,7 +378,7 @@ func (a *Authority) DecryptPKIEnvelope(ctx context.Context, msg *PKIMessage) err
 		}
 		return nil
 	case microscep.GetCRL, microscep.GetCert, microscep.CertPoll:
-		return errors.New("not implemented")
+		return NewFailInfoError(BadRequest, fmt.Errorf("message type %s is not supported", msg.MessageType))
 	}
 
 	return nil
@@ -489,16 +637,61 @@ func (a *Authority) CreateFailureResponse(ctx context.Context, _ *x509.Certifica
 func (a *Authority) GetCACaps(ctx context.Context) []string {
 	p := provisionerFromContext(ctx)
 
-	caps := p.GetCapabilities()
-	if len(caps) == 0 {
-		return defaultCapabilities
+	// The capabilities configured in the provisioner override the ones
+	// derived from its configuration.
+	if caps := p.GetCapabilities(); len(caps) > 0 {
+		return caps
+	}
+
+	var caps []string
+
+	// PKIOperation requests can only be processed if a decrypter is
+	// available.
+	if _, decrypter, err := a.selectDecrypter(ctx); err == nil && decrypter != nil {
+		caps = pkiOperationCapabilities(p)
+	}
+
+	// GetNextCACert is only advertised during a CA rollover.
+	if len(p.GetNextCACertificates()) > 0 {
+		caps = append(caps, "GetNextCACert")
+	}
+
+	return caps
+}
+
+// pkiOperationCapabilities returns the capabilities related to PKIOperation
+// requests, as described in https://tools.ietf.org/html/rfc8894#section-3.5.2.
+func pkiOperationCapabilities(p Provisioner) []string {
+	var caps []string
+
+	// NOTE: not advertising Renewal results in the macOS SCEP client stating
+	// the server doesn't support renewal, but it uses PKCSreq to do so.
+	if p.AllowsRenewal() {
+		caps = append(caps, "Renewal")
+	}
+
+	// SHA-1 and DES3 are also advertised if some devices are allowed to use
+	// them.
+	for _, alg := range []string{"SHA-1", "SHA-256", "SHA-512"} {
+		if p.AllowsAlgorithm(alg) || (alg == "SHA-1" && p.HasLegacyDevices()) {
+			caps = append(caps, alg)
+		}
+	}
+	// AES stands for AES-128-CBC, but there is no capability for AES-256, so
+	// AES is also advertised if only AES-256 is allowed.
+	caps = append(caps, "AES")
+	if p.AllowsAlgorithm("DES3") || p.HasLegacyDevices() {
+		caps = append(caps, "DES3")
 	}
 
-	// TODO: validate the caps? Ensure they are the right format according to RFC?
-	// TODO: ensure that the capabilities are actually "enforced"/"verified" in code too:
-	// check that only parts of the spec are used in the implementation belonging to the capabilities.
-	// For example for renewals, which we could disable in the provisioner, should then also
-	// not be reported in cacaps operation.
+	if p.AllowsPOSTPKIOperation() {
+		caps = append(caps, "POSTPKIOperation")
+	}
+
+	// SCEPStandard implies AES, POSTPKIOperation and SHA-256.
+	if p.AllowsPOSTPKIOperation() && p.AllowsAlgorithm("SHA-256") {
+		caps = append(caps, "SCEPStandard")
+	}
 
 	return caps
 }
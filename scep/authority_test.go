@@ -1,16 +1,25 @@
 package scep
 
 import (
+	"context"
+	"crypto"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"testing"
+	"time"
 
+	microscep "github.com/micromdm/scep/v2/scep"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.mozilla.org/pkcs7"
 	"go.step.sm/crypto/keyutil"
 	"go.step.sm/crypto/minica"
 	"go.step.sm/crypto/randutil"
+
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 func generateContent(t *testing.T, size int) []byte {
@@ -71,3 +80,293 @@ func TestAuthority_encrypt(t *testing.T) {
 		})
 	}
 }
+
+type revokedSignAuthority struct {
+	SignAuthority
+	revoked      map[string]bool
+	provisioners map[string]provisioner.Interface
+}
+
+func (r *revokedSignAuthority) IsRevoked(sn string) (bool, error) {
+	return r.revoked[sn], nil
+}
+
+func (r *revokedSignAuthority) LoadProvisionerByCertificate(crt *x509.Certificate) (provisioner.Interface, error) {
+	if p, ok := r.provisioners[crt.SerialNumber.String()]; ok {
+		return p, nil
+	}
+	return nil, errors.New("unable to load provisioner from certificate")
+}
+
+func generateRenewalMessage(t *testing.T, ca *minica.CA, cn string, dnsNames ...string) (*PKIMessage, *x509.Certificate) {
+	t.Helper()
+	signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+	require.NoError(t, err)
+	cert, err := ca.Sign(&x509.Certificate{
+		PublicKey: signer.Public(),
+		Subject:   pkix.Name{CommonName: cn},
+		DNSNames:  dnsNames,
+	})
+	require.NoError(t, err)
+
+	sd, err := pkcs7.NewSignedData(generateContent(t, 32))
+	require.NoError(t, err)
+	require.NoError(t, sd.AddSigner(cert, signer, pkcs7.SignerInfoConfig{}))
+	b, err := sd.Finish()
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(b)
+	require.NoError(t, err)
+
+	return &PKIMessage{
+		TransactionID: "transaction-id",
+		MessageType:   microscep.RenewalReq,
+		P7:            p7,
+	}, cert
+}
+
+func TestAuthority_ValidateRenewal(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	untrusted, err := minica.New()
+	require.NoError(t, err)
+
+	p := &provisioner.SCEP{Name: "scep", Type: "SCEP"}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	other := &provisioner.SCEP{Name: "other", Type: "SCEP"}
+	require.NoError(t, other.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+
+	msg, cert := generateRenewalMessage(t, ca, "device", "device.example.com")
+	otherMsg, otherCert := generateRenewalMessage(t, ca, "device", "device.example.com")
+	signAuth := &revokedSignAuthority{
+		revoked: map[string]bool{},
+		provisioners: map[string]provisioner.Interface{
+			cert.SerialNumber.String():      p,
+			otherCert.SerialNumber.String(): other,
+		},
+	}
+	a := &Authority{
+		signAuth:      signAuth,
+		roots:         []*x509.Certificate{ca.Root},
+		intermediates: []*x509.Certificate{ca.Intermediate},
+	}
+	ctx := NewProvisionerContext(context.Background(), p)
+	csr := func(cn string, dnsNames ...string) *x509.CertificateRequest {
+		return &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}
+	}
+
+	assert.NoError(t, a.ValidateRenewal(ctx, csr("device"), msg))
+	assert.NoError(t, a.ValidateRenewal(ctx, csr("device", "device.example.com"), msg))
+	assert.EqualError(t, a.ValidateRenewal(ctx, csr("other"), msg),
+		`renewal request subject "other" does not match certificate subject "device"`)
+	assert.EqualError(t, a.ValidateRenewal(ctx, csr("device", "device.example.com", "admin.example.com"), msg),
+		`renewal request DNS name "admin.example.com" is not in the certificate`)
+
+	// The certificate must have been issued by the same provisioner.
+	assert.EqualError(t, a.ValidateRenewal(ctx, csr("device"), otherMsg),
+		`renewal certificate was not issued by provisioner "scep"`)
+	unknownMsg, _ := generateRenewalMessage(t, ca, "device")
+	assert.ErrorContains(t, a.ValidateRenewal(ctx, csr("device"), unknownMsg), "failed loading provisioner of renewal certificate")
+
+	untrustedMsg, _ := generateRenewalMessage(t, untrusted, "device")
+	err = a.ValidateRenewal(ctx, csr("device"), untrustedMsg)
+	assert.ErrorContains(t, err, "failed verifying renewal certificate")
+	var fie *FailInfoError
+	if assert.ErrorAs(t, err, &fie) {
+		assert.Equal(t, BadCertID, fie.FailInfo)
+	}
+
+	signAuth.revoked[cert.SerialNumber.String()] = true
+	err = a.ValidateRenewal(ctx, csr("device"), msg)
+	assert.EqualError(t, err, "renewal certificate has been revoked")
+	if assert.ErrorAs(t, err, &fie) {
+		assert.Equal(t, BadRequest, fie.FailInfo)
+	}
+}
+
+type mockSignAuthority struct {
+	SignAuthority
+	provisioners map[string]provisioner.Interface
+}
+
+func (m *mockSignAuthority) LoadProvisionerByName(name string) (provisioner.Interface, error) {
+	if p, ok := m.provisioners[name]; ok {
+		return p, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestAuthority_Validate(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	decrypter, err := keyutil.GenerateSigner("RSA", "", 2048)
+	require.NoError(t, err)
+	decrypterCert, err := ca.Sign(&x509.Certificate{
+		PublicKey: decrypter.Public(),
+		Subject:   pkix.Name{CommonName: "SCEP Decrypter"},
+	})
+	require.NoError(t, err)
+	otherCert := generateRecipients(t)[0]
+
+	p := &provisioner.SCEP{Name: "scep", Type: "SCEP"}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	signAuth := &mockSignAuthority{provisioners: map[string]provisioner.Interface{"scep": p}}
+
+	tests := []struct {
+		name    string
+		a       *Authority
+		wantErr string
+	}{
+		{"ok", &Authority{
+			signAuth:             signAuth,
+			defaultDecrypter:     decrypter.(crypto.Decrypter),
+			decrypterCertificate: decrypterCert,
+			scepProvisionerNames: []string{"scep"},
+		}, ""},
+		{"ok nil", nil, ""},
+		{"fail mismatch", &Authority{
+			signAuth:             signAuth,
+			defaultDecrypter:     decrypter.(crypto.Decrypter),
+			decrypterCertificate: otherCert,
+			scepProvisionerNames: []string{"scep"},
+		}, "SCEP authority has an invalid default decrypter: mismatch between decrypter certificate and decrypter public keys"},
+		{"fail no decrypter", &Authority{
+			signAuth:             signAuth,
+			scepProvisionerNames: []string{"scep"},
+		}, `SCEP provisioner "scep" does not have a decrypter certificate`},
+		{"fail provisioner", &Authority{
+			signAuth:             signAuth,
+			scepProvisionerNames: []string{"missing"},
+		}, `failed loading provisioner "missing": not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.a.Validate()
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthority_DecryptPKIEnvelope(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	decrypter, err := keyutil.GenerateSigner("RSA", "", 2048)
+	require.NoError(t, err)
+	decrypterCert, err := ca.Sign(&x509.Certificate{
+		PublicKey: decrypter.Public(),
+		Subject:   pkix.Name{CommonName: "SCEP Decrypter"},
+	})
+	require.NoError(t, err)
+	a := &Authority{
+		defaultDecrypter:     decrypter.(crypto.Decrypter),
+		decrypterCertificate: decrypterCert,
+	}
+	p := &provisioner.SCEP{Name: "scep", Type: "SCEP"}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	ctx := NewProvisionerContext(context.Background(), p)
+
+	// The envelope is encrypted for a different recipient.
+	msg := generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.EncryptionAlgorithmAES128CBC, nil)
+	err = a.DecryptPKIEnvelope(ctx, msg)
+	var fie *FailInfoError
+	if assert.ErrorAs(t, err, &fie) {
+		assert.Equal(t, BadMessageCheck, fie.FailInfo)
+	}
+	assert.ErrorContains(t, err, "error decrypting encrypted pkcs7 content")
+
+	msg.P7.Content = []byte("foo")
+	err = a.DecryptPKIEnvelope(ctx, msg)
+	if assert.ErrorAs(t, err, &fie) {
+		assert.Equal(t, BadMessageCheck, fie.FailInfo)
+	}
+	assert.ErrorContains(t, err, "error parsing pkcs7 content")
+}
+
+func TestAuthority_GetNextCACert(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	next, err := minica.New()
+	require.NoError(t, err)
+	bundle := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: next.Intermediate.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: next.Root.Raw})...)
+	signer, err := keyutil.GenerateSigner("EC", "P-256", 0)
+	require.NoError(t, err)
+	signerCert, err := ca.Sign(&x509.Certificate{
+		PublicKey: signer.Public(),
+		Subject:   pkix.Name{CommonName: "SCEP Signer"},
+	})
+	require.NoError(t, err)
+
+	a := &Authority{
+		defaultSigner:     signer,
+		signerCertificate: signerCert,
+	}
+
+	p := &provisioner.SCEP{Name: "scep", Type: "SCEP", NextCACertificates: bundle}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	ctx := NewProvisionerContext(context.Background(), p)
+	assert.Contains(t, a.GetCACaps(ctx), "GetNextCACert")
+
+	b, err := a.GetNextCACert(ctx)
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(b)
+	require.NoError(t, err)
+	require.NoError(t, p7.Verify())
+	assert.Equal(t, signerCert, p7.GetOnlySigner())
+	certs, err := microscep.CACerts(p7.Content)
+	require.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{next.Intermediate, next.Root}, certs)
+
+	p = &provisioner.SCEP{Name: "scep", Type: "SCEP"}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	ctx = NewProvisionerContext(context.Background(), p)
+	assert.NotContains(t, a.GetCACaps(ctx), "GetNextCACert")
+	_, err = a.GetNextCACert(ctx)
+	assert.EqualError(t, err, "no next CA certificate available")
+}
+
+func TestAuthority_GetCACaps(t *testing.T) {
+	ca, err := minica.New()
+	require.NoError(t, err)
+	decrypter, err := keyutil.GenerateSigner("RSA", "", 2048)
+	require.NoError(t, err)
+	decrypterCert, err := ca.Sign(&x509.Certificate{
+		PublicKey: decrypter.Public(),
+		Subject:   pkix.Name{CommonName: "SCEP Decrypter"},
+	})
+	require.NoError(t, err)
+	a := &Authority{
+		defaultDecrypter:     decrypter.(crypto.Decrypter),
+		decrypterCertificate: decrypterCert,
+	}
+
+	tests := []struct {
+		name string
+		a    *Authority
+		p    *provisioner.SCEP
+		want []string
+	}{
+		{"default", a, &provisioner.SCEP{}, []string{"Renewal", "SHA-256", "SHA-512", "AES", "POSTPKIOperation", "SCEPStandard"}},
+		{"legacy", a, &provisioner.SCEP{LegacyDevices: []provisioner.SCEPLegacyDevice{
+			{Subject: "printer", ExpiresAt: time.Now().Add(time.Hour)},
+		}}, []string{"Renewal", "SHA-1", "SHA-256", "SHA-512", "AES", "DES3", "POSTPKIOperation", "SCEPStandard"}},
+		{"weak", a, &provisioner.SCEP{MinimumHashAlgorithm: "SHA-1", MinimumEncryptionAlgorithm: "DES3"},
+			[]string{"Renewal", "SHA-1", "SHA-256", "SHA-512", "AES", "DES3", "POSTPKIOperation", "SCEPStandard"}},
+		{"strict", a, &provisioner.SCEP{MinimumHashAlgorithm: "SHA-512", MinimumEncryptionAlgorithm: "AES-256", DisableRenewal: true},
+			[]string{"SHA-512", "AES", "POSTPKIOperation"}},
+		{"no-post", a, &provisioner.SCEP{DisablePOSTPKIOperation: true}, []string{"Renewal", "SHA-256", "SHA-512", "AES"}},
+		{"override", a, &provisioner.SCEP{Capabilities: []string{"SHA-256", "AES"}}, []string{"SHA-256", "AES"}},
+		{"no-decrypter", &Authority{}, &provisioner.SCEP{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.p.Name, tt.p.Type = "scep", "SCEP"
+			require.NoError(t, tt.p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+			ctx := NewProvisionerContext(context.Background(), tt.p)
+			assert.Equal(t, tt.want, tt.a.GetCACaps(ctx))
+		})
+	}
+}
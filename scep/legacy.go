@@ -0,0 +1,164 @@
+package scep
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+
+	"github.com/smallstep/certificates/audit"
+)
+
+// ErrLegacyAlgorithm is the error returned when a request uses an algorithm
+// weaker than the ones allowed by the provisioner, like SHA-1, DES or 3DES,
+// and the device is not allowed to use them.
+var ErrLegacyAlgorithm = errors.New("legacy algorithms are not allowed")
+
+// legacyAlgorithmNames are the algorithms that the devices listed in the
+// provisioner are allowed to use regardless of the minimum algorithms.
+var legacyAlgorithmNames = []string{"MD5", "SHA-1", "DES", "DES3"}
+
+// envelopeContentInfo and envelopedData are the parts of the PKCS#7 enveloped
+// data required to get the content encryption algorithm.
+type envelopeContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       asn1.RawValue
+	EncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	}
+}
+
+// ValidateAlgorithms rejects the requests using algorithms weaker than the
+// ones allowed by the provisioner. Requests signed using SHA-1, or encrypted
+// using DES or 3DES, are accepted if the provisioner allows the device that
+// created the CSR to use them. Every request allowed to use them is written to
+// the audit log.
+func (a *Authority) ValidateAlgorithms(ctx context.Context, msg *PKIMessage) error {
+	algorithms, err := messageAlgorithms(msg)
+	if err != nil {
+		return NewFailInfoError(BadMessageCheck, err)
+	}
+
+	p := provisionerFromContext(ctx)
+	var weak []string
+	legacy := true
+	for _, alg := range algorithms {
+		if !p.AllowsAlgorithm(alg) {
+			weak = append(weak, alg)
+			legacy = legacy && contains(legacyAlgorithmNames, alg)
+		}
+	}
+	if len(weak) == 0 {
+		return nil
+	}
+
+	var csr *x509.CertificateRequest
+	if msg.CSRReqMessage != nil {
+		csr = msg.CSRReqMessage.CSR
+	}
+
+	if !legacy || !p.AllowsLegacyAlgorithms(csr) {
+		return NewFailInfoError(BadAlg, fmt.Errorf("%w: request uses %s", ErrLegacyAlgorithm, strings.Join(weak, ", ")))
+	}
+
+	return audit.FromContext(ctx).Log(&audit.Event{
+		Type:            audit.SCEPLegacyAlgorithms,
+		Provisioner:     p.GetName(),
+		ProvisionerType: "SCEP",
+		Subject:         csr.Subject.CommonName,
+		Details: map[string]string{
+			"algorithms":    strings.Join(weak, ", "),
+			"serialNumber":  csr.Subject.SerialNumber,
+			"transactionID": string(msg.TransactionID),
+		},
+	})
+}
+
+// messageAlgorithms returns the hash algorithms used in the signature of the
+// message and the CSR, and the content encryption algorithm used in the
+// envelope of the message.
+func messageAlgorithms(msg *PKIMessage) ([]string, error) {
+	var algorithms []string
+	add := func(name string) {
+		if !contains(algorithms, name) {
+			algorithms = append(algorithms, name)
+		}
+	}
+
+	for _, si := range msg.P7.Signers {
+		switch alg := si.DigestAlgorithm.Algorithm; {
+		case alg.Equal(pkcs7.OIDDigestAlgorithmSHA1):
+			add("SHA-1")
+		case alg.Equal(pkcs7.OIDDigestAlgorithmSHA256):
+			add("SHA-256")
+		case alg.Equal(pkcs7.OIDDigestAlgorithmSHA384):
+			add("SHA-384")
+		case alg.Equal(pkcs7.OIDDigestAlgorithmSHA512):
+			add("SHA-512")
+		}
+		switch alg := si.DigestEncryptionAlgorithm.Algorithm; {
+		case alg.Equal(pkcs7.OIDEncryptionAlgorithmRSAMD5):
+			add("MD5")
+		case alg.Equal(pkcs7.OIDEncryptionAlgorithmRSASHA1),
+			alg.Equal(pkcs7.OIDDigestAlgorithmECDSASHA1),
+			alg.Equal(pkcs7.OIDDigestAlgorithmDSASHA1):
+			add("SHA-1")
+		}
+	}
+
+	var ci envelopeContentInfo
+	if _, err := asn1.Unmarshal(msg.P7.Content, &ci); err != nil {
+		return nil, fmt.Errorf("error parsing pkcs7 envelope: %w", err)
+	}
+	var ed envelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		return nil, fmt.Errorf("error parsing pkcs7 enveloped data: %w", err)
+	}
+	switch alg := ed.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm; {
+	case alg.Equal(pkcs7.OIDEncryptionAlgorithmDESCBC):
+		add("DES")
+	case alg.Equal(pkcs7.OIDEncryptionAlgorithmDESEDE3CBC):
+		add("DES3")
+	case alg.Equal(pkcs7.OIDEncryptionAlgorithmAES128CBC), alg.Equal(pkcs7.OIDEncryptionAlgorithmAES128GCM):
+		add("AES-128")
+	case alg.Equal(pkcs7.OIDEncryptionAlgorithmAES256CBC), alg.Equal(pkcs7.OIDEncryptionAlgorithmAES256GCM):
+		add("AES-256")
+	}
+
+	if msg.CSRReqMessage != nil && msg.CSRReqMessage.CSR != nil {
+		switch msg.CSRReqMessage.CSR.SignatureAlgorithm {
+		case x509.MD5WithRSA:
+			add("MD5")
+		case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+			add("SHA-1")
+		case x509.SHA256WithRSA, x509.SHA256WithRSAPSS, x509.DSAWithSHA256, x509.ECDSAWithSHA256:
+			add("SHA-256")
+		case x509.SHA384WithRSA, x509.SHA384WithRSAPSS, x509.ECDSAWithSHA384:
+			add("SHA-384")
+		case x509.SHA512WithRSA, x509.SHA512WithRSAPSS, x509.ECDSAWithSHA512:
+			add("SHA-512")
+		}
+	}
+
+	return algorithms, nil
+}
+
+func contains(list []string, name string) bool {
+	for _, v := range list {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package scep
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	microscep "github.com/micromdm/scep/v2/scep"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mozilla.org/pkcs7"
+	"go.step.sm/crypto/keyutil"
+	"go.step.sm/crypto/minica"
+
+	"github.com/smallstep/certificates/audit"
+	"github.com/smallstep/certificates/authority/config"
+	"github.com/smallstep/certificates/authority/provisioner"
+)
+
+func generateLegacyMessage(t *testing.T, digest asn1.ObjectIdentifier, encryption int, csr *x509.CertificateRequest) *PKIMessage {
+	t.Helper()
+
+	ca, err := minica.New()
+	require.NoError(t, err)
+	signer, err := keyutil.GenerateSigner("RSA", "", 2048)
+	require.NoError(t, err)
+	cert, err := ca.Sign(&x509.Certificate{
+		PublicKey: signer.Public(),
+		Subject:   pkix.Name{CommonName: "Test SCEP Client"},
+	})
+	require.NoError(t, err)
+
+	a := &Authority{}
+	envelope, err := a.encrypt(generateContent(t, 32), generateRecipients(t), encryption)
+	require.NoError(t, err)
+
+	sd, err := pkcs7.NewSignedData(envelope)
+	require.NoError(t, err)
+	sd.SetDigestAlgorithm(digest)
+	require.NoError(t, sd.AddSigner(cert, signer, pkcs7.SignerInfoConfig{}))
+	b, err := sd.Finish()
+	require.NoError(t, err)
+	p7, err := pkcs7.Parse(b)
+	require.NoError(t, err)
+
+	return &PKIMessage{
+		TransactionID: "transaction-id",
+		MessageType:   microscep.PKCSReq,
+		P7:            p7,
+		CSRReqMessage: &microscep.CSRReqMessage{CSR: csr},
+	}
+}
+
+func generateLegacyCSR(t *testing.T, cn, serialNumber string) *x509.CertificateRequest {
+	t.Helper()
+	signer, err := keyutil.GenerateSigner("RSA", "", 2048)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: cn, SerialNumber: serialNumber},
+	}, signer)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	require.NoError(t, err)
+	return csr
+}
+
+func Test_messageAlgorithms(t *testing.T) {
+	csr := generateLegacyCSR(t, "printer", "")
+	tests := []struct {
+		name string
+		msg  *PKIMessage
+		want []string
+	}{
+		{"ok/modern", generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.EncryptionAlgorithmAES128CBC, csr), []string{"SHA-256", "AES-128"}},
+		{"ok/sha512", generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA512, pkcs7.EncryptionAlgorithmAES256GCM, csr), []string{"SHA-512", "AES-256", "SHA-256"}},
+		{"ok/sha1", generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.EncryptionAlgorithmAES256CBC, csr), []string{"SHA-1", "AES-256", "SHA-256"}},
+		{"ok/des", generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.EncryptionAlgorithmDESCBC, csr), []string{"SHA-256", "DES"}},
+		{"ok/sha1-des", generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.EncryptionAlgorithmDESCBC, csr), []string{"SHA-1", "DES", "SHA-256"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := messageAlgorithms(tt.msg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("fail/envelope", func(t *testing.T) {
+		msg := generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.EncryptionAlgorithmAES128CBC, csr)
+		msg.P7.Content = []byte("foo")
+		_, err := messageAlgorithms(msg)
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthority_ValidateAlgorithms(t *testing.T) {
+	p := &provisioner.SCEP{
+		Name: "scep",
+		Type: "SCEP",
+		LegacyDevices: []provisioner.SCEPLegacyDevice{
+			{Subject: "printer", ExpiresAt: time.Now().Add(time.Hour)},
+			{SerialNumber: "1234", ExpiresAt: time.Now().Add(-time.Hour)},
+		},
+	}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	strict := &provisioner.SCEP{
+		Name:                       "strict",
+		Type:                       "SCEP",
+		MinimumHashAlgorithm:       "SHA-256",
+		MinimumEncryptionAlgorithm: "AES-256",
+		LegacyDevices: []provisioner.SCEPLegacyDevice{
+			{Subject: "printer", ExpiresAt: time.Now().Add(time.Hour)},
+		},
+	}
+	require.NoError(t, strict.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+	a := &Authority{}
+
+	modern := generateLegacyCSR(t, "phone", "")
+	allowed := generateLegacyCSR(t, "printer", "")
+	expired := generateLegacyCSR(t, "scanner", "1234")
+
+	tests := []struct {
+		name    string
+		p       Provisioner
+		msg     *PKIMessage
+		wantErr bool
+	}{
+		{"ok/modern", p, generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.EncryptionAlgorithmAES128CBC, modern), false},
+		{"ok/allowed", p, generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.EncryptionAlgorithmDESCBC, allowed), false},
+		{"ok/strict", strict, generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA512, pkcs7.EncryptionAlgorithmAES256CBC, modern), false},
+		{"ok/strict-allowed", strict, generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.EncryptionAlgorithmDESCBC, allowed), false},
+		{"fail/not-allowed", p, generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.EncryptionAlgorithmAES128CBC, modern), true},
+		{"fail/expired", p, generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.EncryptionAlgorithmDESCBC, expired), true},
+		{"fail/strict", strict, generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.EncryptionAlgorithmAES128GCM, modern), true},
+		{"fail/strict-not-legacy", strict, generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.EncryptionAlgorithmAES128CBC, allowed), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewProvisionerContext(context.Background(), tt.p)
+			err := a.ValidateAlgorithms(ctx, tt.msg)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrLegacyAlgorithm)
+				var fie *FailInfoError
+				if assert.ErrorAs(t, err, &fie) {
+					assert.Equal(t, BadAlg, fie.FailInfo)
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthority_ValidateAlgorithms_audit(t *testing.T) {
+	p := &provisioner.SCEP{
+		Name: "scep",
+		Type: "SCEP",
+		LegacyDevices: []provisioner.SCEPLegacyDevice{
+			{Subject: "printer", ExpiresAt: time.Now().Add(time.Hour)},
+		},
+	}
+	require.NoError(t, p.Init(provisioner.Config{Claims: config.GlobalProvisionerClaims}))
+
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := audit.NewFileSink(filename)
+	require.NoError(t, err)
+	l := audit.New(nil, sink)
+	ctx := audit.NewContext(context.Background(), l)
+	ctx = NewProvisionerContext(ctx, p)
+
+	a := &Authority{}
+	modern := generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA256, pkcs7.EncryptionAlgorithmAES128CBC, generateLegacyCSR(t, "phone", ""))
+	require.NoError(t, a.ValidateAlgorithms(ctx, modern))
+	legacy := generateLegacyMessage(t, pkcs7.OIDDigestAlgorithmSHA1, pkcs7.EncryptionAlgorithmDESCBC, generateLegacyCSR(t, "printer", ""))
+	require.NoError(t, a.ValidateAlgorithms(ctx, legacy))
+	require.NoError(t, l.Close())
+
+	// Only the request using legacy algorithms is audited.
+	b, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	var ev audit.Event
+	require.NoError(t, json.Unmarshal(b, &ev))
+	assert.Equal(t, audit.SCEPLegacyAlgorithms, ev.Type)
+	assert.Equal(t, "scep", ev.Provisioner)
+	assert.Equal(t, "SCEP", ev.ProvisionerType)
+	assert.Equal(t, "printer", ev.Subject)
+	assert.Equal(t, string(legacy.TransactionID), ev.Details["transactionID"])
+	assert.NotEmpty(t, ev.Details["algorithms"])
+}
@@ -20,6 +20,12 @@ type Provisioner interface {
 	GetDecrypter() (*x509.Certificate, crypto.Decrypter)
 	GetSigner() (*x509.Certificate, crypto.Signer)
 	GetContentEncryptionAlgorithm() int
+	GetNextCACertificates() []*x509.Certificate
+	HasLegacyDevices() bool
+	AllowsLegacyAlgorithms(csr *x509.CertificateRequest) bool
+	AllowsAlgorithm(name string) bool
+	AllowsRenewal() bool
+	AllowsPOSTPKIOperation() bool
 	ValidateChallenge(ctx context.Context, csr *x509.CertificateRequest, challenge, transactionID string) error
 	NotifySuccess(ctx context.Context, csr *x509.CertificateRequest, cert *x509.Certificate, transactionID string) error
 	NotifyFailure(ctx context.Context, csr *x509.CertificateRequest, transactionID string, errorCode int, errorDescription string) error
@@ -39,6 +45,13 @@ func provisionerFromContext(ctx context.Context) Provisioner {
 	return p
 }
 
+// NewProvisionerContext adds the given SCEP provisioner to the context.
 func NewProvisionerContext(ctx context.Context, p Provisioner) context.Context {
 	return context.WithValue(ctx, provisionerKey{}, p)
 }
+
+// ProvisionerFromContext returns the SCEP provisioner from the given context.
+func ProvisionerFromContext(ctx context.Context) (p Provisioner, ok bool) {
+	p, ok = ctx.Value(provisionerKey{}).(Provisioner)
+	return
+}
@@ -12,6 +12,38 @@ import (
 // FailInfoName models the name/value of failInfo
 type FailInfoName microscep.FailInfo
 
+// The failInfo values defined in https://tools.ietf.org/html/rfc8894#section-3.2.1.4.
+const (
+	BadAlg          = FailInfoName(microscep.BadAlg)
+	BadMessageCheck = FailInfoName(microscep.BadMessageCheck)
+	BadRequest      = FailInfoName(microscep.BadRequest)
+	BadTime         = FailInfoName(microscep.BadTime)
+	BadCertID       = FailInfoName(microscep.BadCertID)
+)
+
+// FailInfoError is an error that is returned to the SCEP client in a CertRep
+// message with the given failInfo.
+type FailInfoError struct {
+	FailInfo FailInfoName
+	Err      error
+}
+
+// NewFailInfoError returns a new FailInfoError with the given failInfo and
+// error.
+func NewFailInfoError(info FailInfoName, err error) *FailInfoError {
+	return &FailInfoError{FailInfo: info, Err: err}
+}
+
+// Error implements the error interface.
+func (e *FailInfoError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *FailInfoError) Unwrap() error {
+	return e.Err
+}
+
 // FailInfo models a failInfo object consisting of a
 // name/identifier and a failInfoText, the latter of
 // which can be more descriptive and is intended to be
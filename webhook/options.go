@@ -22,6 +22,17 @@ func NewRequestBody(options ...RequestBodyOption) (*RequestBody, error) {
 	return rb, nil
 }
 
+func WithProvisioner(id, name, typ string) RequestBodyOption {
+	return func(rb *RequestBody) error {
+		rb.Provisioner = &ProvisionerInfo{
+			ID:   id,
+			Name: name,
+			Type: typ,
+		}
+		return nil
+	}
+}
+
 func WithX509CertificateRequest(cr *x509.CertificateRequest) RequestBodyOption {
 	return func(rb *RequestBody) error {
 		rb.X509CertificateRequest = &X509CertificateRequest{
@@ -68,6 +79,13 @@ func WithAttestationData(data *AttestationData) RequestBodyOption {
 	}
 }
 
+func WithDeviceAttestationData(data *DeviceAttestationData) RequestBodyOption {
+	return func(rb *RequestBody) error {
+		rb.DeviceAttestationData = data
+		return nil
+	}
+}
+
 func WithAuthorizationPrincipal(p string) RequestBodyOption {
 	return func(rb *RequestBody) error {
 		rb.AuthorizationPrincipal = p
@@ -32,6 +32,17 @@ func TestNewRequestBody(t *testing.T) {
 		wantErr bool
 	}
 	tests := map[string]test{
+		"Provisioner": {
+			options: []RequestBodyOption{WithProvisioner("prov-id", "my-provisioner", "JWK")},
+			want: &RequestBody{
+				Provisioner: &ProvisionerInfo{
+					ID:   "prov-id",
+					Name: "my-provisioner",
+					Type: "JWK",
+				},
+			},
+			wantErr: false,
+		},
 		"Permanent Identifier": {
 			options: []RequestBodyOption{WithAttestationData(&AttestationData{PermanentIdentifier: "mydevice123"})},
 			want: &RequestBody{
@@ -11,6 +11,30 @@ import (
 type ResponseBody struct {
 	Data  any  `json:"data"`
 	Allow bool `json:"allow"`
+	// Decision is the optional structured decision returned by authorizing
+	// webhooks. Enriching webhooks can use its reason to explain a denial.
+	Decision *Decision `json:"decision,omitempty"`
+}
+
+// Decision is the structured decision returned by authorizing webhooks. The
+// reason is always recorded by the CA, but the modifications are only applied
+// if the webhook is allowed to mutate certificates.
+type Decision struct {
+	// Reason is a human-readable explanation of the decision. If the request is
+	// not allowed it will be part of the error returned by the CA.
+	Reason string `json:"reason,omitempty"`
+	// SANs, if set, is the subset of the requested subject alternative names
+	// that will be included in the certificate. Names not present in the
+	// request cannot be added.
+	SANs []string `json:"sans,omitempty"`
+	// NotAfter, if set, is the new expiration of the certificate. It can only
+	// shorten the requested lifetime.
+	NotAfter time.Time `json:"notAfter,omitempty"`
+}
+
+// HasModifications returns true if the decision modifies the certificate.
+func (d *Decision) HasModifications() bool {
+	return d != nil && (len(d.SANs) > 0 || !d.NotAfter.IsZero())
 }
 
 // X509CertificateRequest is the certificate request sent to webhook servers for
@@ -57,6 +81,33 @@ type AttestationData struct {
 	PermanentIdentifier string `json:"permanentIdentifier"`
 }
 
+// DeviceAttestationData is the data attested by a device in an acme
+// device-attest-01 challenge. It is sent to device attestation webhooks before
+// the challenge is marked as valid.
+type DeviceAttestationData struct {
+	// Format is the attestation format, apple, step, tpm or android-key.
+	Format string `json:"format"`
+	// Identifier is the permanent identifier requested in the order.
+	Identifier string `json:"identifier"`
+	// PermanentIdentifiers are the identifiers attested by the device, like
+	// serial numbers, UDIDs, IMEIs or TPM EK identifiers.
+	PermanentIdentifiers []string `json:"permanentIdentifiers,omitempty"`
+	// SerialNumber is the attested serial number of the device, if any.
+	SerialNumber string `json:"serialNumber,omitempty"`
+	// UDID is the attested unique device identifier of an Apple device.
+	UDID string `json:"udid,omitempty"`
+	// Fingerprint is the fingerprint of the attested key.
+	Fingerprint string `json:"fingerprint"`
+	// Certificate is the DER encoded attestation certificate.
+	Certificate []byte `json:"certificate,omitempty"`
+	// EKCertificate is the DER encoded TPM endorsement key certificate, if the
+	// TPM endorsement roots are configured.
+	EKCertificate []byte `json:"ekCertificate,omitempty"`
+	// EKIssuerSerial identifies the TPM endorsement key certificate with the
+	// SHA-256 hash of its issuer and its serial number.
+	EKIssuerSerial string `json:"ekIssuerSerial,omitempty"`
+}
+
 // X5CCertificate is the authorization certificate sent to webhook servers for
 // enriching or authorizing webhooks when signing X509 or SSH certificates using
 // the X5C provisioner.
@@ -68,11 +119,24 @@ type X5CCertificate struct {
 	NotAfter           time.Time `json:"notAfter"`
 }
 
+// ProvisionerInfo is the provisioner that authorized the request sent to
+// webhook servers.
+type ProvisionerInfo struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
 // RequestBody is the body sent to webhook servers.
 type RequestBody struct {
 	Timestamp time.Time `json:"timestamp"`
+	// Set for all the requests sent by a provisioner
+	Provisioner *ProvisionerInfo `json:"provisioner,omitempty"`
 	// Only set after successfully completing acme device-attest-01 challenge
 	AttestationData *AttestationData `json:"attestationData,omitempty"`
+	// Only set for device attestation webhooks while validating an acme
+	// device-attest-01 challenge
+	DeviceAttestationData *DeviceAttestationData `json:"deviceAttestationData,omitempty"`
 	// Set for most provisioners, but not acme or scep
 	// Token any `json:"token,omitempty"`
 	// Exactly one of the remaining fields should be set